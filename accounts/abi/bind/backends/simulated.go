@@ -788,12 +788,19 @@ func (fb *filterBackend) GetLogs(ctx context.Context, hash common.Hash) ([][]*ty
 	return logs, nil
 }
 
+func (fb *filterBackend) GetSnailBlock(ctx context.Context, hash common.Hash) (*types.SnailBlock, error) {
+	return nil, nil
+}
+
 func (fb *filterBackend) SubscribeNewTxsEvent(ch chan<- types.NewTxsEvent) event.Subscription {
 	return nullSubscription()
 }
 func (fb *filterBackend) SubscribeChainEvent(ch chan<- types.FastChainEvent) event.Subscription {
 	return fb.bc.SubscribeChainEvent(ch)
 }
+func (fb *filterBackend) SubscribeSnailChainEvent(ch chan<- types.SnailChainEvent) event.Subscription {
+	return nullSubscription()
+}
 func (fb *filterBackend) SubscribeRemovedLogsEvent(ch chan<- types.RemovedLogsEvent) event.Subscription {
 	return fb.bc.SubscribeRemovedLogsEvent(ch)
 }
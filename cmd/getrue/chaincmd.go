@@ -20,6 +20,7 @@ import (
 	"truechain/discovery/etrue/downloader"
 	"truechain/discovery/etruedb"
 	"truechain/discovery/event"
+	"truechain/discovery/les"
 	"truechain/discovery/log"
 	"truechain/discovery/trie"
 
@@ -34,6 +35,7 @@ var (
 		ArgsUsage: "<genesisPath>",
 		Flags: []cli.Flag{
 			utils.DataDirFlag,
+			utils.LightFreezerFlag,
 			//utils.LightModeFlag,
 		},
 		Category: "BLOCKCHAIN COMMANDS",
@@ -183,6 +185,12 @@ func initGenesis(ctx *cli.Context) error {
 		if err != nil {
 			utils.Fatalf("Failed to open database: %v", err)
 		}
+		// The headers frozen by the light client are read the same way it does
+		if name == "lightchaindata" && ctx.GlobalBool(utils.LightFreezerFlag.Name) {
+			if chaindb, err = les.NewFreezerDB(chaindb); err != nil {
+				utils.Fatalf("Failed to open header freezer: %v", err)
+			}
+		}
 		_, fastHash, snailHash, genesisErr := core.SetupGenesisBlock(chaindb, genesis)
 		if genesisErr != nil {
 			utils.Fatalf("Failed to write fast genesis block: %v", genesisErr)
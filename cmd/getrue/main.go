@@ -12,7 +12,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/elastic/gosigar"
 	"gopkg.in/urfave/cli.v1"
 	"truechain/discovery/accounts"
 	"truechain/discovery/accounts/keystore"
@@ -80,9 +79,47 @@ var (
 		utils.GCModeFlag,
 		utils.LightServFlag,
 		utils.LightPeersFlag,
+		utils.LightProfileFlag,
+		utils.LightFiltersFlag,
+		utils.LightRechargeFlag,
+		utils.LightBufLimitFlag,
+		utils.LightDecoysFlag,
+		utils.LightPrivacyFlag,
+		utils.LightEventBufferFlag,
+		utils.LightRewindBackupFlag,
+		utils.LightRelayOnlyFlag,
+		utils.LightSyncOnlyFlag,
+		utils.LightTopicsFlag,
+		utils.LightNoDefaultTopicFlag,
+		utils.LightNoAdvertiseFlag,
+		utils.LightAPIModulesFlag,
+		utils.LightHotAccountsFlag,
+		utils.LightMaxPerGroupFlag,
+		utils.LightAnnounceConfirmsFlag,
+		utils.LightHedgeTimeoutFlag,
+		utils.LightRequestTimeoutFlag,
+		utils.LightRequestHardTimeoutFlag,
+		utils.LightRequestRetriesFlag,
+		utils.LightRequestBackoffFlag,
+		utils.LightRequestPeerWaitFlag,
+		utils.LightAllowIdMismatchFlag,
+		utils.LightMinGasPriceFlag,
+		utils.LightMaxGasPriceFlag,
+		utils.LightTxAccountSlotsFlag,
+		utils.LightTxGlobalSlotsFlag,
+		utils.LightPruneSectionsFlag,
+		utils.LightFreezerFlag,
+		utils.LightCacheSizeFlag,
+		utils.LightNodeSessionFlag,
+		utils.LightProofFormatFlag,
+		utils.LightRevertReasonsFlag,
+		utils.ULCTrustedServersFlag,
+		utils.ULCMinTrustedFractionFlag,
 		utils.LightKDFFlag,
 		utils.CacheFlag,
 		utils.CacheDatabaseFlag,
+		utils.DatabaseBackendFlag,
+		utils.ConsensusEngineFlag,
 		utils.CacheGCFlag,
 		utils.TrieCacheGenFlag,
 		utils.ListenPortFlag,
@@ -103,6 +140,7 @@ var (
 		utils.NoDiscoverFlag,
 		utils.DiscoveryV5Flag,
 		utils.NetrestrictFlag,
+		utils.ProxyFlag,
 		utils.NodeKeyFileFlag,
 		utils.NodeKeyHexFlag,
 		utils.TestnetFlag,
@@ -193,13 +231,17 @@ func init() {
 			return err
 		}
 		// Cap the cache allowance and tune the garbage colelctor
-		var mem gosigar.Mem
-		if err := mem.Get(); err == nil {
-			allowance := int(mem.Total / 1024 / 1024 / 3)
+		if limit, source := utils.MemoryLimit(); limit > 0 {
+			allowance := int(limit / 1024 / 1024 / 3)
 			if cache := ctx.GlobalInt(utils.CacheFlag.Name); cache > allowance {
-				log.Warn("Sanitizing cache to Go's GC limits", "provided", cache, "updated", allowance)
+				log.Warn("Sanitizing cache to Go's GC limits", "provided", cache, "updated", allowance, "limit", source)
 				ctx.GlobalSet(utils.CacheFlag.Name, strconv.Itoa(allowance))
 			}
+			// Shrink the transaction pool queues along with the default cache
+			if cache := utils.CacheFlag.Value; allowance < cache {
+				scaleFlag(ctx, utils.TxPoolGlobalSlotsFlag, allowance, cache)
+				scaleFlag(ctx, utils.TxPoolGlobalQueueFlag, allowance, cache)
+			}
 		}
 		// Ensure Go's GC ignores the database cache for trigger percentage
 		cache := ctx.GlobalInt(utils.CacheFlag.Name)
@@ -224,6 +266,20 @@ func init() {
 	}
 }
 
+// scaleFlag scales down the default of a queue size flag by the given ratio,
+// keeping at least an eighth of it. Explicitly set flags are left alone.
+func scaleFlag(ctx *cli.Context, flag cli.Uint64Flag, num, denom int) {
+	if ctx.GlobalIsSet(flag.Name) {
+		return
+	}
+	size := flag.Value * uint64(num) / uint64(denom)
+	if size < flag.Value/8 {
+		size = flag.Value / 8
+	}
+	log.Info("Sanitizing queue size to the memory limit", "flag", flag.Name, "default", flag.Value, "updated", size)
+	ctx.GlobalSet(flag.Name, strconv.FormatUint(size, 10))
+}
+
 func main() {
 	if err := app.Run(os.Args); err != nil {
 		fmt.Fprintln(os.Stderr, err)
@@ -64,6 +64,42 @@ var AppHelpFlagGroups = []flagGroup{
 			utils.IdentityFlag,
 			utils.LightServFlag,
 			utils.LightPeersFlag,
+			utils.LightProfileFlag,
+			utils.LightFiltersFlag,
+			utils.LightRechargeFlag,
+			utils.LightBufLimitFlag,
+			utils.LightDecoysFlag,
+			utils.LightPrivacyFlag,
+			utils.LightEventBufferFlag,
+			utils.LightRewindBackupFlag,
+			utils.LightRelayOnlyFlag,
+			utils.LightSyncOnlyFlag,
+			utils.LightTopicsFlag,
+			utils.LightNoDefaultTopicFlag,
+			utils.LightNoAdvertiseFlag,
+			utils.LightAPIModulesFlag,
+			utils.LightHotAccountsFlag,
+			utils.LightMaxPerGroupFlag,
+			utils.LightAnnounceConfirmsFlag,
+			utils.LightHedgeTimeoutFlag,
+			utils.LightRequestTimeoutFlag,
+			utils.LightRequestHardTimeoutFlag,
+			utils.LightRequestRetriesFlag,
+			utils.LightRequestBackoffFlag,
+			utils.LightRequestPeerWaitFlag,
+			utils.LightAllowIdMismatchFlag,
+			utils.LightMinGasPriceFlag,
+			utils.LightMaxGasPriceFlag,
+			utils.LightTxAccountSlotsFlag,
+			utils.LightTxGlobalSlotsFlag,
+			utils.LightPruneSectionsFlag,
+			utils.LightFreezerFlag,
+			utils.LightCacheSizeFlag,
+			utils.LightNodeSessionFlag,
+			utils.LightProofFormatFlag,
+			utils.LightRevertReasonsFlag,
+			utils.ULCTrustedServersFlag,
+			utils.ULCMinTrustedFractionFlag,
 			utils.LightKDFFlag,
 		},
 	},
@@ -123,6 +159,8 @@ var AppHelpFlagGroups = []flagGroup{
 		Flags: []cli.Flag{
 			utils.CacheFlag,
 			utils.CacheDatabaseFlag,
+			utils.DatabaseBackendFlag,
+			utils.ConsensusEngineFlag,
 			utils.CacheGCFlag,
 			utils.TrieCacheGenFlag,
 		},
@@ -166,6 +204,7 @@ var AppHelpFlagGroups = []flagGroup{
 			utils.NoDiscoverFlag,
 			utils.DiscoveryV5Flag,
 			utils.NetrestrictFlag,
+			utils.ProxyFlag,
 			utils.NodeKeyFileFlag,
 			utils.NodeKeyHexFlag,
 		},
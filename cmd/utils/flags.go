@@ -22,6 +22,7 @@ import (
 	"encoding/hex"
 	"fmt"
 	"io/ioutil"
+	"math/big"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -230,6 +231,156 @@ var (
 		Usage: "Maximum number of LES client peers",
 		Value: etrue.DefaultConfig.LightPeers,
 	}
+	LightProfileFlag = cli.StringFlag{
+		Name:  "light.profile",
+		Usage: `Light client configuration profile ("light-embedded" for devices with <256MB RAM)`,
+	}
+	LightFiltersFlag = cli.BoolFlag{
+		Name:  "lightserv.filters",
+		Usage: "Serve compact block filters to LES clients (experimental)",
+	}
+	LightRechargeFlag = cli.Uint64Flag{
+		Name:  "lightserv.recharge",
+		Usage: "Minimum buffer recharge rate of a free LES client in cost units per second (0 = derived from request costs)",
+	}
+	LightBufLimitFlag = cli.Uint64Flag{
+		Name:  "lightserv.buflimit",
+		Usage: "Buffer limit of a free LES client in cost units (0 = derived from the recharge rate)",
+	}
+	LightDecoysFlag = cli.IntFlag{
+		Name:  "light.decoys",
+		Usage: "Number of decoy accounts bundled with each account proof request (0 = disabled)",
+	}
+	LightPrivacyFlag = cli.BoolFlag{
+		Name:  "light.privacy",
+		Usage: "Spread requests about the same account over different servers (slower responses)",
+	}
+	LightEventBufferFlag = cli.IntFlag{
+		Name:  "light.eventbuffer",
+		Usage: "Number of head and log events buffered per subscriber, oldest dropped on overflow (0 = unbuffered)",
+	}
+	LightRewindBackupFlag = cli.BoolFlag{
+		Name:  "light.rewindbackup",
+		Usage: "Back up the headers dropped by a rewind caused by a chain config upgrade",
+	}
+	LightRelayOnlyFlag = cli.StringFlag{
+		Name:  "light.relayonly",
+		Usage: "Comma separated enode URLs of servers only used for transaction relay, not trusted for headers",
+	}
+	LightSyncOnlyFlag = cli.StringFlag{
+		Name:  "light.synconly",
+		Usage: "Comma separated enode URLs of servers used for headers and data but never relayed transactions to",
+	}
+	LightTopicsFlag = cli.StringFlag{
+		Name:  "light.topics",
+		Usage: "Comma separated extra discv5 topics light servers are advertised and searched under",
+	}
+	LightNoDefaultTopicFlag = cli.BoolFlag{
+		Name:  "light.nodefaulttopic",
+		Usage: "Only use the extra discv5 topics, not the ones derived from the genesis hash",
+	}
+	LightNoAdvertiseFlag = cli.BoolFlag{
+		Name:  "light.noadvertise",
+		Usage: "Don't advertise the light server in the discv5 topics",
+	}
+	LightAPIModulesFlag = cli.StringFlag{
+		Name:  "light.apimodules",
+		Usage: "Comma separated namespaces of the light client APIs to register, suffix :admin to keep one private (default: all)",
+	}
+	LightHotAccountsFlag = cli.StringFlag{
+		Name:  "light.hotaccounts",
+		Usage: "Comma separated accounts and contracts whose state is synced at every head and served locally",
+	}
+	LightMaxPerGroupFlag = cli.IntFlag{
+		Name:  "light.maxpergroup",
+		Usage: "Maximum number of light servers connected from the same /16 network (0 = unlimited)",
+	}
+	LightAnnounceConfirmsFlag = cli.IntFlag{
+		Name:  "light.announceconfirms",
+		Usage: "Number of light servers which must announce a head before switching to it (capped by the servers connected)",
+		Value: 1,
+	}
+	LightHedgeTimeoutFlag = cli.DurationFlag{
+		Name:  "light.hedgetimeout",
+		Usage: "Time after which a light client request is also sent to another server, taking the first answer (0 = disabled)",
+	}
+	LightRequestTimeoutFlag = cli.DurationFlag{
+		Name:  "light.requesttimeout",
+		Usage: "Time after which a light client request is also sent to another server (default = 500ms)",
+	}
+	LightRequestHardTimeoutFlag = cli.DurationFlag{
+		Name:  "light.requesthardtimeout",
+		Usage: "Time after which a server not answering a light client request is dropped (default = 10s)",
+	}
+	LightRequestRetriesFlag = cli.IntFlag{
+		Name:  "light.requestretries",
+		Usage: "Maximum number of times a light client request is resent to other servers (0 = unlimited)",
+	}
+	LightRequestBackoffFlag = cli.StringFlag{
+		Name:  "light.requestbackoff",
+		Usage: "Growth of the delay between retries while no server is suitable for a request (constant, exponential)",
+		Value: "constant",
+	}
+	LightRequestPeerWaitFlag = cli.DurationFlag{
+		Name:  "light.requestpeerwait",
+		Usage: "Time a light client request waits for a suitable server before failing (default = 3s)",
+	}
+	LightAllowIdMismatchFlag = cli.BoolFlag{
+		Name:  "light.allowidmismatch",
+		Usage: "Start the light client even if the network id differs from the chain id of the genesis config",
+	}
+	LightMinGasPriceFlag = BigFlag{
+		Name:  "light.mingasprice",
+		Value: new(big.Int),
+		Usage: "Minimum gas price of relayed transactions (default = a tenth of the suggested gas price)",
+	}
+	LightMaxGasPriceFlag = BigFlag{
+		Name:  "light.maxgasprice",
+		Value: new(big.Int),
+		Usage: "Maximum gas price of relayed transactions (default = 100 times the suggested gas price)",
+	}
+	LightTxAccountSlotsFlag = cli.Uint64Flag{
+		Name:  "light.txaccountslots",
+		Usage: "Maximum number of pending transactions per sender in the light transaction pool (0 = unlimited)",
+	}
+	LightTxGlobalSlotsFlag = cli.Uint64Flag{
+		Name:  "light.txglobalslots",
+		Usage: "Maximum number of pending transactions in the light transaction pool, the busiest sender is evicted first (0 = unlimited)",
+	}
+	ULCTrustedServersFlag = cli.StringFlag{
+		Name:  "ulc.servers",
+		Usage: "List of trusted ultra light servers (enode URLs, comma separated)",
+	}
+	ULCMinTrustedFractionFlag = cli.IntFlag{
+		Name:  "ulc.fraction",
+		Usage: "Minimum percentage of trusted ultra light servers agreeing on a head (1-100)",
+		Value: etrue.DefaultULCMinTrustedFraction,
+	}
+	LightPruneSectionsFlag = cli.Uint64Flag{
+		Name:  "light.prunesections",
+		Usage: "Number of recent sections whose cached bodies, receipts and bloom bits are kept (0 = never pruned)",
+	}
+	LightFreezerFlag = cli.BoolFlag{
+		Name:  "light.freezer",
+		Usage: "Move the headers older than the trusted checkpoint out of LevelDB into append-only flat files",
+	}
+	LightCacheSizeFlag = cli.IntFlag{
+		Name:  "light.cachesize",
+		Usage: "Megabytes of memory allocated to caching trie nodes, code and receipts retrieved on demand (0 = disabled)",
+	}
+	LightNodeSessionFlag = cli.IntFlag{
+		Name:  "light.nodesession",
+		Usage: "Number of trie nodes remembered per server so that servers can omit them from proofs (0 = default 4096, -1 = disabled)",
+	}
+	LightProofFormatFlag = cli.StringFlag{
+		Name:  "light.proofformat",
+		Usage: `Format of the proofs requested from the servers supporting it ("compact" or "raw")`,
+		Value: "compact",
+	}
+	LightRevertReasonsFlag = cli.BoolFlag{
+		Name:  "light.revertreasons",
+		Usage: "Re-execute failed transactions to report their revert reason in receipts (retrieves the block state from the servers)",
+	}
 	LightKDFFlag = cli.BoolFlag{
 		Name:  "lightkdf",
 		Usage: "Reduce key-derivation RAM & CPU usage at some expense of KDF strength",
@@ -331,6 +482,16 @@ var (
 		Usage: "Percentage of cache memory allowance to use for database io",
 		Value: 75,
 	}
+	DatabaseBackendFlag = cli.StringFlag{
+		Name:  "db.engine",
+		Usage: "Backend of the chain database (leveldb, memory)",
+		Value: etruedb.BackendLevelDB,
+	}
+	ConsensusEngineFlag = cli.StringFlag{
+		Name:  "consensus.engine",
+		Usage: "Consensus engine of the snail chain, among the ones registered by the binary",
+		Value: etrue.EngineMinerva,
+	}
 	CacheGCFlag = cli.IntFlag{
 		Name:  "cache.gc",
 		Usage: "Percentage of cache memory allowance to use for trie pruning",
@@ -549,6 +710,10 @@ var (
 		Name:  "netrestrict",
 		Usage: "Restricts network communication to the given IP networks (CIDR masks)",
 	}
+	ProxyFlag = cli.StringFlag{
+		Name:  "proxy",
+		Usage: "SOCKS5 proxy (e.g. Tor at 127.0.0.1:9050) for outbound peer connections, required for .onion nodes",
+	}
 
 	// ATM the url is left to the user and deployment to
 	JSpathFlag = cli.StringFlag{
@@ -972,6 +1137,9 @@ func SetP2PConfig(ctx *cli.Context, cfg *p2p.Config) {
 		}
 		cfg.NetRestrict = list
 	}
+	if ctx.GlobalIsSet(ProxyFlag.Name) {
+		cfg.Proxy = ctx.GlobalString(ProxyFlag.Name)
+	}
 
 	if !ctx.GlobalBool(SingleNodeFlag.Name) && ctx.GlobalBool(EnableElectionFlag.Name) && ctx.GlobalIsSet(BFTIPFlag.Name) {
 		cfg.Host = ctx.GlobalString(BFTIPFlag.Name)
@@ -1130,6 +1298,120 @@ func SetTruechainConfig(ctx *cli.Context, stack *node.Node, cfg *etrue.Config) {
 	if ctx.GlobalIsSet(LightPeersFlag.Name) {
 		cfg.LightPeers = ctx.GlobalInt(LightPeersFlag.Name)
 	}
+	if ctx.GlobalIsSet(LightProfileFlag.Name) {
+		cfg.LightProfile = ctx.GlobalString(LightProfileFlag.Name)
+	}
+	if ctx.GlobalIsSet(LightFiltersFlag.Name) {
+		cfg.LightServeFilters = ctx.GlobalBool(LightFiltersFlag.Name)
+	}
+	if ctx.GlobalIsSet(LightRechargeFlag.Name) {
+		cfg.LightRecharge = ctx.GlobalUint64(LightRechargeFlag.Name)
+	}
+	if ctx.GlobalIsSet(LightBufLimitFlag.Name) {
+		cfg.LightBufLimit = ctx.GlobalUint64(LightBufLimitFlag.Name)
+	}
+	if ctx.GlobalIsSet(LightDecoysFlag.Name) {
+		cfg.LightProofDecoys = ctx.GlobalInt(LightDecoysFlag.Name)
+	}
+	if ctx.GlobalIsSet(LightPrivacyFlag.Name) {
+		cfg.LightPrivacyMode = ctx.GlobalBool(LightPrivacyFlag.Name)
+	}
+	if ctx.GlobalIsSet(LightEventBufferFlag.Name) {
+		cfg.LightEventBuffer = ctx.GlobalInt(LightEventBufferFlag.Name)
+	}
+	if ctx.GlobalIsSet(LightRewindBackupFlag.Name) {
+		cfg.LightRewindBackup = ctx.GlobalBool(LightRewindBackupFlag.Name)
+	}
+	if ctx.GlobalIsSet(LightRelayOnlyFlag.Name) {
+		cfg.LightRelayOnly = splitAndTrim(ctx.GlobalString(LightRelayOnlyFlag.Name))
+	}
+	if ctx.GlobalIsSet(LightSyncOnlyFlag.Name) {
+		cfg.LightSyncOnly = splitAndTrim(ctx.GlobalString(LightSyncOnlyFlag.Name))
+	}
+	if ctx.GlobalIsSet(LightTopicsFlag.Name) {
+		cfg.LightTopics = splitAndTrim(ctx.GlobalString(LightTopicsFlag.Name))
+	}
+	if ctx.GlobalIsSet(LightNoDefaultTopicFlag.Name) {
+		cfg.LightNoDefaultTopic = ctx.GlobalBool(LightNoDefaultTopicFlag.Name)
+	}
+	if ctx.GlobalIsSet(LightNoAdvertiseFlag.Name) {
+		cfg.LightNoAdvertise = ctx.GlobalBool(LightNoAdvertiseFlag.Name)
+	}
+	if ctx.GlobalIsSet(LightAPIModulesFlag.Name) {
+		cfg.LightAPIModules = splitAndTrim(ctx.GlobalString(LightAPIModulesFlag.Name))
+	}
+	if ctx.GlobalIsSet(LightHotAccountsFlag.Name) {
+		cfg.LightHotAccounts = nil
+		for _, account := range splitAndTrim(ctx.GlobalString(LightHotAccountsFlag.Name)) {
+			if !common.IsHexAddress(account) {
+				Fatalf("Invalid hot account %q", account)
+			}
+			cfg.LightHotAccounts = append(cfg.LightHotAccounts, common.HexToAddress(account))
+		}
+	}
+	if ctx.GlobalIsSet(LightMaxPerGroupFlag.Name) {
+		cfg.LightMaxPerGroup = ctx.GlobalInt(LightMaxPerGroupFlag.Name)
+	}
+	if ctx.GlobalIsSet(LightAnnounceConfirmsFlag.Name) {
+		cfg.LightAnnounceConfirms = ctx.GlobalInt(LightAnnounceConfirmsFlag.Name)
+	}
+	if ctx.GlobalIsSet(LightHedgeTimeoutFlag.Name) {
+		cfg.LightHedgeTimeout = ctx.GlobalDuration(LightHedgeTimeoutFlag.Name)
+	}
+	if ctx.GlobalIsSet(LightRequestTimeoutFlag.Name) {
+		cfg.LightRequestTimeout = ctx.GlobalDuration(LightRequestTimeoutFlag.Name)
+	}
+	if ctx.GlobalIsSet(LightRequestHardTimeoutFlag.Name) {
+		cfg.LightRequestHardTimeout = ctx.GlobalDuration(LightRequestHardTimeoutFlag.Name)
+	}
+	if ctx.GlobalIsSet(LightRequestRetriesFlag.Name) {
+		cfg.LightRequestRetries = ctx.GlobalInt(LightRequestRetriesFlag.Name)
+	}
+	if ctx.GlobalIsSet(LightRequestBackoffFlag.Name) {
+		cfg.LightRequestBackoff = ctx.GlobalString(LightRequestBackoffFlag.Name)
+	}
+	if ctx.GlobalIsSet(LightRequestPeerWaitFlag.Name) {
+		cfg.LightRequestPeerWait = ctx.GlobalDuration(LightRequestPeerWaitFlag.Name)
+	}
+	if ctx.GlobalIsSet(LightAllowIdMismatchFlag.Name) {
+		cfg.LightAllowIdMismatch = ctx.GlobalBool(LightAllowIdMismatchFlag.Name)
+	}
+	if ctx.GlobalIsSet(LightRevertReasonsFlag.Name) {
+		cfg.LightRevertReasons = ctx.GlobalBool(LightRevertReasonsFlag.Name)
+	}
+	if ctx.GlobalIsSet(LightPruneSectionsFlag.Name) {
+		cfg.LightPruneSections = ctx.GlobalUint64(LightPruneSectionsFlag.Name)
+	}
+	if ctx.GlobalIsSet(LightFreezerFlag.Name) {
+		cfg.LightFreezer = ctx.GlobalBool(LightFreezerFlag.Name)
+	}
+	if ctx.GlobalIsSet(LightCacheSizeFlag.Name) {
+		cfg.CacheSizeMB = ctx.GlobalInt(LightCacheSizeFlag.Name)
+	}
+	if ctx.GlobalIsSet(LightNodeSessionFlag.Name) {
+		cfg.LightNodeSession = ctx.GlobalInt(LightNodeSessionFlag.Name)
+	}
+	if ctx.GlobalIsSet(LightProofFormatFlag.Name) {
+		cfg.LightProofFormat = ctx.GlobalString(LightProofFormatFlag.Name)
+	}
+	if ctx.GlobalIsSet(ULCTrustedServersFlag.Name) {
+		cfg.ULC = &etrue.ULCConfig{
+			TrustedServers:     splitAndTrim(ctx.GlobalString(ULCTrustedServersFlag.Name)),
+			MinTrustedFraction: ctx.GlobalInt(ULCMinTrustedFractionFlag.Name),
+		}
+	}
+	if ctx.GlobalIsSet(LightMinGasPriceFlag.Name) {
+		cfg.LightMinGasPrice = GlobalBig(ctx, LightMinGasPriceFlag.Name)
+	}
+	if ctx.GlobalIsSet(LightMaxGasPriceFlag.Name) {
+		cfg.LightMaxGasPrice = GlobalBig(ctx, LightMaxGasPriceFlag.Name)
+	}
+	if ctx.GlobalIsSet(LightTxAccountSlotsFlag.Name) {
+		cfg.LightTxAccountSlots = ctx.GlobalUint64(LightTxAccountSlotsFlag.Name)
+	}
+	if ctx.GlobalIsSet(LightTxGlobalSlotsFlag.Name) {
+		cfg.LightTxGlobalSlots = ctx.GlobalUint64(LightTxGlobalSlotsFlag.Name)
+	}
 	if ctx.GlobalIsSet(NetworkIdFlag.Name) {
 		cfg.NetworkId = ctx.GlobalUint64(NetworkIdFlag.Name)
 	}
@@ -1190,6 +1472,12 @@ func SetTruechainConfig(ctx *cli.Context, stack *node.Node, cfg *etrue.Config) {
 		cfg.DatabaseCache = ctx.GlobalInt(CacheFlag.Name) * ctx.GlobalInt(CacheDatabaseFlag.Name) / 100
 	}
 	cfg.DatabaseHandles = makeDatabaseHandles()
+	if ctx.GlobalIsSet(DatabaseBackendFlag.Name) {
+		cfg.DatabaseBackend = ctx.GlobalString(DatabaseBackendFlag.Name)
+	}
+	if ctx.GlobalIsSet(ConsensusEngineFlag.Name) {
+		cfg.ConsensusEngine = ctx.GlobalString(ConsensusEngineFlag.Name)
+	}
 
 	if gcmode := ctx.GlobalString(GCModeFlag.Name); gcmode != "full" && gcmode != "archive" {
 		Fatalf("--%s must be either 'full' or 'archive'", GCModeFlag.Name)
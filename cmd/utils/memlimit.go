@@ -0,0 +1,91 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/gosigar"
+)
+
+// cgroupLimitFiles are the memory limits of the cgroup of the process, for
+// cgroup v2 and v1.
+var cgroupLimitFiles = []string{
+	"/sys/fs/cgroup/memory.max",
+	"/sys/fs/cgroup/memory/memory.limit_in_bytes",
+}
+
+// unlimitedMemory is the limit above which a cgroup v1 limit means none.
+const unlimitedMemory = 1 << 62
+
+// MemoryLimit returns the memory available to the process in bytes and where
+// the limit comes from: the lowest of the physical memory, the memory limit of
+// the cgroup the process runs in, e.g. a container, and the soft limit of the
+// Go runtime set by GOMEMLIMIT. It returns zero if no limit is known.
+func MemoryLimit() (uint64, string) {
+	var (
+		limit  uint64
+		source string
+	)
+	lower := func(l uint64, s string) {
+		if l > 0 && (limit == 0 || l < limit) {
+			limit, source = l, s
+		}
+	}
+	var mem gosigar.Mem
+	if err := mem.Get(); err == nil {
+		lower(mem.Total, "system")
+	}
+	for _, file := range cgroupLimitFiles {
+		if blob, err := ioutil.ReadFile(file); err == nil {
+			if l, err := strconv.ParseUint(strings.TrimSpace(string(blob)), 10, 64); err == nil && l < unlimitedMemory {
+				lower(l, "cgroup")
+			}
+		}
+	}
+	if l, ok := parseMemoryLimit(os.Getenv("GOMEMLIMIT")); ok {
+		lower(l, "GOMEMLIMIT")
+	}
+	return limit, source
+}
+
+// parseMemoryLimit parses a memory limit in the format of GOMEMLIMIT: a number
+// of bytes with an optional B, KiB, MiB, GiB or TiB suffix.
+func parseMemoryLimit(s string) (uint64, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "off" {
+		return 0, false
+	}
+	unit := uint64(1)
+	for _, suffix := range []struct {
+		name string
+		unit uint64
+	}{{"TiB", 1 << 40}, {"GiB", 1 << 30}, {"MiB", 1 << 20}, {"KiB", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(s, suffix.name) {
+			s, unit = strings.TrimSuffix(s, suffix.name), suffix.unit
+			break
+		}
+	}
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil || n == 0 {
+		return 0, false
+	}
+	return n * unit, true
+}
@@ -0,0 +1,127 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package checkpointoracle is an on-chain light client checkpoint oracle.
+package checkpointoracle
+
+import (
+	"context"
+	"math/big"
+	"strings"
+
+	truechain "truechain/discovery"
+	"truechain/discovery/accounts/abi"
+	"truechain/discovery/accounts/abi/bind"
+	"truechain/discovery/common"
+)
+
+// CheckpointOracleABI is the input ABI used to generate the binding from.
+const CheckpointOracleABI = `[{"constant":true,"inputs":[],"name":"GetLatestCheckpoint","outputs":[{"name":"","type":"uint64"},{"name":"","type":"bytes32"},{"name":"","type":"uint256"}],"payable":false,"stateMutability":"view","type":"function"},{"constant":true,"inputs":[],"name":"GetAllAdmin","outputs":[{"name":"","type":"address[]"}],"payable":false,"stateMutability":"view","type":"function"},{"anonymous":false,"inputs":[{"indexed":true,"name":"index","type":"uint64"},{"indexed":false,"name":"checkpointHash","type":"bytes32"},{"indexed":false,"name":"v","type":"uint8"},{"indexed":false,"name":"r","type":"bytes32"},{"indexed":false,"name":"s","type":"bytes32"}],"name":"NewCheckpointVote","type":"event"}]`
+
+// NewCheckpointVote is a vote of an admin for a checkpoint, emitted by the
+// contract when the admin signature is submitted.
+type NewCheckpointVote struct {
+	Index          uint64
+	CheckpointHash [32]byte
+	V              uint8
+	R              [32]byte
+	S              [32]byte
+}
+
+// CheckpointOracle is a Go wrapper around an on-chain checkpoint oracle contract.
+type CheckpointOracle struct {
+	address  common.Address
+	abi      abi.ABI
+	backend  bind.ContractBackend
+	contract *bind.BoundContract
+}
+
+// NewCheckpointOracle binds checkpoint contract and returns a registrar instance.
+func NewCheckpointOracle(contractAddr common.Address, backend bind.ContractBackend) (*CheckpointOracle, error) {
+	parsed, err := abi.JSON(strings.NewReader(CheckpointOracleABI))
+	if err != nil {
+		return nil, err
+	}
+	return &CheckpointOracle{
+		address:  contractAddr,
+		abi:      parsed,
+		backend:  backend,
+		contract: bind.NewBoundContract(contractAddr, parsed, backend, backend, backend),
+	}, nil
+}
+
+// ContractAddr returns the address of contract.
+func (oracle *CheckpointOracle) ContractAddr() common.Address {
+	return oracle.address
+}
+
+// LatestCheckpoint returns the section index, the hash and the registration
+// block number of the latest checkpoint approved in the contract.
+func (oracle *CheckpointOracle) LatestCheckpoint(opts *bind.CallOpts) (uint64, [32]byte, *big.Int, error) {
+	var (
+		index  uint64
+		hash   [32]byte
+		height = new(big.Int)
+	)
+	out := &[]interface{}{&index, &hash, &height}
+	if err := oracle.contract.Call(opts, out, "GetLatestCheckpoint"); err != nil {
+		return 0, [32]byte{}, nil, err
+	}
+	return index, hash, height, nil
+}
+
+// Admins returns the admins allowed to vote for checkpoints in the contract.
+func (oracle *CheckpointOracle) Admins(opts *bind.CallOpts) ([]common.Address, error) {
+	var admins []common.Address
+	if err := oracle.contract.Call(opts, &admins, "GetAllAdmin"); err != nil {
+		return nil, err
+	}
+	return admins, nil
+}
+
+// LookupVotes returns the signatures of the admin votes for the given checkpoint
+// which were emitted in the block the checkpoint was registered in. Signatures
+// are in the [R || S || V] format with V being 27 or 28.
+func (oracle *CheckpointOracle) LookupVotes(ctx context.Context, index uint64, hash [32]byte, height uint64) ([][]byte, error) {
+	topics, err := abi.MakeTopics([]interface{}{oracle.abi.Events["NewCheckpointVote"].ID}, []interface{}{index})
+	if err != nil {
+		return nil, err
+	}
+	logs, err := oracle.backend.FilterLogs(ctx, truechain.FilterQuery{
+		Addresses: []common.Address{oracle.address},
+		Topics:    topics,
+		FromBlock: new(big.Int).SetUint64(height),
+		ToBlock:   new(big.Int).SetUint64(height),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var sigs [][]byte
+	for _, log := range logs {
+		vote := new(NewCheckpointVote)
+		if err := oracle.contract.UnpackLog(vote, "NewCheckpointVote", log); err != nil {
+			return nil, err
+		}
+		if vote.CheckpointHash != hash {
+			continue
+		}
+		sig := make([]byte, 0, 65)
+		sig = append(sig, vote.R[:]...)
+		sig = append(sig, vote.S[:]...)
+		sigs = append(sigs, append(sig, vote.V))
+	}
+	return sigs, nil
+}
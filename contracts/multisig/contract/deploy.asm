@@ -0,0 +1,93 @@
+;; Deployment code of the multi-signature wallet in multisig.asm, running the
+;; constructor(uint256 threshold, address[] owners). The owners have to be
+;; sorted by ascending address and the threshold has to be between one and the
+;; number of owners.
+;;
+;; gen.go replaces RUNTIME_SIZE with the size of the runtime code, which is
+;; appended to this code, followed by the constructor arguments.
+
+;; Copy the constructor arguments to memory
+	PUSH RUNTIME_SIZE
+	PUSH @runtime
+	PUSH 1
+	ADD
+	ADD
+	DUP1
+	CODESIZE
+	SUB
+	SWAP1
+	PUSH 0
+	CODECOPY
+
+;; Store the number of owners and the threshold
+	PUSH 0x20
+	MLOAD
+	DUP1
+	MLOAD
+	DUP1
+	PUSH 2
+	SSTORE
+	PUSH 0
+	MLOAD
+	DUP1
+	ISZERO
+	JUMPI @revert
+	DUP2
+	DUP2
+	GT
+	JUMPI @revert
+	PUSH 1
+	SSTORE
+
+;; Store the owners, which have to be sorted and distinct
+	PUSH 0
+	PUSH 0
+loop:
+	;; stack: i, last owner, count, owners offset
+	DUP3
+	DUP2
+	LT
+	ISZERO
+	JUMPI @done
+	DUP1
+	PUSH 0x20
+	MUL
+	DUP5
+	ADD
+	PUSH 0x20
+	ADD
+	MLOAD
+	DUP1
+	DUP4
+	LT
+	ISZERO
+	JUMPI @revert
+	DUP1
+	DUP3
+	PUSH 3
+	ADD
+	SSTORE
+	SWAP2
+	POP
+	PUSH 1
+	ADD
+	JUMP @loop
+
+;; Return the runtime code
+done:
+	PUSH RUNTIME_SIZE
+	DUP1
+	PUSH @runtime
+	PUSH 1
+	ADD
+	PUSH 0
+	CODECOPY
+	PUSH 0
+	RETURN
+
+revert:
+	PUSH 0
+	PUSH 0
+	REVERT
+
+runtime:
@@ -0,0 +1,74 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// +build none
+
+// The gen command assembles the multi-signature wallet contract from its
+// runtime and deployment code, writing the deployment bytecode abigen binds.
+//
+//     go run gen.go -runtime multisig.asm -deploy deploy.asm -out multisig.bin
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+
+	"truechain/discovery/core/asm"
+)
+
+var (
+	runtimeFlag = flag.String("runtime", "multisig.asm", "runtime code of the contract")
+	deployFlag  = flag.String("deploy", "deploy.asm", "deployment code of the contract")
+	outFlag     = flag.String("out", "multisig.bin", "output file of the deployment bytecode")
+)
+
+// assemble compiles an EVM assembly source to hex encoded bytecode.
+func assemble(source []byte) (string, error) {
+	c := asm.NewCompiler(false)
+	c.Feed(asm.Lex(source, false))
+	code, errs := c.Compile()
+	if len(errs) > 0 {
+		return "", fmt.Errorf("%v", errs)
+	}
+	return code, nil
+}
+
+func main() {
+	flag.Parse()
+
+	source, err := ioutil.ReadFile(*runtimeFlag)
+	if err != nil {
+		log.Fatalf("Failed to read runtime code: %v", err)
+	}
+	runtime, err := assemble(source)
+	if err != nil {
+		log.Fatalf("Failed to assemble runtime code: %v", err)
+	}
+	if source, err = ioutil.ReadFile(*deployFlag); err != nil {
+		log.Fatalf("Failed to read deployment code: %v", err)
+	}
+	size := fmt.Sprintf("%#x", len(runtime)/2)
+	deploy, err := assemble(bytes.Replace(source, []byte("RUNTIME_SIZE"), []byte(size), -1))
+	if err != nil {
+		log.Fatalf("Failed to assemble deployment code: %v", err)
+	}
+	if err := ioutil.WriteFile(*outFlag, []byte(deploy+runtime), 0644); err != nil {
+		log.Fatalf("Failed to write bytecode: %v", err)
+	}
+}
@@ -0,0 +1,367 @@
+;; Multisig is a multi-signature wallet executing a call once enough of its
+;; owners signed it off-chain. This is the runtime code, the constructor is in
+;; deploy.asm. Both are assembled by gen.go.
+;;
+;; Storage:
+;;   slot 0        nonce, incremented by every execution
+;;   slot 1        threshold, the number of signatures an execution needs
+;;   slot 2        number of owners
+;;   slot 3 + i    owner i, sorted by ascending address
+;;
+;; The owners sign keccak256(0x19 0x00 wallet destination value data nonce),
+;; the EIP-191 version 0 data with the wallet as intended validator. The
+;; signatures passed to execute have to be sorted by ascending signer address,
+;; so every owner is counted once.
+;;
+;; Memory used by execute:
+;;   0x000 - 0x0a0  ecrecover input and output
+;;   0x100          signing hash
+;;   0x120          number of signatures
+;;   0x140          index of the signature being checked
+;;   0x160          index of the next owner a signer may match
+;;   0x180          number of owners
+;;   0x1a0          calldata offset of the first sigV element
+;;   0x1c0          calldata offset of the first sigR element
+;;   0x1e0          calldata offset of the first sigS element
+;;   0x400 -        signed data, then the input of the executed call
+
+;; Dispatch on the function selector
+	PUSH 0
+	CALLDATALOAD
+	PUSH 0x100000000000000000000000000000000000000000000000000000000
+	SWAP1
+	DIV
+	DUP1
+	;; nonce()
+	PUSH 0xaffed0e0
+	EQ
+	JUMPI @nonce
+	DUP1
+	;; threshold()
+	PUSH 0x42cde4e8
+	EQ
+	JUMPI @threshold
+	DUP1
+	;; getOwners()
+	PUSH 0xa0e67e2b
+	EQ
+	JUMPI @owners
+	DUP1
+	;; execute(address,uint256,bytes,uint8[],bytes32[],bytes32[])
+	PUSH 0x3a49183e
+	EQ
+	JUMPI @execute
+
+;; Plain value transfers are accepted, unknown calls are not
+	CALLDATASIZE
+	JUMPI @revert
+	STOP
+
+;; nonce() returns (uint256)
+nonce:
+	PUSH 0
+	SLOAD
+	PUSH 0
+	MSTORE
+	PUSH 0x20
+	PUSH 0
+	RETURN
+
+;; threshold() returns (uint256)
+threshold:
+	PUSH 1
+	SLOAD
+	PUSH 0
+	MSTORE
+	PUSH 0x20
+	PUSH 0
+	RETURN
+
+;; getOwners() returns (address[])
+owners:
+	PUSH 0x20
+	PUSH 0
+	MSTORE
+	PUSH 2
+	SLOAD
+	DUP1
+	PUSH 0x20
+	MSTORE
+	PUSH 0
+owners_loop:
+	;; stack: i, count
+	DUP2
+	DUP2
+	LT
+	ISZERO
+	JUMPI @owners_done
+	DUP1
+	PUSH 3
+	ADD
+	SLOAD
+	DUP2
+	PUSH 0x20
+	MUL
+	PUSH 0x40
+	ADD
+	MSTORE
+	PUSH 1
+	ADD
+	JUMP @owners_loop
+owners_done:
+	PUSH 0x20
+	MUL
+	PUSH 0x40
+	ADD
+	PUSH 0
+	RETURN
+
+;; execute(address destination, uint256 value, bytes data, uint8[] sigV, bytes32[] sigR, bytes32[] sigS)
+execute:
+	CALLVALUE
+	JUMPI @revert
+
+	;; The signature arrays have to be of the same length
+	PUSH 0x64
+	CALLDATALOAD
+	PUSH 4
+	ADD
+	DUP1
+	CALLDATALOAD
+	PUSH 0x120
+	MSTORE
+	PUSH 0x20
+	ADD
+	PUSH 0x1a0
+	MSTORE
+	PUSH 0x84
+	CALLDATALOAD
+	PUSH 4
+	ADD
+	DUP1
+	CALLDATALOAD
+	PUSH 0x120
+	MLOAD
+	EQ
+	ISZERO
+	JUMPI @revert
+	PUSH 0x20
+	ADD
+	PUSH 0x1c0
+	MSTORE
+	PUSH 0xa4
+	CALLDATALOAD
+	PUSH 4
+	ADD
+	DUP1
+	CALLDATALOAD
+	PUSH 0x120
+	MLOAD
+	EQ
+	ISZERO
+	JUMPI @revert
+	PUSH 0x20
+	ADD
+	PUSH 0x1e0
+	MSTORE
+
+	;; At least threshold signatures are needed
+	PUSH 1
+	SLOAD
+	PUSH 0x120
+	MLOAD
+	LT
+	JUMPI @revert
+
+	;; Hash the signed data: 0x19 0x00 wallet destination value data nonce
+	PUSH 0x19
+	PUSH 0x400
+	MSTORE8
+	ADDRESS
+	PUSH 0x1000000000000000000000000
+	MUL
+	PUSH 0x402
+	MSTORE
+	PUSH 4
+	CALLDATALOAD
+	PUSH 0xffffffffffffffffffffffffffffffffffffffff
+	AND
+	PUSH 0x1000000000000000000000000
+	MUL
+	PUSH 0x416
+	MSTORE
+	PUSH 0x24
+	CALLDATALOAD
+	PUSH 0x42a
+	MSTORE
+	PUSH 0x44
+	CALLDATALOAD
+	PUSH 4
+	ADD
+	DUP1
+	CALLDATALOAD
+	SWAP1
+	PUSH 0x20
+	ADD
+	DUP2
+	SWAP1
+	PUSH 0x44a
+	CALLDATACOPY
+	PUSH 0x44a
+	ADD
+	PUSH 0
+	SLOAD
+	DUP2
+	MSTORE
+	PUSH 0x20
+	ADD
+	PUSH 0x400
+	SWAP1
+	SUB
+	PUSH 0x400
+	SHA3
+	PUSH 0x100
+	MSTORE
+
+	;; Every signer has to be an owner after the previous signer
+	PUSH 2
+	SLOAD
+	PUSH 0x180
+	MSTORE
+	PUSH 0
+	PUSH 0x140
+	MSTORE
+	PUSH 0
+	PUSH 0x160
+	MSTORE
+sig_loop:
+	PUSH 0x120
+	MLOAD
+	PUSH 0x140
+	MLOAD
+	LT
+	ISZERO
+	JUMPI @sig_done
+
+	;; Recover the signer with ecrecover(hash, v, r, s)
+	PUSH 0x100
+	MLOAD
+	PUSH 0
+	MSTORE
+	PUSH 0x140
+	MLOAD
+	PUSH 0x20
+	MUL
+	DUP1
+	PUSH 0x1a0
+	MLOAD
+	ADD
+	CALLDATALOAD
+	PUSH 0x20
+	MSTORE
+	DUP1
+	PUSH 0x1c0
+	MLOAD
+	ADD
+	CALLDATALOAD
+	PUSH 0x40
+	MSTORE
+	PUSH 0x1e0
+	MLOAD
+	ADD
+	CALLDATALOAD
+	PUSH 0x60
+	MSTORE
+	PUSH 0
+	PUSH 0x80
+	MSTORE
+	PUSH 0x20
+	PUSH 0x80
+	PUSH 0x80
+	PUSH 0
+	PUSH 0
+	PUSH 1
+	GAS
+	CALL
+	ISZERO
+	JUMPI @revert
+	PUSH 0x80
+	MLOAD
+	DUP1
+	ISZERO
+	JUMPI @revert
+owner_loop:
+	;; stack: signer
+	PUSH 0x180
+	MLOAD
+	PUSH 0x160
+	MLOAD
+	LT
+	ISZERO
+	JUMPI @revert
+	PUSH 0x160
+	MLOAD
+	DUP1
+	PUSH 1
+	ADD
+	PUSH 0x160
+	MSTORE
+	PUSH 3
+	ADD
+	SLOAD
+	DUP2
+	EQ
+	ISZERO
+	JUMPI @owner_loop
+	POP
+	PUSH 0x140
+	MLOAD
+	PUSH 1
+	ADD
+	PUSH 0x140
+	MSTORE
+	JUMP @sig_loop
+
+sig_done:
+	;; Increment the nonce before the call, so the signatures can't be replayed
+	PUSH 0
+	SLOAD
+	PUSH 1
+	ADD
+	PUSH 0
+	SSTORE
+
+	;; Call the destination with the value and the data
+	PUSH 0x44
+	CALLDATALOAD
+	PUSH 4
+	ADD
+	DUP1
+	CALLDATALOAD
+	SWAP1
+	PUSH 0x20
+	ADD
+	DUP2
+	SWAP1
+	PUSH 0x400
+	CALLDATACOPY
+	PUSH 0
+	PUSH 0
+	DUP3
+	PUSH 0x400
+	PUSH 0x24
+	CALLDATALOAD
+	PUSH 4
+	CALLDATALOAD
+	PUSH 0xffffffffffffffffffffffffffffffffffffffff
+	AND
+	GAS
+	CALL
+	ISZERO
+	JUMPI @revert
+	STOP
+
+revert:
+	PUSH 0
+	PUSH 0
+	REVERT
@@ -0,0 +1,309 @@
+// Code generated - DO NOT EDIT.
+// This file is a generated binding and any manual changes will be lost.
+
+package contract
+
+import (
+	"math/big"
+	"strings"
+
+	ethereum "truechain/discovery"
+	"truechain/discovery/accounts/abi"
+	"truechain/discovery/accounts/abi/bind"
+	"truechain/discovery/common"
+	"truechain/discovery/core/types"
+	"truechain/discovery/event"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var (
+	_ = big.NewInt
+	_ = strings.NewReader
+	_ = ethereum.NotFound
+	_ = bind.Bind
+	_ = common.Big1
+	_ = types.BloomLookup
+	_ = event.NewSubscription
+)
+
+// MultisigABI is the input ABI used to generate the binding from.
+const MultisigABI = "[{\"constant\":true,\"inputs\":[],\"name\":\"nonce\",\"outputs\":[{\"name\":\"\",\"type\":\"uint256\"}],\"payable\":false,\"stateMutability\":\"view\",\"type\":\"function\"},{\"constant\":true,\"inputs\":[],\"name\":\"threshold\",\"outputs\":[{\"name\":\"\",\"type\":\"uint256\"}],\"payable\":false,\"stateMutability\":\"view\",\"type\":\"function\"},{\"constant\":true,\"inputs\":[],\"name\":\"getOwners\",\"outputs\":[{\"name\":\"\",\"type\":\"address[]\"}],\"payable\":false,\"stateMutability\":\"view\",\"type\":\"function\"},{\"constant\":false,\"inputs\":[{\"name\":\"destination\",\"type\":\"address\"},{\"name\":\"value\",\"type\":\"uint256\"},{\"name\":\"data\",\"type\":\"bytes\"},{\"name\":\"sigV\",\"type\":\"uint8[]\"},{\"name\":\"sigR\",\"type\":\"bytes32[]\"},{\"name\":\"sigS\",\"type\":\"bytes32[]\"}],\"name\":\"execute\",\"outputs\":[],\"payable\":false,\"stateMutability\":\"nonpayable\",\"type\":\"function\"},{\"inputs\":[{\"name\":\"threshold\",\"type\":\"uint256\"},{\"name\":\"owners\",\"type\":\"address[]\"}],\"payable\":true,\"stateMutability\":\"payable\",\"type\":\"constructor\"},{\"payable\":true,\"stateMutability\":\"payable\",\"type\":\"fallback\"}]"
+
+// MultisigBin is the compiled bytecode used for deploying new contracts.
+var MultisigBin = "0x610288630000008060010101803803906000396020518051806002556000518015630000007a57818111630000007a57600155600060005b828110156300000067578060200284016020015180831015630000007a5780826003015591506001016300000037565b6102888063000000806001016000396000f35b60006000fd5b6000357c010000000000000000000000000000000000000000000000000000000090048063affed0e014630000005f57806342cde4e814630000006b578063a0e67e2b1463000000775780633a49183e1463000000b15736630000028257005b60005460005260206000f35b60015460005260206000f35b60206000526002548060205260005b8181101563000000a757806003015481602002604001526001016300000086565b6020026040016000f35b346300000282576064356004018035610120526020016101a05260843560040180356101205114156300000282576020016101c05260a43560040180356101205114156300000282576020016101e0526001546101205110630000028257601961040053306c01000000000000000000000000026104025260043573ffffffffffffffffffffffffffffffffffffffff166c01000000000000000000000000026104165260243561042a52604435600401803590602001819061044a3761044a01600054815260200161040090036104002061010052600254610180526000610140526000610160525b610120516101405110156300000238576101005160005261014051602002806101a0510135602052806101c05101356040526101e051013560605260006080526020608060806000600060015af11563000002825760805180156300000282575b610180516101605110156300000282576101605180600101610160526003015481141563000001fc57506101405160010161014052630000019b565b600054600101600055604435600401803590602001819061040037600060008261040060243560043573ffffffffffffffffffffffffffffffffffffffff165af115630000028257005b60006000fd"
+
+// DeployMultisig deploys a new Ethereum contract, binding an instance of Multisig to it.
+func DeployMultisig(auth *bind.TransactOpts, backend bind.ContractBackend, threshold *big.Int, owners []common.Address) (common.Address, *types.Transaction, *Multisig, error) {
+	parsed, err := abi.JSON(strings.NewReader(MultisigABI))
+	if err != nil {
+		return common.Address{}, nil, nil, err
+	}
+
+	address, tx, contract, err := bind.DeployContract(auth, parsed, common.FromHex(MultisigBin), backend, threshold, owners)
+	if err != nil {
+		return common.Address{}, nil, nil, err
+	}
+	return address, tx, &Multisig{MultisigCaller: MultisigCaller{contract: contract}, MultisigTransactor: MultisigTransactor{contract: contract}, MultisigFilterer: MultisigFilterer{contract: contract}}, nil
+}
+
+// Multisig is an auto generated Go binding around an Ethereum contract.
+type Multisig struct {
+	MultisigCaller     // Read-only binding to the contract
+	MultisigTransactor // Write-only binding to the contract
+	MultisigFilterer   // Log filterer for contract events
+}
+
+// MultisigCaller is an auto generated read-only Go binding around an Ethereum contract.
+type MultisigCaller struct {
+	contract *bind.BoundContract // Generic contract wrapper for the low level calls
+}
+
+// MultisigTransactor is an auto generated write-only Go binding around an Ethereum contract.
+type MultisigTransactor struct {
+	contract *bind.BoundContract // Generic contract wrapper for the low level calls
+}
+
+// MultisigFilterer is an auto generated log filtering Go binding around an Ethereum contract events.
+type MultisigFilterer struct {
+	contract *bind.BoundContract // Generic contract wrapper for the low level calls
+}
+
+// MultisigSession is an auto generated Go binding around an Ethereum contract,
+// with pre-set call and transact options.
+type MultisigSession struct {
+	Contract     *Multisig         // Generic contract binding to set the session for
+	CallOpts     bind.CallOpts     // Call options to use throughout this session
+	TransactOpts bind.TransactOpts // Transaction auth options to use throughout this session
+}
+
+// MultisigCallerSession is an auto generated read-only Go binding around an Ethereum contract,
+// with pre-set call options.
+type MultisigCallerSession struct {
+	Contract *MultisigCaller // Generic contract caller binding to set the session for
+	CallOpts bind.CallOpts   // Call options to use throughout this session
+}
+
+// MultisigTransactorSession is an auto generated write-only Go binding around an Ethereum contract,
+// with pre-set transact options.
+type MultisigTransactorSession struct {
+	Contract     *MultisigTransactor // Generic contract transactor binding to set the session for
+	TransactOpts bind.TransactOpts   // Transaction auth options to use throughout this session
+}
+
+// MultisigRaw is an auto generated low-level Go binding around an Ethereum contract.
+type MultisigRaw struct {
+	Contract *Multisig // Generic contract binding to access the raw methods on
+}
+
+// MultisigCallerRaw is an auto generated low-level read-only Go binding around an Ethereum contract.
+type MultisigCallerRaw struct {
+	Contract *MultisigCaller // Generic read-only contract binding to access the raw methods on
+}
+
+// MultisigTransactorRaw is an auto generated low-level write-only Go binding around an Ethereum contract.
+type MultisigTransactorRaw struct {
+	Contract *MultisigTransactor // Generic write-only contract binding to access the raw methods on
+}
+
+// NewMultisig creates a new instance of Multisig, bound to a specific deployed contract.
+func NewMultisig(address common.Address, backend bind.ContractBackend) (*Multisig, error) {
+	contract, err := bindMultisig(address, backend, backend, backend)
+	if err != nil {
+		return nil, err
+	}
+	return &Multisig{MultisigCaller: MultisigCaller{contract: contract}, MultisigTransactor: MultisigTransactor{contract: contract}, MultisigFilterer: MultisigFilterer{contract: contract}}, nil
+}
+
+// NewMultisigCaller creates a new read-only instance of Multisig, bound to a specific deployed contract.
+func NewMultisigCaller(address common.Address, caller bind.ContractCaller) (*MultisigCaller, error) {
+	contract, err := bindMultisig(address, caller, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &MultisigCaller{contract: contract}, nil
+}
+
+// NewMultisigTransactor creates a new write-only instance of Multisig, bound to a specific deployed contract.
+func NewMultisigTransactor(address common.Address, transactor bind.ContractTransactor) (*MultisigTransactor, error) {
+	contract, err := bindMultisig(address, nil, transactor, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &MultisigTransactor{contract: contract}, nil
+}
+
+// NewMultisigFilterer creates a new log filterer instance of Multisig, bound to a specific deployed contract.
+func NewMultisigFilterer(address common.Address, filterer bind.ContractFilterer) (*MultisigFilterer, error) {
+	contract, err := bindMultisig(address, nil, nil, filterer)
+	if err != nil {
+		return nil, err
+	}
+	return &MultisigFilterer{contract: contract}, nil
+}
+
+// bindMultisig binds a generic wrapper to an already deployed contract.
+func bindMultisig(address common.Address, caller bind.ContractCaller, transactor bind.ContractTransactor, filterer bind.ContractFilterer) (*bind.BoundContract, error) {
+	parsed, err := abi.JSON(strings.NewReader(MultisigABI))
+	if err != nil {
+		return nil, err
+	}
+	return bind.NewBoundContract(address, parsed, caller, transactor, filterer), nil
+}
+
+// Call invokes the (constant) contract method with params as input values and
+// sets the output to result. The result type might be a single field for simple
+// returns, a slice of interfaces for anonymous returns and a struct for named
+// returns.
+func (_Multisig *MultisigRaw) Call(opts *bind.CallOpts, result interface{}, method string, params ...interface{}) error {
+	return _Multisig.Contract.MultisigCaller.contract.Call(opts, result, method, params...)
+}
+
+// Transfer initiates a plain transaction to move funds to the contract, calling
+// its default method if one is available.
+func (_Multisig *MultisigRaw) Transfer(opts *bind.TransactOpts) (*types.Transaction, error) {
+	return _Multisig.Contract.MultisigTransactor.contract.Transfer(opts)
+}
+
+// Transact invokes the (paid) contract method with params as input values.
+func (_Multisig *MultisigRaw) Transact(opts *bind.TransactOpts, method string, params ...interface{}) (*types.Transaction, error) {
+	return _Multisig.Contract.MultisigTransactor.contract.Transact(opts, method, params...)
+}
+
+// Call invokes the (constant) contract method with params as input values and
+// sets the output to result. The result type might be a single field for simple
+// returns, a slice of interfaces for anonymous returns and a struct for named
+// returns.
+func (_Multisig *MultisigCallerRaw) Call(opts *bind.CallOpts, result interface{}, method string, params ...interface{}) error {
+	return _Multisig.Contract.contract.Call(opts, result, method, params...)
+}
+
+// Transfer initiates a plain transaction to move funds to the contract, calling
+// its default method if one is available.
+func (_Multisig *MultisigTransactorRaw) Transfer(opts *bind.TransactOpts) (*types.Transaction, error) {
+	return _Multisig.Contract.contract.Transfer(opts)
+}
+
+// Transact invokes the (paid) contract method with params as input values.
+func (_Multisig *MultisigTransactorRaw) Transact(opts *bind.TransactOpts, method string, params ...interface{}) (*types.Transaction, error) {
+	return _Multisig.Contract.contract.Transact(opts, method, params...)
+}
+
+// GetOwners is a free data retrieval call binding the contract method 0xa0e67e2b.
+//
+// Solidity: function getOwners() view returns(address[])
+func (_Multisig *MultisigCaller) GetOwners(opts *bind.CallOpts) ([]common.Address, error) {
+	var (
+		ret0 = new([]common.Address)
+	)
+	out := ret0
+	err := _Multisig.contract.Call(opts, out, "getOwners")
+	return *ret0, err
+}
+
+// GetOwners is a free data retrieval call binding the contract method 0xa0e67e2b.
+//
+// Solidity: function getOwners() view returns(address[])
+func (_Multisig *MultisigSession) GetOwners() ([]common.Address, error) {
+	return _Multisig.Contract.GetOwners(&_Multisig.CallOpts)
+}
+
+// GetOwners is a free data retrieval call binding the contract method 0xa0e67e2b.
+//
+// Solidity: function getOwners() view returns(address[])
+func (_Multisig *MultisigCallerSession) GetOwners() ([]common.Address, error) {
+	return _Multisig.Contract.GetOwners(&_Multisig.CallOpts)
+}
+
+// Nonce is a free data retrieval call binding the contract method 0xaffed0e0.
+//
+// Solidity: function nonce() view returns(uint256)
+func (_Multisig *MultisigCaller) Nonce(opts *bind.CallOpts) (*big.Int, error) {
+	var (
+		ret0 = new(*big.Int)
+	)
+	out := ret0
+	err := _Multisig.contract.Call(opts, out, "nonce")
+	return *ret0, err
+}
+
+// Nonce is a free data retrieval call binding the contract method 0xaffed0e0.
+//
+// Solidity: function nonce() view returns(uint256)
+func (_Multisig *MultisigSession) Nonce() (*big.Int, error) {
+	return _Multisig.Contract.Nonce(&_Multisig.CallOpts)
+}
+
+// Nonce is a free data retrieval call binding the contract method 0xaffed0e0.
+//
+// Solidity: function nonce() view returns(uint256)
+func (_Multisig *MultisigCallerSession) Nonce() (*big.Int, error) {
+	return _Multisig.Contract.Nonce(&_Multisig.CallOpts)
+}
+
+// Threshold is a free data retrieval call binding the contract method 0x42cde4e8.
+//
+// Solidity: function threshold() view returns(uint256)
+func (_Multisig *MultisigCaller) Threshold(opts *bind.CallOpts) (*big.Int, error) {
+	var (
+		ret0 = new(*big.Int)
+	)
+	out := ret0
+	err := _Multisig.contract.Call(opts, out, "threshold")
+	return *ret0, err
+}
+
+// Threshold is a free data retrieval call binding the contract method 0x42cde4e8.
+//
+// Solidity: function threshold() view returns(uint256)
+func (_Multisig *MultisigSession) Threshold() (*big.Int, error) {
+	return _Multisig.Contract.Threshold(&_Multisig.CallOpts)
+}
+
+// Threshold is a free data retrieval call binding the contract method 0x42cde4e8.
+//
+// Solidity: function threshold() view returns(uint256)
+func (_Multisig *MultisigCallerSession) Threshold() (*big.Int, error) {
+	return _Multisig.Contract.Threshold(&_Multisig.CallOpts)
+}
+
+// Execute is a paid mutator transaction binding the contract method 0x3a49183e.
+//
+// Solidity: function execute(address destination, uint256 value, bytes data, uint8[] sigV, bytes32[] sigR, bytes32[] sigS) returns()
+func (_Multisig *MultisigTransactor) Execute(opts *bind.TransactOpts, destination common.Address, value *big.Int, data []byte, sigV []uint8, sigR [][32]byte, sigS [][32]byte) (*types.Transaction, error) {
+	return _Multisig.contract.Transact(opts, "execute", destination, value, data, sigV, sigR, sigS)
+}
+
+// Execute is a paid mutator transaction binding the contract method 0x3a49183e.
+//
+// Solidity: function execute(address destination, uint256 value, bytes data, uint8[] sigV, bytes32[] sigR, bytes32[] sigS) returns()
+func (_Multisig *MultisigSession) Execute(destination common.Address, value *big.Int, data []byte, sigV []uint8, sigR [][32]byte, sigS [][32]byte) (*types.Transaction, error) {
+	return _Multisig.Contract.Execute(&_Multisig.TransactOpts, destination, value, data, sigV, sigR, sigS)
+}
+
+// Execute is a paid mutator transaction binding the contract method 0x3a49183e.
+//
+// Solidity: function execute(address destination, uint256 value, bytes data, uint8[] sigV, bytes32[] sigR, bytes32[] sigS) returns()
+func (_Multisig *MultisigTransactorSession) Execute(destination common.Address, value *big.Int, data []byte, sigV []uint8, sigR [][32]byte, sigS [][32]byte) (*types.Transaction, error) {
+	return _Multisig.Contract.Execute(&_Multisig.TransactOpts, destination, value, data, sigV, sigR, sigS)
+}
+
+// Fallback is a paid mutator transaction binding the contract fallback function.
+//
+// Solidity: fallback() payable returns()
+func (_Multisig *MultisigTransactor) Fallback(opts *bind.TransactOpts, calldata []byte) (*types.Transaction, error) {
+	return _Multisig.contract.RawTransact(opts, calldata)
+}
+
+// Fallback is a paid mutator transaction binding the contract fallback function.
+//
+// Solidity: fallback() payable returns()
+func (_Multisig *MultisigSession) Fallback(calldata []byte) (*types.Transaction, error) {
+	return _Multisig.Contract.Fallback(&_Multisig.TransactOpts, calldata)
+}
+
+// Fallback is a paid mutator transaction binding the contract fallback function.
+//
+// Solidity: fallback() payable returns()
+func (_Multisig *MultisigTransactorSession) Fallback(calldata []byte) (*types.Transaction, error) {
+	return _Multisig.Contract.Fallback(&_Multisig.TransactOpts, calldata)
+}
@@ -0,0 +1,108 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package multisig packs and unpacks the calls of the multi-signature wallet
+// contract in the contract directory, which executes a call once enough of its
+// owners signed it off-chain.
+//
+// The signatures passed to execute have to be made by distinct owners, sorted
+// by ascending owner address, on the hash returned by SigningHash.
+package multisig
+
+//go:generate go run contract/gen.go -runtime contract/multisig.asm -deploy contract/deploy.asm -out contract/multisig.bin
+//go:generate abigen --abi contract/multisig.abi --bin contract/multisig.bin --pkg contract --type Multisig --out contract/multisig.go
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+
+	"truechain/discovery/accounts/abi"
+	"truechain/discovery/common"
+	"truechain/discovery/contracts/multisig/contract"
+	"truechain/discovery/crypto"
+)
+
+var errInvalidSignature = errors.New("invalid signature length")
+
+// Multisig packs and unpacks the calls of a multi-signature wallet contract.
+type Multisig struct {
+	abi abi.ABI
+}
+
+// New creates the packer of the multi-signature wallet calls.
+func New() (*Multisig, error) {
+	parsed, err := abi.JSON(strings.NewReader(contract.MultisigABI))
+	if err != nil {
+		return nil, err
+	}
+	return &Multisig{abi: parsed}, nil
+}
+
+// Pack packs the input of a call without arguments, used for the getters.
+func (m *Multisig) Pack(method string) ([]byte, error) {
+	return m.abi.Pack(method)
+}
+
+// UnpackUint unpacks the output of nonce() or threshold().
+func (m *Multisig) UnpackUint(method string, output []byte) (*big.Int, error) {
+	value := new(big.Int)
+	if err := m.abi.Unpack(&value, method, output); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// UnpackOwners unpacks the output of getOwners().
+func (m *Multisig) UnpackOwners(output []byte) ([]common.Address, error) {
+	var owners []common.Address
+	if err := m.abi.Unpack(&owners, "getOwners", output); err != nil {
+		return nil, err
+	}
+	return owners, nil
+}
+
+// PackExecute packs the input of execute() from the signatures in the
+// [R || S || V] format, which have to be sorted by ascending signer address.
+func (m *Multisig) PackExecute(destination common.Address, value *big.Int, data []byte, sigs [][]byte) ([]byte, error) {
+	var (
+		v    = make([]uint8, len(sigs))
+		r, s = make([][32]byte, len(sigs)), make([][32]byte, len(sigs))
+	)
+	for i, sig := range sigs {
+		if len(sig) != 65 {
+			return nil, errInvalidSignature
+		}
+		copy(r[i][:], sig[:32])
+		copy(s[i][:], sig[32:64])
+		v[i] = sig[64]
+	}
+	return m.abi.Pack("execute", destination, value, data, v, r, s)
+}
+
+// SigningHash returns the hash the owners sign to approve a call, following
+// EIP-191 version 0 (data with intended validator): the contract address, the
+// call and the nonce of the wallet are signed.
+func SigningHash(contract, destination common.Address, value *big.Int, data []byte, nonce uint64) common.Hash {
+	return crypto.Keccak256Hash(
+		[]byte{0x19, 0x00},
+		contract.Bytes(),
+		destination.Bytes(),
+		common.LeftPadBytes(value.Bytes(), 32),
+		data,
+		common.LeftPadBytes(new(big.Int).SetUint64(nonce).Bytes(), 32),
+	)
+}
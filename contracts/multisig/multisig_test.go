@@ -0,0 +1,230 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package multisig
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"math/big"
+	"sort"
+	"strings"
+	"testing"
+
+	truechain "truechain/discovery"
+	"truechain/discovery/accounts/abi"
+	"truechain/discovery/accounts/abi/bind"
+	"truechain/discovery/accounts/abi/bind/backends"
+	"truechain/discovery/common"
+	"truechain/discovery/contracts/multisig/contract"
+	"truechain/discovery/core/types"
+	"truechain/discovery/crypto"
+)
+
+var (
+	deployerKey, _ = crypto.GenerateKey()
+	deployerAddr   = crypto.PubkeyToAddress(deployerKey.PublicKey)
+)
+
+// newOwnerKeys creates n keys sorted by ascending address.
+func newOwnerKeys(n int) ([]*ecdsa.PrivateKey, []common.Address) {
+	keys := make([]*ecdsa.PrivateKey, n)
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := crypto.PubkeyToAddress(keys[i].PublicKey), crypto.PubkeyToAddress(keys[j].PublicKey)
+		return bytes.Compare(a[:], b[:]) < 0
+	})
+	addrs := make([]common.Address, n)
+	for i, key := range keys {
+		addrs[i] = crypto.PubkeyToAddress(key.PublicKey)
+	}
+	return keys, addrs
+}
+
+// sign signs a call hash the way an owner does, with V being 27 or 28.
+func sign(t *testing.T, hash common.Hash, key *ecdsa.PrivateKey) []byte {
+	sig, err := crypto.Sign(hash[:], key)
+	if err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+	sig[64] += 27
+	return sig
+}
+
+// call executes a call of the wallet on the current state.
+func call(backend *backends.SimulatedBackend, wallet common.Address, input []byte) ([]byte, error) {
+	return backend.CallContract(context.Background(), truechain.CallMsg{From: deployerAddr, To: &wallet, Data: input}, nil)
+}
+
+// Tests that the deployment of a wallet rejects owners which aren't sorted or
+// distinct and thresholds out of range.
+func TestDeploy(t *testing.T) {
+	_, owners := newOwnerKeys(3)
+
+	tests := []struct {
+		threshold int64
+		owners    []common.Address
+		ok        bool
+	}{
+		{2, owners, true},
+		{3, owners, true},
+		{0, owners, false},
+		{4, owners, false},
+		{1, []common.Address{owners[1], owners[0]}, false},
+		{1, []common.Address{owners[0], owners[0]}, false},
+		{1, []common.Address{{}, owners[0]}, false},
+	}
+	for i, tt := range tests {
+		backend := backends.NewSimulatedBackend(types.GenesisAlloc{deployerAddr: {Balance: big.NewInt(1000000000000000000)}}, 10000000)
+		addr, _, wallet, err := contract.DeployMultisig(bind.NewKeyedTransactor(deployerKey), backend, big.NewInt(tt.threshold), tt.owners)
+		if (err == nil) != tt.ok {
+			t.Errorf("test %d: deployment result mismatch: have %v, want ok %v", i, err, tt.ok)
+		}
+		if err != nil {
+			backend.Close()
+			continue
+		}
+		backend.Commit()
+
+		if code, _ := backend.CodeAt(context.Background(), addr, nil); len(code) == 0 {
+			t.Errorf("test %d: no code deployed", i)
+		}
+		threshold, err := wallet.Threshold(nil)
+		if err != nil || threshold.Int64() != tt.threshold {
+			t.Errorf("test %d: threshold mismatch: have %v, want %d (err %v)", i, threshold, tt.threshold, err)
+		}
+		stored, err := wallet.GetOwners(nil)
+		if err != nil || len(stored) != len(tt.owners) {
+			t.Errorf("test %d: owners mismatch: have %v, want %v (err %v)", i, stored, tt.owners, err)
+		}
+		backend.Close()
+	}
+}
+
+// Tests the propose, sign and relay workflow of a call against the wallet
+// contract: the state is read with the packed getters, the owners sign the
+// call hash and the relayed execution transfers the value once.
+func TestProposeSignRelay(t *testing.T) {
+	keys, owners := newOwnerKeys(3)
+	outsider, _ := crypto.GenerateKey()
+
+	backend := backends.NewSimulatedBackend(types.GenesisAlloc{deployerAddr: {Balance: big.NewInt(1000000000000000000)}}, 10000000)
+	defer backend.Close()
+
+	opts := bind.NewKeyedTransactor(deployerKey)
+	opts.Value = big.NewInt(1000000)
+	wallet, _, _, err := contract.DeployMultisig(opts, backend, big.NewInt(2), owners)
+	if err != nil {
+		t.Fatalf("failed to deploy: %v", err)
+	}
+	backend.Commit()
+
+	m, err := New()
+	if err != nil {
+		t.Fatalf("failed to parse ABI: %v", err)
+	}
+	// Propose: read the nonce, the threshold and the owners of the wallet
+	uints := make(map[string]uint64)
+	for _, method := range []string{"nonce", "threshold"} {
+		input, _ := m.Pack(method)
+		output, err := call(backend, wallet, input)
+		if err != nil {
+			t.Fatalf("%s() failed: %v", method, err)
+		}
+		value, err := m.UnpackUint(method, output)
+		if err != nil {
+			t.Fatalf("failed to unpack %s(): %v", method, err)
+		}
+		uints[method] = value.Uint64()
+	}
+	if uints["nonce"] != 0 || uints["threshold"] != 2 {
+		t.Fatalf("wallet state mismatch: have nonce %d threshold %d, want 0 and 2", uints["nonce"], uints["threshold"])
+	}
+	input, _ := m.Pack("getOwners")
+	output, err := call(backend, wallet, input)
+	if err != nil {
+		t.Fatalf("getOwners() failed: %v", err)
+	}
+	stored, err := m.UnpackOwners(output)
+	if err != nil {
+		t.Fatalf("failed to unpack getOwners(): %v", err)
+	}
+	for i := range owners {
+		if stored[i] != owners[i] {
+			t.Fatalf("owner %d mismatch: have %x, want %x", i, stored[i], owners[i])
+		}
+	}
+	var (
+		destination = common.HexToAddress("0x0102030405060708090a0b0c0d0e0f1011121314")
+		value       = big.NewInt(1000)
+		data        = []byte{0xde, 0xad, 0xbe, 0xef}
+		hash        = SigningHash(wallet, destination, value, data, uints["nonce"])
+	)
+	// Sign: the execution is only accepted with enough owner signatures,
+	// sorted by signer address
+	sig0, sig1, sig2 := sign(t, hash, keys[0]), sign(t, hash, keys[1]), sign(t, hash, keys[2])
+	tests := []struct {
+		sigs [][]byte
+		ok   bool
+	}{
+		{[][]byte{sig0}, false},
+		{[][]byte{sig1, sig0}, false},
+		{[][]byte{sig0, sig0}, false},
+		{[][]byte{sig0, sign(t, hash, outsider)}, false},
+		{[][]byte{sig0, sign(t, SigningHash(wallet, destination, value, data, 1), keys[1])}, false},
+		{[][]byte{sig0, sig2}, true},
+		{[][]byte{sig0, sig1, sig2}, true},
+	}
+	for i, tt := range tests {
+		input, err := m.PackExecute(destination, value, data, tt.sigs)
+		if err != nil {
+			t.Fatalf("test %d: failed to pack execute: %v", i, err)
+		}
+		if _, err := call(backend, wallet, input); (err == nil) != tt.ok {
+			t.Errorf("test %d: execution result mismatch: have %v, want ok %v", i, err, tt.ok)
+		}
+	}
+	// Relay: send the execution and check that it can't be replayed
+	input, err = m.PackExecute(destination, value, data, [][]byte{sig1, sig2})
+	if err != nil {
+		t.Fatalf("failed to pack execute: %v", err)
+	}
+	parsed, _ := abi.JSON(strings.NewReader(contract.MultisigABI))
+	relayer := bind.NewBoundContract(wallet, parsed, backend, backend, backend)
+	if _, err := relayer.RawTransact(bind.NewKeyedTransactor(deployerKey), input); err != nil {
+		t.Fatalf("failed to relay: %v", err)
+	}
+	backend.Commit()
+
+	if balance, _ := backend.BalanceAt(context.Background(), destination, nil); balance.Cmp(value) != 0 {
+		t.Errorf("destination balance mismatch: have %v, want %v", balance, value)
+	}
+	if balance, _ := backend.BalanceAt(context.Background(), wallet, nil); balance.Int64() != 1000000-1000 {
+		t.Errorf("wallet balance mismatch: have %v, want %d", balance, 1000000-1000)
+	}
+	input, _ = m.Pack("nonce")
+	output, _ = call(backend, wallet, input)
+	if nonce, _ := m.UnpackUint("nonce", output); nonce == nil || nonce.Uint64() != 1 {
+		t.Errorf("nonce mismatch: have %v, want 1", nonce)
+	}
+	input, _ = m.PackExecute(destination, value, data, [][]byte{sig1, sig2})
+	if _, err := call(backend, wallet, input); err == nil {
+		t.Errorf("replayed execution succeeded")
+	}
+}
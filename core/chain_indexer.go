@@ -20,6 +20,7 @@ import (
 	"context"
 	"encoding/binary"
 	"fmt"
+	"runtime/pprof"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -73,6 +74,7 @@ type ChainIndexer struct {
 	children []*ChainIndexer     // Child indexers to cascade chain updates to
 
 	active    uint32          // Flag whether the event loop was started
+	paused    uint32          // Flag whether section processing is suspended
 	update    chan struct{}   // Notification channel that headers should be processed
 	quit      chan chan error // Quit channel to tear down running goroutines
 	ctx       context.Context
@@ -113,7 +115,8 @@ func NewChainIndexer(chainDb, indexDb etruedb.Database, backend ChainIndexerBack
 	c.loadValidSections()
 	c.ctx, c.ctxCancel = context.WithCancel(context.Background())
 
-	go c.updateLoop()
+	// Label the updater so indexers can be told apart in goroutine profiles
+	go pprof.Do(context.Background(), pprof.Labels("indexer", kind), func(context.Context) { c.updateLoop() })
 
 	return c
 }
@@ -311,6 +314,10 @@ func (c *ChainIndexer) updateLoop() {
 			return
 
 		case <-c.update:
+			// Section processing suspended, pick up again on resume
+			if atomic.LoadUint32(&c.paused) != 0 {
+				continue
+			}
 			// Section headers completed (or rolled back), update the index
 			c.lock.Lock()
 			if c.knownSections > c.storedSections {
@@ -411,6 +418,43 @@ func (c *ChainIndexer) processSection(section uint64, lastHead common.Hash) (com
 	return lastHead, nil
 }
 
+// SetThrottling changes the delay between processing consecutive sections.
+func (c *ChainIndexer) SetThrottling(throttling time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.throttling = throttling
+}
+
+// Pause suspends the processing of new sections by the indexer and all of its
+// children until Resume is called. Incoming head events are still tracked.
+func (c *ChainIndexer) Pause() {
+	atomic.StoreUint32(&c.paused, 1)
+
+	c.lock.RLock()
+	children := c.children
+	c.lock.RUnlock()
+	for _, child := range children {
+		child.Pause()
+	}
+}
+
+// Resume continues the section processing suspended by Pause.
+func (c *ChainIndexer) Resume() {
+	if atomic.SwapUint32(&c.paused, 0) != 0 {
+		select {
+		case c.update <- struct{}{}:
+		default:
+		}
+	}
+	c.lock.RLock()
+	children := c.children
+	c.lock.RUnlock()
+	for _, child := range children {
+		child.Resume()
+	}
+}
+
 // Sections returns the number of processed sections maintained by the indexer
 // and also the information about the last header indexed for potential canonical
 // verifications.
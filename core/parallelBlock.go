@@ -397,6 +397,7 @@ func (pb *ParallelBlock) executeGroup(group *ExecutionGroup, wg *sync.WaitGroup)
 			return
 		}
 		txInfo.result = NewTrxResult(receipt, statedb.FinalizeTouchedAddress(), trxUsedGas, feeAmount)
+		group.AddFeeAmount(feeAmount)
 	}
 	group.SetStartTrxPos(-1)
 }
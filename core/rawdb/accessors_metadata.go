@@ -69,3 +69,18 @@ func WritePreimages(db DatabaseWriter, number uint64, preimages map[common.Hash]
 	preimageCounter.Inc(int64(len(preimages)))
 	preimageHitCounter.Inc(int64(len(preimages)))
 }
+
+// ReadServerPoolNodes retrieves the encoded known light servers of a discovery
+// topic and their statistics.
+func ReadServerPoolNodes(db DatabaseReader, topic string) []byte {
+	data, _ := db.Get(serverPoolKey(topic))
+	return data
+}
+
+// WriteServerPoolNodes stores the encoded known light servers of a discovery
+// topic and their statistics.
+func WriteServerPoolNodes(db DatabaseWriter, topic string, enc []byte) {
+	if err := db.Put(serverPoolKey(topic), enc); err != nil {
+		log.Error("Failed to store server pool nodes", "err", err)
+	}
+}
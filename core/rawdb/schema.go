@@ -18,6 +18,7 @@
 package rawdb
 
 import (
+	"bytes"
 	"encoding/binary"
 
 	"truechain/discovery/common"
@@ -64,6 +65,7 @@ var (
 	configPrefix      = []byte("truechain-config-") // config prefix for the db
 	rewardInfoPrefix  = []byte("sri")
 	balanceInfoPrefix = []byte("srb")
+	serverPoolPrefix  = []byte("lsp-") // serverPoolPrefix + discovery topic -> known light servers and their statistics
 
 	// Chain index prefixes (use `i` + single byte to avoid mixing data types).
 	BloomBitsIndexPrefix = []byte("iB") // BloomBitsIndexPrefix is the data table of a chain indexer to track its progress
@@ -99,6 +101,16 @@ func headerKey(number uint64, hash common.Hash) []byte {
 	return append(append(headerPrefix, encodeBlockNumber(number)...), hash.Bytes()...)
 }
 
+// SplitHeaderKey returns the number and hash of a header key, ok is false if the
+// key isn't one.
+func SplitHeaderKey(key []byte) (number uint64, hash common.Hash, ok bool) {
+	if len(key) != len(headerPrefix)+8+common.HashLength || !bytes.HasPrefix(key, headerPrefix) {
+		return 0, common.Hash{}, false
+	}
+	number = binary.BigEndian.Uint64(key[len(headerPrefix):])
+	return number, common.BytesToHash(key[len(headerPrefix)+8:]), true
+}
+
 // headerTDKey = headerPrefix + num (uint64 big endian) + hash + headerTDSuffix
 func headerTDKey(number uint64, hash common.Hash) []byte {
 	return append(headerKey(number, hash), headerTDSuffix...)
@@ -154,6 +166,11 @@ func configKey(hash common.Hash) []byte {
 	return append(configPrefix, hash.Bytes()...)
 }
 
+// serverPoolKey = serverPoolPrefix + topic
+func serverPoolKey(topic string) []byte {
+	return append(append([]byte{}, serverPoolPrefix...), topic...)
+}
+
 // headerCIKey = headerPrefix + num (uint64 big endian) + hash + headerTDSuffix
 func headerCIKey(number uint64, hash common.Hash) []byte {
 	return append(headerKey(number, hash), headerCISuffix...)
@@ -18,6 +18,7 @@
 package rawdb
 
 import (
+	"bytes"
 	"encoding/binary"
 
 	"truechain/discovery/common"
@@ -83,6 +84,16 @@ func headerKey(number uint64, hash common.Hash) []byte {
 	return append(append(headerPrefix, encodeBlockNumber(number)...), hash.Bytes()...)
 }
 
+// SplitHeaderKey returns the number and hash of a header key, ok is false if the
+// key isn't one.
+func SplitHeaderKey(key []byte) (number uint64, hash common.Hash, ok bool) {
+	if len(key) != len(headerPrefix)+8+common.HashLength || !bytes.HasPrefix(key, headerPrefix) {
+		return 0, common.Hash{}, false
+	}
+	number = binary.BigEndian.Uint64(key[len(headerPrefix):])
+	return number, common.BytesToHash(key[len(headerPrefix)+8:]), true
+}
+
 // headerTDKey = headerPrefix + num (uint64 big endian) + hash + headerTDSuffix
 func headerTDKey(number uint64, hash common.Hash) []byte {
 	return append(headerKey(number, hash), headerTDSuffix...)
@@ -103,6 +103,8 @@ type stateObject struct {
 	originPOSStorage POSStorage
 	dirtyPOSStorage  POSStorage
 
+	fakeStorage Storage // Storage replacing the storage trie entirely, used to override the state of calls
+
 	// Cache flags.
 	// When an object is marked suicided it will be delete from the trie
 	// during the "update" phase of the state transition.
@@ -186,6 +188,10 @@ func (c *stateObject) getTrie(db Database) Trie {
 
 // GetState retrieves a value from the account storage trie.
 func (self *stateObject) GetState(db Database, key common.Hash) common.Hash {
+	// If the storage is overridden, the trie is never read
+	if self.fakeStorage != nil {
+		return self.fakeStorage[key]
+	}
 	// If we have a dirty value for this state entry, return it
 	value, dirty := self.dirtyStorage[key]
 	if dirty {
@@ -197,6 +203,10 @@ func (self *stateObject) GetState(db Database, key common.Hash) common.Hash {
 
 // GetCommittedState retrieves a value from the committed account storage trie.
 func (self *stateObject) GetCommittedState(db Database, key common.Hash) common.Hash {
+	// If the storage is overridden, the trie is never read
+	if self.fakeStorage != nil {
+		return self.fakeStorage[key]
+	}
 	// If we have the original value cached, return that
 	value, cached := self.originStorage[key]
 	if cached {
@@ -249,9 +259,24 @@ func (self *stateObject) SetState(db Database, key, value common.Hash) {
 }
 
 func (self *stateObject) setState(key, value common.Hash) {
+	// If the storage is overridden, keep the update in the override
+	if self.fakeStorage != nil {
+		self.fakeStorage[key] = value
+		return
+	}
 	self.dirtyStorage[key] = value
 }
 
+// SetStorage replaces the entire storage of the account, used to override the
+// state of a call. The storage trie isn't read anymore, so on a light client no
+// entry of it is retrieved on demand.
+func (self *stateObject) SetStorage(storage map[common.Hash]common.Hash) {
+	self.fakeStorage = make(Storage)
+	for key, value := range storage {
+		self.fakeStorage[key] = value
+	}
+}
+
 func (self *stateObject) SetPOSState(db Database, key common.Hash, value []byte) {
 	self.db.journal.append(posStorageChange{
 		account:  &self.address,
@@ -369,6 +394,9 @@ func (self *stateObject) deepCopy(db *StateDB) *stateObject {
 	stateObject.originStorage = self.originStorage.Copy()
 	stateObject.dirtyPOSStorage = self.dirtyPOSStorage.Copy()
 	stateObject.originPOSStorage = self.originPOSStorage.Copy()
+	if self.fakeStorage != nil {
+		stateObject.fakeStorage = self.fakeStorage.Copy()
+	}
 	stateObject.suicided = self.suicided
 	stateObject.dirtyCode = self.dirtyCode
 	stateObject.deleted = self.deleted
@@ -60,6 +60,12 @@ func lockedKey(addr common.Address) (h common.Hash) {
 	return crypto.Keccak256Hash(base)
 }
 
+// LockedKey returns the storage key of the staking address holding the locked
+// balance of an address.
+func LockedKey(addr common.Address) common.Hash {
+	return lockedKey(addr)
+}
+
 // StateDBs within the ethereum protocol are used to store anything
 // within the merkle trie. StateDBs take care of caching and storing
 // nested states. It's the general query interface to retrieve:
@@ -439,6 +445,15 @@ func (self *StateDB) SetState(addr common.Address, key, value common.Hash) {
 	}
 }
 
+// SetStorage replaces the entire storage of the given account, used to override
+// the state of a call. It must not be used for state which is committed.
+func (self *StateDB) SetStorage(addr common.Address, storage map[common.Hash]common.Hash) {
+	stateObject := self.GetOrNewStateObject(addr)
+	if stateObject != nil {
+		stateObject.SetStorage(storage)
+	}
+}
+
 // Suicide marks the given account as suicided.
 // This clears the account balance.
 //
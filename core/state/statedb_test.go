@@ -443,3 +443,47 @@ func TestCopyOfCopy(t *testing.T) {
 		t.Fatalf("2nd copy fail, expected 42, got %v", got)
 	}
 }
+
+// Tests that replacing the storage of an account hides the entries of its
+// storage trie, while the updates of the overridden storage are kept.
+func TestSetStorage(t *testing.T) {
+	db := NewDatabase(ethdb.NewMemDatabase())
+	sdb, _ := New(common.Hash{}, db)
+	addr := common.HexToAddress("aaaa")
+	sdb.SetState(addr, common.Hash{1}, common.Hash{1})
+	sdb.SetState(addr, common.Hash{2}, common.Hash{2})
+	root, _ := sdb.Commit(false)
+
+	sdb, _ = New(root, db)
+	sdb.SetStorage(addr, map[common.Hash]common.Hash{{2}: {3}})
+	if got := sdb.GetState(addr, common.Hash{1}); got != (common.Hash{}) {
+		t.Fatalf("replaced entry visible: got %x", got)
+	}
+	if got := sdb.GetState(addr, common.Hash{2}); got != (common.Hash{3}) {
+		t.Fatalf("overridden entry mismatch: got %x, want %x", got, common.Hash{3})
+	}
+	sdb.SetState(addr, common.Hash{4}, common.Hash{4})
+	if got := sdb.GetState(addr, common.Hash{4}); got != (common.Hash{4}) {
+		t.Fatalf("update of overridden storage mismatch: got %x, want %x", got, common.Hash{4})
+	}
+}
+
+// Tests that the updates of an overridden storage are journaled, so reverting
+// to a snapshot restores the overridden entries too.
+func TestSetStorageRevert(t *testing.T) {
+	sdb, _ := New(common.Hash{}, NewDatabase(ethdb.NewMemDatabase()))
+	addr := common.HexToAddress("aaaa")
+	sdb.SetStorage(addr, map[common.Hash]common.Hash{{1}: {1}})
+
+	snap := sdb.Snapshot()
+	sdb.SetState(addr, common.Hash{1}, common.Hash{2})
+	sdb.SetState(addr, common.Hash{3}, common.Hash{3})
+	sdb.RevertToSnapshot(snap)
+
+	if got := sdb.GetState(addr, common.Hash{1}); got != (common.Hash{1}) {
+		t.Fatalf("overridden entry not reverted: got %x, want %x", got, common.Hash{1})
+	}
+	if got := sdb.GetState(addr, common.Hash{3}); got != (common.Hash{}) {
+		t.Fatalf("new entry not reverted: got %x", got)
+	}
+}
@@ -18,6 +18,7 @@ package etrue
 
 import (
 	"context"
+	"errors"
 	"math/big"
 
 	"truechain/discovery/accounts"
@@ -37,6 +38,9 @@ import (
 	"truechain/discovery/rpc"
 )
 
+// errQuorumUnsupported is returned for quorum reads on a full node.
+var errQuorumUnsupported = errors.New("quorum reads are only supported by light clients")
+
 // TRUEAPIBackend implements ethapi.Backend for full nodes
 type TrueAPIBackend struct {
 	etrue *Truechain
@@ -150,6 +154,12 @@ func (b *TrueAPIBackend) StateAndHeaderByNumber(ctx context.Context, blockNr rpc
 	return stateDb, header, err
 }
 
+// QuorumStateAndHeader is only supported by light clients, a full node doesn't
+// depend on the servers for its state.
+func (b *TrueAPIBackend) QuorumStateAndHeader(ctx context.Context, addr common.Address, blockNr rpc.BlockNumber, quorum int) (*state.StateDB, *types.Header, error) {
+	return nil, nil, errQuorumUnsupported
+}
+
 // GetBlock returns the block by the block's hash
 func (b *TrueAPIBackend) GetBlock(ctx context.Context, hash common.Hash) (*types.Block, error) {
 	return b.etrue.blockchain.GetBlockByHash(hash), nil
@@ -214,6 +224,11 @@ func (b *TrueAPIBackend) SubscribeChainEvent(ch chan<- types.FastChainEvent) eve
 	return b.etrue.BlockChain().SubscribeChainEvent(ch)
 }
 
+// SubscribeSnailChainEvent registers a subscription of chainEvnet in snail blockchain
+func (b *TrueAPIBackend) SubscribeSnailChainEvent(ch chan<- types.SnailChainEvent) event.Subscription {
+	return b.etrue.SnailBlockChain().SubscribeChainEvent(ch)
+}
+
 // SubscribeChainHeadEvent registers a subscription of chainHeadEvnet in fast blockchain
 func (b *TrueAPIBackend) SubscribeChainHeadEvent(ch chan<- types.FastChainHeadEvent) event.Subscription {
 	return b.etrue.BlockChain().SubscribeChainHeadEvent(ch)
@@ -336,6 +351,10 @@ func (b *TrueAPIBackend) TxPoolContent() (map[common.Address]types.Transactions,
 	return b.etrue.TxPool().Content()
 }
 
+func (b *TrueAPIBackend) PriceBump() uint64 {
+	return b.etrue.txPool.PriceBump()
+}
+
 // SubscribeNewTxsEvent returns the subscript event of new tx
 func (b *TrueAPIBackend) SubscribeNewTxsEvent(ch chan<- types.NewTxsEvent) event.Subscription {
 	return b.etrue.TxPool().SubscribeNewTxsEvent(ch)
@@ -144,13 +144,17 @@ func New(ctx *node.ServiceContext, config *Config) (*Truechain, error) {
 		config.MinerGasCeil = config.Genesis.GasLimit * 11 / 10
 	}*/
 
+	engine, err := NewConsensusEngine(ctx, config, chainConfig, chainDb)
+	if err != nil {
+		return nil, err
+	}
 	etrue := &Truechain{
 		config:         config,
 		chainDb:        chainDb,
 		chainConfig:    chainConfig,
 		eventMux:       ctx.EventMux,
 		accountManager: ctx.AccountManager,
-		engine:         CreateConsensusEngine(ctx, &config.MinervaHash, chainConfig, chainDb),
+		engine:         engine,
 		shutdownChan:   make(chan bool),
 		networkID:      config.NetworkId,
 		gasPrice:       config.GasPrice,
@@ -268,9 +272,21 @@ func makeExtraData(extra []byte) []byte {
 	return extra
 }
 
-// CreateDB creates the chain database.
+// CreateDB creates the chain database with the configured backend.
 func CreateDB(ctx *node.ServiceContext, config *Config, name string) (etruedb.Database, error) {
-	db, err := ctx.OpenDatabase(name, config.DatabaseCache, config.DatabaseHandles)
+	var (
+		db  etruedb.Database
+		err error
+	)
+	switch config.DatabaseBackend {
+	case "", etruedb.BackendLevelDB:
+		db, err = ctx.OpenDatabase(name, config.DatabaseCache, config.DatabaseHandles)
+	case etruedb.BackendMemory:
+		log.Warn("Chain database kept in memory, it is lost on shutdown", "name", name)
+		db = etruedb.NewMemDatabase()
+	default:
+		err = fmt.Errorf("unknown database backend %q", config.DatabaseBackend)
+	}
 	if err != nil {
 		return nil, err
 	}
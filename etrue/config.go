@@ -94,7 +94,7 @@ func init() {
 type Config struct {
 	// The genesis block, which is inserted if the database is empty.
 	// If nil, the Truechain main net block is used.
-	Genesis *core.Genesis
+	Genesis *core.Genesis `toml:",omitempty"`
 	// FastGenesis  *fastchain.Genesis
 	// SnailGenesis *snailchain.Genesis
 
@@ -111,6 +111,102 @@ type Config struct {
 	LightServ  int `toml:",omitempty"` // Maximum percentage of time allowed for serving LES requests
 	LightPeers int `toml:",omitempty"` // Maximum number of LES client peers
 
+	LightServeFilters bool `toml:",omitempty"` // Serve compact block filters to LES clients (experimental)
+	LightProofDecoys  int  `toml:",omitempty"` // Number of decoy accounts bundled with each account proof request
+	LightPrivacyMode  bool `toml:",omitempty"` // Spread requests about the same account over different servers
+	LightEventBuffer  int  `toml:",omitempty"` // Head and log events buffered per subscriber, oldest dropped on overflow
+	LightMaxPerGroup  int  `toml:",omitempty"` // Maximum number of servers from the same network group (/16 or ASN)
+
+	// Servers announcing a head required before switching to it outside ULC mode (0 or 1 = any server)
+	LightAnnounceConfirms int `toml:",omitempty"`
+
+	// Re-execute failed transactions to add their revert reason to the receipt (retrieves the block state)
+	LightRevertReasons bool `toml:",omitempty"`
+
+	// Recent sections whose ODR cached chain data is kept by the light client (0 = never pruned automatically)
+	LightPruneSections uint64 `toml:",omitempty"`
+
+	// Keep the headers older than the trusted checkpoint in append-only flat files instead of LevelDB
+	LightFreezer bool `toml:",omitempty"`
+
+	// Flow control parameters of the LES client peers (0 = derived from the request costs)
+	LightRecharge uint64 `toml:",omitempty"` // Minimum recharge rate of a free client's buffer, in cost units per second
+	LightBufLimit uint64 `toml:",omitempty"` // Buffer limit of a free client, in cost units
+
+	// Time after which a light client request is duplicated to another server (0 = only after the soft timeout)
+	LightHedgeTimeout time.Duration `toml:",omitempty"`
+
+	// Timeout and retry policy of the light client requests, zero values select the defaults
+	LightRequestTimeout     time.Duration `toml:",omitempty"` // Soft timeout, the request is also sent to another server
+	LightRequestHardTimeout time.Duration `toml:",omitempty"` // Hard timeout, the server is dropped
+	LightRequestRetries     int           `toml:",omitempty"` // Maximum resends of a request to other servers (0 = unlimited)
+	LightRequestBackoff     string        `toml:",omitempty"` // Retry delay while no server is suitable: "constant" or "exponential"
+	LightRequestPeerWait    time.Duration `toml:",omitempty"` // Time a request waits for a suitable server before failing
+
+	// Start the light client even if the network id differs from the chain id
+	LightAllowIdMismatch bool `toml:",omitempty"`
+
+	// Gas price bounds of transactions relayed by the light client (nil = derived from the gas price oracle)
+	LightMinGasPrice *big.Int `toml:",omitempty"`
+	LightMaxGasPrice *big.Int `toml:",omitempty"`
+
+	// Pending transaction limits of the light client pool per sender and in total (0 = unlimited)
+	LightTxAccountSlots uint64 `toml:",omitempty"`
+	LightTxGlobalSlots  uint64 `toml:",omitempty"`
+
+	// Servers (enode URLs) only used for transaction relay, or never relayed to
+	LightRelayOnly []string `toml:",omitempty"`
+	LightSyncOnly  []string `toml:",omitempty"`
+
+	// Light client profile whose defaults are layered over the ones above (see les.ApplyLightProfile)
+	LightProfile         string        `toml:",omitempty"`
+	LightIndexerThrottle time.Duration `toml:",omitempty"` // Delay between processing two indexer sections
+
+	// Light client resource limits, background work is shed above them (0 = disabled)
+	LightMemoryLimit int `toml:",omitempty"` // Heap size in megabytes
+	LightCPULimit    int `toml:",omitempty"` // Process CPU usage in percent of a single core
+
+	// Back up the headers dropped by a rewind caused by a chain config upgrade
+	LightRewindBackup bool `toml:",omitempty"`
+
+	// URL receiving a JSON POST for every reorg affecting a watched transaction
+	LightTxWebhook string `toml:",omitempty"`
+
+	// URL receiving a JSON POST for every batch of deposits to the watched addresses
+	LightDepositWebhook string `toml:",omitempty"`
+
+	// Accounts whose state is synced at every head, so that queries about them are served locally
+	LightHotAccounts []common.Address `toml:",omitempty"`
+
+	// HTTPS JSON-RPC endpoint the head hash is periodically cross-checked against
+	LightHeadCheckURL      string        `toml:",omitempty"`
+	LightHeadCheckInterval time.Duration `toml:",omitempty"`
+
+	// Memory allowance (MB) for caching trie nodes, code and receipts retrieved by the light client (0 = disabled)
+	CacheSizeMB int `toml:",omitempty"`
+
+	// Number of trie nodes the light client remembers per server so that they can be omitted from proofs (0 = default, negative = disabled)
+	LightNodeSession int `toml:",omitempty"`
+
+	// Format of the proofs requested by the light client: "compact" (default) or "raw"
+	LightProofFormat string `toml:",omitempty"`
+
+	// Extra discv5 topics light servers are advertised and searched under, e.g. of
+	// archive servers or private networks. The topics derived from the genesis hash
+	// are left out if LightNoDefaultTopic is set and extra topics are given.
+	LightTopics         []string `toml:",omitempty"`
+	LightNoDefaultTopic bool     `toml:",omitempty"`
+
+	// Don't advertise the discv5 topics of the light server
+	LightNoAdvertise bool `toml:",omitempty"`
+
+	// Namespaces of the light client APIs to register, all if empty. A namespace
+	// suffixed by ":admin", e.g. "les:admin", is kept off the public endpoints.
+	LightAPIModules []string `toml:",omitempty"`
+
+	// Checkpoint oracle overriding the built-in m-of-n signer set of the network
+	CheckpointOracle *params.CheckpointOracleConfig `toml:",omitempty"`
+
 	// election options
 
 	EnableElection bool `toml:",omitempty"`
@@ -137,6 +233,7 @@ type Config struct {
 	SkipBcVersionCheck bool `toml:"-"`
 	DatabaseHandles    int  `toml:"-"`
 	DatabaseCache      int
+	DatabaseBackend    string `toml:",omitempty"` // leveldb (default) or memory
 	TrieCache          int
 	TrieTimeout        time.Duration
 
@@ -148,6 +245,9 @@ type Config struct {
 	MinerGasCeil  uint64
 	GasPrice      *big.Int
 
+	// Consensus engine registered under this name (see RegisterConsensusEngine), minerva if empty
+	ConsensusEngine string `toml:",omitempty"`
+
 	// MinervaHash options
 	MinervaHash minerva.Config
 
@@ -184,5 +284,6 @@ func (c *Config) GetNodeType() bool {
 }
 
 type configMarshaling struct {
-	ExtraData hexutil.Bytes
+	CommitteeKey hexutil.Bytes
+	ExtraData    hexutil.Bytes
 }
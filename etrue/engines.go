@@ -0,0 +1,85 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package etrue
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"truechain/discovery/consensus"
+	"truechain/discovery/etruedb"
+	"truechain/discovery/node"
+	"truechain/discovery/params"
+)
+
+// EngineMinerva is the name of the default consensus engine.
+const EngineMinerva = "minerva"
+
+// EngineConstructor creates a consensus engine selectable in the config. The
+// engine is wired to the election and the snail chain by the service creating
+// it, through the setters of consensus.Engine.
+type EngineConstructor func(ctx *node.ServiceContext, config *Config, chainConfig *params.ChainConfig, db etruedb.Database) (consensus.Engine, error)
+
+var (
+	enginesLock sync.RWMutex
+	engines     = map[string]EngineConstructor{
+		EngineMinerva: func(ctx *node.ServiceContext, config *Config, chainConfig *params.ChainConfig, db etruedb.Database) (consensus.Engine, error) {
+			return CreateConsensusEngine(ctx, &config.MinervaHash, chainConfig, db), nil
+		},
+	}
+)
+
+// RegisterConsensusEngine makes a consensus engine selectable by name in
+// Config.ConsensusEngine, e.g. a testnet engine or a fake engine for
+// integration tests. It must be called before the services are created.
+func RegisterConsensusEngine(name string, constructor EngineConstructor) {
+	enginesLock.Lock()
+	defer enginesLock.Unlock()
+
+	engines[name] = constructor
+}
+
+// NewConsensusEngine creates the consensus engine selected in the config,
+// Minerva if none is selected.
+func NewConsensusEngine(ctx *node.ServiceContext, config *Config, chainConfig *params.ChainConfig, db etruedb.Database) (consensus.Engine, error) {
+	name := config.ConsensusEngine
+	if name == "" {
+		name = EngineMinerva
+	}
+	enginesLock.RLock()
+	constructor, ok := engines[name]
+	enginesLock.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown consensus engine %q, registered: %v", name, ConsensusEngines())
+	}
+	return constructor(ctx, config, chainConfig, db)
+}
+
+// ConsensusEngines returns the names of the registered consensus engines.
+func ConsensusEngines() []string {
+	enginesLock.RLock()
+	defer enginesLock.RUnlock()
+
+	names := make([]string, 0, len(engines))
+	for name := range engines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
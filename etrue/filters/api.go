@@ -31,6 +31,7 @@ import (
 	"truechain/discovery/core/types"
 	"truechain/discovery/etruedb"
 	"truechain/discovery/event"
+	"truechain/discovery/log"
 	"truechain/discovery/rpc"
 )
 
@@ -59,16 +60,18 @@ type PublicFilterAPI struct {
 	events    *EventSystem
 	filtersMu sync.Mutex
 	filters   map[rpc.ID]*filter
+	lightMode bool
 }
 
 // NewPublicFilterAPI returns a new PublicFilterAPI instance.
 func NewPublicFilterAPI(backend Backend, lightMode bool) *PublicFilterAPI {
 	api := &PublicFilterAPI{
-		backend: backend,
-		mux:     backend.EventMux(),
-		chainDb: backend.ChainDb(),
-		events:  NewEventSystem(backend.EventMux(), backend, lightMode),
-		filters: make(map[rpc.ID]*filter),
+		backend:   backend,
+		mux:       backend.EventMux(),
+		chainDb:   backend.ChainDb(),
+		events:    NewEventSystem(backend.EventMux(), backend, lightMode),
+		filters:   make(map[rpc.ID]*filter),
+		lightMode: lightMode,
 	}
 	go api.timeoutLoop()
 
@@ -233,7 +236,117 @@ func (api *PublicFilterAPI) NewHeads(ctx context.Context) (*rpc.Subscription, er
 	return rpcSub, nil
 }
 
+// NewSnailBlockFilter creates a filter that fetches the hashes of the snail
+// blocks imported into the snail chain, polled with etrue_getFilterChanges.
+func (api *PublicFilterAPI) NewSnailBlockFilter() rpc.ID {
+	var (
+		headers   = make(chan *types.SnailHeader)
+		headerSub = api.events.SubscribeNewSnailHeads(headers)
+	)
+
+	api.filtersMu.Lock()
+	api.filters[headerSub.ID] = &filter{typ: SnailBlocksSubscription, deadline: time.NewTimer(deadline), hashes: make([]common.Hash, 0), s: headerSub}
+	api.filtersMu.Unlock()
+
+	go func() {
+		for {
+			select {
+			case h := <-headers:
+				api.filtersMu.Lock()
+				if f, found := api.filters[headerSub.ID]; found {
+					f.hashes = append(f.hashes, h.Hash())
+				}
+				api.filtersMu.Unlock()
+			case <-headerSub.Err():
+				api.filtersMu.Lock()
+				delete(api.filters, headerSub.ID)
+				api.filtersMu.Unlock()
+				return
+			}
+		}
+	}()
+
+	return headerSub.ID
+}
+
+// NewSnailHeads send a notification each time a new snail block header is
+// appended to the snail chain.
+func (api *PublicFilterAPI) NewSnailHeads(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		headers := make(chan *types.SnailHeader)
+		headersSub := api.events.SubscribeNewSnailHeads(headers)
+
+		for {
+			select {
+			case h := <-headers:
+				notifier.Notify(rpcSub.ID, h)
+			case <-rpcSub.Err():
+				headersSub.Unsubscribe()
+				return
+			case <-notifier.Closed():
+				headersSub.Unsubscribe()
+				return
+			}
+		}
+	}()
+
+	return rpcSub, nil
+}
+
+// NewFruits send a notification with the fruit headers of each new snail block.
+// In light mode the fruits are retrieved from the servers, a block whose fruits
+// can't be retrieved is skipped.
+func (api *PublicFilterAPI) NewFruits(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		headers := make(chan *types.SnailHeader)
+		headersSub := api.events.SubscribeNewSnailHeads(headers)
+
+		for {
+			select {
+			case h := <-headers:
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+				block, err := api.backend.GetSnailBlock(ctx, h.Hash())
+				cancel()
+				if block == nil || err != nil {
+					log.Debug("Failed to retrieve fruits of snail block", "number", h.Number, "hash", h.Hash(), "err", err)
+					continue
+				}
+				for _, fruit := range block.Fruits() {
+					notifier.Notify(rpcSub.ID, fruit.Header())
+				}
+			case <-rpcSub.Err():
+				headersSub.Unsubscribe()
+				return
+			case <-notifier.Closed():
+				headersSub.Unsubscribe()
+				return
+			}
+		}
+	}()
+
+	return rpcSub, nil
+}
+
 // Logs creates a subscription that fires for all new log that match the given filter criteria.
+//
+// In light mode a subscription starting at a specific block is backfilled: the
+// logs between that block and the current head (or the end block of the
+// criteria if it's earlier) are retrieved through the bloom trie and streamed
+// first, the new logs follow once the backfill is done.
 func (api *PublicFilterAPI) Logs(ctx context.Context, crit FilterCriteria) (*rpc.Subscription, error) {
 	notifier, supported := rpc.NotifierFromContext(ctx)
 	if !supported {
@@ -249,15 +362,62 @@ func (api *PublicFilterAPI) Logs(ctx context.Context, crit FilterCriteria) (*rpc
 	if err != nil {
 		return nil, err
 	}
+	// Resolve the backfilled range before any new log is delivered, the new logs
+	// of the blocks up to the head are covered by the backfill.
+	var (
+		backfill chan error
+		head     uint64
+	)
+	if api.lightMode && crit.FromBlock != nil && crit.FromBlock.Sign() >= 0 {
+		header, err := api.backend.HeaderByNumber(ctx, rpc.LatestBlockNumber)
+		if err != nil || header == nil {
+			logsSub.Unsubscribe()
+			return nil, fmt.Errorf("failed to retrieve the head for the backfill: %v", err)
+		}
+		head = header.Number.Uint64()
+		if crit.ToBlock != nil && crit.ToBlock.Sign() >= 0 && crit.ToBlock.Uint64() < head {
+			head = crit.ToBlock.Uint64()
+		}
+		if crit.FromBlock.Uint64() <= head {
+			backfill = make(chan error, 1)
+		}
+	}
 
 	go func() {
-
+		// The new logs are held back while the backfill runs, the event
+		// system must not be blocked meanwhile.
+		var (
+			pending             []*types.Log
+			backfillCtx, cancel = context.WithCancel(context.Background())
+		)
+		defer cancel()
+
+		if backfill != nil {
+			go func(done chan error) {
+				done <- api.backfillLogs(backfillCtx, notifier, rpcSub.ID, crit, head)
+			}(backfill)
+		}
 		for {
 			select {
 			case logs := <-matchedLogs:
+				if backfill != nil {
+					pending = append(pending, logs...)
+					continue
+				}
 				for _, log := range logs {
 					notifier.Notify(rpcSub.ID, &log)
 				}
+			case err := <-backfill:
+				if err != nil {
+					log.Debug("Failed to backfill logs", "id", rpcSub.ID, "from", crit.FromBlock, "head", head, "err", err)
+				}
+				backfill = nil
+				for _, l := range pending {
+					if l.BlockNumber > head || l.Removed {
+						notifier.Notify(rpcSub.ID, &l)
+					}
+				}
+				pending = nil
 			case <-rpcSub.Err(): // client send an unsubscribe request
 				logsSub.Unsubscribe()
 				return
@@ -271,6 +431,24 @@ func (api *PublicFilterAPI) Logs(ctx context.Context, crit FilterCriteria) (*rpc
 	return rpcSub, nil
 }
 
+// backfillLogs streams the logs matching the criteria between the start of the
+// subscription and the given head. In light mode the range filter looks the
+// matching blocks up in the bloom trie and retrieves their receipts on demand.
+func (api *PublicFilterAPI) backfillLogs(ctx context.Context, notifier *rpc.Notifier, id rpc.ID, crit FilterCriteria, head uint64) error {
+	filter := NewRangeFilter(api.backend, crit.FromBlock.Int64(), int64(head), crit.Addresses, crit.Topics)
+
+	logs, err := filter.Logs(ctx)
+	if err != nil {
+		return err
+	}
+	for _, log := range logs {
+		if err := notifier.Notify(id, log); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // FilterCriteria represents a request to create a new filter.
 // Same as ethereum.FilterQuery but with UnmarshalJSON() method.
 type FilterCriteria truechain.FilterQuery
@@ -417,7 +595,7 @@ func (api *PublicFilterAPI) GetFilterChanges(id rpc.ID) (interface{}, error) {
 		f.deadline.Reset(deadline)
 
 		switch f.typ {
-		case PendingTransactionsSubscription, BlocksSubscription:
+		case PendingTransactionsSubscription, BlocksSubscription, SnailBlocksSubscription:
 			hashes := f.hashes
 			f.hashes = nil
 			return returnHashes(hashes), nil
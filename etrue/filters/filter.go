@@ -36,11 +36,13 @@ type Backend interface {
 	HeaderByHash(ctx context.Context, blockHash common.Hash) (*types.Header, error)
 	GetReceipts(ctx context.Context, blockHash common.Hash) (types.Receipts, error)
 	GetLogs(ctx context.Context, blockHash common.Hash) ([][]*types.Log, error)
+	GetSnailBlock(ctx context.Context, blockHash common.Hash) (*types.SnailBlock, error)
 
 	SubscribeNewTxsEvent(chan<- types.NewTxsEvent) event.Subscription
 	SubscribeChainEvent(ch chan<- types.FastChainEvent) event.Subscription
 	SubscribeRemovedLogsEvent(ch chan<- types.RemovedLogsEvent) event.Subscription
 	SubscribeLogsEvent(ch chan<- []*types.Log) event.Subscription
+	SubscribeSnailChainEvent(ch chan<- types.SnailChainEvent) event.Subscription
 
 	BloomStatus() (uint64, uint64)
 	ServiceFilter(ctx context.Context, session *bloombits.MatcherSession)
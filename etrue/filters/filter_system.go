@@ -52,6 +52,8 @@ const (
 	PendingTransactionsSubscription
 	// BlocksSubscription queries hashes for blocks that are imported
 	BlocksSubscription
+	// SnailBlocksSubscription queries hashes for snail blocks that are imported
+	SnailBlocksSubscription
 	// LastSubscription keeps track of the last index
 	LastIndexSubscription
 )
@@ -67,6 +69,8 @@ const (
 	logsChanSize = 10
 	// chainEvChanSize is the size of channel listening to ChainEvent.
 	chainEvChanSize = 10
+	// snailChainEvChanSize is the size of channel listening to SnailChainEvent.
+	snailChainEvChanSize = 10
 )
 
 var (
@@ -81,6 +85,7 @@ type subscription struct {
 	logs      chan []*types.Log
 	hashes    chan []common.Hash
 	headers   chan *types.Header
+	snails    chan *types.SnailHeader
 	installed chan struct{} // closed when the filter is installed
 	err       chan error    // closed when the filter is uninstalled
 }
@@ -98,6 +103,7 @@ type EventSystem struct {
 	logsSub       event.Subscription         // Subscription for new log event
 	rmLogsSub     event.Subscription         // Subscription for removed log event
 	chainSub      event.Subscription         // Subscription for new chain event
+	snailChainSub event.Subscription         // Subscription for new snail chain event
 	pendingLogSub *event.TypeMuxSubscription // Subscription for pending log event
 
 	// Channels
@@ -107,6 +113,7 @@ type EventSystem struct {
 	logsCh    chan []*types.Log           // Channel to receive new log event
 	rmLogsCh  chan types.RemovedLogsEvent // Channel to receive removed log event
 	chainCh   chan types.FastChainEvent   // Channel to receive new chain event
+	snailCh   chan types.SnailChainEvent  // Channel to receive new snail chain event
 }
 
 // NewEventSystem creates a new manager that listens for event on the given mux,
@@ -126,6 +133,7 @@ func NewEventSystem(mux *event.TypeMux, backend Backend, lightMode bool) *EventS
 		logsCh:    make(chan []*types.Log, logsChanSize),
 		rmLogsCh:  make(chan types.RemovedLogsEvent, rmLogsChanSize),
 		chainCh:   make(chan types.FastChainEvent, chainEvChanSize),
+		snailCh:   make(chan types.SnailChainEvent, snailChainEvChanSize),
 	}
 
 	// Subscribe events
@@ -133,12 +141,13 @@ func NewEventSystem(mux *event.TypeMux, backend Backend, lightMode bool) *EventS
 	m.logsSub = m.backend.SubscribeLogsEvent(m.logsCh)
 	m.rmLogsSub = m.backend.SubscribeRemovedLogsEvent(m.rmLogsCh)
 	m.chainSub = m.backend.SubscribeChainEvent(m.chainCh)
+	m.snailChainSub = m.backend.SubscribeSnailChainEvent(m.snailCh)
 	// TODO(rjl493456442): use feed to subscribe pending log event
 	m.pendingLogSub = m.mux.Subscribe(types.PendingLogsEvent{})
 
 	// Make sure none of the subscriptions are empty
 	if m.txsSub == nil || m.logsSub == nil || m.rmLogsSub == nil || m.chainSub == nil ||
-		m.pendingLogSub.Closed() {
+		m.snailChainSub == nil || m.pendingLogSub.Closed() {
 		log.Crit("Subscribe for event system failed")
 	}
 
@@ -174,6 +183,7 @@ func (sub *Subscription) Unsubscribe() {
 			case <-sub.f.logs:
 			case <-sub.f.hashes:
 			case <-sub.f.headers:
+			case <-sub.f.snails:
 			}
 		}
 
@@ -241,6 +251,7 @@ func (es *EventSystem) subscribeMinedPendingLogs(crit truechain.FilterQuery, log
 		logs:      logs,
 		hashes:    make(chan []common.Hash),
 		headers:   make(chan *types.Header),
+		snails:    make(chan *types.SnailHeader),
 		installed: make(chan struct{}),
 		err:       make(chan error),
 	}
@@ -258,6 +269,7 @@ func (es *EventSystem) subscribeLogs(crit truechain.FilterQuery, logs chan []*ty
 		logs:      logs,
 		hashes:    make(chan []common.Hash),
 		headers:   make(chan *types.Header),
+		snails:    make(chan *types.SnailHeader),
 		installed: make(chan struct{}),
 		err:       make(chan error),
 	}
@@ -275,6 +287,7 @@ func (es *EventSystem) subscribePendingLogs(crit truechain.FilterQuery, logs cha
 		logs:      logs,
 		hashes:    make(chan []common.Hash),
 		headers:   make(chan *types.Header),
+		snails:    make(chan *types.SnailHeader),
 		installed: make(chan struct{}),
 		err:       make(chan error),
 	}
@@ -291,6 +304,24 @@ func (es *EventSystem) SubscribeNewHeads(headers chan *types.Header) *Subscripti
 		logs:      make(chan []*types.Log),
 		hashes:    make(chan []common.Hash),
 		headers:   headers,
+		snails:    make(chan *types.SnailHeader),
+		installed: make(chan struct{}),
+		err:       make(chan error),
+	}
+	return es.subscribe(sub)
+}
+
+// SubscribeNewSnailHeads creates a subscription that writes the header of a
+// snail block that is imported in the snail chain.
+func (es *EventSystem) SubscribeNewSnailHeads(headers chan *types.SnailHeader) *Subscription {
+	sub := &subscription{
+		id:        rpc.NewID(),
+		typ:       SnailBlocksSubscription,
+		created:   time.Now(),
+		logs:      make(chan []*types.Log),
+		hashes:    make(chan []common.Hash),
+		headers:   make(chan *types.Header),
+		snails:    headers,
 		installed: make(chan struct{}),
 		err:       make(chan error),
 	}
@@ -307,6 +338,7 @@ func (es *EventSystem) SubscribePendingTxs(hashes chan []common.Hash) *Subscript
 		logs:      make(chan []*types.Log),
 		hashes:    hashes,
 		headers:   make(chan *types.Header),
+		snails:    make(chan *types.SnailHeader),
 		installed: make(chan struct{}),
 		err:       make(chan error),
 	}
@@ -368,6 +400,10 @@ func (es *EventSystem) broadcast(filters filterIndex, ev interface{}) {
 				}
 			})
 		}
+	case types.SnailChainEvent:
+		for _, f := range filters[SnailBlocksSubscription] {
+			f.snails <- e.Block.Header()
+		}
 	}
 }
 
@@ -453,6 +489,7 @@ func (es *EventSystem) eventLoop() {
 		es.logsSub.Unsubscribe()
 		es.rmLogsSub.Unsubscribe()
 		es.chainSub.Unsubscribe()
+		es.snailChainSub.Unsubscribe()
 	}()
 
 	index := make(filterIndex)
@@ -471,6 +508,8 @@ func (es *EventSystem) eventLoop() {
 			es.broadcast(index, ev)
 		case ev := <-es.chainCh:
 			es.broadcast(index, ev)
+		case ev := <-es.snailCh:
+			es.broadcast(index, ev)
 		case ev, active := <-es.pendingLogSub.Chan():
 			if !active { // system stopped
 				return
@@ -506,6 +545,8 @@ func (es *EventSystem) eventLoop() {
 			return
 		case <-es.chainSub.Err():
 			return
+		case <-es.snailChainSub.Err():
+			return
 		}
 	}
 }
@@ -3,93 +3,272 @@
 package etrue
 
 import (
+	"crypto/ecdsa"
 	"math/big"
-
+	"time"
 	"truechain/discovery/common"
 	"truechain/discovery/common/hexutil"
 	"truechain/discovery/consensus/minerva"
 	"truechain/discovery/core"
+	"truechain/discovery/core/snailchain"
 	"truechain/discovery/etrue/downloader"
 	"truechain/discovery/etrue/gasprice"
+	"truechain/discovery/params"
 )
 
 var _ = (*configMarshaling)(nil)
 
+// MarshalTOML marshals as TOML.
 func (c Config) MarshalTOML() (interface{}, error) {
 	type Config struct {
 		Genesis                 *core.Genesis `toml:",omitempty"`
 		NetworkId               uint64
 		SyncMode                downloader.SyncMode
-		LightServ               int           `toml:",omitempty"`
-		LightPeers              int           `toml:",omitempty"`
-		EnableElection          bool          `toml:",omitempty"`
-		CommitteeKey            hexutil.Bytes `toml:",omitempty"`
-		Host                    string        `toml:",omitempty"`
-		Port                    int           `toml:",omitempty"`
-		StandbyPort             int           `toml:",omitempty"`
-		SkipBcVersionCheck      bool          `toml:"-"`
-		DatabaseHandles         int           `toml:"-"`
+		NoPruning               bool
+		DeletedState            bool
+		Whitelist               map[uint64]common.Hash         `toml:"-"`
+		LightServ               int                            `toml:",omitempty"`
+		LightPeers              int                            `toml:",omitempty"`
+		LightServeFilters       bool                           `toml:",omitempty"`
+		LightProofDecoys        int                            `toml:",omitempty"`
+		LightPrivacyMode        bool                           `toml:",omitempty"`
+		LightEventBuffer        int                            `toml:",omitempty"`
+		LightMaxPerGroup        int                            `toml:",omitempty"`
+		LightAnnounceConfirms   int                            `toml:",omitempty"`
+		LightRevertReasons      bool                           `toml:",omitempty"`
+		LightPruneSections      uint64                         `toml:",omitempty"`
+		LightFreezer            bool                           `toml:",omitempty"`
+		LightRecharge           uint64                         `toml:",omitempty"`
+		LightBufLimit           uint64                         `toml:",omitempty"`
+		LightHedgeTimeout       time.Duration                  `toml:",omitempty"`
+		LightRequestTimeout     time.Duration                  `toml:",omitempty"`
+		LightRequestHardTimeout time.Duration                  `toml:",omitempty"`
+		LightRequestRetries     int                            `toml:",omitempty"`
+		LightRequestBackoff     string                         `toml:",omitempty"`
+		LightRequestPeerWait    time.Duration                  `toml:",omitempty"`
+		LightAllowIdMismatch    bool                           `toml:",omitempty"`
+		LightMinGasPrice        *big.Int                       `toml:",omitempty"`
+		LightMaxGasPrice        *big.Int                       `toml:",omitempty"`
+		LightTxAccountSlots     uint64                         `toml:",omitempty"`
+		LightTxGlobalSlots      uint64                         `toml:",omitempty"`
+		LightRelayOnly          []string                       `toml:",omitempty"`
+		LightSyncOnly           []string                       `toml:",omitempty"`
+		LightProfile            string                         `toml:",omitempty"`
+		LightIndexerThrottle    time.Duration                  `toml:",omitempty"`
+		LightMemoryLimit        int                            `toml:",omitempty"`
+		LightCPULimit           int                            `toml:",omitempty"`
+		LightRewindBackup       bool                           `toml:",omitempty"`
+		LightTxWebhook          string                         `toml:",omitempty"`
+		LightDepositWebhook     string                         `toml:",omitempty"`
+		LightHotAccounts        []common.Address               `toml:",omitempty"`
+		LightHeadCheckURL       string                         `toml:",omitempty"`
+		LightHeadCheckInterval  time.Duration                  `toml:",omitempty"`
+		CacheSizeMB             int                            `toml:",omitempty"`
+		LightNodeSession        int                            `toml:",omitempty"`
+		LightProofFormat        string                         `toml:",omitempty"`
+		LightTopics             []string                       `toml:",omitempty"`
+		LightNoDefaultTopic     bool                           `toml:",omitempty"`
+		LightNoAdvertise        bool                           `toml:",omitempty"`
+		LightAPIModules         []string                       `toml:",omitempty"`
+		CheckpointOracle        *params.CheckpointOracleConfig `toml:",omitempty"`
+		EnableElection          bool                           `toml:",omitempty"`
+		CommitteeKey            hexutil.Bytes                  `toml:",omitempty"`
+		PrivateKey              *ecdsa.PrivateKey              `toml:"-"`
+		Host                    string                         `toml:",omitempty"`
+		Port                    int                            `toml:",omitempty"`
+		StandbyPort             int                            `toml:",omitempty"`
+		ULC                     *ULCConfig                     `toml:",omitempty"`
+		SkipBcVersionCheck      bool                           `toml:"-"`
+		DatabaseHandles         int                            `toml:"-"`
 		DatabaseCache           int
+		DatabaseBackend         string `toml:",omitempty"`
+		TrieCache               int
+		TrieTimeout             time.Duration
 		Etherbase               common.Address `toml:",omitempty"`
 		MinerThreads            int            `toml:",omitempty"`
 		ExtraData               hexutil.Bytes  `toml:",omitempty"`
+		MinerGasFloor           uint64
+		MinerGasCeil            uint64
 		GasPrice                *big.Int
+		ConsensusEngine         string `toml:",omitempty"`
 		MinervaHash             minerva.Config
 		TxPool                  core.TxPoolConfig
+		SnailPool               snailchain.SnailPoolConfig
 		GPO                     gasprice.Config
 		EnablePreimageRecording bool
 		DocRoot                 string `toml:"-"`
+		NodeType                bool   `toml:",omitempty"`
+		MineFruit               bool   `toml:",omitempty"`
+		Mine                    bool   `toml:",omitempty"`
+		RemoteMine              bool   `toml:",omitempty"`
 	}
 	var enc Config
 	enc.Genesis = c.Genesis
 	enc.NetworkId = c.NetworkId
 	enc.SyncMode = c.SyncMode
+	enc.NoPruning = c.NoPruning
+	enc.DeletedState = c.DeletedState
+	enc.Whitelist = c.Whitelist
 	enc.LightServ = c.LightServ
 	enc.LightPeers = c.LightPeers
+	enc.LightServeFilters = c.LightServeFilters
+	enc.LightProofDecoys = c.LightProofDecoys
+	enc.LightPrivacyMode = c.LightPrivacyMode
+	enc.LightEventBuffer = c.LightEventBuffer
+	enc.LightMaxPerGroup = c.LightMaxPerGroup
+	enc.LightAnnounceConfirms = c.LightAnnounceConfirms
+	enc.LightRevertReasons = c.LightRevertReasons
+	enc.LightPruneSections = c.LightPruneSections
+	enc.LightFreezer = c.LightFreezer
+	enc.LightRecharge = c.LightRecharge
+	enc.LightBufLimit = c.LightBufLimit
+	enc.LightHedgeTimeout = c.LightHedgeTimeout
+	enc.LightRequestTimeout = c.LightRequestTimeout
+	enc.LightRequestHardTimeout = c.LightRequestHardTimeout
+	enc.LightRequestRetries = c.LightRequestRetries
+	enc.LightRequestBackoff = c.LightRequestBackoff
+	enc.LightRequestPeerWait = c.LightRequestPeerWait
+	enc.LightAllowIdMismatch = c.LightAllowIdMismatch
+	enc.LightMinGasPrice = c.LightMinGasPrice
+	enc.LightMaxGasPrice = c.LightMaxGasPrice
+	enc.LightTxAccountSlots = c.LightTxAccountSlots
+	enc.LightTxGlobalSlots = c.LightTxGlobalSlots
+	enc.LightRelayOnly = c.LightRelayOnly
+	enc.LightSyncOnly = c.LightSyncOnly
+	enc.LightProfile = c.LightProfile
+	enc.LightIndexerThrottle = c.LightIndexerThrottle
+	enc.LightMemoryLimit = c.LightMemoryLimit
+	enc.LightCPULimit = c.LightCPULimit
+	enc.LightRewindBackup = c.LightRewindBackup
+	enc.LightTxWebhook = c.LightTxWebhook
+	enc.LightDepositWebhook = c.LightDepositWebhook
+	enc.LightHotAccounts = c.LightHotAccounts
+	enc.LightHeadCheckURL = c.LightHeadCheckURL
+	enc.LightHeadCheckInterval = c.LightHeadCheckInterval
+	enc.CacheSizeMB = c.CacheSizeMB
+	enc.LightNodeSession = c.LightNodeSession
+	enc.LightProofFormat = c.LightProofFormat
+	enc.LightTopics = c.LightTopics
+	enc.LightNoDefaultTopic = c.LightNoDefaultTopic
+	enc.LightNoAdvertise = c.LightNoAdvertise
+	enc.LightAPIModules = c.LightAPIModules
+	enc.CheckpointOracle = c.CheckpointOracle
 	enc.EnableElection = c.EnableElection
 	enc.CommitteeKey = c.CommitteeKey
+	enc.PrivateKey = c.PrivateKey
 	enc.Host = c.Host
 	enc.Port = c.Port
 	enc.StandbyPort = c.StandbyPort
+	enc.ULC = c.ULC
 	enc.SkipBcVersionCheck = c.SkipBcVersionCheck
 	enc.DatabaseHandles = c.DatabaseHandles
 	enc.DatabaseCache = c.DatabaseCache
+	enc.DatabaseBackend = c.DatabaseBackend
+	enc.TrieCache = c.TrieCache
+	enc.TrieTimeout = c.TrieTimeout
 	enc.Etherbase = c.Etherbase
 	enc.MinerThreads = c.MinerThreads
 	enc.ExtraData = c.ExtraData
+	enc.MinerGasFloor = c.MinerGasFloor
+	enc.MinerGasCeil = c.MinerGasCeil
 	enc.GasPrice = c.GasPrice
+	enc.ConsensusEngine = c.ConsensusEngine
 	enc.MinervaHash = c.MinervaHash
 	enc.TxPool = c.TxPool
+	enc.SnailPool = c.SnailPool
 	enc.GPO = c.GPO
 	enc.EnablePreimageRecording = c.EnablePreimageRecording
 	enc.DocRoot = c.DocRoot
+	enc.NodeType = c.NodeType
+	enc.MineFruit = c.MineFruit
+	enc.Mine = c.Mine
+	enc.RemoteMine = c.RemoteMine
 	return &enc, nil
 }
 
+// UnmarshalTOML unmarshals from TOML.
 func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	type Config struct {
 		Genesis                 *core.Genesis `toml:",omitempty"`
 		NetworkId               *uint64
 		SyncMode                *downloader.SyncMode
-		EnableElection          *bool          `toml:",omitempty"`
-		CommitteeKey            *hexutil.Bytes `toml:",omitempty"`
-		Host                    *string        `toml:",omitempty"`
-		Port                    *int           `toml:",omitempty"`
-		StandbyPort             *int           `toml:",omitempty"`
-		LightServ               *int           `toml:",omitempty"`
-		LightPeers              *int           `toml:",omitempty"`
-		SkipBcVersionCheck      *bool          `toml:"-"`
-		DatabaseHandles         *int           `toml:"-"`
+		NoPruning               *bool
+		DeletedState            *bool
+		Whitelist               map[uint64]common.Hash         `toml:"-"`
+		LightServ               *int                           `toml:",omitempty"`
+		LightPeers              *int                           `toml:",omitempty"`
+		LightServeFilters       *bool                          `toml:",omitempty"`
+		LightProofDecoys        *int                           `toml:",omitempty"`
+		LightPrivacyMode        *bool                          `toml:",omitempty"`
+		LightEventBuffer        *int                           `toml:",omitempty"`
+		LightMaxPerGroup        *int                           `toml:",omitempty"`
+		LightAnnounceConfirms   *int                           `toml:",omitempty"`
+		LightRevertReasons      *bool                          `toml:",omitempty"`
+		LightPruneSections      *uint64                        `toml:",omitempty"`
+		LightFreezer            *bool                          `toml:",omitempty"`
+		LightRecharge           *uint64                        `toml:",omitempty"`
+		LightBufLimit           *uint64                        `toml:",omitempty"`
+		LightHedgeTimeout       *time.Duration                 `toml:",omitempty"`
+		LightRequestTimeout     *time.Duration                 `toml:",omitempty"`
+		LightRequestHardTimeout *time.Duration                 `toml:",omitempty"`
+		LightRequestRetries     *int                           `toml:",omitempty"`
+		LightRequestBackoff     *string                        `toml:",omitempty"`
+		LightRequestPeerWait    *time.Duration                 `toml:",omitempty"`
+		LightAllowIdMismatch    *bool                          `toml:",omitempty"`
+		LightMinGasPrice        *big.Int                       `toml:",omitempty"`
+		LightMaxGasPrice        *big.Int                       `toml:",omitempty"`
+		LightTxAccountSlots     *uint64                        `toml:",omitempty"`
+		LightTxGlobalSlots      *uint64                        `toml:",omitempty"`
+		LightRelayOnly          []string                       `toml:",omitempty"`
+		LightSyncOnly           []string                       `toml:",omitempty"`
+		LightProfile            *string                        `toml:",omitempty"`
+		LightIndexerThrottle    *time.Duration                 `toml:",omitempty"`
+		LightMemoryLimit        *int                           `toml:",omitempty"`
+		LightCPULimit           *int                           `toml:",omitempty"`
+		LightRewindBackup       *bool                          `toml:",omitempty"`
+		LightTxWebhook          *string                        `toml:",omitempty"`
+		LightDepositWebhook     *string                        `toml:",omitempty"`
+		LightHotAccounts        []common.Address               `toml:",omitempty"`
+		LightHeadCheckURL       *string                        `toml:",omitempty"`
+		LightHeadCheckInterval  *time.Duration                 `toml:",omitempty"`
+		CacheSizeMB             *int                           `toml:",omitempty"`
+		LightNodeSession        *int                           `toml:",omitempty"`
+		LightProofFormat        *string                        `toml:",omitempty"`
+		LightTopics             []string                       `toml:",omitempty"`
+		LightNoDefaultTopic     *bool                          `toml:",omitempty"`
+		LightNoAdvertise        *bool                          `toml:",omitempty"`
+		LightAPIModules         []string                       `toml:",omitempty"`
+		CheckpointOracle        *params.CheckpointOracleConfig `toml:",omitempty"`
+		EnableElection          *bool                          `toml:",omitempty"`
+		CommitteeKey            *hexutil.Bytes                 `toml:",omitempty"`
+		PrivateKey              *ecdsa.PrivateKey              `toml:"-"`
+		Host                    *string                        `toml:",omitempty"`
+		Port                    *int                           `toml:",omitempty"`
+		StandbyPort             *int                           `toml:",omitempty"`
+		ULC                     *ULCConfig                     `toml:",omitempty"`
+		SkipBcVersionCheck      *bool                          `toml:"-"`
+		DatabaseHandles         *int                           `toml:"-"`
 		DatabaseCache           *int
+		DatabaseBackend         *string `toml:",omitempty"`
+		TrieCache               *int
+		TrieTimeout             *time.Duration
 		Etherbase               *common.Address `toml:",omitempty"`
 		MinerThreads            *int            `toml:",omitempty"`
 		ExtraData               *hexutil.Bytes  `toml:",omitempty"`
+		MinerGasFloor           *uint64
+		MinerGasCeil            *uint64
 		GasPrice                *big.Int
+		ConsensusEngine         *string `toml:",omitempty"`
 		MinervaHash             *minerva.Config
 		TxPool                  *core.TxPoolConfig
+		SnailPool               *snailchain.SnailPoolConfig
 		GPO                     *gasprice.Config
 		EnablePreimageRecording *bool
 		DocRoot                 *string `toml:"-"`
+		NodeType                *bool   `toml:",omitempty"`
+		MineFruit               *bool   `toml:",omitempty"`
+		Mine                    *bool   `toml:",omitempty"`
+		RemoteMine              *bool   `toml:",omitempty"`
 	}
 	var dec Config
 	if err := unmarshal(&dec); err != nil {
@@ -104,12 +283,156 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	if dec.SyncMode != nil {
 		c.SyncMode = *dec.SyncMode
 	}
+	if dec.NoPruning != nil {
+		c.NoPruning = *dec.NoPruning
+	}
+	if dec.DeletedState != nil {
+		c.DeletedState = *dec.DeletedState
+	}
+	if dec.Whitelist != nil {
+		c.Whitelist = dec.Whitelist
+	}
+	if dec.LightServ != nil {
+		c.LightServ = *dec.LightServ
+	}
+	if dec.LightPeers != nil {
+		c.LightPeers = *dec.LightPeers
+	}
+	if dec.LightServeFilters != nil {
+		c.LightServeFilters = *dec.LightServeFilters
+	}
+	if dec.LightProofDecoys != nil {
+		c.LightProofDecoys = *dec.LightProofDecoys
+	}
+	if dec.LightPrivacyMode != nil {
+		c.LightPrivacyMode = *dec.LightPrivacyMode
+	}
+	if dec.LightEventBuffer != nil {
+		c.LightEventBuffer = *dec.LightEventBuffer
+	}
+	if dec.LightMaxPerGroup != nil {
+		c.LightMaxPerGroup = *dec.LightMaxPerGroup
+	}
+	if dec.LightAnnounceConfirms != nil {
+		c.LightAnnounceConfirms = *dec.LightAnnounceConfirms
+	}
+	if dec.LightRevertReasons != nil {
+		c.LightRevertReasons = *dec.LightRevertReasons
+	}
+	if dec.LightPruneSections != nil {
+		c.LightPruneSections = *dec.LightPruneSections
+	}
+	if dec.LightFreezer != nil {
+		c.LightFreezer = *dec.LightFreezer
+	}
+	if dec.LightRecharge != nil {
+		c.LightRecharge = *dec.LightRecharge
+	}
+	if dec.LightBufLimit != nil {
+		c.LightBufLimit = *dec.LightBufLimit
+	}
+	if dec.LightHedgeTimeout != nil {
+		c.LightHedgeTimeout = *dec.LightHedgeTimeout
+	}
+	if dec.LightRequestTimeout != nil {
+		c.LightRequestTimeout = *dec.LightRequestTimeout
+	}
+	if dec.LightRequestHardTimeout != nil {
+		c.LightRequestHardTimeout = *dec.LightRequestHardTimeout
+	}
+	if dec.LightRequestRetries != nil {
+		c.LightRequestRetries = *dec.LightRequestRetries
+	}
+	if dec.LightRequestBackoff != nil {
+		c.LightRequestBackoff = *dec.LightRequestBackoff
+	}
+	if dec.LightRequestPeerWait != nil {
+		c.LightRequestPeerWait = *dec.LightRequestPeerWait
+	}
+	if dec.LightAllowIdMismatch != nil {
+		c.LightAllowIdMismatch = *dec.LightAllowIdMismatch
+	}
+	if dec.LightMinGasPrice != nil {
+		c.LightMinGasPrice = dec.LightMinGasPrice
+	}
+	if dec.LightMaxGasPrice != nil {
+		c.LightMaxGasPrice = dec.LightMaxGasPrice
+	}
+	if dec.LightTxAccountSlots != nil {
+		c.LightTxAccountSlots = *dec.LightTxAccountSlots
+	}
+	if dec.LightTxGlobalSlots != nil {
+		c.LightTxGlobalSlots = *dec.LightTxGlobalSlots
+	}
+	if dec.LightRelayOnly != nil {
+		c.LightRelayOnly = dec.LightRelayOnly
+	}
+	if dec.LightSyncOnly != nil {
+		c.LightSyncOnly = dec.LightSyncOnly
+	}
+	if dec.LightProfile != nil {
+		c.LightProfile = *dec.LightProfile
+	}
+	if dec.LightIndexerThrottle != nil {
+		c.LightIndexerThrottle = *dec.LightIndexerThrottle
+	}
+	if dec.LightMemoryLimit != nil {
+		c.LightMemoryLimit = *dec.LightMemoryLimit
+	}
+	if dec.LightCPULimit != nil {
+		c.LightCPULimit = *dec.LightCPULimit
+	}
+	if dec.LightRewindBackup != nil {
+		c.LightRewindBackup = *dec.LightRewindBackup
+	}
+	if dec.LightTxWebhook != nil {
+		c.LightTxWebhook = *dec.LightTxWebhook
+	}
+	if dec.LightDepositWebhook != nil {
+		c.LightDepositWebhook = *dec.LightDepositWebhook
+	}
+	if dec.LightHotAccounts != nil {
+		c.LightHotAccounts = dec.LightHotAccounts
+	}
+	if dec.LightHeadCheckURL != nil {
+		c.LightHeadCheckURL = *dec.LightHeadCheckURL
+	}
+	if dec.LightHeadCheckInterval != nil {
+		c.LightHeadCheckInterval = *dec.LightHeadCheckInterval
+	}
+	if dec.CacheSizeMB != nil {
+		c.CacheSizeMB = *dec.CacheSizeMB
+	}
+	if dec.LightNodeSession != nil {
+		c.LightNodeSession = *dec.LightNodeSession
+	}
+	if dec.LightProofFormat != nil {
+		c.LightProofFormat = *dec.LightProofFormat
+	}
+	if dec.LightTopics != nil {
+		c.LightTopics = dec.LightTopics
+	}
+	if dec.LightNoDefaultTopic != nil {
+		c.LightNoDefaultTopic = *dec.LightNoDefaultTopic
+	}
+	if dec.LightNoAdvertise != nil {
+		c.LightNoAdvertise = *dec.LightNoAdvertise
+	}
+	if dec.LightAPIModules != nil {
+		c.LightAPIModules = dec.LightAPIModules
+	}
+	if dec.CheckpointOracle != nil {
+		c.CheckpointOracle = dec.CheckpointOracle
+	}
 	if dec.EnableElection != nil {
 		c.EnableElection = *dec.EnableElection
 	}
 	if dec.CommitteeKey != nil {
 		c.CommitteeKey = *dec.CommitteeKey
 	}
+	if dec.PrivateKey != nil {
+		c.PrivateKey = dec.PrivateKey
+	}
 	if dec.Host != nil {
 		c.Host = *dec.Host
 	}
@@ -119,11 +442,8 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	if dec.StandbyPort != nil {
 		c.StandbyPort = *dec.StandbyPort
 	}
-	if dec.LightServ != nil {
-		c.LightServ = *dec.LightServ
-	}
-	if dec.LightPeers != nil {
-		c.LightPeers = *dec.LightPeers
+	if dec.ULC != nil {
+		c.ULC = dec.ULC
 	}
 	if dec.SkipBcVersionCheck != nil {
 		c.SkipBcVersionCheck = *dec.SkipBcVersionCheck
@@ -134,6 +454,15 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	if dec.DatabaseCache != nil {
 		c.DatabaseCache = *dec.DatabaseCache
 	}
+	if dec.DatabaseBackend != nil {
+		c.DatabaseBackend = *dec.DatabaseBackend
+	}
+	if dec.TrieCache != nil {
+		c.TrieCache = *dec.TrieCache
+	}
+	if dec.TrieTimeout != nil {
+		c.TrieTimeout = *dec.TrieTimeout
+	}
 	if dec.Etherbase != nil {
 		c.Etherbase = *dec.Etherbase
 	}
@@ -143,15 +472,27 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	if dec.ExtraData != nil {
 		c.ExtraData = *dec.ExtraData
 	}
+	if dec.MinerGasFloor != nil {
+		c.MinerGasFloor = *dec.MinerGasFloor
+	}
+	if dec.MinerGasCeil != nil {
+		c.MinerGasCeil = *dec.MinerGasCeil
+	}
 	if dec.GasPrice != nil {
 		c.GasPrice = dec.GasPrice
 	}
+	if dec.ConsensusEngine != nil {
+		c.ConsensusEngine = *dec.ConsensusEngine
+	}
 	if dec.MinervaHash != nil {
 		c.MinervaHash = *dec.MinervaHash
 	}
 	if dec.TxPool != nil {
 		c.TxPool = *dec.TxPool
 	}
+	if dec.SnailPool != nil {
+		c.SnailPool = *dec.SnailPool
+	}
 	if dec.GPO != nil {
 		c.GPO = *dec.GPO
 	}
@@ -161,5 +502,17 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	if dec.DocRoot != nil {
 		c.DocRoot = *dec.DocRoot
 	}
+	if dec.NodeType != nil {
+		c.NodeType = *dec.NodeType
+	}
+	if dec.MineFruit != nil {
+		c.MineFruit = *dec.MineFruit
+	}
+	if dec.Mine != nil {
+		c.Mine = *dec.Mine
+	}
+	if dec.RemoteMine != nil {
+		c.RemoteMine = *dec.RemoteMine
+	}
 	return nil
 }
@@ -16,6 +16,12 @@
 
 package etruedb
 
+// Backends of the chain database selectable in the configuration.
+const (
+	BackendLevelDB = "leveldb" // persistent LevelDB database, the default
+	BackendMemory  = "memory"  // in-memory database, lost on shutdown
+)
+
 // Code using batches should try to add this much data to the batch.
 // The value was determined empirically.
 const IdealBatchSize = 100 * 1024
@@ -38,6 +38,7 @@ import (
 	ethash "truechain/discovery/consensus/minerva"
 	"truechain/discovery/core"
 	"truechain/discovery/core/rawdb"
+	"truechain/discovery/core/state"
 	"truechain/discovery/core/types"
 	"truechain/discovery/core/vm"
 	"truechain/discovery/crypto"
@@ -85,6 +86,7 @@ func (s *PublicTrueAPI) ProtocolVersion() hexutil.Uint {
 // - highestBlock:  block number of the highest block header this node has received from peers
 // - pulledStates:  number of state entries processed until now
 // - knownStates:   number of known state entries that still need to be pulled
+// Light clients also report the CHT sections verified and the total sections.
 func (s *PublicTrueAPI) Syncing() (interface{}, error) {
 	progress := s.b.Downloader().Progress()
 
@@ -93,7 +95,7 @@ func (s *PublicTrueAPI) Syncing() (interface{}, error) {
 		return false, nil
 	}
 	// Otherwise gather the block sync stats
-	return map[string]interface{}{
+	fields := map[string]interface{}{
 		"startingFastBlock":  hexutil.Uint64(progress.StartingFastBlock),
 		"currentFastBlock":   hexutil.Uint64(progress.CurrentFastBlock),
 		"highestFastBlock":   hexutil.Uint64(progress.HighestFastBlock),
@@ -102,7 +104,19 @@ func (s *PublicTrueAPI) Syncing() (interface{}, error) {
 		"highestSnailBlock":  hexutil.Uint64(progress.HighestSnailBlock),
 		"pulledStates":       hexutil.Uint64(progress.PulledStates),
 		"knownStates":        hexutil.Uint64(progress.KnownStates),
-	}, nil
+	}
+	if cb, ok := s.b.(chtProgressBackend); ok {
+		verified, total := cb.ChtProgress()
+		fields["verifiedChtSections"] = hexutil.Uint64(verified)
+		fields["totalChtSections"] = hexutil.Uint64(total)
+	}
+	return fields, nil
+}
+
+// chtProgressBackend is implemented by light client backends, which verify the
+// synced headers by CHT sections.
+type chtProgressBackend interface {
+	ChtProgress() (verified, total uint64)
 }
 
 // PublicTxPoolAPI offers and API for the transaction pool. It only operates on data that is non confidential.
@@ -608,15 +622,130 @@ func (s *PublicBlockChainAPI) BlockNumber() hexutil.Uint64 {
 
 // GetBalance returns the amount of wei for the given address in the state of the
 // given block number. The rpc.LatestBlockNumber and rpc.PendingBlockNumber meta
-// block numbers are also allowed.
-func (s *PublicBlockChainAPI) GetBalance(ctx context.Context, address common.Address, blockNr rpc.BlockNumber) (*hexutil.Big, error) {
-	state, _, err := s.b.StateAndHeaderByNumber(ctx, blockNr)
+// block numbers are also allowed. If a quorum is given, a light client only
+// returns the balance once that many servers proved it in the same block.
+func (s *PublicBlockChainAPI) GetBalance(ctx context.Context, address common.Address, blockNr rpc.BlockNumber, quorum *hexutil.Uint) (*hexutil.Big, error) {
+	var (
+		state *state.StateDB
+		err   error
+	)
+	if quorum != nil {
+		state, _, err = s.b.QuorumStateAndHeader(ctx, address, blockNr, int(*quorum))
+	} else {
+		state, _, err = s.b.StateAndHeaderByNumber(ctx, blockNr)
+	}
 	if state == nil || err != nil {
 		return nil, err
 	}
 	return (*hexutil.Big)(state.GetUnlockedBalance(address)), state.Error()
 }
 
+const (
+	maxBalanceHistorySamples = 1024 // maximum number of balances returned by GetBalanceHistory
+	balanceHistoryWorkers    = 8    // balances retrieved concurrently by GetBalanceHistory
+)
+
+// BalanceAt is the balance of an account in the state of a block.
+type BalanceAt struct {
+	Number  hexutil.Uint64 `json:"number"`
+	Hash    common.Hash    `json:"hash"`
+	Balance *hexutil.Big   `json:"balance"`
+}
+
+// GetBalanceHistory returns the balances of the given address sampled every
+// step blocks from fromBlock up to toBlock, which is always included. On a light
+// node every balance is retrieved with a proof against the state root of a
+// header anchored in the CHT, so the samples are retrieved concurrently.
+func (s *PublicBlockChainAPI) GetBalanceHistory(ctx context.Context, address common.Address, fromBlock, toBlock rpc.BlockNumber, step hexutil.Uint64) ([]*BalanceAt, error) {
+	resolve := func(blockNr rpc.BlockNumber) (uint64, error) {
+		header, err := s.b.HeaderByNumber(ctx, blockNr)
+		if err != nil {
+			return 0, err
+		}
+		if header == nil {
+			return 0, fmt.Errorf("block %d not found", blockNr)
+		}
+		return header.Number.Uint64(), nil
+	}
+	from, err := resolve(fromBlock)
+	if err != nil {
+		return nil, err
+	}
+	to, err := resolve(toBlock)
+	if err != nil {
+		return nil, err
+	}
+	if from > to {
+		return nil, fmt.Errorf("invalid block range %d > %d", from, to)
+	}
+	if step == 0 {
+		step = 1
+	}
+	if samples := (to-from)/uint64(step) + 1; samples > maxBalanceHistorySamples {
+		return nil, fmt.Errorf("too many samples (%d), the maximum is %d", samples, maxBalanceHistorySamples)
+	}
+	var numbers []uint64
+	for number := from; number < to; number += uint64(step) {
+		numbers = append(numbers, number)
+	}
+	numbers = append(numbers, to)
+
+	// Retrieve the balances with a bounded number of workers, aborting all of
+	// them on the first failure
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		history = make([]*BalanceAt, len(numbers))
+		tasks   = make(chan int, len(numbers))
+		errc    = make(chan error, len(numbers))
+	)
+	for i := range numbers {
+		tasks <- i
+	}
+	close(tasks)
+
+	workers := balanceHistoryWorkers
+	if len(numbers) < workers {
+		workers = len(numbers)
+	}
+	for w := 0; w < workers; w++ {
+		go func() {
+			for i := range tasks {
+				if ctx.Err() != nil {
+					errc <- ctx.Err()
+					continue
+				}
+				state, header, err := s.b.StateAndHeaderByNumber(ctx, rpc.BlockNumber(numbers[i]))
+				if err == nil && state == nil {
+					err = fmt.Errorf("block %d not found", numbers[i])
+				}
+				if err == nil {
+					balance := state.GetUnlockedBalance(address)
+					if err = state.Error(); err == nil {
+						history[i] = &BalanceAt{Number: hexutil.Uint64(numbers[i]), Hash: header.Hash(), Balance: (*hexutil.Big)(balance)}
+					}
+				}
+				if err != nil {
+					cancel()
+				}
+				errc <- err
+			}
+		}()
+	}
+	var first error
+	for range numbers {
+		// Report the failure which aborted the others, not their cancellation
+		if err := <-errc; err != nil && (first == nil || first == context.Canceled) {
+			first = err
+		}
+	}
+	if first != nil {
+		return nil, first
+	}
+	return history, nil
+}
+
 // GetLockBalance returns the amount of wei for the given address in pos state of the
 // given block number. The rpc.LatestBlockNumber and rpc.PendingBlockNumber meta
 // block numbers are also allowed.
@@ -828,13 +957,62 @@ type CallArgs struct {
 	Fee      hexutil.Big     `json:"fee"`
 }
 
-func (s *PublicBlockChainAPI) doCall(ctx context.Context, args CallArgs, blockNr rpc.BlockNumber, vmCfg vm.Config, timeout time.Duration) (*core.ExecutionResult, error) {
+// account indicates the overriding fields of account during the execution of
+// a message call. The overrides are layered over the state of the block, so
+// on a light node only the accounts and slots not overridden are retrieved on
+// demand. State replaces the whole storage of the account, StateDiff only the
+// given slots; they can't be both set.
+type account struct {
+	Nonce     *hexutil.Uint64              `json:"nonce"`
+	Code      *hexutil.Bytes               `json:"code"`
+	Balance   **hexutil.Big                `json:"balance"`
+	State     *map[common.Hash]common.Hash `json:"state"`
+	StateDiff *map[common.Hash]common.Hash `json:"stateDiff"`
+}
+
+func (s *PublicBlockChainAPI) doCall(ctx context.Context, args CallArgs, blockNr rpc.BlockNumber, overrides map[common.Address]account, vmCfg vm.Config, timeout time.Duration) (*core.ExecutionResult, error) {
 	defer func(start time.Time) { log.Debug("Executing EVM call finished", "runtime", time.Since(start)) }(time.Now())
 
 	state, header, err := s.b.StateAndHeaderByNumber(ctx, blockNr)
 	if state == nil || err != nil {
 		return nil, err
 	}
+	if err := applyOverrides(state, overrides); err != nil {
+		return nil, err
+	}
+	return s.applyCall(ctx, state, header, args, vmCfg, timeout)
+}
+
+// applyOverrides overrides the fields of the specified accounts in the state.
+func applyOverrides(statedb *state.StateDB, overrides map[common.Address]account) error {
+	for addr, account := range overrides {
+		if account.Nonce != nil {
+			statedb.SetNonce(addr, uint64(*account.Nonce))
+		}
+		if account.Code != nil {
+			statedb.SetCode(addr, *account.Code)
+		}
+		if account.Balance != nil {
+			statedb.SetBalance(addr, (*big.Int)(*account.Balance))
+		}
+		if account.State != nil && account.StateDiff != nil {
+			return fmt.Errorf("account %s has both 'state' and 'stateDiff'", addr.Hex())
+		}
+		if account.State != nil {
+			statedb.SetStorage(addr, *account.State)
+		}
+		if account.StateDiff != nil {
+			for key, value := range *account.StateDiff {
+				statedb.SetState(addr, key, value)
+			}
+		}
+	}
+	return nil
+}
+
+// applyCall executes a call on top of the given state, the state is modified
+// by the call.
+func (s *PublicBlockChainAPI) applyCall(ctx context.Context, statedb *state.StateDB, header *types.Header, args CallArgs, vmCfg vm.Config, timeout time.Duration) (*core.ExecutionResult, error) {
 	// Set sender address or use a default if none specified
 	addr := args.From
 	if addr == (common.Address{}) {
@@ -869,7 +1047,7 @@ func (s *PublicBlockChainAPI) doCall(ctx context.Context, args CallArgs, blockNr
 	defer cancel()
 
 	// Get a new instance of the EVM.
-	evm, vmError, err := s.b.GetEVM(ctx, msg, state, header, vmCfg)
+	evm, vmError, err := s.b.GetEVM(ctx, msg, statedb, header, vmCfg)
 	if err != nil {
 		return nil, err
 	}
@@ -899,8 +1077,15 @@ func (s *PublicBlockChainAPI) doCall(ctx context.Context, args CallArgs, blockNr
 
 // Call executes the given transaction on the state for the given block number.
 // It doesn't make and changes in the state/blockchain and is useful to execute and retrieve values.
-func (s *PublicBlockChainAPI) Call(ctx context.Context, args CallArgs, blockNr rpc.BlockNumber) (hexutil.Bytes, error) {
-	result, err := s.doCall(ctx, args, blockNr, vm.Config{}, 5*time.Second)
+//
+// Additionally, the caller can specify a batch of accounts whose balance, nonce,
+// code or storage slots are overridden for the call.
+func (s *PublicBlockChainAPI) Call(ctx context.Context, args CallArgs, blockNr rpc.BlockNumber, overrides *map[common.Address]account) (hexutil.Bytes, error) {
+	var accounts map[common.Address]account
+	if overrides != nil {
+		accounts = *overrides
+	}
+	result, err := s.doCall(ctx, args, blockNr, accounts, vm.Config{}, 5*time.Second)
 	if err != nil {
 		return nil, err
 	}
@@ -911,6 +1096,54 @@ func (s *PublicBlockChainAPI) Call(ctx context.Context, args CallArgs, blockNr r
 	return result.Return(), result.Err
 }
 
+// BundleCallResult is the outcome of a single call of a simulated bundle.
+type BundleCallResult struct {
+	ReturnData hexutil.Bytes  `json:"returnData"`
+	GasUsed    hexutil.Uint64 `json:"gasUsed"`
+	Error      string         `json:"error,omitempty"`
+	Revert     string         `json:"revert,omitempty"` // revert reason hex encoded
+}
+
+// SimulateBundle executes a sequence of calls on a single state of the given
+// block, each call seeing the state changes of the previous ones. On a light
+// node the state accessed by earlier calls is retrieved once and shared by the
+// later ones. Failing calls don't abort the bundle, their error is reported in
+// their result.
+func (s *PublicBlockChainAPI) SimulateBundle(ctx context.Context, calls []CallArgs, blockNr rpc.BlockNumber, overrides *map[common.Address]account) ([]BundleCallResult, error) {
+	statedb, header, err := s.b.StateAndHeaderByNumber(ctx, blockNr)
+	if statedb == nil || err != nil {
+		return nil, err
+	}
+	if overrides != nil {
+		if err := applyOverrides(statedb, *overrides); err != nil {
+			return nil, err
+		}
+	}
+	results := make([]BundleCallResult, len(calls))
+	for i, args := range calls {
+		result, err := s.applyCall(ctx, statedb, header, args, vm.Config{}, 5*time.Second)
+		if result != nil {
+			results[i].ReturnData = result.Return()
+			results[i].GasUsed = hexutil.Uint64(result.UsedGas)
+			if len(result.Revert()) > 0 {
+				results[i].Revert = hexutil.Encode(result.Revert())
+			}
+		}
+		if err == nil && result.Err != nil {
+			err = result.Err
+		}
+		if err != nil {
+			results[i].Error = err.Error()
+		}
+		if err := statedb.Error(); err != nil {
+			// The state couldn't be retrieved, later calls would fail as well
+			return nil, err
+		}
+		statedb.Finalise(true)
+	}
+	return results, nil
+}
+
 // EstimateGas returns an estimate of the amount of gas needed to execute the
 // given transaction against the current pending block.
 func (s *PublicBlockChainAPI) EstimateGas(ctx context.Context, args CallArgs) (hexutil.Uint64, error) {
@@ -932,11 +1165,31 @@ func (s *PublicBlockChainAPI) EstimateGas(ctx context.Context, args CallArgs) (h
 	}
 	cap = hi
 
+	// Backends retrieving the state on demand prepare it once, the iterations
+	// run on copies of it
+	var (
+		prepared *state.StateDB
+		header   *types.Header
+	)
+	if eb, ok := s.b.(estimateStateBackend); ok {
+		var err error
+		if prepared, header, err = eb.EstimateState(ctx, rpc.PendingBlockNumber, args.From, args.To); err != nil {
+			return 0, err
+		}
+	}
 	// Create a helper to check if a gas allowance results in an executable transaction
 	executable := func(gas uint64) (bool, *core.ExecutionResult, error) {
 		args.Gas = hexutil.Uint64(gas)
 
-		result, err := s.doCall(ctx, args, rpc.PendingBlockNumber, vm.Config{}, 0)
+		var (
+			result *core.ExecutionResult
+			err    error
+		)
+		if prepared != nil {
+			result, err = s.applyCall(ctx, prepared.Copy(), header, args, vm.Config{}, 0)
+		} else {
+			result, err = s.doCall(ctx, args, rpc.PendingBlockNumber, nil, vm.Config{}, 0)
+		}
 		if err != nil {
 			if errors.Is(err, core.ErrIntrinsicGas) {
 				return true, nil, nil // Special case, raise gas limit
@@ -1569,7 +1822,19 @@ func (s *PublicTransactionPoolAPI) GetRawTransactionByHash(ctx context.Context,
 func (s *PublicTransactionPoolAPI) GetTransactionReceipt(ctx context.Context, hash common.Hash) (map[string]interface{}, error) {
 	tx, blockHash, blockNumber, index := rawdb.ReadTransaction(s.b.ChainDb(), hash)
 	if tx == nil {
-		return nil, nil
+		// Light clients only index the transactions of the local pool, look
+		// the others up from the network if the backend supports it
+		lb, ok := s.b.(txLookupBackend)
+		if !ok {
+			return nil, nil
+		}
+		var err error
+		if tx, blockHash, blockNumber, index, err = lb.GetTransaction(ctx, hash); err != nil {
+			return nil, err
+		}
+		if tx == nil {
+			return nil, nil
+		}
 	}
 	receipts, err := s.b.GetReceipts(ctx, blockHash)
 	if err != nil {
@@ -1609,9 +1874,36 @@ func (s *PublicTransactionPoolAPI) GetTransactionReceipt(ctx context.Context, ha
 	if receipt.ContractAddress != (common.Address{}) {
 		fields["contractAddress"] = receipt.ContractAddress
 	}
+	// Add the revert reason of a failed transaction if the backend recovers it
+	if rb, ok := s.b.(revertReasonBackend); ok && receipt.Status == types.ReceiptStatusFailed {
+		reason, err := rb.RevertReason(ctx, blockHash, index)
+		if err != nil {
+			log.Debug("Failed to recover revert reason", "hash", hash, "err", err)
+		} else if len(reason) > 0 {
+			fields["revertReason"] = hexutil.Bytes(reason)
+		}
+	}
 	return fields, nil
 }
 
+// txLookupBackend is implemented by backends that can retrieve the position of
+// a transaction which isn't indexed in the local database.
+type txLookupBackend interface {
+	GetTransaction(ctx context.Context, txHash common.Hash) (*types.Transaction, common.Hash, uint64, uint64, error)
+}
+
+// estimateStateBackend is implemented by backends retrieving the state on
+// demand, which prepare the state the gas estimation of a call runs on.
+type estimateStateBackend interface {
+	EstimateState(ctx context.Context, blockNr rpc.BlockNumber, from common.Address, to *common.Address) (*state.StateDB, *types.Header, error)
+}
+
+// revertReasonBackend is implemented by backends that can recover the revert
+// reason of a failed transaction, which isn't part of its receipt.
+type revertReasonBackend interface {
+	RevertReason(ctx context.Context, blockHash common.Hash, index uint64) ([]byte, error)
+}
+
 // sign is a helper function that signs a transaction with the private key of the given address.
 func (s *PublicTransactionPoolAPI) sign(addr common.Address, tx *types.Transaction) (*types.Transaction, error) {
 	// Look up the wallet containing the requested signer
@@ -1651,6 +1943,10 @@ type SendTxArgs struct {
 	// newer name and should be preferred by clients.
 	Data  *hexutil.Bytes `json:"data"`
 	Input *hexutil.Bytes `json:"input"`
+
+	// Preflight executes the transaction on the latest state before it is
+	// submitted, and rejects it if it would fail.
+	Preflight bool `json:"preflight"`
 }
 
 // setDefaults is a helper function that fills in default values for unspecified tx fields.
@@ -1720,6 +2016,37 @@ func (args *SendTxArgs) toRawTransaction() *types.RawTransaction {
 	return types.NewRawTransaction(uint64(*args.Nonce), *args.To, (*big.Int)(args.Value), uint64(*args.Gas), (*big.Int)(args.GasPrice), input)
 }
 
+// preflightTransaction executes the transaction as a call on the latest state,
+// returning the revert reason or execution error if it would fail. It saves
+// the fees of transactions that are bound to fail, but can't detect failures
+// caused by state changes before the transaction is included.
+func preflightTransaction(ctx context.Context, b Backend, tx *types.Transaction) error {
+	msg, err := tx.AsMessage(types.MakeSigner(b.ChainConfig(), b.CurrentBlock().Number()))
+	if err != nil {
+		return err
+	}
+	args := CallArgs{
+		From:     msg.From(),
+		To:       tx.To(),
+		Gas:      hexutil.Uint64(tx.Gas()),
+		GasPrice: hexutil.Big(*tx.GasPrice()),
+		Value:    hexutil.Big(*tx.Value()),
+		Data:     tx.Data(),
+		Payer:    msg.Payment(),
+	}
+	if fee := tx.Fee(); fee != nil {
+		args.Fee = hexutil.Big(*fee)
+	}
+	result, err := NewPublicBlockChainAPI(b).doCall(ctx, args, rpc.LatestBlockNumber, nil, vm.Config{}, 5*time.Second)
+	if err != nil {
+		return err
+	}
+	if len(result.Revert()) > 0 {
+		return newRevertError(result)
+	}
+	return result.Err
+}
+
 // submitTransaction is a helper function that submits tx to txPool and logs a message.
 func submitTransaction(ctx context.Context, b Backend, tx *types.Transaction) (common.Hash, error) {
 	LocalTxMetrics.Mark(1)
@@ -1795,23 +2122,25 @@ func (s *PublicTransactionPoolAPI) SendTransaction(ctx context.Context, args Sen
 	if err != nil {
 		return params.EmptyHash, err
 	}
-	//normal transaction execution
-	if args.Payment == (common.Address{}) {
-		return submitTransaction(ctx, s.b, signed)
-	}
 	//sign payment
-	signed_payment, err := s.signPayment(args.Payment, signed)
-	if err != nil {
-		log.Error("signPayment error", "error", err)
-		return params.EmptyHash, err
+	if args.Payment != (common.Address{}) {
+		if signed, err = s.signPayment(args.Payment, signed); err != nil {
+			log.Error("signPayment error", "error", err)
+			return params.EmptyHash, err
+		}
 	}
-	//fmt.Println("newTx2:", signedPaymentTx.Info())
-	return submitTransaction(ctx, s.b, signed_payment)
+	if args.Preflight {
+		if err := preflightTransaction(ctx, s.b, signed); err != nil {
+			return params.EmptyHash, err
+		}
+	}
+	return submitTransaction(ctx, s.b, signed)
 }
 
 // SendRawTransaction will add the signed transaction to the transaction pool.
 // The sender is responsible for signing the transaction and using the correct nonce.
-func (s *PublicTransactionPoolAPI) SendRawTransaction(ctx context.Context, encodedTx hexutil.Bytes) (common.Hash, error) {
+// If preflight is set, the transaction is rejected if it fails on the latest state.
+func (s *PublicTransactionPoolAPI) SendRawTransaction(ctx context.Context, encodedTx hexutil.Bytes, preflight *bool) (common.Hash, error) {
 	raw_tx := new(types.RawTransaction)
 	if err := rlp.DecodeBytes(encodedTx, raw_tx); err != nil {
 		log.Error("api method SendRawTransaction error", "error", err)
@@ -1819,16 +2148,26 @@ func (s *PublicTransactionPoolAPI) SendRawTransaction(ctx context.Context, encod
 	}
 	tx := raw_tx.ConvertTransaction()
 	//log.Info("api method SendRawTransaction info", "tx.info", tx.Info())
+	if preflight != nil && *preflight {
+		if err := preflightTransaction(ctx, s.b, tx); err != nil {
+			return common.Hash{}, err
+		}
+	}
 	return submitTransaction(ctx, s.b, tx)
 }
 
-func (s *PublicTransactionPoolAPI) SendTrueRawTransaction(ctx context.Context, encodedTx hexutil.Bytes) (common.Hash, error) {
+func (s *PublicTransactionPoolAPI) SendTrueRawTransaction(ctx context.Context, encodedTx hexutil.Bytes, preflight *bool) (common.Hash, error) {
 	tx := new(types.Transaction)
 	if err := rlp.DecodeBytes(encodedTx, tx); err != nil {
 		log.Error("api method SendTrueRawTransaction error", "error", err)
 		return common.Hash{}, err
 	}
 	//log.Info("api method SendTrueRawTransaction info", "tx.info", tx.Info())
+	if preflight != nil && *preflight {
+		if err := preflightTransaction(ctx, s.b, tx); err != nil {
+			return common.Hash{}, err
+		}
+	}
 	return submitTransaction(ctx, s.b, tx)
 }
 
@@ -1993,6 +2332,57 @@ func (s *PublicTransactionPoolAPI) Resend(ctx context.Context, sendArgs SendTxAr
 	return common.Hash{}, fmt.Errorf("Transaction %#x not found", matchTx.Hash())
 }
 
+// SpeedUpResult is the outcome of replacing a stuck transaction.
+type SpeedUpResult struct {
+	Original    common.Hash `json:"original"`
+	Replacement common.Hash `json:"replacement"`
+}
+
+// SpeedUpTransaction replaces a stuck pending transaction of the pool with an
+// identical one paying a higher gas price, signed by the account manager, and
+// returns the hashes of both. Without a gas price, the original one is raised
+// by the price bump of the pool, or to the suggested gas price if that's higher.
+func (s *PublicTransactionPoolAPI) SpeedUpTransaction(ctx context.Context, hash common.Hash, gasPrice *hexutil.Big) (*SpeedUpResult, error) {
+	tx := s.b.GetPoolTransaction(hash)
+	if tx == nil {
+		return nil, fmt.Errorf("transaction %#x not pending", hash)
+	}
+	if tx.Payer() != nil || (tx.Fee() != nil && tx.Fee().Sign() != 0) {
+		return nil, errors.New("sponsored transactions and transactions with a fee cannot be sped up")
+	}
+	signer := types.NewTIP1Signer(tx.ChainId())
+	from, err := types.Sender(signer, tx)
+	if err != nil {
+		return nil, err
+	}
+	minPrice := new(big.Int).Mul(tx.GasPrice(), new(big.Int).SetUint64(100+s.b.PriceBump()))
+	minPrice.Div(minPrice, big.NewInt(100))
+
+	price := minPrice
+	if gasPrice != nil {
+		if price = (*big.Int)(gasPrice); price.Cmp(minPrice) < 0 {
+			return nil, fmt.Errorf("gas price %v below the replacement minimum %v", price, minPrice)
+		}
+	} else if suggested, err := s.b.SuggestPrice(ctx); err == nil && suggested.Cmp(price) > 0 {
+		price = suggested
+	}
+	var replacement *types.Transaction
+	if to := tx.To(); to != nil {
+		replacement = types.NewTransaction(tx.Nonce(), *to, tx.Value(), tx.Gas(), price, tx.Data())
+	} else {
+		replacement = types.NewContractCreation(tx.Nonce(), tx.Value(), tx.Gas(), price, tx.Data())
+	}
+	signed, err := s.sign(from, replacement)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.b.SendTx(ctx, signed); err != nil {
+		return nil, err
+	}
+	log.Info("Sped up transaction", "original", hash, "replacement", signed.Hash(), "gasprice", price)
+	return &SpeedUpResult{Original: hash, Replacement: signed.Hash()}, nil
+}
+
 // PublicDebugAPI is the collection of True APIs exposed over the public
 // debugging endpoint.
 type PublicDebugAPI struct {
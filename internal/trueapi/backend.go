@@ -54,6 +54,7 @@ type Backend interface {
 	SnailBlockByNumber(ctx context.Context, blockNr rpc.BlockNumber) (*types.SnailBlock, error)
 	GetFruit(ctx context.Context, fastblockHash common.Hash) (*types.SnailBlock, error)
 	StateAndHeaderByNumber(ctx context.Context, blockNr rpc.BlockNumber) (*state.StateDB, *types.Header, error)
+	QuorumStateAndHeader(ctx context.Context, addr common.Address, blockNr rpc.BlockNumber, quorum int) (*state.StateDB, *types.Header, error)
 	GetBlock(ctx context.Context, blockHash common.Hash) (*types.Block, error)
 	GetSnailBlock(ctx context.Context, blockHash common.Hash) (*types.SnailBlock, error)
 	GetReceipts(ctx context.Context, blockHash common.Hash) (types.Receipts, error)
@@ -79,6 +80,7 @@ type Backend interface {
 	GetPoolNonce(ctx context.Context, addr common.Address) (uint64, error)
 	Stats() (pending int, queued int)
 	TxPoolContent() (map[common.Address]types.Transactions, map[common.Address]types.Transactions)
+	PriceBump() uint64
 	SubscribeNewTxsEvent(chan<- types.NewTxsEvent) event.Subscription
 
 	ChainConfig() *params.ChainConfig
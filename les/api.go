@@ -17,14 +17,28 @@
 package les
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"math/big"
+	"time"
 
+	"truechain/discovery/common"
 	"truechain/discovery/common/hexutil"
+	"truechain/discovery/core/types"
+	"truechain/discovery/crypto"
+	"truechain/discovery/light/fast"
+	"truechain/discovery/params"
+	"truechain/discovery/rlp"
+	"truechain/discovery/rpc"
 )
 
 var (
 	errNoCheckpoint = errors.New("no local checkpoint provided")
 	errNotActivated = errors.New("checkpoint registrar is not activated")
+
+	errUnknownSnailBlock = errors.New("unknown snail block")
+	errHeaderNotFound    = errors.New("header not found")
 )
 
 // PrivateLightAPI provides an API to access the LES light server or light client.
@@ -75,6 +89,12 @@ func (api *PrivateLightAPI) GetCheckpoint(index uint64) ([3]string, error) {
 	return res, nil
 }
 
+// GetCheckpointProof returns the CHT root and the head of the given section with
+// a merkle proof of the head, verified against the local checkpoint.
+func (api *PrivateLightAPI) GetCheckpointProof(ctx context.Context, index uint64) (*CheckpointProof, error) {
+	return api.backend.checkpointProof(ctx, index)
+}
+
 // GetCheckpointContractAddress returns the contract contract address in hex format.
 func (api *PrivateLightAPI) GetCheckpointContractAddress() (string, error) {
 	if api.reg == nil {
@@ -82,3 +102,419 @@ func (api *PrivateLightAPI) GetCheckpointContractAddress() (string, error) {
 	}
 	return api.reg.config.Address.Hex(), nil
 }
+
+// VerifyCheckpoint checks whether a checkpoint update is signed by at least the
+// threshold of the configured checkpoint oracle signers, returning the
+// addresses of the approving signers.
+func (api *PrivateLightAPI) VerifyCheckpoint(checkpoint params.TrustedCheckpoint, signatures []hexutil.Bytes) ([]common.Address, error) {
+	if api.reg == nil {
+		return nil, errNotActivated
+	}
+	sigs := make([][]byte, len(signatures))
+	for i, sig := range signatures {
+		sigs[i] = sig
+	}
+	return api.reg.verifyCheckpoint(&checkpoint, sigs)
+}
+
+// CheckConfigCompat reports the rewind the local chain would go through if the
+// node was restarted with the given chain config, without applying it.
+func (api *PrivateLightAPI) CheckConfigCompat(config *params.ChainConfig) (*ConfigCompat, error) {
+	if config == nil {
+		return nil, errors.New("missing chain config")
+	}
+	return api.backend.checkConfigCompat(config)
+}
+
+// ProtocolSpec returns the protocol spec the message codes, request limits and
+// cost tables of the node were generated from.
+func (api *PrivateLightAPI) ProtocolSpec() json.RawMessage {
+	return json.RawMessage(protocolSpecJSON)
+}
+
+// PrivateLightServerAPI provides an API to access the LES light server.
+type PrivateLightServerAPI struct {
+	server *LesServer
+}
+
+// NewPrivateLightServerAPI creates a new LES light server API.
+func NewPrivateLightServerAPI(server *LesServer) *PrivateLightServerAPI {
+	return &PrivateLightServerAPI{server: server}
+}
+
+// Drain announces to the connected clients that the server is going under
+// maintenance for the given number of seconds.
+func (api *PrivateLightServerAPI) Drain(seconds uint64) bool {
+	api.server.Drain(time.Duration(seconds) * time.Second)
+	return true
+}
+
+// CheckpointBlob is a checkpoint ready to be signed by a trusted signer of the
+// checkpoint oracle contract.
+type CheckpointBlob struct {
+	Checkpoint  params.TrustedCheckpoint `json:"checkpoint"`
+	Hash        common.Hash              `json:"hash"`        // checkpoint hash registered in the contract
+	Oracle      common.Address           `json:"oracle"`      // address of the oracle contract
+	SigningData hexutil.Bytes            `json:"signingData"` // EIP 191 data approved by the signers
+	SigningHash common.Hash              `json:"signingHash"` // keccak256 of the signing data, to be signed directly
+}
+
+// CheckpointBlob computes the CHT and bloom trie roots of the latest locally
+// processed sections and returns them together with the data the trusted
+// signers of the checkpoint oracle have to sign.
+func (api *PrivateLightServerAPI) CheckpointBlob() (*CheckpointBlob, error) {
+	reg := api.server.protocolManager.reg
+	if reg == nil {
+		return nil, errNotActivated
+	}
+	cp := api.server.latestLocalCheckpoint()
+	if cp.Empty() {
+		return nil, errNoCheckpoint
+	}
+	data := checkpointSigningData(reg.config.Address, cp.SectionIndex, cp.Hash())
+	return &CheckpointBlob{
+		Checkpoint:  cp,
+		Hash:        cp.Hash(),
+		Oracle:      reg.config.Address,
+		SigningData: data,
+		SigningHash: crypto.Keccak256Hash(data),
+	}, nil
+}
+
+// PrivateLightClientAPI provides an API to access the LES light client.
+type PrivateLightClientAPI struct {
+	client *LightEtrue
+}
+
+// NewPrivateLightClientAPI creates a new LES light client API.
+func NewPrivateLightClientAPI(client *LightEtrue) *PrivateLightClientAPI {
+	return &PrivateLightClientAPI{client: client}
+}
+
+// SelfTest runs a suite of request/response round trips against each connected
+// server and reports which message types each server answers correctly.
+func (api *PrivateLightClientAPI) SelfTest(ctx context.Context) []*SelfTestResult {
+	return api.client.selfTest(ctx)
+}
+
+// WatchTransaction starts watching a transaction. If the transaction gets
+// rolled back by a reorg after it has been included, an alert is logged and
+// posted to the configured webhook.
+func (api *PrivateLightClientAPI) WatchTransaction(ctx context.Context, hash common.Hash) error {
+	return api.client.txPool.Watch(ctx, hash)
+}
+
+// UnwatchTransaction stops watching a transaction.
+func (api *PrivateLightClientAPI) UnwatchTransaction(hash common.Hash) bool {
+	return api.client.txPool.Unwatch(hash)
+}
+
+// WatchedTransactions returns the last known positions of the watched
+// transactions.
+func (api *PrivateLightClientAPI) WatchedTransactions() []fast.WatchedTx {
+	return api.client.txPool.Watched()
+}
+
+// TransactionStatus returns the status of the given transactions, looking up
+// the ones not mined by the local pool from the servers.
+func (api *PrivateLightClientAPI) TransactionStatus(ctx context.Context, hashes []common.Hash) ([]fast.TxStatus, error) {
+	return api.client.txPool.Status(ctx, hashes)
+}
+
+// ScheduleTransaction holds a signed transaction until the head reaches the
+// given block number and timestamp, then relays and tracks it like a sent one.
+// Scheduled transactions are kept across restarts.
+func (api *PrivateLightClientAPI) ScheduleTransaction(encodedTx hexutil.Bytes, number, timestamp *hexutil.Uint64) (*ScheduledTx, error) {
+	tx := new(types.Transaction)
+	if err := rlp.DecodeBytes(encodedTx, tx); err != nil {
+		return nil, err
+	}
+	var n, t uint64
+	if number != nil {
+		n = uint64(*number)
+	}
+	if timestamp != nil {
+		t = uint64(*timestamp)
+	}
+	return api.client.scheduler.schedule(tx, n, t)
+}
+
+// ScheduledTransactions returns the transactions waiting for their release.
+func (api *PrivateLightClientAPI) ScheduledTransactions() []ScheduledTx {
+	return api.client.scheduler.scheduled()
+}
+
+// CancelScheduledTransaction drops a scheduled transaction before its release.
+func (api *PrivateLightClientAPI) CancelScheduledTransaction(hash common.Hash) bool {
+	return api.client.scheduler.cancel(hash)
+}
+
+// FruitHeaders returns the headers of the fruits included in a snail block,
+// retrieved on demand and validated against the block header, e.g. to verify
+// the reward distribution of the block.
+func (api *PrivateLightClientAPI) FruitHeaders(ctx context.Context, number uint64) ([]*types.SnailHeader, error) {
+	header := api.client.blockchain.GetHeaderByNumber(number)
+	if header == nil {
+		return nil, errUnknownSnailBlock
+	}
+	return api.client.blockchain.GetFruitHeaders(ctx, header.Hash())
+}
+
+// WatchDeposits adds addresses to the set scanned for deposits in every new
+// block, returning the number of addresses not watched before. The set is kept
+// across restarts and may hold many thousands of addresses.
+func (api *PrivateLightClientAPI) WatchDeposits(addresses []common.Address) int {
+	return api.client.deposits.watch(addresses)
+}
+
+// UnwatchDeposits removes addresses from the set scanned for deposits.
+func (api *PrivateLightClientAPI) UnwatchDeposits(addresses []common.Address) int {
+	return api.client.deposits.unwatch(addresses)
+}
+
+// DepositWatchStatus returns the number of watched addresses and the scanning
+// progress.
+func (api *PrivateLightClientAPI) DepositWatchStatus() *DepositWatchStatus {
+	return api.client.deposits.status()
+}
+
+// Deposits returns the batches of deposits found since the last call.
+func (api *PrivateLightClientAPI) Deposits() []DepositBatch {
+	return api.client.deposits.poll()
+}
+
+// MultisigInfo returns the nonce, the threshold and the owners of a
+// multi-signature wallet contract, read from the state retrieved on demand.
+func (api *PrivateLightClientAPI) MultisigInfo(ctx context.Context, contract common.Address) (*MultisigInfo, error) {
+	return api.client.multisigInfo(ctx, contract)
+}
+
+// ProposeMultisig starts collecting owner signatures for a call of a
+// multi-signature wallet at its current nonce. The owners sign the returned
+// hash and submit their signature with SignMultisig.
+func (api *PrivateLightClientAPI) ProposeMultisig(ctx context.Context, contract, destination common.Address, value *hexutil.Big, data hexutil.Bytes) (*MultisigProposal, error) {
+	v := new(big.Int)
+	if value != nil {
+		v = value.ToInt()
+	}
+	return api.client.proposeMultisig(ctx, contract, destination, v, data)
+}
+
+// SignMultisig adds an owner signature to a multisig proposal, returning the
+// recovered owner.
+func (api *PrivateLightClientAPI) SignMultisig(hash common.Hash, sig hexutil.Bytes) (common.Address, error) {
+	return api.client.signMultisig(hash, sig)
+}
+
+// MultisigProposals returns the multisig proposals collecting signatures.
+func (api *PrivateLightClientAPI) MultisigProposals() []*MultisigProposal {
+	return api.client.multisigs.list()
+}
+
+// RelayMultisig executes a multisig proposal with enough signatures in a
+// transaction sent from the given unlocked account, returning its hash.
+func (api *PrivateLightClientAPI) RelayMultisig(ctx context.Context, hash common.Hash, from common.Address, gas *hexutil.Uint64, gasPrice *hexutil.Big) (common.Hash, error) {
+	var g uint64
+	if gas != nil {
+		g = uint64(*gas)
+	}
+	return api.client.relayMultisig(ctx, hash, from, g, (*big.Int)(gasPrice))
+}
+
+// ScanLogs returns the logs of the given block range emitted by any of the
+// addresses and carrying any of the topics. Logs are found by matching compact
+// block filters locally, without revealing the addresses and topics to the
+// servers. The range ends at the current head at the latest. Requires servers
+// serving the experimental block filter extension.
+func (api *PrivateLightClientAPI) ScanLogs(ctx context.Context, from, to rpc.BlockNumber, addresses []common.Address, topics []common.Hash) ([]*types.Log, error) {
+	head := api.client.fblockchain.CurrentHeader().Number.Uint64()
+	resolve := func(n rpc.BlockNumber) uint64 {
+		if n < 0 || uint64(n) > head {
+			return head
+		}
+		return uint64(n)
+	}
+	start, end := resolve(from), resolve(to)
+	if (from >= 0 && uint64(from) > head) || start > end {
+		return nil, errInvalidScanRange
+	}
+	return api.client.scanLogs(ctx, start, end, addresses, topics)
+}
+
+// Dashboard returns a consolidated snapshot of the peers, sync progress,
+// indexers, caches, transaction relay and bandwidth of the light client.
+func (api *PrivateLightClientAPI) Dashboard() *Dashboard {
+	return api.client.dashboard()
+}
+
+// PrivateLightDebugAPI provides debugging tools for the les subsystems.
+type PrivateLightDebugAPI struct {
+	client *LightEtrue
+}
+
+// NewPrivateLightDebugAPI creates a new les debug API.
+func NewPrivateLightDebugAPI(client *LightEtrue) *PrivateLightDebugAPI {
+	return &PrivateLightDebugAPI{client: client}
+}
+
+// LesGoroutines lists the long-lived goroutines of the les subsystems along with
+// their current state. The goroutines carry the pprof label "les" with the same
+// name, indexer update loops are labeled "indexer".
+func (api *PrivateLightDebugAPI) LesGoroutines() []RoutineInfo {
+	return routines.list()
+}
+
+// LesForkChoice returns the total difficulty of the branches announced by the
+// servers and the recent snail head changes along with the announcement or
+// sync that caused them, for the analysis of unexpected reorgs.
+func (api *PrivateLightDebugAPI) LesForkChoice() *ForkChoiceReport {
+	return api.client.forkChoice()
+}
+
+// EventBuffers returns the fill level and the number of dropped events of the
+// buffered head and log event subscriptions.
+func (api *PrivateLightClientAPI) EventBuffers() []EventBufferStats {
+	return api.client.events.stats()
+}
+
+// RestoreRewindBackup undoes the last rewind caused by a chain config upgrade,
+// writing back the dropped headers and the previous chain config. The node has
+// to be restarted with the previous config afterwards.
+func (api *PrivateLightClientAPI) RestoreRewindBackup() (*RewindRestore, error) {
+	return restoreRewind(api.client.chainDb)
+}
+
+// EclipseRisk returns whether an eclipse attack is suspected. While the risk is
+// raised, the heads announced by the servers are not finalized.
+func (api *PrivateLightClientAPI) EclipseRisk() EclipseRiskEvent {
+	return api.client.protocolManager.eclipse.current()
+}
+
+// ClientInfo returns the response time and reliability statistics of the
+// connected light servers, as tracked by the server pool.
+func (api *PrivateLightClientAPI) ClientInfo() []ServerStats {
+	return api.client.serverPool.stats()
+}
+
+// ServerPool returns all servers of the server pool, the ones found by topic
+// discovery and the ones connected before, with their connection statistics and
+// addresses. The statistics of the servers connected before are kept across
+// restarts.
+func (api *PrivateLightClientAPI) ServerPool() []KnownServer {
+	return api.client.serverPool.known()
+}
+
+// StartupReport returns the configuration the light client was started with.
+func (api *PrivateLightClientAPI) StartupReport() *StartupReport {
+	return api.client.report
+}
+
+// ULCStatus returns the configuration of the ultra light client mode and the
+// trusted servers currently connected.
+func (api *PrivateLightClientAPI) ULCStatus() *ULCStatus {
+	return api.client.protocolManager.ulc.status(api.client.peers)
+}
+
+// SetAnnounceConfirmations sets the number of servers which must announce a head
+// before the light client switches to it, outside ultra light client mode. More
+// confirmations make a head forged by a few servers less likely to be followed,
+// at the cost of switching later. It's capped by the servers connected.
+func (api *PrivateLightClientAPI) SetAnnounceConfirmations(n int) error {
+	return api.client.setAnnounceConfirms(n)
+}
+
+// AnnounceConfirmations returns the number of servers which must announce a
+// head before the light client switches to it.
+func (api *PrivateLightClientAPI) AnnounceConfirmations() int {
+	n := api.client.config.LightAnnounceConfirms
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+// AddTrustedServer pins a server (enode URL) without restarting the client: it
+// is kept connected and, in ultra light client mode, trusted to announce heads.
+func (api *PrivateLightClientAPI) AddTrustedServer(url string) error {
+	return api.client.addTrustedServer(url)
+}
+
+// RemoveTrustedServer unpins a server added as trusted by the configuration or
+// AddTrustedServer, and disconnects it.
+func (api *PrivateLightClientAPI) RemoveTrustedServer(url string) (bool, error) {
+	return api.client.removeTrustedServer(url)
+}
+
+// Prune deletes the bodies, receipts and bloom bits cached from the servers for
+// all but the given number of most recent sections. If keep is omitted, the
+// configured number of sections is kept.
+func (api *PrivateLightClientAPI) Prune(keep *uint64) (*PruneResult, error) {
+	sections := api.client.config.LightPruneSections
+	if keep != nil {
+		sections = *keep
+	}
+	return api.client.pruner.prune(sections)
+}
+
+// PeerHead is the latest head announced by a connected server.
+type PeerHead struct {
+	ID         string       `json:"id"`
+	Hash       common.Hash  `json:"hash"`
+	Number     uint64       `json:"number"`
+	Td         *hexutil.Big `json:"td"`
+	FastHash   common.Hash  `json:"fastHash"`
+	FastNumber uint64       `json:"fastNumber"`
+	Agree      int          `json:"agree"`  // number of servers announcing the same head, including this one
+	Status     string       `json:"status"` // "canonical", "ahead" or "fork" compared to the local chain
+}
+
+// PeerHeads lists the latest head and total difficulty announced by every
+// connected server, along with how many servers agree on it and whether it is
+// on the local canonical chain, to spot a server following a different fork.
+func (api *PrivateLightClientAPI) PeerHeads() []PeerHead {
+	var (
+		heads []PeerHead
+		agree = make(map[common.Hash]int)
+		local = api.client.blockchain.CurrentHeader().Number.Uint64()
+	)
+	for _, p := range api.client.peers.AllPeers() {
+		info := p.headBlockInfo()
+		head := PeerHead{
+			ID:         p.id,
+			Hash:       info.Hash,
+			Number:     info.Number,
+			FastHash:   info.FastHash,
+			FastNumber: info.FastNumber,
+			Status:     "ahead",
+		}
+		if info.Td != nil {
+			head.Td = (*hexutil.Big)(info.Td)
+		}
+		if info.Number <= local {
+			head.Status = "fork"
+			if header := api.client.blockchain.GetHeaderByNumber(info.Number); header != nil && header.Hash() == info.Hash {
+				head.Status = "canonical"
+			}
+		}
+		agree[info.Hash]++
+		heads = append(heads, head)
+	}
+	for i := range heads {
+		heads[i].Agree = agree[heads[i].Hash]
+	}
+	return heads
+}
+
+// HeadCheck returns the result of the last comparison of the local chain with
+// the configured HTTPS head check source, or nil if none is configured or no
+// check was done yet.
+func (api *PrivateLightClientAPI) HeadCheck() *HeadCheck {
+	return api.client.headChecker.status()
+}
+
+// ExportGenesis returns the genesis spec the node was initialised with, as
+// reconstructed from the database, so that it can be verified and used to
+// initialise new nodes.
+func (api *PrivateLightClientAPI) ExportGenesis() (json.RawMessage, error) {
+	return api.client.exportGenesis()
+}
@@ -105,7 +105,21 @@ func (b *LesApiBackend) StateAndHeaderByNumber(ctx context.Context, blockNr rpc.
 	if header == nil || err != nil {
 		return nil, nil, err
 	}
-	return fast.NewState(ctx, header, b.etrue.odr), header, nil
+	return fast.NewState(ctx, header, b.etrue.hot.odrBackend(b.etrue.odr)), header, nil
+}
+
+// QuorumStateAndHeader returns the state of a block after the account entry of
+// addr in it has been proven by quorum servers, each in its own chain.
+func (b *LesApiBackend) QuorumStateAndHeader(ctx context.Context, addr common.Address, blockNr rpc.BlockNumber, quorum int) (*state.StateDB, *types.Header, error) {
+	header, err := b.HeaderByNumber(ctx, blockNr)
+	if header == nil || err != nil {
+		return nil, nil, err
+	}
+	_, header, _, err = b.etrue.quorumBalance(ctx, addr, header.Number.Uint64(), quorum)
+	if err != nil {
+		return nil, nil, err
+	}
+	return fast.NewState(ctx, header, b.etrue.hot.odrBackend(b.etrue.odr)), header, nil
 }
 
 func (b *LesApiBackend) GetBlock(ctx context.Context, blockHash common.Hash) (*types.Block, error) {
@@ -128,6 +142,10 @@ func (b *LesApiBackend) GetReceipts(ctx context.Context, hash common.Hash) (type
 }
 
 func (b *LesApiBackend) GetLogs(ctx context.Context, hash common.Hash) ([][]*types.Log, error) {
+	if b.etrue.loadShedder.overloaded() {
+		loadShedRejectMeter.Mark(1)
+		return nil, errOverloaded
+	}
 	if number := rawdb.ReadHeaderNumber(b.etrue.chainDb, hash); number != nil {
 		return fast.GetBlockLogs(ctx, b.etrue.odr, hash, *number)
 	}
@@ -144,6 +162,16 @@ func (b *LesApiBackend) GetEVM(ctx context.Context, msg core.Message, state *sta
 	return vm.NewEVM(context, state, b.etrue.chainConfig, vmCfg), state.Error, nil
 }
 
+// RevertReason returns the revert reason of the transaction with the given index
+// in a fast block, recovered by re-executing the block. It returns nil if the
+// recovery is not enabled.
+func (b *LesApiBackend) RevertReason(ctx context.Context, blockHash common.Hash, index uint64) ([]byte, error) {
+	if b.etrue.revertCache == nil {
+		return nil, nil
+	}
+	return b.etrue.revertReason(ctx, blockHash, index)
+}
+
 func (b *LesApiBackend) SendTx(ctx context.Context, signedTx *types.Transaction) error {
 	return b.etrue.txPool.Add(ctx, signedTx)
 }
@@ -176,28 +204,48 @@ func (b *LesApiBackend) TxPoolContent() (map[common.Address]types.Transactions,
 	return b.etrue.txPool.Content()
 }
 
+func (b *LesApiBackend) PriceBump() uint64 {
+	return b.etrue.txPool.PriceBump()
+}
+
 func (b *LesApiBackend) SubscribeNewTxsEvent(ch chan<- types.NewTxsEvent) event.Subscription {
 	return b.etrue.txPool.SubscribeNewTxsEvent(ch)
 }
 
 func (b *LesApiBackend) SubscribeChainEvent(ch chan<- types.FastChainEvent) event.Subscription {
-	return b.etrue.fblockchain.SubscribeChainEvent(ch)
+	return b.etrue.events.subscribe("chain", ch, func(ch interface{}) event.Subscription {
+		return b.etrue.fblockchain.SubscribeChainEvent(ch.(chan<- types.FastChainEvent))
+	})
 }
 
 func (b *LesApiBackend) SubscribeChainHeadEvent(ch chan<- types.FastChainHeadEvent) event.Subscription {
-	return b.etrue.fblockchain.SubscribeChainHeadEvent(ch)
+	return b.etrue.events.subscribe("chainHead", ch, func(ch interface{}) event.Subscription {
+		return b.etrue.fblockchain.SubscribeChainHeadEvent(ch.(chan<- types.FastChainHeadEvent))
+	})
 }
 
 func (b *LesApiBackend) SubscribeChainSideEvent(ch chan<- types.FastChainSideEvent) event.Subscription {
-	return b.etrue.fblockchain.SubscribeChainSideEvent(ch)
+	return b.etrue.events.subscribe("chainSide", ch, func(ch interface{}) event.Subscription {
+		return b.etrue.fblockchain.SubscribeChainSideEvent(ch.(chan<- types.FastChainSideEvent))
+	})
+}
+
+func (b *LesApiBackend) SubscribeSnailChainEvent(ch chan<- types.SnailChainEvent) event.Subscription {
+	return b.etrue.events.subscribe("snailChain", ch, func(ch interface{}) event.Subscription {
+		return b.etrue.blockchain.SubscribeChainEvent(ch.(chan<- types.SnailChainEvent))
+	})
 }
 
 func (b *LesApiBackend) SubscribeLogsEvent(ch chan<- []*types.Log) event.Subscription {
-	return b.etrue.fblockchain.SubscribeLogsEvent(ch)
+	return b.etrue.events.subscribe("logs", ch, func(ch interface{}) event.Subscription {
+		return b.etrue.fblockchain.SubscribeLogsEvent(ch.(chan<- []*types.Log))
+	})
 }
 
 func (b *LesApiBackend) SubscribeRemovedLogsEvent(ch chan<- types.RemovedLogsEvent) event.Subscription {
-	return b.etrue.fblockchain.SubscribeRemovedLogsEvent(ch)
+	return b.etrue.events.subscribe("removedLogs", ch, func(ch interface{}) event.Subscription {
+		return b.etrue.fblockchain.SubscribeRemovedLogsEvent(ch.(chan<- types.RemovedLogsEvent))
+	})
 }
 
 func (b *LesApiBackend) GetReward(number int64) *types.BlockReward {
@@ -248,6 +296,17 @@ func (b *LesApiBackend) Downloader() *downloader.Downloader {
 	return b.etrue.Downloader()
 }
 
+// ChtProgress returns the number of CHT sections verified locally and the number
+// of complete sections up to the highest known snail header.
+func (b *LesApiBackend) ChtProgress() (uint64, uint64) {
+	verified, _, _ := b.etrue.chtIndexer.Sections()
+	highest := b.etrue.Downloader().Progress().HighestSnailBlock
+	if head := b.etrue.blockchain.CurrentHeader().Number.Uint64(); head > highest {
+		highest = head
+	}
+	return verified, chtSections(highest)
+}
+
 func (b *LesApiBackend) ProtocolVersion() int {
 	return b.etrue.LesVersion() + 10000
 }
@@ -0,0 +1,66 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"fmt"
+	"strings"
+
+	"truechain/discovery/rpc"
+)
+
+// adminModuleSuffix marks a namespace of LightAPIModules as admin-only.
+const adminModuleSuffix = ":admin"
+
+// apiModules parses the namespaces of the light client APIs to register,
+// mapped to whether they are admin-only. It returns nil if all namespaces are
+// registered.
+func apiModules(modules []string) (map[string]bool, error) {
+	if len(modules) == 0 {
+		return nil, nil
+	}
+	parsed := make(map[string]bool)
+	for _, module := range modules {
+		name, admin := strings.TrimSuffix(module, adminModuleSuffix), strings.HasSuffix(module, adminModuleSuffix)
+		if name == "" || strings.ContainsAny(name, ": ") {
+			return nil, fmt.Errorf("invalid light API module %q", module)
+		}
+		parsed[name] = parsed[name] || admin
+	}
+	return parsed, nil
+}
+
+// filterAPIs keeps the APIs in the configured namespaces, all if modules is nil.
+// Admin-only namespaces are made private, so they're served over IPC but over
+// HTTP and WebSocket only if they're whitelisted there explicitly.
+func filterAPIs(apis []rpc.API, modules map[string]bool) []rpc.API {
+	if modules == nil {
+		return apis
+	}
+	var filtered []rpc.API
+	for _, api := range apis {
+		admin, ok := modules[api.Namespace]
+		if !ok {
+			continue
+		}
+		if admin {
+			api.Public = false
+		}
+		filtered = append(filtered, api)
+	}
+	return filtered
+}
@@ -18,14 +18,16 @@
 package les
 
 import (
+	"context"
 	"fmt"
+	"math/big"
 	"sync"
-	"time"
 	"truechain/discovery/accounts/abi/bind"
 	"truechain/discovery/common/mclock"
 	"truechain/discovery/light/fast"
 	"truechain/discovery/light/public"
 
+	"github.com/hashicorp/golang-lru"
 	"truechain/discovery/accounts"
 	"truechain/discovery/common"
 	"truechain/discovery/common/hexutil"
@@ -45,6 +47,7 @@ import (
 	"truechain/discovery/node"
 	"truechain/discovery/p2p"
 	"truechain/discovery/p2p/discv5"
+	"truechain/discovery/p2p/enode"
 	"truechain/discovery/params"
 	"truechain/discovery/rpc"
 )
@@ -58,6 +61,7 @@ type LightEtrue struct {
 	shutdownChan chan bool
 
 	// Handlers
+	handler     *clientHandler // protocol manager of the client, shared as lesCommons.protocolManager
 	peers       *peerSet
 	txPool      *fast.TxPool
 	election    *Election
@@ -67,6 +71,29 @@ type LightEtrue struct {
 	reqDist     *requestDistributor
 	retriever   *retrieveManager
 	relay       *lesTxRelay
+	loadShedder *loadShedder
+	txAlerter   *txAlerter
+	headChecker *headChecker
+	pruner      *pruner
+	freezer     *headerFreezer
+	scheduler   *txScheduler
+	deposits    *depositWatcher
+	hot         *hotState
+	logIndexers []*logIndexer // registered contract event indexer plugins
+	extensions  []string      // registered protocol extensions, announced after a restart too
+	customAPIs  []rpc.API     // RPC services registered by the embedding application
+	middlewares []BackendMiddleware
+	syncFeed    event.Feed // milestones of the header synchronisation, kept across restarts
+	multisigs   *multisigBook
+	events      *eventBuffers
+	peerGroup   PeerGroupFunc // Network group lookup of the servers, nil for the /16 prefix
+	scorer      ServerScorer  // Dial selection weight of the servers, nil for the default
+	report      *StartupReport
+	revertCache *lru.Cache // recovered revert reasons by block hash and index, nil if disabled
+	estimates   *lru.Cache // state entries touched by the latest estimated call by destination
+	trustedLock sync.Mutex // serialises runtime changes of the trusted servers
+
+	apiModules map[string]bool // namespaces of the registered APIs mapped to admin-only, nil for all
 
 	bloomRequests chan chan *bloombits.Retrieval // Channel receiving bloom data retrieval requests
 	bloomIndexer  *core.ChainIndexer
@@ -80,59 +107,140 @@ type LightEtrue struct {
 	networkId     uint64
 	netRPCService *trueapi.PublicNetAPI
 
+	svcCtx  *node.ServiceContext // Context the service was created with, needed to restart it
+	stopped bool                 // Whether the service was stopped and has to be set up again on Start
+
 	wg sync.WaitGroup
 }
 
 func New(ctx *node.ServiceContext, config *etrue.Config) (*LightEtrue, error) {
-	chainDb, err := etrue.CreateDB(ctx, config, "lightchaindata")
+	if err := ApplyLightProfile(config); err != nil {
+		return nil, err
+	}
+	leth := &LightEtrue{
+		lesCommons: lesCommons{
+			config:  config,
+			iConfig: public.DefaultClientIndexerConfig,
+		},
+		svcCtx:         ctx,
+		eventMux:       ctx.EventMux,
+		accountManager: ctx.AccountManager,
+		networkId:      config.NetworkId,
+		events:         newEventBuffers(config.LightEventBuffer),
+		multisigs:      newMultisigBook(),
+	}
+	if config.LightRevertReasons {
+		leth.revertCache, _ = lru.New(revertCacheLimit)
+	}
+	leth.estimates, _ = lru.New(estimateCacheLimit)
+	modules, err := apiModules(config.LightAPIModules)
 	if err != nil {
 		return nil, err
 	}
+	leth.apiModules = modules
+	if err := leth.setup(); err != nil {
+		return nil, err
+	}
+	// The API backend resolves the components through the service, so it is
+	// shared by all runs of a restarted service.
+	leth.ApiBackend = &LesApiBackend{false, leth, nil}
+	gpoParams := config.GPO
+	if gpoParams.Default == nil {
+		gpoParams.Default = config.GasPrice
+	}
+	leth.ApiBackend.gpo = gasprice.NewOracle(leth.ApiBackend, gpoParams)
+
+	return leth, nil
+}
+
+// setup opens the database and creates all the internal components of the
+// service. It runs on creation and again on every restart after a Stop, since
+// stopping consumes the channels, pools and chains of the previous run.
+func (leth *LightEtrue) setup() (err error) {
+	ctx, config := leth.svcCtx, leth.config
+
+	chainDb, err := etrue.CreateDB(ctx, config, "lightchaindata")
+	if err != nil {
+		return err
+	}
+	// Close the database again if any component below fails to set up
+	defer func() {
+		if err != nil {
+			chainDb.Close()
+		}
+	}()
+	if config.LightFreezer {
+		fdb, err := NewFreezerDB(chainDb)
+		if err != nil {
+			return err
+		}
+		chainDb = fdb
+	}
 	chainConfig, genesisHash, snailGenesis, genesisErr := core.SetupGenesisBlock(chainDb, config.Genesis)
 	if _, isCompat := genesisErr.(*params.ConfigCompatError); genesisErr != nil && !isCompat {
-		return nil, genesisErr
+		return genesisErr
 	}
 	log.Info("Initialised chain configuration", "config", chainConfig)
 
+	if err := checkNetworkId(chainConfig, config); err != nil {
+		return err
+	}
 	peers := newPeerSet()
 	quitSync := make(chan struct{})
 
-	leth := &LightEtrue{
-		lesCommons: lesCommons{
-			chainDb: chainDb,
-			config:  config,
-			iConfig: public.DefaultClientIndexerConfig,
-		},
-		chainConfig:    chainConfig,
-		eventMux:       ctx.EventMux,
-		peers:          peers,
-		reqDist:        newRequestDistributor(peers, quitSync, &mclock.System{}),
-		accountManager: ctx.AccountManager,
-		engine:         etrue.CreateConsensusEngine(ctx, &config.MinervaHash, chainConfig, chainDb),
-		shutdownChan:   make(chan bool),
-		networkId:      config.NetworkId,
-		bloomRequests:  make(chan chan *bloombits.Retrieval),
-		//bloomIndexer:   etrue.NewBloomIndexer(chainDb, params.BloomBitsBlocksClient, params.HelperTrieConfirmations),
+	leth.chainDb = chainDb
+	leth.chainConfig = chainConfig
+	leth.peers = peers
+	leth.reqDist = newRequestDistributor(peers, quitSync, &mclock.System{})
+	if leth.engine, err = etrue.NewConsensusEngine(ctx, config, chainConfig, chainDb); err != nil {
+		return err
 	}
+	leth.shutdownChan = make(chan bool)
+	leth.bloomRequests = make(chan chan *bloombits.Retrieval)
+	leth.bloomIndexer = etrue.NewBloomIndexer(chainDb, params.BloomBitsBlocksClient, params.HelperTrieConfirmations)
 
 	leth.serverPool = newServerPool(chainDb, quitSync, &leth.wg, nil)
+	leth.serverPool.diversity = newPeerDiversity(config.LightMaxPerGroup, leth.peerGroup)
+	if leth.scorer != nil {
+		leth.serverPool.scorer = leth.scorer
+	}
 	leth.retriever = newRetrieveManager(peers, leth.reqDist, leth.serverPool)
-	leth.relay = newLesTxRelay(peers, leth.retriever)
+	leth.retriever.hedgeTimeout = config.LightHedgeTimeout
+	if leth.retriever.policy, err = newRetrievePolicy(config.LightRequestTimeout, config.LightRequestHardTimeout, config.LightRequestRetries, config.LightRequestBackoff); err != nil {
+		return err
+	}
+	if config.LightRequestPeerWait > 0 {
+		leth.reqDist.peerWait = config.LightRequestPeerWait
+	}
+	leth.relay = newLesTxRelay(peers, leth.retriever, &leth.wg)
 
 	leth.odr = NewLesOdr(chainDb, public.DefaultClientIndexerConfig, leth.retriever)
-	leth.chtIndexer = light.NewChtIndexer(chainDb, leth.odr, params.CHTFrequency, params.HelperTrieConfirmations)
-	leth.bloomTrieIndexer = fast.NewBloomTrieIndexer(chainDb, leth.odr, params.BloomBitsBlocksClient, params.BloomTrieFrequency)
+	leth.odr.decoys = newDecoyPool(config.LightProofDecoys)
+	leth.odr.privacy = newPrivacyRouter(config.LightPrivacyMode)
+	leth.odr.cache = newOdrCache(config.CacheSizeMB)
+	leth.odr.batcher = newTrieBatcher(leth.odr, trieBatchWindow)
+	leth.odr.chainConfig = chainConfig
+	// The indexers retrieve their sections in the background
+	indexerOdr := priorityOdr{LesOdr: leth.odr, priority: priorityBackground}
+	leth.chtIndexer = light.NewChtIndexer(chainDb, indexerOdr, params.CHTFrequency, params.HelperTrieConfirmations)
+	leth.bloomTrieIndexer = fast.NewBloomTrieIndexer(chainDb, indexerOdr, params.BloomBitsBlocksClient, params.BloomTrieFrequency)
 	leth.odr.SetIndexers(leth.chtIndexer, leth.bloomTrieIndexer, leth.bloomIndexer)
+	if config.LightIndexerThrottle > 0 {
+		leth.chtIndexer.SetThrottling(config.LightIndexerThrottle)
+		leth.bloomTrieIndexer.SetThrottling(config.LightIndexerThrottle)
+		leth.bloomIndexer.SetThrottling(config.LightIndexerThrottle)
+	}
+	leth.loadShedder = newLoadShedder(config, leth.chtIndexer, leth.bloomTrieIndexer, leth.bloomIndexer)
 
 	checkpoint := params.TrustedCheckpoints[snailGenesis]
 
 	if leth.fblockchain, err = fast.NewLightChain(leth.odr, leth.chainConfig, leth.engine, checkpoint); err != nil {
-		return nil, err
+		return err
 	}
 	// Note: NewLightChain adds the trusted checkpoint so it needs an ODR with
 	// indexers already set but not started yet
 	if leth.blockchain, err = light.NewLightChain(leth.fblockchain, leth.odr, leth.chainConfig, leth.engine, checkpoint); err != nil {
-		return nil, err
+		return err
 	}
 	leth.election = NewLightElection(leth.fblockchain, leth.blockchain)
 	leth.engine.SetElection(leth.election)
@@ -141,32 +249,82 @@ func New(ctx *node.ServiceContext, config *etrue.Config) (*LightEtrue, error) {
 
 	// Note: AddChildIndexer starts the update process for the child
 	leth.chtIndexer.Start(leth.blockchain)
-	//leth.bloomIndexer.AddChildIndexer(leth.bloomTrieIndexer)
-	//leth.bloomIndexer.Start(leth.fblockchain)
+	leth.bloomIndexer.AddChildIndexer(leth.bloomTrieIndexer)
+	leth.bloomIndexer.Start(leth.fblockchain)
 
-	// Rewind the chain in case of an incompatible config upgrade.
+	// Rewind the fast chain in case of an incompatible config upgrade, the
+	// compatibility check is done against its head.
 	if compat, ok := genesisErr.(*params.ConfigCompatError); ok {
 		log.Warn("Rewinding chain to upgrade configuration", "err", compat)
-		leth.blockchain.SetHead(compat.RewindTo)
+		if config.LightRewindBackup {
+			backupRewind(chainDb, genesisHash, compat)
+		}
+		leth.fblockchain.SetHead(compat.RewindTo)
 		rawdb.WriteChainConfig(chainDb, genesisHash, chainConfig)
 	}
 
 	leth.txPool = fast.NewTxPool(leth.chainConfig, leth.fblockchain, leth.relay)
-	leth.ApiBackend = &LesApiBackend{false, leth, nil}
-	gpoParams := config.GPO
-	if gpoParams.Default == nil {
-		gpoParams.Default = config.GasPrice
+	leth.txPool.SetPriceBounds(config.LightMinGasPrice, config.LightMaxGasPrice, backendPriceOracle{leth})
+	leth.txPool.SetPendingLimits(config.LightTxAccountSlots, config.LightTxGlobalSlots)
+	leth.txPool.SetPriceBump(config.TxPool.PriceBump)
+	leth.txAlerter = newTxAlerter(leth.txPool, config.LightTxWebhook)
+	leth.scheduler = newTxScheduler(chainDb, leth.txPool, leth.fblockchain, types.NewTIP1Signer(leth.chainConfig.ChainID), &leth.wg)
+	leth.deposits = newDepositWatcher(chainDb, leth.fblockchain, types.NewTIP1Signer(leth.chainConfig.ChainID), config.LightDepositWebhook, &leth.wg)
+	leth.hot = newHotState(leth, config.LightHotAccounts, &leth.wg)
+	if leth.headChecker, err = newHeadChecker(leth.fblockchain, config.LightHeadCheckURL, config.LightHeadCheckInterval); err != nil {
+		return err
 	}
-	leth.ApiBackend.gpo = gasprice.NewOracle(leth.ApiBackend, gpoParams)
-
-	if leth.protocolManager, err = NewProtocolManager(leth.chainConfig, checkpoint, public.DefaultClientIndexerConfig, nil, 0, true, config.NetworkId, leth.eventMux, leth.engine, leth.peers, leth.fblockchain, leth.blockchain, nil, chainDb, leth.odr, leth.serverPool, nil, quitSync, &leth.wg, leth.election, nil); err != nil {
-		return nil, err
+	capabilities, err := proofCapabilities(config.LightProofFormat)
+	if err != nil {
+		return err
+	}
+	for _, name := range leth.extensions {
+		capabilities = withCapability(capabilities, extensionCapability(name))
 	}
+	ulcServers, ulcFraction := ulcConfig(config)
+	leth.handler = newClientHandler(&handlerConfig{
+		ChainConfig:   leth.chainConfig,
+		IndexerConfig: public.DefaultClientIndexerConfig,
+		NetworkId:     config.NetworkId,
+		EventMux:      leth.eventMux,
+		Peers:         leth.peers,
+		FastChain:     leth.fblockchain,
+		SnailChain:    leth.blockchain,
+		ChainDb:       chainDb,
+		Registrar:     newCheckpointOracle(checkpointOracleConfig(config, snailGenesis), nil),
+		QuitSync:      quitSync,
+		Wg:            &leth.wg,
+	}, &clientOptions{
+		Checkpoint:       checkpoint,
+		ULCServers:       ulcServers,
+		ULCFraction:      ulcFraction,
+		Odr:              leth.odr,
+		ServerPool:       leth.serverPool,
+		Election:         leth.election,
+		Roles:            newPeerRoles(config.LightRelayOnly, config.LightSyncOnly),
+		NodeSession:      config.LightNodeSession,
+		AnnounceConfirms: config.LightAnnounceConfirms,
+		Capabilities:     capabilities,
+		Eclipse:          newEclipseMonitor(checkpoint, leth.peerGroup),
+		SyncFeed:         &leth.syncFeed,
+	})
+	leth.protocolManager = leth.handler.ProtocolManager
+	leth.freezer = newHeaderFreezer(chainDb, leth.iConfig, leth.protocolManager.trustedCheckpoint, &leth.wg)
+	leth.pruner = newPruner(chainDb, leth.iConfig, leth.chtIndexer, leth.bloomTrieIndexer, leth.protocolManager.trustedCheckpoint, config.LightPruneSections, &leth.wg)
 	if leth.protocolManager.ulc != nil {
-		log.Warn("Ultra light client is enabled")
 		leth.blockchain.DisableCheckFreq()
 	}
-	return leth, nil
+	return nil
+}
+
+// backendPriceOracle suggests gas prices through the API backend, which is
+// created after the transaction pool.
+type backendPriceOracle struct {
+	s *LightEtrue
+}
+
+func (o backendPriceOracle) SuggestPrice(ctx context.Context) (*big.Int, error) {
+	return o.s.ApiBackend.SuggestPrice(ctx)
 }
 
 func lesTopic(genesisHash common.Hash, protocolVersion uint) discv5.Topic {
@@ -174,12 +332,31 @@ func lesTopic(genesisHash common.Hash, protocolVersion uint) discv5.Topic {
 	switch protocolVersion {
 	case lpv2:
 		name = "LES2"
+	case lpv3:
+		name = "LES3"
 	default:
 		panic(nil)
 	}
 	return discv5.Topic(name + "@" + common.Bytes2Hex(genesisHash.Bytes()[0:8]))
 }
 
+// lesTopics returns the discv5 topics light servers of the given protocol
+// versions are advertised and searched under: the ones derived from the genesis
+// hash, unless disabled in favour of the configured extra topics, followed by
+// the extra topics.
+func lesTopics(config *etrue.Config, genesisHash common.Hash, protocolVersions []uint) []discv5.Topic {
+	var topics []discv5.Topic
+	if !config.LightNoDefaultTopic || len(config.LightTopics) == 0 {
+		for _, pv := range protocolVersions {
+			topics = append(topics, lesTopic(genesisHash, pv))
+		}
+	}
+	for _, topic := range config.LightTopics {
+		topics = append(topics, discv5.Topic(topic))
+	}
+	return topics
+}
+
 type LightDummyAPI struct{}
 
 // Etherbase is the address that mining rewards will be send to
@@ -202,10 +379,12 @@ func (s *LightDummyAPI) Mining() bool {
 	return false
 }
 
-// APIs returns the collection of RPC services the ethereum package offers.
+// APIs returns the collection of RPC services the ethereum package offers,
+// limited to the namespaces of LightAPIModules if configured.
 // NOTE, some of these services probably need to be moved to somewhere else.
 func (s *LightEtrue) APIs() []rpc.API {
-	apis := trueapi.GetAPIs(s.ApiBackend)
+	backend := s.apiBackend()
+	apis := trueapi.GetAPIs(backend)
 	namespaces := []string{"etrue", "eth"}
 	for _, name := range namespaces {
 		apis = append(apis, []rpc.API{
@@ -222,13 +401,33 @@ func (s *LightEtrue) APIs() []rpc.API {
 			}, {
 				Namespace: name,
 				Version:   "1.0",
-				Service:   filters.NewPublicFilterAPI(s.ApiBackend, true),
+				Service:   filters.NewPublicFilterAPI(backend, true),
+				Public:    true,
+			}, {
+				Namespace: name,
+				Version:   "1.0",
+				Service:   NewPublicConfirmationAPI(s),
+				Public:    true,
+			}, {
+				Namespace: name,
+				Version:   "1.0",
+				Service:   NewPublicPairingAPI(s),
+				Public:    true,
+			}, {
+				Namespace: name,
+				Version:   "1.0",
+				Service:   NewPublicRewardInfoAPI(s),
 				Public:    true,
 			},
 		}...)
 	}
 	apis = append(apis, []rpc.API{
 		{
+			Namespace: "impawn",
+			Version:   "1.0",
+			Service:   NewPublicLightImpawnAPI(s),
+			Public:    true,
+		}, {
 			Namespace: "net",
 			Version:   "1.0",
 			Service:   s.netRPCService,
@@ -238,9 +437,26 @@ func (s *LightEtrue) APIs() []rpc.API {
 			Version:   "1.0",
 			Service:   NewPrivateLightAPI(&s.lesCommons, s.protocolManager.reg),
 			Public:    false,
+		}, {
+			Namespace: "les",
+			Version:   "1.0",
+			Service:   NewPrivateLightClientAPI(s),
+			Public:    false,
+		}, {
+			Namespace: "debug",
+			Version:   "1.0",
+			Service:   NewPrivateLightDebugAPI(s),
+			Public:    false,
 		},
 	}...)
-	return apis
+	return filterAPIs(append(apis, s.customAPIs...), s.apiModules)
+}
+
+// RegisterAPIs adds RPC services of the embedding application, e.g. in their own
+// namespaces, to the ones offered by the light client. It must be called before
+// the node is started.
+func (s *LightEtrue) RegisterAPIs(apis ...rpc.API) {
+	s.customAPIs = append(s.customAPIs, apis...)
 }
 
 func (s *LightEtrue) ResetWithGenesisBlock(gb *types.Block) {
@@ -262,40 +478,79 @@ func (s *LightEtrue) Protocols() []p2p.Protocol {
 }
 
 // Start implements node.Service, starting all internal goroutines needed by the
-// Truechain protocol implementation.
+// Truechain protocol implementation. A stopped service can be started again,
+// in which case all of its internal components are recreated first.
 func (s *LightEtrue) Start(srvr *p2p.Server) error {
-	log.Warn("Light client mode is an experimental feature")
+	if s.stopped {
+		if err := s.setup(); err != nil {
+			return err
+		}
+		s.stopped = false
+	}
 	s.startBloomHandlers(params.BloomBitsBlocksClient)
 	s.netRPCService = trueapi.NewPublicNetAPI(srvr, s.networkId)
 	// clients are searching for the first advertised protocol in the list
-	protocolVersion := AdvertiseProtocolVersions[0]
-	s.serverPool.start(srvr, lesTopic(s.SnailBlockChain().Genesis().Hash(), protocolVersion))
+	s.serverPool.start(srvr, lesTopics(s.config, s.SnailBlockChain().Genesis().Hash(), AdvertiseProtocolVersions[:1]))
 	s.protocolManager.Start(s.config.LightPeers)
+	s.loadShedder.start()
+	s.txAlerter.start()
+	s.headChecker.start()
+	s.pruner.start()
+	s.freezer.start()
+	s.scheduler.start()
+	s.deposits.start()
+	s.hot.start()
+	for _, l := range s.logIndexers {
+		l.start()
+	}
+
+	s.report = s.startupReport()
+	s.report.log()
 	return nil
 }
 
 // Stop implements node.Service, terminating all internal goroutines used by the
 // Truechain protocol.
 func (s *LightEtrue) Stop() error {
+	s.loadShedder.stop()
+	s.txAlerter.stop()
+	s.headChecker.stop()
+	s.pruner.stop()
+	s.freezer.stop()
+	s.scheduler.stop()
+	s.deposits.stop()
+	s.hot.stop()
+	for _, l := range s.logIndexers {
+		l.stop()
+	}
 	s.odr.Stop()
 	s.relay.Stop()
-	//s.bloomIndexer.Close()
-	s.chtIndexer.Close()
+	s.closeIndexers()
 	s.blockchain.Stop()
 	s.fblockchain.Stop()
 	s.protocolManager.Stop()
 	s.txPool.Stop()
 	//s.engine.Close()
 
-	s.eventMux.Stop()
+	// The event mux is shared with the node, keep it usable for a restart.
 
-	time.Sleep(time.Millisecond * 200)
+	// The retrievals were drained by the ODR backend and the database writing
+	// loops by the protocol manager waiting for the service wait group.
+	routines.checkLeaks(leakCheckTimeout)
 	s.chainDb.Close()
 	close(s.shutdownChan)
+	s.stopped = true
 
 	return nil
 }
 
+// closeIndexers stops the chain indexers. The bloom trie indexer is a child of
+// the bloom indexer and closed by it, closing it again would block forever.
+func (s *LightEtrue) closeIndexers() {
+	s.bloomIndexer.Close()
+	s.chtIndexer.Close()
+}
+
 // SetClient sets the rpc client and binds the registrar contract.
 func (s *LightEtrue) SetContractBackend(backend bind.ContractBackend) {
 	// Short circuit if registrar is nil
@@ -304,3 +559,67 @@ func (s *LightEtrue) SetContractBackend(backend bind.ContractBackend) {
 	}
 	s.protocolManager.reg.start(backend)
 }
+
+// addTrustedServer pins a server by adding it to the trusted servers of the
+// server pool and, if the ultra light client is enabled, to its trusted set.
+func (s *LightEtrue) addTrustedServer(url string) error {
+	node, err := enode.Parse(enode.ValidSchemes, url)
+	if err != nil {
+		return err
+	}
+	s.trustedLock.Lock()
+	defer s.trustedLock.Unlock()
+
+	if ulc := s.protocolManager.ulc; ulc != nil {
+		ulc.add(node.ID())
+	}
+	s.serverPool.addTrusted(node)
+	return nil
+}
+
+// setAnnounceConfirms sets the number of servers which must announce a head
+// before it's fetched, kept in the config across restarts of the client.
+func (s *LightEtrue) setAnnounceConfirms(n int) error {
+	if s.protocolManager.ulc != nil {
+		return errULCAnnounceQuorum
+	}
+	s.config.LightAnnounceConfirms = n
+	s.handler.fetcher.setAnnounceConfirms(n)
+	return nil
+}
+
+// removeTrustedServer unpins a trusted server, removing it from both the
+// server pool and the ultra light client. It returns false if the server
+// wasn't trusted.
+func (s *LightEtrue) removeTrustedServer(url string) (bool, error) {
+	node, err := enode.Parse(enode.ValidSchemes, url)
+	if err != nil {
+		return false, err
+	}
+	s.trustedLock.Lock()
+	defer s.trustedLock.Unlock()
+
+	if ulc := s.protocolManager.ulc; ulc != nil {
+		if err := ulc.remove(node.ID()); err != nil {
+			return false, err
+		}
+	}
+	return s.serverPool.removeTrusted(node.ID()), nil
+}
+
+// SetPeerGroupLookup replaces the /16 prefix grouping of the servers limited by
+// LightMaxPerGroup and checked by the eclipse monitor, e.g. with an ASN lookup.
+// It must be called before the node is started.
+func (s *LightEtrue) SetPeerGroupLookup(group PeerGroupFunc) {
+	s.peerGroup = group
+	s.serverPool.diversity = newPeerDiversity(s.config.LightMaxPerGroup, group)
+	if group != nil {
+		s.protocolManager.eclipse.group = group
+	}
+}
+
+// SubscribeEclipseRiskEvent registers a subscription of EclipseRiskEvent, sent
+// when an eclipse attack is suspected and when the risk is cleared.
+func (s *LightEtrue) SubscribeEclipseRiskEvent(ch chan<- EclipseRiskEvent) event.Subscription {
+	return s.protocolManager.eclipse.subscribe(ch)
+}
@@ -0,0 +1,53 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"testing"
+	"time"
+
+	"truechain/discovery/etrue"
+	"truechain/discovery/etruedb"
+	"truechain/discovery/light"
+	"truechain/discovery/light/fast"
+	"truechain/discovery/params"
+)
+
+// Tests that stopping the indexers of the light client returns, the bloom trie
+// indexer being closed through the bloom indexer it is a child of.
+func TestStopIndexers(t *testing.T) {
+	db := etruedb.NewMemDatabase()
+	leth := &LightEtrue{
+		lesCommons: lesCommons{
+			chtIndexer:       light.NewChtIndexer(db, nil, params.CHTFrequency, params.HelperTrieConfirmations),
+			bloomTrieIndexer: fast.NewBloomTrieIndexer(db, nil, params.BloomBitsBlocksClient, params.BloomTrieFrequency),
+		},
+		bloomIndexer: etrue.NewBloomIndexer(db, params.BloomBitsBlocksClient, params.HelperTrieConfirmations),
+	}
+	leth.bloomIndexer.AddChildIndexer(leth.bloomTrieIndexer)
+
+	done := make(chan struct{})
+	go func() {
+		leth.closeIndexers()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("closing the indexers blocked")
+	}
+}
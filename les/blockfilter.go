@@ -0,0 +1,242 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/bits"
+	"sort"
+
+	"truechain/discovery/common"
+	"truechain/discovery/core/rawdb"
+	"truechain/discovery/core/types"
+	"truechain/discovery/crypto"
+)
+
+// Compact block filters are Golomb-coded sets of the log addresses and topics
+// of a block, similar to the BIP158 filters of Neutrino. They are much smaller
+// than the header blooms for the same false positive rate, so a client can
+// download the filters of every block and scan them locally, only requesting
+// receipts of matching blocks.
+//
+// Filters are an experimental protocol extension: they are not committed to by
+// the headers, so a server may hide matches. Matching blocks are still checked
+// against the header bloom and the retrieved receipts are verified.
+const (
+	blockFilterP = 19     // Golomb-Rice coding parameter
+	blockFilterM = 784931 // inverse false positive rate
+
+	blockFilterCacheLimit = 4096 // number of filters cached by the server
+)
+
+var errInvalidBlockFilter = errors.New("invalid compact block filter")
+
+// blockFilterItems returns the distinct log addresses and topics of a block.
+func blockFilterItems(receipts types.Receipts) [][]byte {
+	var (
+		items [][]byte
+		seen  = make(map[string]struct{})
+	)
+	add := func(item []byte) {
+		if _, ok := seen[string(item)]; !ok {
+			seen[string(item)] = struct{}{}
+			items = append(items, item)
+		}
+	}
+	for _, receipt := range receipts {
+		for _, log := range receipt.Logs {
+			add(log.Address.Bytes())
+			for _, topic := range log.Topics {
+				add(topic.Bytes())
+			}
+		}
+	}
+	return items
+}
+
+// blockFilterValues maps the items into the range of a filter of n entries,
+// keyed by the block hash and sorted.
+func blockFilterValues(block common.Hash, n uint64, items [][]byte) []uint64 {
+	modulus := n * blockFilterM
+	values := make([]uint64, len(items))
+	for i, item := range items {
+		h := crypto.Keccak256(block[:16], item)
+		values[i], _ = bits.Mul64(binary.BigEndian.Uint64(h[:8]), modulus)
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	return values
+}
+
+// buildBlockFilter creates the compact filter of a block from its receipts.
+func buildBlockFilter(block common.Hash, receipts types.Receipts) []byte {
+	items := blockFilterItems(receipts)
+	n := uint64(len(items))
+
+	var w bitWriter
+	w.data = make([]byte, binary.MaxVarintLen64)
+	w.data = w.data[:binary.PutUvarint(w.data, n)]
+	w.n = uint(len(w.data)) * 8
+
+	var prev uint64
+	for _, value := range blockFilterValues(block, n, items) {
+		delta := value - prev
+		for q := delta >> blockFilterP; q > 0; q-- {
+			w.writeBit(true)
+		}
+		w.writeBit(false)
+		w.writeBits(delta, blockFilterP)
+		prev = value
+	}
+	return w.data
+}
+
+// blockFilter returns the compact filter of a canonical block, or nil if the
+// block or its receipts are unknown.
+func (s *LesServer) blockFilter(hash common.Hash) []byte {
+	if filter, ok := s.filterCache.Get(hash); ok {
+		return filter.([]byte)
+	}
+	number := rawdb.ReadHeaderNumber(s.chainDb, hash)
+	if number == nil {
+		return nil
+	}
+	receipts := rawdb.ReadReceipts(s.chainDb, hash, *number)
+	if receipts == nil {
+		if header := rawdb.ReadHeader(s.chainDb, hash, *number); header == nil || header.ReceiptHash != types.EmptyRootHash {
+			return nil
+		}
+	}
+	filter := buildBlockFilter(hash, receipts)
+	s.filterCache.Add(hash, filter)
+	return filter
+}
+
+// blockFilterMatch returns true if any of the items may be contained in the
+// filter. False positives are possible, false negatives are not.
+func blockFilterMatch(filter []byte, block common.Hash, items [][]byte) (bool, error) {
+	n, size := binary.Uvarint(filter)
+	if size <= 0 {
+		return false, errInvalidBlockFilter
+	}
+	if n == 0 || len(items) == 0 {
+		return false, nil
+	}
+	var (
+		targets = blockFilterValues(block, n, items)
+		r       = bitReader{data: filter[size:]}
+		value   uint64
+		next    int
+	)
+	for i := uint64(0); i < n; i++ {
+		delta, err := r.readGolomb()
+		if err != nil {
+			return false, err
+		}
+		value += delta
+		for next < len(targets) && targets[next] < value {
+			next++
+		}
+		if next == len(targets) {
+			return false, nil
+		}
+		if targets[next] == value {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// checkBlockFilter checks whether a filter received from the network can be
+// fully decoded.
+func checkBlockFilter(filter []byte) error {
+	n, size := binary.Uvarint(filter)
+	if size <= 0 {
+		return errInvalidBlockFilter
+	}
+	r := bitReader{data: filter[size:]}
+	for i := uint64(0); i < n; i++ {
+		if _, err := r.readGolomb(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bitWriter appends bits to a byte slice, most significant bit first.
+type bitWriter struct {
+	data []byte
+	n    uint // number of bits written
+}
+
+func (w *bitWriter) writeBit(bit bool) {
+	if w.n%8 == 0 {
+		w.data = append(w.data, 0)
+	}
+	if bit {
+		w.data[len(w.data)-1] |= 0x80 >> (w.n % 8)
+	}
+	w.n++
+}
+
+// writeBits writes the lowest count bits of v.
+func (w *bitWriter) writeBits(v uint64, count uint) {
+	for i := count; i > 0; i-- {
+		w.writeBit((v>>(i-1))&1 == 1)
+	}
+}
+
+// bitReader reads bits from a byte slice, most significant bit first.
+type bitReader struct {
+	data []byte
+	n    uint // number of bits read
+}
+
+func (r *bitReader) readBit() (bool, error) {
+	if r.n/8 >= uint(len(r.data)) {
+		return false, errInvalidBlockFilter
+	}
+	bit := r.data[r.n/8]&(0x80>>(r.n%8)) != 0
+	r.n++
+	return bit, nil
+}
+
+// readGolomb reads a single Golomb-Rice coded value.
+func (r *bitReader) readGolomb() (uint64, error) {
+	var q uint64
+	for {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		if !bit {
+			break
+		}
+		q++
+	}
+	v := q << blockFilterP
+	for i := blockFilterP - 1; i >= 0; i-- {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		if bit {
+			v |= 1 << uint(i)
+		}
+	}
+	return v, nil
+}
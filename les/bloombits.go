@@ -17,10 +17,12 @@
 package les
 
 import (
+	"context"
 	"time"
-	"truechain/discovery/light/fast"
 
 	"truechain/discovery/common/bitutil"
+	"truechain/discovery/core/rawdb"
+	"truechain/discovery/light/fast"
 )
 
 const (
@@ -54,7 +56,13 @@ func (etrue *LightEtrue) startBloomHandlers(sectionSize uint64) {
 				case request := <-etrue.bloomRequests:
 					task := <-request
 					task.Bitsets = make([][]byte, len(task.Sections))
-					compVectors, err := fast.GetBloomBits(task.Context, etrue.odr, task.Bit, task.Sections)
+					if etrue.loadShedder.overloaded() {
+						loadShedRejectMeter.Mark(1)
+						task.Error = errOverloaded
+						request <- task
+						continue
+					}
+					compVectors, err := etrue.bloomBits(task.Context, task.Bit, task.Sections)
 					if err == nil {
 						for i := range task.Sections {
 							if blob, err := bitutil.DecompressBytes(compVectors[i], int(sectionSize/8)); err == nil {
@@ -72,3 +80,36 @@ func (etrue *LightEtrue) startBloomHandlers(sectionSize uint64) {
 		}()
 	}
 }
+
+// bloomBits returns the compressed bloom bit vectors of the given sections. The
+// sections already processed by the local bloom indexer are read from the
+// database, the others are retrieved from the servers.
+func (etrue *LightEtrue) bloomBits(ctx context.Context, bit uint, sections []uint64) ([][]byte, error) {
+	var (
+		result  = make([][]byte, len(sections))
+		reqList []uint64
+		reqIdx  []int
+	)
+	indexed, _, _ := etrue.bloomIndexer.Sections()
+	for i, section := range sections {
+		if section < indexed {
+			if bits, err := rawdb.ReadBloomBits(etrue.chainDb, bit, section, etrue.bloomIndexer.SectionHead(section)); err == nil {
+				result[i] = bits
+				continue
+			}
+		}
+		reqList = append(reqList, section)
+		reqIdx = append(reqIdx, i)
+	}
+	if len(reqList) == 0 {
+		return result, nil
+	}
+	retrieved, err := fast.GetBloomBits(ctx, etrue.odr, bit, reqList)
+	if err != nil {
+		return nil, err
+	}
+	for i, idx := range reqIdx {
+		result[idx] = retrieved[i]
+	}
+	return result, nil
+}
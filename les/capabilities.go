@@ -0,0 +1,67 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+// Capabilities are optional protocol features negotiated in the handshake from
+// lpv3 on. A new request type or behaviour is added as a capability, and only
+// used with peers that announced it, so older peers keep working unchanged.
+const (
+	capTxStatusBatch  = "txStatusBatch"  // batched GetTxStatus requests
+	capFlowStop       = "flowStop"       // Stop/Resume flow control notifications
+	capNodeDedup      = "nodeDedup"      // omission of trie nodes already sent in the session
+	capCompactWitness = "compactWitness" // proofs sent as compact witnesses
+)
+
+// localCapabilities lists the capabilities supported by this node.
+var localCapabilities = []string{capTxStatusBatch, capFlowStop, capNodeDedup, capCompactWitness}
+
+// lpv2Capabilities are the capabilities implied by an lpv2 peer, which has no
+// capability negotiation.
+var lpv2Capabilities = []string{capTxStatusBatch, capFlowStop}
+
+// capabilitySet is the set of capabilities negotiated with a peer.
+type capabilitySet map[string]struct{}
+
+// negotiateCapabilities returns the capabilities supported by both sides.
+func negotiateCapabilities(announced, remote []string) capabilitySet {
+	local := make(map[string]bool, len(announced))
+	for _, c := range announced {
+		local[c] = true
+	}
+	caps := make(capabilitySet)
+	for _, c := range remote {
+		if local[c] {
+			caps[c] = struct{}{}
+		}
+	}
+	return caps
+}
+
+// has returns true if the capability was negotiated.
+func (s capabilitySet) has(c string) bool {
+	_, ok := s[c]
+	return ok
+}
+
+// list returns the negotiated capabilities.
+func (s capabilitySet) list() []string {
+	list := make([]string, 0, len(s))
+	for c := range s {
+		list = append(list, c)
+	}
+	return list
+}
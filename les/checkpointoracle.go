@@ -17,27 +17,64 @@
 package les
 
 import (
+	"context"
 	"encoding/binary"
+	"errors"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"truechain/discovery/accounts/abi/bind"
 	"truechain/discovery/common"
+	"truechain/discovery/common/mclock"
+	"truechain/discovery/contracts/checkpointoracle"
 	"truechain/discovery/crypto"
+	"truechain/discovery/etrue"
 	"truechain/discovery/log"
 	"truechain/discovery/params"
 )
 
+const (
+	// stableCheckpointCacheTime is the time the stable checkpoint announced by
+	// the server in handshakes is cached before looking it up in the contract.
+	stableCheckpointCacheTime = time.Minute
+
+	// checkpointLookupTimeout is the time allowed to look up the latest
+	// checkpoint and its votes in the contract.
+	checkpointLookupTimeout = 5 * time.Second
+)
+
+var errCheckpointUnapproved = errors.New("checkpoint not approved by enough trusted signers")
+
 // checkpointOracle is responsible for offering the latest stable checkpoint
 // generated and announced by the contract admins on-chain. The checkpoint is
 // verified by clients locally during the checkpoint syncing.
 type checkpointOracle struct {
-	config *params.CheckpointOracleConfig
+	config   *params.CheckpointOracleConfig
+	contract *checkpointoracle.CheckpointOracle
 
 	// Whether the contract backend is set.
 	running int32
 
-	getLocal     func(uint64, uint64) params.TrustedCheckpoint // Function used to retrieve local checkpoint
-	syncDoneHook func()                                        // Function used to notify that light syncing has completed.
+	getLocal      func(uint64, uint64) params.TrustedCheckpoint // Function used to retrieve local checkpoint
+	bloomSections func() uint64                                 // Function used to retrieve the number of local bloom trie sections
+	syncDoneHook  func()                                        // Function used to notify that light syncing has completed.
+
+	lock         sync.Mutex // protects the cached stable checkpoint and serialises client updates
+	stable       *params.TrustedCheckpoint
+	stableHeight uint64
+	stableTime   mclock.AbsTime
+}
+
+// checkpointOracleConfig returns the checkpoint oracle of the chain with the
+// given genesis hash. The built-in signer set of the known networks can be
+// overridden in the config, which is the only way to set one up for private
+// networks.
+func checkpointOracleConfig(config *etrue.Config, genesis common.Hash) *params.CheckpointOracleConfig {
+	if config.CheckpointOracle != nil {
+		return config.CheckpointOracle
+	}
+	return params.CheckpointOracles[genesis]
 }
 
 // newCheckpointOracle returns a checkpoint registrar handler.
@@ -46,7 +83,7 @@ func newCheckpointOracle(config *params.CheckpointOracleConfig, getLocal func(ui
 		log.Info("Checkpoint registrar is not enabled")
 		return nil
 	}
-	if config.Address == (common.Address{}) || uint64(len(config.Signers)) < config.Threshold {
+	if config.Address == (common.Address{}) || config.Threshold == 0 || uint64(len(config.Signers)) < config.Threshold {
 		log.Warn("Invalid checkpoint registrar config")
 		return nil
 	}
@@ -61,16 +98,16 @@ func newCheckpointOracle(config *params.CheckpointOracleConfig, getLocal func(ui
 // start binds the registrar contract and start listening to the
 // newCheckpointEvent for the server side.
 func (reg *checkpointOracle) start(backend bind.ContractBackend) {
-	//contract, err := checkpointoracle.NewCheckpointOracle(reg.config.Address, backend)
-	//if err != nil {
-	//	log.Error("Oracle contract binding failed", "err", err)
-	//	return
-	//}
-	//if !atomic.CompareAndSwapInt32(&reg.running, 0, 1) {
-	//	log.Error("Already bound and listening to registrar")
-	//	return
-	//}
-	//reg.contract = contract
+	contract, err := checkpointoracle.NewCheckpointOracle(reg.config.Address, backend)
+	if err != nil {
+		log.Error("Oracle contract binding failed", "err", err)
+		return
+	}
+	if !atomic.CompareAndSwapInt32(&reg.running, 0, 1) {
+		log.Error("Already bound and listening to registrar")
+		return
+	}
+	reg.contract = contract
 }
 
 // isRunning returns an indicator whether the registrar is running.
@@ -81,8 +118,71 @@ func (reg *checkpointOracle) isRunning() bool {
 // stableCheckpoint returns the stable checkpoint which was generated by local
 // indexers and announced by trusted signers.
 func (reg *checkpointOracle) stableCheckpoint() (*params.TrustedCheckpoint, uint64) {
+	reg.lock.Lock()
+	defer reg.lock.Unlock()
+
+	if reg.stableTime != 0 && time.Duration(mclock.Now()-reg.stableTime) < stableCheckpointCacheTime {
+		return reg.stable, reg.stableHeight
+	}
+	reg.stable, reg.stableHeight, reg.stableTime = nil, 0, mclock.Now()
+
 	// Retrieve the latest checkpoint from the contract, abort if empty
-	return nil, 0
+	ctx, cancel := context.WithTimeout(context.Background(), checkpointLookupTimeout)
+	defer cancel()
+	index, hash, height, err := reg.latestApproved(ctx)
+	if err != nil {
+		log.Debug("Failed to retrieve stable checkpoint", "err", err)
+		return nil, 0
+	}
+	// The checkpoint hash doesn't include the bloom trie section, look for the
+	// local one the registered bloom trie root was generated from.
+	for bIndex := reg.bloomSections(); bIndex > 0; bIndex-- {
+		if cp := reg.getLocal(index, bIndex-1); cp.HashEqual(hash) {
+			reg.stable, reg.stableHeight = &cp, height
+			break
+		}
+	}
+	return reg.stable, reg.stableHeight
+}
+
+// latestApproved returns the index, hash and registration block number of the
+// latest checkpoint registered in the contract, after checking that the votes
+// it was registered with were cast by enough signers of the configured set.
+func (reg *checkpointOracle) latestApproved(ctx context.Context) (uint64, common.Hash, uint64, error) {
+	index, hash, height, err := reg.contract.LatestCheckpoint(&bind.CallOpts{Context: ctx})
+	if err != nil {
+		return 0, common.Hash{}, 0, err
+	}
+	if hash == [32]byte{} {
+		return 0, common.Hash{}, 0, errNoCheckpoint
+	}
+	sigs, err := reg.contract.LookupVotes(ctx, index, hash, height.Uint64())
+	if err != nil {
+		return 0, common.Hash{}, 0, err
+	}
+	if approved, _ := reg.verifySigners(index, hash, sigs); !approved {
+		return 0, common.Hash{}, 0, errCheckpointUnapproved
+	}
+	return index, common.Hash(hash), height.Uint64(), nil
+}
+
+// checkpointSigningData returns the data a trusted signer signs to approve a
+// checkpoint in the oracle contract.
+//
+// EIP 191 style signatures
+//
+// Arguments when calculating hash to validate
+// 1: byte(0x19) - the initial 0x19 byte
+// 2: byte(0) - the version byte (data with intended validator)
+// 3: this - the validator address
+// --  Application specific data
+// 4 : checkpoint section_index (uint64)
+// 5 : checkpoint hash (bytes32)
+//     hash = keccak256(checkpoint_index, section_head, cht_root, bloom_root)
+func checkpointSigningData(oracle common.Address, index uint64, hash [32]byte) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, index)
+	return append([]byte{0x19, 0x00}, append(oracle.Bytes(), append(buf, hash[:]...)...)...)
 }
 
 // verifySigners recovers the signer addresses according to the signature and
@@ -100,21 +200,10 @@ func (reg *checkpointOracle) verifySigners(index uint64, hash [32]byte, signatur
 		if len(signatures[i]) != 65 {
 			continue
 		}
-		// EIP 191 style signatures
-		//
-		// Arguments when calculating hash to validate
-		// 1: byte(0x19) - the initial 0x19 byte
-		// 2: byte(0) - the version byte (data with intended validator)
-		// 3: this - the validator address
-		// --  Application specific data
-		// 4 : checkpoint section_index (uint64)
-		// 5 : checkpoint hash (bytes32)
-		//     hash = keccak256(checkpoint_index, section_head, cht_root, bloom_root)
-		buf := make([]byte, 8)
-		binary.BigEndian.PutUint64(buf, index)
-		data := append([]byte{0x19, 0x00}, append(reg.config.Address.Bytes(), append(buf, hash[:]...)...)...)
-		signatures[i][64] -= 27 // Transform V from 27/28 to 0/1 according to the yellow paper for verification.
-		pubkey, err := crypto.Ecrecover(crypto.Keccak256(data), signatures[i])
+		data := checkpointSigningData(reg.config.Address, index, hash)
+		sig := common.CopyBytes(signatures[i])
+		sig[64] -= 27 // Transform V from 27/28 to 0/1 according to the yellow paper for verification.
+		pubkey, err := crypto.Ecrecover(crypto.Keccak256(data), sig)
 		if err != nil {
 			return false, nil
 		}
@@ -123,11 +212,9 @@ func (reg *checkpointOracle) verifySigners(index uint64, hash [32]byte, signatur
 		if _, exist := checked[signer]; exist {
 			continue
 		}
-		for _, s := range reg.config.Signers {
-			if s == signer {
-				signers = append(signers, signer)
-				checked[signer] = struct{}{}
-			}
+		if reg.config.IsSigner(signer) {
+			signers = append(signers, signer)
+			checked[signer] = struct{}{}
 		}
 	}
 	threshold := reg.config.Threshold
@@ -137,3 +224,16 @@ func (reg *checkpointOracle) verifySigners(index uint64, hash [32]byte, signatur
 	}
 	return true, signers
 }
+
+// verifyCheckpoint checks whether the checkpoint update is approved by at least
+// threshold distinct signers of the configured admin set, returning them.
+func (reg *checkpointOracle) verifyCheckpoint(cp *params.TrustedCheckpoint, signatures [][]byte) ([]common.Address, error) {
+	if cp.Empty() {
+		return nil, errNoCheckpoint
+	}
+	approved, signers := reg.verifySigners(cp.SectionIndex, cp.Hash(), signatures)
+	if !approved {
+		return nil, errCheckpointUnapproved
+	}
+	return signers, nil
+}
@@ -0,0 +1,112 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+
+	"truechain/discovery/common"
+	"truechain/discovery/common/hexutil"
+	snaildb "truechain/discovery/core/snailchain/rawdb"
+	"truechain/discovery/etruedb"
+	"truechain/discovery/light"
+	"truechain/discovery/light/public"
+	"truechain/discovery/rlp"
+	"truechain/discovery/trie"
+)
+
+// CheckpointProof proves the head of a CHT section against the root of the
+// section's canonical hash trie, allowing to bootstrap from the section.
+type CheckpointProof struct {
+	SectionIndex hexutil.Uint64  `json:"sectionIndex"`
+	SectionHead  common.Hash     `json:"sectionHead"`
+	CHTRoot      common.Hash     `json:"chtRoot"`
+	Number       hexutil.Uint64  `json:"number"`
+	Td           *hexutil.Big    `json:"td"`
+	Header       hexutil.Bytes   `json:"header"` // RLP encoded section head
+	Proof        []hexutil.Bytes `json:"proof"`  // trie nodes from the root to the section head
+}
+
+// checkpointProof creates the proof of a processed CHT section. The server
+// proves it from the local trie, the client retrieves the proof from the
+// servers. Either way the proof is verified before it's returned.
+func (c *lesCommons) checkpointProof(ctx context.Context, index uint64) (*CheckpointProof, error) {
+	sectionHead := c.chtIndexer.SectionHead(index)
+	root := light.GetChtRoot(c.chainDb, index, sectionHead)
+	if sectionHead == (common.Hash{}) || root == (common.Hash{}) {
+		return nil, errNoCheckpoint
+	}
+	var (
+		number = (index+1)*c.iConfig.ChtSize - 1
+		key    [8]byte
+		nodes  *public.NodeSet
+		header []byte
+	)
+	binary.BigEndian.PutUint64(key[:], number)
+
+	if odr := c.protocolManager.odr; odr != nil {
+		r := &light.ChtRequest{ChtRoot: root, ChtNum: index, BlockNum: number, Config: c.iConfig}
+		if err := odr.Retrieve(ctx, r); err != nil {
+			return nil, err
+		}
+		nodes = r.Proof
+		header, _ = rlp.EncodeToBytes(r.Header)
+	} else {
+		t, err := trie.New(root, trie.NewDatabase(etruedb.NewTable(c.chainDb, light.ChtTablePrefix)))
+		if err != nil {
+			return nil, err
+		}
+		nodes = public.NewNodeSet()
+		if err := t.Prove(key[:], 0, nodes); err != nil {
+			return nil, err
+		}
+		header = snaildb.ReadHeaderRLP(c.chainDb, sectionHead, number)
+	}
+	// Verify the proof and the header against the checkpoint
+	value, _, err := trie.VerifyProof(root, key[:], nodes)
+	if err != nil {
+		return nil, fmt.Errorf("merkle proof verification failed: %v", err)
+	}
+	var node light.ChtNode
+	if err := rlp.DecodeBytes(value, &node); err != nil {
+		return nil, err
+	}
+	if node.Hash != sectionHead {
+		return nil, errCHTHashMismatch
+	}
+	head, err := decodeSnailHeader(c.protocolManager.chainConfig, number, header)
+	if err != nil {
+		return nil, errHeaderUnavailable
+	}
+	if head.Hash() != sectionHead {
+		return nil, errCHTHashMismatch
+	}
+	proof := &CheckpointProof{
+		SectionIndex: hexutil.Uint64(index),
+		SectionHead:  sectionHead,
+		CHTRoot:      root,
+		Number:       hexutil.Uint64(number),
+		Td:           (*hexutil.Big)(node.Td),
+		Header:       header,
+	}
+	for _, n := range nodes.NodeList() {
+		proof.Proof = append(proof.Proof, hexutil.Bytes(n))
+	}
+	return proof, nil
+}
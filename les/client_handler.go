@@ -0,0 +1,106 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"truechain/discovery/etrue/downloader"
+	"truechain/discovery/etrue/fastdownloader"
+	"truechain/discovery/event"
+	"truechain/discovery/log"
+	"truechain/discovery/params"
+)
+
+// disableClientRemovePeer keeps the downloaders from dropping misbehaving
+// servers, for debugging.
+const disableClientRemovePeer = false
+
+// clientOptions are the settings of the protocol manager specific to the light
+// client. Client features extend the options instead of the constructor.
+type clientOptions struct {
+	Checkpoint  *params.TrustedCheckpoint // hardcoded or configured trusted checkpoint, nil if none
+	ULCServers  []string                  // trusted servers of the ultra light client, nil if disabled
+	ULCFraction int                       // percentage of the trusted servers confirming a head
+	Odr         *LesOdr
+	ServerPool  *serverPool
+	Election    *Election
+
+	Roles            peerRoles       // servers with a restricted role, nil if none
+	NodeSession      int             // number of trie nodes remembered per session, see sessionLimit
+	AnnounceConfirms int             // servers announcing a head required before fetching it outside ULC mode
+	Capabilities     []string        // capabilities announced in the handshake, all if nil
+	Eclipse          *eclipseMonitor // nil if eclipse detection is disabled
+	SyncFeed         *event.Feed     // milestones of the header synchronisation, nil if not reported
+}
+
+// clientHandler is the protocol manager of a light client: the protocol
+// handling shared with the server, plus the downloaders and fetchers syncing
+// the chains from the servers.
+type clientHandler struct {
+	*ProtocolManager
+}
+
+// newClientHandler creates the protocol manager of a light client.
+func newClientHandler(config *handlerConfig, opts *clientOptions) *clientHandler {
+	h := &clientHandler{ProtocolManager: newProtocolManager(config)}
+	pm := h.ProtocolManager
+
+	pm.client = true
+	pm.checkpoint = opts.Checkpoint
+	pm.odr = opts.Odr
+	pm.serverPool = opts.ServerPool
+	pm.election = opts.Election
+	pm.roles = opts.Roles
+	pm.nodeSession = opts.NodeSession
+	pm.capabilities = opts.Capabilities
+	pm.eclipse = opts.Eclipse
+	pm.forkChoices = new(forkChoiceLog)
+	pm.syncFeed = opts.SyncFeed
+
+	if opts.Odr != nil {
+		pm.retriever = opts.Odr.retriever
+		pm.reqDist = opts.Odr.retriever.dist
+	}
+	if opts.ULCServers != nil {
+		ulc, err := newULC(opts.ULCServers, opts.ULCFraction)
+		if err != nil {
+			log.Warn("Failed to initialize ultra light client", "err", err)
+		} else {
+			pm.ulc = ulc
+		}
+	}
+	removePeer := pm.removePeer
+	if disableClientRemovePeer {
+		removePeer = func(id string, call uint32) {}
+	}
+	var checkpointNumber uint64
+	if opts.Checkpoint != nil {
+		checkpointNumber = (opts.Checkpoint.SectionIndex+1)*params.CHTFrequency - 1
+	}
+	mode := downloader.LightSync
+	fmode := fastdownloader.SyncMode(mode)
+	pm.fdownloader = fastdownloader.New(fmode, pm.chainDb, pm.eventMux, nil, pm.fblockchain, removePeer)
+	pm.downloader = downloader.New(mode, checkpointNumber, pm.chainDb, pm.eventMux, nil, pm.blockchain, removePeer, pm.fdownloader)
+	pm.peers.notify((*downloaderPeerNotify)(pm))
+	if opts.Eclipse != nil {
+		pm.peers.notify(opts.Eclipse)
+	}
+	pm.fastFetcher = newFastLightFetcher(pm)
+	pm.fetcher = newLightFetcher(pm)
+	pm.fetcher.setFastFetcher(pm.fastFetcher)
+	pm.fetcher.setAnnounceConfirms(opts.AnnounceConfirms)
+	return h
+}
@@ -379,6 +379,18 @@ func (f *clientPool) setLimits(count int, totalCap uint64) {
 	})
 }
 
+// capacity returns the free and the total capacity of the pool, announced to
+// the clients in the handshake.
+func (f *clientPool) capacity() (free, total uint64) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.connectedCapacity < f.capacityLimit {
+		free = f.capacityLimit - f.connectedCapacity
+	}
+	return free, f.capacityLimit
+}
+
 // logOffset calculates the time-dependent offset for the logarithmic
 // representation of negative balance
 func (f *clientPool) logOffset(now mclock.AbsTime) int64 {
@@ -17,6 +17,8 @@
 package les
 
 import (
+	"errors"
+	"fmt"
 	"math/big"
 	"truechain/discovery/core"
 	"truechain/discovery/core/snailchain"
@@ -24,14 +26,35 @@ import (
 	"truechain/discovery/light/public"
 
 	"truechain/discovery/common"
+	"truechain/discovery/common/hexutil"
+	"truechain/discovery/core/rawdb"
+	snailrawdb "truechain/discovery/core/snailchain/rawdb"
 	"truechain/discovery/etrue"
 	"truechain/discovery/etruedb"
 	"truechain/discovery/light"
+	"truechain/discovery/log"
 	"truechain/discovery/p2p"
 	"truechain/discovery/p2p/enode"
 	"truechain/discovery/params"
 )
 
+// checkNetworkId verifies that the network id matches the chain id of the chain
+// config. A mismatch is usually a misconfigured private network, which would
+// otherwise only surface later as peers or transactions being rejected.
+func checkNetworkId(chainConfig *params.ChainConfig, config *etrue.Config) error {
+	if chainConfig.ChainID == nil || chainConfig.ChainID.Sign() == 0 {
+		return nil
+	}
+	if chainConfig.ChainID.IsUint64() && chainConfig.ChainID.Uint64() == config.NetworkId {
+		return nil
+	}
+	if config.LightAllowIdMismatch {
+		log.Warn("Network id differs from chain id", "networkid", config.NetworkId, "chainid", chainConfig.ChainID)
+		return nil
+	}
+	return fmt.Errorf("network id %d differs from chain id %v of the genesis config (set --networkid or --light.allowidmismatch)", config.NetworkId, chainConfig.ChainID)
+}
+
 // lesCommons contains fields needed by both server and client.
 type lesCommons struct {
 	config           *etrue.Config
@@ -124,9 +147,73 @@ func (c *lesCommons) getLocalCheckpoint(index, bIndex uint64) params.TrustedChec
 	sectionHead := c.chtIndexer.SectionHead(index)
 	bloomHead := c.bloomTrieIndexer.SectionHead(bIndex)
 	return params.TrustedCheckpoint{
-		SectionIndex: index,
-		SectionHead:  sectionHead,
-		CHTRoot:      light.GetChtRoot(c.chainDb, index, sectionHead),
-		BloomRoot:    fast.GetBloomTrieRoot(c.chainDb, bIndex, bloomHead),
+		SectionIndex:  index,
+		SectionHead:   sectionHead,
+		CHTRoot:       light.GetChtRoot(c.chainDb, index, sectionHead),
+		SectionBIndex: bIndex,
+		SectionBHead:  bloomHead,
+		BloomRoot:     fast.GetBloomTrieRoot(c.chainDb, bIndex, bloomHead),
+	}
+}
+
+// ConfigCompat reports whether a proposed chain config can be applied to the
+// local chains. The fast chain is rewound to RewindTo on the next startup, the
+// snail headers past an incompatible snail fork no longer follow the config.
+type ConfigCompat struct {
+	Compatible bool        `json:"compatible"`
+	Fast       ChainCompat `json:"fast"`
+	Snail      ChainCompat `json:"snail"`
+}
+
+// ChainCompat is the compatibility of a proposed chain config with one chain.
+type ChainCompat struct {
+	Compatible   bool           `json:"compatible"`
+	Head         hexutil.Uint64 `json:"head"`
+	What         string         `json:"what,omitempty"`
+	StoredConfig *hexutil.Big   `json:"storedConfig,omitempty"` // fork block of the stored config
+	NewConfig    *hexutil.Big   `json:"newConfig,omitempty"`    // fork block of the proposed config
+	RewindTo     hexutil.Uint64 `json:"rewindTo,omitempty"`
+	Rewound      hexutil.Uint64 `json:"rewound,omitempty"` // number of blocks dropped by the rewind
+}
+
+// checkConfigCompat checks the proposed chain config against the stored one
+// the same way the genesis setup does on startup, without applying it.
+func (c *lesCommons) checkConfigCompat(newcfg *params.ChainConfig) (*ConfigCompat, error) {
+	stored := rawdb.ReadCanonicalHash(c.chainDb, 0)
+	storedcfg := rawdb.ReadChainConfig(c.chainDb, stored)
+	if storedcfg == nil {
+		return nil, errors.New("no stored chain config")
+	}
+	height := rawdb.ReadHeaderNumber(c.chainDb, rawdb.ReadHeadHeaderHash(c.chainDb))
+	if height == nil {
+		return nil, errors.New("missing block number for head header hash")
+	}
+	var snailHeight uint64
+	if number := snailrawdb.ReadHeaderNumber(c.chainDb, snailrawdb.ReadHeadHeaderHash(c.chainDb)); number != nil {
+		snailHeight = *number
+	}
+	res := &ConfigCompat{
+		Fast:  newChainCompat(*height, storedcfg.CheckCompatible(newcfg, *height)),
+		Snail: newChainCompat(snailHeight, storedcfg.CheckSnailCompatible(newcfg, snailHeight)),
+	}
+	res.Compatible = res.Fast.Compatible && res.Snail.Compatible
+	return res, nil
+}
+
+// newChainCompat converts the lowest compatibility error of a chain at the given
+// height. Errors at the genesis are ignored, as they are on startup.
+func newChainCompat(height uint64, compatErr *params.ConfigCompatError) ChainCompat {
+	res := ChainCompat{Compatible: true, Head: hexutil.Uint64(height)}
+	if compatErr == nil || height == 0 || compatErr.RewindTo == 0 {
+		return res
+	}
+	res.Compatible = false
+	res.What = compatErr.What
+	res.StoredConfig = (*hexutil.Big)(compatErr.StoredConfig)
+	res.NewConfig = (*hexutil.Big)(compatErr.NewConfig)
+	res.RewindTo = hexutil.Uint64(compatErr.RewindTo)
+	if compatErr.RewindTo < height {
+		res.Rewound = hexutil.Uint64(height - compatErr.RewindTo)
 	}
+	return res
 }
@@ -0,0 +1,64 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"math/big"
+	"testing"
+
+	"truechain/discovery/core/rawdb"
+	"truechain/discovery/etruedb"
+	"truechain/discovery/params"
+)
+
+// Tests that the config pre-flight check reports the rewind of a passed fast
+// fork that is rescheduled, and nothing for a fork added ahead of the head.
+func TestCheckConfigCompat(t *testing.T) {
+	db := etruedb.NewMemDatabase()
+	headers := makeRewindChain(db, 50)
+	stored := &params.ChainConfig{ChainID: big.NewInt(1), TIP7: &params.BlockConfig{FastNumber: big.NewInt(30)}}
+	rawdb.WriteChainConfig(db, headers[0].Hash(), stored)
+	c := &lesCommons{chainDb: db}
+
+	ahead := &params.ChainConfig{
+		ChainID: big.NewInt(1),
+		TIP7:    &params.BlockConfig{FastNumber: big.NewInt(30)},
+		TIP11:   &params.BlockConfig{FastNumber: big.NewInt(100)},
+	}
+	res, err := c.checkConfigCompat(ahead)
+	if err != nil {
+		t.Fatalf("failed to check config: %v", err)
+	}
+	if !res.Compatible || res.Fast.Head != 49 {
+		t.Fatalf("fork ahead of the head reported incompatible: %+v", res)
+	}
+
+	moved := &params.ChainConfig{ChainID: big.NewInt(1), TIP7: &params.BlockConfig{FastNumber: big.NewInt(40)}}
+	res, err = c.checkConfigCompat(moved)
+	if err != nil {
+		t.Fatalf("failed to check config: %v", err)
+	}
+	if res.Compatible || res.Fast.Compatible {
+		t.Fatalf("rescheduled passed fork reported compatible: %+v", res)
+	}
+	if res.Fast.RewindTo != 29 || res.Fast.Rewound != 20 {
+		t.Errorf("rewind mismatch: have %d (%d dropped), want 29 (20 dropped)", res.Fast.RewindTo, res.Fast.Rewound)
+	}
+	if !res.Snail.Compatible {
+		t.Errorf("snail chain without headers reported incompatible: %+v", res.Snail)
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"context"
+
+	"truechain/discovery/common"
+	"truechain/discovery/common/hexutil"
+	"truechain/discovery/core/rawdb"
+	"truechain/discovery/core/types"
+	"truechain/discovery/light/fast"
+	"truechain/discovery/log"
+)
+
+// confirmHeadChanSize is the size of channel listening to FastChainHeadEvent
+// while waiting for confirmations.
+const confirmHeadChanSize = 10
+
+// PublicConfirmationAPI provides an API to wait for transactions to be
+// confirmed on the fast light chain.
+type PublicConfirmationAPI struct {
+	client *LightEtrue
+}
+
+// NewPublicConfirmationAPI creates a new confirmation tracker API.
+func NewPublicConfirmationAPI(client *LightEtrue) *PublicConfirmationAPI {
+	return &PublicConfirmationAPI{client: client}
+}
+
+// TxConfirmation is the position of a confirmed transaction.
+type TxConfirmation struct {
+	BlockHash     common.Hash    `json:"blockHash"`
+	BlockNumber   hexutil.Uint64 `json:"blockNumber"`
+	Confirmations hexutil.Uint64 `json:"confirmations"`
+}
+
+// WaitForConfirmations blocks until the given transaction is included in the
+// canonical fast chain with at least the requested number of confirmations
+// (the including block counts as the first one). Inclusion is verified against
+// the locally validated headers and re-checked whenever the chain is reorged,
+// so the call only returns for a position that is canonical at that moment.
+func (api *PublicConfirmationAPI) WaitForConfirmations(ctx context.Context, hash common.Hash, confirmations hexutil.Uint64) (*TxConfirmation, error) {
+	var (
+		chain  = api.client.fblockchain
+		db     = api.client.chainDb
+		headCh = make(chan types.FastChainHeadEvent, confirmHeadChanSize)
+	)
+	sub := chain.SubscribeChainHeadEvent(headCh)
+	defer sub.Unsubscribe()
+
+	var (
+		blockHash   common.Hash
+		blockNumber uint64
+	)
+	for {
+		// Look up the transaction again if it's not known or has been reorged
+		if blockHash == (common.Hash{}) || rawdb.ReadCanonicalHash(db, blockNumber) != blockHash {
+			tx, bhash, bnumber, _, err := fast.GetTransaction(ctx, api.client.odr, hash)
+			switch {
+			case err != nil && ctx.Err() != nil:
+				return nil, ctx.Err()
+			case err != nil:
+				log.Debug("Failed to look up awaited transaction", "hash", hash, "err", err)
+				blockHash = common.Hash{}
+			case tx == nil:
+				blockHash = common.Hash{}
+			default:
+				blockHash, blockNumber = bhash, bnumber
+			}
+		}
+		if blockHash != (common.Hash{}) {
+			if head := chain.CurrentHeader().Number.Uint64(); head >= blockNumber && head-blockNumber+1 >= uint64(confirmations) {
+				return &TxConfirmation{
+					BlockHash:     blockHash,
+					BlockNumber:   hexutil.Uint64(blockNumber),
+					Confirmations: hexutil.Uint64(head - blockNumber + 1),
+				}, nil
+			}
+		}
+		select {
+		case <-headCh:
+		case err := <-sub.Err():
+			return nil, err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
@@ -32,65 +32,7 @@ import (
 
 const makeCostStats = false // make request cost statistics during operation
 
-var (
-	// average request cost estimates based on serving time
-	reqAvgTimeCost = requestCostTable{
-		GetFastBlockHeadersMsg:  {150000, 30000},
-		GetFastBlockBodiesMsg:   {0, 700000},
-		GetSnailBlockHeadersMsg: {150000, 30000},
-		GetSnailBlockBodiesMsg:  {0, 7000000},
-		GetFruitBodiesMsg:       {0, 700000},
-		GetReceiptsMsg:          {0, 1000000},
-		GetCodeMsg:              {0, 450000},
-		GetProofsV2Msg:          {0, 600000},
-		GetHelperTrieProofsMsg:  {0, 1000000},
-		SendTxV2Msg:             {0, 450000},
-		GetTxStatusMsg:          {0, 250000},
-	}
-	// maximum incoming message size estimates
-	reqMaxInSize = requestCostTable{
-		GetFastBlockHeadersMsg:  {40, 0},
-		GetFastBlockBodiesMsg:   {0, 40},
-		GetSnailBlockHeadersMsg: {40, 0},
-		GetSnailBlockBodiesMsg:  {0, 400},
-		GetFruitBodiesMsg:       {0, 40},
-		GetReceiptsMsg:          {0, 40},
-		GetCodeMsg:              {0, 80},
-		GetProofsV2Msg:          {0, 80},
-		GetHelperTrieProofsMsg:  {0, 20},
-		SendTxV2Msg:             {0, 16500},
-		GetTxStatusMsg:          {0, 50},
-	}
-	// maximum outgoing message size estimates
-	reqMaxOutSize = requestCostTable{
-		GetFastBlockHeadersMsg:  {0, 556},
-		GetFastBlockBodiesMsg:   {0, 100000},
-		GetSnailBlockHeadersMsg: {0, 556},
-		GetSnailBlockBodiesMsg:  {0, 1000000},
-		GetFruitBodiesMsg:       {0, 100000},
-		GetReceiptsMsg:          {0, 200000},
-		GetCodeMsg:              {0, 50000},
-		GetProofsV2Msg:          {0, 4000},
-		GetHelperTrieProofsMsg:  {0, 4000},
-		SendTxV2Msg:             {0, 100},
-		GetTxStatusMsg:          {0, 100},
-	}
-	// request amounts that have to fit into the minimum buffer size minBufferMultiplier times
-	minBufferReqAmount = map[uint64]uint64{
-		GetFastBlockHeadersMsg:  192,
-		GetFastBlockBodiesMsg:   1,
-		GetSnailBlockHeadersMsg: 192,
-		GetSnailBlockBodiesMsg:  128,
-		GetFruitBodiesMsg:       1,
-		GetReceiptsMsg:          1,
-		GetCodeMsg:              1,
-		GetProofsV2Msg:          1,
-		GetHelperTrieProofsMsg:  16,
-		SendTxV2Msg:             8,
-		GetTxStatusMsg:          64,
-	}
-	minBufferMultiplier = 3
-)
+var minBufferMultiplier = 3
 
 const (
 	maxCostFactor    = 2 // ratio of maximum and average cost estimates
@@ -0,0 +1,137 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"truechain/discovery/common"
+	"truechain/discovery/metrics"
+)
+
+// Dashboard is a consolidated snapshot of the light client state, meant to
+// back a simple web dashboard with a single request.
+type Dashboard struct {
+	Peers     []DashboardPeer             `json:"peers"`
+	Sync      DashboardSync               `json:"sync"`
+	Indexers  map[string]DashboardIndexer `json:"indexers"`
+	Caches    map[string]int              `json:"caches"`
+	Relay     DashboardRelay              `json:"relay"`
+	Bandwidth DashboardBandwidth          `json:"bandwidth"`
+}
+
+// DashboardPeer is the state of a single connected server.
+type DashboardPeer struct {
+	ID         string      `json:"id"`
+	Version    int         `json:"version"`
+	Trusted    bool        `json:"trusted"`
+	Onion      bool        `json:"onion"`
+	Role       string      `json:"role"`
+	Head       common.Hash `json:"head"`
+	Number     uint64      `json:"number"`
+	FastNumber uint64      `json:"fastNumber"`
+}
+
+// DashboardSync is the progress of the chain synchronisation.
+type DashboardSync struct {
+	Syncing            bool   `json:"syncing"`
+	StartingFastBlock  uint64 `json:"startingFastBlock"`
+	CurrentFastBlock   uint64 `json:"currentFastBlock"`
+	HighestFastBlock   uint64 `json:"highestFastBlock"`
+	StartingSnailBlock uint64 `json:"startingSnailBlock"`
+	CurrentSnailBlock  uint64 `json:"currentSnailBlock"`
+	HighestSnailBlock  uint64 `json:"highestSnailBlock"`
+	FastHead           uint64 `json:"fastHead"`
+	SnailHead          uint64 `json:"snailHead"`
+}
+
+// DashboardIndexer is the progress of a chain indexer.
+type DashboardIndexer struct {
+	Sections uint64      `json:"sections"`
+	Head     uint64      `json:"head"`
+	HeadHash common.Hash `json:"headHash"`
+}
+
+// DashboardRelay is the state of the transaction relay.
+type DashboardRelay struct {
+	Sent    int `json:"sent"`
+	Pending int `json:"pending"`
+}
+
+// DashboardBandwidth is the LES traffic since startup. It is only accounted if
+// metrics collection is enabled.
+type DashboardBandwidth struct {
+	Metered    bool    `json:"metered"`
+	InPackets  int64   `json:"inPackets"`
+	InBytes    int64   `json:"inBytes"`
+	InRate     float64 `json:"inRate"` // bytes per second, one minute moving average
+	OutPackets int64   `json:"outPackets"`
+	OutBytes   int64   `json:"outBytes"`
+	OutRate    float64 `json:"outRate"` // bytes per second, one minute moving average
+}
+
+// dashboard collects the current dashboard snapshot.
+func (s *LightEtrue) dashboard() *Dashboard {
+	d := &Dashboard{
+		Peers:    []DashboardPeer{},
+		Indexers: make(map[string]DashboardIndexer),
+		Caches:   make(map[string]int),
+	}
+	for _, p := range s.peers.AllPeers() {
+		head := p.headBlockInfo()
+		d.Peers = append(d.Peers, DashboardPeer{
+			ID:         p.id,
+			Version:    p.version,
+			Trusted:    p.trusted,
+			Onion:      p.onion,
+			Role:       p.role.String(),
+			Head:       head.Hash,
+			Number:     head.Number,
+			FastNumber: head.FastNumber,
+		})
+	}
+	progress := s.protocolManager.downloader.Progress()
+	d.Sync = DashboardSync{
+		Syncing:            progress.CurrentFastBlock < progress.HighestFastBlock || progress.CurrentSnailBlock < progress.HighestSnailBlock,
+		StartingFastBlock:  progress.StartingFastBlock,
+		CurrentFastBlock:   progress.CurrentFastBlock,
+		HighestFastBlock:   progress.HighestFastBlock,
+		StartingSnailBlock: progress.StartingSnailBlock,
+		CurrentSnailBlock:  progress.CurrentSnailBlock,
+		HighestSnailBlock:  progress.HighestSnailBlock,
+		FastHead:           s.fblockchain.CurrentHeader().Number.Uint64(),
+		SnailHead:          s.blockchain.CurrentHeader().Number.Uint64(),
+	}
+	sections, head, hash := s.chtIndexer.Sections()
+	d.Indexers["cht"] = DashboardIndexer{Sections: sections, Head: head, HeadHash: hash}
+	sections, head, hash = s.bloomTrieIndexer.Sections()
+	d.Indexers["bloomTrie"] = DashboardIndexer{Sections: sections, Head: head, HeadHash: hash}
+
+	bodies, bodyRLPs, blocks := s.fblockchain.CacheSizes()
+	d.Caches["bodies"], d.Caches["bodyRLPs"], d.Caches["blocks"] = bodies, bodyRLPs, blocks
+
+	d.Relay.Sent, d.Relay.Pending = s.relay.stats()
+
+	d.Bandwidth = DashboardBandwidth{
+		Metered:    metrics.Enabled,
+		InPackets:  miscInPacketsMeter.Count(),
+		InBytes:    miscInTrafficMeter.Count(),
+		InRate:     miscInTrafficMeter.Rate1(),
+		OutPackets: miscOutPacketsMeter.Count(),
+		OutBytes:   miscOutTrafficMeter.Count(),
+		OutRate:    miscOutTrafficMeter.Rate1(),
+	}
+	return d
+}
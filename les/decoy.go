@@ -0,0 +1,129 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"bytes"
+	"crypto/rand"
+	mrand "math/rand"
+	"sync"
+
+	"truechain/discovery/core/types"
+	"truechain/discovery/crypto"
+	"truechain/discovery/light/fast"
+	"truechain/discovery/rlp"
+)
+
+// decoyPoolSize is the number of account keys remembered as decoy candidates.
+const decoyPoolSize = 1024
+
+// decoyPool collects the keys of accounts seen on the chain (transaction
+// recipients and log emitters of retrieved blocks) and bundles some of them
+// with every account proof request, so servers can't tell which of the
+// requested accounts the client is interested in. Random keys are used until
+// enough real accounts have been seen; those are likely absent from the state
+// and therefore weaker decoys.
+type decoyPool struct {
+	count int // number of decoys bundled with each request
+
+	lock sync.Mutex
+	keys [][]byte
+	next int // position of the next overwritten key once the pool is full
+}
+
+// newDecoyPool creates a decoy pool bundling count decoys with each request. It
+// returns nil if count is not positive.
+func newDecoyPool(count int) *decoyPool {
+	if count <= 0 {
+		return nil
+	}
+	return &decoyPool{count: count}
+}
+
+// add remembers an account key as a decoy candidate.
+func (d *decoyPool) add(key []byte) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if len(d.keys) < decoyPoolSize {
+		d.keys = append(d.keys, key)
+		return
+	}
+	d.keys[d.next] = key
+	d.next = (d.next + 1) % decoyPoolSize
+}
+
+// pick returns count decoy keys different from the given key.
+func (d *decoyPool) pick(key []byte) [][]byte {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	decoys := make([][]byte, 0, d.count)
+	if len(d.keys) > d.count {
+		for _, i := range mrand.Perm(len(d.keys)) {
+			if len(decoys) == d.count {
+				break
+			}
+			if !bytes.Equal(d.keys[i], key) {
+				decoys = append(decoys, d.keys[i])
+			}
+		}
+	}
+	for len(decoys) < d.count {
+		random := make([]byte, 32)
+		rand.Read(random)
+		decoys = append(decoys, random)
+	}
+	return decoys
+}
+
+// bundle adds decoys to account proof requests. Storage proofs are left alone,
+// their account is revealed by the request anyway.
+func (d *decoyPool) bundle(req fast.OdrRequest) {
+	if d == nil {
+		return
+	}
+	if r, ok := req.(*fast.TrieRequest); ok && r.Id.AccKey == nil && r.Decoys == nil {
+		r.Decoys = d.pick(r.Key)
+	}
+}
+
+// collect feeds the accounts found in a retrieved block body or receipts into
+// the pool.
+func (d *decoyPool) collect(req fast.OdrRequest) {
+	if d == nil {
+		return
+	}
+	switch r := req.(type) {
+	case *fast.BlockRequest:
+		var body types.Body
+		if rlp.DecodeBytes(r.Rlp, &body) != nil {
+			return
+		}
+		for _, tx := range body.Transactions {
+			if to := tx.To(); to != nil {
+				d.add(crypto.Keccak256(to.Bytes()))
+			}
+		}
+	case *fast.ReceiptsRequest:
+		for _, receipt := range r.Receipts {
+			for _, log := range receipt.Logs {
+				d.add(crypto.Keccak256(log.Address.Bytes()))
+			}
+		}
+	}
+}
@@ -0,0 +1,460 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"truechain/discovery/common"
+	"truechain/discovery/common/hexutil"
+	"truechain/discovery/core/types"
+	"truechain/discovery/crypto"
+	"truechain/discovery/etruedb"
+	"truechain/discovery/event"
+	"truechain/discovery/light/fast"
+	"truechain/discovery/log"
+	"truechain/discovery/rlp"
+)
+
+const (
+	depositChanSize     = 10
+	depositFetchChunk   = 16               // blocks whose data is retrieved concurrently
+	depositBatchLimit   = 1024             // notification batches kept until polled
+	depositFetchTimeout = time.Minute      // time limit of retrieving a chunk of blocks
+	depositPostTimeout  = time.Second * 10 // time limit of delivering a batch to the webhook
+)
+
+var (
+	// depositWatchKey stores the watched deposit addresses and depositNextKey
+	// the first block not scanned yet, so that no deposit is missed across
+	// restarts.
+	depositWatchKey = []byte("LightDepositWatch")
+	depositNextKey  = []byte("LightDepositNext")
+
+	// transferTopic is the topic of the token Transfer(address,address,uint256) event.
+	transferTopic = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+)
+
+// Deposit is a transfer to a watched address, either of the native currency
+// by a transaction or of a token by a Transfer event. Transfers made by
+// internal calls of contracts are not detected.
+type Deposit struct {
+	Address     common.Address  `json:"address"`
+	Token       *common.Address `json:"token"` // nil for native transfers
+	From        common.Address  `json:"from"`
+	Value       *hexutil.Big    `json:"value"`
+	TxHash      common.Hash     `json:"txHash"`
+	BlockHash   common.Hash     `json:"blockHash"`
+	BlockNumber uint64          `json:"blockNumber"`
+}
+
+// DepositBatch is the notification of the deposits found in a block range.
+type DepositBatch struct {
+	From     uint64    `json:"from"`
+	To       uint64    `json:"to"`
+	Deposits []Deposit `json:"deposits"`
+}
+
+// DepositWatchStatus describes the state of the deposit watcher.
+type DepositWatchStatus struct {
+	Addresses int    `json:"addresses"`
+	Next      uint64 `json:"next"`    // first block not scanned yet
+	Pending   int    `json:"pending"` // notification batches waiting to be polled
+}
+
+// bloomPositions are the bits set in a header bloom by a value, precomputed so
+// that testing a header against thousands of addresses is cheap.
+type bloomPositions [3]uint
+
+func newBloomPositions(value []byte) bloomPositions {
+	var (
+		pos  bloomPositions
+		hash = crypto.Keccak256(value)
+	)
+	for i := range pos {
+		pos[i] = (uint(hash[2*i+1]) + uint(hash[2*i])<<8) & 2047
+	}
+	return pos
+}
+
+// in returns true if all bits of the value are set in the bloom.
+func (pos bloomPositions) in(bloom types.Bloom) bool {
+	for _, bit := range pos {
+		if bloom[types.BloomByteLength-1-bit/8]&(1<<(bit%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// depositWatcher scans every new block for deposits to a large set of watched
+// addresses. The block bodies are retrieved once for all addresses, receipts
+// only for the blocks with a native transfer to a watched address or whose
+// bloom matches a watched address as a token transfer recipient. The deposits
+// are batched per scanned range and polled or posted to a webhook.
+type depositWatcher struct {
+	db     etruedb.Database
+	chain  *fast.LightChain
+	odr    fast.OdrBackend
+	signer types.Signer
+	url    string
+	client *http.Client
+
+	lock    sync.Mutex
+	addrs   map[common.Address]bloomPositions // positions of the address as an event topic
+	next    uint64                            // first block not scanned, 0 if nothing is watched yet
+	batches []DepositBatch
+
+	headCh chan types.FastChainHeadEvent
+	sub    event.Subscription
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     *sync.WaitGroup // tracks the scanning loop of the light client
+}
+
+// newDepositWatcher creates the deposit watcher, loading the addresses watched
+// before the last shutdown.
+func newDepositWatcher(db etruedb.Database, chain *fast.LightChain, signer types.Signer, url string, wg *sync.WaitGroup) *depositWatcher {
+	w := &depositWatcher{
+		db:     db,
+		chain:  chain,
+		odr:    chain.Odr(),
+		signer: signer,
+		url:    url,
+		client: &http.Client{Timeout: depositPostTimeout},
+		addrs:  make(map[common.Address]bloomPositions),
+		headCh: make(chan types.FastChainHeadEvent, depositChanSize),
+		wg:     wg,
+	}
+	if enc, err := db.Get(depositWatchKey); err == nil {
+		var addrs []common.Address
+		if err := rlp.DecodeBytes(enc, &addrs); err != nil {
+			log.Error("Failed to decode watched deposit addresses", "err", err)
+		}
+		for _, addr := range addrs {
+			w.addrs[addr] = newBloomPositions(addr.Hash().Bytes())
+		}
+	}
+	if enc, err := db.Get(depositNextKey); err == nil && len(w.addrs) > 0 {
+		w.next = new(big.Int).SetBytes(enc).Uint64()
+		log.Info("Loaded watched deposit addresses", "count", len(w.addrs), "next", w.next)
+	}
+	return w
+}
+
+// start starts scanning the new heads.
+func (w *depositWatcher) start() {
+	w.ctx, w.cancel = context.WithCancel(context.Background())
+	w.sub = w.chain.SubscribeChainHeadEvent(w.headCh)
+	w.wg.Add(1)
+	go w.loop()
+}
+
+// stop stops scanning, the progress is kept in the database.
+func (w *depositWatcher) stop() {
+	w.sub.Unsubscribe()
+	w.cancel()
+}
+
+func (w *depositWatcher) loop() {
+	defer w.wg.Done()
+
+	for {
+		select {
+		case ev := <-w.headCh:
+			w.scan(ev.Block.NumberU64())
+		case <-w.ctx.Done():
+			return
+		}
+	}
+}
+
+// watch adds addresses to the watched set, returning the number of new ones.
+// Blocks are scanned for them from the next head on.
+func (w *depositWatcher) watch(addrs []common.Address) int {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	added := 0
+	for _, addr := range addrs {
+		if _, ok := w.addrs[addr]; !ok {
+			w.addrs[addr] = newBloomPositions(addr.Hash().Bytes())
+			added++
+		}
+	}
+	if w.next == 0 && len(w.addrs) > 0 {
+		w.next = w.chain.CurrentHeader().Number.Uint64() + 1
+		w.storeNext()
+	}
+	w.storeAddrs()
+	return added
+}
+
+// unwatch removes addresses from the watched set, returning the number of
+// removed ones.
+func (w *depositWatcher) unwatch(addrs []common.Address) int {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	removed := 0
+	for _, addr := range addrs {
+		if _, ok := w.addrs[addr]; ok {
+			delete(w.addrs, addr)
+			removed++
+		}
+	}
+	if len(w.addrs) == 0 {
+		// Don't scan the blocks passed while nothing was watched
+		w.next = 0
+		w.storeNext()
+	}
+	w.storeAddrs()
+	return removed
+}
+
+// status returns the state of the watcher.
+func (w *depositWatcher) status() *DepositWatchStatus {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return &DepositWatchStatus{Addresses: len(w.addrs), Next: w.next, Pending: len(w.batches)}
+}
+
+// poll returns and drops the pending notification batches.
+func (w *depositWatcher) poll() []DepositBatch {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	batches := w.batches
+	w.batches = nil
+	return batches
+}
+
+// scan scans the blocks up to the given head in chunks, notifying the deposits
+// found in each chunk. Scanning stops at the first block which couldn't be
+// retrieved, it is retried on the next head.
+func (w *depositWatcher) scan(head uint64) {
+	for {
+		w.lock.Lock()
+		from := w.next
+		if len(w.addrs) == 0 || from == 0 || from > head {
+			w.lock.Unlock()
+			return
+		}
+		to := from + depositFetchChunk - 1
+		if to > head {
+			to = head
+		}
+		w.lock.Unlock()
+
+		deposits, err := w.scanRange(from, to)
+		if err != nil {
+			log.Debug("Failed to scan blocks for deposits", "from", from, "to", to, "err", err)
+			return
+		}
+		batch := DepositBatch{From: from, To: to, Deposits: deposits}
+
+		w.lock.Lock()
+		if w.next != from {
+			// Everything was unwatched meanwhile
+			w.lock.Unlock()
+			return
+		}
+		w.next = to + 1
+		w.storeNext()
+		if len(deposits) > 0 {
+			if len(w.batches) == depositBatchLimit {
+				w.batches = w.batches[1:]
+				eventDroppedMeter.Mark(1)
+			}
+			w.batches = append(w.batches, batch)
+		}
+		w.lock.Unlock()
+
+		if len(deposits) > 0 {
+			log.Info("Found deposits", "from", from, "to", to, "count", len(deposits))
+			w.post(batch)
+		}
+	}
+}
+
+// scanRange retrieves the blocks of the range concurrently and returns the
+// deposits to the watched addresses, ordered by block.
+func (w *depositWatcher) scanRange(from, to uint64) ([]Deposit, error) {
+	ctx, cancel := context.WithTimeout(w.ctx, depositFetchTimeout)
+	defer cancel()
+
+	var (
+		wg      sync.WaitGroup
+		results = make([][]Deposit, to-from+1)
+		errs    = make([]error, to-from+1)
+	)
+	for number := from; number <= to; number++ {
+		wg.Add(1)
+		go func(i int, number uint64) {
+			defer wg.Done()
+			results[i], errs[i] = w.scanBlock(ctx, number)
+		}(int(number-from), number)
+	}
+	wg.Wait()
+
+	var deposits []Deposit
+	for i, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+		deposits = append(deposits, results[i]...)
+	}
+	return deposits, nil
+}
+
+// scanBlock returns the deposits to the watched addresses in a single block.
+func (w *depositWatcher) scanBlock(ctx context.Context, number uint64) ([]Deposit, error) {
+	header, err := w.chain.GetHeaderByNumberOdr(ctx, number)
+	if err != nil {
+		return nil, err
+	}
+	hash := header.Hash()
+	body, err := fast.GetBody(ctx, w.odr, hash, number)
+	if err != nil {
+		return nil, err
+	}
+	// Find the candidates without holding the lock during the retrievals
+	w.lock.Lock()
+	var native []int
+	for i, tx := range body.Transactions {
+		if to := tx.To(); to != nil && tx.Value().Sign() > 0 {
+			if _, ok := w.addrs[*to]; ok {
+				native = append(native, i)
+			}
+		}
+	}
+	tokens := false
+	for _, pos := range w.addrs {
+		if pos.in(header.Bloom) {
+			tokens = true
+			break
+		}
+	}
+	w.lock.Unlock()
+
+	if len(native) == 0 && !tokens {
+		return nil, nil
+	}
+	receipts, err := fast.GetBlockReceipts(ctx, w.odr, hash, number)
+	if err != nil {
+		return nil, err
+	}
+	var deposits []Deposit
+	for _, i := range native {
+		tx := body.Transactions[i]
+		if i >= len(receipts) || receipts[i].Status != types.ReceiptStatusSuccessful {
+			continue
+		}
+		from, err := types.Sender(w.signer, tx)
+		if err != nil {
+			continue
+		}
+		deposits = append(deposits, Deposit{
+			Address:     *tx.To(),
+			From:        from,
+			Value:       (*hexutil.Big)(tx.Value()),
+			TxHash:      tx.Hash(),
+			BlockHash:   hash,
+			BlockNumber: number,
+		})
+	}
+	if tokens {
+		w.lock.Lock()
+		for _, receipt := range receipts {
+			for _, l := range receipt.Logs {
+				if len(l.Topics) != 3 || l.Topics[0] != transferTopic || len(l.Data) != 32 {
+					continue
+				}
+				to := common.BytesToAddress(l.Topics[2].Bytes())
+				if _, ok := w.addrs[to]; !ok {
+					continue
+				}
+				token := l.Address
+				deposits = append(deposits, Deposit{
+					Address:     to,
+					Token:       &token,
+					From:        common.BytesToAddress(l.Topics[1].Bytes()),
+					Value:       (*hexutil.Big)(new(big.Int).SetBytes(l.Data)),
+					TxHash:      l.TxHash,
+					BlockHash:   hash,
+					BlockNumber: number,
+				})
+			}
+		}
+		w.lock.Unlock()
+	}
+	return deposits, nil
+}
+
+// post delivers a batch to the webhook if configured. Delivery is not retried,
+// the batch can still be polled.
+func (w *depositWatcher) post(batch DepositBatch) {
+	if w.url == "" {
+		return
+	}
+	body, err := json.Marshal(batch)
+	if err != nil {
+		log.Error("Failed to encode deposit batch", "err", err)
+		return
+	}
+	resp, err := w.client.Post(w.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Warn("Failed to deliver deposit batch", "from", batch.From, "to", batch.To, "err", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		log.Warn("Deposit batch rejected by webhook", "from", batch.From, "to", batch.To, "status", resp.Status)
+	}
+}
+
+// storeAddrs writes the watched addresses into the database. The lock is
+// assumed to be held.
+func (w *depositWatcher) storeAddrs() {
+	addrs := make([]common.Address, 0, len(w.addrs))
+	for addr := range w.addrs {
+		addrs = append(addrs, addr)
+	}
+	enc, err := rlp.EncodeToBytes(addrs)
+	if err != nil {
+		log.Error("Failed to encode watched deposit addresses", "err", err)
+		return
+	}
+	if err := w.db.Put(depositWatchKey, enc); err != nil {
+		log.Error("Failed to store watched deposit addresses", "err", err)
+	}
+}
+
+// storeNext writes the scanning progress into the database. The lock is
+// assumed to be held.
+func (w *depositWatcher) storeNext() {
+	if err := w.db.Put(depositNextKey, new(big.Int).SetUint64(w.next).Bytes()); err != nil {
+		log.Error("Failed to store deposit scanning progress", "err", err)
+	}
+}
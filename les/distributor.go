@@ -18,7 +18,9 @@ package les
 
 import (
 	"container/list"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"truechain/discovery/common/mclock"
@@ -26,16 +28,32 @@ import (
 
 // requestDistributor implements a mechanism that distributes requests to
 // suitable peers, obeying flow control rules and prioritizing them in creation
-// order (even when a resend is necessary).
+// order (even when a resend is necessary) within their priority class. The
+// classes are served by weighted fair queuing: the class with queued requests
+// which has sent the fewest requests relative to its weight goes first.
+//
+// The distribution loop only runs when something may have changed: a request
+// is queued, a peer is added or removed, a reply recharged the flow control
+// buffer of a server, a send queue was drained, or the waiting time of a
+// request calculated in the previous run has passed.
 type requestDistributor struct {
-	clock            mclock.Clock
-	reqQueue         *list.List
-	lastReqOrder     uint64
-	peers            map[distPeer]struct{}
-	peerLock         sync.RWMutex
-	stopChn, loopChn chan struct{}
-	loopNextSent     bool
-	lock             sync.Mutex
+	clock        mclock.Clock
+	reqQueues    [priorityClasses]*list.List // queued requests by priority class
+	served       [priorityClasses]float64    // requests sent per class relative to its weight
+	lastReqOrder uint64
+	peers        map[distPeer]struct{}
+	peerLock     sync.RWMutex
+	stopChn      chan struct{}
+	wakeChn      chan struct{} // coalesced wake up signals of the loop
+	waiting      int32         // set atomically if queued requests wait for the peers
+	lock         sync.Mutex
+
+	timer   mclock.Event   // wake up at the earliest waiting time, nil if none
+	timerAt mclock.AbsTime // time the timer fires at
+
+	// peerWait is the time a queued request waits for a suitable peer before
+	// failing, waitForPeers by default
+	peerWait time.Duration
 }
 
 // distPeer is an LES server peer interface for the request distributor.
@@ -62,6 +80,7 @@ type distReq struct {
 	canSend func(distPeer) bool
 	request func(distPeer) func()
 
+	priority     reqPriority
 	reqOrder     uint64
 	sentChn      chan distPeer
 	element      *list.Element
@@ -72,15 +91,18 @@ type distReq struct {
 func newRequestDistributor(peers *peerSet, stopChn chan struct{}, clock mclock.Clock) *requestDistributor {
 	d := &requestDistributor{
 		clock:    clock,
-		reqQueue: list.New(),
-		loopChn:  make(chan struct{}, 2),
+		wakeChn:  make(chan struct{}, 1),
 		stopChn:  stopChn,
 		peers:    make(map[distPeer]struct{}),
+		peerWait: waitForPeers,
+	}
+	for i := range d.reqQueues {
+		d.reqQueues[i] = list.New()
 	}
 	if peers != nil {
 		peers.notify(d)
 	}
-	go d.loop()
+	goLabeled("distributor", d.loop)
 	return d
 }
 
@@ -89,6 +111,7 @@ func (d *requestDistributor) registerPeer(p *peer) {
 	d.peerLock.Lock()
 	d.peers[p] = struct{}{}
 	d.peerLock.Unlock()
+	d.update()
 }
 
 // unregisterPeer implements peerSetNotify
@@ -96,6 +119,7 @@ func (d *requestDistributor) unregisterPeer(p *peer) {
 	d.peerLock.Lock()
 	delete(d.peers, p)
 	d.peerLock.Unlock()
+	d.update()
 }
 
 // registerTestPeer adds a new test peer
@@ -103,69 +127,112 @@ func (d *requestDistributor) registerTestPeer(p distPeer) {
 	d.peerLock.Lock()
 	d.peers[p] = struct{}{}
 	d.peerLock.Unlock()
+	d.update()
 }
 
-// distMaxWait is the maximum waiting time after which further necessary waiting
-// times are recalculated based on new feedback from the servers
-const distMaxWait = time.Millisecond * 50
+// wake signals the loop to distribute the queued requests. Signals sent while
+// the loop is busy are coalesced.
+func (d *requestDistributor) wake() {
+	select {
+	case d.wakeChn <- struct{}{}:
+	default:
+	}
+}
+
+// update signals a possible change in the availability of the peers, waking
+// up the loop if queued requests are waiting for the peers.
+func (d *requestDistributor) update() {
+	if atomic.LoadInt32(&d.waiting) != 0 {
+		d.wake()
+	}
+}
+
+// schedule wakes up the loop after the given waiting time, unless it's woken
+// up earlier by the timer already. The lock is held by the caller.
+func (d *requestDistributor) schedule(wait time.Duration) {
+	at := d.clock.Now() + mclock.AbsTime(wait)
+	if d.timer != nil {
+		if d.timerAt <= at {
+			return
+		}
+		d.timer.Cancel()
+	}
+	d.timer, d.timerAt = d.clock.AfterFunc(wait, d.wake), at
+}
 
 // waitForPeers is the time window in which a request does not fail even if it
 // has no suitable peers to send to at the moment
 const waitForPeers = time.Second * 3
 
 // main event loop
-func (d *requestDistributor) loop() {
+func (d *requestDistributor) loop(rt *routine) {
 	for {
+		rt.setState("waiting")
 		select {
 		case <-d.stopChn:
 			d.lock.Lock()
-			elem := d.reqQueue.Front()
-			for elem != nil {
-				req := elem.Value.(*distReq)
-				close(req.sentChn)
-				req.sentChn = nil
-				elem = elem.Next()
+			if d.timer != nil {
+				d.timer.Cancel()
+				d.timer = nil
+			}
+			for _, queue := range d.reqQueues {
+				for elem := queue.Front(); elem != nil; elem = elem.Next() {
+					req := elem.Value.(*distReq)
+					close(req.sentChn)
+					req.sentChn = nil
+				}
 			}
 			d.lock.Unlock()
 			return
-		case <-d.loopChn:
+		case <-d.wakeChn:
+			rt.setState("distributing")
 			d.lock.Lock()
-			d.loopNextSent = false
-		loop:
+			if d.timer != nil && d.clock.Now() >= d.timerAt {
+				d.timer = nil
+			}
+			// Flag the waiting before scanning, so that a peer change during
+			// the scan wakes up the loop again instead of being missed
+			atomic.StoreInt32(&d.waiting, 1)
 			for {
 				peer, req, wait := d.nextRequest()
-				if req != nil && wait == 0 {
-					chn := req.sentChn // save sentChn because remove sets it to nil
-					d.remove(req)
-					send := req.request(peer)
-					if send != nil {
-						peer.queueSend(send)
-					}
-					chn <- peer
-					close(chn)
-				} else {
+				if req == nil || wait != 0 {
+					// Nothing to send until the waiting time passes or the
+					// peers change, the next queued request wakes up the
+					// loop anyway
 					if wait == 0 {
-						// no request to send and nothing to wait for; the next
-						// queued request will wake up the loop
-						break loop
+						wait = d.nextDeadline()
 					}
-					d.loopNextSent = true // a "next" signal has been sent, do not send another one until this one has been received
-					if wait > distMaxWait {
-						// waiting times may be reduced by incoming request replies, if it is too long, recalculate it periodically
-						wait = distMaxWait
+					if wait != 0 {
+						d.schedule(wait)
 					}
-					go func() {
-						d.clock.Sleep(wait)
-						d.loopChn <- struct{}{}
-					}()
-					break loop
+					if d.queued() == 0 {
+						atomic.StoreInt32(&d.waiting, 0)
+					}
+					break
 				}
+				d.send(peer, req)
 			}
 			d.lock.Unlock()
 		}
 	}
 }
 
+// send sends a request to the selected peer and counts it as served for its
+// priority class. The lock is held by the caller.
+func (d *requestDistributor) send(peer distPeer, req *distReq) {
+	chn := req.sentChn // save sentChn because remove sets it to nil
+	d.remove(req)
+	d.served[req.priority] += 1 / priorityWeights[req.priority]
+	if send := req.request(peer); send != nil {
+		peer.queueSend(func() {
+			send()
+			d.update() // room in the send queue
+		})
+	}
+	chn <- peer
+	close(chn)
+}
+
 // selectPeerItem represents a peer to be selected for a request by weightedRandomSelect
 type selectPeerItem struct {
 	peer   distPeer
@@ -179,20 +246,46 @@ func (sp selectPeerItem) Weight() int64 {
 }
 
 // nextRequest returns the next possible request from any peer, along with the
-// associated peer and necessary waiting time
+// associated peer and necessary waiting time. The priority classes are tried
+// in the order of the requests they have sent relative to their weights.
 func (d *requestDistributor) nextRequest() (distPeer, *distReq, time.Duration) {
+	var classes []reqPriority
+	for i, queue := range d.reqQueues {
+		if queue.Len() > 0 {
+			classes = append(classes, reqPriority(i))
+		}
+	}
+	sort.SliceStable(classes, func(i, j int) bool { return d.served[classes[i]] < d.served[classes[j]] })
+
+	d.peerLock.RLock()
+	defer d.peerLock.RUnlock()
+
+	var bestWait time.Duration
+	for _, class := range classes {
+		peer, req, wait := d.nextRequestOf(d.reqQueues[class])
+		if req != nil {
+			return peer, req, 0
+		}
+		if wait != 0 && (bestWait == 0 || wait < bestWait) {
+			bestWait = wait
+		}
+	}
+	return nil, nil, bestWait
+}
+
+// nextRequestOf returns the next possible request of a priority class from any
+// peer, along with the associated peer and necessary waiting time. The peer
+// lock is held by the caller.
+func (d *requestDistributor) nextRequestOf(queue *list.List) (distPeer, *distReq, time.Duration) {
 	checkedPeers := make(map[distPeer]struct{})
-	elem := d.reqQueue.Front()
+	elem := queue.Front()
 	var (
 		bestWait time.Duration
 		sel      *weightedRandomSelect
 	)
 
-	d.peerLock.RLock()
-	defer d.peerLock.RUnlock()
-
 	peerCount := len(d.peers)
-	for (len(checkedPeers) < peerCount || elem == d.reqQueue.Front()) && elem != nil {
+	for (len(checkedPeers) < peerCount || elem == queue.Front()) && elem != nil {
 		req := elem.Value.(*distReq)
 		canSend := false
 		now := d.clock.Now()
@@ -222,7 +315,7 @@ func (d *requestDistributor) nextRequest() (distPeer, *distReq, time.Duration) {
 			}
 		}
 		next := elem.Next()
-		if !canSend && elem == d.reqQueue.Front() {
+		if !canSend && elem == queue.Front() {
 			close(req.sentChn)
 			d.remove(req)
 		}
@@ -247,24 +340,30 @@ func (d *requestDistributor) queue(r *distReq) chan distPeer {
 	if r.reqOrder == 0 {
 		d.lastReqOrder++
 		r.reqOrder = d.lastReqOrder
-		r.waitForPeers = d.clock.Now() + mclock.AbsTime(waitForPeers)
+		r.waitForPeers = d.clock.Now() + mclock.AbsTime(d.peerWait)
 	}
-
-	back := d.reqQueue.Back()
+	if r.priority < 0 || r.priority >= priorityClasses {
+		r.priority = priorityInteractive
+	}
+	queue := d.reqQueues[r.priority]
+	if queue.Len() == 0 {
+		// An idle class doesn't save up its share, it starts level with the
+		// busy classes
+		d.catchUp(r.priority)
+	}
+	back := queue.Back()
 	if back == nil || r.reqOrder > back.Value.(*distReq).reqOrder {
-		r.element = d.reqQueue.PushBack(r)
+		r.element = queue.PushBack(r)
 	} else {
-		before := d.reqQueue.Front()
+		before := queue.Front()
 		for before.Value.(*distReq).reqOrder < r.reqOrder {
 			before = before.Next()
 		}
-		r.element = d.reqQueue.InsertBefore(r, before)
+		r.element = queue.InsertBefore(r, before)
 	}
+	distQueuedGauges[r.priority].Update(int64(queue.Len()))
 
-	if !d.loopNextSent {
-		d.loopNextSent = true
-		d.loopChn <- struct{}{}
-	}
+	d.wake()
 
 	r.sentChn = make(chan distPeer, 1)
 	return r.sentChn
@@ -290,7 +389,58 @@ func (d *requestDistributor) cancel(r *distReq) bool {
 func (d *requestDistributor) remove(r *distReq) {
 	r.sentChn = nil
 	if r.element != nil {
-		d.reqQueue.Remove(r.element)
+		queue := d.reqQueues[r.priority]
+		queue.Remove(r.element)
 		r.element = nil
+		distQueuedGauges[r.priority].Update(int64(queue.Len()))
+	}
+}
+
+// queued returns the number of queued requests of all classes.
+func (d *requestDistributor) queued() int {
+	var n int
+	for _, queue := range d.reqQueues {
+		n += queue.Len()
+	}
+	return n
+}
+
+// nextDeadline returns the time until the earliest queued request runs out of
+// its time window to wait for peers, or zero if none is pending. The lock is
+// held by the caller.
+func (d *requestDistributor) nextDeadline() time.Duration {
+	var (
+		now  = d.clock.Now()
+		next time.Duration
+	)
+	for _, queue := range d.reqQueues {
+		for elem := queue.Front(); elem != nil; elem = elem.Next() {
+			req := elem.Value.(*distReq)
+			if wait := time.Duration(req.waitForPeers - now); req.waitForPeers > now && (next == 0 || wait < next) {
+				next = wait
+			}
+		}
+	}
+	return next
+}
+
+// catchUp raises the requests sent by a class which becomes busy to the least
+// sent by the busy classes. The lock is held by the caller.
+func (d *requestDistributor) catchUp(class reqPriority) {
+	min, busy := 0.0, false
+	for i, queue := range d.reqQueues {
+		if queue.Len() > 0 && (!busy || d.served[i] < min) {
+			min, busy = d.served[i], true
+		}
+	}
+	if !busy {
+		// Nothing queued at all, start over to keep the counters small
+		for i := range d.served {
+			d.served[i] = 0
+		}
+		return
+	}
+	if d.served[class] < min {
+		d.served[class] = min
 	}
 }
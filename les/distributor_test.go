@@ -0,0 +1,251 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"container/list"
+	"testing"
+	"time"
+
+	"truechain/discovery/common/mclock"
+)
+
+// testDistPeer is a server whose flow control buffer allows sending a request
+// from a given time on. A busy server has its send queue full.
+type testDistPeer struct {
+	clock   mclock.Clock
+	readyAt mclock.AbsTime
+	busy    bool
+}
+
+func (p *testDistPeer) waitBefore(uint64) (time.Duration, float64) {
+	if now := p.clock.Now(); now < p.readyAt {
+		return time.Duration(p.readyAt - now), 0
+	}
+	return 0, 1
+}
+
+func (p *testDistPeer) canQueue() bool     { return !p.busy }
+func (p *testDistPeer) queueSend(f func()) { f() }
+
+// newTestDistReq creates a request which can be sent to any peer.
+func newTestDistReq() *distReq {
+	return &distReq{
+		getCost: func(distPeer) uint64 { return 1 },
+		canSend: func(distPeer) bool { return true },
+		request: func(distPeer) func() { return func() {} },
+	}
+}
+
+// Tests that a request waiting for the flow control buffer of a server is sent
+// once the simulated waiting time has passed, not before.
+func TestDistributorWaitsForBuffer(t *testing.T) {
+	var (
+		clock = &mclock.Simulated{}
+		stop  = make(chan struct{})
+	)
+	defer close(stop)
+	d := newRequestDistributor(nil, stop, clock)
+	peer := &testDistPeer{clock: clock, readyAt: mclock.AbsTime(time.Second)}
+	d.registerTestPeer(peer)
+
+	sent := d.queue(newTestDistReq())
+	clock.WaitForTimers(1)
+	select {
+	case <-sent:
+		t.Fatal("request sent before the buffer recharged")
+	case <-time.After(100 * time.Millisecond):
+	}
+	clock.Run(time.Second)
+	select {
+	case p := <-sent:
+		if p != peer {
+			t.Fatalf("request sent to wrong peer: %v", p)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("request not sent after the buffer recharged")
+	}
+}
+
+// Tests that a request without suitable peers fails after waitForPeers of
+// simulated time.
+func TestDistributorPeerTimeout(t *testing.T) {
+	var (
+		clock = &mclock.Simulated{}
+		stop  = make(chan struct{})
+	)
+	defer close(stop)
+	d := newRequestDistributor(nil, stop, clock)
+
+	sent := d.queue(newTestDistReq())
+	clock.WaitForTimers(1)
+	clock.Run(waitForPeers - time.Millisecond)
+	select {
+	case <-sent:
+		t.Fatal("request failed before waitForPeers")
+	case <-time.After(100 * time.Millisecond):
+	}
+	clock.Run(time.Millisecond)
+	select {
+	case p, ok := <-sent:
+		if ok {
+			t.Fatalf("request sent without peers to %v", p)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("request not failed after waitForPeers")
+	}
+}
+
+// Tests that the requests queued while the only server is busy fail each at
+// the end of their own waiting time, a later request still waiting for peers
+// after the first one failed.
+func TestDistributorDeadlinePastBusyPeer(t *testing.T) {
+	var (
+		clock = &mclock.Simulated{}
+		stop  = make(chan struct{})
+	)
+	defer close(stop)
+	d := newRequestDistributor(nil, stop, clock)
+	d.registerTestPeer(&testDistPeer{clock: clock, busy: true})
+
+	first := d.queue(newTestDistReq())
+	clock.WaitForTimers(1)
+	clock.Run(time.Second)
+	second := d.queue(newTestDistReq())
+
+	clock.Run(waitForPeers - time.Second)
+	select {
+	case p, ok := <-first:
+		if ok {
+			t.Fatalf("first request sent to busy peer %v", p)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("first request not failed after waitForPeers")
+	}
+	clock.WaitForTimers(1)
+	select {
+	case <-second:
+		t.Fatal("second request failed before waitForPeers")
+	case <-time.After(100 * time.Millisecond):
+	}
+	clock.Run(time.Second)
+	select {
+	case p, ok := <-second:
+		if ok {
+			t.Fatalf("second request sent to busy peer %v", p)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("second request not failed after waitForPeers")
+	}
+}
+
+// newTestDistributor creates a distributor with a server which is always ready,
+// the requests being sent by the test instead of the distribution loop.
+func newTestDistributor() *requestDistributor {
+	d := &requestDistributor{
+		clock:    &mclock.Simulated{},
+		peers:    make(map[distPeer]struct{}),
+		peerWait: waitForPeers,
+	}
+	for i := range d.reqQueues {
+		d.reqQueues[i] = list.New()
+	}
+	d.peers[&testDistPeer{clock: d.clock}] = struct{}{}
+	return d
+}
+
+// queueTestRequests queues requests of a priority class recording the class
+// when sent.
+func queueTestRequests(d *requestDistributor, class reqPriority, n int, sent *[]reqPriority) {
+	for i := 0; i < n; i++ {
+		req := newTestDistReq()
+		req.priority = class
+		req.request = func(distPeer) func() {
+			*sent = append(*sent, class)
+			return nil
+		}
+		d.queue(req)
+	}
+}
+
+// sendTestRequests sends the given number of queued requests in the order the
+// distribution loop would.
+func sendTestRequests(t *testing.T, d *requestDistributor, n int) {
+	for i := 0; i < n; i++ {
+		peer, req, _ := d.nextRequest()
+		if req == nil {
+			t.Fatalf("no request to send after %d", i)
+		}
+		d.send(peer, req)
+	}
+}
+
+// countClasses returns the number of requests sent of each class.
+func countClasses(sent []reqPriority) (counts [priorityClasses]int) {
+	for _, class := range sent {
+		counts[class]++
+	}
+	return counts
+}
+
+// Tests that the busy priority classes are served in proportion to their weights.
+func TestDistributorWeightedShares(t *testing.T) {
+	var (
+		d    = newTestDistributor()
+		sent []reqPriority
+	)
+	queueTestRequests(d, priorityBackground, 100, &sent)
+	queueTestRequests(d, priorityInteractive, 1000, &sent)
+	queueTestRequests(d, prioritySync, 1000, &sent)
+
+	// Send a multiple of the total weight while all classes stay busy
+	var total float64
+	for _, weight := range priorityWeights {
+		total += weight
+	}
+	rounds := 50
+	sendTestRequests(t, d, rounds*int(total))
+
+	counts := countClasses(sent)
+	for class, weight := range priorityWeights {
+		want := rounds * int(weight)
+		if diff := counts[class] - want; diff < -1 || diff > 1 {
+			t.Errorf("class %d: served %d requests, want %d", class, counts[class], want)
+		}
+	}
+}
+
+// Tests that a class idle while the others are served doesn't save up its share,
+// it gets its weighted share from the time it is queued on.
+func TestDistributorIdleClassCatchUp(t *testing.T) {
+	var (
+		d    = newTestDistributor()
+		sent []reqPriority
+	)
+	queueTestRequests(d, priorityInteractive, 1000, &sent)
+	sendTestRequests(t, d, 500)
+
+	sent = sent[:0]
+	queueTestRequests(d, priorityBackground, 100, &sent)
+	rounds := 10
+	sendTestRequests(t, d, rounds*int(priorityWeights[priorityInteractive]+priorityWeights[priorityBackground]))
+
+	counts := countClasses(sent)
+	if diff := counts[priorityBackground] - rounds; diff < -1 || diff > 1 {
+		t.Errorf("idle class served %d requests after catching up, want %d", counts[priorityBackground], rounds)
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"net"
+)
+
+// PeerGroupFunc maps the IP address of a server to its network group, e.g. the
+// autonomous system it is announced from. Servers in the same group are assumed
+// to be controlled by the same party. An empty group leaves the server
+// unconstrained.
+type PeerGroupFunc func(ip net.IP) string
+
+// prefixGroup is the default network group of a server, its /16 IPv4 or /32
+// IPv6 prefix.
+func prefixGroup(ip net.IP) string {
+	if ip == nil {
+		return ""
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(net.CIDRMask(16, 32)).String() + "/16"
+	}
+	return ip.Mask(net.CIDRMask(32, 128)).String() + "/32"
+}
+
+// peerDiversity limits the number of servers dialed or connected from the same
+// network group, so that a single party can't fill all the server slots of the
+// light client with colluding nodes.
+type peerDiversity struct {
+	max   int            // Maximum number of servers per group, 0 disables the limit
+	group PeerGroupFunc  // Lookup of the network group of a server
+	count map[string]int // Number of servers dialed or connected per group
+}
+
+// newPeerDiversity creates the diversity limit of the server pool. It returns
+// nil if the limit is disabled.
+func newPeerDiversity(max int, group PeerGroupFunc) *peerDiversity {
+	if max <= 0 {
+		return nil
+	}
+	if group == nil {
+		group = prefixGroup
+	}
+	return &peerDiversity{max: max, group: group, count: make(map[string]int)}
+}
+
+// entryGroup returns the network group of a pool entry. Onion services have no
+// IP address and are not constrained.
+func (d *peerDiversity) entryGroup(entry *poolEntry) string {
+	if d == nil || entry.isOnion() {
+		return ""
+	}
+	return d.group(entry.node.IP())
+}
+
+// full returns true if no more servers may be dialed from the group of the
+// entry. An entry already counted in its group is never rejected.
+func (d *peerDiversity) full(entry *poolEntry) bool {
+	if d == nil || entry.grouped {
+		return false
+	}
+	group := d.entryGroup(entry)
+	return group != "" && d.count[group] >= d.max
+}
+
+// join counts the entry in its group when it is dialed or accepted.
+func (d *peerDiversity) join(entry *poolEntry) {
+	if d == nil || entry.grouped {
+		return
+	}
+	entry.group = d.entryGroup(entry)
+	entry.grouped = true
+	if entry.group != "" {
+		d.count[entry.group]++
+	}
+}
+
+// leave removes the entry from its group when it is disconnected. It returns the
+// group that got a free slot, or an empty string.
+func (d *peerDiversity) leave(entry *poolEntry) string {
+	if d == nil || !entry.grouped {
+		return ""
+	}
+	entry.grouped = false
+	if entry.group == "" {
+		return ""
+	}
+	if d.count[entry.group]--; d.count[entry.group] <= 0 {
+		delete(d.count, entry.group)
+	}
+	return entry.group
+}
@@ -0,0 +1,192 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"truechain/discovery/common/mclock"
+	"truechain/discovery/event"
+	"truechain/discovery/log"
+	"truechain/discovery/params"
+)
+
+const (
+	// eclipseChurnWindow and eclipseChurnLimit define suspicious connectivity
+	// churn: more than eclipseChurnLimit servers disconnected in the window.
+	eclipseChurnWindow = time.Minute * 10
+	eclipseChurnLimit  = 30
+	// eclipseMinGroups is the number of distinct network groups the connected
+	// servers have to come from before a raised eclipse risk is cleared.
+	eclipseMinGroups = 2
+)
+
+const (
+	eclipseReasonCheckpoint = "checkpoint" // all servers agree on a checkpoint diverging from ours
+	eclipseReasonChurn      = "churn"      // servers are replaced suspiciously fast
+)
+
+// EclipseRiskEvent is posted when the light client suspects that all of its
+// servers are controlled by an attacker, and again once the risk is cleared.
+type EclipseRiskEvent struct {
+	Risk   bool   `json:"risk"`
+	Reason string `json:"reason"` // "checkpoint" or "churn", empty if cleared
+	Peers  int    `json:"peers"`
+	Groups int    `json:"groups"` // distinct network groups of the connected servers
+}
+
+// eclipseMonitor watches the connected servers for signs of an eclipse attack.
+// While the risk is raised, the fetcher doesn't request or sync announced heads
+// so the local chain isn't advanced by the suspicious servers.
+type eclipseMonitor struct {
+	checkpoint *params.TrustedCheckpoint // trusted checkpoint, nil if none
+	group      PeerGroupFunc
+
+	lock   sync.Mutex
+	peers  map[*peer]struct{}
+	drops  []mclock.AbsTime // disconnect times within the churn window
+	status EclipseRiskEvent
+	feed   event.Feed
+}
+
+// newEclipseMonitor creates the eclipse monitor of the light client.
+func newEclipseMonitor(checkpoint *params.TrustedCheckpoint, group PeerGroupFunc) *eclipseMonitor {
+	if group == nil {
+		group = prefixGroup
+	}
+	return &eclipseMonitor{checkpoint: checkpoint, group: group, peers: make(map[*peer]struct{})}
+}
+
+// setCheckpoint replaces the trusted checkpoint after it was updated from the
+// checkpoint oracle.
+func (m *eclipseMonitor) setCheckpoint(cp *params.TrustedCheckpoint) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.checkpoint = cp
+	m.update()
+}
+
+// registerPeer implements peerSetNotify
+func (m *eclipseMonitor) registerPeer(p *peer) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if p.servesData() {
+		m.peers[p] = struct{}{}
+	}
+	m.update()
+}
+
+// unregisterPeer implements peerSetNotify
+func (m *eclipseMonitor) unregisterPeer(p *peer) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if _, ok := m.peers[p]; ok {
+		delete(m.peers, p)
+		m.drops = append(m.drops, mclock.Now())
+	}
+	m.update()
+}
+
+// risky returns true if heads announced by the servers shouldn't be finalized.
+func (m *eclipseMonitor) risky() bool {
+	if m == nil {
+		return false
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.update()
+	return m.status.Risk
+}
+
+// current returns the current eclipse risk status.
+func (m *eclipseMonitor) current() EclipseRiskEvent {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.update()
+	return m.status
+}
+
+// subscribe subscribes to the changes of the eclipse risk status.
+func (m *eclipseMonitor) subscribe(ch chan<- EclipseRiskEvent) event.Subscription {
+	return m.feed.Subscribe(ch)
+}
+
+// update evaluates the heuristics and raises or clears the eclipse risk. A
+// raised risk is only cleared when its cause is gone and the servers come from
+// enough distinct network groups.
+func (m *eclipseMonitor) update() {
+	cutoff := mclock.Now() - mclock.AbsTime(eclipseChurnWindow)
+	for len(m.drops) > 0 && m.drops[0] < cutoff {
+		m.drops = m.drops[1:]
+	}
+	groups := make(map[string]struct{})
+	for p := range m.peers {
+		if addr, ok := p.RemoteAddr().(*net.TCPAddr); ok {
+			groups[m.group(addr.IP)] = struct{}{}
+		}
+	}
+	reason := ""
+	switch {
+	case m.checkpointDiverged():
+		reason = eclipseReasonCheckpoint
+	case len(m.drops) > eclipseChurnLimit:
+		reason = eclipseReasonChurn
+	}
+	status := EclipseRiskEvent{Risk: reason != "", Reason: reason, Peers: len(m.peers), Groups: len(groups)}
+	if !status.Risk && m.status.Risk && len(groups) < eclipseMinGroups {
+		// Cause is gone, keep the risk until diversity is restored
+		status.Risk, status.Reason = true, m.status.Reason
+	}
+	changed := status.Risk != m.status.Risk
+	m.status = status
+	if !changed {
+		return
+	}
+	if status.Risk {
+		log.Warn("Possible eclipse attack, not finalizing heads", "reason", status.Reason, "peers", status.Peers, "groups", status.Groups)
+	} else {
+		log.Info("Eclipse risk cleared", "peers", status.Peers, "groups", status.Groups)
+	}
+	go m.feed.Send(status)
+}
+
+// checkpointDiverged returns true if all connected servers announce the same
+// checkpoint for the section of the trusted one, but with a different head.
+func (m *eclipseMonitor) checkpointDiverged() bool {
+	if m.checkpoint == nil || len(m.peers) == 0 {
+		return false
+	}
+	var announced *params.TrustedCheckpoint
+	for p := range m.peers {
+		cp := &p.checkpoint
+		if cp.SectionIndex != m.checkpoint.SectionIndex || cp.SectionHead == m.checkpoint.SectionHead {
+			return false
+		}
+		if announced != nil && announced.SectionHead != cp.SectionHead {
+			return false
+		}
+		announced = cp
+	}
+	return true
+}
@@ -18,9 +18,11 @@ package les
 
 import (
 	"bytes"
+	"context"
 	"encoding/hex"
 	"errors"
 	"math/big"
+	"time"
 
 	"github.com/hashicorp/golang-lru"
 	"truechain/discovery/common"
@@ -37,6 +39,10 @@ const (
 	snailchainHeadSize  = 64
 	committeeCacheLimit = 256
 
+	// switchInfoTimeout is the time limit for retrieving the switch infos of
+	// a fast block from the servers.
+	switchInfoTimeout = 10 * time.Second
+
 	// The sha3 of empy switchinfo rlp encoded data
 	emptyCommittee = "1dcc4de8dec75d7aab85b567b6ccd41ad312451b948a7413f0a142fd40d49347"
 )
@@ -220,11 +226,12 @@ func (e *Election) GetCommittee(fastNumber *big.Int) []*types.CommitteeMember {
 		c          *types.ElectionCommittee
 	)
 
-	blockHead := e.fastchain.GetHeaderByNumber(fastNumber.Uint64())
-	if fruitHead := e.snailchain.GetFruitHeaderByHash(blockHead.Hash()); fruitHead != nil {
-		snail = fruitHead.Number
-	} else {
-		snail = e.snailchain.CurrentHeader().Number
+	// The header of signs being verified may not have been inserted yet
+	snail = e.snailchain.CurrentHeader().Number
+	if blockHead := e.fastchain.GetHeaderByNumber(fastNumber.Uint64()); blockHead != nil {
+		if fruitHead := e.snailchain.GetFruitHeaderByHash(blockHead.Hash()); fruitHead != nil {
+			snail = fruitHead.Number
+		}
 	}
 
 	id = new(big.Int).Div(snail, params.ElectionPeriodNumber)
@@ -302,9 +309,9 @@ func (e *Election) filterWithSwitchInfo(c *types.ElectionCommittee, fastNumber *
 		if num >= fastNumber.Uint64() {
 			break
 		}
-		b := e.fastchain.GetSwitchInfo(num)
+		b, err := e.switchInfo(num)
 		if b == nil {
-			log.Warn("Switch block not exists", "number", num)
+			log.Warn("Switch block not exists", "number", num, "err", err)
 			break
 		}
 		for _, s := range b {
@@ -337,6 +344,17 @@ func (e *Election) filterWithSwitchInfo(c *types.ElectionCommittee, fastNumber *
 	return
 }
 
+// switchInfo returns the committee switch infos of a fast block, retrieving them
+// from the servers if they weren't received with the header.
+func (e *Election) switchInfo(number uint64) ([]*types.CommitteeMember, error) {
+	if infos := e.fastchain.GetSwitchInfo(number); infos != nil {
+		return infos, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), switchInfoTimeout)
+	defer cancel()
+	return e.fastchain.GetSwitchInfoOdr(ctx, number)
+}
+
 func (e *Election) getCommittee(id *big.Int) *types.ElectionCommittee {
 	if cache, ok := e.commiteeCache.Get(id.Uint64()); ok {
 		committee := cache.(*types.ElectionCommittee)
@@ -0,0 +1,210 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"context"
+	"sync"
+
+	"truechain/discovery/common"
+	"truechain/discovery/core/state"
+	"truechain/discovery/core/types"
+	"truechain/discovery/crypto"
+	"truechain/discovery/light/fast"
+	"truechain/discovery/log"
+	"truechain/discovery/rlp"
+	"truechain/discovery/rpc"
+	"truechain/discovery/trie"
+)
+
+const (
+	estimateCacheLimit = 64  // number of call destinations the touched state is remembered for
+	estimateKeyLimit   = 512 // number of trie entries remembered for a destination
+)
+
+// stateKeys is the set of state trie entries touched by a call, the hashed
+// keys grouped by the hashed address of the storage trie, the account trie
+// under the empty string.
+type stateKeys struct {
+	lock  sync.Mutex
+	count int
+	keys  map[string]map[string]struct{}
+}
+
+func newStateKeys() *stateKeys {
+	return &stateKeys{keys: make(map[string]map[string]struct{})}
+}
+
+// add records an entry of a trie, unless the limit is reached.
+func (s *stateKeys) add(accKey, key []byte) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	set := s.keys[string(accKey)]
+	if set == nil {
+		set = make(map[string]struct{})
+		s.keys[string(accKey)] = set
+	}
+	if _, ok := set[string(key)]; ok || s.count >= estimateKeyLimit {
+		return
+	}
+	set[string(key)] = struct{}{}
+	s.count++
+}
+
+// copy returns a copy of the set, further entries of which can be recorded
+// independently.
+func (s *stateKeys) copy() *stateKeys {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	cpy := newStateKeys()
+	for accKey, set := range s.keys {
+		for key := range set {
+			cpy.add([]byte(accKey), []byte(key))
+		}
+	}
+	return cpy
+}
+
+// stateRecorder is an ODR backend recording the state trie entries retrieved
+// on demand by a call.
+type stateRecorder struct {
+	fast.OdrBackend
+	keys *stateKeys
+}
+
+// FastRetrieve records the entry of a trie request and retrieves it.
+func (r *stateRecorder) FastRetrieve(ctx context.Context, req fast.OdrRequest) error {
+	if tr, ok := req.(*fast.TrieRequest); ok {
+		r.keys.add(tr.Id.AccKey, tr.Key)
+	}
+	return r.OdrBackend.FastRetrieve(ctx, req)
+}
+
+// EstimateState returns the state the gas estimation of a call runs on. The
+// state entries touched by the latest estimated call to the same destination
+// are prefetched in batches, instead of being retrieved one at a time by the
+// first iteration of the estimation. The entries retrieved on demand are
+// recorded for the next estimation. Like any other state, it is read through
+// the hot state backend.
+func (b *LesApiBackend) EstimateState(ctx context.Context, blockNr rpc.BlockNumber, from common.Address, to *common.Address) (*state.StateDB, *types.Header, error) {
+	header, err := b.HeaderByNumber(ctx, blockNr)
+	if header == nil || err != nil {
+		return nil, nil, err
+	}
+	var dest common.Address // contract creations are remembered under the zero address
+	if to != nil {
+		dest = *to
+	}
+	keys := newStateKeys()
+	if prev, ok := b.etrue.estimates.Get(dest); ok {
+		keys = prev.(*stateKeys).copy()
+	}
+	keys.add(nil, crypto.Keccak256(from[:]))
+	if to != nil {
+		keys.add(nil, crypto.Keccak256(to[:]))
+	}
+	odr := b.etrue.hot.odrBackend(b.etrue.odr)
+	b.etrue.prefetchState(ctx, odr, header, keys)
+	b.etrue.estimates.Add(dest, keys)
+
+	return fast.NewState(ctx, header, &stateRecorder{OdrBackend: odr, keys: keys}), header, nil
+}
+
+// prefetchState retrieves the given state entries of a block: the accounts
+// first, then the storage entries of every account concurrently. Entries which
+// can't be retrieved are left to be retrieved on demand.
+func (s *LightEtrue) prefetchState(ctx context.Context, odr fast.OdrBackend, header *types.Header, keys *stateKeys) {
+	keys.lock.Lock()
+	var (
+		accounts = make(map[string]struct{})
+		storage  = make(map[string][][]byte)
+	)
+	for accKey, set := range keys.keys {
+		if accKey == "" {
+			for key := range set {
+				accounts[key] = struct{}{}
+			}
+			continue
+		}
+		accounts[accKey] = struct{}{}
+		for key := range set {
+			storage[accKey] = append(storage[accKey], []byte(key))
+		}
+	}
+	accKeys := make([][]byte, 0, len(accounts))
+	for key := range accounts {
+		accKeys = append(accKeys, []byte(key))
+	}
+	keys.lock.Unlock()
+
+	stateID := fast.StateTrieID(header)
+	if err := s.retrieveEntries(ctx, odr, stateID, accKeys); err != nil {
+		log.Debug("Failed to prefetch accounts", "number", header.Number, "accounts", len(accKeys), "err", err)
+		return
+	}
+	st, err := trie.New(header.Root, trie.NewDatabase(s.chainDb))
+	if err != nil {
+		return
+	}
+	var wg sync.WaitGroup
+	for accKey, entries := range storage {
+		enc, err := st.TryGet([]byte(accKey))
+		if err != nil || len(enc) == 0 {
+			continue
+		}
+		var account state.Account
+		if err := rlp.DecodeBytes(enc, &account); err != nil || account.Root == types.EmptyRootHash {
+			continue
+		}
+		wg.Add(1)
+		go func(addrHash common.Hash, root common.Hash, entries [][]byte) {
+			defer wg.Done()
+			if err := s.retrieveEntries(ctx, odr, fast.StorageTrieID(stateID, addrHash, root), entries); err != nil {
+				log.Debug("Failed to prefetch storage", "number", header.Number, "account", addrHash, "entries", len(entries), "err", err)
+			}
+		}(common.BytesToHash([]byte(accKey)), account.Root, entries)
+	}
+	wg.Wait()
+}
+
+// retrieveEntries retrieves the proofs of the given entries of a trie, as many
+// in a request as a reply can hold. In privacy mode or with decoys enabled
+// every entry is retrieved on its own, so that the entries of different
+// accounts are spread over the servers or covered by random decoys.
+func (s *LightEtrue) retrieveEntries(ctx context.Context, odr fast.OdrBackend, id *fast.TrieID, keys [][]byte) error {
+	limit := MaxProofsFetch
+	if s.odr.privacy != nil || s.odr.decoys != nil {
+		limit = 1
+	}
+	for len(keys) > 0 {
+		n := len(keys)
+		if n > limit {
+			n = limit
+		}
+		req := &fast.TrieRequest{Id: id, Key: keys[0]}
+		if n > 1 {
+			req.Decoys = keys[1:n]
+		}
+		if err := odr.FastRetrieve(ctx, req); err != nil {
+			return err
+		}
+		keys = keys[n:]
+	}
+	return nil
+}
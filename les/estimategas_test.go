@@ -0,0 +1,69 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"truechain/discovery/light/fast"
+)
+
+// requestCounter is an ODR backend counting the keys of every trie request.
+type requestCounter struct {
+	fast.OdrBackend
+	keys []int
+}
+
+func (c *requestCounter) FastRetrieve(ctx context.Context, req fast.OdrRequest) error {
+	c.keys = append(c.keys, 1+len(req.(*fast.TrieRequest).Decoys))
+	return nil
+}
+
+// Tests that the prefetched entries of a trie are batched, unless the privacy
+// mode or the decoys require every entry to be retrieved on its own.
+func TestRetrieveEntries(t *testing.T) {
+	entries := make([][]byte, MaxProofsFetch+10)
+	for i := range entries {
+		entries[i] = []byte(fmt.Sprintf("key-%d", i))
+	}
+	tests := []struct {
+		name string
+		odr  *LesOdr
+		keys []int // keys per request
+	}{
+		{"batched", &LesOdr{}, []int{MaxProofsFetch, 10}},
+		{"privacy", &LesOdr{privacy: newPrivacyRouter(true)}, nil},
+		{"decoys", &LesOdr{decoys: newDecoyPool(2)}, nil},
+	}
+	for _, tt := range tests {
+		if tt.keys == nil {
+			for range entries {
+				tt.keys = append(tt.keys, 1)
+			}
+		}
+		counter := new(requestCounter)
+		s := &LightEtrue{odr: tt.odr}
+		if err := s.retrieveEntries(context.Background(), counter, &fast.TrieID{}, entries); err != nil {
+			t.Fatalf("%s: failed to retrieve entries: %v", tt.name, err)
+		}
+		if fmt.Sprint(counter.keys) != fmt.Sprint(tt.keys) {
+			t.Errorf("%s: keys per request mismatch: have %v, want %v", tt.name, counter.keys, tt.keys)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"reflect"
+	"sync"
+	"sync/atomic"
+
+	"truechain/discovery/event"
+	"truechain/discovery/log"
+)
+
+// eventBuffers decouples the subscribers of the light backend events from the
+// event feeds. Every subscription gets a bounded buffer, once it is full the
+// oldest event is dropped, so a slow subscriber can't stall the delivery to
+// the others.
+type eventBuffers struct {
+	size int // Number of events buffered per subscription, 0 disables buffering
+
+	lock sync.Mutex
+	subs map[*bufferedSub]struct{}
+}
+
+// newEventBuffers creates the event buffers of the light backend.
+func newEventBuffers(size int) *eventBuffers {
+	return &eventBuffers{size: size, subs: make(map[*bufferedSub]struct{})}
+}
+
+// EventBufferStats is the state of a buffered event subscription.
+type EventBufferStats struct {
+	Kind     string `json:"kind"`
+	Buffered int    `json:"buffered"`
+	Dropped  uint64 `json:"dropped"`
+}
+
+// stats returns the state of the active buffered subscriptions.
+func (b *eventBuffers) stats() []EventBufferStats {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	list := make([]EventBufferStats, 0, len(b.subs))
+	for sub := range b.subs {
+		list = append(list, EventBufferStats{
+			Kind:     sub.kind,
+			Buffered: int(atomic.LoadInt32(&sub.buffered)),
+			Dropped:  atomic.LoadUint64(&sub.dropped),
+		})
+	}
+	return list
+}
+
+// subscribe subscribes the send-only channel ch to a feed through a bounded
+// buffer. The subscribe function is called with a channel of the same type.
+func (b *eventBuffers) subscribe(kind string, ch interface{}, subscribe func(ch interface{}) event.Subscription) event.Subscription {
+	if b.size <= 0 {
+		return subscribe(ch)
+	}
+	out := reflect.ValueOf(ch)
+	in := reflect.MakeChan(reflect.ChanOf(reflect.BothDir, out.Type().Elem()), 0)
+
+	sub := &bufferedSub{
+		kind:  kind,
+		size:  b.size,
+		in:    in,
+		out:   out,
+		inner: subscribe(in.Convert(out.Type()).Interface()),
+		quit:  make(chan struct{}),
+		err:   make(chan error, 1),
+	}
+	b.lock.Lock()
+	b.subs[sub] = struct{}{}
+	b.lock.Unlock()
+
+	go func() {
+		sub.loop()
+		b.lock.Lock()
+		delete(b.subs, sub)
+		b.lock.Unlock()
+	}()
+	return sub
+}
+
+// bufferedSub is a feed subscription delivering events through a bounded
+// drop-oldest buffer.
+type bufferedSub struct {
+	kind  string
+	size  int
+	in    reflect.Value // channel subscribed to the feed
+	out   reflect.Value // channel of the subscriber
+	inner event.Subscription
+
+	buffered int32  // number of events waiting in the buffer (atomic)
+	dropped  uint64 // number of events dropped due to overflow (atomic)
+
+	once sync.Once
+	quit chan struct{}
+	err  chan error
+}
+
+// loop forwards the events of the feed to the subscriber until unsubscribed.
+func (sub *bufferedSub) loop() {
+	defer close(sub.err)
+
+	var (
+		queue []reflect.Value
+		cases = []reflect.SelectCase{
+			{Dir: reflect.SelectRecv, Chan: sub.in},
+			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(sub.inner.Err())},
+			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(sub.quit)},
+			{Dir: reflect.SelectSend, Chan: sub.out},
+		}
+	)
+	for {
+		active := cases[:3]
+		if len(queue) > 0 {
+			cases[3].Send = queue[0]
+			active = cases
+		}
+		chosen, recv, ok := reflect.Select(active)
+		switch chosen {
+		case 0:
+			if len(queue) == sub.size {
+				queue[0] = reflect.Value{}
+				queue = queue[1:]
+				if atomic.AddUint64(&sub.dropped, 1) == 1 {
+					log.Warn("Slow event subscriber, dropping oldest events", "kind", sub.kind, "buffer", sub.size)
+				}
+				eventDroppedMeter.Mark(1)
+			}
+			queue = append(queue, recv)
+		case 1:
+			if ok {
+				sub.err <- recv.Interface().(error)
+			}
+			sub.inner.Unsubscribe()
+			return
+		case 2:
+			sub.inner.Unsubscribe()
+			return
+		case 3:
+			queue[0] = reflect.Value{}
+			queue = queue[1:]
+		}
+		atomic.StoreInt32(&sub.buffered, int32(len(queue)))
+	}
+}
+
+// Unsubscribe implements event.Subscription.
+func (sub *bufferedSub) Unsubscribe() {
+	sub.once.Do(func() { close(sub.quit) })
+	for range sub.err {
+	}
+}
+
+// Err implements event.Subscription.
+func (sub *bufferedSub) Err() <-chan error {
+	return sub.err
+}
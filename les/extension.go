@@ -0,0 +1,140 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"context"
+	"errors"
+
+	"truechain/discovery/etruedb"
+	"truechain/discovery/light/fast"
+)
+
+// extensionCapPrefix + name is the capability announced for an extension, so
+// that its requests are only sent to servers serving it.
+const extensionCapPrefix = "ext:"
+
+var errUnknownExtension = errors.New("unknown protocol extension")
+
+// Extension is a private protocol extension served by a light server. Clients
+// retrieve its data with ExtensionRequests carried by the GetExtension and
+// Extension messages, so that custom request types don't need changes to the
+// les package. Both sides register the extension under the same name before
+// the node is started.
+type Extension interface {
+	// Name identifies the extension in the handshake and in its messages.
+	Name() string
+
+	// Serve answers a request of the extension. The code identifies the type of
+	// the request within the extension, the data is its encoding.
+	Serve(code uint64, data []byte) ([]byte, error)
+}
+
+// ExtensionRequest is a custom ODR request retrieved from the servers serving
+// an extension.
+type ExtensionRequest interface {
+	fast.OdrRequest
+
+	// Extension returns the name of the extension serving the request.
+	Extension() string
+
+	// Encode returns the code and the encoding of the request.
+	Encode() (code uint64, data []byte)
+
+	// Validate checks the reply of a server, keeping the result if it's valid.
+	// The result is stored by StoreResult afterwards.
+	Validate(db etruedb.Database, reply []byte) error
+}
+
+// extensionCapability returns the capability announced for an extension.
+func extensionCapability(name string) string {
+	return extensionCapPrefix + name
+}
+
+// withCapability returns the announced capabilities extended by another one.
+func withCapability(caps []string, c string) []string {
+	if caps == nil {
+		caps = localCapabilities
+	}
+	return append(append([]string{}, caps...), c)
+}
+
+// RegisterExtension enables the requests of a protocol extension, which are
+// only sent to servers announcing it. It must be called before the light client
+// is started.
+func (s *LightEtrue) RegisterExtension(name string) {
+	s.extensions = append(s.extensions, name)
+	s.protocolManager.capabilities = withCapability(s.protocolManager.capabilities, extensionCapability(name))
+}
+
+// RetrieveExtension retrieves a request of a registered protocol extension from
+// the servers.
+func (s *LightEtrue) RetrieveExtension(ctx context.Context, req ExtensionRequest) error {
+	return s.odr.FastRetrieve(ctx, req)
+}
+
+// RegisterExtension serves a protocol extension to the clients registering it.
+// It must be called before the server is started.
+func (s *LesServer) RegisterExtension(ext Extension) {
+	if s.extensions == nil {
+		s.extensions = make(map[string]Extension)
+	}
+	s.extensions[ext.Name()] = ext
+	s.protocolManager.capabilities = withCapability(s.protocolManager.capabilities, extensionCapability(ext.Name()))
+}
+
+// serveExtension answers a request of a registered protocol extension.
+func (s *LesServer) serveExtension(name string, code uint64, data []byte) ([]byte, error) {
+	ext, ok := s.extensions[name]
+	if !ok {
+		return nil, errUnknownExtension
+	}
+	return ext.Serve(code, data)
+}
+
+// extensionRequest is the LES request of an ExtensionRequest.
+type extensionRequest struct {
+	ExtensionRequest
+}
+
+// GetCost returns the cost of the given ODR request according to the serving
+// peer's cost table (implementation of LesOdrRequest)
+func (r extensionRequest) GetCost(peer *peer) uint64 {
+	return peer.GetRequestCost(GetExtensionMsg, 1)
+}
+
+// CanSend tells if a certain peer is suitable for serving the given request
+func (r extensionRequest) CanSend(peer *peer) bool {
+	return peer.caps.has(extensionCapability(r.Extension()))
+}
+
+// Request sends an ODR request to the LES network (implementation of LesOdrRequest)
+func (r extensionRequest) Request(reqID uint64, peer *peer) error {
+	code, data := r.Encode()
+	peer.Log().Debug("Requesting extension data", "extension", r.Extension(), "code", code)
+	return peer.RequestExtension(reqID, r.GetCost(peer), r.Extension(), code, data)
+}
+
+// Validate processes an ODR request reply message from the LES network
+// returns true and stores results in memory if the message was a valid reply
+// to the request (implementation of LesOdrRequest)
+func (r extensionRequest) Validate(db etruedb.Database, msg *Msg) error {
+	if msg.MsgType != MsgExtension {
+		return errInvalidMessageType
+	}
+	return r.ExtensionRequest.Validate(db, msg.Obj.([]byte))
+}
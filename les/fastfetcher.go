@@ -356,6 +356,9 @@ func (f *fastLightFetcher) requestedID(reqID uint64) bool {
 // nextRequest selects the peer and announced head to be requested next, amount
 // to be downloaded starting from the head backwards is also returned
 func (f *fastLightFetcher) nextRequest() (*distReq, uint64, bool) {
+	if f.pm.eclipse.risky() {
+		return nil, 0, false
+	}
 	var (
 		bestHash   common.Hash
 		bestAmount uint64
@@ -404,6 +407,7 @@ func (f *fastLightFetcher) nextRequest() (*distReq, uint64, bool) {
 	reqID := genReqID()
 	if !bestSyncing {
 		rq = &distReq{
+			priority: prioritySync,
 			getCost: func(dp distPeer) uint64 {
 				p := dp.(*peer)
 				return p.GetRequestCost(GetFastBlockHeadersMsg, int(bestAmount))
@@ -19,6 +19,7 @@ package les
 import (
 	"math/big"
 	"sync"
+	"sync/atomic"
 	"time"
 	"truechain/discovery/light/public"
 
@@ -61,6 +62,10 @@ type lightFetcher struct {
 	lastTrustedHeader *types.SnailHeader
 	fastFetcher       *fastLightFetcher
 	fastSync          bool
+
+	// Servers announcing a head required before fetching it outside ultra light
+	// mode, capped by the servers connected. Accessed atomically.
+	announceConfirms int32
 }
 
 // lightChain extends the BlockChain interface by locking.
@@ -134,7 +139,7 @@ func newLightFetcher(pm *ProtocolManager) *lightFetcher {
 	pm.peers.notify(f)
 
 	f.pm.wg.Add(1)
-	go f.syncLoop()
+	goLabeled("fetcher", func(*routine) { f.syncLoop() })
 	return f
 }
 
@@ -423,6 +428,9 @@ func (f *lightFetcher) requestedID(reqID uint64) bool {
 // nextRequest selects the peer and announced head to be requested next, amount
 // to be downloaded starting from the head backwards is also returned
 func (f *lightFetcher) nextRequest() (*distReq, uint64, bool) {
+	if f.pm.eclipse.risky() {
+		return nil, 0, false
+	}
 	var (
 		bestHash    common.Hash
 		bestAmount  uint64
@@ -474,9 +482,23 @@ func (f *lightFetcher) findBestRequest() (bestHash common.Hash, bestAmount uint6
 
 // isTrustedHash checks if the block can be trusted by the minimum trusted fraction.
 func (f *lightFetcher) isTrustedHash(hash common.Hash) bool {
-	// If ultra light cliet mode is disabled, trust all hashes
+	// If ultra light cliet mode is disabled, trust the hashes announced by
+	// enough servers
 	if f.pm.ulc == nil {
-		return true
+		need := int(atomic.LoadInt32(&f.announceConfirms))
+		if need > len(f.peers) {
+			need = len(f.peers)
+		}
+		if need <= 1 {
+			return true
+		}
+		var announced int
+		for _, info := range f.peers {
+			if info.nodeByHash[hash] != nil {
+				announced++
+			}
+		}
+		return announced >= need
 	}
 	// Ultra light enabled, only trust after enough confirmations
 	var agreed int
@@ -485,11 +507,21 @@ func (f *lightFetcher) isTrustedHash(hash common.Hash) bool {
 			agreed++
 		}
 	}
-	return 100*agreed/len(f.pm.ulc.keys) >= f.pm.ulc.fraction
+	return 100*agreed/f.pm.ulc.count() >= f.pm.ulc.fraction
+}
+
+// setAnnounceConfirms sets the number of servers announcing a head required
+// before fetching it outside ultra light mode.
+func (f *lightFetcher) setAnnounceConfirms(n int) {
+	if n < 1 {
+		n = 1
+	}
+	atomic.StoreInt32(&f.announceConfirms, int32(n))
 }
 
 func (f *lightFetcher) newFetcherDistReqForSync(bestHash common.Hash) *distReq {
 	return &distReq{
+		priority: prioritySync,
 		getCost: func(dp distPeer) uint64 {
 			return 0
 		},
@@ -523,6 +555,7 @@ func (f *lightFetcher) newFetcherDistReqForSync(bestHash common.Hash) *distReq {
 // newFetcherDistReq creates a new request for the distributor.
 func (f *lightFetcher) newFetcherDistReq(bestHash common.Hash, reqID uint64, bestAmount uint64) *distReq {
 	return &distReq{
+		priority: prioritySync,
 		getCost: func(dp distPeer) uint64 {
 			p := dp.(*peer)
 			return p.GetRequestCost(GetSnailBlockHeadersMsg, int(bestAmount))
@@ -586,6 +619,7 @@ func (f *lightFetcher) processResponse(req fetchRequest, resp fetchResponse) boo
 		fheaders[int(req.amount)-1-i] = resp.fheaders[i]
 		log.Debug("processResponse", "i", i, "head", len(resp.fheaders[i]), "head", header.Number, "hash", header.Hash())
 	}
+	old := f.chain.CurrentHeader()
 	if _, err := f.chain.InsertHeaderChain(headers, fheaders, 1); err != nil {
 		if err == consensus.ErrFutureBlock {
 			return true
@@ -593,6 +627,7 @@ func (f *lightFetcher) processResponse(req fetchRequest, resp fetchResponse) boo
 		log.Debug("Failed to insert header chain", "err", err)
 		return false
 	}
+	f.pm.forkChoices.record("announce", req.peer, req.hash, f.chain, old)
 	tds := make([]*big.Int, len(headers))
 	for i, header := range headers {
 		td := f.chain.GetTd(header.Hash(), header.Number.Uint64())
@@ -0,0 +1,149 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"truechain/discovery/common"
+	"truechain/discovery/core/types"
+	"truechain/discovery/light/fast"
+)
+
+var errInvalidScanRange = errors.New("invalid block range")
+
+// scanLogs retrieves the logs of the given block range emitted by any of the
+// addresses and carrying any of the topics (an empty list matches everything).
+// The compact filters of every block in the range are downloaded and matched
+// locally, so servers don't learn the watched addresses and topics. Receipts
+// are only requested for matching blocks and are verified against the headers.
+func (s *LightEtrue) scanLogs(ctx context.Context, from, to uint64, addresses []common.Address, topics []common.Hash) ([]*types.Log, error) {
+	if from > to {
+		return nil, errInvalidScanRange
+	}
+	var addrItems, topicItems [][]byte
+	for _, addr := range addresses {
+		addrItems = append(addrItems, addr.Bytes())
+	}
+	for _, topic := range topics {
+		topicItems = append(topicItems, topic.Bytes())
+	}
+	var logs []*types.Log
+	for start := from; start <= to; start += MaxBlockFilterFetch {
+		end := start + MaxBlockFilterFetch - 1
+		if end > to || end < start {
+			end = to
+		}
+		headers := make([]*types.Header, 0, end-start+1)
+		for n := start; n <= end; n++ {
+			header, err := s.fblockchain.GetHeaderByNumberOdr(ctx, n)
+			if err != nil {
+				return nil, err
+			}
+			if header == nil {
+				return nil, fmt.Errorf("header #%d not found", n)
+			}
+			headers = append(headers, header)
+		}
+		req := &fast.BlockFiltersRequest{Hashes: make([]common.Hash, len(headers)), LastNumber: end}
+		for i, header := range headers {
+			req.Hashes[i] = header.Hash()
+		}
+		if err := s.odr.FastRetrieve(ctx, req); err != nil {
+			return nil, err
+		}
+		for i, header := range headers {
+			match, err := scanFilterMatch(header, req.Filters[i], addrItems, topicItems)
+			if err != nil {
+				return nil, err
+			}
+			if !match {
+				continue
+			}
+			blockLogs, err := fast.GetBlockLogs(ctx, s.odr, header.Hash(), header.Number.Uint64())
+			if err != nil {
+				return nil, err
+			}
+			for _, txLogs := range blockLogs {
+				for _, log := range txLogs {
+					if scanLogMatch(log, addresses, topics) {
+						log.BlockHash, log.BlockNumber = header.Hash(), header.Number.Uint64()
+						logs = append(logs, log)
+					}
+				}
+			}
+		}
+		if end == to {
+			break
+		}
+	}
+	return logs, nil
+}
+
+// scanFilterMatch checks both the header bloom and the compact filter of a
+// block against the scanned addresses and topics.
+func scanFilterMatch(header *types.Header, filter []byte, addrItems, topicItems [][]byte) (bool, error) {
+	for _, items := range [][][]byte{addrItems, topicItems} {
+		if len(items) == 0 {
+			continue
+		}
+		inBloom := false
+		for _, item := range items {
+			if header.Bloom.TestBytes(item) {
+				inBloom = true
+				break
+			}
+		}
+		if !inBloom {
+			return false, nil
+		}
+		match, err := blockFilterMatch(filter, header.Hash(), items)
+		if err != nil || !match {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// scanLogMatch checks a single log against the scanned addresses and topics.
+func scanLogMatch(log *types.Log, addresses []common.Address, topics []common.Hash) bool {
+	if len(addresses) > 0 {
+		found := false
+		for _, addr := range addresses {
+			if log.Address == addr {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(topics) == 0 {
+		return true
+	}
+	for _, topic := range log.Topics {
+		for _, t := range topics {
+			if topic == t {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,163 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"sync"
+	"time"
+
+	"truechain/discovery/common"
+	"truechain/discovery/common/hexutil"
+	"truechain/discovery/core/types"
+	"truechain/discovery/log"
+)
+
+// maxForkChoices is the number of head changes kept in the fork choice log.
+const maxForkChoices = 128
+
+// ForkChoice is a change of the snail chain head, along with the announcement
+// or sync that caused it.
+type ForkChoice struct {
+	Time      time.Time    `json:"time"`
+	Trigger   string       `json:"trigger"`   // "announce" or "sync"
+	Peer      string       `json:"peer"`      // server whose announcement was fetched
+	Announced common.Hash  `json:"announced"` // head announced by the server
+	OldHead   common.Hash  `json:"oldHead"`
+	OldNumber uint64       `json:"oldNumber"`
+	OldTd     *hexutil.Big `json:"oldTd"`
+	NewHead   common.Hash  `json:"newHead"`
+	NewNumber uint64       `json:"newNumber"`
+	NewTd     *hexutil.Big `json:"newTd"`
+	Reorg     bool         `json:"reorg"` // whether the old head left the canonical chain
+	Depth     uint64       `json:"depth"` // number of old canonical headers dropped by the reorg
+}
+
+// ForkBranch is a branch head currently announced by the servers.
+type ForkBranch struct {
+	Head      common.Hash  `json:"head"`
+	Number    uint64       `json:"number"`
+	Td        *hexutil.Big `json:"td"`
+	Peers     []string     `json:"peers"`
+	Canonical bool         `json:"canonical"` // whether the head is on the local canonical chain
+}
+
+// ForkChoiceReport is the weight of the competing branches and the recent fork
+// choice decisions of the light client.
+type ForkChoiceReport struct {
+	Head      common.Hash  `json:"head"`
+	Number    uint64       `json:"number"`
+	Td        *hexutil.Big `json:"td"`
+	Branches  []ForkBranch `json:"branches"`
+	Decisions []ForkChoice `json:"decisions"`
+}
+
+// forkChoiceLog records the recent head changes of the snail chain.
+type forkChoiceLog struct {
+	lock sync.Mutex
+	list []ForkChoice
+}
+
+// record adds the head change since old to the log, if the head changed at all.
+func (l *forkChoiceLog) record(trigger string, p *peer, announced common.Hash, chain BlockChain, old *types.SnailHeader) {
+	if l == nil || old == nil {
+		return
+	}
+	head := chain.CurrentHeader()
+	if head.Hash() == old.Hash() {
+		return
+	}
+	fc := ForkChoice{
+		Time:      time.Now(),
+		Trigger:   trigger,
+		Peer:      p.id,
+		Announced: announced,
+		OldHead:   old.Hash(),
+		OldNumber: old.Number.Uint64(),
+		OldTd:     (*hexutil.Big)(chain.GetTd(old.Hash(), old.Number.Uint64())),
+		NewHead:   head.Hash(),
+		NewNumber: head.Number.Uint64(),
+		NewTd:     (*hexutil.Big)(chain.GetTd(head.Hash(), head.Number.Uint64())),
+	}
+	// Walk back the old branch until it joins the canonical chain
+	for h := old; h != nil && h.Number.Sign() > 0; h = chain.GetHeader(h.ParentHash, h.Number.Uint64()-1) {
+		if canon := chain.GetHeaderByNumber(h.Number.Uint64()); canon != nil && canon.Hash() == h.Hash() {
+			break
+		}
+		fc.Reorg = true
+		fc.Depth++
+	}
+	if fc.Reorg {
+		log.Info("Snail chain reorganised", "trigger", trigger, "peer", p.id, "depth", fc.Depth, "oldTd", fc.OldTd, "newTd", fc.NewTd)
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if len(l.list) == maxForkChoices {
+		copy(l.list, l.list[1:])
+		l.list = l.list[:maxForkChoices-1]
+	}
+	l.list = append(l.list, fc)
+}
+
+// decisions returns the recorded head changes, oldest first.
+func (l *forkChoiceLog) decisions() []ForkChoice {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return append([]ForkChoice{}, l.list...)
+}
+
+// branches groups the heads last announced by the servers.
+func (f *lightFetcher) branches() []ForkBranch {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	var (
+		list  []ForkBranch
+		index = make(map[common.Hash]int)
+	)
+	for p, fp := range f.peers {
+		n := fp.lastAnnounced
+		if n == nil {
+			continue
+		}
+		i, ok := index[n.hash]
+		if !ok {
+			i = len(list)
+			index[n.hash] = i
+			branch := ForkBranch{Head: n.hash, Number: n.number, Td: (*hexutil.Big)(n.td)}
+			if canon := f.chain.GetHeaderByNumber(n.number); canon != nil && canon.Hash() == n.hash {
+				branch.Canonical = true
+			}
+			list = append(list, branch)
+		}
+		list[i].Peers = append(list[i].Peers, p.id)
+	}
+	return list
+}
+
+// forkChoice collects the fork choice report of the light client.
+func (s *LightEtrue) forkChoice() *ForkChoiceReport {
+	head := s.blockchain.CurrentHeader()
+	return &ForkChoiceReport{
+		Head:      head.Hash(),
+		Number:    head.Number.Uint64(),
+		Td:        (*hexutil.Big)(s.blockchain.GetTd(head.Hash(), head.Number.Uint64())),
+		Branches:  s.protocolManager.fetcher.branches(),
+		Decisions: s.protocolManager.forkChoices.decisions(),
+	}
+}
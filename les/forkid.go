@@ -0,0 +1,223 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"sort"
+
+	"truechain/discovery/common"
+	"truechain/discovery/params"
+)
+
+var (
+	// errRemoteStale is returned if a peer is at a fork of the local chain, but
+	// is unaware of the next fork the local node has already passed.
+	errRemoteStale = errors.New("remote needs update")
+
+	// errLocalIncompatibleOrStale is returned if a peer is on another chain, or
+	// has passed a fork the local node doesn't know of.
+	errLocalIncompatibleOrStale = errors.New("local incompatible or needs update")
+)
+
+// forkID is an EIP-2124 style identifier of the chain a node follows: a
+// checksum of the genesis hash and the fork blocks passed, and the next fork
+// block known (0 if none).
+type forkID struct {
+	Hash [4]byte
+	Next uint64
+}
+
+// forkFilter computes the fork ID of a chain of the local node and checks the
+// ones of the peers against it.
+type forkFilter struct {
+	forks []uint64  // fork block numbers, ascending
+	sums  [][4]byte // checksum after passing each fork, sums[0] covers the genesis only
+}
+
+// newForkFilter creates the fork filter of a chain with the given genesis and
+// fork blocks. The forks at genesis are left out, they can't tell chains apart.
+func newForkFilter(genesis common.Hash, forks []uint64) *forkFilter {
+	sort.Slice(forks, func(i, j int) bool { return forks[i] < forks[j] })
+
+	f := &forkFilter{}
+	hash := crc32.ChecksumIEEE(genesis[:])
+	f.sums = append(f.sums, checksumBytes(hash))
+	for _, fork := range forks {
+		if fork == 0 || (len(f.forks) > 0 && f.forks[len(f.forks)-1] == fork) {
+			continue
+		}
+		var blob [8]byte
+		binary.BigEndian.PutUint64(blob[:], fork)
+		hash = crc32.Update(hash, crc32.IEEETable, blob[:])
+		f.forks = append(f.forks, fork)
+		f.sums = append(f.sums, checksumBytes(hash))
+	}
+	return f
+}
+
+// id returns the fork ID of the chain at the given head.
+func (f *forkFilter) id(head uint64) forkID {
+	for i, fork := range f.forks {
+		if head < fork {
+			return forkID{Hash: f.sums[i], Next: fork}
+		}
+	}
+	return forkID{Hash: f.sums[len(f.sums)-1]}
+}
+
+// validate checks the fork ID of a peer against the local chain at the given
+// head, following the rules of EIP-2124.
+func (f *forkFilter) validate(remote forkID, head uint64) error {
+	// Find the forks passed locally
+	passed := len(f.forks)
+	for i, fork := range f.forks {
+		if head < fork {
+			passed = i
+			break
+		}
+	}
+	// Same forks passed: the peer must not announce a fork already passed locally
+	if f.sums[passed] == remote.Hash {
+		if remote.Next > 0 && head >= remote.Next {
+			return errLocalIncompatibleOrStale
+		}
+		return nil
+	}
+	// Fewer forks passed by the peer: it must know the next one of them
+	for i := 0; i < passed; i++ {
+		if f.sums[i] == remote.Hash {
+			if f.forks[i] != remote.Next {
+				return errRemoteStale
+			}
+			return nil
+		}
+	}
+	// More forks passed by the peer: the local node is syncing
+	for i := passed + 1; i < len(f.sums); i++ {
+		if f.sums[i] == remote.Hash {
+			return nil
+		}
+	}
+	return errLocalIncompatibleOrStale
+}
+
+func checksumBytes(hash uint32) [4]byte {
+	var blob [4]byte
+	binary.BigEndian.PutUint32(blob[:], hash)
+	return blob
+}
+
+// chainForks returns the fast and the snail fork blocks of a chain config. A
+// new fork of the chain config has to be added to the list.
+func chainForks(config *params.ChainConfig) (fastForks, snailForks []uint64) {
+	forks := []*params.BlockConfig{
+		config.TIP3, config.TIP5, config.TIP7, config.TIP8, config.TIP9,
+		config.TIP10, config.TIP11, config.TIPStake,
+	}
+	for _, bc := range forks {
+		if bc == nil {
+			continue
+		}
+		if bc.FastNumber != nil && bc.FastNumber.Sign() > 0 {
+			fastForks = append(fastForks, bc.FastNumber.Uint64())
+		}
+		if bc.SnailNumber != nil && bc.SnailNumber.Sign() > 0 {
+			snailForks = append(snailForks, bc.SnailNumber.Uint64())
+		}
+	}
+	return fastForks, snailForks
+}
+
+// checkpointStatus identifies a trusted checkpoint in the handshake.
+type checkpointStatus struct {
+	SectionIndex  uint64
+	SectionBIndex uint64
+	Hash          common.Hash
+}
+
+// chainStatus is the fork IDs of both chains and the latest trusted checkpoint
+// of the local node, exchanged in the handshake so that peers following another
+// chain are told apart before syncing from them.
+type chainStatus struct {
+	ForkID      forkID
+	SnailForkID forkID
+	Checkpoint  *checkpointStatus // nil if none
+}
+
+// chainStatus returns the status of the local chains at the given heads.
+func (pm *ProtocolManager) chainStatus(fastHead, snailHead uint64) *chainStatus {
+	status := &chainStatus{
+		ForkID:      pm.fastForks.id(fastHead),
+		SnailForkID: pm.snailForks.id(snailHead),
+	}
+	var cp *params.TrustedCheckpoint
+	if pm.client {
+		cp = pm.trustedCheckpoint()
+	} else if pm.server != nil {
+		latest := pm.server.latestLocalCheckpoint()
+		cp = &latest
+	}
+	if cp != nil && !cp.Empty() {
+		status.Checkpoint = &checkpointStatus{SectionIndex: cp.SectionIndex, SectionBIndex: cp.SectionBIndex, Hash: cp.Hash()}
+	}
+	return status
+}
+
+// checkChainStatus validates the fork IDs and the trusted checkpoint sent by a
+// peer in the handshake. Peers of older versions not sending them are accepted.
+// A server checks the checkpoint of a client against the one it generated for
+// the same section, a client only compares it to its own.
+func (pm *ProtocolManager) checkChainStatus(p *peer, fastHead, snailHead uint64) error {
+	if p.forkID != nil {
+		if err := pm.fastForks.validate(*p.forkID, fastHead); err != nil {
+			handshakeForkMeter.Mark(1)
+			return errResp(ErrForkIDMismatch, "fast chain: %v", err)
+		}
+	}
+	if p.snailForkID != nil {
+		if err := pm.snailForks.validate(*p.snailForkID, snailHead); err != nil {
+			handshakeForkMeter.Mark(1)
+			return errResp(ErrForkIDMismatch, "snail chain: %v", err)
+		}
+	}
+	remote := p.trustedCheckpoint
+	if remote == nil {
+		return nil
+	}
+	var local *params.TrustedCheckpoint
+	if pm.client {
+		local = pm.trustedCheckpoint()
+	} else if pm.server != nil {
+		sections, _, _ := pm.server.chtIndexer.Sections()
+		bSections, _, _ := pm.server.bloomTrieIndexer.Sections()
+		if remote.SectionIndex < sections && remote.SectionBIndex < bSections {
+			cp := pm.server.getLocalCheckpoint(remote.SectionIndex, remote.SectionBIndex)
+			local = &cp
+		}
+	}
+	if local == nil || local.Empty() || local.SectionIndex != remote.SectionIndex || local.SectionBIndex != remote.SectionBIndex {
+		return nil
+	}
+	if hash := local.Hash(); hash != remote.Hash {
+		handshakeCheckpointMeter.Mark(1)
+		return errResp(ErrCheckpointMismatch, "section %d: %x (!= %x)", remote.SectionIndex, remote.Hash[:8], hash[:8])
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+
+	"truechain/discovery/common"
+	"truechain/discovery/params"
+)
+
+// Tests that the fork ID of a chain changes at each fork, the forks at genesis
+// and the repeated ones being left out.
+func TestForkID(t *testing.T) {
+	f := newForkFilter(common.Hash{1}, []uint64{300, 0, 100, 200, 100})
+	if !reflect.DeepEqual(f.forks, []uint64{100, 200, 300}) {
+		t.Fatalf("fork list mismatch: have %v, want [100 200 300]", f.forks)
+	}
+	tests := []struct {
+		head uint64
+		want forkID
+	}{
+		{0, forkID{Hash: f.sums[0], Next: 100}},
+		{99, forkID{Hash: f.sums[0], Next: 100}},
+		{100, forkID{Hash: f.sums[1], Next: 200}},
+		{299, forkID{Hash: f.sums[2], Next: 300}},
+		{300, forkID{Hash: f.sums[3]}},
+		{10000, forkID{Hash: f.sums[3]}},
+	}
+	for i, tt := range tests {
+		if have := f.id(tt.head); have != tt.want {
+			t.Errorf("test %d: fork ID mismatch: have %x, want %x", i, have, tt.want)
+		}
+	}
+	if other := newForkFilter(common.Hash{2}, []uint64{100, 200, 300}); other.id(0).Hash == f.id(0).Hash {
+		t.Error("fork ID of another genesis matches")
+	}
+}
+
+// Tests the validation of the fork IDs of the peers along the rules of EIP-2124.
+func TestForkIDValidation(t *testing.T) {
+	f := newForkFilter(common.Hash{1}, []uint64{100, 200, 300})
+
+	tests := []struct {
+		head uint64
+		id   forkID
+		err  error
+	}{
+		// Local is at a fork, remote announces the same fork and the next one
+		{150, forkID{Hash: f.sums[1], Next: 200}, nil},
+
+		// Local is at a fork, remote is unaware of the next one. The remote
+		// isn't stale until the local node passes that fork.
+		{150, forkID{Hash: f.sums[1], Next: 0}, nil},
+
+		// Local is at a fork, remote announces another next fork which the
+		// local node hasn't passed yet (only one of them can be right)
+		{150, forkID{Hash: f.sums[1], Next: 250}, nil},
+
+		// Local and remote are past all forks
+		{350, forkID{Hash: f.sums[3], Next: 0}, nil},
+
+		// Local is past all forks, remote announces a fork which the local
+		// node has passed without knowing of it
+		{350, forkID{Hash: f.sums[3], Next: 320}, errLocalIncompatibleOrStale},
+		{150, forkID{Hash: f.sums[1], Next: 150}, errLocalIncompatibleOrStale},
+
+		// Remote is syncing behind a fork which it knows of
+		{250, forkID{Hash: f.sums[1], Next: 200}, nil},
+		{350, forkID{Hash: f.sums[0], Next: 100}, nil},
+
+		// Remote is behind a fork which it doesn't know of
+		{250, forkID{Hash: f.sums[1], Next: 0}, errRemoteStale},
+		{350, forkID{Hash: f.sums[1], Next: 250}, errRemoteStale},
+
+		// Local is syncing behind forks which the remote has passed
+		{50, forkID{Hash: f.sums[1], Next: 200}, nil},
+		{50, forkID{Hash: f.sums[3], Next: 0}, nil},
+		{150, forkID{Hash: f.sums[3], Next: 0}, nil},
+
+		// Remote is on another chain or past a fork the local node doesn't know
+		{150, forkID{Hash: [4]byte{0xde, 0xad, 0xbe, 0xef}, Next: 0}, errLocalIncompatibleOrStale},
+		{350, forkID{Hash: newForkFilter(common.Hash{1}, []uint64{100, 200, 300, 400}).sums[4]}, errLocalIncompatibleOrStale},
+		{350, forkID{Hash: newForkFilter(common.Hash{2}, []uint64{100, 200, 300}).sums[3]}, errLocalIncompatibleOrStale},
+	}
+	for i, tt := range tests {
+		if err := f.validate(tt.id, tt.head); err != tt.err {
+			t.Errorf("test %d: validation error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+}
+
+// Tests that the fork blocks of all the forks of a chain config are gathered.
+func TestChainForks(t *testing.T) {
+	config := &params.ChainConfig{
+		TIP3:     &params.BlockConfig{FastNumber: big.NewInt(10)},
+		TIP5:     &params.BlockConfig{SnailNumber: big.NewInt(20)},
+		TIP7:     &params.BlockConfig{FastNumber: big.NewInt(30), SnailNumber: big.NewInt(40)},
+		TIP8:     &params.BlockConfig{FastNumber: big.NewInt(50)},
+		TIP9:     &params.BlockConfig{SnailNumber: big.NewInt(60)},
+		TIP10:    &params.BlockConfig{FastNumber: big.NewInt(70)},
+		TIP11:    &params.BlockConfig{FastNumber: big.NewInt(0)},
+		TIPStake: &params.BlockConfig{FastNumber: big.NewInt(80)},
+	}
+	fast, snail := chainForks(config)
+	if want := []uint64{10, 30, 50, 70, 80}; !reflect.DeepEqual(fast, want) {
+		t.Errorf("fast forks mismatch: have %v, want %v", fast, want)
+	}
+	if want := []uint64{20, 40, 60}; !reflect.DeepEqual(snail, want) {
+		t.Errorf("snail forks mismatch: have %v, want %v", snail, want)
+	}
+	if fast, snail := chainForks(&params.ChainConfig{}); len(fast) != 0 || len(snail) != 0 {
+		t.Errorf("forks of an empty config: %v, %v", fast, snail)
+	}
+}
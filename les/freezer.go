@@ -0,0 +1,390 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"truechain/discovery/common"
+	"truechain/discovery/core/rawdb"
+	snailrawdb "truechain/discovery/core/snailchain/rawdb"
+	"truechain/discovery/crypto"
+	"truechain/discovery/etruedb"
+	"truechain/discovery/light/public"
+	"truechain/discovery/log"
+	"truechain/discovery/params"
+)
+
+const (
+	freezeInterval   = 10 * time.Minute // time between two moves of headers to the freezer
+	freezeBatch      = 2048             // headers appended to a freezer table at once
+	freezerIndexSize = 12               // offset (8 bytes) and length (4 bytes) of a header in the data file
+)
+
+// freezerTable is an append-only flat file store of the canonical headers of a
+// chain, by number. The headers are appended to the data file, the index file
+// holds the position of the header of every number, with zero length if the
+// header wasn't stored locally when the table was extended.
+type freezerTable struct {
+	lock  sync.RWMutex
+	index *os.File
+	data  *os.File
+	items uint64 // numbers covered by the index
+	size  uint64 // size of the data file
+}
+
+// openFreezerTable opens or creates the files of a freezer table, repairing
+// the ones left behind by a crash.
+func openFreezerTable(dir, name string) (*freezerTable, error) {
+	index, err := os.OpenFile(filepath.Join(dir, name+".idx"), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.OpenFile(filepath.Join(dir, name+".dat"), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		index.Close()
+		return nil, err
+	}
+	t := &freezerTable{index: index, data: data}
+	if err := t.repair(); err != nil {
+		t.close()
+		return nil, err
+	}
+	return t, nil
+}
+
+// repair brings the index and the data file back in line. A partially written
+// index entry is dropped, and so are the entries of data lost from the end of
+// the data file, their headers are frozen again (as missing if they have been
+// deleted from LevelDB already). Data not referenced by the index is truncated.
+func (t *freezerTable) repair() error {
+	stat, err := t.data.Stat()
+	if err != nil {
+		return err
+	}
+	size := uint64(stat.Size())
+	if stat, err = t.index.Stat(); err != nil {
+		return err
+	}
+	t.items, t.size = uint64(stat.Size())/freezerIndexSize, 0
+	for ; t.items > 0; t.items-- {
+		var entry [freezerIndexSize]byte
+		if _, err := t.index.ReadAt(entry[:], int64((t.items-1)*freezerIndexSize)); err != nil {
+			return err
+		}
+		end := binary.BigEndian.Uint64(entry[:8]) + uint64(binary.BigEndian.Uint32(entry[8:]))
+		if end <= size {
+			t.size = end
+			break
+		}
+	}
+	if err := t.index.Truncate(int64(t.items * freezerIndexSize)); err != nil {
+		return err
+	}
+	return t.data.Truncate(int64(t.size))
+}
+
+// frozen returns the number of numbers covered by the table.
+func (t *freezerTable) frozen() uint64 {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	return t.items
+}
+
+// retrieve returns the header of a number, nil if it isn't in the table.
+func (t *freezerTable) retrieve(number uint64) []byte {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	if number >= t.items {
+		return nil
+	}
+	var entry [freezerIndexSize]byte
+	if _, err := t.index.ReadAt(entry[:], int64(number*freezerIndexSize)); err != nil {
+		return nil
+	}
+	offset, length := binary.BigEndian.Uint64(entry[:8]), binary.BigEndian.Uint32(entry[8:])
+	if length == 0 {
+		return nil
+	}
+	blob := make([]byte, length)
+	if _, err := t.data.ReadAt(blob, int64(offset)); err != nil {
+		return nil
+	}
+	return blob
+}
+
+// append adds the headers of the next numbers to the table, nil for the ones
+// not stored locally. The data is synced to disk before the index referencing
+// it, so that a crash never leaves an index entry of missing data.
+func (t *freezerTable) append(blobs [][]byte) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	var (
+		index = make([]byte, 0, len(blobs)*freezerIndexSize)
+		data  []byte
+		entry [freezerIndexSize]byte
+	)
+	for _, blob := range blobs {
+		binary.BigEndian.PutUint64(entry[:8], t.size+uint64(len(data)))
+		binary.BigEndian.PutUint32(entry[8:], uint32(len(blob)))
+		index = append(index, entry[:]...)
+		data = append(data, blob...)
+	}
+	if _, err := t.data.WriteAt(data, int64(t.size)); err != nil {
+		return err
+	}
+	if err := t.data.Sync(); err != nil {
+		return err
+	}
+	if _, err := t.index.WriteAt(index, int64(t.items*freezerIndexSize)); err != nil {
+		return err
+	}
+	if err := t.index.Sync(); err != nil {
+		return err
+	}
+	t.items += uint64(len(blobs))
+	t.size += uint64(len(data))
+	return nil
+}
+
+func (t *freezerTable) close() {
+	t.index.Close()
+	t.data.Close()
+}
+
+// freezerDB is the chain database of a light client keeping the canonical
+// headers older than the trusted checkpoint in freezer tables instead of
+// LevelDB. Headers missing from LevelDB are looked up in the tables, all other
+// data is stored in LevelDB as before.
+type freezerDB struct {
+	*etruedb.LDBDatabase
+	snail, fast *freezerTable
+}
+
+// NewFreezerDB opens the freezer tables in the directory of a LevelDB chain
+// database. Databases which aren't persistent are returned unchanged. The light
+// client and the database commands open the light chain database through it.
+func NewFreezerDB(db etruedb.Database) (etruedb.Database, error) {
+	ldb, ok := db.(*etruedb.LDBDatabase)
+	if !ok {
+		log.Warn("Header freezer only works with a LevelDB chain database")
+		return db, nil
+	}
+	dir := filepath.Join(ldb.Path(), "ancient")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	snail, err := openFreezerTable(dir, "snailheaders")
+	if err != nil {
+		return nil, err
+	}
+	fast, err := openFreezerTable(dir, "headers")
+	if err != nil {
+		snail.close()
+		return nil, err
+	}
+	log.Info("Opened header freezer", "dir", dir, "snail", snail.items, "fast", fast.items)
+	return &freezerDB{LDBDatabase: ldb, snail: snail, fast: fast}, nil
+}
+
+// Get retrieves a value from LevelDB, or a frozen header from the tables.
+func (db *freezerDB) Get(key []byte) ([]byte, error) {
+	data, err := db.LDBDatabase.Get(key)
+	if err != nil {
+		if blob := db.retrieve(key); blob != nil {
+			return blob, nil
+		}
+	}
+	return data, err
+}
+
+// Has checks whether a value is in LevelDB or a frozen header in the tables.
+func (db *freezerDB) Has(key []byte) (bool, error) {
+	has, err := db.LDBDatabase.Has(key)
+	if err == nil && !has && db.retrieve(key) != nil {
+		return true, nil
+	}
+	return has, err
+}
+
+// retrieve returns the frozen header of a header key, nil if the key isn't one
+// or the header isn't frozen.
+func (db *freezerDB) retrieve(key []byte) []byte {
+	table := db.fast
+	number, hash, ok := rawdb.SplitHeaderKey(key)
+	if !ok {
+		if number, hash, ok = snailrawdb.SplitHeaderKey(key); !ok {
+			return nil
+		}
+		table = db.snail
+	}
+	// Only the canonical header of a number is frozen, check the hash
+	blob := table.retrieve(number)
+	if blob == nil || crypto.Keccak256Hash(blob) != hash {
+		return nil
+	}
+	return blob
+}
+
+// Close closes the freezer tables and LevelDB.
+func (db *freezerDB) Close() {
+	db.snail.close()
+	db.fast.close()
+	db.LDBDatabase.Close()
+}
+
+// headerFreezer periodically moves the canonical headers older than the latest
+// trusted checkpoint from LevelDB to the freezer tables. They can't be reorged
+// anymore, so they are never written again, which keeps them out of the
+// compactions of LevelDB. Headers retrieved on demand after their number has
+// been frozen stay in LevelDB.
+type headerFreezer struct {
+	db         *freezerDB
+	config     *public.IndexerConfig
+	checkpoint func() *params.TrustedCheckpoint
+
+	quit chan struct{}
+	wg   *sync.WaitGroup // tracks the freezing loop of the light client
+}
+
+// newHeaderFreezer creates the header freezer of a chain database, nil if the
+// database has no freezer tables.
+func newHeaderFreezer(db etruedb.Database, config *public.IndexerConfig, checkpoint func() *params.TrustedCheckpoint, wg *sync.WaitGroup) *headerFreezer {
+	fdb, ok := db.(*freezerDB)
+	if !ok {
+		return nil
+	}
+	return &headerFreezer{
+		db:         fdb,
+		config:     config,
+		checkpoint: checkpoint,
+		quit:       make(chan struct{}),
+		wg:         wg,
+	}
+}
+
+// start starts moving headers to the freezer.
+func (f *headerFreezer) start() {
+	if f == nil {
+		return
+	}
+	f.wg.Add(1)
+	go f.loop()
+}
+
+// stop stops moving headers to the freezer.
+func (f *headerFreezer) stop() {
+	if f == nil {
+		return
+	}
+	close(f.quit)
+}
+
+func (f *headerFreezer) loop() {
+	defer f.wg.Done()
+
+	ticker := time.NewTicker(freezeInterval)
+	defer ticker.Stop()
+
+	for {
+		f.freeze()
+		select {
+		case <-ticker.C:
+		case <-f.quit:
+			return
+		}
+	}
+}
+
+// freeze moves the headers of the sections covered by the trusted checkpoint.
+func (f *headerFreezer) freeze() {
+	cp := f.checkpoint()
+	if cp == nil || cp.Empty() {
+		return
+	}
+	start := time.Now()
+	snail, err := f.freezeTable(f.db.snail, (cp.SectionIndex+1)*f.config.ChtSize, func(number uint64) (common.Hash, []byte) {
+		hash := snailrawdb.ReadCanonicalHash(f.db.LDBDatabase, number)
+		return hash, snailrawdb.ReadHeaderRLP(f.db.LDBDatabase, hash, number)
+	}, func(db etruedb.Deleter, hash common.Hash, number uint64) {
+		snailrawdb.DeleteHeaderRLP(db, hash, number)
+	})
+	if err != nil {
+		log.Error("Failed to freeze snail headers", "err", err)
+		return
+	}
+	fast, err := f.freezeTable(f.db.fast, (cp.SectionBIndex+1)*f.config.BloomSize, func(number uint64) (common.Hash, []byte) {
+		hash := rawdb.ReadCanonicalHash(f.db.LDBDatabase, number)
+		return hash, rawdb.ReadHeaderRLP(f.db.LDBDatabase, hash, number)
+	}, func(db etruedb.Deleter, hash common.Hash, number uint64) {
+		rawdb.DeleteHeaderRLP(db, hash, number)
+	})
+	if err != nil {
+		log.Error("Failed to freeze fast headers", "err", err)
+		return
+	}
+	if snail > 0 || fast > 0 {
+		log.Info("Moved headers to the freezer", "snail", snail, "fast", fast, "elapsed", common.PrettyDuration(time.Since(start)))
+	}
+}
+
+// freezeTable appends the canonical headers below the limit to a table and
+// deletes them from LevelDB. It returns the number of headers moved.
+func (f *headerFreezer) freezeTable(t *freezerTable, limit uint64, canonical func(uint64) (common.Hash, []byte), remove func(etruedb.Deleter, common.Hash, uint64)) (uint64, error) {
+	var moved uint64
+	for from := t.frozen(); from < limit; from = t.frozen() {
+		select {
+		case <-f.quit:
+			return moved, nil
+		default:
+		}
+		to := from + freezeBatch
+		if to > limit {
+			to = limit
+		}
+		var (
+			hashes = make([]common.Hash, 0, to-from)
+			blobs  = make([][]byte, 0, to-from)
+		)
+		for number := from; number < to; number++ {
+			hash, blob := canonical(number)
+			hashes = append(hashes, hash)
+			blobs = append(blobs, blob)
+		}
+		if err := t.append(blobs); err != nil {
+			return moved, err
+		}
+		batch := f.db.LDBDatabase.NewBatch()
+		for i, blob := range blobs {
+			if len(blob) > 0 {
+				remove(batch, hashes[i], from+uint64(i))
+				moved++
+			}
+		}
+		if err := batch.Write(); err != nil {
+			return moved, err
+		}
+	}
+	return moved, nil
+}
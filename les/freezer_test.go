@@ -0,0 +1,233 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"truechain/discovery/core/rawdb"
+	"truechain/discovery/core/types"
+	"truechain/discovery/etruedb"
+	"truechain/discovery/rlp"
+)
+
+// testFreezerBlobs returns the items appended to the test tables, the ones of
+// the numbers not stored locally being nil.
+func testFreezerBlobs(n int) [][]byte {
+	blobs := make([][]byte, n)
+	for i := range blobs {
+		if i%5 != 3 {
+			blobs[i] = []byte(fmt.Sprintf("header-%d", i))
+		}
+	}
+	return blobs
+}
+
+// checkFreezerTable checks that the table holds the given items.
+func checkFreezerTable(t *testing.T, table *freezerTable, blobs [][]byte) {
+	t.Helper()
+
+	if table.frozen() != uint64(len(blobs)) {
+		t.Fatalf("frozen count mismatch: have %d, want %d", table.frozen(), len(blobs))
+	}
+	for i, blob := range blobs {
+		if have := table.retrieve(uint64(i)); !bytes.Equal(have, blob) {
+			t.Errorf("item %d mismatch: have %q, want %q", i, have, blob)
+		}
+	}
+	if have := table.retrieve(uint64(len(blobs))); have != nil {
+		t.Errorf("item past the end retrieved: %q", have)
+	}
+}
+
+// reopenFreezerTable closes the table, lets the files be changed and opens it
+// again.
+func reopenFreezerTable(t *testing.T, table *freezerTable, dir string, change func(index, data string)) *freezerTable {
+	table.close()
+	if change != nil {
+		change(filepath.Join(dir, "test.idx"), filepath.Join(dir, "test.dat"))
+	}
+	table, err := openFreezerTable(dir, "test")
+	if err != nil {
+		t.Fatalf("failed to reopen table: %v", err)
+	}
+	return table
+}
+
+// truncateFile cuts the given number of bytes from the end of a file.
+func truncateFile(t *testing.T, path string, cut int64) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(path, stat.Size()-cut); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Tests that the items appended to a freezer table are retrieved, also after
+// reopening it.
+func TestFreezerTableReopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freezer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	table, err := openFreezerTable(dir, "test")
+	if err != nil {
+		t.Fatalf("failed to open table: %v", err)
+	}
+	blobs := testFreezerBlobs(20)
+	if err := table.append(blobs[:12]); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	if err := table.append(blobs[12:]); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	checkFreezerTable(t, table, blobs)
+
+	table = reopenFreezerTable(t, table, dir, nil)
+	defer table.close()
+	checkFreezerTable(t, table, blobs)
+}
+
+// Tests that a table left behind by a crash is repaired on opening and can be
+// extended again.
+func TestFreezerTableRepair(t *testing.T) {
+	blobs := testFreezerBlobs(10)
+	last := int64(len(blobs[len(blobs)-1]))
+
+	tests := []struct {
+		name   string
+		change func(index, data string)
+		items  int // items left after the repair
+	}{
+		{"partial index entry", func(index, data string) {
+			truncateFile(t, index, freezerIndexSize/2)
+		}, 9},
+		{"truncated data", func(index, data string) {
+			truncateFile(t, data, last/2)
+		}, 9},
+		{"data of several items lost", func(index, data string) {
+			truncateFile(t, data, last+int64(len(blobs[len(blobs)-2]))+1)
+		}, 7},
+		{"data lost, index entry partial", func(index, data string) {
+			truncateFile(t, index, 1)
+			truncateFile(t, data, last+1)
+		}, 7},
+		{"data without index entry", func(index, data string) {
+			truncateFile(t, index, freezerIndexSize)
+		}, 9},
+		{"empty data file", func(index, data string) {
+			if err := os.Truncate(data, 0); err != nil {
+				t.Fatal(err)
+			}
+		}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "freezer")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			table, err := openFreezerTable(dir, "test")
+			if err != nil {
+				t.Fatalf("failed to open table: %v", err)
+			}
+			if err := table.append(blobs); err != nil {
+				t.Fatalf("failed to append: %v", err)
+			}
+			table = reopenFreezerTable(t, table, dir, tt.change)
+			checkFreezerTable(t, table, blobs[:tt.items])
+
+			// The dropped items are frozen again and the table reopens intact
+			if err := table.append(blobs[tt.items:]); err != nil {
+				t.Fatalf("failed to append: %v", err)
+			}
+			checkFreezerTable(t, table, blobs)
+			table = reopenFreezerTable(t, table, dir, nil)
+			defer table.close()
+			checkFreezerTable(t, table, blobs)
+		})
+	}
+}
+
+// Tests that the canonical headers in the tables are read through the freezer
+// database once deleted from LevelDB, and that no other data is.
+func TestFreezerDB(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freezer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ldb, err := etruedb.NewLDBDatabase(dir, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := NewFreezerDB(ldb)
+	if err != nil {
+		t.Fatalf("failed to open freezer: %v", err)
+	}
+	fdb := db.(*freezerDB)
+
+	var blobs [][]byte
+	headers := make([]*types.Header, 3)
+	for i := range headers {
+		headers[i] = &types.Header{Number: big.NewInt(int64(i)), SnailNumber: new(big.Int), Time: new(big.Int)}
+		enc, _ := rlp.EncodeToBytes(headers[i])
+		blobs = append(blobs, enc)
+	}
+	if err := fdb.fast.append(blobs); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	for i, header := range headers {
+		if have := rawdb.ReadHeader(db, header.Hash(), uint64(i)); have == nil || have.Hash() != header.Hash() {
+			t.Errorf("frozen header %d not read", i)
+		}
+	}
+	// A header of another hash at a frozen number isn't found
+	other := &types.Header{Number: big.NewInt(1), SnailNumber: new(big.Int), Time: big.NewInt(1)}
+	if rawdb.ReadHeader(db, other.Hash(), 1) != nil {
+		t.Error("non-canonical header read from the freezer")
+	}
+	if has, _ := db.Has([]byte("unknown")); has {
+		t.Error("unknown key found")
+	}
+	db.Close()
+
+	// The tables are opened again along with the database
+	if ldb, err = etruedb.NewLDBDatabase(dir, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if db, err = NewFreezerDB(ldb); err != nil {
+		t.Fatalf("failed to reopen freezer: %v", err)
+	}
+	defer db.Close()
+	if rawdb.ReadHeader(db, headers[2].Hash(), 2) == nil {
+		t.Error("frozen header not read after reopening")
+	}
+}
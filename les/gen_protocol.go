@@ -0,0 +1,590 @@
+// Code generated by mkspec.go from protocol_spec.json. DO NOT EDIT.
+
+package les
+
+// Number of implemented message corresponding to different protocol versions.
+var ProtocolLengths = map[uint]uint64{
+	lpv2: 37,
+	lpv3: 37,
+}
+
+// les protocol message codes
+const (
+	// Protocol messages inherited from LPV1
+	StatusMsg               = 0x00
+	AnnounceMsg             = 0x01
+	GetFastBlockHeadersMsg  = 0x02
+	FastBlockHeadersMsg     = 0x03
+	GetFastBlockBodiesMsg   = 0x04
+	FastBlockBodiesMsg      = 0x05
+	GetSnailBlockHeadersMsg = 0x06
+	SnailBlockHeadersMsg    = 0x07
+	GetSnailBlockBodiesMsg  = 0x08
+	SnailBlockBodiesMsg     = 0x09
+	GetFruitBodiesMsg       = 0x0a
+	FruitBodiesMsg          = 0x0b
+	GetReceiptsMsg          = 0x0c
+	ReceiptsMsg             = 0x0d
+	// Protocol messages belonging to LPV2
+	GetCodeMsg             = 0x0e
+	CodeMsg                = 0x0f
+	GetProofsV2Msg         = 0x10
+	ProofsV2Msg            = 0x11
+	GetHelperTrieProofsMsg = 0x12
+	HelperTrieProofsMsg    = 0x13
+	SendTxV2Msg            = 0x15
+	GetTxStatusMsg         = 0x16
+	TxStatusMsg            = 0x17
+	// Protocol messages introduced in LPV3
+	StopMsg            = 0x18
+	ResumeMsg          = 0x19
+	GetBlockFiltersMsg = 0x1a
+	BlockFiltersMsg    = 0x1b
+	GetExtensionMsg    = 0x1c
+	ExtensionMsg       = 0x1d
+)
+
+// request limits
+const (
+	MaxHeaderFetch           = 192 // Amount of block headers to be fetched per retrieval request
+	MaxBodyFetch             = 32  // Amount of block bodies to be fetched per retrieval request
+	MaxSnailBodyFetch        = 128 // Amount of block bodies to be fetched per retrieval request
+	MaxFruitBodyFetch        = 128 // Amount of block bodies to be fetched per retrieval request
+	MaxReceiptFetch          = 128 // Amount of transaction receipts to allow fetching per request
+	MaxCodeFetch             = 64  // Amount of contract codes to allow fetching per request
+	MaxProofsFetch           = 64  // Amount of merkle proofs to be fetched per retrieval request
+	MaxHelperTrieProofsFetch = 64  // Amount of merkle proofs to be fetched per retrieval request
+	MaxTxSend                = 64  // Amount of transactions to be send per request
+	MaxTxStatus              = 256 // Amount of transactions to queried per request
+	MaxBlockFilterFetch      = 256 // Amount of compact block filters to be fetched per request
+	MaxExtensionFetch        = 1   // Amount of protocol extension requests to be served per message
+)
+
+var requests = map[uint64]requestInfo{
+	GetFastBlockHeadersMsg:  {"GetBlockHeaders", MaxHeaderFetch},
+	GetFastBlockBodiesMsg:   {"GetBlockBodies", MaxBodyFetch},
+	GetSnailBlockHeadersMsg: {"GetBlockHeaders", MaxHeaderFetch},
+	GetSnailBlockBodiesMsg:  {"GetBlockBodies", MaxBodyFetch},
+	GetFruitBodiesMsg:       {"GetBlockBodies", MaxBodyFetch},
+	GetReceiptsMsg:          {"GetReceipts", MaxReceiptFetch},
+	GetCodeMsg:              {"GetCode", MaxCodeFetch},
+	GetProofsV2Msg:          {"GetProofsV2", MaxProofsFetch},
+	GetHelperTrieProofsMsg:  {"GetHelperTrieProofs", MaxHelperTrieProofsFetch},
+	SendTxV2Msg:             {"SendTxV2", MaxTxSend},
+	GetTxStatusMsg:          {"GetTxStatus", MaxTxStatus},
+	GetBlockFiltersMsg:      {"GetBlockFilters", MaxBlockFilterFetch},
+	GetExtensionMsg:         {"GetExtension", MaxExtensionFetch},
+}
+
+var (
+	// average request cost estimates based on serving time
+	reqAvgTimeCost = requestCostTable{
+		GetFastBlockHeadersMsg:  {150000, 30000},
+		GetFastBlockBodiesMsg:   {0, 700000},
+		GetSnailBlockHeadersMsg: {150000, 30000},
+		GetSnailBlockBodiesMsg:  {0, 7000000},
+		GetFruitBodiesMsg:       {0, 700000},
+		GetReceiptsMsg:          {0, 1000000},
+		GetCodeMsg:              {0, 450000},
+		GetProofsV2Msg:          {0, 600000},
+		GetHelperTrieProofsMsg:  {0, 1000000},
+		SendTxV2Msg:             {0, 450000},
+		GetTxStatusMsg:          {0, 250000},
+		GetBlockFiltersMsg:      {0, 20000},
+		GetExtensionMsg:         {0, 1000000},
+	}
+	// maximum incoming message size estimates
+	reqMaxInSize = requestCostTable{
+		GetFastBlockHeadersMsg:  {40, 0},
+		GetFastBlockBodiesMsg:   {0, 40},
+		GetSnailBlockHeadersMsg: {40, 0},
+		GetSnailBlockBodiesMsg:  {0, 400},
+		GetFruitBodiesMsg:       {0, 40},
+		GetReceiptsMsg:          {0, 40},
+		GetCodeMsg:              {0, 80},
+		GetProofsV2Msg:          {0, 80},
+		GetHelperTrieProofsMsg:  {0, 20},
+		SendTxV2Msg:             {0, 16500},
+		GetTxStatusMsg:          {0, 50},
+		GetBlockFiltersMsg:      {0, 40},
+		GetExtensionMsg:         {0, 1000},
+	}
+	// maximum outgoing message size estimates
+	reqMaxOutSize = requestCostTable{
+		GetFastBlockHeadersMsg:  {0, 556},
+		GetFastBlockBodiesMsg:   {0, 100000},
+		GetSnailBlockHeadersMsg: {0, 556},
+		GetSnailBlockBodiesMsg:  {0, 1000000},
+		GetFruitBodiesMsg:       {0, 100000},
+		GetReceiptsMsg:          {0, 200000},
+		GetCodeMsg:              {0, 50000},
+		GetProofsV2Msg:          {0, 4000},
+		GetHelperTrieProofsMsg:  {0, 4000},
+		SendTxV2Msg:             {0, 100},
+		GetTxStatusMsg:          {0, 100},
+		GetBlockFiltersMsg:      {0, 2000},
+		GetExtensionMsg:         {0, 100000},
+	}
+	// request amounts that have to fit into the minimum buffer size minBufferMultiplier times
+	minBufferReqAmount = map[uint64]uint64{
+		GetFastBlockHeadersMsg:  192,
+		GetFastBlockBodiesMsg:   1,
+		GetSnailBlockHeadersMsg: 192,
+		GetSnailBlockBodiesMsg:  128,
+		GetFruitBodiesMsg:       1,
+		GetReceiptsMsg:          1,
+		GetCodeMsg:              1,
+		GetProofsV2Msg:          1,
+		GetHelperTrieProofsMsg:  16,
+		SendTxV2Msg:             8,
+		GetTxStatusMsg:          64,
+		GetBlockFiltersMsg:      64,
+		GetExtensionMsg:         1,
+	}
+)
+
+// protocolSpecJSON is the spec the tables above were generated from.
+const protocolSpecJSON = `{
+  "versions": [
+    {
+      "version": 2,
+      "name": "lpv2",
+      "length": 37
+    },
+    {
+      "version": 3,
+      "name": "lpv3",
+      "length": 37
+    }
+  ],
+  "limits": [
+    {
+      "name": "MaxHeaderFetch",
+      "value": 192,
+      "doc": "Amount of block headers to be fetched per retrieval request"
+    },
+    {
+      "name": "MaxBodyFetch",
+      "value": 32,
+      "doc": "Amount of block bodies to be fetched per retrieval request"
+    },
+    {
+      "name": "MaxSnailBodyFetch",
+      "value": 128,
+      "doc": "Amount of block bodies to be fetched per retrieval request"
+    },
+    {
+      "name": "MaxFruitBodyFetch",
+      "value": 128,
+      "doc": "Amount of block bodies to be fetched per retrieval request"
+    },
+    {
+      "name": "MaxReceiptFetch",
+      "value": 128,
+      "doc": "Amount of transaction receipts to allow fetching per request"
+    },
+    {
+      "name": "MaxCodeFetch",
+      "value": 64,
+      "doc": "Amount of contract codes to allow fetching per request"
+    },
+    {
+      "name": "MaxProofsFetch",
+      "value": 64,
+      "doc": "Amount of merkle proofs to be fetched per retrieval request"
+    },
+    {
+      "name": "MaxHelperTrieProofsFetch",
+      "value": 64,
+      "doc": "Amount of merkle proofs to be fetched per retrieval request"
+    },
+    {
+      "name": "MaxTxSend",
+      "value": 64,
+      "doc": "Amount of transactions to be send per request"
+    },
+    {
+      "name": "MaxTxStatus",
+      "value": 256,
+      "doc": "Amount of transactions to queried per request"
+    },
+    {
+      "name": "MaxBlockFilterFetch",
+      "value": 256,
+      "doc": "Amount of compact block filters to be fetched per request"
+    },
+    {
+      "name": "MaxExtensionFetch",
+      "value": 1,
+      "doc": "Amount of protocol extension requests to be served per message"
+    }
+  ],
+  "messages": [
+    {
+      "name": "StatusMsg",
+      "code": 0,
+      "since": 1
+    },
+    {
+      "name": "AnnounceMsg",
+      "code": 1,
+      "since": 1
+    },
+    {
+      "name": "GetFastBlockHeadersMsg",
+      "code": 2,
+      "since": 1,
+      "request": {
+        "name": "GetBlockHeaders",
+        "limit": "MaxHeaderFetch",
+        "avgTimeCost": [
+          150000,
+          30000
+        ],
+        "maxInSize": [
+          40,
+          0
+        ],
+        "maxOutSize": [
+          0,
+          556
+        ],
+        "minBufferAmount": 192
+      }
+    },
+    {
+      "name": "FastBlockHeadersMsg",
+      "code": 3,
+      "since": 1
+    },
+    {
+      "name": "GetFastBlockBodiesMsg",
+      "code": 4,
+      "since": 1,
+      "request": {
+        "name": "GetBlockBodies",
+        "limit": "MaxBodyFetch",
+        "avgTimeCost": [
+          0,
+          700000
+        ],
+        "maxInSize": [
+          0,
+          40
+        ],
+        "maxOutSize": [
+          0,
+          100000
+        ],
+        "minBufferAmount": 1
+      }
+    },
+    {
+      "name": "FastBlockBodiesMsg",
+      "code": 5,
+      "since": 1
+    },
+    {
+      "name": "GetSnailBlockHeadersMsg",
+      "code": 6,
+      "since": 1,
+      "request": {
+        "name": "GetBlockHeaders",
+        "limit": "MaxHeaderFetch",
+        "avgTimeCost": [
+          150000,
+          30000
+        ],
+        "maxInSize": [
+          40,
+          0
+        ],
+        "maxOutSize": [
+          0,
+          556
+        ],
+        "minBufferAmount": 192
+      }
+    },
+    {
+      "name": "SnailBlockHeadersMsg",
+      "code": 7,
+      "since": 1
+    },
+    {
+      "name": "GetSnailBlockBodiesMsg",
+      "code": 8,
+      "since": 1,
+      "request": {
+        "name": "GetBlockBodies",
+        "limit": "MaxBodyFetch",
+        "avgTimeCost": [
+          0,
+          7000000
+        ],
+        "maxInSize": [
+          0,
+          400
+        ],
+        "maxOutSize": [
+          0,
+          1000000
+        ],
+        "minBufferAmount": 128
+      }
+    },
+    {
+      "name": "SnailBlockBodiesMsg",
+      "code": 9,
+      "since": 1
+    },
+    {
+      "name": "GetFruitBodiesMsg",
+      "code": 10,
+      "since": 1,
+      "request": {
+        "name": "GetBlockBodies",
+        "limit": "MaxBodyFetch",
+        "avgTimeCost": [
+          0,
+          700000
+        ],
+        "maxInSize": [
+          0,
+          40
+        ],
+        "maxOutSize": [
+          0,
+          100000
+        ],
+        "minBufferAmount": 1
+      }
+    },
+    {
+      "name": "FruitBodiesMsg",
+      "code": 11,
+      "since": 1
+    },
+    {
+      "name": "GetReceiptsMsg",
+      "code": 12,
+      "since": 1,
+      "request": {
+        "name": "GetReceipts",
+        "limit": "MaxReceiptFetch",
+        "avgTimeCost": [
+          0,
+          1000000
+        ],
+        "maxInSize": [
+          0,
+          40
+        ],
+        "maxOutSize": [
+          0,
+          200000
+        ],
+        "minBufferAmount": 1
+      }
+    },
+    {
+      "name": "ReceiptsMsg",
+      "code": 13,
+      "since": 1
+    },
+    {
+      "name": "GetCodeMsg",
+      "code": 14,
+      "since": 2,
+      "request": {
+        "name": "GetCode",
+        "limit": "MaxCodeFetch",
+        "avgTimeCost": [
+          0,
+          450000
+        ],
+        "maxInSize": [
+          0,
+          80
+        ],
+        "maxOutSize": [
+          0,
+          50000
+        ],
+        "minBufferAmount": 1
+      }
+    },
+    {
+      "name": "CodeMsg",
+      "code": 15,
+      "since": 2
+    },
+    {
+      "name": "GetProofsV2Msg",
+      "code": 16,
+      "since": 2,
+      "request": {
+        "name": "GetProofsV2",
+        "limit": "MaxProofsFetch",
+        "avgTimeCost": [
+          0,
+          600000
+        ],
+        "maxInSize": [
+          0,
+          80
+        ],
+        "maxOutSize": [
+          0,
+          4000
+        ],
+        "minBufferAmount": 1
+      }
+    },
+    {
+      "name": "ProofsV2Msg",
+      "code": 17,
+      "since": 2
+    },
+    {
+      "name": "GetHelperTrieProofsMsg",
+      "code": 18,
+      "since": 2,
+      "request": {
+        "name": "GetHelperTrieProofs",
+        "limit": "MaxHelperTrieProofsFetch",
+        "avgTimeCost": [
+          0,
+          1000000
+        ],
+        "maxInSize": [
+          0,
+          20
+        ],
+        "maxOutSize": [
+          0,
+          4000
+        ],
+        "minBufferAmount": 16
+      }
+    },
+    {
+      "name": "HelperTrieProofsMsg",
+      "code": 19,
+      "since": 2
+    },
+    {
+      "name": "SendTxV2Msg",
+      "code": 21,
+      "since": 2,
+      "request": {
+        "name": "SendTxV2",
+        "limit": "MaxTxSend",
+        "avgTimeCost": [
+          0,
+          450000
+        ],
+        "maxInSize": [
+          0,
+          16500
+        ],
+        "maxOutSize": [
+          0,
+          100
+        ],
+        "minBufferAmount": 8
+      }
+    },
+    {
+      "name": "GetTxStatusMsg",
+      "code": 22,
+      "since": 2,
+      "request": {
+        "name": "GetTxStatus",
+        "limit": "MaxTxStatus",
+        "avgTimeCost": [
+          0,
+          250000
+        ],
+        "maxInSize": [
+          0,
+          50
+        ],
+        "maxOutSize": [
+          0,
+          100
+        ],
+        "minBufferAmount": 64
+      }
+    },
+    {
+      "name": "TxStatusMsg",
+      "code": 23,
+      "since": 2
+    },
+    {
+      "name": "StopMsg",
+      "code": 24,
+      "since": 3
+    },
+    {
+      "name": "ResumeMsg",
+      "code": 25,
+      "since": 3
+    },
+    {
+      "name": "GetBlockFiltersMsg",
+      "code": 26,
+      "since": 3,
+      "request": {
+        "name": "GetBlockFilters",
+        "limit": "MaxBlockFilterFetch",
+        "avgTimeCost": [
+          0,
+          20000
+        ],
+        "maxInSize": [
+          0,
+          40
+        ],
+        "maxOutSize": [
+          0,
+          2000
+        ],
+        "minBufferAmount": 64
+      }
+    },
+    {
+      "name": "BlockFiltersMsg",
+      "code": 27,
+      "since": 3
+    },
+    {
+      "name": "GetExtensionMsg",
+      "code": 28,
+      "since": 3,
+      "request": {
+        "name": "GetExtension",
+        "limit": "MaxExtensionFetch",
+        "avgTimeCost": [
+          0,
+          1000000
+        ],
+        "maxInSize": [
+          0,
+          1000
+        ],
+        "maxOutSize": [
+          0,
+          100000
+        ],
+        "minBufferAmount": 1
+      }
+    },
+    {
+      "name": "ExtensionMsg",
+      "code": 29,
+      "since": 3
+    }
+  ]
+}`
@@ -0,0 +1,120 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"truechain/discovery/common"
+	"truechain/discovery/common/hexutil"
+	"truechain/discovery/core"
+	"truechain/discovery/core/rawdb"
+	"truechain/discovery/core/state"
+	"truechain/discovery/core/types"
+	"truechain/discovery/rlp"
+)
+
+var errGenesisPreimages = errors.New("genesis state preimages missing")
+
+// genesisMember is the genesis spec encoding of a committee member, see
+// types.CommitteeMember.UnmarshalJSON.
+type genesisMember struct {
+	Address common.Address `json:"address"`
+	PubKey  hexutil.Bytes  `json:"publickey"`
+}
+
+// exportGenesis reconstructs the genesis spec the database was initialised
+// with from the stored chain config, the genesis headers and the genesis
+// state. The staking account is left out of the allocation as it is derived
+// from the committee when the genesis state is created.
+func (s *LightEtrue) exportGenesis() (json.RawMessage, error) {
+	var (
+		fast  = s.fblockchain.Genesis()
+		snail = s.blockchain.Genesis().Header()
+	)
+	genesis := &core.Genesis{
+		Config:     rawdb.ReadChainConfig(s.chainDb, fast.Hash()),
+		Nonce:      snail.Nonce.Uint64(),
+		Timestamp:  fast.Time().Uint64(),
+		ExtraData:  fast.Extra(),
+		GasLimit:   fast.GasLimit(),
+		Difficulty: new(big.Int).Set(snail.Difficulty),
+		Mixhash:    snail.MixDigest,
+		Coinbase:   snail.Coinbase,
+		Alloc:      make(types.GenesisAlloc),
+		Number:     fast.NumberU64(),
+		GasUsed:    fast.GasUsed(),
+		ParentHash: fast.ParentHash(),
+	}
+	statedb, err := state.New(fast.Root(), state.NewDatabase(s.chainDb))
+	if err != nil {
+		return nil, err
+	}
+	for addr, dump := range statedb.RawDump().Accounts {
+		if addr == "" {
+			return nil, errGenesisPreimages
+		}
+		address := common.HexToAddress(addr)
+		if address == types.StakingAddress {
+			continue
+		}
+		balance, ok := new(big.Int).SetString(dump.Balance, 10)
+		if !ok {
+			return nil, fmt.Errorf("invalid genesis balance of %x", address)
+		}
+		account := types.GenesisAccount{
+			Balance: balance,
+			Nonce:   dump.Nonce,
+			Code:    common.Hex2Bytes(dump.Code),
+		}
+		for key, value := range dump.Storage {
+			if key == "" {
+				return nil, errGenesisPreimages
+			}
+			_, content, _, err := rlp.Split(common.Hex2Bytes(value))
+			if err != nil {
+				return nil, err
+			}
+			if account.Storage == nil {
+				account.Storage = make(map[common.Hash]common.Hash)
+			}
+			account.Storage[common.HexToHash(key)] = common.BytesToHash(content)
+		}
+		genesis.Alloc[address] = account
+	}
+	// The committee members are encoded differently than they are decoded,
+	// replace them with the spec encoding.
+	enc, err := json.Marshal(genesis)
+	if err != nil {
+		return nil, err
+	}
+	var spec map[string]json.RawMessage
+	if err := json.Unmarshal(enc, &spec); err != nil {
+		return nil, err
+	}
+	members := make([]genesisMember, 0, len(fast.SwitchInfos()))
+	for _, member := range fast.SwitchInfos() {
+		members = append(members, genesisMember{Address: member.Coinbase, PubKey: member.Publickey})
+	}
+	if spec["committee"], err = json.Marshal(members); err != nil {
+		return nil, err
+	}
+	return json.Marshal(spec)
+}
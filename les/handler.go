@@ -34,7 +34,6 @@ import (
 	"truechain/discovery/light/public"
 
 	"truechain/discovery/common"
-	"truechain/discovery/consensus"
 	"truechain/discovery/core"
 	"truechain/discovery/core/rawdb"
 	snaildb "truechain/discovery/core/snailchain/rawdb"
@@ -59,19 +58,6 @@ const (
 	estHeaderRlpSize  = 500             // Approximate size of an RLP encoded block header
 
 	etrueVersion = 63 // equivalent etrue version for the downloader
-
-	MaxHeaderFetch           = 192 // Amount of block headers to be fetched per retrieval request
-	MaxBodyFetch             = 32  // Amount of block bodies to be fetched per retrieval request
-	MaxSnailBodyFetch        = 128 // Amount of block bodies to be fetched per retrieval request
-	MaxFruitBodyFetch        = 128 // Amount of block bodies to be fetched per retrieval request
-	MaxReceiptFetch          = 128 // Amount of transaction receipts to allow fetching per request
-	MaxCodeFetch             = 64  // Amount of contract codes to allow fetching per request
-	MaxProofsFetch           = 64  // Amount of merkle proofs to be fetched per retrieval request
-	MaxHelperTrieProofsFetch = 64  // Amount of merkle proofs to be fetched per retrieval request
-	MaxTxSend                = 64  // Amount of transactions to be send per request
-	MaxTxStatus              = 256 // Amount of transactions to queried per request
-
-	disableClientRemovePeer = false
 )
 
 func errResp(code errCode, format string, v ...interface{}) error {
@@ -139,8 +125,17 @@ type ProtocolManager struct {
 	fetcher      *lightFetcher
 	fastFetcher  *fastLightFetcher
 	ulc          *ulc
+	roles        peerRoles       // servers with a restricted role, nil if none
+	nodeSession  int             // number of trie nodes remembered per session, see sessionLimit
+	capabilities []string        // capabilities announced in the handshake, all if nil
+	eclipse      *eclipseMonitor // nil on the server side
+	forkChoices  *forkChoiceLog  // nil on the server side
+	syncFeed     *event.Feed     // milestones of the header synchronisation, nil on the server side
 	peers        *peerSet
-	checkpoint   *params.TrustedCheckpoint
+	fastForks    *forkFilter               // fork ID of the fast chain
+	snailForks   *forkFilter               // fork ID of the snail chain
+	checkpoint   *params.TrustedCheckpoint // replaced by the checkpoint oracle, guarded by cpLock
+	cpLock       sync.RWMutex
 	reg          *checkpointOracle // If reg == nil, it means the checkpoint registrar is not activated
 
 	// channels for fetcher, syncer, txsyncLoop
@@ -155,66 +150,50 @@ type ProtocolManager struct {
 	synced func() bool
 }
 
-// NewProtocolManager returns a new ethereum sub protocol manager. The Ethereum sub protocol manages peers capable
-// with the ethereum network.
-func NewProtocolManager(chainConfig *params.ChainConfig, checkpoint *params.TrustedCheckpoint, indexerConfig *public.IndexerConfig, ulcServers []string, ulcFraction int, client bool, networkId uint64, mux *event.TypeMux, engine consensus.Engine, peers *peerSet, blockchain FastBlockChain, snailchain BlockChain, txpool txPool, chainDb etruedb.Database, odr *LesOdr, serverPool *serverPool, registrar *checkpointOracle, quitSync chan struct{}, wg *sync.WaitGroup, election *Election, synced func() bool) (*ProtocolManager, error) {
-	// Create the protocol manager with the base fields
+// handlerConfig is the configuration of the protocol manager shared by the
+// client and the server. Side specific settings are set by the constructor of
+// the side, e.g. clientOptions for the light client.
+type handlerConfig struct {
+	ChainConfig   *params.ChainConfig
+	IndexerConfig *public.IndexerConfig
+	NetworkId     uint64
+	EventMux      *event.TypeMux
+	Peers         *peerSet
+	FastChain     FastBlockChain
+	SnailChain    BlockChain
+	ChainDb       etruedb.Database
+	Registrar     *checkpointOracle // nil if the checkpoint registrar is not activated
+	QuitSync      chan struct{}
+	Wg            *sync.WaitGroup
+
+	TxPool txPool      // transaction pool of the served chain, nil on the client side
+	Synced func() bool // whether the served chain is synced, nil on the client side
+}
+
+// newProtocolManager returns the protocol handling shared by the light client
+// and the server. The client completes it with newClientHandler.
+func newProtocolManager(config *handlerConfig) *ProtocolManager {
 	manager := &ProtocolManager{
-		client:      client,
-		eventMux:    mux,
-		blockchain:  snailchain,
-		fblockchain: blockchain,
-		chainConfig: chainConfig,
-		iConfig:     indexerConfig,
-		chainDb:     chainDb,
-		odr:         odr,
-		networkId:   networkId,
-		txpool:      txpool,
-		serverPool:  serverPool,
-		reg:         registrar,
-		peers:       peers,
+		eventMux:    config.EventMux,
+		blockchain:  config.SnailChain,
+		fblockchain: config.FastChain,
+		chainConfig: config.ChainConfig,
+		iConfig:     config.IndexerConfig,
+		chainDb:     config.ChainDb,
+		networkId:   config.NetworkId,
+		txpool:      config.TxPool,
+		reg:         config.Registrar,
+		peers:       config.Peers,
 		newPeerCh:   make(chan *peer),
-		quitSync:    quitSync,
-		wg:          wg,
+		quitSync:    config.QuitSync,
+		wg:          config.Wg,
 		noMorePeers: make(chan struct{}),
-		election:    election,
-		checkpoint:  checkpoint,
-		synced:      synced,
-	}
-	if odr != nil {
-		manager.retriever = odr.retriever
-		manager.reqDist = odr.retriever.dist
-	}
-
-	if ulcServers != nil {
-		ulc, err := newULC(ulcServers, ulcFraction)
-		if err != nil {
-			log.Warn("Failed to initialize ultra light client", "err", err)
-		} else {
-			manager.ulc = ulc
-		}
+		synced:      config.Synced,
 	}
-	removePeer := manager.removePeer
-	if disableClientRemovePeer {
-		removePeer = func(id string, call uint32) {}
-	}
-	if client {
-		var checkpointNumber uint64
-		if checkpoint != nil {
-			checkpointNumber = (checkpoint.SectionIndex+1)*params.CHTFrequency - 1
-		}
-		mode := downloader.LightSync
-		fmode := fastdownloader.SyncMode(mode)
-		manager.fdownloader = fastdownloader.New(fmode, chainDb, manager.eventMux, nil, blockchain, removePeer)
-		manager.downloader = downloader.New(mode, checkpointNumber, chainDb, manager.eventMux, nil, snailchain, removePeer, manager.fdownloader)
-		manager.peers.notify((*downloaderPeerNotify)(manager))
-		manager.fastFetcher = newFastLightFetcher(manager)
-		manager.fetcher = newLightFetcher(manager)
-		manager.fetcher.setFastFetcher(manager.fastFetcher)
-
-	}
-
-	return manager, nil
+	fastForks, snailForks := chainForks(config.ChainConfig)
+	manager.fastForks = newForkFilter(config.SnailChain.Genesis().Hash(), fastForks)
+	manager.snailForks = newForkFilter(config.SnailChain.Genesis().Hash(), snailForks)
+	return manager
 }
 
 // removePeer initiates disconnection from a peer by removing it from the peer set
@@ -226,7 +205,7 @@ func (pm *ProtocolManager) removePeer(id string, call uint32) {
 func (pm *ProtocolManager) Start(maxPeers int) {
 	pm.maxPeers = maxPeers
 	if pm.client {
-		go pm.syncer()
+		goLabeled("syncer", func(*routine) { pm.syncer() })
 	} else {
 		go func() {
 			for range pm.newPeerCh {
@@ -292,7 +271,16 @@ func (pm *ProtocolManager) newPeer(pv int, nv uint64, p *p2p.Peer, rw p2p.MsgRea
 	if pm.ulc != nil {
 		trusted = pm.ulc.trusted(p.ID())
 	}
-	return newPeer(pv, nv, trusted, p, newMeteredMsgWriter(rw))
+	peer := newPeer(pv, nv, trusted, p, newMeteredMsgWriter(rw))
+	peer.role = pm.roles.role(p.ID())
+	peer.nodeSessionSize = pm.nodeSession
+	if pm.capabilities != nil {
+		peer.local = pm.capabilities
+	}
+	if pm.reqDist != nil {
+		peer.clock = pm.reqDist.clock // flow control estimates in distributor time
+	}
+	return peer
 }
 
 // handle is the callback invoked to manage the life cycle of a les peer. When
@@ -304,8 +292,8 @@ func (pm *ProtocolManager) handle(p *peer) error {
 		clientRejectedMeter.Mark(1)
 		return p2p.DiscTooManyPeers
 	}
-	// Reject light clients if server is not synced.
-	if !pm.client && !pm.synced() {
+	// Reject light clients if server is not synced or under maintenance.
+	if !pm.client && (!pm.synced() || pm.server.isDraining()) {
 		clientRejectedMeter.Mark(1)
 		return p2p.DiscRequested
 	}
@@ -321,17 +309,26 @@ func (pm *ProtocolManager) handle(p *peer) error {
 		fastHash   = pm.fblockchain.CurrentHeader().Hash()
 		fastHeight = pm.fblockchain.CurrentHeader().Number
 	)
-	if err := p.Handshake(td, hash, number, genesis.Hash(), fastHash, fastHeight, pm.server); err != nil {
+	if err := p.Handshake(td, hash, number, genesis.Hash(), fastHash, fastHeight, pm.chainStatus(fastHeight.Uint64(), number), pm.server); err != nil {
 		p.Log().Debug("Light Truechain handshake failed", "err", err)
 		clientErrorMeter.Mark(1)
 		return err
 	}
+	if err := pm.checkChainStatus(p, fastHeight.Uint64(), number); err != nil {
+		p.Log().Debug("Light Truechain peer on another chain", "err", err)
+		clientErrorMeter.Mark(1)
+		return err
+	}
 	if p.fcClient != nil {
 		defer p.fcClient.Disconnect()
 	}
 
 	if rw, ok := p.rw.(*meteredMsgReadWriter); ok {
-		rw.Init(p.version)
+		if pm.client {
+			p.metrics = newPeerMetrics(p.id)
+			defer p.metrics.close()
+		}
+		rw.Init(p.version, p.metrics)
 	}
 
 	// Register the peer locally
@@ -450,7 +447,9 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 	var deliverMsg *Msg
 	balanceTracker := p.balanceTracker
 
-	sendResponse := func(reqID, amount uint64, reply *reply, servingTime uint64) {
+	// sendResponse returns whether the reply is queued for sending, a frozen
+	// client gets none.
+	sendResponse := func(reqID, amount uint64, reply *reply, servingTime uint64) bool {
 		p.responseLock.Lock()
 		defer p.responseLock.Unlock()
 
@@ -473,16 +472,18 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			realCost = maxCost
 		}
 		bv := p.fcClient.RequestProcessed(reqID, responseCount, maxCost, realCost)
-		if reply != nil {
-			p.queueSend(func() {
-				if err := reply.send(bv); err != nil {
-					select {
-					case p.errCh <- err:
-					default:
-					}
-				}
-			})
+		if reply == nil {
+			return false
 		}
+		p.queueSend(func() {
+			if err := reply.send(bv); err != nil {
+				select {
+				case p.errCh <- err:
+				default:
+				}
+			}
+		})
+		return true
 	}
 
 	// Handle the message depending on its contents
@@ -506,6 +507,10 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			return errResp(ErrRequestRejected, "")
 		}
 		p.updateFlowControl(update)
+		if d, ok := p.updateDraining(update); ok && pm.serverPool != nil {
+			p.Log().Debug("Server announced draining", "duration", d)
+			pm.serverPool.adjustDraining(p.poolEntry, d)
+		}
 
 		if req.Hash != (common.Hash{}) || req.FastHash != (common.Hash{}) {
 			if p.announceType == announceTypeNone {
@@ -519,7 +524,9 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 				p.Log().Trace("Valid announcement signature")
 			}
 
-			if pm.fetcher != nil {
+			if !p.servesData() {
+				p.Log().Trace("Ignoring announcement of relay-only server")
+			} else if pm.fetcher != nil {
 				if req.FastHash != (common.Hash{}) {
 					pm.fastFetcher.announce(p, &req)
 				} else {
@@ -720,10 +727,11 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 		}
 
 		p.Log().Trace("Received block bodies response")
-		// A batch of block bodies arrived to one of our previous requests
+		// A batch of block bodies arrived to one of our previous requests, they
+		// are decoded during validation by the fork active at their block
 		var resp struct {
 			ReqID, BV uint64
-			Data      []*types.Body
+			Data      []rlp.RawValue
 		}
 		if err := msg.Decode(&resp); err != nil {
 			return errResp(ErrDecode, "msg %v: %v", msg, err)
@@ -923,7 +931,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			return errResp(ErrDecode, "msg %v: %v", msg, err)
 		}
 		p.fcServer.ReceivedReply(resp.ReqID, resp.BV)
-		if resp.Data.Type == public.FruitHead {
+		if resp.Data.Type == public.FruitHead && !pm.retriever.pending(resp.ReqID) {
 			// Deliver them all to the downloader for queuing
 			blocks := make([][]*types.SnailBlock, len(resp.Data.FruitHeads))
 			for i, body := range resp.Data.FruitHeads {
@@ -1148,9 +1156,10 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 
 		p.Log().Trace("Received receipts response")
 		// A batch of receipts arrived to one of our previous requests
+		// Receipts are decoded during validation by the fork active at their block
 		var resp struct {
 			ReqID, BV uint64
-			Receipts  []types.Receipts
+			Receipts  []rlp.RawValue
 		}
 		if err := msg.Decode(&resp); err != nil {
 			return errResp(ErrDecode, "msg %v: %v", msg, err)
@@ -1255,7 +1264,20 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 						break
 					}
 				}
-				sendResponse(req.ReqID, uint64(reqCnt), p.ReplyProofsV2(req.ReqID, nodes.NodeList()), task.done())
+				if p.sentNodes == nil || p.isFrozen() {
+					sendResponse(req.ReqID, uint64(reqCnt), p.ReplyProofsV2(req.ReqID, nodes.NodeList()), task.done())
+					return
+				}
+				omitKnown := false
+				for _, request := range req.Reqs {
+					if len(request.Flags) > 0 && request.Flags[0]&proofOmitKnown != 0 {
+						omitKnown = true
+					}
+				}
+				servingTime := task.done()
+				p.sentNodes.reply(nodes.NodeList(), omitKnown, func(list public.NodeList) bool {
+					return sendResponse(req.ReqID, uint64(reqCnt), p.ReplyProofsV2(req.ReqID, list), servingTime)
+				})
 			}()
 		}
 
@@ -1273,12 +1295,22 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 		if err := msg.Decode(&resp); err != nil {
 			return errResp(ErrDecode, "msg %v: %v", msg, err)
 		}
+		if p.caps.has(capCompactWitness) {
+			if resp.Data, err = expandWitness(resp.Data); err != nil {
+				return errResp(ErrDecode, "msg %v: %v", msg, err)
+			}
+		}
 		p.fcServer.ReceivedReply(resp.ReqID, resp.BV)
 		deliverMsg = &Msg{
 			MsgType: MsgProofsV2,
 			ReqID:   resp.ReqID,
 			Obj:     resp.Data,
 		}
+		if p.recvNodes != nil {
+			// The server omitted the nodes sent in earlier replies, the ones
+			// of this reply are added by the request once it's validated
+			deliverMsg.Known = p.recvNodes
+		}
 
 	case GetHelperTrieProofsMsg:
 		// Decode the retrieval message
@@ -1439,6 +1471,108 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			}()
 		}
 
+	case GetBlockFiltersMsg:
+		if pm.server == nil || !pm.server.blockFilters {
+			return errResp(ErrUnexpectedResponse, "block filters not served")
+		}
+		p.Log().Trace("Received block filters request")
+		var req struct {
+			ReqID  uint64
+			Hashes []common.Hash
+		}
+		if err := msg.Decode(&req); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		reqCnt := len(req.Hashes)
+		if accept(req.ReqID, uint64(reqCnt), MaxBlockFilterFetch) {
+			go func() {
+				filters := make([][]byte, 0, reqCnt)
+				for i, hash := range req.Hashes {
+					if i != 0 && !task.waitOrStop() {
+						sendResponse(req.ReqID, 0, nil, task.servingTime)
+						return
+					}
+					filter := pm.server.blockFilter(hash)
+					if filter == nil {
+						atomic.AddUint32(&p.invalidCount, 1)
+						break
+					}
+					filters = append(filters, filter)
+				}
+				sendResponse(req.ReqID, uint64(reqCnt), p.ReplyBlockFilters(req.ReqID, filters), task.done())
+			}()
+		}
+
+	case BlockFiltersMsg:
+		if pm.odr == nil {
+			return errResp(ErrUnexpectedResponse, "")
+		}
+
+		p.Log().Trace("Received block filters response")
+		var resp struct {
+			ReqID, BV uint64
+			Filters   [][]byte
+		}
+		if err := msg.Decode(&resp); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		p.fcServer.ReceivedReply(resp.ReqID, resp.BV)
+		deliverMsg = &Msg{
+			MsgType: MsgBlockFilters,
+			ReqID:   resp.ReqID,
+			Obj:     resp.Filters,
+		}
+
+	case GetExtensionMsg:
+		if pm.server == nil {
+			return errResp(ErrUnexpectedResponse, "extensions not served")
+		}
+		var req struct {
+			ReqID uint64
+			Req   struct {
+				Extension string
+				Code      uint64
+				Data      []byte
+			}
+		}
+		if err := msg.Decode(&req); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		p.Log().Trace("Received extension request", "extension", req.Req.Extension, "code", req.Req.Code)
+		if !p.caps.has(extensionCapability(req.Req.Extension)) {
+			return errResp(ErrUnexpectedResponse, "extension %q not negotiated", req.Req.Extension)
+		}
+		if accept(req.ReqID, 1, MaxExtensionFetch) {
+			go func() {
+				data, err := pm.server.serveExtension(req.Req.Extension, req.Req.Code, req.Req.Data)
+				if err != nil {
+					p.Log().Debug("Failed to serve extension request", "extension", req.Req.Extension, "code", req.Req.Code, "err", err)
+					atomic.AddUint32(&p.invalidCount, 1)
+				}
+				sendResponse(req.ReqID, 1, p.ReplyExtension(req.ReqID, data), task.done())
+			}()
+		}
+
+	case ExtensionMsg:
+		if pm.odr == nil {
+			return errResp(ErrUnexpectedResponse, "")
+		}
+
+		p.Log().Trace("Received extension response")
+		var resp struct {
+			ReqID, BV uint64
+			Data      []byte
+		}
+		if err := msg.Decode(&resp); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		p.fcServer.ReceivedReply(resp.ReqID, resp.BV)
+		deliverMsg = &Msg{
+			MsgType: MsgExtension,
+			ReqID:   resp.ReqID,
+			Obj:     resp.Data,
+		}
+
 	case TxStatusMsg:
 		if pm.odr == nil {
 			return errResp(ErrUnexpectedResponse, "")
@@ -1487,9 +1621,25 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 		return errResp(ErrInvalidMsgCode, "%v", msg.Code)
 	}
 
+	// Replies recharge the flow control buffer of the server and a resumed
+	// server accepts requests again, let the waiting requests be sent
+	if pm.reqDist != nil {
+		pm.reqDist.update()
+	}
 	if deliverMsg != nil {
 		err := pm.retriever.deliver(p, deliverMsg)
 		if err != nil {
+			if p.metrics != nil {
+				p.metrics.invalid(msg.Code)
+			}
+			if err == errReceiptHashMismatch {
+				p.Log().Warn("Server served receipts not matching the receipt root", "reqID", deliverMsg.ReqID)
+				invalidReceiptsMeter.Mark(1)
+				if pm.serverPool != nil {
+					pm.serverPool.adjustInvalidData(p.poolEntry)
+				}
+				return errResp(ErrInvalidResponse, "reqID = %v: %v", deliverMsg.ReqID, err)
+			}
 			p.responseErrors++
 			if p.responseErrors > maxResponseErrors {
 				return err
@@ -1614,6 +1764,7 @@ func (pc *peerConnection) Head() (common.Hash, *big.Int) {
 func (pc *peerConnection) RequestHeadersByHash(origin common.Hash, amount int, skip int, reverse bool, fast bool) error {
 	reqID := genReqID()
 	rq := &distReq{
+		priority: prioritySync,
 		getCost: func(dp distPeer) uint64 {
 			peer := dp.(*peer)
 			if fast {
@@ -1647,6 +1798,7 @@ func (pc *peerConnection) RequestHeadersByHash(origin common.Hash, amount int, s
 func (pc *peerConnection) RequestHeadersByNumber(origin uint64, amount int, skip int, reverse bool, fast bool) error {
 	reqID := genReqID()
 	rq := &distReq{
+		priority: prioritySync,
 		getCost: func(dp distPeer) uint64 {
 			peer := dp.(*peer)
 			if fast {
@@ -1680,6 +1832,7 @@ func (pc *peerConnection) RequestHeadersByNumber(origin uint64, amount int, skip
 func (pc *peerConnection) RequestBodies(hashes []common.Hash, fast bool, call uint32) error {
 	reqID := genReqID()
 	rq := &distReq{
+		priority: prioritySync,
 		getCost: func(dp distPeer) uint64 {
 			peer := dp.(*peer)
 			return peer.GetRequestCost(GetSnailBlockBodiesMsg, len(hashes))
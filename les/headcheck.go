@@ -0,0 +1,199 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"truechain/discovery/common"
+	"truechain/discovery/common/hexutil"
+	"truechain/discovery/light/fast"
+	"truechain/discovery/log"
+)
+
+const (
+	headCheckDefaultInterval = time.Minute * 5
+	headCheckTimeout         = time.Second * 30 // time limit of a single query
+	// headCheckLag is the number of blocks the compared block is behind the
+	// local head, so that the source has already seen it.
+	headCheckLag = 12
+)
+
+var errHeadCheckNotHTTPS = errors.New("head check source must be an https URL")
+
+// HeadCheck is the result of the last comparison with the head check source.
+type HeadCheck struct {
+	Time     time.Time   `json:"time"`
+	Number   uint64      `json:"number"`
+	Local    common.Hash `json:"local"`
+	Remote   common.Hash `json:"remote"`
+	Diverged bool        `json:"diverged"`
+	Error    string      `json:"error,omitempty"`
+}
+
+// headChecker periodically compares the hash of a recent fast block with the
+// one served by an independent HTTPS JSON-RPC source, e.g. a block explorer.
+// It is a last-resort safety net against being fed a fake chain by all
+// servers, divergence is only flagged, never acted upon.
+type headChecker struct {
+	chain    *fast.LightChain
+	url      string
+	interval time.Duration
+	client   *http.Client
+	quit     chan struct{}
+
+	lock sync.Mutex
+	last *HeadCheck
+}
+
+// newHeadChecker creates a head checker querying the given source. It returns
+// nil if no source is configured.
+func newHeadChecker(chain *fast.LightChain, source string, interval time.Duration) (*headChecker, error) {
+	if source == "" {
+		return nil, nil
+	}
+	if u, err := url.Parse(source); err != nil || u.Scheme != "https" {
+		return nil, errHeadCheckNotHTTPS
+	}
+	if interval <= 0 {
+		interval = headCheckDefaultInterval
+	}
+	return &headChecker{
+		chain:    chain,
+		url:      source,
+		interval: interval,
+		client:   &http.Client{Timeout: headCheckTimeout},
+		quit:     make(chan struct{}),
+	}, nil
+}
+
+// start starts the periodic checks
+func (c *headChecker) start() {
+	if c == nil {
+		return
+	}
+	go c.loop()
+}
+
+// stop stops the periodic checks
+func (c *headChecker) stop() {
+	if c == nil {
+		return
+	}
+	close(c.quit)
+}
+
+// status returns the result of the last check, nil if none was done yet.
+func (c *headChecker) status() *HeadCheck {
+	if c == nil {
+		return nil
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.last
+}
+
+func (c *headChecker) loop() {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.check()
+		case <-c.quit:
+			return
+		}
+	}
+}
+
+// check compares a recent canonical block with the source.
+func (c *headChecker) check() {
+	head := c.chain.CurrentHeader().Number.Uint64()
+	if head < headCheckLag {
+		return
+	}
+	number := head - headCheckLag
+	header := c.chain.GetHeaderByNumber(number)
+	if header == nil {
+		return
+	}
+	res := &HeadCheck{Time: time.Now(), Number: number, Local: header.Hash()}
+	remote, err := c.remoteHash(number)
+	if err != nil {
+		log.Warn("Failed to query head check source", "number", number, "err", err)
+		res.Error = err.Error()
+	} else {
+		res.Remote = remote
+		res.Diverged = remote != res.Local
+		if res.Diverged {
+			headDivergedMeter.Mark(1)
+			log.Error("Local chain diverged from head check source", "number", number, "local", res.Local, "remote", remote)
+		}
+	}
+	c.lock.Lock()
+	c.last = res
+	c.lock.Unlock()
+}
+
+// remoteHash retrieves the hash of the fast block with the given number from
+// the source through etrue_getBlockByNumber.
+func (c *headChecker) remoteHash(number uint64) (common.Hash, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  "etrue_getBlockByNumber",
+		"params":  []interface{}{hexutil.Uint64(number), false},
+	})
+	if err != nil {
+		return common.Hash{}, err
+	}
+	resp, err := c.client.Post(c.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return common.Hash{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return common.Hash{}, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	var result struct {
+		Result *struct {
+			Hash common.Hash `json:"hash"`
+		} `json:"result"`
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return common.Hash{}, err
+	}
+	if result.Error != nil {
+		return common.Hash{}, errors.New(result.Error.Message)
+	}
+	if result.Result == nil {
+		return common.Hash{}, fmt.Errorf("block %d unknown to source", number)
+	}
+	return result.Result.Hash, nil
+}
@@ -0,0 +1,235 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/golang-lru"
+	"truechain/discovery/common"
+	"truechain/discovery/core/state"
+	"truechain/discovery/core/types"
+	"truechain/discovery/crypto"
+	"truechain/discovery/event"
+	"truechain/discovery/light/fast"
+	"truechain/discovery/log"
+	"truechain/discovery/rlp"
+	"truechain/discovery/trie"
+)
+
+const (
+	hotStateChanSize = 10
+	hotStateTimeout  = time.Minute // time limit of syncing the hot state of a head
+	hotStorageLimit  = 1024        // number of queried storage entries synced at every head
+)
+
+var emptyCodeHash = crypto.Keccak256(nil)
+
+// hotState keeps the state of a configured set of hot accounts local, so that
+// queries about them don't wait for the servers: the proofs of the accounts,
+// the code of the contracts and the storage entries of them that have been
+// queried before are retrieved at every new head, in as few requests as
+// possible. The rest of the state is still retrieved on demand.
+type hotState struct {
+	etrue    *LightEtrue
+	accounts map[string]common.Address // hot accounts by hashed address
+	keys     *lru.Cache                // queried storage entries of the hot accounts by hotKey
+
+	headCh chan types.FastChainHeadEvent
+	sub    event.Subscription
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     *sync.WaitGroup // tracks the syncing loop of the light client
+}
+
+// newHotState creates the hot state syncer of the given accounts, nil if there
+// are none.
+func newHotState(etrue *LightEtrue, addrs []common.Address, wg *sync.WaitGroup) *hotState {
+	if len(addrs) == 0 {
+		return nil
+	}
+	h := &hotState{
+		etrue:    etrue,
+		accounts: make(map[string]common.Address),
+		headCh:   make(chan types.FastChainHeadEvent, hotStateChanSize),
+		wg:       wg,
+	}
+	h.keys, _ = lru.New(hotStorageLimit)
+	for _, addr := range addrs {
+		h.accounts[string(crypto.Keccak256(addr[:]))] = addr
+	}
+	return h
+}
+
+// hotKey is a queried storage entry of a hot account, the hashed key in the
+// storage trie of the hashed address.
+type hotKey struct {
+	accKey, key string
+}
+
+// start starts syncing the hot state at the new heads.
+func (h *hotState) start() {
+	if h == nil {
+		return
+	}
+	h.ctx, h.cancel = context.WithCancel(withRequestPriority(context.Background(), priorityBackground))
+	h.sub = h.etrue.fblockchain.SubscribeChainHeadEvent(h.headCh)
+	h.wg.Add(1)
+	go h.loop()
+}
+
+// stop stops syncing the hot state.
+func (h *hotState) stop() {
+	if h == nil {
+		return
+	}
+	h.sub.Unsubscribe()
+	h.cancel()
+}
+
+func (h *hotState) loop() {
+	defer h.wg.Done()
+
+	h.sync(h.etrue.fblockchain.CurrentHeader())
+	for {
+		select {
+		case ev := <-h.headCh:
+			// Only the state of the latest head is worth syncing
+			header := ev.Block.Header()
+			for drained := false; !drained; {
+				select {
+				case ev := <-h.headCh:
+					header = ev.Block.Header()
+				default:
+					drained = true
+				}
+			}
+			h.sync(header)
+		case <-h.ctx.Done():
+			return
+		}
+	}
+}
+
+// sync retrieves the hot state of a head which isn't available locally.
+func (h *hotState) sync(header *types.Header) {
+	ctx, cancel := context.WithTimeout(h.ctx, hotStateTimeout)
+	defer cancel()
+
+	var (
+		start   = time.Now()
+		stateID = fast.StateTrieID(header)
+		accKeys = make([][]byte, 0, len(h.accounts))
+	)
+	for accKey := range h.accounts {
+		accKeys = append(accKeys, []byte(accKey))
+	}
+	if err := h.etrue.retrieveEntries(ctx, h.etrue.odr, stateID, h.missing(header.Root, accKeys)); err != nil {
+		log.Debug("Failed to sync hot accounts", "number", header.Number, "err", err)
+		return
+	}
+	st, err := trie.New(header.Root, trie.NewDatabase(h.etrue.chainDb))
+	if err != nil {
+		return
+	}
+	storage := h.storage()
+	for accKey, addr := range h.accounts {
+		enc, err := st.TryGet([]byte(accKey))
+		if err != nil || len(enc) == 0 {
+			continue
+		}
+		var account state.Account
+		if err := rlp.DecodeBytes(enc, &account); err != nil {
+			continue
+		}
+		id := fast.StorageTrieID(stateID, common.BytesToHash([]byte(accKey)), account.Root)
+		if !bytes.Equal(account.CodeHash, emptyCodeHash) {
+			if ok, _ := h.etrue.chainDb.Has(account.CodeHash); !ok {
+				if err := h.etrue.odr.FastRetrieve(ctx, &fast.CodeRequest{Id: id, Hash: common.BytesToHash(account.CodeHash)}); err != nil {
+					log.Debug("Failed to sync hot contract code", "address", addr, "err", err)
+				}
+			}
+		}
+		if entries := storage[accKey]; len(entries) > 0 && account.Root != types.EmptyRootHash {
+			if err := h.etrue.retrieveEntries(ctx, h.etrue.odr, id, h.missing(account.Root, entries)); err != nil {
+				log.Debug("Failed to sync hot storage", "address", addr, "entries", len(entries), "err", err)
+			}
+		}
+	}
+	log.Trace("Synced hot state", "number", header.Number, "accounts", len(h.accounts), "elapsed", common.PrettyDuration(time.Since(start)))
+}
+
+// missing returns the keys of a trie whose entries can't be resolved locally.
+func (h *hotState) missing(root common.Hash, keys [][]byte) [][]byte {
+	t, err := trie.New(root, trie.NewDatabase(h.etrue.chainDb))
+	if err != nil {
+		return keys
+	}
+	var missing [][]byte
+	for _, key := range keys {
+		if _, err := t.TryGet(key); err != nil {
+			missing = append(missing, key)
+		}
+	}
+	return missing
+}
+
+// storage returns the queried storage entries of the hot accounts. Beyond
+// hotStorageLimit entries the least recently queried ones are not synced any
+// more.
+func (h *hotState) storage() map[string][][]byte {
+	storage := make(map[string][][]byte)
+	for _, k := range h.keys.Keys() {
+		key := k.(hotKey)
+		storage[key.accKey] = append(storage[key.accKey], []byte(key.key))
+	}
+	return storage
+}
+
+// hotRecorder is an ODR backend recording the storage entries of the hot
+// accounts retrieved on demand, which are synced at the next heads.
+type hotRecorder struct {
+	fast.OdrBackend
+	hot *hotState
+}
+
+// FastRetrieve records the entries of a storage trie request of a hot account
+// and retrieves them. The other keys of a storage trie request are entries of
+// the same trie, random decoys are only bundled with account requests.
+func (r *hotRecorder) FastRetrieve(ctx context.Context, req fast.OdrRequest) error {
+	if tr, ok := req.(*fast.TrieRequest); ok && tr.Id.AccKey != nil {
+		if _, ok := r.hot.accounts[string(tr.Id.AccKey)]; ok {
+			r.hot.keys.Add(hotKey{accKey: string(tr.Id.AccKey), key: string(tr.Key)}, nil)
+			for _, key := range tr.Decoys {
+				r.hot.keys.Add(hotKey{accKey: string(tr.Id.AccKey), key: string(key)}, nil)
+			}
+		}
+	}
+	return r.OdrBackend.FastRetrieve(ctx, req)
+}
+
+// odrBackend returns the ODR backend of the state of a query, recording the
+// storage entries of the hot accounts.
+func (h *hotState) odrBackend(odr fast.OdrBackend) fast.OdrBackend {
+	if h == nil {
+		return odr
+	}
+	return &hotRecorder{OdrBackend: odr, hot: h}
+}
@@ -0,0 +1,87 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"truechain/discovery/common"
+	"truechain/discovery/crypto"
+	"truechain/discovery/light/fast"
+)
+
+// nopOdr is an ODR backend answering every request without retrieving it.
+type nopOdr struct {
+	fast.OdrBackend
+}
+
+func (nopOdr) FastRetrieve(ctx context.Context, req fast.OdrRequest) error { return nil }
+
+// queryStorage records a storage trie request of the given account.
+func queryStorage(t *testing.T, odr fast.OdrBackend, accKey []byte, key string) {
+	req := &fast.TrieRequest{Id: &fast.TrieID{AccKey: accKey}, Key: []byte(key)}
+	if err := odr.FastRetrieve(context.Background(), req); err != nil {
+		t.Fatalf("failed to retrieve %s: %v", key, err)
+	}
+}
+
+// Tests that only the storage entries of the hot accounts are recorded, and
+// that beyond the limit the least recently queried ones are dropped.
+func TestHotStateStorageLimit(t *testing.T) {
+	var (
+		hot  = common.Address{1}
+		cold = common.Address{2}
+	)
+	h := newHotState(nil, []common.Address{hot}, new(sync.WaitGroup))
+	odr := h.odrBackend(nopOdr{})
+	hotAcc, coldAcc := crypto.Keccak256(hot[:]), crypto.Keccak256(cold[:])
+
+	for i := 0; i < hotStorageLimit; i++ {
+		queryStorage(t, odr, hotAcc, fmt.Sprintf("key-%d", i))
+		queryStorage(t, odr, coldAcc, fmt.Sprintf("key-%d", i))
+	}
+	// Query the first entry again, the second one is the least recent now
+	queryStorage(t, odr, hotAcc, "key-0")
+	for i := hotStorageLimit; i < hotStorageLimit+10; i++ {
+		queryStorage(t, odr, hotAcc, fmt.Sprintf("key-%d", i))
+	}
+	storage := h.storage()
+	if len(storage) != 1 {
+		t.Fatalf("storage of %d accounts recorded, want 1", len(storage))
+	}
+	keys := make(map[string]bool)
+	for _, key := range storage[string(hotAcc)] {
+		keys[string(key)] = true
+	}
+	if len(keys) != hotStorageLimit {
+		t.Errorf("recorded entry count mismatch: have %d, want %d", len(keys), hotStorageLimit)
+	}
+	if !keys["key-0"] {
+		t.Error("entry queried again dropped")
+	}
+	for i := 1; i <= 10; i++ {
+		if key := fmt.Sprintf("key-%d", i); keys[key] {
+			t.Errorf("least recently queried entry %s kept", key)
+		}
+	}
+	if key := fmt.Sprintf("key-%d", hotStorageLimit+9); !keys[key] {
+		t.Errorf("latest entry %s dropped", key)
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"errors"
+	"os"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"github.com/elastic/gosigar"
+	"truechain/discovery/etrue"
+	"truechain/discovery/log"
+)
+
+// errOverloaded is returned for low priority requests rejected while the light
+// client is shedding load.
+var errOverloaded = errors.New("light client overloaded, low priority request rejected")
+
+const (
+	loadCheckPeriod  = time.Second * 3 // period of sampling the resource usage
+	loadRecoverRatio = 0.9             // usage ratio of the limits below which shedding stops
+)
+
+// pausableIndexer is a background chain indexer which can be suspended while the
+// client is shedding load.
+type pausableIndexer interface {
+	Pause()
+	Resume()
+}
+
+// loadShedder periodically samples the memory and CPU usage of the process. If
+// any of the configured limits is exceeded, background indexers are paused and
+// low priority requests are rejected until the usage drops back again. Header
+// tracking and transaction relay are never affected.
+type loadShedder struct {
+	memLimit uint64  // heap size limit in bytes, 0 if disabled
+	cpuLimit float64 // CPU usage limit in cores, 0 if disabled
+	indexers []pausableIndexer
+
+	shedding uint32 // 1 if background work is being shed, accessed atomically
+	quit     chan struct{}
+}
+
+// newLoadShedder creates a load shedder for the limits set in the config. It
+// returns nil if no limits are configured.
+func newLoadShedder(config *etrue.Config, indexers ...pausableIndexer) *loadShedder {
+	if config.LightMemoryLimit <= 0 && config.LightCPULimit <= 0 {
+		return nil
+	}
+	s := &loadShedder{
+		indexers: indexers,
+		quit:     make(chan struct{}),
+	}
+	if config.LightMemoryLimit > 0 {
+		s.memLimit = uint64(config.LightMemoryLimit) * 1024 * 1024
+	}
+	if config.LightCPULimit > 0 {
+		s.cpuLimit = float64(config.LightCPULimit) / 100
+	}
+	return s
+}
+
+// start starts the sampling loop
+func (s *loadShedder) start() {
+	if s != nil {
+		go s.loop()
+	}
+}
+
+// stop terminates the sampling loop
+func (s *loadShedder) stop() {
+	if s != nil {
+		close(s.quit)
+	}
+}
+
+// overloaded returns true if low priority requests should be rejected
+func (s *loadShedder) overloaded() bool {
+	return s != nil && atomic.LoadUint32(&s.shedding) != 0
+}
+
+func (s *loadShedder) loop() {
+	var (
+		mem      runtime.MemStats
+		procTime gosigar.ProcTime
+		lastCPU  uint64
+		lastTime = time.Now()
+	)
+	if err := procTime.Get(os.Getpid()); err == nil {
+		lastCPU = procTime.Total
+	}
+	ticker := time.NewTicker(loadCheckPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			var memUsage, cpuUsage float64
+			if s.memLimit != 0 {
+				runtime.ReadMemStats(&mem)
+				memUsage = float64(mem.HeapAlloc) / float64(s.memLimit)
+			}
+			if s.cpuLimit != 0 {
+				if err := procTime.Get(os.Getpid()); err == nil {
+					// process time is measured in milliseconds
+					elapsed := time.Since(lastTime)
+					cores := float64(procTime.Total-lastCPU) * float64(time.Millisecond) / float64(elapsed)
+					cpuUsage = cores / s.cpuLimit
+					lastCPU = procTime.Total
+				}
+				lastTime = time.Now()
+			}
+			shedding := atomic.LoadUint32(&s.shedding) != 0
+			switch {
+			case !shedding && (memUsage > 1 || cpuUsage > 1):
+				log.Warn("Light client overloaded, shedding background work", "mem", mem.HeapAlloc, "cpu", cpuUsage*s.cpuLimit)
+				atomic.StoreUint32(&s.shedding, 1)
+				loadSheddingGauge.Update(1)
+				for _, indexer := range s.indexers {
+					indexer.Pause()
+				}
+			case shedding && memUsage < loadRecoverRatio && cpuUsage < loadRecoverRatio:
+				log.Info("Light client load recovered, resuming background work")
+				atomic.StoreUint32(&s.shedding, 0)
+				loadSheddingGauge.Update(0)
+				for _, indexer := range s.indexers {
+					indexer.Resume()
+				}
+			}
+		case <-s.quit:
+			return
+		}
+	}
+}
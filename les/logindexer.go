@@ -0,0 +1,227 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"context"
+	"time"
+
+	"truechain/discovery/common"
+	"truechain/discovery/core/rawdb"
+	"truechain/discovery/core/types"
+	"truechain/discovery/event"
+	"truechain/discovery/light/fast"
+	"truechain/discovery/log"
+	"truechain/discovery/rlp"
+)
+
+const (
+	logIndexChanSize = 10
+	logIndexTimeout  = time.Minute // time limit of retrieving the logs of a block
+)
+
+// logIndexerPrefix + name stores the last block processed by a log indexer, so
+// that no block is missed or indexed twice across restarts.
+var logIndexerPrefix = []byte("LightLogIndexer-")
+
+// LogIndexer is a plugin building a local index of the events of a set of
+// contracts inside the light client process. The logs handed to it are taken
+// from receipts verified against the receipt root of their fast block header.
+type LogIndexer interface {
+	// Contracts returns the contracts whose events are indexed.
+	Contracts() []common.Address
+
+	// Index processes the logs of the contracts emitted in a block which became
+	// canonical, in block order. The block is retried if an error is returned.
+	Index(header *types.Header, logs []*types.Log) error
+
+	// Unindex reverts the logs of an indexed block which is no longer canonical,
+	// in reverse block order. The block is retried if an error is returned.
+	Unindex(header *types.Header, logs []*types.Log) error
+}
+
+// logIndexProgress is the last block processed by a log indexer.
+type logIndexProgress struct {
+	Number uint64
+	Hash   common.Hash
+}
+
+// logIndexer feeds the logs of the new canonical blocks to a LogIndexer and
+// reverts the ones of the blocks reorged out. Receipts are only retrieved for
+// the blocks whose bloom matches a contract of the indexer.
+type logIndexer struct {
+	name      string
+	indexer   LogIndexer
+	etrue     *LightEtrue
+	contracts map[common.Address]bloomPositions
+
+	headCh chan types.FastChainHeadEvent
+	sub    event.Subscription
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// RegisterLogIndexer registers a plugin indexing the events of contracts. The
+// name identifies the progress of the indexer in the database, blocks are
+// indexed from the head at the first start of the indexer on. It must be called
+// before the light client is started.
+func (s *LightEtrue) RegisterLogIndexer(name string, indexer LogIndexer) {
+	l := &logIndexer{
+		name:      name,
+		indexer:   indexer,
+		etrue:     s,
+		contracts: make(map[common.Address]bloomPositions),
+	}
+	for _, addr := range indexer.Contracts() {
+		l.contracts[addr] = newBloomPositions(addr[:])
+	}
+	s.logIndexers = append(s.logIndexers, l)
+}
+
+// start starts indexing the new heads.
+func (l *logIndexer) start() {
+	l.ctx, l.cancel = context.WithCancel(withRequestPriority(context.Background(), priorityBackground))
+	l.headCh = make(chan types.FastChainHeadEvent, logIndexChanSize)
+	l.sub = l.etrue.fblockchain.SubscribeChainHeadEvent(l.headCh)
+	l.etrue.wg.Add(1)
+	go l.loop()
+}
+
+// stop stops indexing, the progress is kept in the database.
+func (l *logIndexer) stop() {
+	l.sub.Unsubscribe()
+	l.cancel()
+}
+
+func (l *logIndexer) loop() {
+	defer l.etrue.wg.Done()
+
+	l.process(l.etrue.fblockchain.CurrentHeader())
+	for {
+		select {
+		case ev := <-l.headCh:
+			l.process(ev.Block.Header())
+		case <-l.ctx.Done():
+			return
+		}
+	}
+}
+
+// process reverts the indexed blocks which are no longer canonical, then
+// indexes the canonical blocks up to the head. Processing stops at the first
+// block which fails, it is retried on the next head.
+func (l *logIndexer) process(head *types.Header) {
+	db := l.etrue.chainDb
+	progress := l.progress()
+	if progress == nil {
+		l.setProgress(&logIndexProgress{Number: head.Number.Uint64(), Hash: head.Hash()})
+		log.Info("Started log indexer", "name", l.name, "contracts", len(l.contracts), "number", head.Number)
+		return
+	}
+	for progress.Number > 0 && rawdb.ReadCanonicalHash(db, progress.Number) != progress.Hash {
+		header := rawdb.ReadHeader(db, progress.Hash, progress.Number)
+		if header == nil {
+			log.Error("Reorged indexed block missing", "name", l.name, "number", progress.Number, "hash", progress.Hash)
+			return
+		}
+		if err := l.apply(header, l.indexer.Unindex); err != nil {
+			log.Warn("Failed to unindex block logs", "name", l.name, "number", progress.Number, "err", err)
+			return
+		}
+		progress = &logIndexProgress{Number: progress.Number - 1, Hash: header.ParentHash}
+		l.setProgress(progress)
+	}
+	for number := progress.Number + 1; number <= head.Number.Uint64() && l.ctx.Err() == nil; number++ {
+		ctx, cancel := context.WithTimeout(l.ctx, logIndexTimeout)
+		header, err := l.etrue.fblockchain.GetHeaderByNumberOdr(ctx, number)
+		cancel()
+		if header == nil {
+			log.Debug("Failed to retrieve header for log indexing", "name", l.name, "number", number, "err", err)
+			return
+		}
+		if header.ParentHash != progress.Hash {
+			return // reorged meanwhile, reverted at the next head
+		}
+		if err := l.apply(header, l.indexer.Index); err != nil {
+			log.Warn("Failed to index block logs", "name", l.name, "number", number, "err", err)
+			return
+		}
+		progress = &logIndexProgress{Number: number, Hash: header.Hash()}
+		l.setProgress(progress)
+	}
+}
+
+// apply hands the logs of the indexed contracts emitted in a block to the
+// indexer, if the bloom of the block matches any of the contracts.
+func (l *logIndexer) apply(header *types.Header, fn func(*types.Header, []*types.Log) error) error {
+	matched := false
+	for _, pos := range l.contracts {
+		if pos.in(header.Bloom) {
+			matched = true
+			break
+		}
+	}
+	if !matched {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(l.ctx, logIndexTimeout)
+	defer cancel()
+
+	receipts, err := fast.GetBlockReceipts(ctx, l.etrue.odr, header.Hash(), header.Number.Uint64())
+	if err != nil {
+		return err
+	}
+	var logs []*types.Log
+	for _, receipt := range receipts {
+		for _, lg := range receipt.Logs {
+			if _, ok := l.contracts[lg.Address]; ok {
+				logs = append(logs, lg)
+			}
+		}
+	}
+	if len(logs) == 0 {
+		return nil
+	}
+	return fn(header, logs)
+}
+
+// progress returns the last block processed by the indexer, nil if it's new.
+func (l *logIndexer) progress() *logIndexProgress {
+	enc, err := l.etrue.chainDb.Get(l.key())
+	if err != nil || len(enc) == 0 {
+		return nil
+	}
+	progress := new(logIndexProgress)
+	if err := rlp.DecodeBytes(enc, progress); err != nil {
+		log.Error("Invalid log indexer progress", "name", l.name, "err", err)
+		return nil
+	}
+	return progress
+}
+
+// key returns the database key of the progress of the indexer.
+func (l *logIndexer) key() []byte {
+	return append(append([]byte{}, logIndexerPrefix...), l.name...)
+}
+
+// setProgress stores the last block processed by the indexer.
+func (l *logIndexer) setProgress(progress *logIndexProgress) {
+	enc, _ := rlp.EncodeToBytes(progress)
+	if err := l.etrue.chainDb.Put(l.key(), enc); err != nil {
+		log.Error("Failed to store log indexer progress", "name", l.name, "err", err)
+	}
+}
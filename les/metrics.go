@@ -29,6 +29,31 @@ var (
 
 	connectionTimer = metrics.NewRegisteredTimer("les/connectionTime", nil)
 
+	// Peers rejected in the handshake by reason
+	handshakeGenesisMeter    = metrics.NewRegisteredMeter("les/handshake/rejected/genesis", nil)
+	handshakeNetworkMeter    = metrics.NewRegisteredMeter("les/handshake/rejected/network", nil)
+	handshakeVersionMeter    = metrics.NewRegisteredMeter("les/handshake/rejected/version", nil)
+	handshakeForkMeter       = metrics.NewRegisteredMeter("les/handshake/rejected/forkid", nil)
+	handshakeCheckpointMeter = metrics.NewRegisteredMeter("les/handshake/rejected/checkpoint", nil)
+
+	loadSheddingGauge   = metrics.NewRegisteredGauge("les/client/loadShedding", nil)
+	loadShedRejectMeter = metrics.NewRegisteredMeter("les/client/loadShedRejected", nil)
+	eventDroppedMeter   = metrics.NewRegisteredMeter("les/client/eventsDropped", nil)
+	headDivergedMeter   = metrics.NewRegisteredMeter("les/client/headDiverged", nil)
+	odrCacheHitMeter    = metrics.NewRegisteredMeter("les/client/odrCache/hit", nil)
+	odrCacheMissMeter   = metrics.NewRegisteredMeter("les/client/odrCache/miss", nil)
+	proofDuplicateMeter = metrics.NewRegisteredMeter("les/client/proofs/duplicate", nil)
+	proofOmittedMeter   = metrics.NewRegisteredMeter("les/client/proofs/omitted", nil)
+
+	invalidReceiptsMeter = metrics.NewRegisteredMeter("les/client/receipts/invalid", nil) // receipts not matching the receipt root
+
+	// Requests queued in the distributor by priority class
+	distQueuedGauges = [priorityClasses]metrics.Gauge{
+		metrics.NewRegisteredGauge("les/client/distributor/queued/interactive", nil),
+		metrics.NewRegisteredGauge("les/client/distributor/queued/sync", nil),
+		metrics.NewRegisteredGauge("les/client/distributor/queued/background", nil),
+	}
+
 	totalConnectedGauge     = metrics.NewRegisteredGauge("les/server/totalConnected", nil)
 	totalCapacityGauge      = metrics.NewRegisteredGauge("les/server/totalCapacity", nil)
 	totalRechargeGauge      = metrics.NewRegisteredGauge("les/server/totalRecharge", nil)
@@ -47,13 +72,16 @@ var (
 	clientDisconnectedMeter = metrics.NewRegisteredMeter("les/server/clientEvent/disconnected", nil)
 	clientFreezeMeter       = metrics.NewRegisteredMeter("les/server/clientEvent/freeze", nil)
 	clientErrorMeter        = metrics.NewRegisteredMeter("les/server/clientEvent/error", nil)
+
+	proofOmittedTrafficMeter = metrics.NewRegisteredMeter("les/server/proofs/omittedTraffic", nil)
 )
 
 // meteredMsgReadWriter is a wrapper around a p2p.MsgReadWriter, capable of
 // accumulating the above defined metrics based on the data stream contents.
 type meteredMsgReadWriter struct {
-	p2p.MsgReadWriter     // Wrapped message stream to meter
-	version           int // Protocol version to select correct meters
+	p2p.MsgReadWriter              // Wrapped message stream to meter
+	version           int          // Protocol version to select correct meters
+	peer              *peerMetrics // Per message type metrics of a server, nil on the server side
 }
 
 // newMeteredMsgWriter wraps a p2p MsgReadWriter with metering support. If the
@@ -66,9 +94,11 @@ func newMeteredMsgWriter(rw p2p.MsgReadWriter) p2p.MsgReadWriter {
 }
 
 // Init sets the protocol version used by the stream to know which meters to
-// increment in case of overlapping message ids between protocol versions.
-func (rw *meteredMsgReadWriter) Init(version int) {
+// increment in case of overlapping message ids between protocol versions, and
+// the metrics of the server if the stream is connected to one.
+func (rw *meteredMsgReadWriter) Init(version int, peer *peerMetrics) {
 	rw.version = version
+	rw.peer = peer
 }
 
 func (rw *meteredMsgReadWriter) ReadMsg() (p2p.Msg, error) {
@@ -81,7 +111,9 @@ func (rw *meteredMsgReadWriter) ReadMsg() (p2p.Msg, error) {
 	packets, traffic := miscInPacketsMeter, miscInTrafficMeter
 	packets.Mark(1)
 	traffic.Mark(int64(msg.Size))
-
+	if rw.peer != nil {
+		rw.peer.message(msg.Code, true, msg.Size)
+	}
 	return msg, err
 }
 
@@ -90,7 +122,9 @@ func (rw *meteredMsgReadWriter) WriteMsg(msg p2p.Msg) error {
 	packets, traffic := miscOutPacketsMeter, miscOutTrafficMeter
 	packets.Mark(1)
 	traffic.Mark(int64(msg.Size))
-
+	if rw.peer != nil {
+		rw.peer.message(msg.Code, false, msg.Size)
+	}
 	// Send the packet to the p2p layer
 	return rw.MsgReadWriter.WriteMsg(msg)
 }
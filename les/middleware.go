@@ -0,0 +1,289 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"context"
+	"errors"
+	"math/big"
+
+	"truechain/discovery/common"
+	"truechain/discovery/core/state"
+	"truechain/discovery/core/types"
+	"truechain/discovery/etrue/filters"
+	"truechain/discovery/internal/trueapi"
+	"truechain/discovery/rpc"
+)
+
+var errMiddlewareResults = errors.New("wrong number of results returned by backend middleware")
+
+// BackendCall is a call of the light client API backend seen by middlewares.
+type BackendCall struct {
+	Method string        // name of the backend method, e.g. "HeaderByNumber"
+	Args   []interface{} // arguments of the method besides the context
+}
+
+// BackendMiddleware hooks into the calls of the light client API backend which
+// retrieve data from the servers or send transactions, so that operators of
+// RPC gateways can implement authorisation, caching or request shaping policies
+// without forking the backend. The results of a call are the return values of
+// the method besides the error, in order and of the same types.
+type BackendMiddleware interface {
+	// Before runs before a call. It may replace the context, e.g. to shorten
+	// its deadline, and answer the call itself by returning results, e.g. from
+	// a cache, or an error, e.g. to reject it.
+	Before(ctx context.Context, call *BackendCall) (context.Context, []interface{}, error)
+
+	// After runs after a call and may replace its results or error. It runs
+	// for every middleware whose Before ran, in reverse order.
+	After(ctx context.Context, call *BackendCall, results []interface{}, err error) ([]interface{}, error)
+}
+
+// UseBackendMiddleware adds a middleware around the calls of the API backend
+// made by the RPC services. Middlewares run in the order they are added. It
+// must be called before the node is started.
+func (s *LightEtrue) UseBackendMiddleware(m BackendMiddleware) {
+	s.middlewares = append(s.middlewares, m)
+}
+
+// rpcBackend is the backend of the RPC services of the light client.
+type rpcBackend interface {
+	trueapi.Backend
+	filters.Backend
+}
+
+// apiBackend returns the backend of the RPC services, wrapped by the
+// middlewares if there are any.
+func (s *LightEtrue) apiBackend() rpcBackend {
+	if len(s.middlewares) == 0 {
+		return s.ApiBackend
+	}
+	return &hookedBackend{LesApiBackend: s.ApiBackend, middlewares: s.middlewares}
+}
+
+// hookedBackend runs the middlewares around the calls of the API backend.
+// Calls without a context are passed through.
+type hookedBackend struct {
+	*LesApiBackend
+	middlewares []BackendMiddleware
+}
+
+// call runs a backend call through the middlewares, checking the number of
+// results.
+func (b *hookedBackend) call(ctx context.Context, method string, args []interface{}, want int, fn func(context.Context) ([]interface{}, error)) ([]interface{}, error) {
+	var (
+		call    = &BackendCall{Method: method, Args: args}
+		results []interface{}
+		err     error
+		ran     int
+	)
+	for _, m := range b.middlewares {
+		ran++
+		if ctx, results, err = m.Before(ctx, call); err != nil || results != nil {
+			break
+		}
+	}
+	if err == nil && results == nil {
+		results, err = fn(ctx)
+	}
+	for i := ran - 1; i >= 0; i-- {
+		results, err = b.middlewares[i].After(ctx, call, results, err)
+	}
+	if err == nil && len(results) != want {
+		return nil, errMiddlewareResults
+	}
+	return results, err
+}
+
+func (b *hookedBackend) HeaderByNumber(ctx context.Context, blockNr rpc.BlockNumber) (*types.Header, error) {
+	res, err := b.call(ctx, "HeaderByNumber", []interface{}{blockNr}, 1, func(ctx context.Context) ([]interface{}, error) {
+		header, err := b.LesApiBackend.HeaderByNumber(ctx, blockNr)
+		return []interface{}{header}, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	header, _ := res[0].(*types.Header)
+	return header, nil
+}
+
+func (b *hookedBackend) HeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error) {
+	res, err := b.call(ctx, "HeaderByHash", []interface{}{hash}, 1, func(ctx context.Context) ([]interface{}, error) {
+		header, err := b.LesApiBackend.HeaderByHash(ctx, hash)
+		return []interface{}{header}, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	header, _ := res[0].(*types.Header)
+	return header, nil
+}
+
+func (b *hookedBackend) SnailHeaderByNumber(ctx context.Context, blockNr rpc.BlockNumber) (*types.SnailHeader, error) {
+	res, err := b.call(ctx, "SnailHeaderByNumber", []interface{}{blockNr}, 1, func(ctx context.Context) ([]interface{}, error) {
+		header, err := b.LesApiBackend.SnailHeaderByNumber(ctx, blockNr)
+		return []interface{}{header}, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	header, _ := res[0].(*types.SnailHeader)
+	return header, nil
+}
+
+func (b *hookedBackend) BlockByNumber(ctx context.Context, blockNr rpc.BlockNumber) (*types.Block, error) {
+	res, err := b.call(ctx, "BlockByNumber", []interface{}{blockNr}, 1, func(ctx context.Context) ([]interface{}, error) {
+		block, err := b.LesApiBackend.BlockByNumber(ctx, blockNr)
+		return []interface{}{block}, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	block, _ := res[0].(*types.Block)
+	return block, nil
+}
+
+func (b *hookedBackend) SnailBlockByNumber(ctx context.Context, blockNr rpc.BlockNumber) (*types.SnailBlock, error) {
+	res, err := b.call(ctx, "SnailBlockByNumber", []interface{}{blockNr}, 1, func(ctx context.Context) ([]interface{}, error) {
+		block, err := b.LesApiBackend.SnailBlockByNumber(ctx, blockNr)
+		return []interface{}{block}, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	block, _ := res[0].(*types.SnailBlock)
+	return block, nil
+}
+
+func (b *hookedBackend) StateAndHeaderByNumber(ctx context.Context, blockNr rpc.BlockNumber) (*state.StateDB, *types.Header, error) {
+	res, err := b.call(ctx, "StateAndHeaderByNumber", []interface{}{blockNr}, 2, func(ctx context.Context) ([]interface{}, error) {
+		st, header, err := b.LesApiBackend.StateAndHeaderByNumber(ctx, blockNr)
+		return []interface{}{st, header}, err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	st, _ := res[0].(*state.StateDB)
+	header, _ := res[1].(*types.Header)
+	return st, header, nil
+}
+
+func (b *hookedBackend) GetBlock(ctx context.Context, blockHash common.Hash) (*types.Block, error) {
+	res, err := b.call(ctx, "GetBlock", []interface{}{blockHash}, 1, func(ctx context.Context) ([]interface{}, error) {
+		block, err := b.LesApiBackend.GetBlock(ctx, blockHash)
+		return []interface{}{block}, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	block, _ := res[0].(*types.Block)
+	return block, nil
+}
+
+func (b *hookedBackend) GetFruit(ctx context.Context, fastblockHash common.Hash) (*types.SnailBlock, error) {
+	res, err := b.call(ctx, "GetFruit", []interface{}{fastblockHash}, 1, func(ctx context.Context) ([]interface{}, error) {
+		fruit, err := b.LesApiBackend.GetFruit(ctx, fastblockHash)
+		return []interface{}{fruit}, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	fruit, _ := res[0].(*types.SnailBlock)
+	return fruit, nil
+}
+
+func (b *hookedBackend) GetSnailBlock(ctx context.Context, blockHash common.Hash) (*types.SnailBlock, error) {
+	res, err := b.call(ctx, "GetSnailBlock", []interface{}{blockHash}, 1, func(ctx context.Context) ([]interface{}, error) {
+		block, err := b.LesApiBackend.GetSnailBlock(ctx, blockHash)
+		return []interface{}{block}, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	block, _ := res[0].(*types.SnailBlock)
+	return block, nil
+}
+
+func (b *hookedBackend) GetReceipts(ctx context.Context, hash common.Hash) (types.Receipts, error) {
+	res, err := b.call(ctx, "GetReceipts", []interface{}{hash}, 1, func(ctx context.Context) ([]interface{}, error) {
+		receipts, err := b.LesApiBackend.GetReceipts(ctx, hash)
+		return []interface{}{receipts}, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	receipts, _ := res[0].(types.Receipts)
+	return receipts, nil
+}
+
+func (b *hookedBackend) GetLogs(ctx context.Context, hash common.Hash) ([][]*types.Log, error) {
+	res, err := b.call(ctx, "GetLogs", []interface{}{hash}, 1, func(ctx context.Context) ([]interface{}, error) {
+		logs, err := b.LesApiBackend.GetLogs(ctx, hash)
+		return []interface{}{logs}, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	logs, _ := res[0].([][]*types.Log)
+	return logs, nil
+}
+
+func (b *hookedBackend) SendTx(ctx context.Context, signedTx *types.Transaction) error {
+	_, err := b.call(ctx, "SendTx", []interface{}{signedTx}, 0, func(ctx context.Context) ([]interface{}, error) {
+		return []interface{}{}, b.LesApiBackend.SendTx(ctx, signedTx)
+	})
+	return err
+}
+
+func (b *hookedBackend) GetTransaction(ctx context.Context, txHash common.Hash) (*types.Transaction, common.Hash, uint64, uint64, error) {
+	res, err := b.call(ctx, "GetTransaction", []interface{}{txHash}, 4, func(ctx context.Context) ([]interface{}, error) {
+		tx, blockHash, number, index, err := b.LesApiBackend.GetTransaction(ctx, txHash)
+		return []interface{}{tx, blockHash, number, index}, err
+	})
+	if err != nil {
+		return nil, common.Hash{}, 0, 0, err
+	}
+	tx, _ := res[0].(*types.Transaction)
+	blockHash, _ := res[1].(common.Hash)
+	number, _ := res[2].(uint64)
+	index, _ := res[3].(uint64)
+	return tx, blockHash, number, index, nil
+}
+
+func (b *hookedBackend) GetPoolNonce(ctx context.Context, addr common.Address) (uint64, error) {
+	res, err := b.call(ctx, "GetPoolNonce", []interface{}{addr}, 1, func(ctx context.Context) ([]interface{}, error) {
+		nonce, err := b.LesApiBackend.GetPoolNonce(ctx, addr)
+		return []interface{}{nonce}, err
+	})
+	if err != nil {
+		return 0, err
+	}
+	nonce, _ := res[0].(uint64)
+	return nonce, nil
+}
+
+func (b *hookedBackend) SuggestPrice(ctx context.Context) (*big.Int, error) {
+	res, err := b.call(ctx, "SuggestPrice", nil, 1, func(ctx context.Context) ([]interface{}, error) {
+		price, err := b.LesApiBackend.SuggestPrice(ctx)
+		return []interface{}{price}, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	price, _ := res[0].(*big.Int)
+	return price, nil
+}
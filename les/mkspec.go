@@ -0,0 +1,197 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// +build none
+
+// The mkspec command generates the les protocol constants, request limits and
+// cost tables from the checked-in protocol spec.
+//
+//     go run mkspec.go -spec protocol_spec.json -out gen_protocol.go
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"strings"
+	"text/template"
+)
+
+type spec struct {
+	Versions []struct {
+		Version uint   `json:"version"`
+		Name    string `json:"name"`
+		Length  uint64 `json:"length"`
+	} `json:"versions"`
+	Limits []struct {
+		Name  string `json:"name"`
+		Value uint64 `json:"value"`
+		Doc   string `json:"doc"`
+	} `json:"limits"`
+	Messages []struct {
+		Name    string `json:"name"`
+		Code    uint64 `json:"code"`
+		Since   uint   `json:"since"`
+		Request *struct {
+			Name            string    `json:"name"`
+			Limit           string    `json:"limit"`
+			AvgTimeCost     [2]uint64 `json:"avgTimeCost"`
+			MaxInSize       [2]uint64 `json:"maxInSize"`
+			MaxOutSize      [2]uint64 `json:"maxOutSize"`
+			MinBufferAmount uint64    `json:"minBufferAmount"`
+		} `json:"request"`
+	} `json:"messages"`
+}
+
+var sinceDocs = map[uint]string{
+	1: "Protocol messages inherited from LPV1",
+	2: "Protocol messages belonging to LPV2",
+	3: "Protocol messages introduced in LPV3",
+}
+
+var tmpl = template.Must(template.New("").Funcs(template.FuncMap{
+	"hex":       func(code uint64) string { return fmt.Sprintf("0x%02x", code) },
+	"sinceDoc":  func(since uint) string { return sinceDocs[since] },
+	"backquote": func(s string) string { return "`" + s + "`" },
+}).Parse(`// Code generated by mkspec.go from {{.File}}. DO NOT EDIT.
+
+package les
+
+// Number of implemented message corresponding to different protocol versions.
+var ProtocolLengths = map[uint]uint64{
+{{- range .Spec.Versions}}
+	{{.Name}}: {{.Length}},
+{{- end}}
+}
+
+// les protocol message codes
+const (
+{{- $since := 0}}
+{{- range .Spec.Messages}}
+{{- if ne .Since $since}}{{$since = .Since}}
+	// {{sinceDoc .Since}}{{end}}
+	{{.Name}} = {{hex .Code}}
+{{- end}}
+)
+
+// request limits
+const (
+{{- range .Spec.Limits}}
+	{{.Name}} = {{.Value}} // {{.Doc}}
+{{- end}}
+)
+
+var requests = map[uint64]requestInfo{
+{{- range .Spec.Messages}}{{if .Request}}
+	{{.Name}}: { {{printf "%q" .Request.Name}}, {{.Request.Limit}} },
+{{- end}}{{end}}
+}
+
+var (
+	// average request cost estimates based on serving time
+	reqAvgTimeCost = requestCostTable{
+	{{- range .Spec.Messages}}{{if .Request}}
+		{{.Name}}: { {{index .Request.AvgTimeCost 0}}, {{index .Request.AvgTimeCost 1}} },
+	{{- end}}{{end}}
+	}
+	// maximum incoming message size estimates
+	reqMaxInSize = requestCostTable{
+	{{- range .Spec.Messages}}{{if .Request}}
+		{{.Name}}: { {{index .Request.MaxInSize 0}}, {{index .Request.MaxInSize 1}} },
+	{{- end}}{{end}}
+	}
+	// maximum outgoing message size estimates
+	reqMaxOutSize = requestCostTable{
+	{{- range .Spec.Messages}}{{if .Request}}
+		{{.Name}}: { {{index .Request.MaxOutSize 0}}, {{index .Request.MaxOutSize 1}} },
+	{{- end}}{{end}}
+	}
+	// request amounts that have to fit into the minimum buffer size minBufferMultiplier times
+	minBufferReqAmount = map[uint64]uint64{
+	{{- range .Spec.Messages}}{{if .Request}}
+		{{.Name}}: {{.Request.MinBufferAmount}},
+	{{- end}}{{end}}
+	}
+)
+
+// protocolSpecJSON is the spec the tables above were generated from.
+const protocolSpecJSON = {{backquote .Raw}}
+`))
+
+func main() {
+	var (
+		specFile = flag.String("spec", "protocol_spec.json", "protocol spec to generate the tables from")
+		outFile  = flag.String("out", "gen_protocol.go", "output file")
+	)
+	flag.Parse()
+
+	raw, err := ioutil.ReadFile(*specFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var s spec
+	if err := json.Unmarshal(raw, &s); err != nil {
+		log.Fatalf("invalid spec: %v", err)
+	}
+	if err := validate(&s); err != nil {
+		log.Fatalf("invalid spec: %v", err)
+	}
+	var buf bytes.Buffer
+	data := map[string]interface{}{"File": *specFile, "Spec": s, "Raw": strings.TrimSpace(string(raw))}
+	if err := tmpl.Execute(&buf, data); err != nil {
+		log.Fatal(err)
+	}
+	code, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatalf("generated invalid code: %v\n%s", err, buf.Bytes())
+	}
+	if err := ioutil.WriteFile(*outFile, code, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// validate checks that message codes are unique and fit into the length of
+// every protocol version they belong to, and that every request refers to a
+// defined limit.
+func validate(s *spec) error {
+	if len(s.Versions) == 0 {
+		return fmt.Errorf("no protocol versions")
+	}
+	limits := make(map[string]bool)
+	for _, l := range s.Limits {
+		limits[l.Name] = true
+	}
+	codes := make(map[uint64]string)
+	for _, m := range s.Messages {
+		for _, v := range s.Versions {
+			if v.Version >= m.Since && m.Code >= v.Length {
+				return fmt.Errorf("message %s code %d exceeds protocol %s length %d", m.Name, m.Code, v.Name, v.Length)
+			}
+		}
+		if prev, ok := codes[m.Code]; ok {
+			return fmt.Errorf("messages %s and %s share code %d", prev, m.Name, m.Code)
+		}
+		codes[m.Code] = m.Name
+		if m.Request != nil && !limits[m.Request.Limit] {
+			return fmt.Errorf("message %s refers to unknown limit %s", m.Name, m.Request.Limit)
+		}
+	}
+	return nil
+}
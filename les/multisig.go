@@ -0,0 +1,323 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"sync"
+
+	"truechain/discovery/accounts"
+	"truechain/discovery/common"
+	"truechain/discovery/common/hexutil"
+	"truechain/discovery/contracts/multisig"
+	"truechain/discovery/core"
+	"truechain/discovery/core/types"
+	"truechain/discovery/core/vm"
+	"truechain/discovery/crypto"
+	"truechain/discovery/rpc"
+)
+
+var (
+	errMultisigUnknown   = errors.New("unknown multisig proposal")
+	errMultisigNotOwner  = errors.New("signer is not an owner of the multisig contract")
+	errMultisigNoQuorum  = errors.New("not enough signatures collected")
+	errMultisigStale     = errors.New("multisig nonce changed since the proposal")
+	errMultisigSignature = errors.New("signature must be 65 bytes in the [R || S || V] format")
+)
+
+// MultisigInfo is the state of a multi-signature wallet contract.
+type MultisigInfo struct {
+	Contract  common.Address   `json:"contract"`
+	Nonce     uint64           `json:"nonce"`
+	Threshold uint64           `json:"threshold"`
+	Owners    []common.Address `json:"owners"`
+}
+
+// MultisigProposal is a call of a multi-signature wallet for which signatures
+// of the owners are collected. Owners sign Hash with their key, the call is
+// relayed once Threshold signatures are collected.
+type MultisigProposal struct {
+	Hash        common.Hash                      `json:"hash"`
+	Contract    common.Address                   `json:"contract"`
+	Destination common.Address                   `json:"destination"`
+	Value       *hexutil.Big                     `json:"value"`
+	Data        hexutil.Bytes                    `json:"data"`
+	Nonce       uint64                           `json:"nonce"`
+	Threshold   uint64                           `json:"threshold"`
+	Owners      []common.Address                 `json:"owners"`
+	Signatures  map[common.Address]hexutil.Bytes `json:"signatures"`
+}
+
+// multisigBook collects the signatures of the multisig proposals. Proposals are
+// only kept in memory, they are dropped once relayed.
+type multisigBook struct {
+	packer *multisig.Multisig
+
+	lock      sync.Mutex
+	proposals map[common.Hash]*MultisigProposal
+}
+
+// newMultisigBook creates an empty book of multisig proposals.
+func newMultisigBook() *multisigBook {
+	packer, err := multisig.New()
+	if err != nil {
+		panic(err) // the ABI is a constant
+	}
+	return &multisigBook{
+		packer:    packer,
+		proposals: make(map[common.Hash]*MultisigProposal),
+	}
+}
+
+// callContract executes a read-only call of a contract on the state of the
+// current head, retrieving the accessed state on demand.
+func (s *LightEtrue) callContract(ctx context.Context, from common.Address, contract common.Address, input []byte) (*core.ExecutionResult, error) {
+	statedb, header, err := s.ApiBackend.StateAndHeaderByNumber(ctx, rpc.LatestBlockNumber)
+	if statedb == nil || err != nil {
+		return nil, err
+	}
+	msg := types.NewMessage(from, &contract, common.Address{}, 0, new(big.Int), new(big.Int), math.MaxUint64/2, new(big.Int), input, false)
+	evm, vmError, err := s.ApiBackend.GetEVM(ctx, msg, statedb, header, vm.Config{})
+	if err != nil {
+		return nil, err
+	}
+	result, err := core.ApplyMessage(evm, msg, new(core.GasPool).AddGas(math.MaxUint64))
+	if err := vmError(); err != nil {
+		return nil, err
+	}
+	return result, err
+}
+
+// multisigInfo reads the nonce, the threshold and the owners of a multisig
+// contract.
+func (s *LightEtrue) multisigInfo(ctx context.Context, contract common.Address) (*MultisigInfo, error) {
+	packer := s.multisigs.packer
+	get := func(method string) ([]byte, error) {
+		input, err := packer.Pack(method)
+		if err != nil {
+			return nil, err
+		}
+		result, err := s.callContract(ctx, common.Address{}, contract, input)
+		if err != nil {
+			return nil, err
+		}
+		if result.Failed() {
+			return nil, fmt.Errorf("%s() failed: %v", method, result.Err)
+		}
+		return result.Return(), nil
+	}
+	info := &MultisigInfo{Contract: contract}
+	for _, method := range []string{"nonce", "threshold"} {
+		output, err := get(method)
+		if err != nil {
+			return nil, err
+		}
+		value, err := packer.UnpackUint(method, output)
+		if err != nil {
+			return nil, err
+		}
+		if method == "nonce" {
+			info.Nonce = value.Uint64()
+		} else {
+			info.Threshold = value.Uint64()
+		}
+	}
+	output, err := get("getOwners")
+	if err != nil {
+		return nil, err
+	}
+	if info.Owners, err = packer.UnpackOwners(output); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// proposeMultisig creates a proposal for a multisig call at the current nonce
+// of the contract. Proposing the same call again returns the existing proposal.
+func (s *LightEtrue) proposeMultisig(ctx context.Context, contract, destination common.Address, value *big.Int, data []byte) (*MultisigProposal, error) {
+	info, err := s.multisigInfo(ctx, contract)
+	if err != nil {
+		return nil, err
+	}
+	hash := multisig.SigningHash(contract, destination, value, data, info.Nonce)
+
+	book := s.multisigs
+	book.lock.Lock()
+	defer book.lock.Unlock()
+
+	if p, ok := book.proposals[hash]; ok {
+		return p.copy(), nil
+	}
+	p := &MultisigProposal{
+		Hash:        hash,
+		Contract:    contract,
+		Destination: destination,
+		Value:       (*hexutil.Big)(value),
+		Data:        data,
+		Nonce:       info.Nonce,
+		Threshold:   info.Threshold,
+		Owners:      info.Owners,
+		Signatures:  make(map[common.Address]hexutil.Bytes),
+	}
+	book.proposals[hash] = p
+	return p.copy(), nil
+}
+
+// signMultisig adds an owner signature to a proposal, returning the signer.
+// Both 0/1 and 27/28 are accepted as V.
+func (s *LightEtrue) signMultisig(hash common.Hash, sig []byte) (common.Address, error) {
+	if len(sig) != 65 {
+		return common.Address{}, errMultisigSignature
+	}
+	sig = common.CopyBytes(sig)
+	if sig[64] >= 27 {
+		sig[64] -= 27
+	}
+	pub, err := crypto.SigToPub(hash[:], sig)
+	if err != nil {
+		return common.Address{}, err
+	}
+	signer := crypto.PubkeyToAddress(*pub)
+
+	book := s.multisigs
+	book.lock.Lock()
+	defer book.lock.Unlock()
+
+	p, ok := book.proposals[hash]
+	if !ok {
+		return common.Address{}, errMultisigUnknown
+	}
+	owner := false
+	for _, addr := range p.Owners {
+		if addr == signer {
+			owner = true
+			break
+		}
+	}
+	if !owner {
+		return common.Address{}, errMultisigNotOwner
+	}
+	// The contract recovers the signers with V being 27 or 28
+	sig[64] += 27
+	p.Signatures[signer] = sig
+	return signer, nil
+}
+
+// list returns the multisig proposals collecting signatures.
+func (b *multisigBook) list() []*MultisigProposal {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	list := make([]*MultisigProposal, 0, len(b.proposals))
+	for _, p := range b.proposals {
+		list = append(list, p.copy())
+	}
+	return list
+}
+
+// copy returns a copy of the proposal which isn't changed by new signatures.
+func (p *MultisigProposal) copy() *MultisigProposal {
+	cpy := *p
+	cpy.Signatures = make(map[common.Address]hexutil.Bytes, len(p.Signatures))
+	for signer, sig := range p.Signatures {
+		cpy.Signatures[signer] = sig
+	}
+	return &cpy
+}
+
+// relayMultisig sends the execution of a proposal with enough signatures in a
+// transaction signed by the given unlocked account. The execution is simulated
+// first, so a call which would revert is not relayed. If gas is zero, the gas
+// used by the simulation is taken with a margin.
+func (s *LightEtrue) relayMultisig(ctx context.Context, hash common.Hash, from common.Address, gas uint64, gasPrice *big.Int) (common.Hash, error) {
+	book := s.multisigs
+	book.lock.Lock()
+	p, ok := book.proposals[hash]
+	if !ok {
+		book.lock.Unlock()
+		return common.Hash{}, errMultisigUnknown
+	}
+	if uint64(len(p.Signatures)) < p.Threshold {
+		book.lock.Unlock()
+		return common.Hash{}, errMultisigNoQuorum
+	}
+	// The contract requires the signatures sorted by signer address
+	signers := make([]common.Address, 0, len(p.Signatures))
+	for signer := range p.Signatures {
+		signers = append(signers, signer)
+	}
+	sort.Slice(signers, func(i, j int) bool { return bytes.Compare(signers[i][:], signers[j][:]) < 0 })
+	sigs := make([][]byte, len(signers))
+	for i, signer := range signers {
+		sigs[i] = p.Signatures[signer]
+	}
+	input, err := book.packer.PackExecute(p.Destination, p.Value.ToInt(), p.Data, sigs)
+	book.lock.Unlock()
+	if err != nil {
+		return common.Hash{}, err
+	}
+	info, err := s.multisigInfo(ctx, p.Contract)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if info.Nonce != p.Nonce {
+		return common.Hash{}, errMultisigStale
+	}
+	result, err := s.callContract(ctx, from, p.Contract, input)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if result.Failed() {
+		return common.Hash{}, fmt.Errorf("execution would fail: %v", result.Err)
+	}
+	if gas == 0 {
+		gas = result.UsedGas + result.UsedGas/5
+	}
+	if gasPrice == nil {
+		if gasPrice, err = s.ApiBackend.SuggestPrice(ctx); err != nil {
+			return common.Hash{}, err
+		}
+	}
+	nonce, err := s.txPool.GetNonce(ctx, from)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	account := accounts.Account{Address: from}
+	wallet, err := s.accountManager.Find(account)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	tx := types.NewTransaction(nonce, p.Contract, new(big.Int), gas, gasPrice, input)
+	signed, err := wallet.SignTx(account, tx, s.chainConfig.ChainID)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if err := s.txPool.Add(ctx, signed); err != nil {
+		return common.Hash{}, err
+	}
+	book.lock.Lock()
+	delete(book.proposals, hash)
+	book.lock.Unlock()
+
+	return signed.Hash(), nil
+}
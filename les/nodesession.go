@@ -0,0 +1,163 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+
+	"truechain/discovery/common"
+	"truechain/discovery/crypto"
+	"truechain/discovery/light/public"
+)
+
+// sessionNodeLimit is the default and maximum number of trie nodes remembered
+// by both sides of a connection with capNodeDedup. Both sides announce their
+// limit in the handshake and use the lower one: the server may only omit the
+// nodes the client still remembers.
+const sessionNodeLimit = 4096
+
+// proofOmitKnown is the ProofReq flag asking the server to omit the trie nodes
+// already sent in the proof replies of the session.
+const proofOmitKnown = 1
+
+// nodeSession tracks the trie nodes sent in the proof replies of a connection.
+// The server and the client apply the same rule to every reply in the order
+// the replies are sent: the nodes not yet in the session are appended, and the
+// oldest ones are dropped beyond the negotiated limit. Both sides thus agree on the
+// nodes the server may omit. The server side only keeps the hashes, the client
+// side also keeps the nodes, which proofs with omitted nodes are verified with.
+type nodeSession struct {
+	lock  sync.Mutex
+	keep  bool                   // keep the nodes, not only the hashes
+	limit int                    // number of nodes remembered
+	order []common.Hash          // nodes in the order they were added
+	nodes map[common.Hash][]byte // nil values on the server side
+}
+
+// newNodeSession creates an empty session of the negotiated size, keeping the
+// nodes on the client side.
+func newNodeSession(keep bool, limit int) *nodeSession {
+	return &nodeSession{
+		keep:  keep,
+		limit: limit,
+		nodes: make(map[common.Hash][]byte),
+	}
+}
+
+// sessionLimit returns the number of session nodes announced for a configured
+// size: zero selects the default, a negative size disables the session.
+func sessionLimit(size int) uint64 {
+	switch {
+	case size < 0:
+		return 0
+	case size == 0 || size > sessionNodeLimit:
+		return sessionNodeLimit
+	}
+	return uint64(size)
+}
+
+// add inserts the nodes of a reply not yet in the session. They are added in
+// the order of their hashes, so that both sides evict the same nodes whatever
+// the order or the encoding of the nodes in the reply. The lock is held by the
+// caller.
+func (s *nodeSession) add(list public.NodeList) {
+	var (
+		added  = make(map[common.Hash][]byte)
+		hashes []common.Hash
+	)
+	for _, node := range list {
+		hash := crypto.Keccak256Hash(node)
+		if _, ok := s.nodes[hash]; ok {
+			continue
+		}
+		if _, ok := added[hash]; ok {
+			continue
+		}
+		added[hash] = node
+		hashes = append(hashes, hash)
+	}
+	sort.Slice(hashes, func(i, j int) bool { return bytes.Compare(hashes[i][:], hashes[j][:]) < 0 })
+	for _, hash := range hashes {
+		if len(s.order) >= s.limit {
+			delete(s.nodes, s.order[0])
+			s.order = s.order[1:]
+		}
+		node := added[hash]
+		if !s.keep {
+			node = nil
+		}
+		s.order = append(s.order, hash)
+		s.nodes[hash] = node
+	}
+}
+
+// reply sends a reply on the server side and records its nodes if it is sent,
+// a reply dropped for a frozen client never reaches it. If omitKnown is set,
+// the nodes already sent in the session are removed from the reply. The session
+// is locked until the reply is queued, so that it's updated in the order the
+// client receives the replies.
+func (s *nodeSession) reply(list public.NodeList, omitKnown bool, send func(public.NodeList) bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var (
+		reply   public.NodeList
+		omitted int
+	)
+	for _, node := range list {
+		if _, ok := s.nodes[crypto.Keccak256Hash(node)]; ok && omitKnown {
+			omitted += len(node)
+			continue
+		}
+		reply = append(reply, node)
+	}
+	if omitted > 0 {
+		proofOmittedTrafficMeter.Mark(int64(omitted))
+	}
+	if send(reply) {
+		s.add(reply)
+	}
+}
+
+// record adds the nodes of a validated reply on the client side.
+func (s *nodeSession) record(list public.NodeList) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.add(list)
+}
+
+// Get returns a node received earlier in the session, implementing
+// trie.DatabaseReader.
+func (s *nodeSession) Get(key []byte) ([]byte, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if node := s.nodes[common.BytesToHash(key)]; node != nil {
+		return node, nil
+	}
+	return nil, errNotCached
+}
+
+// Has returns true if the node was received earlier in the session,
+// implementing trie.DatabaseReader.
+func (s *nodeSession) Has(key []byte) (bool, error) {
+	_, err := s.Get(key)
+	return err == nil, nil
+}
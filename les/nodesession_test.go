@@ -0,0 +1,94 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"fmt"
+	"testing"
+
+	"truechain/discovery/common"
+	"truechain/discovery/etruedb"
+	"truechain/discovery/light/fast"
+	"truechain/discovery/light/public"
+	"truechain/discovery/trie"
+)
+
+// makeTestProof returns the root of a small trie and the proof of one of its
+// keys.
+func makeTestProof(t *testing.T) (common.Hash, []byte, public.NodeList) {
+	tr, _ := trie.New(common.Hash{}, trie.NewDatabase(etruedb.NewMemDatabase()))
+	for i := 0; i < 100; i++ {
+		tr.Update([]byte(fmt.Sprintf("key-%d", i)), []byte(fmt.Sprintf("value-%d", i)))
+	}
+	root, err := tr.Commit(nil)
+	if err != nil {
+		t.Fatalf("failed to commit trie: %v", err)
+	}
+	key := []byte("key-42")
+	proof := public.NewNodeSet()
+	if err := tr.Prove(key, 0, proof); err != nil {
+		t.Fatalf("failed to prove key: %v", err)
+	}
+	return root, key, proof.NodeList()
+}
+
+// Tests that the server only records the nodes of the replies actually sent,
+// a reply dropped for a frozen client leaves the session unchanged.
+func TestNodeSessionDroppedReply(t *testing.T) {
+	_, _, nodes := makeTestProof(t)
+	s := newNodeSession(false, sessionNodeLimit)
+
+	var sent public.NodeList
+	s.reply(nodes, true, func(list public.NodeList) bool { return false })
+	s.reply(nodes, true, func(list public.NodeList) bool { sent = list; return true })
+	if len(sent) != len(nodes) {
+		t.Fatalf("nodes of the dropped reply omitted: sent %d of %d", len(sent), len(nodes))
+	}
+	s.reply(nodes, true, func(list public.NodeList) bool { sent = list; return true })
+	if len(sent) != 0 {
+		t.Fatalf("nodes of the sent reply not omitted: sent %d", len(sent))
+	}
+}
+
+// Tests that the client only records the nodes of a proof reply once it is
+// validated, and validates the later replies with the nodes omitted against
+// the session.
+func TestNodeSessionValidatedReply(t *testing.T) {
+	root, key, nodes := makeTestProof(t)
+	s := newNodeSession(true, sessionNodeLimit)
+
+	// A reply failing the validation must not be recorded
+	req := &TrieRequest{Id: &fast.TrieID{Root: common.Hash{1}}, Key: key}
+	if err := req.Validate(nil, &Msg{MsgType: MsgProofsV2, Obj: nodes, Known: s}); err == nil {
+		t.Fatal("proof of the wrong root validated")
+	}
+	if len(s.order) != 0 {
+		t.Fatalf("nodes of an invalid reply recorded: %d", len(s.order))
+	}
+	// A valid reply is recorded and later replies may omit its nodes
+	req = &TrieRequest{Id: &fast.TrieID{Root: root}, Key: key}
+	if err := req.Validate(nil, &Msg{MsgType: MsgProofsV2, Obj: nodes, Known: s}); err != nil {
+		t.Fatalf("valid proof rejected: %v", err)
+	}
+	if len(s.order) != len(nodes) {
+		t.Fatalf("nodes of the valid reply not recorded: have %d, want %d", len(s.order), len(nodes))
+	}
+	req = &TrieRequest{Id: &fast.TrieID{Root: root}, Key: key}
+	if err := req.Validate(nil, &Msg{MsgType: MsgProofsV2, Obj: public.NodeList{}, Known: s}); err != nil {
+		t.Fatalf("proof with the known nodes omitted rejected: %v", err)
+	}
+}
@@ -18,6 +18,8 @@ package les
 
 import (
 	"context"
+	"errors"
+	"sync"
 	"truechain/discovery/core/snailchain"
 	"truechain/discovery/light/fast"
 	"truechain/discovery/light/public"
@@ -26,6 +28,7 @@ import (
 	"truechain/discovery/etruedb"
 	"truechain/discovery/light"
 	"truechain/discovery/log"
+	"truechain/discovery/params"
 )
 
 // LesOdr implements light.OdrBackend
@@ -35,9 +38,21 @@ type LesOdr struct {
 	chtIndexer                       *snailchain.ChainIndexer
 	bloomTrieIndexer, bloomIndexer   *core.ChainIndexer
 	retriever                        *retrieveManager
+	decoys                           *decoyPool     // nil if no decoys are bundled with proof requests
+	privacy                          *privacyRouter // nil if the privacy mode is disabled
+	cache                            *odrCache      // nil if the ODR cache is disabled
+	batcher                          *trieBatcher   // nil if the trie requests aren't aggregated
+	chainConfig                      *params.ChainConfig
 	stop                             chan struct{}
+
+	lock     sync.RWMutex   // protects closed against retrievals starting during Stop
+	closed   bool           // whether Stop was called, no retrievals are started anymore
+	inflight sync.WaitGroup // retrievals in progress, including the storing of their results
 }
 
+// errOdrStopped is returned by the retrievals started after Stop.
+var errOdrStopped = errors.New("client is shutting down")
+
 func NewLesOdr(db etruedb.Database, config *public.IndexerConfig, retriever *retrieveManager) *LesOdr {
 	return &LesOdr{
 		db:                db,
@@ -48,9 +63,33 @@ func NewLesOdr(db etruedb.Database, config *public.IndexerConfig, retriever *ret
 	}
 }
 
-// Stop cancels all pending retrievals
+// Stop cancels all pending retrievals and waits until the ones in progress have
+// returned, so that no result is written into the database after Stop.
 func (odr *LesOdr) Stop() {
+	odr.lock.Lock()
+	odr.closed = true
 	close(odr.stop)
+	odr.lock.Unlock()
+
+	odr.inflight.Wait()
+}
+
+// enter registers a retrieval in progress, returning false if the ODR backend
+// is stopped. Every successful enter has to be followed by a leave.
+func (odr *LesOdr) enter() bool {
+	odr.lock.RLock()
+	defer odr.lock.RUnlock()
+
+	if odr.closed {
+		return false
+	}
+	odr.inflight.Add(1)
+	return true
+}
+
+// leave marks a retrieval as finished.
+func (odr *LesOdr) leave() {
+	odr.inflight.Done()
 }
 
 // Database returns the backing database
@@ -99,6 +138,8 @@ const (
 	MsgProofsV2
 	MsgHelperTrieProofs
 	MsgTxStatus
+	MsgBlockFilters
+	MsgExtension
 )
 
 // Msg encodes a LES message that delivers reply data for a request
@@ -106,21 +147,36 @@ type Msg struct {
 	MsgType int
 	ReqID   uint64
 	Obj     interface{}
+	Config  *params.ChainConfig // Selects the fork specific encoding of the reply data
+	Known   *nodeSession        // Trie nodes the server may have omitted from a proof reply
+}
+
+// validate checks a reply to the request, decoding the chain objects in it
+// according to the forks active at their block numbers.
+func (odr *LesOdr) validate(lreq LesOdrRequest, msg *Msg) error {
+	msg.Config = odr.chainConfig
+	return lreq.Validate(odr.db, msg)
 }
 
 // Retrieve tries to fetch an object from the LES network.
 // If the network retrieval was successful, it stores the object in local db.
 func (odr *LesOdr) Retrieve(ctx context.Context, req light.OdrRequest) (err error) {
+	if !odr.enter() {
+		return errOdrStopped
+	}
+	defer odr.leave()
+
 	lreq := LesRequest(req)
 
 	reqID := genReqID()
 	rq := &distReq{
+		priority: requestPriority(ctx),
 		getCost: func(dp distPeer) uint64 {
 			return lreq.GetCost(dp.(*peer))
 		},
 		canSend: func(dp distPeer) bool {
 			p := dp.(*peer)
-			if !p.onlyAnnounce {
+			if !p.onlyAnnounce && p.servesData() {
 				return lreq.CanSend(p)
 			}
 			return false
@@ -133,7 +189,7 @@ func (odr *LesOdr) Retrieve(ctx context.Context, req light.OdrRequest) (err erro
 		},
 	}
 
-	if err = odr.retriever.retrieve(ctx, reqID, rq, func(p distPeer, msg *Msg) error { return lreq.Validate(odr.db, msg) }, odr.stop); err == nil {
+	if err = odr.retriever.retrieve(ctx, reqID, rq, func(p distPeer, msg *Msg) error { return odr.validate(lreq, msg) }, odr.stop); err == nil {
 		// retrieved from network, store in db
 		req.StoreResult(odr.db)
 	} else {
@@ -145,33 +201,133 @@ func (odr *LesOdr) Retrieve(ctx context.Context, req light.OdrRequest) (err erro
 // FastRetrieve tries to fetch an object from the LES network.
 // If the network retrieval was successful, it stores the object in local db.
 func (odr *LesOdr) FastRetrieve(ctx context.Context, req fast.OdrRequest) (err error) {
+	if !odr.enter() {
+		return errOdrStopped
+	}
+	defer odr.leave()
+
+	if odr.cache.serve(req) {
+		req.StoreResult(odr.db)
+		return nil
+	}
+	// Single trie entries are aggregated, unless the requests of different
+	// accounts shouldn't be seen together by the servers or every request gets
+	// its own random decoys
+	if r, ok := req.(*fast.TrieRequest); ok && odr.batcher != nil && odr.privacy == nil && odr.decoys == nil && r.Decoys == nil {
+		if err = odr.batcher.retrieve(ctx, r); err == nil {
+			odr.cache.store(req)
+		}
+		return
+	}
+	return odr.retrieveFast(ctx, req)
+}
+
+// retrieveFast fetches an object from the LES network and stores it in the
+// local db.
+func (odr *LesOdr) retrieveFast(ctx context.Context, req fast.OdrRequest) (err error) {
+	odr.decoys.bundle(req)
 	lreq := LesRequest(req)
+	subject, avoid := odr.privacyAvoid(req, lreq)
 
 	reqID := genReqID()
 	rq := &distReq{
+		priority: requestPriority(ctx),
 		getCost: func(dp distPeer) uint64 {
 			return lreq.GetCost(dp.(*peer))
 		},
 		canSend: func(dp distPeer) bool {
 			p := dp.(*peer)
-			if !p.onlyAnnounce {
+			if _, ok := avoid[p.id]; ok {
+				return false
+			}
+			if !p.onlyAnnounce && p.servesData() {
 				return lreq.CanSend(p)
 			}
 			return false
 		},
 		request: func(dp distPeer) func() {
 			p := dp.(*peer)
+			if subject != nil {
+				odr.privacy.served(subject, p.id)
+			}
 			cost := lreq.GetCost(p)
 			p.fcServer.QueuedRequest(reqID, cost)
 			return func() { lreq.Request(reqID, p) }
 		},
 	}
 
-	if err = odr.retriever.retrieve(ctx, reqID, rq, func(p distPeer, msg *Msg) error { return lreq.Validate(odr.db, msg) }, odr.stop); err == nil {
+	if err = odr.retriever.retrieve(ctx, reqID, rq, func(p distPeer, msg *Msg) error { return odr.validate(lreq, msg) }, odr.stop); err == nil {
 		// retrieved from network, store in db
 		req.StoreResult(odr.db)
+		odr.cache.store(req)
+		odr.decoys.collect(req)
 	} else {
 		log.Debug("Failed to retrieve fast data from network", "err", err)
 	}
 	return
 }
+
+// privacyAvoid returns the account a request is about and the servers to avoid
+// for it if the privacy mode is enabled.
+func (odr *LesOdr) privacyAvoid(req fast.OdrRequest, lreq LesOdrRequest) ([]byte, map[string]struct{}) {
+	if odr.privacy == nil {
+		return nil, nil
+	}
+	subject := requestSubject(req)
+	if subject == nil {
+		return nil, nil
+	}
+	var suitable []*peer
+	for _, p := range odr.retriever.peers.AllPeers() {
+		if !p.onlyAnnounce && lreq.CanSend(p) {
+			suitable = append(suitable, p)
+		}
+	}
+	return subject, odr.privacy.avoid(subject, suitable)
+}
+
+// retrieveFrom sends an ODR request to the given server only and waits for a
+// valid answer. The result is not stored in the database. If the server sent an
+// invalid answer, the validation error is returned.
+func (odr *LesOdr) retrieveFrom(ctx context.Context, lreq LesOdrRequest, target *peer) error {
+	if !odr.enter() {
+		return errOdrStopped
+	}
+	defer odr.leave()
+
+	reqID := genReqID()
+	rq := &distReq{
+		priority: requestPriority(ctx),
+		getCost: func(dp distPeer) uint64 {
+			return lreq.GetCost(dp.(*peer))
+		},
+		canSend: func(dp distPeer) bool {
+			return dp.(*peer) == target
+		},
+		request: func(dp distPeer) func() {
+			p := dp.(*peer)
+			cost := lreq.GetCost(p)
+			p.fcServer.QueuedRequest(reqID, cost)
+			return func() { lreq.Request(reqID, p) }
+		},
+	}
+	invalid := make(chan error, 1)
+	validate := func(p distPeer, msg *Msg) error {
+		err := odr.validate(lreq, msg)
+		if err != nil {
+			select {
+			case invalid <- err:
+			default:
+			}
+		}
+		return err
+	}
+	err := odr.retriever.retrieve(ctx, reqID, rq, validate, odr.stop)
+	if err != nil {
+		select {
+		case err = <-invalid:
+		default:
+		}
+	}
+	return err
+}
@@ -20,6 +20,7 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"math/rand"
 	"truechain/discovery/light/fast"
 	"truechain/discovery/light/public"
 
@@ -43,9 +44,11 @@ var (
 	errReceiptHashMismatch = errors.New("receipt hash mismatch")
 	errDataHashMismatch    = errors.New("data hash mismatch")
 	errCHTHashMismatch     = errors.New("cht hash mismatch")
+	errCommitteeMismatch   = errors.New("committee hash mismatch")
 	errCHTNumberMismatch   = errors.New("cht number mismatch")
 	errDatasetMismatch     = errors.New("dataset mismatch")
 	errUselessNodes        = errors.New("useless nodes in merkle proof nodeset")
+	errUnknownSchema       = errors.New("no encoding schema active at block")
 )
 
 type LesOdrRequest interface {
@@ -59,8 +62,14 @@ func LesRequest(req light.OdrRequest) LesOdrRequest {
 	switch r := req.(type) {
 	case *light.BlockRequest:
 		return (*BlockRequest)(r)
+	case *light.FruitRequest:
+		return (*FruitRequest)(r)
+	case *light.FruitHeadersRequest:
+		return (*FruitHeadersRequest)(r)
 	case *fast.BlockRequest:
 		return (*FastBlockRequest)(r)
+	case *fast.CommitteeRequest:
+		return (*CommitteeRequest)(r)
 	case *fast.ReceiptsRequest:
 		return (*ReceiptsRequest)(r)
 	case *fast.TrieRequest:
@@ -73,6 +82,10 @@ func LesRequest(req light.OdrRequest) LesOdrRequest {
 		return (*BloomRequest)(r)
 	case *fast.TxStatusRequest:
 		return (*TxStatusRequest)(r)
+	case *fast.BlockFiltersRequest:
+		return (*BlockFiltersRequest)(r)
+	case ExtensionRequest:
+		return extensionRequest{r}
 	default:
 		return nil
 	}
@@ -109,6 +122,9 @@ func (r *BlockRequest) Validate(db etruedb.Database, msg *Msg) error {
 		return errInvalidMessageType
 	}
 	bodies := msg.Obj.(snailBlockBodiesData)
+	if bodies.Type != public.Fruit || len(bodies.Fruits) != 1 {
+		return errInvalidEntryCount
+	}
 	body := bodies.Fruits[0]
 
 	// FastRetrieve our stored header and validate block content against it
@@ -123,6 +139,13 @@ func (r *BlockRequest) Validate(db etruedb.Database, msg *Msg) error {
 	if header.FruitsHash != types.DeriveSha(types.FruitsHeaders(headers)) {
 		return errTxHashMismatch
 	}
+	// The fruit headers commit to the committee signatures of the fruits, so a
+	// server can't replace them without the headers mismatching
+	for _, fruit := range body.Fruit {
+		if fruit.Header().SignHash != types.CalcSignHash(fruit.Signs()) {
+			return errTxHashMismatch
+		}
+	}
 	// Validations passed, encode and store RLP
 	data, err := rlp.EncodeToBytes(&types.SnailBody{Fruits: body.Fruit})
 	if err != nil {
@@ -132,8 +155,56 @@ func (r *BlockRequest) Validate(db etruedb.Database, msg *Msg) error {
 	return nil
 }
 
-// BlockRequest is the ODR request type for block bodies
-type FruitRequest light.BlockRequest
+// FruitHeadersRequest is the ODR request type for the fruit headers of a snail block
+type FruitHeadersRequest light.FruitHeadersRequest
+
+// GetCost returns the cost of the given ODR request according to the serving
+// peer's cost table (implementation of LesOdrRequest)
+func (r *FruitHeadersRequest) GetCost(peer *peer) uint64 {
+	return peer.GetRequestCost(GetSnailBlockBodiesMsg, 1)
+}
+
+// CanSend tells if a certain peer is suitable for serving the given request
+func (r *FruitHeadersRequest) CanSend(peer *peer) bool {
+	return peer.HasBlock(r.Hash, r.Number)
+}
+
+// Request sends an ODR request to the LES network (implementation of LesOdrRequest)
+func (r *FruitHeadersRequest) Request(reqID uint64, peer *peer) error {
+	peer.Log().Debug("Requesting fruit headers", "hash", r.Hash)
+	return peer.RequestSnailBodies(reqID, r.GetCost(peer), getBlockBodiesData{[]common.Hash{r.Hash}, public.FruitHead})
+}
+
+// Valid processes an ODR request reply message from the LES network
+// returns true and stores results in memory if the message was a valid reply
+// to the request (implementation of LesOdrRequest)
+func (r *FruitHeadersRequest) Validate(db etruedb.Database, msg *Msg) error {
+	log.Debug("Validating fruit headers", "hash", r.Hash)
+
+	// Ensure we have a correct message with the fruit headers of a single block
+	if msg.MsgType != MsgSnailBlockBodies {
+		return errInvalidMessageType
+	}
+	bodies := msg.Obj.(snailBlockBodiesData)
+	if bodies.Type != public.FruitHead || len(bodies.FruitHeads) != 1 {
+		return errInvalidEntryCount
+	}
+	headers := bodies.FruitHeads[0].FruitHead
+
+	// The fruits hash of the block commits to the fruit headers
+	header := snailDB.ReadHeader(db, r.Hash, r.Number)
+	if header == nil {
+		return errHeaderUnavailable
+	}
+	if header.FruitsHash != types.DeriveSha(types.FruitsHeaders(headers)) {
+		return errTxHashMismatch
+	}
+	r.Headers = headers
+	return nil
+}
+
+// FruitRequest is the ODR request type for fruit bodies
+type FruitRequest light.FruitRequest
 
 // GetCost returns the cost of the given ODR request according to the serving
 // peer's cost table (implementation of LesOdrRequest)
@@ -168,8 +239,11 @@ func (r *FruitRequest) Validate(db etruedb.Database, msg *Msg) error {
 	}
 	body := bodies[0]
 
-	// FastRetrieve our stored header and validate block content against it
-	header := snailDB.ReadHeader(db, r.Hash, r.Number)
+	// Validate the body against the given fruit header or the stored one
+	header := r.Header
+	if header == nil {
+		header = snailDB.ReadHeader(db, r.Hash, r.Number)
+	}
 	if header == nil {
 		return errHeaderUnavailable
 	}
@@ -215,12 +289,14 @@ func (r *FastBlockRequest) Validate(db etruedb.Database, msg *Msg) error {
 	if msg.MsgType != MsgBlockBodies {
 		return errInvalidMessageType
 	}
-	bodies := msg.Obj.([]*types.Body)
+	bodies := msg.Obj.([]rlp.RawValue)
 	if len(bodies) != 1 {
 		return errInvalidEntryCount
 	}
-	body := bodies[0]
-
+	body, err := decodeBody(msg.Config, r.Number, bodies[0])
+	if err != nil {
+		return err
+	}
 	// FastRetrieve our stored header and validate block content against it
 	header := rawdb.ReadHeader(db, r.Hash, r.Number)
 	if header == nil {
@@ -229,12 +305,60 @@ func (r *FastBlockRequest) Validate(db etruedb.Database, msg *Msg) error {
 	if header.TxHash != types.DeriveSha(types.Transactions(body.Transactions)) {
 		return errTxHashMismatch
 	}
-	// Validations passed, encode and store RLP
-	data, err := rlp.EncodeToBytes(body)
+	// Validations passed, store the RLP as received so that the encoding of
+	// the transactions is preserved
+	r.Rlp = common.CopyBytes(bodies[0])
+	return nil
+}
+
+// CommitteeRequest is the ODR request type for the committee switch infos of a
+// fast block, retrieved with the block body
+type CommitteeRequest fast.CommitteeRequest
+
+// GetCost returns the cost of the given ODR request according to the serving
+// peer's cost table (implementation of LesOdrRequest)
+func (r *CommitteeRequest) GetCost(peer *peer) uint64 {
+	return peer.GetRequestCost(GetFastBlockBodiesMsg, 1)
+}
+
+// CanSend tells if a certain peer is suitable for serving the given request
+func (r *CommitteeRequest) CanSend(peer *peer) bool {
+	return peer.HasFastBlock(r.Hash, r.Number, false)
+}
+
+// Request sends an ODR request to the LES network (implementation of LesOdrRequest)
+func (r *CommitteeRequest) Request(reqID uint64, peer *peer) error {
+	peer.Log().Debug("Requesting committee infos", "hash", r.Hash)
+	return peer.RequestBodies(reqID, r.GetCost(peer), []common.Hash{r.Hash})
+}
+
+// Valid processes an ODR request reply message from the LES network
+// returns true and stores results in memory if the message was a valid reply
+// to the request (implementation of LesOdrRequest)
+func (r *CommitteeRequest) Validate(db etruedb.Database, msg *Msg) error {
+	log.Debug("Validating committee infos", "hash", r.Hash)
+
+	// Ensure we have a correct message with a single block body
+	if msg.MsgType != MsgBlockBodies {
+		return errInvalidMessageType
+	}
+	bodies := msg.Obj.([]rlp.RawValue)
+	if len(bodies) != 1 {
+		return errInvalidEntryCount
+	}
+	body, err := decodeBody(msg.Config, r.Number, bodies[0])
 	if err != nil {
 		return err
 	}
-	r.Rlp = data
+	// The switch infos are committed to by the committee hash of the header
+	header := rawdb.ReadHeader(db, r.Hash, r.Number)
+	if header == nil {
+		return errHeaderUnavailable
+	}
+	if header.CommitteeHash != types.RlpHash(body.Infos) {
+		return errCommitteeMismatch
+	}
+	r.Infos = body.Infos
 	return nil
 }
 
@@ -268,11 +392,14 @@ func (r *ReceiptsRequest) Validate(db etruedb.Database, msg *Msg) error {
 	if msg.MsgType != MsgReceipts {
 		return errInvalidMessageType
 	}
-	receipts := msg.Obj.([]types.Receipts)
+	receipts := msg.Obj.([]rlp.RawValue)
 	if len(receipts) != 1 {
 		return errInvalidEntryCount
 	}
-	receipt := receipts[0]
+	receipt, err := decodeReceipts(msg.Config, r.Number, receipts[0])
+	if err != nil {
+		return err
+	}
 
 	// FastRetrieve our stored header and validate receipt content against it
 	if r.Header == nil {
@@ -293,6 +420,7 @@ type ProofReq struct {
 	BHash       common.Hash
 	AccKey, Key []byte
 	FromLevel   uint
+	Flags       []uint `rlp:"tail"` // optional, only sent if a node session was negotiated
 }
 
 // ODR request type for state/storage trie entries, see LesOdrRequest interface
@@ -301,7 +429,7 @@ type TrieRequest fast.TrieRequest
 // GetCost returns the cost of the given ODR request according to the serving
 // peer's cost table (implementation of LesOdrRequest)
 func (r *TrieRequest) GetCost(peer *peer) uint64 {
-	return peer.GetRequestCost(GetProofsV2Msg, 1)
+	return peer.GetRequestCost(GetProofsV2Msg, 1+len(r.Decoys))
 }
 
 // CanSend tells if a certain peer is suitable for serving the given request
@@ -311,13 +439,23 @@ func (r *TrieRequest) CanSend(peer *peer) bool {
 
 // Request sends an ODR request to the LES network (implementation of LesOdrRequest)
 func (r *TrieRequest) Request(reqID uint64, peer *peer) error {
-	peer.Log().Debug("Requesting trie proof", "root", r.Id.Root, "key", r.Key)
-	req := ProofReq{
-		BHash:  r.Id.BlockHash,
-		AccKey: r.Id.AccKey,
-		Key:    r.Key,
+	peer.Log().Debug("Requesting trie proof", "root", r.Id.Root, "key", r.Key, "decoys", len(r.Decoys))
+	var flags []uint
+	if peer.recvNodes != nil {
+		flags = []uint{proofOmitKnown}
+	}
+	reqs := make([]ProofReq, 0, 1+len(r.Decoys))
+	for _, key := range append([][]byte{r.Key}, r.Decoys...) {
+		reqs = append(reqs, ProofReq{
+			BHash:  r.Id.BlockHash,
+			AccKey: r.Id.AccKey,
+			Key:    key,
+			Flags:  flags,
+		})
 	}
-	return peer.RequestProofs(reqID, r.GetCost(peer), []ProofReq{req})
+	// Shuffle the keys so the position doesn't tell the real one
+	rand.Shuffle(len(reqs), func(i, j int) { reqs[i], reqs[j] = reqs[j], reqs[i] })
+	return peer.RequestProofs(reqID, r.GetCost(peer), reqs)
 }
 
 // Valid processes an ODR request reply message from the LES network
@@ -330,17 +468,36 @@ func (r *TrieRequest) Validate(db etruedb.Database, msg *Msg) error {
 		return errInvalidMessageType
 	}
 	proofs := msg.Obj.(public.NodeList)
-	// Verify the proof and store if checks out
+	// Verify the proof and store if checks out. Nodes sent more than once are
+	// only counted, nodes omitted by the server are taken from the session.
 	nodeSet := proofs.NodeSet()
-	reads := &readTraceDB{db: nodeSet}
-	if _, _, err := trie.VerifyProof(r.Id.Root, r.Key, reads); err != nil {
-		return fmt.Errorf("merkle proof verification failed: %v", err)
+	if dups := len(proofs) - nodeSet.KeyCount(); dups > 0 {
+		proofDuplicateMeter.Mark(int64(dups))
+	}
+	var (
+		proof = public.NewNodeSet()
+		reads = &readTraceDB{db: &proofTraceDB{db: &sessionReader{reply: nodeSet, known: msg.Known}, proof: proof}}
+	)
+	for _, key := range append([][]byte{r.Key}, r.Decoys...) {
+		if _, _, err := trie.VerifyProof(r.Id.Root, key, reads); err != nil {
+			return fmt.Errorf("merkle proof verification failed: %v", err)
+		}
 	}
-	// check if all nodes have been read by VerifyProof
-	if len(reads.reads) != nodeSet.KeyCount() {
-		return errUselessNodes
+	// check if all nodes of the reply have been read by VerifyProof
+	for _, node := range nodeSet.NodeList() {
+		if _, ok := reads.reads[string(crypto.Keccak256(node))]; !ok {
+			return errUselessNodes
+		}
 	}
-	r.Proof = nodeSet
+	if omitted := proof.KeyCount() - nodeSet.KeyCount(); omitted > 0 {
+		proofOmittedMeter.Mark(int64(omitted))
+	}
+	// The server added the nodes of the reply to its session when sending it,
+	// the client only trusts them once the proof is verified
+	if msg.Known != nil {
+		msg.Known.record(proofs)
+	}
+	r.Proof = proof
 	return nil
 }
 
@@ -477,8 +634,8 @@ func (r *ChtRequest) Validate(db etruedb.Database, msg *Msg) error {
 	if len(headerEnc) == 0 {
 		return errHeaderUnavailable
 	}
-	header := new(types.SnailHeader)
-	if err := rlp.DecodeBytes(headerEnc, header); err != nil {
+	header, err := decodeSnailHeader(msg.Config, r.BlockNum, headerEnc)
+	if err != nil {
 		return errHeaderUnavailable
 	}
 
@@ -616,6 +773,9 @@ func (r *TxStatusRequest) GetCost(peer *peer) uint64 {
 
 // CanSend tells if a certain peer is suitable for serving the given request
 func (r *TxStatusRequest) CanSend(peer *peer) bool {
+	if len(r.Hashes) > 1 && !peer.caps.has(capTxStatusBatch) {
+		return false
+	}
 	return peer.version >= lpv2
 }
 
@@ -643,6 +803,52 @@ func (r *TxStatusRequest) Validate(db etruedb.Database, msg *Msg) error {
 	return nil
 }
 
+// BlockFiltersRequest is the ODR request type for compact block filters
+type BlockFiltersRequest fast.BlockFiltersRequest
+
+// GetCost returns the cost of the given ODR request according to the serving
+// peer's cost table (implementation of LesOdrRequest)
+func (r *BlockFiltersRequest) GetCost(peer *peer) uint64 {
+	return peer.GetRequestCost(GetBlockFiltersMsg, len(r.Hashes))
+}
+
+// CanSend tells if a certain peer is suitable for serving the given request
+func (r *BlockFiltersRequest) CanSend(peer *peer) bool {
+	if !peer.serveBlockFilters || len(r.Hashes) == 0 {
+		return false
+	}
+	return peer.HasFastBlock(r.Hashes[len(r.Hashes)-1], r.LastNumber, false)
+}
+
+// Request sends an ODR request to the LES network (implementation of LesOdrRequest)
+func (r *BlockFiltersRequest) Request(reqID uint64, peer *peer) error {
+	peer.Log().Debug("Requesting block filters", "count", len(r.Hashes))
+	return peer.RequestBlockFilters(reqID, r.GetCost(peer), r.Hashes)
+}
+
+// Valid processes an ODR request reply message from the LES network
+// returns true and stores results in memory if the message was a valid reply
+// to the request (implementation of LesOdrRequest)
+func (r *BlockFiltersRequest) Validate(db etruedb.Database, msg *Msg) error {
+	log.Debug("Validating block filters", "count", len(r.Hashes))
+
+	// Ensure we have a correct message with a filter for every block
+	if msg.MsgType != MsgBlockFilters {
+		return errInvalidMessageType
+	}
+	filters := msg.Obj.([][]byte)
+	if len(filters) != len(r.Hashes) {
+		return errInvalidEntryCount
+	}
+	for _, filter := range filters {
+		if err := checkBlockFilter(filter); err != nil {
+			return err
+		}
+	}
+	r.Filters = filters
+	return nil
+}
+
 // readTraceDB stores the keys of database reads. We use this to check that received node
 // sets contain only the trie nodes necessary to make proofs pass.
 type readTraceDB struct {
@@ -650,6 +856,28 @@ type readTraceDB struct {
 	reads map[string]struct{}
 }
 
+// sessionReader reads the trie nodes of a proof reply, falling back to the nodes
+// received earlier in the session which the server omitted.
+type sessionReader struct {
+	reply *public.NodeSet
+	known *nodeSession // nil if no nodes could be omitted
+}
+
+// Get returns a node of the reply or of the session.
+func (db *sessionReader) Get(key []byte) ([]byte, error) {
+	value, err := db.reply.Get(key)
+	if err != nil && db.known != nil {
+		return db.known.Get(key)
+	}
+	return value, err
+}
+
+// Has returns true if the reply or the session contains the given node.
+func (db *sessionReader) Has(key []byte) (bool, error) {
+	_, err := db.Get(key)
+	return err == nil, nil
+}
+
 // Get returns a stored node
 func (db *readTraceDB) Get(k []byte) ([]byte, error) {
 	if db.reads == nil {
@@ -0,0 +1,178 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"truechain/discovery/common"
+	"truechain/discovery/light/fast"
+	"truechain/discovery/light/public"
+)
+
+// trieBatchWindow is the time the trie requests of the same trie are collected
+// for before they are sent in a single proof request.
+const trieBatchWindow = 2 * time.Millisecond
+
+// trieBatchKey identifies the trie of a request.
+type trieBatchKey struct {
+	blockHash, root common.Hash
+	accKey          string
+}
+
+// trieBatch is a proof request collecting the keys of the requests of a trie.
+type trieBatch struct {
+	key   trieBatchKey
+	id    *fast.TrieID
+	keys  [][]byte
+	seen  map[string]struct{}
+	timer *time.Timer
+
+	priority reqPriority // most urgent priority class of the requests joined
+
+	ctx     context.Context // cancelled when every request of the batch left
+	cancel  func()
+	waiters int // requests waiting for the proofs, guarded by the batcher lock
+
+	done  chan struct{} // closed when the proofs are retrieved
+	proof *public.NodeSet
+	err   error
+}
+
+// trieBatcher aggregates the trie requests issued concurrently, typically by
+// parallel state accesses, into proof requests of up to MaxProofsFetch keys,
+// saving a round trip per request. The proof of the batch is handed to every
+// request of the batch.
+type trieBatcher struct {
+	odr     *LesOdr
+	window  time.Duration
+	lock    sync.Mutex
+	batches map[trieBatchKey]*trieBatch
+}
+
+// newTrieBatcher creates a trie request aggregator for the ODR backend.
+func newTrieBatcher(odr *LesOdr, window time.Duration) *trieBatcher {
+	return &trieBatcher{
+		odr:     odr,
+		window:  window,
+		batches: make(map[trieBatchKey]*trieBatch),
+	}
+}
+
+// retrieve adds the request to the open batch of its trie and waits for the
+// proofs of the batch.
+func (b *trieBatcher) retrieve(ctx context.Context, req *fast.TrieRequest) error {
+	batch := b.join(req, requestPriority(ctx))
+	select {
+	case <-batch.done:
+	case <-ctx.Done():
+		b.leave(batch)
+		return ctx.Err()
+	}
+	if batch.err != nil {
+		return batch.err
+	}
+	req.Proof = batch.proof
+	return nil
+}
+
+// join adds the key of a request to the open batch of its trie, opening a new
+// batch if there is none or the open one is full. The batch is sent with the
+// most urgent priority class of its requests.
+func (b *trieBatcher) join(req *fast.TrieRequest, priority reqPriority) *trieBatch {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	key := trieBatchKey{blockHash: req.Id.BlockHash, root: req.Id.Root, accKey: string(req.Id.AccKey)}
+	batch := b.batches[key]
+	if batch == nil {
+		batch = &trieBatch{
+			key:      key,
+			id:       req.Id,
+			seen:     make(map[string]struct{}),
+			done:     make(chan struct{}),
+			priority: priority,
+		}
+		batch.ctx, batch.cancel = context.WithCancel(context.Background())
+		b.batches[key] = batch
+		batch.timer = time.AfterFunc(b.window, func() { b.flush(batch) })
+	}
+	if priority < batch.priority {
+		batch.priority = priority
+	}
+	batch.waiters++
+	if _, ok := batch.seen[string(req.Key)]; !ok {
+		batch.seen[string(req.Key)] = struct{}{}
+		batch.keys = append(batch.keys, req.Key)
+	}
+	// A full batch is closed right away, the requests joining after it open a
+	// new one. If its timer has already fired, the flush is on its way.
+	if len(batch.keys) >= MaxProofsFetch {
+		delete(b.batches, key)
+		if batch.timer.Stop() {
+			go b.flush(batch)
+		}
+	}
+	return batch
+}
+
+// leave removes a request which stopped waiting from its batch. The retrieval
+// of a batch is cancelled when its last request leaves, and an open batch is
+// closed so that no new request joins the cancelled one.
+func (b *trieBatcher) leave(batch *trieBatch) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if batch.waiters--; batch.waiters > 0 {
+		return
+	}
+	if b.batches[batch.key] == batch {
+		delete(b.batches, batch.key)
+	}
+	batch.cancel()
+}
+
+// flush closes a batch and retrieves its proofs.
+func (b *trieBatcher) flush(batch *trieBatch) {
+	b.lock.Lock()
+	if b.batches[batch.key] == batch {
+		delete(b.batches, batch.key)
+	}
+	priority := batch.priority
+	b.lock.Unlock()
+
+	defer close(batch.done)
+	defer batch.cancel()
+	if batch.err = batch.ctx.Err(); batch.err != nil {
+		return
+	}
+	if !b.odr.enter() {
+		batch.err = errOdrStopped
+		return
+	}
+	defer b.odr.leave()
+
+	req := &fast.TrieRequest{Id: batch.id, Key: batch.keys[0]}
+	if len(batch.keys) > 1 {
+		req.Decoys = batch.keys[1:]
+	}
+	if batch.err = b.odr.retrieveFast(withRequestPriority(batch.ctx, priority), req); batch.err == nil {
+		batch.proof = req.Proof
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"truechain/discovery/common"
+	"truechain/discovery/light/fast"
+)
+
+// Tests that the requests joining a trie batch concurrently never push it past
+// the number of proofs a server accepts in a single request.
+func TestTrieBatchLimit(t *testing.T) {
+	// The ODR backend is stopped, so flushed batches finish without retrieving
+	b := newTrieBatcher(&LesOdr{closed: true}, time.Hour)
+	id := &fast.TrieID{BlockHash: common.Hash{1}, Root: common.Hash{2}}
+
+	var (
+		joins   = MaxProofsFetch*8 + 3
+		wg      sync.WaitGroup
+		lock    sync.Mutex
+		batches = make(map[*trieBatch]struct{})
+		start   = make(chan struct{})
+	)
+	for i := 0; i < joins; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			batch := b.join(&fast.TrieRequest{Id: id, Key: []byte(fmt.Sprintf("key-%d", i))}, priorityInteractive)
+			lock.Lock()
+			batches[batch] = struct{}{}
+			lock.Unlock()
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	total := 0
+	for batch := range batches {
+		if len(batch.keys) > MaxProofsFetch {
+			t.Errorf("batch has %d keys, more than %d", len(batch.keys), MaxProofsFetch)
+		}
+		total += len(batch.keys)
+	}
+	if total != joins {
+		t.Errorf("batched key count mismatch: have %d, want %d", total, joins)
+	}
+	if want := joins/MaxProofsFetch + 1; len(batches) != want {
+		t.Errorf("batch count mismatch: have %d, want %d", len(batches), want)
+	}
+}
+
+// Tests that a full trie batch is closed before the next request joins, even
+// when all of them are issued in a row.
+func TestTrieBatchClosedWhenFull(t *testing.T) {
+	b := newTrieBatcher(&LesOdr{closed: true}, time.Hour)
+	id := &fast.TrieID{BlockHash: common.Hash{1}, Root: common.Hash{2}}
+
+	var first *trieBatch
+	for i := 0; i <= MaxProofsFetch; i++ {
+		batch := b.join(&fast.TrieRequest{Id: id, Key: []byte(fmt.Sprintf("key-%d", i))}, priorityInteractive)
+		switch {
+		case i == 0:
+			first = batch
+		case i < MaxProofsFetch && batch != first:
+			t.Fatalf("request %d opened a new batch before the first one was full", i)
+		case i == MaxProofsFetch && batch == first:
+			t.Fatalf("request %d joined the full batch", i)
+		}
+	}
+	<-first.done
+	if len(first.keys) != MaxProofsFetch {
+		t.Errorf("full batch has %d keys, want %d", len(first.keys), MaxProofsFetch)
+	}
+}
+
+// Tests that the retrieval of a trie batch is cancelled once every request of
+// it stopped waiting, and that later requests don't join the cancelled batch.
+func TestTrieBatchCancelledWhenAbandoned(t *testing.T) {
+	b := newTrieBatcher(&LesOdr{closed: true}, time.Hour)
+	id := &fast.TrieID{BlockHash: common.Hash{1}, Root: common.Hash{2}}
+
+	var (
+		errs    = make(chan error, 2)
+		cancels []func()
+	)
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancels = append(cancels, cancel)
+		go func(i int) {
+			errs <- b.retrieve(ctx, &fast.TrieRequest{Id: id, Key: []byte(fmt.Sprintf("key-%d", i))})
+		}(i)
+	}
+	// Wait for both requests to join the batch
+	var batch *trieBatch
+	for start := time.Now(); ; time.Sleep(time.Millisecond) {
+		b.lock.Lock()
+		for _, open := range b.batches {
+			if open.waiters == 2 {
+				batch = open
+			}
+		}
+		b.lock.Unlock()
+		if batch != nil {
+			break
+		}
+		if time.Since(start) > time.Second {
+			t.Fatal("requests didn't join the batch")
+		}
+	}
+	defer batch.timer.Stop()
+
+	cancels[0]()
+	if err := <-errs; err != context.Canceled {
+		t.Fatalf("cancelled request error mismatch: have %v, want %v", err, context.Canceled)
+	}
+	if batch.ctx.Err() != nil {
+		t.Fatal("batch cancelled while a request is waiting")
+	}
+	cancels[1]()
+	<-errs
+	if batch.ctx.Err() == nil {
+		t.Fatal("abandoned batch not cancelled")
+	}
+	if next := b.join(&fast.TrieRequest{Id: id, Key: []byte("key-2")}, priorityInteractive); next == batch {
+		t.Error("request joined the abandoned batch")
+	} else {
+		next.timer.Stop()
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"errors"
+	"math"
+	"sync"
+
+	"github.com/hashicorp/golang-lru/simplelru"
+	"truechain/discovery/common"
+	"truechain/discovery/core/types"
+	"truechain/discovery/crypto"
+	"truechain/discovery/light/fast"
+	"truechain/discovery/light/public"
+	"truechain/discovery/trie"
+)
+
+var errNotCached = errors.New("not cached")
+
+// receiptsKey distinguishes the receipts of a block from the trie nodes and
+// code stored in the cache under their own hash.
+type receiptsKey common.Hash
+
+// odrCache is a size bounded LRU cache of the trie nodes, contract code and
+// receipts retrieved from the servers. The retrieved data is also written to
+// the database, but it may be pruned from there, while the cache keeps the data
+// accessed repeatedly (e.g. by calls to the same contract) in memory.
+//
+// A nil cache is valid and caches nothing.
+type odrCache struct {
+	lock  sync.Mutex
+	lru   *simplelru.LRU
+	size  int // bytes of the cached items
+	limit int
+}
+
+// newOdrCache creates an ODR cache of the given size in megabytes, returning nil
+// if the size is zero.
+func newOdrCache(sizeMB int) *odrCache {
+	if sizeMB <= 0 {
+		return nil
+	}
+	c := &odrCache{limit: sizeMB * 1024 * 1024}
+	// The number of items is only bounded by their total size
+	c.lru, _ = simplelru.NewLRU(math.MaxInt32, func(key, value interface{}) {
+		c.size -= itemSize(value)
+	})
+	return c
+}
+
+// itemSize returns the approximate memory used by a cached item.
+func itemSize(value interface{}) int {
+	switch v := value.(type) {
+	case []byte:
+		return common.HashLength + len(v)
+	case types.Receipts:
+		size := common.HashLength
+		for _, r := range v {
+			size += int(r.Size())
+		}
+		return size
+	}
+	return 0
+}
+
+// add inserts an item into the cache, evicting the least recently used ones if
+// the size limit is exceeded.
+func (c *odrCache) add(key, value interface{}) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.lru.Contains(key) {
+		return
+	}
+	c.lru.Add(key, value)
+	c.size += itemSize(value)
+	for c.size > c.limit {
+		c.lru.RemoveOldest()
+	}
+}
+
+// get retrieves an item from the cache.
+func (c *odrCache) get(key interface{}) (interface{}, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.lru.Get(key)
+}
+
+// Get returns a cached trie node, implementing trie.DatabaseReader.
+func (c *odrCache) Get(key []byte) ([]byte, error) {
+	if value, ok := c.get(common.BytesToHash(key)); ok {
+		if node, ok := value.([]byte); ok {
+			return node, nil
+		}
+	}
+	return nil, errNotCached
+}
+
+// Has returns true if the given trie node is cached, implementing
+// trie.DatabaseReader.
+func (c *odrCache) Has(key []byte) (bool, error) {
+	_, err := c.Get(key)
+	return err == nil, nil
+}
+
+// store adds the result of a successful retrieval to the cache.
+func (c *odrCache) store(req fast.OdrRequest) {
+	if c == nil {
+		return
+	}
+	switch r := req.(type) {
+	case *fast.TrieRequest:
+		for _, node := range r.Proof.NodeList() {
+			c.add(common.BytesToHash(crypto.Keccak256(node)), []byte(node))
+		}
+	case *fast.CodeRequest:
+		c.add(r.Hash, r.Data)
+	case *fast.ReceiptsRequest:
+		if !r.Untrusted {
+			c.add(receiptsKey(r.Hash), r.Receipts)
+		}
+	}
+}
+
+// serve tries to answer a request from the cache, filling in its result and
+// returning true if it could.
+func (c *odrCache) serve(req fast.OdrRequest) bool {
+	if c == nil {
+		return false
+	}
+	switch r := req.(type) {
+	case *fast.TrieRequest:
+		// The whole path of the key has to be cached, collect it into a proof
+		proof := public.NewNodeSet()
+		if _, _, err := trie.VerifyProof(r.Id.Root, r.Key, &proofTraceDB{db: c, proof: proof}); err != nil {
+			break
+		}
+		r.Proof = proof
+		odrCacheHitMeter.Mark(1)
+		return true
+	case *fast.CodeRequest:
+		if value, ok := c.get(r.Hash); ok {
+			r.Data = value.([]byte)
+			odrCacheHitMeter.Mark(1)
+			return true
+		}
+	case *fast.ReceiptsRequest:
+		if value, ok := c.get(receiptsKey(r.Hash)); ok {
+			r.Receipts = value.(types.Receipts)
+			odrCacheHitMeter.Mark(1)
+			return true
+		}
+	default:
+		return false
+	}
+	odrCacheMissMeter.Mark(1)
+	return false
+}
+
+// proofTraceDB collects the trie nodes read from a database into a proof.
+type proofTraceDB struct {
+	db    trie.DatabaseReader
+	proof *public.NodeSet
+}
+
+// Get returns a stored node, adding it to the proof.
+func (db *proofTraceDB) Get(key []byte) ([]byte, error) {
+	value, err := db.db.Get(key)
+	if err == nil {
+		db.proof.Put(key, value)
+	}
+	return value, err
+}
+
+// Has returns true if the database contains the given node.
+func (db *proofTraceDB) Has(key []byte) (bool, error) {
+	_, err := db.Get(key)
+	return err == nil, nil
+}
@@ -0,0 +1,118 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"context"
+	"errors"
+
+	"truechain/discovery/common"
+	"truechain/discovery/common/hexutil"
+	"truechain/discovery/core/types"
+	"truechain/discovery/light"
+)
+
+var errPairingMismatch = errors.New("fruit doesn't reference the canonical fast block")
+
+// PublicPairingAPI maps the fast blocks to the snail blocks sealing them
+// through their fruits, and back.
+type PublicPairingAPI struct {
+	client *LightEtrue
+}
+
+// NewPublicPairingAPI creates a new fast and snail block pairing API.
+func NewPublicPairingAPI(client *LightEtrue) *PublicPairingAPI {
+	return &PublicPairingAPI{client: client}
+}
+
+// BlockPairing is a snail block and the range of fast blocks sealed by its
+// fruits. The fruits are verified against the fruits hash of the snail header
+// and the fast blocks at both ends of the range against the canonical chain.
+type BlockPairing struct {
+	SnailNumber hexutil.Uint64 `json:"snailNumber"`
+	SnailHash   common.Hash    `json:"snailHash"`
+	FirstFast   hexutil.Uint64 `json:"firstFastNumber"`
+	LastFast    hexutil.Uint64 `json:"lastFastNumber"`
+}
+
+// SnailToFast returns the range of fast blocks sealed by a snail block, nil if
+// the snail block is unknown.
+func (api *PublicPairingAPI) SnailToFast(ctx context.Context, snailNumber hexutil.Uint64) (*BlockPairing, error) {
+	if uint64(snailNumber) > api.client.blockchain.CurrentHeader().Number.Uint64() {
+		return nil, nil
+	}
+	return api.client.pairing(ctx, uint64(snailNumber))
+}
+
+// FastToSnail returns the snail block sealing a fast block, nil if the fast
+// block isn't sealed yet.
+func (api *PublicPairingAPI) FastToSnail(ctx context.Context, fastNumber hexutil.Uint64) (*BlockPairing, error) {
+	number := uint64(fastNumber)
+	if number == 0 {
+		return api.client.pairing(ctx, 0)
+	}
+	// The fruits of consecutive snail blocks seal consecutive fast ranges
+	lo, hi := uint64(1), api.client.blockchain.CurrentHeader().Number.Uint64()
+	for lo <= hi {
+		mid := lo + (hi-lo)/2
+		p, err := api.client.pairing(ctx, mid)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case number < uint64(p.FirstFast):
+			hi = mid - 1
+		case number > uint64(p.LastFast):
+			lo = mid + 1
+		default:
+			return p, nil
+		}
+	}
+	return nil, nil
+}
+
+// pairing returns the range of fast blocks sealed by a canonical snail block,
+// checking that the fruits at both ends reference canonical fast blocks.
+func (s *LightEtrue) pairing(ctx context.Context, snailNumber uint64) (*BlockPairing, error) {
+	hash, err := light.GetCanonicalHash(ctx, s.odr, snailNumber)
+	if err != nil {
+		return nil, err
+	}
+	p := &BlockPairing{SnailNumber: hexutil.Uint64(snailNumber), SnailHash: hash}
+	if snailNumber == 0 {
+		return p, nil // the genesis blocks pair with each other
+	}
+	fruits, err := light.GetFruitHeaders(ctx, s.odr, hash, snailNumber)
+	if err != nil {
+		return nil, err
+	}
+	if len(fruits) == 0 {
+		return nil, errPairingMismatch
+	}
+	first, last := fruits[0], fruits[len(fruits)-1]
+	for _, fruit := range []*types.SnailHeader{first, last} {
+		header, err := s.fblockchain.GetHeaderByNumberOdr(ctx, fruit.FastNumber.Uint64())
+		if err != nil {
+			return nil, err
+		}
+		if header == nil || header.Hash() != fruit.FastHash {
+			return nil, errPairingMismatch
+		}
+	}
+	p.FirstFast, p.LastFast = hexutil.Uint64(first.FastNumber.Uint64()), hexutil.Uint64(last.FastNumber.Uint64())
+	return p, nil
+}
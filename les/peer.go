@@ -78,8 +78,15 @@ type peer struct {
 	*p2p.Peer
 	rw p2p.MsgReadWriter
 
-	version int    // Protocol version negotiated
-	network uint64 // Network ID being on
+	version int           // Protocol version negotiated
+	network uint64        // Network ID being on
+	caps    capabilitySet // Optional protocol features supported by both sides
+	local   []string      // Capabilities announced in the handshake
+	clock   mclock.Clock  // Clock of the flow control estimates of a server
+
+	nodeSessionSize int          // Configured number of session nodes, see sessionLimit
+	sentNodes       *nodeSession // Trie nodes sent in proof replies, nil without capNodeDedup
+	recvNodes       *nodeSession // Trie nodes received in proof replies, nil without capNodeDedup
 
 	announceType uint64
 
@@ -87,6 +94,11 @@ type peer struct {
 	checkpoint       params.TrustedCheckpoint
 	checkpointNumber uint64
 
+	// Chain status sent in the handshake, nil if the peer didn't send it
+	forkID            *forkID
+	snailForkID       *forkID
+	trustedCheckpoint *checkpointStatus
+
 	id string
 
 	headInfo *announceData
@@ -105,20 +117,27 @@ type peer struct {
 	hasBlock       func(common.Hash, uint64) bool
 	hasFastBlock   func(common.Hash, uint64, bool) bool
 	responseErrors int
+	metrics        *peerMetrics // nil if metrics are disabled or the peer is a client
 	updateCounter  uint64
 	updateTime     mclock.AbsTime
-	frozen         uint32 // 1 if client is in frozen state
+	frozen         uint32         // 1 if client is in frozen state
+	drainUntil     mclock.AbsTime // time until the server announced to be draining
 
 	fcClient       *flowcontrol.ClientNode // nil if the peer is server only
 	fcServer       *flowcontrol.ServerNode // nil if the peer is client only
 	fcParams       flowcontrol.ServerParams
+	freeCapacity   uint64 // free capacity announced by the server in the handshake
+	totalCapacity  uint64 // total capacity announced by the server, 0 if not announced
 	fcCosts        requestCostTable
 	balanceTracker *balanceTracker // set by clientPool.connect, used and removed by ProtocolManager.handle
 
 	trusted                 bool
+	onion                   bool     // connected through a Tor onion service
+	role                    peerRole // restricts what the server is used for (client side)
 	onlyAnnounce            bool
 	chainSince, chainRecent uint64
 	stateSince, stateRecent uint64
+	serveBlockFilters       bool
 }
 
 func newPeer(version int, network uint64, trusted bool, p *p2p.Peer, rw p2p.MsgReadWriter) *peer {
@@ -128,7 +147,10 @@ func newPeer(version int, network uint64, trusted bool, p *p2p.Peer, rw p2p.MsgR
 		version: version,
 		network: network,
 		id:      peerIdToString(p.ID()),
+		local:   localCapabilities,
+		clock:   mclock.System{},
 		trusted: trusted,
+		onion:   p.Node().Onion() != "",
 		errCh:   make(chan error, 1),
 	}
 }
@@ -225,8 +247,30 @@ func (p *peer) isFrozen() bool {
 	return atomic.LoadUint32(&p.frozen) != 0
 }
 
+// updateDraining processes the draining flag of a server announcement. It
+// returns the announced draining duration if the flag was present.
+func (p *peer) updateDraining(update keyValueMap) (time.Duration, bool) {
+	var secs uint64
+	if update.get("serverDraining", &secs) != nil {
+		return 0, false
+	}
+	d := time.Duration(secs) * time.Second
+	p.lock.Lock()
+	p.drainUntil = mclock.Now() + mclock.AbsTime(d)
+	p.lock.Unlock()
+	return d, true
+}
+
+// isDraining returns true if the server has announced that it is going under
+// maintenance and no new requests should be sent to it
+func (p *peer) isDraining() bool {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.drainUntil > mclock.Now()
+}
+
 func (p *peer) canQueue() bool {
-	return p.sendQueue.canQueue() && !p.isFrozen()
+	return p.sendQueue.canQueue() && !p.isFrozen() && !p.isDraining()
 }
 
 func (p *peer) queueSend(f func()) {
@@ -398,11 +442,17 @@ func (p *peer) SendAnnounce(request announceData) error {
 
 // SendStop notifies the client about being in frozen state
 func (p *peer) SendStop() error {
+	if !p.caps.has(capFlowStop) {
+		return nil
+	}
 	return p2p.Send(p.rw, StopMsg, struct{}{})
 }
 
 // SendResume notifies the client about getting out of frozen state
 func (p *peer) SendResume(bv uint64) error {
+	if !p.caps.has(capFlowStop) {
+		return nil
+	}
 	return p2p.Send(p.rw, ResumeMsg, bv)
 }
 
@@ -455,6 +505,9 @@ func (p *peer) ReplyReceiptsRLP(reqID uint64, receipts []rlp.RawValue) *reply {
 
 // ReplyProofsV2 creates a reply with a batch of merkle proofs, corresponding to the ones requested.
 func (p *peer) ReplyProofsV2(reqID uint64, proofs public.NodeList) *reply {
+	if p.caps.has(capCompactWitness) {
+		proofs = compactWitness(proofs)
+	}
 	data, _ := rlp.EncodeToBytes(proofs)
 	return &reply{p.rw, ProofsV2Msg, reqID, data}
 }
@@ -471,6 +524,18 @@ func (p *peer) ReplyTxStatus(reqID uint64, stats []fast.TxStatus) *reply {
 	return &reply{p.rw, TxStatusMsg, reqID, data}
 }
 
+// ReplyBlockFilters creates a reply with a batch of compact block filters.
+func (p *peer) ReplyBlockFilters(reqID uint64, filters [][]byte) *reply {
+	data, _ := rlp.EncodeToBytes(filters)
+	return &reply{p.rw, BlockFiltersMsg, reqID, data}
+}
+
+// ReplyExtension creates a reply to a request of a protocol extension.
+func (p *peer) ReplyExtension(reqID uint64, data []byte) *reply {
+	enc, _ := rlp.EncodeToBytes(data)
+	return &reply{p.rw, ExtensionMsg, reqID, enc}
+}
+
 // RequestHeadersByHash fetches a batch of blocks' headers corresponding to the
 // specified header query, based on the hash of an origin block.
 func (p *peer) RequestHeadersByHash(reqID, cost uint64, origin common.Hash, amount int, skip int, reverse bool, fast bool, fruit bool) error {
@@ -545,6 +610,22 @@ func (p *peer) RequestTxStatus(reqID, cost uint64, txHashes []common.Hash) error
 	return sendRequest(p.rw, GetTxStatusMsg, reqID, cost, txHashes)
 }
 
+// RequestBlockFilters fetches a batch of compact block filters from a remote node.
+func (p *peer) RequestBlockFilters(reqID, cost uint64, hashes []common.Hash) error {
+	p.Log().Debug("Requesting block filters", "count", len(hashes))
+	return sendRequest(p.rw, GetBlockFiltersMsg, reqID, cost, hashes)
+}
+
+// RequestExtension sends a request of a protocol extension to a remote node.
+func (p *peer) RequestExtension(reqID, cost uint64, name string, code uint64, data []byte) error {
+	type extReq struct {
+		Extension string
+		Code      uint64
+		Data      []byte
+	}
+	return sendRequest(p.rw, GetExtensionMsg, reqID, cost, extReq{name, code, data})
+}
+
 // SendTxStatus creates a reply with a batch of transactions to be added to the remote transaction pool.
 func (p *peer) SendTxs(reqID, cost uint64, txs rlp.RawValue) error {
 	p.Log().Debug("Sending batch of transactions", "size", len(txs))
@@ -622,7 +703,7 @@ func (p *peer) sendReceiveHandshake(sendList keyValueList) (keyValueList, error)
 
 // Handshake executes the les protocol handshake, negotiating version number,
 // network IDs, difficulties, head and genesis blocks.
-func (p *peer) Handshake(td *big.Int, head common.Hash, headNum uint64, genesis common.Hash, fastHead common.Hash, fastHeight *big.Int, server *LesServer) error {
+func (p *peer) Handshake(td *big.Int, head common.Hash, headNum uint64, genesis common.Hash, fastHead common.Hash, fastHeight *big.Int, status *chainStatus, server *LesServer) error {
 	p.lock.Lock()
 	defer p.lock.Unlock()
 
@@ -635,6 +716,15 @@ func (p *peer) Handshake(td *big.Int, head common.Hash, headNum uint64, genesis
 	send = send.add("genesisHash", genesis)
 	send = send.add("fastHeadHash", fastHead)
 	send = send.add("fastHeadNum", fastHeight)
+	send = send.add("forkID", status.ForkID)
+	send = send.add("snailForkID", status.SnailForkID)
+	if status.Checkpoint != nil {
+		send = send.add("checkpoint/trusted", status.Checkpoint)
+	}
+	if p.version >= lpv3 {
+		send = send.add("capabilities", p.local)
+		send = send.add("nodeSessionSize", sessionLimit(p.nodeSessionSize))
+	}
 	if server != nil {
 		if !server.onlyAnnounce {
 			send = send.add("serveHeaders", nil)
@@ -649,6 +739,9 @@ func (p *peer) Handshake(td *big.Int, head common.Hash, headNum uint64, genesis
 			}
 			send = send.add("serveRecentState", stateRecent)
 			send = send.add("txRelay", nil)
+			if server.blockFilters {
+				send = send.add("serveBlockFilters", nil)
+			}
 		}
 		send = send.add("flowControl/BL", server.defParams.BufLimit)
 		send = send.add("flowControl/MRR", server.defParams.MinRecharge)
@@ -659,6 +752,11 @@ func (p *peer) Handshake(td *big.Int, head common.Hash, headNum uint64, genesis
 			costList = testCostList(server.testCost)
 		}
 		send = send.add("flowControl/MRC", costList)
+		if server.clientPool != nil {
+			free, total := server.clientPool.capacity()
+			send = send.add("capacity/free", free)
+			send = send.add("capacity/total", total)
+		}
 		p.fcCosts = costList.decode(ProtocolLengths[uint(p.version)])
 		p.fcParams = server.defParams
 
@@ -717,14 +815,47 @@ func (p *peer) Handshake(td *big.Int, head common.Hash, headNum uint64, genesis
 	}
 
 	if rGenesis != genesis {
+		handshakeGenesisMeter.Mark(1)
 		return errResp(ErrGenesisBlockMismatch, "%x (!= %x)", rGenesis[:8], genesis[:8])
 	}
 	if rNetwork != p.network {
+		handshakeNetworkMeter.Mark(1)
 		return errResp(ErrNetworkIdMismatch, "%d (!= %d)", rNetwork, p.network)
 	}
 	if int(rVersion) != p.version {
+		handshakeVersionMeter.Mark(1)
 		return errResp(ErrProtocolVersionMismatch, "%d (!= %d)", rVersion, p.version)
 	}
+	// Missing if the peer is of an older version
+	var rForkID, rSnailForkID forkID
+	if recv.get("forkID", &rForkID) == nil {
+		p.forkID = &rForkID
+	}
+	if recv.get("snailForkID", &rSnailForkID) == nil {
+		p.snailForkID = &rSnailForkID
+	}
+	var rCheckpoint checkpointStatus
+	if recv.get("checkpoint/trusted", &rCheckpoint) == nil {
+		p.trustedCheckpoint = &rCheckpoint
+	}
+	if p.version >= lpv3 {
+		var remote []string
+		recv.get("capabilities", &remote) // missing if the peer supports none
+		p.caps = negotiateCapabilities(p.local, remote)
+	} else {
+		p.caps = negotiateCapabilities(p.local, lpv2Capabilities)
+	}
+	if p.caps.has(capNodeDedup) {
+		// Peers announcing no size remember the default number of nodes
+		limit, remote := sessionLimit(p.nodeSessionSize), uint64(sessionNodeLimit)
+		recv.get("nodeSessionSize", &remote)
+		if remote < limit {
+			limit = remote
+		}
+		if limit > 0 {
+			p.sentNodes, p.recvNodes = newNodeSession(false, int(limit)), newNodeSession(true, int(limit))
+		}
+	}
 
 	if server != nil {
 		// until we have a proper peer connectivity API, allow LES connection to other servers
@@ -753,6 +884,7 @@ func (p *peer) Handshake(td *big.Int, head common.Hash, headNum uint64, genesis
 		if recv.get("txRelay", nil) != nil {
 			p.onlyAnnounce = true
 		}
+		p.serveBlockFilters = recv.get("serveBlockFilters", nil) == nil
 
 		if p.onlyAnnounce && !p.trusted {
 			return errResp(ErrUselessPeer, "peer cannot serve requests")
@@ -770,9 +902,12 @@ func (p *peer) Handshake(td *big.Int, head common.Hash, headNum uint64, genesis
 			return err
 		}
 		p.fcParams = sParams
-		p.fcServer = flowcontrol.NewServerNode(sParams, &mclock.System{})
+		p.fcServer = flowcontrol.NewServerNode(sParams, p.clock)
 		p.fcCosts = MRC.decode(ProtocolLengths[uint(p.version)])
 
+		recv.get("capacity/free", &p.freeCapacity) // missing if not announced
+		recv.get("capacity/total", &p.totalCapacity)
+
 		recv.get("checkpoint/value", &p.checkpoint)
 		recv.get("checkpoint/registerHeight", &p.checkpointNumber)
 
@@ -831,29 +966,62 @@ type peerSetNotify interface {
 }
 
 // peerSet represents the collection of active peers currently participating in
-// the Light Truechain sub-protocol.
+// the Light Truechain sub-protocol. The set is copy-on-write: the registered
+// peers are kept in an immutable snapshot replaced on every change, so the
+// frequent lookups of the announcement handling, the request distribution and
+// the RPC stats never wait for each other nor for a peer being registered.
 type peerSet struct {
-	peers      map[string]*peer
-	lock       sync.RWMutex
+	snapshot atomic.Value // *peerSnapshot, replaced under lock
+
+	lock       sync.Mutex // serializes the changes of the set
 	notifyList []peerSetNotify
 	closed     bool
 }
 
+// peerSnapshot is an immutable state of the peer set.
+type peerSnapshot struct {
+	peers map[string]*peer
+	list  []*peer
+}
+
 // newPeerSet creates a new peer set to track the active participants.
 func newPeerSet() *peerSet {
-	return &peerSet{
-		peers: make(map[string]*peer),
+	ps := &peerSet{}
+	ps.snapshot.Store(&peerSnapshot{peers: make(map[string]*peer)})
+	return ps
+}
+
+// current returns the current snapshot of the set.
+func (ps *peerSet) current() *peerSnapshot {
+	return ps.snapshot.Load().(*peerSnapshot)
+}
+
+// update replaces the snapshot by a copy with the given peer added or, if p is
+// nil, with the peer of the given id removed. The lock is held by the caller.
+func (ps *peerSet) update(id string, p *peer) {
+	old := ps.current()
+	next := &peerSnapshot{
+		peers: make(map[string]*peer, len(old.peers)+1),
+		list:  make([]*peer, 0, len(old.list)+1),
 	}
+	for pid, peer := range old.peers {
+		if pid != id {
+			next.peers[pid] = peer
+			next.list = append(next.list, peer)
+		}
+	}
+	if p != nil {
+		next.peers[id] = p
+		next.list = append(next.list, p)
+	}
+	ps.snapshot.Store(next)
 }
 
 // notify adds a service to be notified about added or removed peers
 func (ps *peerSet) notify(n peerSetNotify) {
 	ps.lock.Lock()
 	ps.notifyList = append(ps.notifyList, n)
-	peers := make([]*peer, 0, len(ps.peers))
-	for _, p := range ps.peers {
-		peers = append(peers, p)
-	}
+	peers := ps.current().list
 	ps.lock.Unlock()
 
 	for _, p := range peers {
@@ -869,12 +1037,12 @@ func (ps *peerSet) Register(p *peer) error {
 		ps.lock.Unlock()
 		return errClosed
 	}
-	if _, ok := ps.peers[p.id]; ok {
+	if _, ok := ps.current().peers[p.id]; ok {
 		ps.lock.Unlock()
 		return errAlreadyRegistered
 	}
-	ps.peers[p.id] = p
 	p.sendQueue = newExecQueue(100)
+	ps.update(p.id, p)
 	peers := make([]peerSetNotify, len(ps.notifyList))
 	copy(peers, ps.notifyList)
 	ps.lock.Unlock()
@@ -889,11 +1057,11 @@ func (ps *peerSet) Register(p *peer) error {
 // actions to/from that particular entity. It also initiates disconnection at the networking layer.
 func (ps *peerSet) Unregister(id string) error {
 	ps.lock.Lock()
-	if p, ok := ps.peers[id]; !ok {
+	if p, ok := ps.current().peers[id]; !ok {
 		ps.lock.Unlock()
 		return errNotRegistered
 	} else {
-		delete(ps.peers, id)
+		ps.update(id, nil)
 		peers := make([]peerSetNotify, len(ps.notifyList))
 		copy(peers, ps.notifyList)
 		ps.lock.Unlock()
@@ -911,44 +1079,35 @@ func (ps *peerSet) Unregister(id string) error {
 
 // AllPeerIDs returns a list of all registered peer IDs
 func (ps *peerSet) AllPeerIDs() []string {
-	ps.lock.RLock()
-	defer ps.lock.RUnlock()
+	list := ps.current().list
 
-	res := make([]string, len(ps.peers))
-	idx := 0
-	for id := range ps.peers {
-		res[idx] = id
-		idx++
+	res := make([]string, len(list))
+	for i, p := range list {
+		res[i] = p.id
 	}
 	return res
 }
 
 // Peer retrieves the registered peer with the given id.
 func (ps *peerSet) Peer(id string) *peer {
-	ps.lock.RLock()
-	defer ps.lock.RUnlock()
-
-	return ps.peers[id]
+	return ps.current().peers[id]
 }
 
 // Len returns if the current number of peers in the set.
 func (ps *peerSet) Len() int {
-	ps.lock.RLock()
-	defer ps.lock.RUnlock()
-
-	return len(ps.peers)
+	return len(ps.current().list)
 }
 
 // BestPeer retrieves the known peer with the currently highest total difficulty.
 func (ps *peerSet) BestPeer() *peer {
-	ps.lock.RLock()
-	defer ps.lock.RUnlock()
-
 	var (
 		bestPeer *peer
 		bestTd   *big.Int
 	)
-	for _, p := range ps.peers {
+	for _, p := range ps.current().list {
+		if !p.servesData() {
+			continue
+		}
 		if td := p.Td(); bestPeer == nil || td.Cmp(bestTd) > 0 {
 			bestPeer, bestTd = p, td
 		}
@@ -958,16 +1117,8 @@ func (ps *peerSet) BestPeer() *peer {
 
 // AllPeers returns all peers in a list
 func (ps *peerSet) AllPeers() []*peer {
-	ps.lock.RLock()
-	defer ps.lock.RUnlock()
-
-	list := make([]*peer, len(ps.peers))
-	i := 0
-	for _, peer := range ps.peers {
-		list[i] = peer
-		i++
-	}
-	return list
+	list := ps.current().list
+	return append(make([]*peer, 0, len(list)), list...)
 }
 
 // Close disconnects all peers.
@@ -976,7 +1127,7 @@ func (ps *peerSet) Close() {
 	ps.lock.Lock()
 	defer ps.lock.Unlock()
 
-	for _, p := range ps.peers {
+	for _, p := range ps.current().list {
 		p.Disconnect(p2p.DiscQuitting)
 	}
 	ps.closed = true
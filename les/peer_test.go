@@ -0,0 +1,155 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+const (
+	benchPeers       = 50  // number of peers registered in the benchmarked sets
+	benchParallelism = 128 // goroutines per CPU doing retrievals concurrently
+)
+
+// benchPeerSet is the part of a peer set exercised by the benchmarks.
+type benchPeerSet interface {
+	Peer(id string) *peer
+	AllPeers() []*peer
+	add(p *peer)
+	remove(id string)
+}
+
+// lockedPeerSet is the peer set as it was before becoming copy-on-write, every
+// lookup holds the read lock of the shared map. It is the benchmark baseline.
+type lockedPeerSet struct {
+	peers map[string]*peer
+	lock  sync.RWMutex
+}
+
+func (ps *lockedPeerSet) Peer(id string) *peer {
+	ps.lock.RLock()
+	defer ps.lock.RUnlock()
+
+	return ps.peers[id]
+}
+
+func (ps *lockedPeerSet) AllPeers() []*peer {
+	ps.lock.RLock()
+	defer ps.lock.RUnlock()
+
+	list := make([]*peer, len(ps.peers))
+	i := 0
+	for _, peer := range ps.peers {
+		list[i] = peer
+		i++
+	}
+	return list
+}
+
+func (ps *lockedPeerSet) add(p *peer) {
+	ps.lock.Lock()
+	ps.peers[p.id] = p
+	ps.lock.Unlock()
+}
+
+func (ps *lockedPeerSet) remove(id string) {
+	ps.lock.Lock()
+	delete(ps.peers, id)
+	ps.lock.Unlock()
+}
+
+// snapshotPeerSet changes the current peer set the way Register and Unregister
+// do, without the send queue and the networking layer of a live peer.
+type snapshotPeerSet struct {
+	*peerSet
+}
+
+func (ps snapshotPeerSet) add(p *peer) {
+	ps.lock.Lock()
+	ps.update(p.id, p)
+	ps.lock.Unlock()
+}
+
+func (ps snapshotPeerSet) remove(id string) {
+	ps.lock.Lock()
+	ps.update(id, nil)
+	ps.lock.Unlock()
+}
+
+func BenchmarkPeerSetLookupLocked(b *testing.B) {
+	benchmarkPeerSet(b, &lockedPeerSet{peers: make(map[string]*peer)}, false)
+}
+
+func BenchmarkPeerSetLookupSnapshot(b *testing.B) {
+	benchmarkPeerSet(b, snapshotPeerSet{newPeerSet()}, false)
+}
+
+func BenchmarkPeerSetChurnLocked(b *testing.B) {
+	benchmarkPeerSet(b, &lockedPeerSet{peers: make(map[string]*peer)}, true)
+}
+
+func BenchmarkPeerSetChurnSnapshot(b *testing.B) {
+	benchmarkPeerSet(b, snapshotPeerSet{newPeerSet()}, true)
+}
+
+// benchmarkPeerSet measures the retrievals done by many concurrent goroutines,
+// mostly single peer lookups and every eighth one a listing of all the peers.
+// If churn is set, a peer is registered and removed repeatedly meanwhile.
+func benchmarkPeerSet(b *testing.B, ps benchPeerSet, churn bool) {
+	ids := make([]string, benchPeers)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("peer-%d", i)
+		ps.add(&peer{id: ids[i]})
+	}
+	quit, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		if !churn {
+			return
+		}
+		p := &peer{id: "churn"}
+		for {
+			select {
+			case <-quit:
+				return
+			default:
+				ps.add(p)
+				ps.remove(p.id)
+			}
+		}
+	}()
+	b.SetParallelism(benchParallelism)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for i := 0; pb.Next(); i++ {
+			if i%8 == 0 {
+				if len(ps.AllPeers()) < benchPeers {
+					b.Error("registered peers missing from the list")
+				}
+				continue
+			}
+			if ps.Peer(ids[i%benchPeers]) == nil {
+				b.Error("registered peer not found")
+			}
+		}
+	})
+	b.StopTimer()
+	close(quit)
+	<-done
+}
@@ -0,0 +1,135 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"fmt"
+	"sync"
+
+	"truechain/discovery/metrics"
+)
+
+// msgNames are the names of the message codes in the metric names.
+var msgNames = map[uint64]string{
+	StatusMsg:               "status",
+	AnnounceMsg:             "announce",
+	GetFastBlockHeadersMsg:  "getFastHeaders",
+	FastBlockHeadersMsg:     "fastHeaders",
+	GetFastBlockBodiesMsg:   "getFastBodies",
+	FastBlockBodiesMsg:      "fastBodies",
+	GetSnailBlockHeadersMsg: "getSnailHeaders",
+	SnailBlockHeadersMsg:    "snailHeaders",
+	GetSnailBlockBodiesMsg:  "getSnailBodies",
+	SnailBlockBodiesMsg:     "snailBodies",
+	GetFruitBodiesMsg:       "getFruitBodies",
+	FruitBodiesMsg:          "fruitBodies",
+	GetReceiptsMsg:          "getReceipts",
+	ReceiptsMsg:             "receipts",
+	GetCodeMsg:              "getCode",
+	CodeMsg:                 "code",
+	GetProofsV2Msg:          "getProofs",
+	ProofsV2Msg:             "proofs",
+	GetHelperTrieProofsMsg:  "getHelperTrieProofs",
+	HelperTrieProofsMsg:     "helperTrieProofs",
+	SendTxV2Msg:             "sendTx",
+	GetTxStatusMsg:          "getTxStatus",
+	TxStatusMsg:             "txStatus",
+	StopMsg:                 "stop",
+	ResumeMsg:               "resume",
+	GetBlockFiltersMsg:      "getBlockFilters",
+	BlockFiltersMsg:         "blockFilters",
+	GetExtensionMsg:         "getExtension",
+	ExtensionMsg:            "extension",
+}
+
+// msgName returns the name of a message code in the metric names.
+func msgName(code uint64) string {
+	if name, ok := msgNames[code]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown%d", code)
+}
+
+// peerMetrics records the messages exchanged with a server per message type,
+// the timed out requests and the invalid replies. Every metric is registered
+// twice: in total under les/client/msg/ and for the server under
+// les/client/peer/<id>/. The metrics of the server are unregistered when it
+// disconnects, so that the registry doesn't grow with the servers seen.
+type peerMetrics struct {
+	prefix string
+
+	lock   sync.Mutex
+	meters map[string]metrics.Meter // metrics of the server by name, nil once closed
+}
+
+// newPeerMetrics creates the metrics of a server.
+func newPeerMetrics(id string) *peerMetrics {
+	return &peerMetrics{
+		prefix: fmt.Sprintf("les/client/peer/%s/", id),
+		meters: make(map[string]metrics.Meter),
+	}
+}
+
+// mark marks the total and the server meter of the given name.
+func (m *peerMetrics) mark(name string, n int64) {
+	metrics.GetOrRegisterMeter("les/client/msg/"+name, nil).Mark(n)
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.meters == nil {
+		return // disconnected, don't register again
+	}
+	meter, ok := m.meters[name]
+	if !ok {
+		meter = metrics.GetOrRegisterMeter(m.prefix+name, nil)
+		m.meters[name] = meter
+	}
+	meter.Mark(n)
+}
+
+// message records a message received from or sent to the server.
+func (m *peerMetrics) message(code uint64, in bool, size uint32) {
+	dir := "out"
+	if in {
+		dir = "in"
+	}
+	name := msgName(code)
+	m.mark(name+"/"+dir+"/packets", 1)
+	m.mark(name+"/"+dir+"/traffic", int64(size))
+}
+
+// timeout records a request to the server which timed out.
+func (m *peerMetrics) timeout() {
+	m.mark("timeouts", 1)
+}
+
+// invalid records a reply of the server which was rejected.
+func (m *peerMetrics) invalid(code uint64) {
+	m.mark(msgName(code)+"/invalid", 1)
+}
+
+// close unregisters the metrics of the server, keeping the totals.
+func (m *peerMetrics) close() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for name := range m.meters {
+		metrics.DefaultRegistry.Unregister(m.prefix + name)
+	}
+	m.meters = nil
+}
@@ -0,0 +1,88 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"context"
+
+	"truechain/discovery/light"
+	"truechain/discovery/light/fast"
+)
+
+// reqPriority is the priority class of a request sent by the distributor. The
+// classes share the servers by weighted fair queuing, so that the requests of
+// API calls aren't stalled behind the synchronisation or background traffic,
+// while the latter still progress.
+type reqPriority int
+
+const (
+	priorityInteractive reqPriority = iota // requests of API calls, the default
+	prioritySync                           // header synchronisation and fetching
+	priorityBackground                     // indexers, hot state and log indexing
+
+	priorityClasses = 3
+)
+
+// priorityWeights are the shares of the requests sent of each class while all
+// of them have queued requests.
+var priorityWeights = [priorityClasses]float64{8, 4, 1}
+
+var priorityNames = [priorityClasses]string{"interactive", "sync", "background"}
+
+func (p reqPriority) String() string {
+	if p < 0 || p >= priorityClasses {
+		return "unknown"
+	}
+	return priorityNames[p]
+}
+
+// priorityKey is the context key of the priority class of the requests
+// retrieved on behalf of a context.
+type priorityKey struct{}
+
+// withRequestPriority returns a context whose requests are sent with the given
+// priority class.
+func withRequestPriority(ctx context.Context, priority reqPriority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, priority)
+}
+
+// requestPriority returns the priority class of the requests retrieved on
+// behalf of a context, interactive by default.
+func requestPriority(ctx context.Context) reqPriority {
+	if p, ok := ctx.Value(priorityKey{}).(reqPriority); ok {
+		return p
+	}
+	return priorityInteractive
+}
+
+// priorityOdr is an ODR backend retrieving all requests with a given priority
+// class, handed to the components not passing a context of their own, e.g. the
+// chain indexers.
+type priorityOdr struct {
+	*LesOdr
+	priority reqPriority
+}
+
+// Retrieve retrieves a snail chain request with the priority of the backend.
+func (odr priorityOdr) Retrieve(ctx context.Context, req light.OdrRequest) error {
+	return odr.LesOdr.Retrieve(withRequestPriority(ctx, odr.priority), req)
+}
+
+// FastRetrieve retrieves a fast chain request with the priority of the backend.
+func (odr priorityOdr) FastRetrieve(ctx context.Context, req fast.OdrRequest) error {
+	return odr.LesOdr.FastRetrieve(withRequestPriority(ctx, odr.priority), req)
+}
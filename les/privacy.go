@@ -0,0 +1,105 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"sync"
+
+	"github.com/hashicorp/golang-lru"
+	"truechain/discovery/light/fast"
+)
+
+// privacySubjectLimit is the number of accounts whose servers are remembered.
+const privacySubjectLimit = 4096
+
+// privacyRouter implements the privacy mode of the light client. Requests
+// about the same account (proofs and code, across any number of blocks) are
+// spread over the connected servers: a server which already served a request
+// about an account is avoided for the next ones until every suitable server
+// has been used, so no single server can follow an account over time. The
+// history survives reconnections, so a server is not trusted again just
+// because it opened a new session.
+//
+// The price is latency: requests can't always go to the fastest server with
+// the most buffer, and with few connected servers the rotation quickly wraps
+// around, giving weaker protection. More servers (--lightpeers) improve both.
+type privacyRouter struct {
+	lock sync.Mutex
+	used *lru.Cache // account key -> map[string]struct{} of servers already used
+}
+
+// newPrivacyRouter creates a privacy router. It returns nil if the privacy
+// mode is disabled.
+func newPrivacyRouter(enabled bool) *privacyRouter {
+	if !enabled {
+		return nil
+	}
+	used, _ := lru.New(privacySubjectLimit)
+	return &privacyRouter{used: used}
+}
+
+// requestSubject returns the account a request is about, or nil if the request
+// doesn't relate to an account.
+func requestSubject(req fast.OdrRequest) []byte {
+	switch r := req.(type) {
+	case *fast.TrieRequest:
+		if r.Id.AccKey != nil {
+			return r.Id.AccKey
+		}
+		return r.Key
+	case *fast.CodeRequest:
+		return r.Id.AccKey
+	}
+	return nil
+}
+
+// avoid returns the servers which should not be asked about the given account.
+// If all suitable servers have been used already, the rotation starts over.
+func (r *privacyRouter) avoid(subject []byte, suitable []*peer) map[string]struct{} {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	v, ok := r.used.Get(string(subject))
+	if !ok {
+		return nil
+	}
+	used := v.(map[string]struct{})
+	for _, p := range suitable {
+		if _, ok := used[p.id]; !ok {
+			avoid := make(map[string]struct{}, len(used))
+			for id := range used {
+				avoid[id] = struct{}{}
+			}
+			return avoid
+		}
+	}
+	r.used.Remove(string(subject))
+	return nil
+}
+
+// served records that a server has been asked about the given account.
+func (r *privacyRouter) served(subject []byte, id string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	used := make(map[string]struct{})
+	if v, ok := r.used.Get(string(subject)); ok {
+		used = v.(map[string]struct{})
+	}
+	used[id] = struct{}{}
+	r.used.Add(string(subject), used)
+}
@@ -0,0 +1,85 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"fmt"
+	"time"
+
+	"truechain/discovery/etrue"
+)
+
+// ProfileEmbedded is the name of the light client profile tuned for devices
+// with less than 256MB of RAM.
+const ProfileEmbedded = "light-embedded"
+
+// lightProfile is a named set of light client configuration defaults. Profiles
+// are layered over the defaults of the etrue package: a profile only changes
+// options still holding their default value, so explicitly configured ones
+// always take precedence.
+type lightProfile struct {
+	databaseCache   int           // Megabytes of memory allocated to the database
+	trieCache       int           // Megabytes of memory allocated to the trie cache
+	lightPeers      int           // Maximum number of connected servers
+	indexerThrottle time.Duration // Delay between processing two indexer sections
+	memoryLimit     int           // Heap size in megabytes above which load is shed
+	gpoBlocks       int           // Number of blocks sampled by the gas price oracle
+}
+
+var lightProfiles = map[string]*lightProfile{
+	ProfileEmbedded: {
+		databaseCache:   16,
+		trieCache:       8,
+		lightPeers:      10,
+		indexerThrottle: time.Second,
+		memoryLimit:     192,
+		gpoBlocks:       10,
+	},
+}
+
+// ApplyLightProfile layers the defaults of the profile selected in the config
+// over the defaults of the etrue package. An empty profile name leaves the
+// config untouched.
+func ApplyLightProfile(config *etrue.Config) error {
+	if config.LightProfile == "" {
+		return nil
+	}
+	profile, ok := lightProfiles[config.LightProfile]
+	if !ok {
+		return fmt.Errorf("unknown light profile %q", config.LightProfile)
+	}
+	def := etrue.DefaultConfig
+	if config.DatabaseCache == def.DatabaseCache {
+		config.DatabaseCache = profile.databaseCache
+	}
+	if config.TrieCache == def.TrieCache {
+		config.TrieCache = profile.trieCache
+	}
+	if config.LightPeers == def.LightPeers {
+		config.LightPeers = profile.lightPeers
+	}
+	if config.LightIndexerThrottle == def.LightIndexerThrottle {
+		config.LightIndexerThrottle = profile.indexerThrottle
+	}
+	if config.LightMemoryLimit == def.LightMemoryLimit {
+		config.LightMemoryLimit = profile.memoryLimit
+	}
+	if config.GPO.Blocks == def.GPO.Blocks {
+		config.GPO.Blocks = profile.gpoBlocks
+	}
+	return nil
+}
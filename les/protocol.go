@@ -35,75 +35,30 @@ import (
 // Constants to match up protocol versions and messages
 const (
 	lpv2 = 2
+	lpv3 = 3 // negotiates optional capabilities in the handshake
 )
 
 // Supported versions of the les protocol (first is primary)
 var (
-	ClientProtocolVersions    = []uint{lpv2}
-	ServerProtocolVersions    = []uint{lpv2}
-	AdvertiseProtocolVersions = []uint{lpv2} // clients are searching for the first advertised protocol in the list
+	ClientProtocolVersions    = []uint{lpv3, lpv2}
+	ServerProtocolVersions    = []uint{lpv3, lpv2}
+	AdvertiseProtocolVersions = []uint{lpv2, lpv3} // clients are searching for the first advertised protocol in the list
 )
 
-// Number of implemented message corresponding to different protocol versions.
-var ProtocolLengths = map[uint]uint64{lpv2: 37}
-
 const (
 	NetworkId          = 1
 	ProtocolMaxMsgSize = 10 * 1024 * 1024 // Maximum cap on the size of a protocol message
 )
 
-// les protocol message codes
-const (
-	// Protocol messages inherited from LPV1
-	StatusMsg               = 0x00
-	AnnounceMsg             = 0x01
-	GetFastBlockHeadersMsg  = 0x02
-	FastBlockHeadersMsg     = 0x03
-	GetFastBlockBodiesMsg   = 0x04
-	FastBlockBodiesMsg      = 0x05
-	GetSnailBlockHeadersMsg = 0x06
-	SnailBlockHeadersMsg    = 0x07
-	GetSnailBlockBodiesMsg  = 0x08
-	SnailBlockBodiesMsg     = 0x09
-	GetFruitBodiesMsg       = 0x0a
-	FruitBodiesMsg          = 0x0b
-
-	GetReceiptsMsg = 0x0c
-	ReceiptsMsg    = 0x0d
-	// Protocol messages belonging to LPV2
-	GetCodeMsg             = 0x0e
-	CodeMsg                = 0x0f
-	GetProofsV2Msg         = 0x10
-	ProofsV2Msg            = 0x11
-	GetHelperTrieProofsMsg = 0x12
-	HelperTrieProofsMsg    = 0x13
-	SendTxV2Msg            = 0x15
-	GetTxStatusMsg         = 0x16
-	TxStatusMsg            = 0x17
-	// Protocol messages introduced in LPV3
-	StopMsg   = 0x18
-	ResumeMsg = 0x19
-)
+// Message codes, request limits and cost tables are generated from the
+// checked-in protocol spec so that client and server can't drift apart.
+//go:generate go run mkspec.go -spec protocol_spec.json -out gen_protocol.go
 
 type requestInfo struct {
 	name     string
 	maxCount uint64
 }
 
-var requests = map[uint64]requestInfo{
-	GetFastBlockHeadersMsg:  {"GetBlockHeaders", MaxHeaderFetch},
-	GetFastBlockBodiesMsg:   {"GetBlockBodies", MaxBodyFetch},
-	GetSnailBlockHeadersMsg: {"GetBlockHeaders", MaxHeaderFetch},
-	GetSnailBlockBodiesMsg:  {"GetBlockBodies", MaxBodyFetch},
-	GetFruitBodiesMsg:       {"GetBlockBodies", MaxBodyFetch},
-	GetReceiptsMsg:          {"GetReceipts", MaxReceiptFetch},
-	GetCodeMsg:              {"GetCode", MaxCodeFetch},
-	GetProofsV2Msg:          {"GetProofsV2", MaxProofsFetch},
-	GetHelperTrieProofsMsg:  {"GetHelperTrieProofs", MaxHelperTrieProofsFetch},
-	SendTxV2Msg:             {"SendTxV2", MaxTxSend},
-	GetTxStatusMsg:          {"GetTxStatus", MaxTxStatus},
-}
-
 type errCode int
 
 const (
@@ -122,6 +77,8 @@ const (
 	ErrInvalidResponse
 	ErrTooManyTimeouts
 	ErrMissingKey
+	ErrForkIDMismatch
+	ErrCheckpointMismatch
 )
 
 func (e errCode) String() string {
@@ -144,6 +101,8 @@ var errorToString = map[int]string{
 	ErrInvalidResponse:         "Invalid response",
 	ErrTooManyTimeouts:         "Too many request timeouts",
 	ErrMissingKey:              "Key missing from list",
+	ErrForkIDMismatch:          "Fork ID mismatch",
+	ErrCheckpointMismatch:      "Trusted checkpoint mismatch",
 }
 
 type announceBlock struct {
@@ -0,0 +1,233 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"truechain/discovery/common"
+	"truechain/discovery/core"
+	"truechain/discovery/core/rawdb"
+	"truechain/discovery/core/snailchain"
+	snailrawdb "truechain/discovery/core/snailchain/rawdb"
+	"truechain/discovery/core/types"
+	"truechain/discovery/etruedb"
+	"truechain/discovery/light/public"
+	"truechain/discovery/log"
+	"truechain/discovery/params"
+	"truechain/discovery/rlp"
+)
+
+// pruneInterval is the time between two automatic prunings of the database.
+const pruneInterval = time.Hour
+
+var (
+	errPruneNothingKept = errors.New("at least one section has to be kept")
+
+	// prunedKey tracks the first fast and snail block numbers not pruned yet, so
+	// that a pruning doesn't walk the already pruned part of the chains again.
+	prunedKey = []byte("LightPruned")
+)
+
+// prunedProgress is the pruning progress stored under prunedKey.
+type prunedProgress struct {
+	Fast, Snail uint64
+}
+
+// PruneResult is the outcome of a database pruning.
+type PruneResult struct {
+	FastBlocks    uint64 `json:"fastBlocks"`    // fast blocks whose body and receipts were deleted
+	SnailBlocks   uint64 `json:"snailBlocks"`   // snail blocks whose body was deleted
+	BloomSections uint64 `json:"bloomSections"` // bloom bits sections deleted
+	FastPruned    uint64 `json:"fastPruned"`    // fast blocks below this number are pruned
+	SnailPruned   uint64 `json:"snailPruned"`   // snail blocks below this number are pruned
+}
+
+// pruner garbage-collects the chain data cached by the light client from ODR
+// responses: block bodies, receipts and bloom bits of all but the most recent
+// sections of the CHT and bloom trie indexers. Headers and canonical hashes are
+// kept, as are the CHT and bloom trie nodes: every section's trie extends the
+// previous one, so its nodes can't be deleted without reference counting.
+// Pruned data is retrieved from the servers again if it is needed later.
+type pruner struct {
+	db         etruedb.Database
+	config     *public.IndexerConfig
+	cht        *snailchain.ChainIndexer
+	bloomTrie  *core.ChainIndexer
+	checkpoint func() *params.TrustedCheckpoint // the first pruning starts at its sections
+	keep       uint64                           // sections kept by the automatic pruning, 0 if disabled
+
+	lock sync.Mutex // serialises prunings
+	quit chan struct{}
+	wg   *sync.WaitGroup // tracks the automatic pruning loop of the light client
+}
+
+// newPruner creates a pruner of the light client database.
+func newPruner(db etruedb.Database, config *public.IndexerConfig, cht *snailchain.ChainIndexer, bloomTrie *core.ChainIndexer, checkpoint func() *params.TrustedCheckpoint, keep uint64, wg *sync.WaitGroup) *pruner {
+	return &pruner{
+		db:         db,
+		config:     config,
+		cht:        cht,
+		bloomTrie:  bloomTrie,
+		checkpoint: checkpoint,
+		keep:       keep,
+		quit:       make(chan struct{}),
+		wg:         wg,
+	}
+}
+
+// start starts the automatic pruning if enabled.
+func (p *pruner) start() {
+	if p.keep == 0 {
+		return
+	}
+	p.wg.Add(1)
+	go p.loop()
+}
+
+// stop stops the automatic pruning and waits for a pruning in progress, which
+// could also be a manual one.
+func (p *pruner) stop() {
+	close(p.quit)
+	p.lock.Lock()
+	p.lock.Unlock()
+}
+
+func (p *pruner) loop() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := p.prune(p.keep); err != nil {
+				log.Warn("Failed to prune light database", "err", err)
+			}
+		case <-p.quit:
+			return
+		}
+	}
+}
+
+// prune deletes the cached data of all but the given number of most recent
+// sections.
+func (p *pruner) prune(keep uint64) (*PruneResult, error) {
+	if keep == 0 {
+		return nil, errPruneNothingKept
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	var progress prunedProgress
+	if enc, err := p.db.Get(prunedKey); err == nil {
+		if err := rlp.DecodeBytes(enc, &progress); err != nil {
+			return nil, err
+		}
+	}
+	// A client synced from a trusted checkpoint has no blocks before it, so the
+	// first pruning starts at the checkpoint instead of walking the whole chains.
+	// Bodies retrieved on demand for older blocks are left in place.
+	if cp := p.checkpoint(); cp != nil && !cp.Empty() {
+		if progress.Fast == 0 {
+			progress.Fast = cp.SectionBIndex * p.config.BloomSize
+		}
+		if progress.Snail == 0 {
+			progress.Snail = cp.SectionIndex * p.config.ChtSize
+		}
+	}
+	// Never prune the genesis blocks
+	if progress.Fast == 0 {
+		progress.Fast = 1
+	}
+	if progress.Snail == 0 {
+		progress.Snail = 1
+	}
+	var (
+		start  = time.Now()
+		result = new(PruneResult)
+		batch  = p.db.NewBatch()
+	)
+	flush := func() error {
+		if batch.ValueSize() < etruedb.IdealBatchSize {
+			return nil
+		}
+		if err := batch.Write(); err != nil {
+			return err
+		}
+		batch.Reset()
+		return nil
+	}
+	// Prune the fast bodies, receipts and bloom bits older than the kept bloom
+	// trie sections. The bloom bits sections are not regenerated by the bloom
+	// indexer, they are retrieved from the servers again if needed.
+	if sections, _, _ := p.bloomTrie.Sections(); sections > keep {
+		limit := (sections - keep) * p.config.BloomTrieSize
+		for number := progress.Fast; number < limit; number++ {
+			hash := rawdb.ReadCanonicalHash(p.db, number)
+			if hash != (common.Hash{}) {
+				rawdb.DeleteBody(batch, hash, number)
+				rawdb.DeleteReceipts(batch, hash, number)
+				result.FastBlocks++
+			}
+			if (number+1)%p.config.BloomSize == 0 {
+				section := number / p.config.BloomSize
+				for bit := uint(0); bit < types.BloomBitLength; bit++ {
+					rawdb.DeleteBloomBits(batch, bit, section, hash)
+					rawdb.DeleteBloomBits(batch, bit, section, common.Hash{})
+				}
+				result.BloomSections++
+			}
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		}
+		if limit > progress.Fast {
+			progress.Fast = limit
+		}
+	}
+	// Prune the snail bodies older than the kept CHT sections
+	if sections, _, _ := p.cht.Sections(); sections > keep {
+		limit := (sections - keep) * p.config.ChtSize
+		for number := progress.Snail; number < limit; number++ {
+			if hash := snailrawdb.ReadCanonicalHash(p.db, number); hash != (common.Hash{}) {
+				snailrawdb.DeleteBody(batch, hash, number)
+				result.SnailBlocks++
+			}
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		}
+		if limit > progress.Snail {
+			progress.Snail = limit
+		}
+	}
+	enc, err := rlp.EncodeToBytes(&progress)
+	if err != nil {
+		return nil, err
+	}
+	batch.Put(prunedKey, enc)
+	if err := batch.Write(); err != nil {
+		return nil, err
+	}
+	result.FastPruned, result.SnailPruned = progress.Fast, progress.Snail
+	log.Info("Pruned light database", "fast", result.FastBlocks, "snail", result.SnailBlocks, "bloom", result.BloomSections, "elapsed", common.PrettyDuration(time.Since(start)))
+	return result, nil
+}
@@ -0,0 +1,158 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sort"
+	"sync"
+
+	"truechain/discovery/common"
+	"truechain/discovery/core/state"
+	"truechain/discovery/core/types"
+	"truechain/discovery/crypto"
+	"truechain/discovery/light/fast"
+	"truechain/discovery/rlp"
+	"truechain/discovery/trie"
+)
+
+// quorumMaxNonCanonical is the number of blocks of a server's announced head
+// looked up individually before its ancestors reach the local canonical chain.
+const quorumMaxNonCanonical = 100
+
+var (
+	errInvalidQuorum      = errors.New("quorum must be at least one server")
+	errQuorumNotReached   = errors.New("not enough servers confirmed the result")
+	errQuorumInconsistent = errors.New("servers returned inconsistent results")
+)
+
+// quorumAnswer is the balance a server proved in its block.
+type quorumAnswer struct {
+	header  *types.Header
+	balance *big.Int
+	req     *fast.TrieRequest
+}
+
+// quorumBalance retrieves the balance of an account at the given block number
+// with merkle proofs from at least quorum distinct servers. Every server's
+// proof is verified against its own block at that number: the ancestor of the
+// fast head the server announced. Servers whose head is behind the block or
+// not known locally are not asked. The read fails if the servers disagree on
+// the block or the balance, so a server on a diverging chain is detected. The
+// agreed header and the ids of the confirming servers are returned, and the
+// proof is stored so that the state of the header can serve the account.
+func (s *LightEtrue) quorumBalance(ctx context.Context, addr common.Address, number uint64, quorum int) (*big.Int, *types.Header, []string, error) {
+	if quorum < 1 {
+		return nil, nil, nil, errInvalidQuorum
+	}
+	var (
+		key = crypto.Keccak256(addr.Bytes())
+
+		lock    sync.Mutex
+		wg      sync.WaitGroup
+		answers = make(map[string]*quorumAnswer)
+	)
+	for _, p := range s.peers.AllPeers() {
+		header := s.quorumAnchor(p, number)
+		if header == nil {
+			continue
+		}
+		req := &fast.TrieRequest{Id: fast.StateTrieID(header), Key: key}
+		if !p.servesData() || !(*TrieRequest)(req).CanSend(p) {
+			continue
+		}
+		wg.Add(1)
+		go func(p *peer) {
+			defer wg.Done()
+			if err := s.odr.retrieveFrom(ctx, (*TrieRequest)(req), p); err != nil {
+				p.Log().Debug("Quorum read failed", "err", err)
+				return
+			}
+			balance, err := proofBalance(header.Root, key, req.Proof)
+			if err != nil {
+				return
+			}
+			lock.Lock()
+			answers[p.id] = &quorumAnswer{header: header, balance: balance, req: req}
+			lock.Unlock()
+		}(p)
+	}
+	wg.Wait()
+
+	agreed, servers, err := agreeQuorum(answers, quorum)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	agreed.req.StoreResult(s.chainDb)
+	return agreed.balance, agreed.header, servers, nil
+}
+
+// agreeQuorum checks that the servers' answers agree on the block and the
+// balance, and that there are at least quorum of them. The ids of the servers
+// are returned sorted.
+func agreeQuorum(answers map[string]*quorumAnswer, quorum int) (*quorumAnswer, []string, error) {
+	var (
+		agreed  *quorumAnswer
+		servers []string
+	)
+	for server, answer := range answers {
+		if agreed != nil && (agreed.header.Hash() != answer.header.Hash() || agreed.balance.Cmp(answer.balance) != 0) {
+			return nil, nil, errQuorumInconsistent
+		}
+		agreed = answer
+		servers = append(servers, server)
+	}
+	if len(answers) < quorum {
+		return nil, nil, errQuorumNotReached
+	}
+	sort.Strings(servers)
+	return agreed, servers, nil
+}
+
+// quorumAnchor returns the header of a server's block at the given number, the
+// ancestor of the fast head it announced, or nil if its head is behind the
+// block or the ancestor isn't known locally.
+func (s *LightEtrue) quorumAnchor(p *peer, number uint64) *types.Header {
+	head := p.headBlockInfo()
+	if head.FastNumber < number {
+		return nil
+	}
+	maxNonCanonical := uint64(quorumMaxNonCanonical)
+	hash, _ := s.fblockchain.GetAncestor(head.FastHash, head.FastNumber, head.FastNumber-number, &maxNonCanonical)
+	if hash == (common.Hash{}) {
+		return nil
+	}
+	return s.fblockchain.GetHeader(hash, number)
+}
+
+// proofBalance extracts the balance of an account from a verified state proof.
+func proofBalance(root common.Hash, key []byte, proof trie.DatabaseReader) (*big.Int, error) {
+	enc, _, err := trie.VerifyProof(root, key, proof)
+	if err != nil {
+		return nil, err
+	}
+	if len(enc) == 0 {
+		return new(big.Int), nil
+	}
+	var account state.Account
+	if err := rlp.DecodeBytes(enc, &account); err != nil {
+		return nil, err
+	}
+	return account.Balance, nil
+}
@@ -0,0 +1,67 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+
+	"truechain/discovery/core/types"
+)
+
+// Tests that a quorum read only succeeds if enough servers proved the same
+// balance in the same block, and that diverging servers are detected.
+func TestAgreeQuorum(t *testing.T) {
+	var (
+		block = &types.Header{Number: big.NewInt(10), Extra: []byte{}}
+		fork  = &types.Header{Number: big.NewInt(10), Extra: []byte("fork")}
+	)
+	answer := func(header *types.Header, balance int64) *quorumAnswer {
+		return &quorumAnswer{header: header, balance: big.NewInt(balance)}
+	}
+	tests := []struct {
+		answers map[string]*quorumAnswer
+		quorum  int
+		servers []string
+		err     error
+	}{
+		{map[string]*quorumAnswer{}, 1, nil, errQuorumNotReached},
+		{map[string]*quorumAnswer{"a": answer(block, 5)}, 1, []string{"a"}, nil},
+		{map[string]*quorumAnswer{"a": answer(block, 5)}, 2, nil, errQuorumNotReached},
+		{map[string]*quorumAnswer{"a": answer(block, 5), "b": answer(block, 5)}, 2, []string{"a", "b"}, nil},
+		{map[string]*quorumAnswer{"a": answer(block, 5), "b": answer(block, 6)}, 2, nil, errQuorumInconsistent},
+		{map[string]*quorumAnswer{"a": answer(block, 5), "b": answer(fork, 5)}, 2, nil, errQuorumInconsistent},
+		{map[string]*quorumAnswer{"a": answer(block, 5), "b": answer(fork, 5)}, 1, nil, errQuorumInconsistent},
+	}
+	for i, tt := range tests {
+		agreed, servers, err := agreeQuorum(tt.answers, tt.quorum)
+		if err != tt.err {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if fmt.Sprint(servers) != fmt.Sprint(tt.servers) {
+			t.Errorf("test %d: servers mismatch: have %v, want %v", i, servers, tt.servers)
+		}
+		if agreed.balance.Int64() != 5 || agreed.header != block {
+			t.Errorf("test %d: agreed answer mismatch: have balance %v in %x", i, agreed.balance, agreed.header.Hash())
+		}
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"time"
+
+	"truechain/discovery/common"
+	"truechain/discovery/light/public"
+	"truechain/discovery/log"
+	"truechain/discovery/params"
+)
+
+// StartupReport describes the configuration the light client was started with.
+// It is logged once on Start and served over RPC, so that the configuration of
+// a fleet of clients can be compared.
+type StartupReport struct {
+	Time       time.Time   `json:"time"`
+	Versions   []uint      `json:"versions"`   // supported protocol versions, preferred first
+	Advertised uint        `json:"advertised"` // protocol version searched for in discovery
+	NetworkId  uint64      `json:"networkId"`
+	Genesis    common.Hash `json:"genesis"` // snail genesis hash
+
+	Checkpoint       *params.TrustedCheckpoint `json:"checkpoint"`       // hardcoded checkpoint, nil if none
+	CheckpointOracle *common.Address           `json:"checkpointOracle"` // nil if not activated
+
+	ULC        bool `json:"ulc"`
+	ULCServers int  `json:"ulcServers"`
+	ULCMinimum int  `json:"ulcMinimum"` // minimum percentage of trusted servers agreeing on a head
+
+	Indexer public.IndexerConfig `json:"indexer"`
+
+	DatabaseCache   int `json:"databaseCache"` // megabytes
+	DatabaseHandles int `json:"databaseHandles"`
+	TrieCache       int `json:"trieCache"` // megabytes
+
+	Peers       int      `json:"peers"`
+	MaxPerGroup int      `json:"maxPerGroup"`
+	RelayOnly   []string `json:"relayOnly"` // servers only used to relay transactions
+	SyncOnly    []string `json:"syncOnly"`  // servers only used to sync
+	Privacy     bool     `json:"privacy"`
+	Decoys      int      `json:"decoys"`
+}
+
+// startupReport collects the startup report of the light client.
+func (s *LightEtrue) startupReport() *StartupReport {
+	pm := s.protocolManager
+	report := &StartupReport{
+		Time:            time.Now(),
+		Versions:        ClientProtocolVersions,
+		Advertised:      AdvertiseProtocolVersions[0],
+		NetworkId:       s.networkId,
+		Genesis:         s.blockchain.Genesis().Hash(),
+		Checkpoint:      pm.trustedCheckpoint(),
+		Indexer:         *s.iConfig,
+		DatabaseCache:   s.config.DatabaseCache,
+		DatabaseHandles: s.config.DatabaseHandles,
+		TrieCache:       s.config.TrieCache,
+		Peers:           s.config.LightPeers,
+		MaxPerGroup:     s.config.LightMaxPerGroup,
+		RelayOnly:       s.config.LightRelayOnly,
+		SyncOnly:        s.config.LightSyncOnly,
+		Privacy:         s.config.LightPrivacyMode,
+		Decoys:          s.config.LightProofDecoys,
+	}
+	if pm.reg != nil {
+		report.CheckpointOracle = &pm.reg.config.Address
+	}
+	if pm.ulc != nil {
+		report.ULC = true
+		report.ULCServers = pm.ulc.count()
+		report.ULCMinimum = pm.ulc.fraction
+	}
+	return report
+}
+
+// log prints the report as a single line.
+func (r *StartupReport) log() {
+	ctx := []interface{}{"versions", r.Versions, "network", r.NetworkId, "genesis", r.Genesis}
+	if r.Checkpoint != nil {
+		ctx = append(ctx, "checkpoint", r.Checkpoint.SectionIndex, "sectionhead", r.Checkpoint.SectionHead)
+	}
+	if r.CheckpointOracle != nil {
+		ctx = append(ctx, "oracle", *r.CheckpointOracle)
+	}
+	if r.ULC {
+		ctx = append(ctx, "ulc", r.ULCServers, "ulcmin", r.ULCMinimum)
+	}
+	ctx = append(ctx, "cht", r.Indexer.ChtSize, "bloomtrie", r.Indexer.BloomTrieSize,
+		"dbcache", r.DatabaseCache, "triecache", r.TrieCache, "peers", r.Peers)
+	log.Info("Started experimental light client", ctx...)
+}
@@ -20,6 +20,7 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
@@ -32,14 +33,106 @@ var (
 	retryQueue         = time.Millisecond * 100
 	softRequestTimeout = time.Millisecond * 500
 	hardRequestTimeout = time.Second * 10
+
+	// servers connected through Tor onion services get more time to answer
+	onionSoftRequestTimeout = time.Second * 3
+	onionHardRequestTimeout = time.Second * 30
+
+	// maxRetryDelay caps the exponential backoff of the retries
+	maxRetryDelay = time.Second * 10
+
+	errRetriesExhausted = errors.New("request retries exhausted")
+)
+
+// Backoff strategies of the retries while no server is suitable for a request.
+const (
+	backoffConstant    = "constant"
+	backoffExponential = "exponential"
 )
 
+// retrievePolicy is the timeout and retry policy of the retrieve manager.
+type retrievePolicy struct {
+	softTimeout time.Duration // the request is also sent to another server after it
+	hardTimeout time.Duration // the server is dropped after it
+	retries     int           // maximum resends of a request to other servers, 0 if unlimited
+	exponential bool          // whether the retry delay doubles while no server is suitable
+}
+
+// defaultRetrievePolicy is the policy used unless configured otherwise.
+var defaultRetrievePolicy = retrievePolicy{softTimeout: softRequestTimeout, hardTimeout: hardRequestTimeout}
+
+// newRetrievePolicy creates a retrieve policy, zero timeouts and an empty
+// backoff select the defaults.
+func newRetrievePolicy(soft, hard time.Duration, retries int, backoff string) (retrievePolicy, error) {
+	policy := defaultRetrievePolicy
+	if soft > 0 {
+		policy.softTimeout = soft
+	}
+	if hard > 0 {
+		policy.hardTimeout = hard
+	}
+	if policy.hardTimeout < policy.softTimeout {
+		return policy, fmt.Errorf("hard request timeout %v shorter than the soft one %v", policy.hardTimeout, policy.softTimeout)
+	}
+	if retries < 0 {
+		return policy, fmt.Errorf("negative request retries %d", retries)
+	}
+	policy.retries = retries
+
+	switch backoff {
+	case "", backoffConstant:
+	case backoffExponential:
+		policy.exponential = true
+	default:
+		return policy, fmt.Errorf("unknown request backoff %q, want %q or %q", backoff, backoffConstant, backoffExponential)
+	}
+	return policy, nil
+}
+
+// requestTimeouts returns the soft and hard request timeouts of a server.
+func (rm *retrieveManager) requestTimeouts(p distPeer) (time.Duration, time.Duration) {
+	soft, hard := rm.policy.softTimeout, rm.policy.hardTimeout
+	if pp, ok := p.(*peer); ok && pp.onion {
+		if soft < onionSoftRequestTimeout {
+			soft = onionSoftRequestTimeout
+		}
+		if hard < onionHardRequestTimeout {
+			hard = onionHardRequestTimeout
+		}
+	}
+	return soft, hard
+}
+
+// retryDelay returns the time waited before the given retry of a request for
+// which no server was suitable.
+func (policy retrievePolicy) retryDelay(attempt int) time.Duration {
+	if !policy.exponential {
+		return retryQueue
+	}
+	delay := retryQueue
+	for i := 0; i < attempt && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay
+}
+
 // retrieveManager is a layer on top of requestDistributor which takes care of
 // matching replies by request ID and handles timeouts and resends if necessary.
 type retrieveManager struct {
 	dist       *requestDistributor
 	peers      *peerSet
 	serverPool peerSelector
+	clock      mclock.Clock // clock of the distributor, timing the requests
+
+	// hedgeTimeout is the time after which a request is also sent to another
+	// peer without considering the first one timed out, taking the first valid
+	// answer. Disabled if zero or not shorter than the soft timeout.
+	hedgeTimeout time.Duration
+
+	policy retrievePolicy
 
 	lock     sync.RWMutex
 	sentReqs map[uint64]*sentReq
@@ -71,6 +164,10 @@ type sentReq struct {
 	lastReqQueued bool     // last request has been queued but not sent
 	lastReqSentTo distPeer // if not nil then last request has been sent to given peer but not timed out
 	reqSrtoCount  int      // number of requests that reached soft (but not hard) timeout
+	sentCount     int      // number of servers the request has been sent to
+	noPeersCount  int      // number of retries while no server was suitable
+
+	routine *routine // goroutine running the retrieve loop
 }
 
 // sentReqToPeer notifies the request-from-peer goroutine (tryRequest) about a response
@@ -90,7 +187,8 @@ type reqPeerEvent struct {
 }
 
 const (
-	rpSent = iota // if peer == nil, not sent (no suitable peers)
+	rpSent  = iota // if peer == nil, not sent (no suitable peers)
+	rpHedge        // hedge timeout reached, the request is duplicated to another peer
 	rpSoftTimeout
 	rpHardTimeout
 	rpDeliveredValid
@@ -104,6 +202,8 @@ func newRetrieveManager(peers *peerSet, dist *requestDistributor, serverPool pee
 		peers:      peers,
 		dist:       dist,
 		serverPool: serverPool,
+		clock:      dist.clock,
+		policy:     defaultRetrievePolicy,
 		sentReqs:   make(map[uint64]*sentReq),
 	}
 }
@@ -158,7 +258,7 @@ func (rm *retrieveManager) sendReq(reqID uint64, req *distReq, val validatorFunc
 	rm.sentReqs[reqID] = r
 	rm.lock.Unlock()
 
-	go r.retrieveLoop()
+	goLabeled("retriever", r.retrieveLoop)
 	return r
 }
 
@@ -174,6 +274,15 @@ func (rm *retrieveManager) deliver(peer distPeer, msg *Msg) error {
 	return errResp(ErrUnexpectedResponse, "reqID = %v", msg.ReqID)
 }
 
+// pending returns true if the given request is waiting for a reply.
+func (rm *retrieveManager) pending(reqID uint64) bool {
+	rm.lock.RLock()
+	defer rm.lock.RUnlock()
+
+	_, ok := rm.sentReqs[reqID]
+	return ok
+}
+
 // frozen is called by the LES protocol manager when a server has suspended its service and we
 // should not expect an answer for the requests already sent there
 func (rm *retrieveManager) frozen(peer distPeer) {
@@ -189,7 +298,8 @@ func (rm *retrieveManager) frozen(peer distPeer) {
 type reqStateFn func() reqStateFn
 
 // retrieveLoop is the retrieval state machine event loop
-func (r *sentReq) retrieveLoop() {
+func (r *sentReq) retrieveLoop(rt *routine) {
+	r.routine = rt
 	go r.tryRequest()
 	r.lastReqQueued = true
 	state := r.stateRequesting
@@ -206,6 +316,7 @@ func (r *sentReq) retrieveLoop() {
 // stateRequesting: a request has been queued or sent recently; when it reaches soft timeout,
 // a new request is sent to a new peer
 func (r *sentReq) stateRequesting() reqStateFn {
+	r.routine.setState("requesting")
 	select {
 	case ev := <-r.eventsCh:
 		r.update(ev)
@@ -222,16 +333,19 @@ func (r *sentReq) stateRequesting() reqStateFn {
 				// no need to go to stopped state because waiting() already returned false
 				return nil
 			}
-		case rpSoftTimeout:
-			// last request timed out, try asking a new peer
-			go r.tryRequest()
-			r.lastReqQueued = true
-			return r.stateRequesting
+		case rpHedge, rpSoftTimeout:
+			// last request is slow or timed out, try asking a new peer
+			return r.retry()
+		case rpHardTimeout:
+			// fail if no more retries are allowed and nothing is left to wait for
+			if r.exhausted() && !r.waiting() {
+				r.stop(errRetriesExhausted)
+				return nil
+			}
 		case rpDeliveredInvalid, rpNotDelivered:
 			// if it was the last sent request (set to nil by update) then start a new one
 			if !r.lastReqQueued && r.lastReqSentTo == nil {
-				go r.tryRequest()
-				r.lastReqQueued = true
+				return r.retry()
 			}
 			return r.stateRequesting
 		case rpDeliveredValid:
@@ -248,8 +362,11 @@ func (r *sentReq) stateRequesting() reqStateFn {
 // Peers may become suitable for a certain request later or new peers may appear so we
 // keep trying.
 func (r *sentReq) stateNoMorePeers() reqStateFn {
+	r.routine.setState("no more peers")
+	delay := r.rm.policy.retryDelay(r.noPeersCount)
+	r.noPeersCount++
 	select {
-	case <-time.After(retryQueue):
+	case <-r.rm.clock.After(delay):
 		go r.tryRequest()
 		r.lastReqQueued = true
 		return r.stateRequesting
@@ -269,9 +386,32 @@ func (r *sentReq) stateNoMorePeers() reqStateFn {
 	}
 }
 
+// exhausted returns true if the request can't be resent to more servers.
+func (r *sentReq) exhausted() bool {
+	limit := r.rm.policy.retries
+	return limit > 0 && r.sentCount > limit
+}
+
+// retry sends the request to a new peer unless the retries are exhausted, in
+// which case it keeps waiting for the requests already sent or fails if none of
+// them can succeed anymore.
+func (r *sentReq) retry() reqStateFn {
+	if r.exhausted() {
+		if r.waiting() {
+			return r.stateRequesting
+		}
+		r.stop(errRetriesExhausted)
+		return nil
+	}
+	go r.tryRequest()
+	r.lastReqQueued = true
+	return r.stateRequesting
+}
+
 // stateStopped: request succeeded or cancelled, just waiting for some peers
 // to either answer or time out hard
 func (r *sentReq) stateStopped() reqStateFn {
+	r.routine.setState("stopped")
 	for r.waiting() {
 		r.update(<-r.eventsCh)
 	}
@@ -284,7 +424,10 @@ func (r *sentReq) update(ev reqPeerEvent) {
 	case rpSent:
 		r.lastReqQueued = false
 		r.lastReqSentTo = ev.peer
-	case rpSoftTimeout:
+		if ev.peer != nil {
+			r.sentCount++
+		}
+	case rpHedge, rpSoftTimeout:
 		r.lastReqSentTo = nil
 		r.reqSrtoCount++
 	case rpHardTimeout:
@@ -325,8 +468,9 @@ func (r *sentReq) tryRequest() {
 		return
 	}
 
-	reqSent := mclock.Now()
+	reqSent := r.rm.clock.Now()
 	srto, hrto := false, false
+	softTimeout, hardTimeout := r.rm.requestTimeouts(p)
 
 	r.lock.RLock()
 	s, ok := r.sentTo[p]
@@ -339,7 +483,7 @@ func (r *sentReq) tryRequest() {
 		// send feedback to server pool and remove peer if hard timeout happened
 		pp, ok := p.(*peer)
 		if ok && r.rm.serverPool != nil {
-			respTime := time.Duration(mclock.Now() - reqSent)
+			respTime := time.Duration(r.rm.clock.Now() - reqSent)
 			r.rm.serverPool.adjustResponseTime(pp.poolEntry, respTime, srto)
 		}
 		if hrto {
@@ -354,18 +498,38 @@ func (r *sentReq) tryRequest() {
 		r.lock.Unlock()
 	}()
 
-	select {
-	case event := <-s.event:
-		if event == rpNotDelivered {
-			r.lock.Lock()
-			delete(r.sentTo, p)
-			r.lock.Unlock()
+	// A hedged request is already counted as a soft timeout by the state
+	// machine, the actual one is only reported to the server pool
+	var (
+		hedgeCh <-chan time.Time
+		hedged  bool
+		softCh  = r.rm.clock.After(softTimeout)
+	)
+	if hedge := r.rm.hedgeTimeout; hedge > 0 && hedge < softTimeout {
+		hedgeCh = r.rm.clock.After(hedge)
+	}
+	for !srto {
+		select {
+		case event := <-s.event:
+			if event == rpNotDelivered {
+				r.lock.Lock()
+				delete(r.sentTo, p)
+				r.lock.Unlock()
+			}
+			r.eventsCh <- reqPeerEvent{event, p}
+			return
+		case <-hedgeCh:
+			hedged, hedgeCh = true, nil
+			r.eventsCh <- reqPeerEvent{rpHedge, p}
+		case <-softCh:
+			srto = true
+			if lp, ok := p.(*peer); ok && lp.metrics != nil {
+				lp.metrics.timeout()
+			}
+			if !hedged {
+				r.eventsCh <- reqPeerEvent{rpSoftTimeout, p}
+			}
 		}
-		r.eventsCh <- reqPeerEvent{event, p}
-		return
-	case <-time.After(softRequestTimeout):
-		srto = true
-		r.eventsCh <- reqPeerEvent{rpSoftTimeout, p}
 	}
 
 	select {
@@ -376,7 +540,7 @@ func (r *sentReq) tryRequest() {
 			r.lock.Unlock()
 		}
 		r.eventsCh <- reqPeerEvent{event, p}
-	case <-time.After(hardRequestTimeout):
+	case <-r.rm.clock.After(hardTimeout):
 		hrto = true
 		r.eventsCh <- reqPeerEvent{rpHardTimeout, p}
 	}
@@ -394,17 +558,23 @@ func (r *sentReq) deliver(peer distPeer, msg *Msg) error {
 	if s.frozen {
 		return nil
 	}
-	valid := r.validate(peer, msg) == nil
+	err := r.validate(peer, msg)
 	r.sentTo[peer] = sentReqToPeer{delivered: true, frozen: false, event: s.event}
-	if valid {
+	if err == nil {
 		s.event <- rpDeliveredValid
 	} else {
 		s.event <- rpDeliveredInvalid
 	}
-	if !valid {
+	switch err {
+	case nil:
+		return nil
+	case errReceiptHashMismatch:
+		// Receipts are checked against a header known locally, a mismatch
+		// can't be caused by anything but the server
+		return err
+	default:
 		return errResp(ErrInvalidResponse, "reqID = %v", msg.ReqID)
 	}
-	return nil
 }
 
 // frozen sends a "not delivered" event to the peer event channel belonging to the
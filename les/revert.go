@@ -0,0 +1,88 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"context"
+	"errors"
+
+	"truechain/discovery/common"
+	"truechain/discovery/core"
+	"truechain/discovery/core/types"
+	"truechain/discovery/core/vm"
+	"truechain/discovery/light/fast"
+)
+
+// revertCacheLimit is the number of recovered revert reasons cached.
+const revertCacheLimit = 256
+
+var (
+	errRevertTxIndex = errors.New("transaction index out of range")
+	errUnknownParent = errors.New("unknown parent header")
+)
+
+// revertReason re-executes the transactions of a fast block on the state of
+// its parent, up to the one with the given index, and returns the revert reason
+// of that transaction. The state accessed by the block is retrieved on demand,
+// so this is expensive and only done if enabled by LightRevertReasons.
+func (s *LightEtrue) revertReason(ctx context.Context, blockHash common.Hash, index uint64) ([]byte, error) {
+	key := struct {
+		hash  common.Hash
+		index uint64
+	}{blockHash, index}
+	if reason, ok := s.revertCache.Get(key); ok {
+		return reason.([]byte), nil
+	}
+	block, err := s.fblockchain.GetBlockByHash(ctx, blockHash)
+	if err != nil {
+		return nil, err
+	}
+	if index >= uint64(len(block.Transactions())) {
+		return nil, errRevertTxIndex
+	}
+	parent := s.fblockchain.GetHeader(block.ParentHash(), block.NumberU64()-1)
+	if parent == nil {
+		return nil, errUnknownParent
+	}
+	var (
+		statedb = fast.NewState(ctx, parent, s.odr)
+		signer  = types.MakeSigner(s.chainConfig, block.Number())
+		gp      = new(core.GasPool).AddGas(block.GasLimit())
+	)
+	for i, tx := range block.Transactions()[:index+1] {
+		msg, err := tx.AsMessage(signer)
+		if err != nil {
+			return nil, err
+		}
+		context := core.NewEVMContext(msg, block.Header(), s.fblockchain, nil, nil)
+		evm := vm.NewEVM(context, statedb, s.chainConfig, vm.Config{})
+		result, err := core.ApplyMessage(evm, msg, gp)
+		if err := statedb.Error(); err != nil {
+			return nil, err
+		}
+		if err != nil {
+			return nil, err
+		}
+		if uint64(i) == index {
+			reason := result.Revert()
+			s.revertCache.Add(key, reason)
+			return reason, nil
+		}
+		statedb.Finalise(true)
+	}
+	return nil, errRevertTxIndex
+}
@@ -0,0 +1,209 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"context"
+	"math/big"
+
+	"truechain/discovery/common"
+	"truechain/discovery/common/hexutil"
+	"truechain/discovery/consensus/minerva"
+	"truechain/discovery/core/types"
+	"truechain/discovery/light"
+	"truechain/discovery/params"
+)
+
+// PublicRewardInfoAPI exposes the staking epochs, the snail reward eras and the
+// parameters needed to estimate rewards, so that wallets don't need a full node
+// for it. The blocks referenced are verified against the canonical chains.
+type PublicRewardInfoAPI struct {
+	client *LightEtrue
+}
+
+// NewPublicRewardInfoAPI creates a new reward information API.
+func NewPublicRewardInfoAPI(client *LightEtrue) *PublicRewardInfoAPI {
+	return &PublicRewardInfoAPI{client: client}
+}
+
+// EpochInfo is a staking epoch, a range of fast blocks with the same validator
+// set. The hash of the first block is given once the epoch has begun.
+type EpochInfo struct {
+	ID          hexutil.Uint64 `json:"id"`
+	BeginNumber hexutil.Uint64 `json:"beginNumber"`
+	EndNumber   hexutil.Uint64 `json:"endNumber"`
+	BeginHash   *common.Hash   `json:"beginHash"`
+	Head        hexutil.Uint64 `json:"head"`
+}
+
+// RewardEra is a range of snail blocks paying the same block reward.
+type RewardEra struct {
+	Era         hexutil.Uint64 `json:"era"`
+	BeginNumber hexutil.Uint64 `json:"beginNumber"`
+	EndNumber   hexutil.Uint64 `json:"endNumber"`
+	SnailNumber hexutil.Uint64 `json:"snailNumber"`
+	SnailHash   common.Hash    `json:"snailHash"`
+	Ended       bool           `json:"ended"` // no block reward is paid any more
+
+	Committee  *hexutil.Big `json:"committeeReward"`
+	MinerBlock *hexutil.Big `json:"minerBlockReward"`
+	MinerFruit *hexutil.Big `json:"minerFruitReward"`
+	Developer  *hexutil.Big `json:"developerReward"`
+}
+
+// RewardParams are the protocol parameters of the reward calculation.
+type RewardParams struct {
+	SnailRewardInterval   hexutil.Uint64 `json:"snailRewardInterval"`   // snail blocks between sealing and rewarding a block
+	SnailConfirmInterval  hexutil.Uint64 `json:"snailConfirmInterval"`  // confirmations of a rewarded snail block
+	EpochLength           hexutil.Uint64 `json:"epochLength"`           // fast blocks per staking epoch
+	MaxRedeemHeight       hexutil.Uint64 `json:"maxRedeemHeight"`       // fast blocks a withdrawn stake stays locked
+	LegacyEraLength       hexutil.Uint64 `json:"legacyEraLength"`       // snail blocks per era before the decay schedule
+	DecayBegin            hexutil.Uint64 `json:"decayBegin"`            // first snail block of the decay schedule
+	DecayEraLength        hexutil.Uint64 `json:"decayEraLength"`        // snail blocks per era of the decay schedule
+	DecayBaseReward       *hexutil.Big   `json:"decayBaseReward"`       // block reward of the first decay era
+	RewardEnd             hexutil.Uint64 `json:"rewardEnd"`             // first snail block without a block reward
+	ElectionMinStakeLimit *hexutil.Big   `json:"electionMinStakeLimit"` // minimum stake of a validator
+}
+
+// Epoch returns the staking epoch of a fast block, the head block if none is
+// given.
+func (api *PublicRewardInfoAPI) Epoch(ctx context.Context, fastNumber *hexutil.Uint64) (*EpochInfo, error) {
+	head := api.client.fblockchain.CurrentHeader().Number.Uint64()
+	number := head
+	if fastNumber != nil {
+		number = uint64(*fastNumber)
+	}
+	return api.client.epochInfo(ctx, types.GetEpochFromHeight(number), head)
+}
+
+// EpochByID returns a staking epoch by its identifier.
+func (api *PublicRewardInfoAPI) EpochByID(ctx context.Context, id hexutil.Uint64) (*EpochInfo, error) {
+	head := api.client.fblockchain.CurrentHeader().Number.Uint64()
+	return api.client.epochInfo(ctx, types.GetEpochFromID(uint64(id)), head)
+}
+
+// RewardEra returns the reward era of a canonical snail block and the block
+// rewards paid in it, the era of the head block if none is given.
+func (api *PublicRewardInfoAPI) RewardEra(ctx context.Context, snailNumber *hexutil.Uint64) (*RewardEra, error) {
+	number := api.client.blockchain.CurrentHeader().Number.Uint64()
+	if snailNumber != nil {
+		if uint64(*snailNumber) > number {
+			return nil, nil
+		}
+		number = uint64(*snailNumber)
+	}
+	hash, err := light.GetCanonicalHash(ctx, api.client.odr, number)
+	if err != nil {
+		return nil, err
+	}
+	era := rewardEra(number)
+	era.SnailNumber, era.SnailHash = hexutil.Uint64(number), hash
+	return era, nil
+}
+
+// RewardParams returns the protocol parameters of the reward calculation.
+func (api *PublicRewardInfoAPI) RewardParams() *RewardParams {
+	return &RewardParams{
+		SnailRewardInterval:   hexutil.Uint64(params.SnailRewardInterval.Uint64()),
+		SnailConfirmInterval:  hexutil.Uint64(params.SnailConfirmInterval.Uint64()),
+		EpochLength:           hexutil.Uint64(params.NewEpochLength),
+		MaxRedeemHeight:       hexutil.Uint64(params.MaxRedeemHeight),
+		LegacyEraLength:       hexutil.Uint64(minerva.SnailBlockRewardsChangeInterval),
+		DecayBegin:            hexutil.Uint64(minerva.NewRewardBegin),
+		DecayEraLength:        hexutil.Uint64(minerva.RewardMinerDecayEpoch),
+		DecayBaseReward:       (*hexutil.Big)(minerva.NewRewardCoin),
+		RewardEnd:             hexutil.Uint64(minerva.NewRewardBegin + minerva.RewardEndSnailHeight),
+		ElectionMinStakeLimit: (*hexutil.Big)(params.ElectionMinLimitForStaking),
+	}
+}
+
+// epochInfo fills in the hash of the first block of an epoch which has begun,
+// retrieved from the canonical fast chain.
+func (s *LightEtrue) epochInfo(ctx context.Context, epoch *types.EpochIDInfo, head uint64) (*EpochInfo, error) {
+	info := &EpochInfo{
+		ID:          hexutil.Uint64(epoch.EpochID),
+		BeginNumber: hexutil.Uint64(epoch.BeginHeight),
+		EndNumber:   hexutil.Uint64(epoch.EndHeight),
+		Head:        hexutil.Uint64(head),
+	}
+	if epoch.BeginHeight <= head {
+		header, err := s.fblockchain.GetHeaderByNumberOdr(ctx, epoch.BeginHeight)
+		if err != nil {
+			return nil, err
+		}
+		if header != nil {
+			hash := header.Hash()
+			info.BeginHash = &hash
+		}
+	}
+	return info, nil
+}
+
+// rewardEra returns the reward era of a snail block. The eras of the legacy
+// schedule, decreasing the reward by 2% every SnailBlockRewardsChangeInterval
+// blocks, are followed by the ones of the decay schedule starting at
+// NewRewardBegin, decreasing it by 20% every RewardMinerDecayEpoch blocks.
+func rewardEra(number uint64) *RewardEra {
+	var (
+		legacyLength = uint64(minerva.SnailBlockRewardsChangeInterval)
+		decayBegin   = uint64(minerva.NewRewardBegin)
+		decayLength  = uint64(minerva.RewardMinerDecayEpoch)
+		rewardEnd    = decayBegin + uint64(minerva.RewardEndSnailHeight)
+		legacyEras   = (decayBegin-1)/legacyLength + 1
+		era          = new(RewardEra)
+	)
+	switch {
+	case number < decayBegin:
+		index := number / legacyLength
+		era.Era = hexutil.Uint64(index)
+		era.BeginNumber = hexutil.Uint64(index * legacyLength)
+		era.EndNumber = hexutil.Uint64(min64(index*legacyLength+legacyLength-1, decayBegin-1))
+	case number < rewardEnd:
+		// Mirrors the era computation of the reward of the decay schedule
+		index := (number - decayBegin + 1) / decayLength
+		begin := decayBegin - 1 + index*decayLength
+		if index == 0 {
+			begin = decayBegin
+		}
+		era.Era = hexutil.Uint64(legacyEras + index)
+		era.BeginNumber = hexutil.Uint64(begin)
+		era.EndNumber = hexutil.Uint64(min64(decayBegin-1+(index+1)*decayLength-1, rewardEnd-1))
+	default:
+		era.Era = hexutil.Uint64(legacyEras + (rewardEnd-decayBegin)/decayLength + 1)
+		era.BeginNumber = hexutil.Uint64(rewardEnd)
+		era.EndNumber = hexutil.Uint64(^uint64(0))
+		era.Ended = true
+		return era
+	}
+	committee, minerBlock, minerFruit, developer, err := minerva.GetBlockReward3(new(big.Int).SetUint64(number))
+	if err != nil {
+		era.Ended = true
+		return era
+	}
+	era.Committee, era.MinerBlock, era.MinerFruit = (*hexutil.Big)(committee), (*hexutil.Big)(minerBlock), (*hexutil.Big)(minerFruit)
+	if developer != nil {
+		era.Developer = (*hexutil.Big)(developer)
+	}
+	return era
+}
+
+func min64(a, b uint64) uint64 {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,149 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"truechain/discovery/common"
+	"truechain/discovery/core/rawdb"
+	"truechain/discovery/core/types"
+	"truechain/discovery/etruedb"
+	"truechain/discovery/log"
+	"truechain/discovery/params"
+	"truechain/discovery/rlp"
+)
+
+// maxRewindBackup is the maximum number of headers saved before a rewind, a
+// deeper rewind is not backed up.
+const maxRewindBackup = 100000
+
+var (
+	rewindBackupKey = []byte("LesRewindBackup")
+
+	errNoRewindBackup = errors.New("no rewind backup")
+)
+
+// rewindBackup is a snapshot of the canonical fast chain section dropped by a
+// config-driven rewind, along with the chain config stored before it. The
+// rewind target is a fast block number, the one the compatibility check was
+// done against.
+type rewindBackup struct {
+	Time     uint64
+	What     string
+	RewindTo uint64
+	Genesis  common.Hash
+	Head     common.Hash
+	Config   []byte // JSON encoded chain config replaced by the upgrade
+	Headers  []*types.Header
+}
+
+// backupRewind saves the canonical fast headers above rewindTo and the stored
+// chain config, so that the rewind caused by the config upgrade can be undone.
+func backupRewind(db etruedb.Database, genesis common.Hash, compat *params.ConfigCompatError) {
+	head := rawdb.ReadHeadHeaderHash(db)
+	number := rawdb.ReadHeaderNumber(db, head)
+	if number == nil || *number <= compat.RewindTo {
+		return
+	}
+	if *number-compat.RewindTo > maxRewindBackup {
+		log.Warn("Rewind too deep to back up", "head", *number, "rewindTo", compat.RewindTo, "limit", maxRewindBackup)
+		return
+	}
+	config, err := json.Marshal(rawdb.ReadChainConfig(db, genesis))
+	if err != nil {
+		log.Error("Failed to encode chain config backup", "err", err)
+		return
+	}
+	backup := &rewindBackup{
+		Time:     uint64(time.Now().Unix()),
+		What:     compat.What,
+		RewindTo: compat.RewindTo,
+		Genesis:  genesis,
+		Head:     head,
+		Config:   config,
+	}
+	for n := compat.RewindTo + 1; n <= *number; n++ {
+		header := rawdb.ReadHeader(db, rawdb.ReadCanonicalHash(db, n), n)
+		if header == nil {
+			break
+		}
+		backup.Headers = append(backup.Headers, header)
+	}
+	enc, err := rlp.EncodeToBytes(backup)
+	if err != nil {
+		log.Error("Failed to encode rewind backup", "err", err)
+		return
+	}
+	batch := db.NewBatch()
+	batch.Put(rewindBackupKey, enc)
+	if err := batch.Write(); err != nil {
+		log.Error("Failed to store rewind backup", "err", err)
+		return
+	}
+	log.Info("Backed up chain before rewind", "headers", len(backup.Headers), "rewindTo", compat.RewindTo)
+}
+
+// RewindRestore is the outcome of restoring a rewind backup.
+type RewindRestore struct {
+	What     string      `json:"what"`
+	Time     time.Time   `json:"time"`
+	RewindTo uint64      `json:"rewindTo"`
+	Head     common.Hash `json:"head"`
+	Headers  int         `json:"headers"`
+}
+
+// restoreRewind writes back the fast headers and the chain config saved before
+// the last config-driven rewind, all in a single batch along with the removal
+// of the backup. The node has to be restarted with the previous config for the
+// restored chain to be loaded, otherwise it is rewound again.
+func restoreRewind(db etruedb.Database) (*RewindRestore, error) {
+	enc, err := db.Get(rewindBackupKey)
+	if err != nil || len(enc) == 0 {
+		return nil, errNoRewindBackup
+	}
+	var backup rewindBackup
+	if err := rlp.DecodeBytes(enc, &backup); err != nil {
+		return nil, err
+	}
+	config := new(params.ChainConfig)
+	if err := json.Unmarshal(backup.Config, config); err != nil {
+		return nil, err
+	}
+	batch := db.NewBatch()
+	for _, header := range backup.Headers {
+		rawdb.WriteHeader(batch, header)
+		rawdb.WriteCanonicalHash(batch, header.Hash(), header.Number.Uint64())
+	}
+	rawdb.WriteHeadHeaderHash(batch, backup.Head)
+	rawdb.WriteChainConfig(batch, backup.Genesis, config)
+	batch.Delete(rewindBackupKey)
+	if err := batch.Write(); err != nil {
+		return nil, err
+	}
+	log.Warn("Restored chain from rewind backup, restart with the previous config", "head", backup.Head, "headers", len(backup.Headers))
+
+	return &RewindRestore{
+		What:     backup.What,
+		Time:     time.Unix(int64(backup.Time), 0),
+		RewindTo: backup.RewindTo,
+		Head:     backup.Head,
+		Headers:  len(backup.Headers),
+	}, nil
+}
@@ -0,0 +1,122 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"math/big"
+	"testing"
+
+	"truechain/discovery/core/rawdb"
+	"truechain/discovery/core/types"
+	"truechain/discovery/etruedb"
+	"truechain/discovery/params"
+)
+
+// makeRewindChain writes a canonical fast header chain of the given length into
+// db, along with the chain config stored for its genesis.
+func makeRewindChain(db etruedb.Database, n int) []*types.Header {
+	headers := make([]*types.Header, n)
+	for i := range headers {
+		headers[i] = &types.Header{
+			Number:      big.NewInt(int64(i)),
+			SnailNumber: new(big.Int),
+			Time:        big.NewInt(int64(i * 10)),
+			Extra:       []byte{},
+		}
+		if i > 0 {
+			headers[i].ParentHash = headers[i-1].Hash()
+		}
+		rawdb.WriteHeader(db, headers[i])
+		rawdb.WriteCanonicalHash(db, headers[i].Hash(), uint64(i))
+	}
+	rawdb.WriteHeadHeaderHash(db, headers[n-1].Hash())
+	rawdb.WriteChainConfig(db, headers[0].Hash(), &params.ChainConfig{ChainID: big.NewInt(1)})
+	return headers
+}
+
+// rewindChain drops the canonical headers above number like the light chain
+// does on a config-driven rewind.
+func rewindChain(db etruedb.Database, headers []*types.Header, number uint64) {
+	for _, header := range headers[number+1:] {
+		rawdb.DeleteHeader(db, header.Hash(), header.Number.Uint64())
+		rawdb.DeleteCanonicalHash(db, header.Number.Uint64())
+	}
+	rawdb.WriteHeadHeaderHash(db, headers[number].Hash())
+}
+
+// Tests that the fast headers dropped by a rewind and the replaced chain config
+// are written back by a restore.
+func TestRewindBackupRestore(t *testing.T) {
+	db := etruedb.NewMemDatabase()
+	headers := makeRewindChain(db, 10)
+	genesis := headers[0].Hash()
+
+	backupRewind(db, genesis, &params.ConfigCompatError{What: "test fork", RewindTo: 4})
+	rewindChain(db, headers, 4)
+	rawdb.WriteChainConfig(db, genesis, &params.ChainConfig{ChainID: big.NewInt(2)})
+
+	res, err := restoreRewind(db)
+	if err != nil {
+		t.Fatalf("failed to restore the backup: %v", err)
+	}
+	if res.Headers != 5 || res.RewindTo != 4 || res.What != "test fork" || res.Head != headers[9].Hash() {
+		t.Errorf("restore result mismatch: %+v", res)
+	}
+	for _, header := range headers {
+		number := header.Number.Uint64()
+		if hash := rawdb.ReadCanonicalHash(db, number); hash != header.Hash() {
+			t.Errorf("canonical hash %d mismatch: have %x, want %x", number, hash, header.Hash())
+		}
+		if rawdb.ReadHeader(db, header.Hash(), number) == nil {
+			t.Errorf("header %d missing", number)
+		}
+	}
+	if head := rawdb.ReadHeadHeaderHash(db); head != headers[9].Hash() {
+		t.Errorf("head mismatch: have %x, want %x", head, headers[9].Hash())
+	}
+	if config := rawdb.ReadChainConfig(db, genesis); config == nil || config.ChainID.Cmp(big.NewInt(1)) != 0 {
+		t.Errorf("chain config not restored: %v", config)
+	}
+	// The backup is removed along with the restore
+	if _, err := restoreRewind(db); err != errNoRewindBackup {
+		t.Errorf("second restore error mismatch: have %v, want %v", err, errNoRewindBackup)
+	}
+}
+
+// Tests that no backup is saved if nothing is dropped by the rewind or if the
+// rewind is too deep to be backed up.
+func TestRewindBackupSkipped(t *testing.T) {
+	db := etruedb.NewMemDatabase()
+	headers := makeRewindChain(db, 10)
+
+	backupRewind(db, headers[0].Hash(), &params.ConfigCompatError{RewindTo: 9})
+	if _, err := restoreRewind(db); err != errNoRewindBackup {
+		t.Errorf("rewind to the head backed up: %v", err)
+	}
+	head := &types.Header{Number: big.NewInt(maxRewindBackup + 10), SnailNumber: new(big.Int), Time: new(big.Int)}
+	rawdb.WriteHeader(db, head)
+	rawdb.WriteCanonicalHash(db, head.Hash(), head.Number.Uint64())
+	rawdb.WriteHeadHeaderHash(db, head.Hash())
+
+	backupRewind(db, headers[0].Hash(), &params.ConfigCompatError{RewindTo: 9})
+	if _, err := restoreRewind(db); err != errNoRewindBackup {
+		t.Errorf("too deep rewind backed up: %v", err)
+	}
+	if _, err := restoreRewind(etruedb.NewMemDatabase()); err != errNoRewindBackup {
+		t.Errorf("restore without backup error mismatch: have %v, want %v", err, errNoRewindBackup)
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"truechain/discovery/log"
+	"truechain/discovery/p2p/enode"
+)
+
+// peerRole restricts what a server is used for by the light client.
+type peerRole int
+
+const (
+	roleFull      peerRole = iota // used for everything
+	roleRelayOnly                 // used for transaction relay, not trusted for headers and data
+	roleSyncOnly                  // used for headers and data, no transactions are relayed to it
+)
+
+// String implements fmt.Stringer.
+func (r peerRole) String() string {
+	switch r {
+	case roleRelayOnly:
+		return "relay-only"
+	case roleSyncOnly:
+		return "sync-only"
+	default:
+		return "full"
+	}
+}
+
+// peerRoles is the set of servers with a restricted role, configured by enode.
+type peerRoles map[enode.ID]peerRole
+
+// newPeerRoles parses the enode URLs of the relay-only and sync-only servers.
+// It returns nil if no roles are configured.
+func newPeerRoles(relayOnly, syncOnly []string) peerRoles {
+	if len(relayOnly) == 0 && len(syncOnly) == 0 {
+		return nil
+	}
+	roles := make(peerRoles)
+	for role, urls := range map[peerRole][]string{roleRelayOnly: relayOnly, roleSyncOnly: syncOnly} {
+		for _, url := range urls {
+			node, err := enode.Parse(enode.ValidSchemes, url)
+			if err != nil {
+				log.Warn("Failed to parse server with restricted role", "url", url, "role", role, "err", err)
+				continue
+			}
+			if prev, ok := roles[node.ID()]; ok && prev != role {
+				log.Warn("Server configured with conflicting roles, using it fully", "id", node.ID())
+				roles[node.ID()] = roleFull
+				continue
+			}
+			roles[node.ID()] = role
+		}
+	}
+	return roles
+}
+
+// role returns the role of the given server.
+func (r peerRoles) role(id enode.ID) peerRole {
+	return r[id] // roleFull if not configured or the set is nil
+}
+
+// servesData returns whether the peer may be used for headers and data.
+func (p *peer) servesData() bool {
+	return p.role != roleRelayOnly
+}
+
+// relaysTxs returns whether transactions may be relayed to the peer.
+func (p *peer) relaysTxs() bool {
+	return p.role != roleSyncOnly
+}
@@ -0,0 +1,125 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"context"
+	"runtime/pprof"
+	"sort"
+	"sync"
+	"time"
+
+	"truechain/discovery/common"
+	"truechain/discovery/log"
+)
+
+// leakCheckTimeout is the time given to the les goroutines to exit after Stop
+// before the ones still running are reported as leaked.
+const leakCheckTimeout = 3 * time.Second
+
+// routines tracks the long-lived goroutines of the les subsystems.
+var routines = &routineSet{running: make(map[*routine]struct{})}
+
+// routine is a long-lived goroutine started with goLabeled. Its goroutines carry
+// the pprof label "les" with the routine name, so they can be told apart in
+// goroutine profiles.
+type routine struct {
+	name    string
+	started time.Time
+
+	lock  sync.Mutex
+	state string
+	since time.Time
+}
+
+// setState records what the routine is currently doing.
+func (r *routine) setState(state string) {
+	r.lock.Lock()
+	r.state, r.since = state, time.Now()
+	r.lock.Unlock()
+}
+
+// routineSet is the set of currently running routines.
+type routineSet struct {
+	lock    sync.Mutex
+	running map[*routine]struct{}
+}
+
+// goLabeled starts fn in a new labeled goroutine tracked until fn returns.
+func goLabeled(name string, fn func(r *routine)) {
+	r := &routine{name: name, started: time.Now(), state: "running"}
+	r.since = r.started
+
+	routines.lock.Lock()
+	routines.running[r] = struct{}{}
+	routines.lock.Unlock()
+
+	go pprof.Do(context.Background(), pprof.Labels("les", name), func(context.Context) {
+		defer func() {
+			routines.lock.Lock()
+			delete(routines.running, r)
+			routines.lock.Unlock()
+		}()
+		fn(r)
+	})
+}
+
+// RoutineInfo is the state of a running les goroutine.
+type RoutineInfo struct {
+	Name    string    `json:"name"`
+	State   string    `json:"state"`
+	Started time.Time `json:"started"`
+	Since   time.Time `json:"since"` // time the current state was entered
+}
+
+// list returns the running routines, oldest first.
+func (s *routineSet) list() []RoutineInfo {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	list := make([]RoutineInfo, 0, len(s.running))
+	for r := range s.running {
+		r.lock.Lock()
+		list = append(list, RoutineInfo{Name: r.name, State: r.state, Started: r.started, Since: r.since})
+		r.lock.Unlock()
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Started.Before(list[j].Started) })
+	return list
+}
+
+// checkLeaks waits for the running routines to exit and reports the ones still
+// running after the timeout, along with their labels and states. It returns
+// immediately unless built with the lesdebug tag.
+func (s *routineSet) checkLeaks(timeout time.Duration) []RoutineInfo {
+	if !leakCheck {
+		return nil
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		list := s.list()
+		if len(list) == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			for _, r := range list {
+				log.Error("Leaked les goroutine", "label", r.Name, "state", r.State, "age", common.PrettyDuration(time.Since(r.Started)))
+			}
+			return list
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
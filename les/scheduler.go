@@ -0,0 +1,261 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"truechain/discovery/common"
+	"truechain/discovery/core"
+	"truechain/discovery/core/types"
+	"truechain/discovery/etruedb"
+	"truechain/discovery/event"
+	"truechain/discovery/light/fast"
+	"truechain/discovery/log"
+	"truechain/discovery/rlp"
+)
+
+const (
+	scheduleChanSize    = 10
+	scheduleSendTimeout = time.Second * 10 // time limit of adding a released transaction to the pool
+)
+
+var (
+	errScheduleNoTarget = errors.New("missing block number or timestamp")
+	errScheduleKnown    = errors.New("transaction already scheduled")
+
+	// scheduledKey stores the transactions held by the scheduler, so that they
+	// are still released after a restart.
+	scheduledKey = []byte("LightScheduledTxs")
+)
+
+// ScheduledTx is a signed transaction held by the light client until the head
+// reaches the given block number and timestamp.
+type ScheduledTx struct {
+	Tx     *types.Transaction `json:"tx"`
+	Hash   common.Hash        `json:"hash"`
+	Number uint64             `json:"number"` // 0 if not set
+	Time   uint64             `json:"time"`   // 0 if not set
+}
+
+// due returns true if the head has reached the release point of the transaction.
+func (s *ScheduledTx) due(head *types.Header) bool {
+	return head.Number.Uint64() >= s.Number && head.Time.Uint64() >= s.Time
+}
+
+// scheduledTxRLP is the database encoding of a scheduled transaction.
+type scheduledTxRLP struct {
+	Tx     *types.Transaction
+	Number uint64
+	Time   uint64
+}
+
+// txScheduler holds signed transactions until their release point and relays
+// them through the light transaction pool, which tracks their inclusion.
+type txScheduler struct {
+	db     etruedb.Database
+	pool   *fast.TxPool
+	chain  *fast.LightChain
+	signer types.Signer
+
+	lock sync.Mutex
+	txs  map[common.Hash]*ScheduledTx
+
+	headCh chan types.FastChainHeadEvent
+	sub    event.Subscription
+	quit   chan struct{}
+	wg     *sync.WaitGroup // tracks the release loop of the light client
+}
+
+// newTxScheduler creates the transaction scheduler, loading the transactions
+// scheduled before the last shutdown.
+func newTxScheduler(db etruedb.Database, pool *fast.TxPool, chain *fast.LightChain, signer types.Signer, wg *sync.WaitGroup) *txScheduler {
+	s := &txScheduler{
+		db:     db,
+		pool:   pool,
+		chain:  chain,
+		signer: signer,
+		txs:    make(map[common.Hash]*ScheduledTx),
+		headCh: make(chan types.FastChainHeadEvent, scheduleChanSize),
+		quit:   make(chan struct{}),
+		wg:     wg,
+	}
+	if enc, err := db.Get(scheduledKey); err == nil {
+		var list []scheduledTxRLP
+		if err := rlp.DecodeBytes(enc, &list); err != nil {
+			log.Error("Failed to decode scheduled transactions", "err", err)
+		}
+		for _, stx := range list {
+			s.txs[stx.Tx.Hash()] = &ScheduledTx{Tx: stx.Tx, Hash: stx.Tx.Hash(), Number: stx.Number, Time: stx.Time}
+		}
+		if len(s.txs) > 0 {
+			log.Info("Loaded scheduled transactions", "count", len(s.txs))
+		}
+	}
+	return s
+}
+
+// start starts releasing the scheduled transactions on new heads.
+func (s *txScheduler) start() {
+	s.sub = s.chain.SubscribeChainHeadEvent(s.headCh)
+	s.wg.Add(1)
+	go s.loop()
+}
+
+// stop stops releasing transactions, the remaining ones are kept in the database.
+func (s *txScheduler) stop() {
+	s.sub.Unsubscribe()
+	close(s.quit)
+}
+
+func (s *txScheduler) loop() {
+	defer s.wg.Done()
+
+	for {
+		select {
+		case ev := <-s.headCh:
+			s.release(ev.Block.Header())
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// schedule holds a signed transaction until the head reaches the given block
+// number and timestamp, at least one of which has to be set.
+func (s *txScheduler) schedule(tx *types.Transaction, number, timestamp uint64) (*ScheduledTx, error) {
+	if number == 0 && timestamp == 0 {
+		return nil, errScheduleNoTarget
+	}
+	if _, err := types.Sender(s.signer, tx); err != nil {
+		return nil, err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	hash := tx.Hash()
+	if _, ok := s.txs[hash]; ok {
+		return nil, errScheduleKnown
+	}
+	stx := &ScheduledTx{Tx: tx, Hash: hash, Number: number, Time: timestamp}
+	s.txs[hash] = stx
+	s.store()
+
+	log.Info("Scheduled transaction", "hash", hash, "number", number, "time", timestamp)
+	return stx, nil
+}
+
+// cancel drops a scheduled transaction before its release, returning false if
+// it isn't scheduled.
+func (s *txScheduler) cancel(hash common.Hash) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.txs[hash]; !ok {
+		return false
+	}
+	delete(s.txs, hash)
+	s.store()
+	return true
+}
+
+// scheduled returns the transactions waiting for their release.
+func (s *txScheduler) scheduled() []ScheduledTx {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	list := make([]ScheduledTx, 0, len(s.txs))
+	for _, stx := range s.txs {
+		list = append(list, *stx)
+	}
+	return list
+}
+
+// release adds the transactions which became due at the given head to the
+// transaction pool. A transaction is dropped once the pool accepts it or rejects
+// it as invalid. If the pool fails to check it, e.g. because the state isn't
+// available from the network, it is kept and retried at the next head.
+func (s *txScheduler) release(head *types.Header) {
+	s.lock.Lock()
+	var due []*ScheduledTx
+	for _, stx := range s.txs {
+		if stx.due(head) {
+			due = append(due, stx)
+		}
+	}
+	s.lock.Unlock()
+
+	var done []common.Hash
+	for _, stx := range due {
+		ctx, cancel := context.WithTimeout(context.Background(), scheduleSendTimeout)
+		err := s.pool.Add(ctx, stx.Tx)
+		cancel()
+
+		switch {
+		case err == nil:
+			log.Info("Relayed scheduled transaction", "hash", stx.Hash, "number", head.Number)
+		case s.pool.GetTransaction(stx.Hash) != nil:
+			log.Debug("Scheduled transaction already pooled", "hash", stx.Hash)
+		case scheduleRejected(err):
+			log.Warn("Dropped scheduled transaction rejected by the pool", "hash", stx.Hash, "err", err)
+		default:
+			log.Warn("Failed to relay scheduled transaction, retrying", "hash", stx.Hash, "err", err)
+			continue
+		}
+		done = append(done, stx.Hash)
+	}
+	if len(done) > 0 {
+		s.lock.Lock()
+		for _, hash := range done {
+			delete(s.txs, hash)
+		}
+		s.store()
+		s.lock.Unlock()
+	}
+}
+
+// scheduleRejected returns true if the pool rejected a transaction as invalid,
+// as opposed to failing to check it or lacking room for it at the moment.
+func scheduleRejected(err error) bool {
+	switch err {
+	case core.ErrInvalidSender, core.ErrNonceTooLow, core.ErrUnderpriced, fast.ErrGasPriceTooHigh,
+		core.ErrReplaceUnderpriced, core.ErrGasLimit, core.ErrNegativeValue,
+		core.ErrInsufficientFunds, core.ErrIntrinsicGas:
+		return true
+	}
+	return false
+}
+
+// store writes the scheduled transactions into the database. The lock is
+// assumed to be held.
+func (s *txScheduler) store() {
+	list := make([]scheduledTxRLP, 0, len(s.txs))
+	for _, stx := range s.txs {
+		list = append(list, scheduledTxRLP{Tx: stx.Tx, Number: stx.Number, Time: stx.Time})
+	}
+	enc, err := rlp.EncodeToBytes(list)
+	if err != nil {
+		log.Error("Failed to encode scheduled transactions", "err", err)
+		return
+	}
+	if err := s.db.Put(scheduledKey, enc); err != nil {
+		log.Error("Failed to store scheduled transactions", "err", err)
+	}
+}
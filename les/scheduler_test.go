@@ -0,0 +1,49 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"context"
+	"testing"
+
+	"truechain/discovery/core"
+	"truechain/discovery/light/fast"
+)
+
+// Tests that only the pool's verdicts on a transaction drop it from the
+// scheduler, failures to check it are retried.
+func TestScheduleRejected(t *testing.T) {
+	tests := []struct {
+		err      error
+		rejected bool
+	}{
+		{core.ErrNonceTooLow, true},
+		{core.ErrUnderpriced, true},
+		{fast.ErrGasPriceTooHigh, true},
+		{core.ErrReplaceUnderpriced, true},
+		{core.ErrInsufficientFunds, true},
+		{context.DeadlineExceeded, false},
+		{fast.ErrNoPeers, false},
+		{fast.ErrAccountLimitExceeded, false},
+		{fast.ErrTxPoolFull, false},
+	}
+	for _, tt := range tests {
+		if rejected := scheduleRejected(tt.err); rejected != tt.rejected {
+			t.Errorf("%v: rejected mismatch: have %v, want %v", tt.err, rejected, tt.rejected)
+		}
+	}
+}
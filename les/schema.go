@@ -0,0 +1,109 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"math/big"
+
+	"truechain/discovery/core/types"
+	"truechain/discovery/params"
+	"truechain/discovery/rlp"
+)
+
+// schema is the encoding of a chain object from a fork on. Objects received
+// by the ODR are decoded by the schema active at their block number, so a fork
+// changing the header or receipt fields (new committee fields for instance)
+// only needs a new schema entry and old clients keep decoding the blocks before
+// it while syncing.
+type schema struct {
+	fork   string
+	active func(config *params.ChainConfig, number *big.Int) bool // nil if active since genesis
+	decode func(enc []byte) (interface{}, error)
+}
+
+// schemaSet is the list of schemas of a chain object in fork order.
+type schemaSet []schema
+
+// decode decodes the object at the given block number with the latest schema
+// active at that number. Without a chain config only the genesis schema is
+// considered.
+func (s schemaSet) decode(config *params.ChainConfig, number uint64, enc []byte) (interface{}, error) {
+	num := new(big.Int).SetUint64(number)
+	for i := len(s) - 1; i >= 0; i-- {
+		if s[i].active == nil || (config != nil && s[i].active(config, num)) {
+			return s[i].decode(enc)
+		}
+	}
+	return nil, errUnknownSchema
+}
+
+// bodySchemas lists the encodings of the fast block bodies, activated by fast
+// block number.
+var bodySchemas = schemaSet{
+	{fork: "genesis", decode: func(enc []byte) (interface{}, error) {
+		body := new(types.Body)
+		err := rlp.DecodeBytes(enc, body)
+		return body, err
+	}},
+}
+
+// receiptSchemas lists the encodings of the fast block receipts, activated by
+// fast block number.
+var receiptSchemas = schemaSet{
+	{fork: "genesis", decode: func(enc []byte) (interface{}, error) {
+		var receipts types.Receipts
+		err := rlp.DecodeBytes(enc, &receipts)
+		return receipts, err
+	}},
+}
+
+// snailHeaderSchemas lists the encodings of the snail headers, activated by
+// snail block number.
+var snailHeaderSchemas = schemaSet{
+	{fork: "genesis", decode: func(enc []byte) (interface{}, error) {
+		header := new(types.SnailHeader)
+		err := rlp.DecodeBytes(enc, header)
+		return header, err
+	}},
+}
+
+// decodeBody decodes the body of the fast block with the given number.
+func decodeBody(config *params.ChainConfig, number uint64, enc []byte) (*types.Body, error) {
+	body, err := bodySchemas.decode(config, number, enc)
+	if err != nil {
+		return nil, err
+	}
+	return body.(*types.Body), nil
+}
+
+// decodeReceipts decodes the receipts of the fast block with the given number.
+func decodeReceipts(config *params.ChainConfig, number uint64, enc []byte) (types.Receipts, error) {
+	receipts, err := receiptSchemas.decode(config, number, enc)
+	if err != nil {
+		return nil, err
+	}
+	return receipts.(types.Receipts), nil
+}
+
+// decodeSnailHeader decodes the snail header with the given number.
+func decodeSnailHeader(config *params.ChainConfig, number uint64, enc []byte) (*types.SnailHeader, error) {
+	header, err := snailHeaderSchemas.decode(config, number, enc)
+	if err != nil {
+		return nil, err
+	}
+	return header.(*types.SnailHeader), nil
+}
@@ -0,0 +1,188 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"math/big"
+	"testing"
+
+	"truechain/discovery/common"
+	"truechain/discovery/core/types"
+	"truechain/discovery/crypto"
+	"truechain/discovery/params"
+	"truechain/discovery/rlp"
+)
+
+// testSchema returns a schema decoding every object as its fork name.
+func testSchema(fork string, active func(config *params.ChainConfig, number *big.Int) bool) schema {
+	return schema{fork: fork, active: active, decode: func(enc []byte) (interface{}, error) {
+		return fork, nil
+	}}
+}
+
+// activeFromTIP3 activates a test schema from the TIP3 fork on.
+func activeFromTIP3(config *params.ChainConfig, number *big.Int) bool {
+	return config.TIP3 != nil && number.Cmp(config.TIP3.FastNumber) >= 0
+}
+
+// Tests that objects are decoded by the latest schema active at their block.
+func TestSchemaSetDecode(t *testing.T) {
+	config := &params.ChainConfig{TIP3: &params.BlockConfig{FastNumber: big.NewInt(100)}}
+
+	tests := []struct {
+		set    schemaSet
+		config *params.ChainConfig
+		number uint64
+		fork   string
+		err    error
+	}{
+		// Before the fork and without a chain config the genesis schema is used
+		{schemaSet{testSchema("genesis", nil), testSchema("tip3", activeFromTIP3)}, config, 0, "genesis", nil},
+		{schemaSet{testSchema("genesis", nil), testSchema("tip3", activeFromTIP3)}, config, 99, "genesis", nil},
+		{schemaSet{testSchema("genesis", nil), testSchema("tip3", activeFromTIP3)}, nil, 200, "genesis", nil},
+		{schemaSet{testSchema("genesis", nil), testSchema("tip3", activeFromTIP3)}, &params.ChainConfig{}, 200, "genesis", nil},
+
+		// From the fork on its schema is used
+		{schemaSet{testSchema("genesis", nil), testSchema("tip3", activeFromTIP3)}, config, 100, "tip3", nil},
+		{schemaSet{testSchema("genesis", nil), testSchema("tip3", activeFromTIP3)}, config, 1000, "tip3", nil},
+
+		// Without a schema active at the block the object can't be decoded
+		{schemaSet{testSchema("tip3", activeFromTIP3)}, config, 99, "", errUnknownSchema},
+		{schemaSet{testSchema("tip3", activeFromTIP3)}, nil, 100, "", errUnknownSchema},
+		{schemaSet{}, config, 0, "", errUnknownSchema},
+	}
+	for i, tt := range tests {
+		obj, err := tt.set.decode(tt.config, tt.number, nil)
+		if err != tt.err {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+			continue
+		}
+		if err == nil && obj.(string) != tt.fork {
+			t.Errorf("test %d: schema mismatch: have %s, want %s", i, obj, tt.fork)
+		}
+	}
+}
+
+// Tests that receipts survive an encoding round trip through their schema and
+// that malformed encodings are rejected.
+func TestDecodeReceipts(t *testing.T) {
+	receipt := types.NewReceipt(nil, false, 21000)
+	receipt.Logs = []*types.Log{{Address: common.Address{1}, Topics: []common.Hash{{2}}, Data: []byte{3}}}
+	receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+
+	enc, err := rlp.EncodeToBytes(types.Receipts{receipt, types.NewReceipt(nil, true, 42000)})
+	if err != nil {
+		t.Fatalf("failed to encode receipts: %v", err)
+	}
+	receipts, err := decodeReceipts(params.TestChainConfig, 1, enc)
+	if err != nil {
+		t.Fatalf("failed to decode receipts: %v", err)
+	}
+	if len(receipts) != 2 {
+		t.Fatalf("receipt count mismatch: have %d, want 2", len(receipts))
+	}
+	if receipts[0].Status != types.ReceiptStatusSuccessful || receipts[1].Status != types.ReceiptStatusFailed {
+		t.Errorf("status mismatch: have %d and %d", receipts[0].Status, receipts[1].Status)
+	}
+	if receipts[0].CumulativeGasUsed != 21000 || receipts[1].CumulativeGasUsed != 42000 {
+		t.Errorf("cumulative gas mismatch: have %d and %d", receipts[0].CumulativeGasUsed, receipts[1].CumulativeGasUsed)
+	}
+	if len(receipts[0].Logs) != 1 || receipts[0].Logs[0].Address != (common.Address{1}) || receipts[0].Bloom != receipt.Bloom {
+		t.Errorf("logs mismatch: have %v", receipts[0].Logs)
+	}
+	if _, err := decodeReceipts(params.TestChainConfig, 1, enc[:len(enc)-1]); err == nil {
+		t.Error("truncated receipts decoded")
+	}
+}
+
+// Tests that snail headers survive an encoding round trip through their schema
+// and that malformed encodings are rejected.
+func TestDecodeSnailHeader(t *testing.T) {
+	header := &types.SnailHeader{
+		ParentHash:      common.Hash{1},
+		PointerNumber:   big.NewInt(2),
+		FastNumber:      big.NewInt(3),
+		Difficulty:      big.NewInt(4),
+		FruitDifficulty: big.NewInt(5),
+		Number:          big.NewInt(6),
+		Publickey:       []byte{7},
+		Time:            big.NewInt(8),
+		Extra:           []byte{9},
+	}
+	enc, err := rlp.EncodeToBytes(header)
+	if err != nil {
+		t.Fatalf("failed to encode header: %v", err)
+	}
+	dec, err := decodeSnailHeader(params.TestChainConfig, 6, enc)
+	if err != nil {
+		t.Fatalf("failed to decode header: %v", err)
+	}
+	if dec.Hash() != header.Hash() {
+		t.Errorf("header hash mismatch: have %x, want %x", dec.Hash(), header.Hash())
+	}
+	if _, err := decodeSnailHeader(params.TestChainConfig, 6, enc[:len(enc)-1]); err == nil {
+		t.Error("truncated header decoded")
+	}
+	if _, err := decodeSnailHeader(nil, 6, []byte{0x01}); err == nil {
+		t.Error("malformed header decoded")
+	}
+}
+
+// Tests that fast block bodies survive an encoding round trip through their
+// schema and that malformed encodings are rejected.
+func TestDecodeBody(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	signer := types.NewTIP1Signer(params.TestChainConfig.ChainID)
+
+	var txs []*types.Transaction
+	for i := 0; i < 3; i++ {
+		tx, err := types.SignTx(types.NewTransaction(uint64(i), common.Address{1}, big.NewInt(100), 21000, big.NewInt(1), nil), signer, key)
+		if err != nil {
+			t.Fatalf("failed to sign transaction: %v", err)
+		}
+		txs = append(txs, tx)
+	}
+	body := &types.Body{
+		Transactions: txs,
+		Signs:        []*types.PbftSign{{FastHeight: big.NewInt(1), FastHash: common.Hash{2}, Result: 1, Sign: []byte{3}}},
+	}
+	enc, err := rlp.EncodeToBytes(body)
+	if err != nil {
+		t.Fatalf("failed to encode body: %v", err)
+	}
+	dec, err := decodeBody(params.TestChainConfig, 1, enc)
+	if err != nil {
+		t.Fatalf("failed to decode body: %v", err)
+	}
+	if len(dec.Transactions) != len(txs) {
+		t.Fatalf("transaction count mismatch: have %d, want %d", len(dec.Transactions), len(txs))
+	}
+	for i, tx := range dec.Transactions {
+		if tx.Hash() != txs[i].Hash() {
+			t.Errorf("transaction %d hash mismatch: have %x, want %x", i, tx.Hash(), txs[i].Hash())
+		}
+	}
+	if len(dec.Signs) != 1 || dec.Signs[0].FastHash != (common.Hash{2}) {
+		t.Errorf("signs mismatch: have %v", dec.Signs)
+	}
+	if _, err := decodeBody(params.TestChainConfig, 1, enc[:len(enc)-1]); err == nil {
+		t.Error("truncated body decoded")
+	}
+	if _, err := decodeBody(nil, 1, []byte{0xc1, 0x01}); err == nil {
+		t.Error("malformed body decoded")
+	}
+}
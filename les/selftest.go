@@ -0,0 +1,116 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"truechain/discovery/common"
+	"truechain/discovery/core/types"
+	"truechain/discovery/crypto"
+	"truechain/discovery/light"
+	"truechain/discovery/light/fast"
+)
+
+// selfTestTimeout is the time a server is given to answer a single request of
+// the conformance self-test.
+const selfTestTimeout = time.Second * 5
+
+const (
+	selfTestOK          = "ok"
+	selfTestUnavailable = "unavailable" // server does not announce the tested data
+)
+
+// selfTestCase is a single request/response round trip of the conformance
+// self-test, built from the current local heads.
+type selfTestCase struct {
+	name string
+	req  func(fhead *types.Header, shead *types.SnailHeader) LesOdrRequest
+}
+
+var selfTestCases = []selfTestCase{
+	{"FastBlockBodies", func(fhead *types.Header, shead *types.SnailHeader) LesOdrRequest {
+		return (*FastBlockRequest)(&fast.BlockRequest{Hash: fhead.Hash(), Number: fhead.Number.Uint64()})
+	}},
+	{"Receipts", func(fhead *types.Header, shead *types.SnailHeader) LesOdrRequest {
+		return (*ReceiptsRequest)(&fast.ReceiptsRequest{Hash: fhead.Hash(), Number: fhead.Number.Uint64(), Header: fhead})
+	}},
+	{"ProofsV2", func(fhead *types.Header, shead *types.SnailHeader) LesOdrRequest {
+		return (*TrieRequest)(&fast.TrieRequest{Id: fast.StateTrieID(fhead), Key: crypto.Keccak256(common.Address{}.Bytes())})
+	}},
+	{"SnailBlockBodies", func(fhead *types.Header, shead *types.SnailHeader) LesOdrRequest {
+		return (*BlockRequest)(&light.BlockRequest{Hash: shead.Hash(), Number: shead.Number.Uint64()})
+	}},
+	{"TxStatus", func(fhead *types.Header, shead *types.SnailHeader) LesOdrRequest {
+		return (*TxStatusRequest)(&fast.TxStatusRequest{Hashes: []common.Hash{{}}})
+	}},
+}
+
+// SelfTestResult reports which message types a server answered correctly
+// during the conformance self-test.
+type SelfTestResult struct {
+	Server  string            `json:"server"`
+	Version int               `json:"version"`
+	Results map[string]string `json:"results"`
+}
+
+// selfTest runs the conformance self-test suite against every connected server.
+func (s *LightEtrue) selfTest(ctx context.Context) []*SelfTestResult {
+	var (
+		fhead   = s.fblockchain.CurrentHeader()
+		shead   = s.blockchain.CurrentHeader()
+		peers   = s.peers.AllPeers()
+		results = make([]*SelfTestResult, len(peers))
+		wg      sync.WaitGroup
+	)
+	for i, p := range peers {
+		wg.Add(1)
+		go func(i int, p *peer) {
+			defer wg.Done()
+			results[i] = s.selfTestPeer(ctx, p, fhead, shead)
+		}(i, p)
+	}
+	wg.Wait()
+	return results
+}
+
+// selfTestPeer runs the conformance self-test suite against a single server.
+func (s *LightEtrue) selfTestPeer(ctx context.Context, p *peer, fhead *types.Header, shead *types.SnailHeader) *SelfTestResult {
+	res := &SelfTestResult{
+		Server:  p.id,
+		Version: p.version,
+		Results: make(map[string]string),
+	}
+	for _, tc := range selfTestCases {
+		req := tc.req(fhead, shead)
+		if !req.CanSend(p) {
+			res.Results[tc.name] = selfTestUnavailable
+			continue
+		}
+		tctx, cancel := context.WithTimeout(ctx, selfTestTimeout)
+		err := s.odr.retrieveFrom(tctx, req, p)
+		cancel()
+		if err != nil {
+			res.Results[tc.name] = err.Error()
+		} else {
+			res.Results[tc.name] = selfTestOK
+		}
+	}
+	return res
+}
@@ -20,6 +20,7 @@ import (
 	"crypto/ecdsa"
 	"math/big"
 	"sync"
+	"sync/atomic"
 	"time"
 	"truechain/discovery/accounts/abi/bind"
 	"truechain/discovery/common/mclock"
@@ -29,6 +30,7 @@ import (
 	"truechain/discovery/params"
 	"truechain/discovery/rpc"
 
+	"github.com/hashicorp/golang-lru"
 	"truechain/discovery/common"
 	"truechain/discovery/core"
 	"truechain/discovery/core/snailchain/rawdb"
@@ -62,12 +64,19 @@ type LesServer struct {
 	maxPeers                                int
 	minCapacity, maxCapacity, freeClientCap uint64
 	clientPool                              *clientPool
+
+	drainUntil int64 // mclock.AbsTime until the server is draining, accessed atomically
+
+	blockFilters bool       // Flag whether compact block filters are served
+	filterCache  *lru.Cache // Cache of recently served block filters
+
+	extensions map[string]Extension // Registered protocol extensions by name
 }
 
 func NewLesServer(etrue *etrue.Truechain, config *etrue.Config) (*LesServer, error) {
-	lesTopics := make([]discv5.Topic, len(AdvertiseProtocolVersions))
-	for i, pv := range AdvertiseProtocolVersions {
-		lesTopics[i] = lesTopic(etrue.SnailBlockChain().Genesis().Hash(), pv)
+	var topics []discv5.Topic
+	if !config.LightNoAdvertise {
+		topics = lesTopics(config, etrue.SnailBlockChain().Genesis().Hash(), AdvertiseProtocolVersions)
 	}
 	quitSync := make(chan struct{})
 	srv := &LesServer{
@@ -80,8 +89,12 @@ func NewLesServer(etrue *etrue.Truechain, config *etrue.Config) (*LesServer, err
 		},
 		archiveMode:  etrue.ArchiveMode(),
 		quitSync:     quitSync,
-		lesTopics:    lesTopics,
+		lesTopics:    topics,
 		onlyAnnounce: false,
+		blockFilters: config.LightServeFilters,
+	}
+	if srv.blockFilters {
+		srv.filterCache, _ = lru.New(blockFilterCacheLimit)
 	}
 	srv.costTracker, srv.minCapacity = newCostTracker(etrue.ChainDb(), config)
 
@@ -101,12 +114,28 @@ func NewLesServer(etrue *etrue.Truechain, config *etrue.Config) (*LesServer, err
 
 	srv.chtIndexer.Start(etrue.SnailBlockChain())
 
-	registrar := newCheckpointOracle(nil, srv.getLocalCheckpoint)
-	// TODO(rjl493456442) Checkpoint is useless for les server, separate handler for client and server.
-	pm, err := NewProtocolManager(etrue.BlockChain().Config(), nil, public.DefaultServerIndexerConfig, nil, 0, false, config.NetworkId, etrue.EventMux(), etrue.Engine(), newPeerSet(), etrue.BlockChain(), etrue.SnailBlockChain(), etrue.TxPool(), etrue.ChainDb(), nil, nil, registrar, quitSync, new(sync.WaitGroup), nil, etrue.Synced)
-	if err != nil {
-		return nil, err
+	registrar := newCheckpointOracle(checkpointOracleConfig(config, etrue.SnailBlockChain().Genesis().Hash()), srv.getLocalCheckpoint)
+	if registrar != nil {
+		registrar.bloomSections = func() uint64 {
+			sections, _, _ := srv.bloomTrieIndexer.Sections()
+			return sections
+		}
 	}
+	pm := newProtocolManager(&handlerConfig{
+		ChainConfig:   etrue.BlockChain().Config(),
+		IndexerConfig: public.DefaultServerIndexerConfig,
+		NetworkId:     config.NetworkId,
+		EventMux:      etrue.EventMux(),
+		Peers:         newPeerSet(),
+		FastChain:     etrue.BlockChain(),
+		SnailChain:    etrue.SnailBlockChain(),
+		ChainDb:       etrue.ChainDb(),
+		Registrar:     registrar,
+		QuitSync:      quitSync,
+		Wg:            new(sync.WaitGroup),
+		TxPool:        etrue.TxPool(),
+		Synced:        etrue.Synced,
+	})
 	srv.protocolManager = pm
 	pm.servingQueue = newServingQueue(int64(time.Millisecond*10), float64(config.LightServ)/100)
 	pm.server = srv
@@ -150,9 +179,41 @@ func (s *LesServer) APIs() []rpc.API {
 			Service:   NewPrivateLightAPI(&s.lesCommons, s.protocolManager.reg),
 			Public:    false,
 		},
+		{
+			Namespace: "les",
+			Version:   "1.0",
+			Service:   NewPrivateLightServerAPI(s),
+			Public:    false,
+		},
 	}
 }
 
+// Drain announces to all connected clients that the server is going under
+// maintenance for the given duration. Clients move their requests to other
+// servers and avoid redialing this one until the period is over, while new
+// client connections are rejected in the meantime.
+func (s *LesServer) Drain(duration time.Duration) {
+	atomic.StoreInt64(&s.drainUntil, int64(mclock.Now()+mclock.AbsTime(duration)))
+
+	var kvList keyValueList
+	kvList = kvList.add("serverDraining", uint64(duration/time.Second))
+	announce := announceData{Update: kvList}
+	for _, p := range s.protocolManager.peers.AllPeers() {
+		p := p
+		p.queueSend(func() { p.SendAnnounce(announce) })
+	}
+	log.Info("Draining light server", "duration", duration, "peers", s.protocolManager.peers.Len())
+}
+
+// isDraining returns true if the server is in a maintenance period announced
+// by Drain.
+func (s *LesServer) isDraining() bool {
+	if s == nil {
+		return false
+	}
+	return mclock.AbsTime(atomic.LoadInt64(&s.drainUntil)) > mclock.Now()
+}
+
 // startEventLoop starts an event handler loop that updates the recharge curve of
 // the client manager and adjusts the client pool's size according to the total
 // capacity updates coming from the client manager
@@ -222,14 +283,29 @@ func (s *LesServer) Start(srvr *p2p.Server) {
 	totalRecharge := s.costTracker.totalRecharge()
 	if s.maxPeers > 0 {
 		s.freeClientCap = s.minCapacity //totalRecharge / uint64(s.maxPeers)
+		if s.config.LightRecharge != 0 {
+			s.freeClientCap = s.config.LightRecharge
+		}
 		if s.freeClientCap < s.minCapacity {
+			log.Warn("Configured LES recharge rate too low, raised to minimum", "configured", s.freeClientCap, "minimum", s.minCapacity)
 			s.freeClientCap = s.minCapacity
 		}
 		if s.freeClientCap > 0 {
+			bufLimit := s.freeClientCap * bufLimitRatio
+			if s.config.LightBufLimit != 0 {
+				// The most expensive request has to fit in the buffer, see newCostTracker
+				if min := s.minCapacity * bufLimitRatio; s.config.LightBufLimit < min {
+					log.Warn("Configured LES buffer limit too low, raised to minimum", "configured", s.config.LightBufLimit, "minimum", min)
+					bufLimit = min
+				} else {
+					bufLimit = s.config.LightBufLimit
+				}
+			}
 			s.defParams = flowcontrol.ServerParams{
-				BufLimit:    s.freeClientCap * bufLimitRatio,
+				BufLimit:    bufLimit,
 				MinRecharge: s.freeClientCap,
 			}
+			log.Info("LES client flow control", "bufLimit", bufLimit, "recharge", s.freeClientCap)
 		}
 	}
 
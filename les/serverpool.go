@@ -23,12 +23,14 @@ import (
 	"math"
 	"math/rand"
 	"net"
+	"sort"
 	"strconv"
 	"sync"
 	"time"
 	"truechain/discovery/crypto"
 
 	"truechain/discovery/common/mclock"
+	"truechain/discovery/core/rawdb"
 	"truechain/discovery/etruedb"
 	"truechain/discovery/log"
 	"truechain/discovery/p2p"
@@ -46,6 +48,8 @@ const (
 	shortRetryCnt   = 5
 	shortRetryDelay = time.Second * 5
 	longRetryDelay  = time.Minute * 10
+	// a server proven to serve invalid data isn't redialed for invalidDataPenalty
+	invalidDataPenalty = time.Hour
 	// maxNewEntries is the maximum number of newly discovered (never connected) nodes.
 	// If the limit is reached, the least recently discovered one is thrown out.
 	maxNewEntries = 1000
@@ -86,8 +90,21 @@ const (
 	// initStatsWeight is used to initialize previously unknown peers with good
 	// statistics to give a chance to prove themselves
 	initStatsWeight = 1
+	// onion service servers are reached through Tor which adds seconds of latency
+	// to every round trip, so they get a longer dial timeout and are scored by
+	// more tolerant time constants than servers dialed directly
+	onionDialTimeout     = time.Minute * 2
+	onionResponseScoreTC = time.Second
+	onionDelayScoreTC    = time.Second * 15
+	// the known nodes and their statistics are saved periodically so that they
+	// survive an unclean shutdown too
+	saveNodesInterval = time.Minute * 5
 )
 
+// legacyServerPoolPrefix + topic is where the known nodes were stored before
+// they got their own table, they are moved on the first start.
+var legacyServerPoolPrefix = []byte("serverPool/")
+
 // connReq represents a request for peer connection.
 type connReq struct {
 	p      *peer
@@ -104,8 +121,10 @@ type disconnReq struct {
 
 // registerReq represents a request for peer registration.
 type registerReq struct {
-	entry *poolEntry
-	done  chan struct{}
+	entry       *poolEntry
+	capacity    uint64 // capacity assigned by the server
+	free, total uint64 // capacity announced by the server, total is 0 if not announced
+	done        chan struct{}
 }
 
 // serverPool implements a pool for storing and selecting newly discovered and already
@@ -113,20 +132,22 @@ type registerReq struct {
 // known nodes and takes care of always having enough good quality servers connected.
 type serverPool struct {
 	db     etruedb.Database
-	dbKey  []byte
 	server *p2p.Server
 	quit   chan struct{}
 	wg     *sync.WaitGroup
 	connWg sync.WaitGroup
 
-	topic discv5.Topic
+	topic  discv5.Topic   // first topic, identifies the known nodes in the database
+	topics []discv5.Topic // topics searched for servers
 
 	discSetPeriod chan time.Duration
 	discNodes     chan *enode.Node
 	discLookups   chan bool
 
+	trustedLock          sync.RWMutex // protects trustedNodes, which can be changed at runtime
 	trustedNodes         map[enode.ID]*enode.Node
 	entries              map[enode.ID]*poolEntry
+	diversity            *peerDiversity // nil if servers are not limited per network group
 	timeout, enableRetry chan *poolEntry
 	adjustStats          chan poolStatAdjust
 
@@ -137,6 +158,13 @@ type serverPool struct {
 	connCh                     chan *connReq
 	disconnCh                  chan *disconnReq
 	registerCh                 chan *registerReq
+	statsCh                    chan chan []ServerStats
+	knownCh                    chan chan []KnownServer
+
+	clock          mclock.Clock // replaced by a simulated clock in tests
+	scorer         ServerScorer
+	bestCapacity   uint64  // highest capacity assigned by a server
+	bestThroughput float64 // highest number of requests per second served by a server
 }
 
 // newServerPool creates a new serverPool instance
@@ -152,10 +180,14 @@ func newServerPool(db etruedb.Database, quit chan struct{}, wg *sync.WaitGroup,
 		connCh:       make(chan *connReq),
 		disconnCh:    make(chan *disconnReq),
 		registerCh:   make(chan *registerReq),
+		statsCh:      make(chan chan []ServerStats),
+		knownCh:      make(chan chan []KnownServer),
 		knownSelect:  newWeightedRandomSelect(),
 		newSelect:    newWeightedRandomSelect(),
 		fastDiscover: true,
 		trustedNodes: parseTrustedNodes(trustedNodes),
+		clock:        mclock.System{},
+		scorer:       DefaultServerScorer{},
 	}
 
 	pool.knownQueue = newPoolEntryQueue(maxKnownEntries, pool.removeEntry)
@@ -163,10 +195,9 @@ func newServerPool(db etruedb.Database, quit chan struct{}, wg *sync.WaitGroup,
 	return pool
 }
 
-func (pool *serverPool) start(server *p2p.Server, topic discv5.Topic) {
+func (pool *serverPool) start(server *p2p.Server, topics []discv5.Topic) {
 	pool.server = server
-	pool.topic = topic
-	pool.dbKey = append([]byte("serverPool/"), []byte(topic)...)
+	pool.topic, pool.topics = topics[0], topics
 	pool.wg.Add(1)
 	pool.loadNodes()
 	pool.connectToTrustedNodes()
@@ -176,17 +207,40 @@ func (pool *serverPool) start(server *p2p.Server, topic discv5.Topic) {
 		pool.discNodes = make(chan *enode.Node, 100)
 		pool.discLookups = make(chan bool, 100)
 		log.Info("serverPool start")
-		go pool.discoverNodes()
+		goLabeled("discovery", func(*routine) { pool.discoverNodes() })
 	}
 	pool.checkDial()
-	go pool.eventLoop()
+	goLabeled("serverPool", func(*routine) { pool.eventLoop() })
 }
 
-// discoverNodes wraps SearchTopic, converting result nodes to enode.Node.
+// discoverNodes wraps SearchTopic of every topic, converting result nodes to
+// enode.Node. The search period set by the pool applies to all topics.
 func (pool *serverPool) discoverNodes() {
-	ch := make(chan *discv5.Node)
+	var (
+		ch      = make(chan *discv5.Node)
+		periods = make([]chan time.Duration, len(pool.topics))
+		wg      sync.WaitGroup
+	)
+	for i, topic := range pool.topics {
+		periods[i] = make(chan time.Duration, 1)
+		wg.Add(1)
+		go func(topic discv5.Topic, period chan time.Duration) {
+			defer wg.Done()
+			pool.server.DiscV5.SearchTopic(topic, period, ch, pool.discLookups)
+		}(topic, periods[i])
+	}
+	go func() {
+		for period := range pool.discSetPeriod {
+			for _, p := range periods {
+				p <- period
+			}
+		}
+		for _, p := range periods {
+			close(p)
+		}
+	}()
 	go func() {
-		pool.server.DiscV5.SearchTopic(pool.topic, pool.discSetPeriod, ch, pool.discLookups)
+		wg.Wait()
 		close(ch)
 	}()
 	for n := range ch {
@@ -217,7 +271,13 @@ func (pool *serverPool) connect(p *peer, node *enode.Node) *poolEntry {
 // registered should be called after a successful handshake
 func (pool *serverPool) registered(entry *poolEntry) {
 	log.Debug("Registered new entry", "enode", entry.node.ID())
-	req := &registerReq{entry: entry, done: make(chan struct{})}
+	req := &registerReq{
+		entry:    entry,
+		capacity: entry.peer.fcParams.MinRecharge,
+		free:     entry.peer.freeCapacity,
+		total:    entry.peer.totalCapacity,
+		done:     make(chan struct{}),
+	}
 	select {
 	case pool.registerCh <- req:
 	case <-pool.quit:
@@ -248,6 +308,8 @@ const (
 	pseBlockDelay = iota
 	pseResponseTime
 	pseResponseTimeout
+	pseDraining
+	pseInvalidData
 )
 
 // poolStatAdjust records are sent to adjust peer block delay/response time statistics
@@ -277,6 +339,25 @@ func (pool *serverPool) adjustResponseTime(entry *poolEntry, time time.Duration,
 	}
 }
 
+// adjustDraining records that a server has announced to be draining for the
+// given duration. The node is not redialed before the draining period is over.
+func (pool *serverPool) adjustDraining(entry *poolEntry, time time.Duration) {
+	if entry == nil {
+		return
+	}
+	pool.adjustStats <- poolStatAdjust{pseDraining, entry, time}
+}
+
+// adjustInvalidData records that a server has served data proven invalid against
+// a header, e.g. receipts not matching its receipt root. It counts as a timeout
+// and the node is not redialed before invalidDataPenalty is over.
+func (pool *serverPool) adjustInvalidData(entry *poolEntry) {
+	if entry == nil {
+		return
+	}
+	pool.adjustStats <- poolStatAdjust{pseInvalidData, entry, invalidDataPenalty}
+}
+
 // eventLoop handles pool events and mutex locking for all internal functions
 func (pool *serverPool) eventLoop() {
 	lookupCnt := 0
@@ -284,6 +365,7 @@ func (pool *serverPool) eventLoop() {
 	if pool.discSetPeriod != nil {
 		pool.discSetPeriod <- time.Millisecond * 100
 	}
+	saveNodes := pool.clock.After(saveNodesInterval)
 
 	// disconnect updates service quality statistics depending on the connection time
 	// and disconnection initiator.
@@ -291,16 +373,23 @@ func (pool *serverPool) eventLoop() {
 		// Handle peer disconnection requests.
 		entry := req.entry
 		if entry.state == psRegistered {
-			connAdjust := float64(mclock.Now()-entry.regTime) / float64(targetConnTime)
+			if connected := time.Duration(pool.clock.Now() - entry.regTime); connected > 0 {
+				entry.throughput = float64(entry.served-entry.servedAtReg) / connected.Seconds()
+				if entry.throughput > pool.bestThroughput {
+					pool.bestThroughput = entry.throughput
+				}
+			}
+			connAdjust := float64(pool.clock.Now()-entry.regTime) / float64(targetConnTime)
 			if connAdjust > 1 {
 				connAdjust = 1
 			}
-			if stopped {
-				// disconnect requested by ourselves.
-				entry.connectStats.add(1, connAdjust)
+			if stopped || entry.drainUntil > pool.clock.Now() {
+				// disconnect requested by ourselves or announced in advance
+				// by a draining server.
+				entry.connectStats.add(1, connAdjust, pool.clock.Now())
 			} else {
 				// disconnect requested by server side.
-				entry.connectStats.add(connAdjust, 1)
+				entry.connectStats.add(connAdjust, 1, pool.clock.Now())
 			}
 		}
 		entry.state = psNotConnected
@@ -310,6 +399,7 @@ func (pool *serverPool) eventLoop() {
 		} else {
 			pool.newSelected--
 		}
+		pool.leaveGroup(entry)
 		pool.setRetryDial(entry)
 		pool.connWg.Done()
 		close(req.done)
@@ -331,16 +421,24 @@ func (pool *serverPool) eventLoop() {
 		case adj := <-pool.adjustStats:
 			switch adj.adjustType {
 			case pseBlockDelay:
-				adj.entry.delayStats.add(float64(adj.time), 1)
+				adj.entry.delayStats.add(float64(adj.time), 1, pool.clock.Now())
 			case pseResponseTime:
-				adj.entry.responseStats.add(float64(adj.time), 1)
-				adj.entry.timeoutStats.add(0, 1)
+				adj.entry.responseStats.add(float64(adj.time), 1, pool.clock.Now())
+				adj.entry.timeoutStats.add(0, 1, pool.clock.Now())
+				adj.entry.served++
 			case pseResponseTimeout:
-				adj.entry.timeoutStats.add(1, 1)
+				adj.entry.timeoutStats.add(1, 1, pool.clock.Now())
+				adj.entry.timeouts++
+			case pseDraining:
+				adj.entry.drainUntil = pool.clock.Now() + mclock.AbsTime(adj.time)
+			case pseInvalidData:
+				adj.entry.timeoutStats.add(1, 1, pool.clock.Now())
+				adj.entry.timeouts++
+				adj.entry.penaltyUntil = pool.clock.Now() + mclock.AbsTime(adj.time)
 			}
 
 		case node := <-pool.discNodes:
-			if pool.trustedNodes[node.ID()] == nil {
+			if !pool.isTrusted(node.ID()) {
 				entry := pool.findOrNewNode(node)
 				pool.updateCheckDial(entry)
 			}
@@ -348,10 +446,10 @@ func (pool *serverPool) eventLoop() {
 		case conv := <-pool.discLookups:
 			if conv {
 				if lookupCnt == 0 {
-					convTime = mclock.Now()
+					convTime = pool.clock.Now()
 				}
 				lookupCnt++
-				if pool.fastDiscover && (lookupCnt == 50 || time.Duration(mclock.Now()-convTime) > time.Minute) {
+				if pool.fastDiscover && (lookupCnt == 50 || time.Duration(pool.clock.Now()-convTime) > time.Minute) {
 					pool.fastDiscover = false
 					if pool.discSetPeriod != nil {
 						pool.discSetPeriod <- time.Minute
@@ -360,7 +458,7 @@ func (pool *serverPool) eventLoop() {
 			}
 
 		case req := <-pool.connCh:
-			if pool.trustedNodes[req.p.ID()] != nil {
+			if pool.isTrusted(req.p.ID()) {
 				// ignore trusted nodes
 				req.result <- nil
 			} else {
@@ -373,13 +471,21 @@ func (pool *serverPool) eventLoop() {
 					req.result <- nil
 					continue
 				}
+				if pool.diversity.full(entry) {
+					log.Debug("Rejected server from saturated network group", "id", entry.node.ID(), "group", pool.diversity.entryGroup(entry))
+					req.result <- nil
+					continue
+				}
+				pool.diversity.join(entry)
 				pool.connWg.Add(1)
 				entry.peer = req.p
 				entry.state = psConnected
 				addr := &poolEntryAddress{
 					ip:       req.node.IP(),
+					onion:    req.node.Onion(),
 					port:     uint16(req.node.TCP()),
-					lastSeen: mclock.Now(),
+					lastSeen: pool.clock.Now(),
+					clock:    pool.clock,
 				}
 				entry.lastConnected = addr
 				entry.addr = make(map[string]*poolEntryAddress)
@@ -393,7 +499,16 @@ func (pool *serverPool) eventLoop() {
 			// Handle peer registration requests.
 			entry := req.entry
 			entry.state = psRegistered
-			entry.regTime = mclock.Now()
+			entry.regTime = pool.clock.Now()
+			entry.servedAtReg = entry.served
+			entry.capacity = req.capacity
+			if entry.capacity > pool.bestCapacity {
+				pool.bestCapacity = entry.capacity
+			}
+			entry.freeCapacity = -1
+			if req.total > 0 {
+				entry.freeCapacity = float64(req.free) / float64(req.total)
+			}
 			if !entry.known {
 				pool.newQueue.remove(entry)
 				entry.known = true
@@ -406,6 +521,16 @@ func (pool *serverPool) eventLoop() {
 			// Handle peer disconnection requests.
 			disconnect(req, req.stopped)
 
+		case res := <-pool.statsCh:
+			res <- pool.connectedStats()
+
+		case res := <-pool.knownCh:
+			res <- pool.knownStats()
+
+		case <-saveNodes:
+			pool.saveNodes()
+			saveNodes = pool.clock.After(saveNodesInterval)
+
 		case <-pool.quit:
 			if pool.discSetPeriod != nil {
 				close(pool.discSetPeriod)
@@ -428,8 +553,133 @@ func (pool *serverPool) eventLoop() {
 	}
 }
 
+// ServerStats is the service quality recorded for a connected light server.
+type ServerStats struct {
+	ID          string        `json:"id"`
+	Latency     time.Duration `json:"latency"`     // average response time
+	Delay       time.Duration `json:"delay"`       // average block announcement delay
+	TimeoutRate float64       `json:"timeoutRate"` // recent ratio of timed out requests
+	Served      uint64        `json:"served"`      // requests answered since startup
+	Timeouts    uint64        `json:"timeouts"`    // requests timed out since startup
+	Weight      int64         `json:"weight"`      // current dial selection weight
+
+	Capacity     uint64  `json:"capacity"`     // capacity assigned by the server
+	FreeCapacity float64 `json:"freeCapacity"` // free ratio of the capacity announced by the server, negative if unknown
+	Throughput   float64 `json:"throughput"`   // requests per second served during the previous connection
+}
+
+// stats returns the statistics of the connected servers.
+func (pool *serverPool) stats() []ServerStats {
+	res := make(chan []ServerStats, 1)
+	select {
+	case pool.statsCh <- res:
+		return <-res
+	case <-pool.quit:
+		return nil
+	}
+}
+
+// connectedStats collects the statistics of the registered entries. It should
+// only be called from the event loop.
+func (pool *serverPool) connectedStats() []ServerStats {
+	var list []ServerStats
+	for _, entry := range pool.entries {
+		if entry.state != psRegistered {
+			continue
+		}
+		weight := (*knownEntry)(entry).Weight()
+		if !entry.known {
+			weight = (*discoveredEntry)(entry).Weight()
+		}
+		list = append(list, ServerStats{
+			ID:          entry.node.ID().String(),
+			Latency:     time.Duration(entry.responseStats.avg),
+			Delay:       time.Duration(entry.delayStats.avg),
+			TimeoutRate: entry.timeoutStats.recentAvg(pool.clock.Now()),
+			Served:      entry.served,
+			Timeouts:    entry.timeouts,
+			Weight:      weight,
+
+			Capacity:     entry.capacity,
+			FreeCapacity: entry.freeCapacity,
+			Throughput:   entry.throughput,
+		})
+	}
+	return list
+}
+
+// KnownServer is an entry of the server pool: a server found by discovery or
+// connected before, with the statistics deciding how likely it is dialed.
+type KnownServer struct {
+	ID        string               `json:"id"`
+	State     string               `json:"state"`     // idle, dialed, connected or registered
+	Known     bool                 `json:"known"`     // connected before, otherwise only discovered
+	Addresses []KnownServerAddress `json:"addresses"` // addresses announced or connected before
+	Weight    int64                `json:"weight"`    // current dial selection weight
+
+	Connect     float64       `json:"connect"`     // average connection success and duration, between 0 and 1
+	Latency     time.Duration `json:"latency"`     // average response time
+	Delay       time.Duration `json:"delay"`       // average block announcement delay
+	TimeoutRate float64       `json:"timeoutRate"` // average ratio of timed out requests
+	Served      uint64        `json:"served"`      // requests answered since startup
+	Timeouts    uint64        `json:"timeouts"`    // requests timed out since startup
+}
+
+// KnownServerAddress is a network address of a known server.
+type KnownServerAddress struct {
+	Addr     string        `json:"addr"`
+	Fails    uint          `json:"fails"`    // connection failures since the last successful connection
+	LastSeen time.Duration `json:"lastSeen"` // time since it was last discovered, connected or loaded
+}
+
+// known returns all entries of the server pool.
+func (pool *serverPool) known() []KnownServer {
+	res := make(chan []KnownServer, 1)
+	select {
+	case pool.knownCh <- res:
+		return <-res
+	case <-pool.quit:
+		return nil
+	}
+}
+
+// knownStats collects the statistics of all entries. It should only be called
+// from the event loop.
+func (pool *serverPool) knownStats() []KnownServer {
+	now := pool.clock.Now()
+	list := make([]KnownServer, 0, len(pool.entries))
+	for _, entry := range pool.entries {
+		weight := (*knownEntry)(entry).Weight()
+		if !entry.known {
+			weight = (*discoveredEntry)(entry).Weight()
+		}
+		server := KnownServer{
+			ID:          entry.node.ID().String(),
+			State:       poolStateNames[entry.state],
+			Known:       entry.known,
+			Weight:      weight,
+			Connect:     entry.connectStats.avg,
+			Latency:     time.Duration(entry.responseStats.avg),
+			Delay:       time.Duration(entry.delayStats.avg),
+			TimeoutRate: entry.timeoutStats.avg,
+			Served:      entry.served,
+			Timeouts:    entry.timeouts,
+		}
+		for key, addr := range entry.addr {
+			server.Addresses = append(server.Addresses, KnownServerAddress{
+				Addr:     key,
+				Fails:    addr.fails,
+				LastSeen: time.Duration(now - addr.lastSeen),
+			})
+		}
+		list = append(list, server)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Weight > list[j].Weight })
+	return list
+}
+
 func (pool *serverPool) findOrNewNode(node *enode.Node) *poolEntry {
-	now := mclock.Now()
+	now := pool.clock.Now()
 	entry := pool.entries[node.ID()]
 	if entry == nil {
 		log.Debug("Discovered new entry", "id", node.ID())
@@ -438,16 +688,19 @@ func (pool *serverPool) findOrNewNode(node *enode.Node) *poolEntry {
 			addr:       make(map[string]*poolEntryAddress),
 			addrSelect: *newWeightedRandomSelect(),
 			shortRetry: shortRetryCnt,
+
+			pool:         pool,
+			freeCapacity: -1,
 		}
 		pool.entries[node.ID()] = entry
 		// initialize previously unknown peers with good statistics to give a chance to prove themselves
-		entry.connectStats.add(1, initStatsWeight)
-		entry.delayStats.add(0, initStatsWeight)
-		entry.responseStats.add(0, initStatsWeight)
-		entry.timeoutStats.add(0, initStatsWeight)
+		entry.connectStats.add(1, initStatsWeight, now)
+		entry.delayStats.add(0, initStatsWeight, now)
+		entry.responseStats.add(0, initStatsWeight, now)
+		entry.timeoutStats.add(0, initStatsWeight, now)
 	}
 	entry.lastDiscovered = now
-	addr := &poolEntryAddress{ip: node.IP(), port: uint16(node.TCP())}
+	addr := &poolEntryAddress{ip: node.IP(), onion: node.Onion(), port: uint16(node.TCP()), clock: pool.clock}
 	if a, ok := entry.addr[addr.strKey()]; ok {
 		addr = a
 	} else {
@@ -463,13 +716,17 @@ func (pool *serverPool) findOrNewNode(node *enode.Node) *poolEntry {
 
 // loadNodes loads known nodes and their statistics from the database
 func (pool *serverPool) loadNodes() {
-	enc, err := pool.db.Get(pool.dbKey)
-	if err != nil {
-		return
+	enc := rawdb.ReadServerPoolNodes(pool.db, string(pool.topic))
+	if len(enc) == 0 {
+		legacyKey := append(append([]byte{}, legacyServerPoolPrefix...), string(pool.topic)...)
+		if enc, _ = pool.db.Get(legacyKey); len(enc) == 0 {
+			return
+		}
+		rawdb.WriteServerPoolNodes(pool.db, string(pool.topic), enc)
+		pool.db.Delete(legacyKey)
 	}
 	var list []*poolEntry
-	err = rlp.DecodeBytes(enc, &list)
-	if err != nil {
+	if err := rlp.DecodeBytes(enc, &list); err != nil {
 		log.Debug("Failed to decode node list", "err", err)
 		return
 	}
@@ -479,8 +736,11 @@ func (pool *serverPool) loadNodes() {
 			"delay", fmt.Sprintf("%v/%v", time.Duration(e.delayStats.avg), e.delayStats.weight),
 			"response", fmt.Sprintf("%v/%v", time.Duration(e.responseStats.avg), e.responseStats.weight),
 			"timeout", fmt.Sprintf("%v/%v", e.timeoutStats.avg, e.timeoutStats.weight))
+		e.pool, e.freeCapacity = pool, -1
+		e.lastConnected.clock, e.lastConnected.lastSeen = pool.clock, pool.clock.Now()
+		e.addrSelect.update(e.lastConnected)
 		pool.entries[e.node.ID()] = e
-		if pool.trustedNodes[e.node.ID()] == nil {
+		if !pool.isTrusted(e.node.ID()) {
 			pool.knownQueue.setLatest(e)
 			pool.knownSelect.update((*knownEntry)(e))
 		}
@@ -493,6 +753,9 @@ func (pool *serverPool) loadNodes() {
 // added to either the known or new selection pools. They are connected/reconnected
 // by p2p.Server whenever possible.
 func (pool *serverPool) connectToTrustedNodes() {
+	pool.trustedLock.RLock()
+	defer pool.trustedLock.RUnlock()
+
 	//connect to trusted nodes
 	for _, node := range pool.trustedNodes {
 		pool.server.AddTrustedPeer(node)
@@ -501,6 +764,44 @@ func (pool *serverPool) connectToTrustedNodes() {
 	}
 }
 
+// isTrusted returns true if the node is a trusted server.
+func (pool *serverPool) isTrusted(id enode.ID) bool {
+	pool.trustedLock.RLock()
+	defer pool.trustedLock.RUnlock()
+
+	return pool.trustedNodes[id] != nil
+}
+
+// addTrusted adds a trusted server at runtime and connects to it. An already
+// connected server is reconnected so that it is handled as a trusted one.
+func (pool *serverPool) addTrusted(node *enode.Node) {
+	pool.trustedLock.Lock()
+	pool.trustedNodes[node.ID()] = node
+	pool.trustedLock.Unlock()
+
+	pool.server.RemovePeer(node)
+	pool.server.AddTrustedPeer(node)
+	pool.server.AddPeer(node)
+	log.Info("Added trusted server", "id", node.ID())
+}
+
+// removeTrusted removes a trusted server at runtime and disconnects it. It
+// returns false if the server wasn't trusted.
+func (pool *serverPool) removeTrusted(id enode.ID) bool {
+	pool.trustedLock.Lock()
+	node := pool.trustedNodes[id]
+	delete(pool.trustedNodes, id)
+	pool.trustedLock.Unlock()
+
+	if node == nil {
+		return false
+	}
+	pool.server.RemoveTrustedPeer(node)
+	pool.server.RemovePeer(node)
+	log.Info("Removed trusted server", "id", id)
+	return true
+}
+
 // parseTrustedNodes returns valid and parsed enodes
 func parseTrustedNodes(trustedNodes []string) map[enode.ID]*enode.Node {
 	nodes := make(map[enode.ID]*enode.Node)
@@ -519,13 +820,9 @@ func parseTrustedNodes(trustedNodes []string) map[enode.ID]*enode.Node {
 // saveNodes saves known nodes and their statistics into the database. Nodes are
 // ordered from least to most recently connected.
 func (pool *serverPool) saveNodes() {
-	list := make([]*poolEntry, len(pool.knownQueue.queue))
-	for i := range list {
-		list[i] = pool.knownQueue.fetchOldest()
-	}
-	enc, err := rlp.EncodeToBytes(list)
+	enc, err := rlp.EncodeToBytes(pool.knownQueue.entries())
 	if err == nil {
-		pool.db.Put(pool.dbKey, enc)
+		rawdb.WriteServerPoolNodes(pool.db, string(pool.topic), enc)
 	}
 }
 
@@ -547,11 +844,17 @@ func (pool *serverPool) setRetryDial(entry *poolEntry) {
 		delay = shortRetryDelay
 	}
 	delay += time.Duration(rand.Int63n(int64(delay) + 1))
+	if drain := time.Duration(entry.drainUntil - pool.clock.Now()); drain > delay {
+		delay = drain
+	}
+	if penalty := time.Duration(entry.penaltyUntil - pool.clock.Now()); penalty > delay {
+		delay = penalty
+	}
 	entry.delayedRetry = true
 	go func() {
 		select {
 		case <-pool.quit:
-		case <-time.After(delay):
+		case <-pool.clock.After(delay):
 			select {
 			case <-pool.quit:
 			case pool.enableRetry <- entry:
@@ -578,14 +881,18 @@ func (pool *serverPool) checkDial() {
 			fillWithKnownSelects = false
 			break
 		}
-		pool.dial((*poolEntry)(entry.(*knownEntry)), true)
+		if pool.checkDiversity((*poolEntry)(entry.(*knownEntry))) {
+			pool.dial((*poolEntry)(entry.(*knownEntry)), true)
+		}
 	}
 	for pool.knownSelected+pool.newSelected < targetServerCount {
 		entry := pool.newSelect.choose()
 		if entry == nil {
 			break
 		}
-		pool.dial((*poolEntry)(entry.(*discoveredEntry)), false)
+		if pool.checkDiversity((*poolEntry)(entry.(*discoveredEntry))) {
+			pool.dial((*poolEntry)(entry.(*discoveredEntry)), false)
+		}
 	}
 	if fillWithKnownSelects {
 		// no more newly discovered nodes to select and since fast discover period
@@ -596,7 +903,39 @@ func (pool *serverPool) checkDial() {
 			if entry == nil {
 				break
 			}
-			pool.dial((*poolEntry)(entry.(*knownEntry)), true)
+			if pool.checkDiversity((*poolEntry)(entry.(*knownEntry))) {
+				pool.dial((*poolEntry)(entry.(*knownEntry)), true)
+			}
+		}
+	}
+}
+
+// checkDiversity returns true if the entry may be dialed without exceeding the
+// server limit of its network group. Otherwise the entry is excluded from the
+// selection until a server of the group disconnects.
+func (pool *serverPool) checkDiversity(entry *poolEntry) bool {
+	if !pool.diversity.full(entry) {
+		return true
+	}
+	entry.group = pool.diversity.entryGroup(entry)
+	entry.diversityBlocked = true
+	pool.newSelect.remove((*discoveredEntry)(entry))
+	pool.knownSelect.remove((*knownEntry)(entry))
+	return false
+}
+
+// leaveGroup removes a disconnected entry from its network group and makes the
+// entries excluded because of the saturated group selectable again.
+func (pool *serverPool) leaveGroup(entry *poolEntry) {
+	group := pool.diversity.leave(entry)
+	if group == "" {
+		return
+	}
+	for _, e := range pool.entries {
+		if e.diversityBlocked && e.group == group {
+			e.diversityBlocked = false
+			pool.newSelect.update((*discoveredEntry)(e))
+			pool.knownSelect.update((*knownEntry)(e))
 		}
 	}
 }
@@ -608,6 +947,7 @@ func (pool *serverPool) dial(entry *poolEntry, knownSelected bool) {
 	}
 	entry.state = psDialed
 	entry.knownSelected = knownSelected
+	pool.diversity.join(entry)
 	if knownSelected {
 		pool.knownSelected++
 	} else {
@@ -616,11 +956,15 @@ func (pool *serverPool) dial(entry *poolEntry, knownSelected bool) {
 	addr := entry.addrSelect.choose().(*poolEntryAddress)
 	log.Debug("Dialing new peer", "lesaddr", entry.node.ID().String()+"@"+addr.strKey(), "set", len(entry.addr), "known", knownSelected)
 	entry.dialed = addr
+	timeout := dialTimeout
+	if entry.isOnion() {
+		timeout = onionDialTimeout
+	}
 	go func() {
 		pool.server.AddPeer(entry.node)
 		select {
 		case <-pool.quit:
-		case <-time.After(dialTimeout):
+		case <-pool.clock.After(timeout):
 			select {
 			case <-pool.quit:
 			case pool.timeout <- entry:
@@ -642,7 +986,8 @@ func (pool *serverPool) checkDialTimeout(entry *poolEntry) {
 	} else {
 		pool.newSelected--
 	}
-	entry.connectStats.add(0, 1)
+	pool.leaveGroup(entry)
+	entry.connectStats.add(0, 1, pool.clock.Now())
 	entry.dialed.fails++
 	pool.setRetryDial(entry)
 }
@@ -654,6 +999,14 @@ const (
 	psRegistered
 )
 
+// poolStateNames are the names of the entry states reported by les_serverPool.
+var poolStateNames = []string{
+	psNotConnected: "idle",
+	psDialed:       "dialed",
+	psConnected:    "connected",
+	psRegistered:   "registered",
+}
+
 // poolEntry represents a server node and stores its current state and statistics.
 type poolEntry struct {
 	peer                  *peer
@@ -674,6 +1027,25 @@ type poolEntry struct {
 
 	delayedRetry bool
 	shortRetry   int
+	drainUntil   mclock.AbsTime // no redial before the announced draining period is over
+	penaltyUntil mclock.AbsTime // no redial before the penalty for serving invalid data is over
+
+	served, timeouts uint64 // requests answered and timed out since startup
+
+	pool         *serverPool
+	capacity     uint64  // capacity assigned at the last connection, 0 if unknown
+	freeCapacity float64 // free ratio of the capacity announced at the last connection, negative if unknown
+	throughput   float64 // requests per second served during the last connection
+	servedAtReg  uint64  // requests answered before the current connection
+
+	group            string // network group counted by the diversity limit
+	grouped          bool   // whether the entry is counted in its group
+	diversityBlocked bool   // not selectable until a server of the group disconnects
+}
+
+// isOnion returns true if the server is reached through a Tor onion service.
+func (e *poolEntry) isOnion() bool {
+	return e.node.Onion() != ""
 }
 
 // poolEntryEnc is the RLP encoding of poolEntry.
@@ -683,9 +1055,14 @@ type poolEntryEnc struct {
 	Port                       uint16
 	Fails                      uint
 	CStat, DStat, RStat, TStat poolStats
+	Onion                      []string `rlp:"tail"` // onion service address, empty for older entries
 }
 
 func (e *poolEntry) EncodeRLP(w io.Writer) error {
+	var onion []string
+	if e.lastConnected.onion != "" {
+		onion = []string{e.lastConnected.onion}
+	}
 	return rlp.Encode(w, &poolEntryEnc{
 		Pubkey: encodePubkey64(e.node.Pubkey()),
 		IP:     e.lastConnected.ip,
@@ -695,6 +1072,7 @@ func (e *poolEntry) EncodeRLP(w io.Writer) error {
 		DStat:  e.delayStats,
 		RStat:  e.responseStats,
 		TStat:  e.timeoutStats,
+		Onion:  onion,
 	})
 }
 
@@ -707,12 +1085,16 @@ func (e *poolEntry) DecodeRLP(s *rlp.Stream) error {
 	if err != nil {
 		return err
 	}
-	addr := &poolEntryAddress{ip: entry.IP, port: entry.Port, fails: entry.Fails, lastSeen: mclock.Now()}
-	e.node = enode.NewV4(pubkey, entry.IP, int(entry.Port), int(entry.Port))
+	addr := &poolEntryAddress{ip: entry.IP, port: entry.Port, fails: entry.Fails}
+	if len(entry.Onion) > 0 {
+		addr.onion = entry.Onion[0]
+		e.node = enode.NewOnionV4(pubkey, addr.onion, int(entry.Port))
+	} else {
+		e.node = enode.NewV4(pubkey, entry.IP, int(entry.Port), int(entry.Port))
+	}
 	e.addr = make(map[string]*poolEntryAddress)
 	e.addr[addr.strKey()] = addr
-	e.addrSelect = *newWeightedRandomSelect()
-	e.addrSelect.update(addr)
+	e.addrSelect = *newWeightedRandomSelect() // filled by loadNodes, the weight needs the clock
 	e.lastConnected = addr
 	e.connectStats = entry.CStat
 	e.delayStats = entry.DStat
@@ -736,10 +1118,10 @@ type discoveredEntry poolEntry
 
 // Weight calculates random selection weight for newly discovered entries
 func (e *discoveredEntry) Weight() int64 {
-	if e.state != psNotConnected || e.delayedRetry {
+	if e.state != psNotConnected || e.delayedRetry || e.diversityBlocked {
 		return 0
 	}
-	t := time.Duration(mclock.Now() - e.lastDiscovered)
+	t := time.Duration(e.pool.clock.Now() - e.lastDiscovered)
 	if t <= discoverExpireStart {
 		return 1000000000
 	}
@@ -751,10 +1133,14 @@ type knownEntry poolEntry
 
 // Weight calculates random selection weight for known entries
 func (e *knownEntry) Weight() int64 {
-	if e.state != psNotConnected || !e.known || e.delayedRetry {
+	if e.state != psNotConnected || !e.known || e.delayedRetry || e.diversityBlocked {
 		return 0
 	}
-	return int64(1000000000 * e.connectStats.recentAvg() * math.Exp(-float64(e.lastConnected.fails)*failDropLn-e.responseStats.recentAvg()/float64(responseScoreTC)-e.delayStats.recentAvg()/float64(delayScoreTC)) * math.Pow(1-e.timeoutStats.recentAvg(), timeoutPow))
+	score := e.pool.scorer.Score(e.pool.score((*poolEntry)(e)))
+	if score <= 0 {
+		return 0
+	}
+	return int64(1000000000 * math.Min(score, 1))
 }
 
 // poolEntryAddress is a separate object because currently it is necessary to remember
@@ -763,17 +1149,22 @@ func (e *knownEntry) Weight() int64 {
 // numbered advertisements, making it clear which IP/port is the latest one.
 type poolEntryAddress struct {
 	ip       net.IP
+	onion    string // onion service address, ip is nil if set
 	port     uint16
 	lastSeen mclock.AbsTime // last time it was discovered, connected or loaded from db
 	fails    uint           // connection failures since last successful connection (persistent)
+	clock    mclock.Clock   // clock of the server pool, set when loaded from db
 }
 
 func (a *poolEntryAddress) Weight() int64 {
-	t := time.Duration(mclock.Now() - a.lastSeen)
+	t := time.Duration(a.clock.Now() - a.lastSeen)
 	return int64(1000000*math.Exp(-float64(t)/float64(discoverExpireConst)-float64(a.fails)*addrFailDropLn)) + 1
 }
 
 func (a *poolEntryAddress) strKey() string {
+	if a.onion != "" {
+		return a.onion + ":" + strconv.Itoa(int(a.port))
+	}
 	return a.ip.String() + ":" + strconv.Itoa(int(a.port))
 }
 
@@ -784,6 +1175,7 @@ func (a *poolEntryAddress) strKey() string {
 type poolStats struct {
 	sum, weight, avg, recent float64
 	lastRecalc               mclock.AbsTime
+	recalced                 bool // whether lastRecalc is set, zero is a valid simulated time
 }
 
 // init initializes stats with a long term sum/update count pair retrieved from the database
@@ -796,12 +1188,14 @@ func (s *poolStats) init(sum, weight float64) {
 	}
 	s.avg = avg
 	s.recent = avg
-	s.lastRecalc = mclock.Now()
+	s.lastRecalc, s.recalced = 0, false // set by the first recalculation
 }
 
 // recalc recalculates recent value return-to-mean and long term average
-func (s *poolStats) recalc() {
-	now := mclock.Now()
+func (s *poolStats) recalc(now mclock.AbsTime) {
+	if !s.recalced {
+		s.lastRecalc, s.recalced = now, true
+	}
 	s.recent = s.avg + (s.recent-s.avg)*math.Exp(-float64(now-s.lastRecalc)/float64(pstatReturnToMeanTC))
 	if s.sum == 0 {
 		s.avg = 0
@@ -816,15 +1210,15 @@ func (s *poolStats) recalc() {
 }
 
 // add updates the stats with a new value
-func (s *poolStats) add(value, weight float64) {
+func (s *poolStats) add(value, weight float64, now mclock.AbsTime) {
 	s.weight += weight
 	s.sum += value * weight
-	s.recalc()
+	s.recalc(now)
 }
 
 // recentAvg returns the short-term adjusted average
-func (s *poolStats) recentAvg() float64 {
-	s.recalc()
+func (s *poolStats) recentAvg(now mclock.AbsTime) float64 {
+	s.recalc(now)
 	return s.recent
 }
 
@@ -871,6 +1265,17 @@ func (q *poolEntryQueue) fetchOldest() *poolEntry {
 	}
 }
 
+// entries returns the entries of the queue from the least to the most recently
+// accessed one, leaving the queue unchanged.
+func (q *poolEntryQueue) entries() []*poolEntry {
+	list := make([]*poolEntry, 0, len(q.queue))
+	for _, e := range q.queue {
+		list = append(list, e)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].queueIdx < list[j].queueIdx })
+	return list
+}
+
 // remove removes an entry from the queue
 func (q *poolEntryQueue) remove(entry *poolEntry) {
 	if q.queue[entry.queueIdx] == entry {
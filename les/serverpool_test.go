@@ -0,0 +1,152 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"math"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"truechain/discovery/common/mclock"
+	"truechain/discovery/crypto"
+	"truechain/discovery/etruedb"
+	"truechain/discovery/p2p/discv5"
+	"truechain/discovery/p2p/enode"
+)
+
+// newTestServerPool creates a server pool timed by a simulated clock, without
+// starting it.
+func newTestServerPool(db etruedb.Database, clock mclock.Clock) (*serverPool, chan struct{}) {
+	quit := make(chan struct{})
+	pool := newServerPool(db, quit, new(sync.WaitGroup), nil)
+	pool.clock = clock
+	pool.topic = discv5.Topic("LES2@test")
+	return pool, quit
+}
+
+// Tests that the known servers are saved and loaded with their statistics, and
+// that the loaded addresses can be selected for dialing.
+func TestServerPoolNodesRoundTrip(t *testing.T) {
+	var (
+		clock = &mclock.Simulated{}
+		db    = etruedb.NewMemDatabase()
+	)
+	pool, quit := newTestServerPool(db, clock)
+	defer close(quit)
+
+	key, _ := crypto.GenerateKey()
+	node := enode.NewV4(&key.PublicKey, net.IP{10, 0, 0, 1}, 30303, 30303)
+	entry := pool.findOrNewNode(node)
+	entry.known = true
+	entry.lastConnected = entry.addr["10.0.0.1:30303"]
+	entry.lastConnected.fails = 2
+	entry.responseStats.add(float64(time.Second), 10, clock.Now())
+	pool.knownQueue.setLatest(entry)
+	pool.saveNodes()
+
+	clock.Run(time.Hour)
+	loaded, quit2 := newTestServerPool(db, clock)
+	defer close(quit2)
+	loaded.loadNodes()
+
+	e := loaded.entries[node.ID()]
+	if e == nil {
+		t.Fatal("saved server not loaded")
+	}
+	if e.node.ID() != node.ID() || e.lastConnected.fails != 2 {
+		t.Fatalf("loaded server mismatch: id %v, fails %d", e.node.ID(), e.lastConnected.fails)
+	}
+	if e.responseStats.sum != entry.responseStats.sum || e.responseStats.weight != entry.responseStats.weight {
+		t.Fatalf("loaded response stats mismatch: have %v/%v, want %v/%v", e.responseStats.sum, e.responseStats.weight, entry.responseStats.sum, entry.responseStats.weight)
+	}
+	addr, ok := e.addrSelect.choose().(*poolEntryAddress)
+	if !ok || addr.strKey() != "10.0.0.1:30303" {
+		t.Fatalf("loaded address not selectable: %v", addr)
+	}
+	if _, ok := loaded.knownSelect.choose().(*knownEntry); !ok {
+		t.Fatal("loaded server not selectable")
+	}
+}
+
+// Tests that the recent value of the statistics returns to the mean over time,
+// also if the simulated time starts at zero.
+func TestPoolStatsReturnToMean(t *testing.T) {
+	clock := &mclock.Simulated{}
+
+	var stats poolStats
+	stats.init(10, 10)
+	stats.add(0, 10, clock.Now())
+	if recent := stats.recentAvg(clock.Now()); recent != 1 {
+		t.Fatalf("recent value changed without time passing: have %v, want 1", recent)
+	}
+	clock.Run(pstatReturnToMeanTC)
+	want := 0.5 + 0.5/math.E
+	if recent := stats.recentAvg(clock.Now()); math.Abs(recent-want) > 1e-9 {
+		t.Fatalf("recent value mismatch after one time constant: have %v, want %v", recent, want)
+	}
+}
+
+// expectRetry checks whether an entry is enabled for dialing again.
+func expectRetry(t *testing.T, pool *serverPool, entry *poolEntry, enabled bool) {
+	t.Helper()
+
+	timeout := time.After(100 * time.Millisecond)
+	if enabled {
+		timeout = time.After(time.Second)
+	}
+	select {
+	case e := <-pool.enableRetry:
+		if !enabled {
+			t.Fatal("dial retried too early")
+		}
+		if e != entry {
+			t.Fatal("wrong entry retried")
+		}
+	case <-timeout:
+		if enabled {
+			t.Fatal("dial not retried")
+		}
+	}
+}
+
+// Tests that the redial of a server is delayed by the retry backoff, and by the
+// penalty of a server which served invalid data.
+func TestServerPoolRetryDelay(t *testing.T) {
+	clock := &mclock.Simulated{}
+	pool, quit := newTestServerPool(etruedb.NewMemDatabase(), clock)
+	defer close(quit)
+
+	// The short delay is randomized between one and two times shortRetryDelay
+	entry := &poolEntry{shortRetry: 1}
+	pool.setRetryDial(entry)
+	clock.WaitForTimers(1)
+	clock.Run(shortRetryDelay - time.Millisecond)
+	expectRetry(t, pool, entry, false)
+	clock.Run(shortRetryDelay + time.Millisecond)
+	expectRetry(t, pool, entry, true)
+
+	// A penalized server waits for the penalty, longer than any backoff
+	entry = &poolEntry{penaltyUntil: clock.Now() + mclock.AbsTime(invalidDataPenalty)}
+	pool.setRetryDial(entry)
+	clock.WaitForTimers(1)
+	clock.Run(2 * longRetryDelay)
+	expectRetry(t, pool, entry, false)
+	clock.Run(invalidDataPenalty - 2*longRetryDelay)
+	expectRetry(t, pool, entry, true)
+}
@@ -0,0 +1,104 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"math"
+	"time"
+)
+
+// ServerScore is the service quality recorded for a known light server, which
+// its dial selection weight is calculated from.
+type ServerScore struct {
+	Connect     float64       // recent ratio of the connection time to the target
+	Response    time.Duration // recent average response time
+	Delay       time.Duration // recent average block announcement delay
+	TimeoutRate float64       // recent ratio of timed out requests
+	Fails       uint          // failed dials of the last known address
+	Onion       bool          // reached through a Tor onion service
+
+	// Announced in the handshake of the last connection, relative to the best
+	// known server. Zero if the server wasn't connected since startup.
+	Capacity float64
+
+	// Free ratio of the total capacity announced by the server in the
+	// handshake of the last connection, negative if not announced.
+	FreeCapacity float64
+
+	// Requests served per second during the last connection, relative to the
+	// best known server. Zero if nothing was served since startup.
+	Throughput float64
+}
+
+// ServerScorer calculates the dial selection weight of the known light servers.
+// Scores are in the [0, 1] range, servers are dialed with a probability
+// proportional to their score.
+type ServerScorer interface {
+	Score(s *ServerScore) float64
+}
+
+// DefaultServerScorer prefers servers with a long connection time, low latency
+// and few timeouts. Servers announcing a lower or saturated capacity and
+// serving fewer requests are dialed less often, but not excluded.
+type DefaultServerScorer struct{}
+
+// Score implements ServerScorer.
+func (DefaultServerScorer) Score(s *ServerScore) float64 {
+	responseTC, delayTC := responseScoreTC, delayScoreTC
+	if s.Onion {
+		responseTC, delayTC = onionResponseScoreTC, onionDelayScoreTC
+	}
+	score := s.Connect * math.Exp(-float64(s.Fails)*failDropLn-float64(s.Response)/float64(responseTC)-float64(s.Delay)/float64(delayTC)) * math.Pow(1-s.TimeoutRate, timeoutPow)
+	if s.Capacity > 0 {
+		score *= 0.5 + 0.5*s.Capacity
+	}
+	if s.FreeCapacity >= 0 {
+		score *= 0.5 + 0.5*s.FreeCapacity
+	}
+	if s.Throughput > 0 {
+		score *= 0.5 + 0.5*s.Throughput
+	}
+	return score
+}
+
+// score collects the service quality of a pool entry. It should only be called
+// from the event loop.
+func (pool *serverPool) score(e *poolEntry) *ServerScore {
+	now := pool.clock.Now()
+	s := &ServerScore{
+		Connect:      e.connectStats.recentAvg(now),
+		Response:     time.Duration(e.responseStats.recentAvg(now)),
+		Delay:        time.Duration(e.delayStats.recentAvg(now)),
+		TimeoutRate:  e.timeoutStats.recentAvg(now),
+		Fails:        e.lastConnected.fails,
+		Onion:        e.isOnion(),
+		FreeCapacity: e.freeCapacity,
+	}
+	if pool.bestCapacity > 0 {
+		s.Capacity = float64(e.capacity) / float64(pool.bestCapacity)
+	}
+	if pool.bestThroughput > 0 {
+		s.Throughput = e.throughput / pool.bestThroughput
+	}
+	return s
+}
+
+// SetServerScorer replaces the dial selection weight calculation of the known
+// light servers. It should be called before the light client is started.
+func (s *LightEtrue) SetServerScorer(scorer ServerScorer) {
+	s.scorer = scorer
+}
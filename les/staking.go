@@ -0,0 +1,107 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"context"
+
+	"truechain/discovery/common"
+	"truechain/discovery/common/hexutil"
+	"truechain/discovery/core/types"
+	"truechain/discovery/core/vm"
+	"truechain/discovery/crypto"
+	"truechain/discovery/light/fast"
+	"truechain/discovery/rpc"
+)
+
+// PublicLightImpawnAPI serves views of the staking (impawn) state tailored to
+// light clients. The staking state is a single entry of the storage of the
+// staking address, its proof and the one of the account are retrieved in as
+// few requests as possible, instead of one at a time by a generic call.
+type PublicLightImpawnAPI struct {
+	client *LightEtrue
+}
+
+// NewPublicLightImpawnAPI creates a new light client staking API.
+func NewPublicLightImpawnAPI(client *LightEtrue) *PublicLightImpawnAPI {
+	return &PublicLightImpawnAPI{client: client}
+}
+
+// StakingInfo is the staking state of an address: the amounts it staked as a
+// validator or delegated, the ones locked until their redeem height and the
+// ones which can still be cancelled. Account is the validator account of the
+// address, if any.
+type StakingInfo struct {
+	Address    common.Address         `json:"address"`
+	Number     hexutil.Uint64         `json:"number"`
+	Staked     []vm.StakingAsset      `json:"staked"`
+	Locked     []vm.LockedAsset       `json:"locked"`
+	Cancelable []vm.CancelableAsset   `json:"cancelable"`
+	Account    map[string]interface{} `json:"account"`
+}
+
+// GetStakingInfo returns the staking state of an address at the given block.
+func (api *PublicLightImpawnAPI) GetStakingInfo(ctx context.Context, addr common.Address, blockNr rpc.BlockNumber) (*StakingInfo, error) {
+	infos, err := api.GetStakingInfos(ctx, []common.Address{addr}, blockNr)
+	if err != nil || len(infos) == 0 {
+		return nil, err
+	}
+	return infos[0], nil
+}
+
+// GetStakingInfos returns the staking state of several addresses at the given
+// block, retrieving the staking state once.
+func (api *PublicLightImpawnAPI) GetStakingInfos(ctx context.Context, addrs []common.Address, blockNr rpc.BlockNumber) ([]*StakingInfo, error) {
+	impawn, header, err := api.client.impawnState(ctx, blockNr)
+	if impawn == nil || err != nil {
+		return nil, err
+	}
+	number := header.Number.Uint64()
+	infos := make([]*StakingInfo, len(addrs))
+	for i, addr := range addrs {
+		infos[i] = &StakingInfo{
+			Address:    addr,
+			Number:     hexutil.Uint64(number),
+			Staked:     impawn.GetStakingAssetRPC(addr),
+			Locked:     impawn.GetLockedAssetRPC(addr, number),
+			Cancelable: impawn.GetAllCancelableAssetRPC(addr),
+			Account:    impawn.GetStakingAccountRPC(number, addr),
+		}
+	}
+	return infos, nil
+}
+
+// impawnState loads the staking state of a block, nil if the block is unknown.
+// The account of the staking address and the storage entry holding the state
+// are retrieved in batches before loading.
+func (s *LightEtrue) impawnState(ctx context.Context, blockNr rpc.BlockNumber) (*vm.ImpawnImpl, *types.Header, error) {
+	header, err := s.ApiBackend.HeaderByNumber(ctx, blockNr)
+	if header == nil || err != nil {
+		return nil, nil, err
+	}
+	accKey := crypto.Keccak256(types.StakingAddress[:])
+	keys := newStateKeys()
+	keys.add(nil, accKey)
+	keys.add(accKey, crypto.Keccak256(common.BytesToHash(types.StakingAddress[:]).Bytes()))
+	s.prefetchState(ctx, s.odr, header, keys)
+
+	impawn := vm.NewImpawnImpl()
+	if err := impawn.Load(fast.NewState(ctx, header, s.odr), types.StakingAddress); err != nil {
+		return nil, nil, err
+	}
+	return impawn, header, nil
+}
@@ -24,6 +24,8 @@ import (
 	"truechain/discovery/core/snailchain/rawdb"
 	"truechain/discovery/etrue/downloader"
 	"truechain/discovery/light"
+	"truechain/discovery/light/fast"
+	"truechain/discovery/params"
 )
 
 // syncer is responsible for periodically synchronising with the network, both
@@ -61,6 +63,10 @@ func (pm *ProtocolManager) synchronise(peer *peer) {
 	if peer == nil {
 		return
 	}
+	// Don't advance the chain while the servers are suspected to eclipse us
+	if pm.eclipse.risky() {
+		return
+	}
 
 	// Make sure the peer's TD is higher than our own.
 	head := pm.blockchain.CurrentHeader()
@@ -89,6 +95,52 @@ func (pm *ProtocolManager) synchronise(peer *peer) {
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 	defer cancel()
+	pm.updateCheckpoint(ctx, peer)
+	done := pm.reportSync(headBlockInfo.Number)
 	pm.blockchain.(*light.LightChain).SyncCht(ctx)
-	pm.downloader.Synchronise(peer.id, peer.Head(), peer.Td(), downloader.LightSync)
+	done(pm.downloader.Synchronise(peer.id, peer.Head(), peer.Td(), downloader.LightSync))
+	pm.forkChoices.record("sync", peer, peer.Head(), pm.blockchain, head)
+}
+
+// trustedCheckpoint returns the latest trusted checkpoint, nil if there is none.
+func (pm *ProtocolManager) trustedCheckpoint() *params.TrustedCheckpoint {
+	pm.cpLock.RLock()
+	defer pm.cpLock.RUnlock()
+
+	return pm.checkpoint
+}
+
+// updateCheckpoint replaces the trusted checkpoint of the light client with the
+// one announced by the peer if it is newer and registered in the checkpoint
+// oracle contract with the votes of enough trusted signers. The CHT and bloom
+// trie roots of the new checkpoint are used by the next synchronisation.
+func (pm *ProtocolManager) updateCheckpoint(ctx context.Context, peer *peer) {
+	if pm.reg == nil || !pm.reg.isRunning() {
+		return
+	}
+	pm.reg.lock.Lock()
+	defer pm.reg.lock.Unlock()
+
+	cp := peer.checkpoint
+	if current := pm.trustedCheckpoint(); cp.Empty() || (current != nil && cp.SectionIndex <= current.SectionIndex) {
+		return
+	}
+	index, hash, _, err := pm.reg.latestApproved(ctx)
+	if err != nil {
+		log.Debug("Failed to retrieve registered checkpoint", "err", err)
+		return
+	}
+	if index != cp.SectionIndex || !cp.HashEqual(hash) {
+		peer.Log().Debug("Announced checkpoint not registered", "section", cp.SectionIndex, "registered", index)
+		return
+	}
+	pm.fblockchain.(*fast.LightChain).AddTrustedCheckpoint(&cp)
+	pm.blockchain.(*light.LightChain).AddTrustedCheckpoint(&cp)
+	pm.cpLock.Lock()
+	pm.checkpoint = &cp
+	pm.cpLock.Unlock()
+	if pm.eclipse != nil {
+		pm.eclipse.setCheckpoint(&cp)
+	}
+	log.Info("Updated trusted checkpoint from oracle", "section", cp.SectionIndex, "head", cp.SectionHead, "hash", hash)
 }
@@ -0,0 +1,563 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"truechain/discovery/common"
+	"truechain/discovery/common/mclock"
+	"truechain/discovery/core/rawdb"
+	snaildb "truechain/discovery/core/snailchain/rawdb"
+	"truechain/discovery/core/types"
+	"truechain/discovery/etruedb"
+	"truechain/discovery/event"
+	"truechain/discovery/les/flowcontrol"
+	"truechain/discovery/light"
+	"truechain/discovery/light/public"
+	"truechain/discovery/p2p"
+	"truechain/discovery/p2p/enode"
+	"truechain/discovery/params"
+	"truechain/discovery/rlp"
+	"truechain/discovery/trie"
+)
+
+var errBenchmarkHeaders = errors.New("invalid header batch")
+
+// validateHeaderBatch checks that a batch of snail headers is the requested
+// range of a chain.
+func validateHeaderBatch(headers []*types.SnailHeader, from, amount uint64) error {
+	if uint64(len(headers)) != amount {
+		return errBenchmarkHeaders
+	}
+	for i, header := range headers {
+		if header.Number.Uint64() != from+uint64(i) {
+			return errBenchmarkHeaders
+		}
+		if i > 0 && header.ParentHash != headers[i-1].Hash() {
+			return errBenchmarkHeaders
+		}
+	}
+	return nil
+}
+
+// syncTestChain is a snail header chain stored in a database, serving the
+// server side of the sync harness.
+type syncTestChain struct {
+	db      etruedb.Database
+	config  *params.ChainConfig
+	genesis *types.SnailHeader
+	head    *types.SnailHeader
+	feed    event.Feed
+}
+
+func (c *syncTestChain) Config() *params.ChainConfig { return c.config }
+func (c *syncTestChain) HasHeader(hash common.Hash, number uint64) bool {
+	return snaildb.HasHeader(c.db, hash, number)
+}
+func (c *syncTestChain) GetHeader(hash common.Hash, number uint64) *types.SnailHeader {
+	return snaildb.ReadHeader(c.db, hash, number)
+}
+func (c *syncTestChain) GetHeaderByHash(hash common.Hash) *types.SnailHeader {
+	number := snaildb.ReadHeaderNumber(c.db, hash)
+	if number == nil {
+		return nil
+	}
+	return snaildb.ReadHeader(c.db, hash, *number)
+}
+func (c *syncTestChain) GetHeaderByNumber(number uint64) *types.SnailHeader {
+	return snaildb.ReadHeader(c.db, snaildb.ReadCanonicalHash(c.db, number), number)
+}
+func (c *syncTestChain) CurrentHeader() *types.SnailHeader { return c.head }
+func (c *syncTestChain) GetTd(hash common.Hash, number uint64) *big.Int {
+	return snaildb.ReadTd(c.db, hash, number)
+}
+func (c *syncTestChain) InsertHeaderChain([]*types.SnailHeader, [][]*types.SnailHeader, int) (int, error) {
+	return 0, errors.New("read only chain")
+}
+func (c *syncTestChain) Rollback([]common.Hash) {}
+func (c *syncTestChain) GetAncestor(hash common.Hash, number, ancestor uint64, maxNonCanonical *uint64) (common.Hash, uint64) {
+	if ancestor > number {
+		return common.Hash{}, 0
+	}
+	return snaildb.ReadCanonicalHash(c.db, number-ancestor), number - ancestor
+}
+func (c *syncTestChain) Genesis() *types.SnailBlock { return types.NewSnailBlockWithHeader(c.genesis) }
+func (c *syncTestChain) SubscribeChainHeadEvent(ch chan<- types.SnailChainHeadEvent) event.Subscription {
+	return c.feed.Subscribe(ch)
+}
+
+// newSyncTestChain writes a snail header chain of the given number of CHT
+// sections, plus the confirmations a client waits for, into db. The CHT of
+// every section is built the way the server's indexer does, and the last
+// block of a section has a body and a fast block to serve as auxiliary data.
+func newSyncTestChain(db etruedb.Database, sections uint64) (*syncTestChain, error) {
+	var (
+		size    = public.DefaultClientIndexerConfig.ChtSize
+		count   = sections*size + public.DefaultClientIndexerConfig.ChtConfirms
+		chain   = &syncTestChain{db: db, config: params.AllMinervaProtocolChanges}
+		td      = new(big.Int)
+		triedb  = trie.NewDatabase(etruedb.NewTable(db, light.ChtTablePrefix))
+		root    common.Hash
+		cht     *trie.Trie
+		parent  common.Hash
+		err     error
+		encNum  [8]byte
+		section uint64
+	)
+	if cht, err = trie.New(common.Hash{}, triedb); err != nil {
+		return nil, err
+	}
+	for number := uint64(0); number < count; number++ {
+		header := &types.SnailHeader{
+			ParentHash:      parent,
+			PointerNumber:   new(big.Int).SetUint64(number),
+			FastNumber:      new(big.Int).SetUint64(number * 60),
+			Difficulty:      big.NewInt(1000000),
+			FruitDifficulty: big.NewInt(1000),
+			Number:          new(big.Int).SetUint64(number),
+			Time:            new(big.Int).SetUint64(number * 600),
+			Extra:           []byte{},
+		}
+		hash := header.Hash()
+		td.Add(td, header.Difficulty)
+		snaildb.WriteHeader(db, header)
+		snaildb.WriteTd(db, hash, number, td)
+		snaildb.WriteCanonicalHash(db, hash, number)
+		if number == 0 {
+			chain.genesis = header
+		}
+		chain.head, parent = header, hash
+
+		if number >= sections*size {
+			continue // confirmations only
+		}
+		binary.BigEndian.PutUint64(encNum[:], number)
+		data, _ := rlp.EncodeToBytes(light.ChtNode{Hash: hash, Td: new(big.Int).Set(td)})
+		cht.Update(encNum[:], data)
+
+		if (number+1)%size != 0 {
+			continue
+		}
+		// Last block of the section: commit the CHT and store the fast block
+		// the section head's last fruit points to
+		fast := &types.Header{Number: new(big.Int).Set(header.FastNumber), Time: new(big.Int).Set(header.Time), Extra: []byte{}}
+		fruit := types.NewSnailBlockWithHeader(&types.SnailHeader{FastHash: fast.Hash(), FastNumber: fast.Number})
+		rawdb.WriteHeader(db, fast)
+		snaildb.WriteBody(db, hash, number, &types.SnailBody{Fruits: []*types.SnailBlock{fruit}})
+
+		if root, err = cht.Commit(nil); err != nil {
+			return nil, err
+		}
+		if err := triedb.Commit(root, false); err != nil {
+			return nil, err
+		}
+		light.StoreChtRoot(db, section, hash, root)
+		section++
+	}
+	snaildb.WriteHeadHeaderHash(db, chain.head.Hash())
+	return chain, nil
+}
+
+// syncClientRW is the client end of the harness' message pipe. It counts the
+// traffic in both directions and hands the header replies to the retrieve
+// manager, which the client handler only does for ODR replies.
+type syncClientRW struct {
+	rw            p2p.MsgReadWriter
+	peer          *peer
+	retriever     *retrieveManager
+	in, out       uint64 // accessed atomically
+	invalidHeader uint64 // accessed atomically
+}
+
+func (rw *syncClientRW) ReadMsg() (p2p.Msg, error) {
+	for {
+		msg, err := rw.rw.ReadMsg()
+		if err != nil {
+			return msg, err
+		}
+		atomic.AddUint64(&rw.in, uint64(msg.Size))
+		if msg.Code != SnailBlockHeadersMsg {
+			return msg, nil
+		}
+		var resp struct {
+			ReqID, BV uint64
+			Headers   snailHeadsData
+		}
+		if err := msg.Decode(&resp); err != nil {
+			return msg, err
+		}
+		rw.peer.fcServer.ReceivedReply(resp.ReqID, resp.BV)
+		if err := rw.retriever.deliver(rw.peer, &Msg{ReqID: resp.ReqID, Obj: resp.Headers.Heads}); err != nil {
+			atomic.AddUint64(&rw.invalidHeader, 1)
+		}
+	}
+}
+
+func (rw *syncClientRW) WriteMsg(msg p2p.Msg) error {
+	atomic.AddUint64(&rw.out, uint64(msg.Size))
+	return rw.rw.WriteMsg(msg)
+}
+
+// syncHarness is an in-process light client connected to a light server
+// through a message pipe. The server side is the real server handler serving a
+// test chain, the client side schedules its requests through the request
+// distributor and the retrieve manager and validates the replies. The proof
+// replies are processed by the real client handler.
+type syncHarness struct {
+	sections uint64
+	server   *ProtocolManager
+	client   *ProtocolManager
+	odr      *LesOdr
+	rw       *syncClientRW
+	chtRoots []common.Hash // CHT root of every section, as trusted by the client
+
+	headers, proofs uint64 // validated in the last sync, accessed atomically
+	closers         []func()
+}
+
+// newSyncHarness creates a server with a chain of the given number of CHT
+// sections and a client connected to it.
+func newSyncHarness(sections uint64) (*syncHarness, error) {
+	h := &syncHarness{sections: sections}
+
+	// Server side: the server handler serving the test chain
+	serverDb := etruedb.NewMemDatabase()
+	chain, err := newSyncTestChain(serverDb, sections)
+	if err != nil {
+		return nil, err
+	}
+	for section := uint64(0); section < sections; section++ {
+		head := snaildb.ReadCanonicalHash(serverDb, (section+1)*public.DefaultClientIndexerConfig.ChtSize-1)
+		h.chtRoots = append(h.chtRoots, light.GetChtRoot(serverDb, section, head))
+	}
+	srv := &LesServer{
+		lesCommons: lesCommons{chainDb: serverDb, iConfig: public.DefaultServerIndexerConfig},
+		fcManager:  flowcontrol.NewClientManager(nil, &mclock.System{}),
+	}
+	h.server = newProtocolManager(&handlerConfig{
+		ChainConfig:   chain.config,
+		IndexerConfig: public.DefaultServerIndexerConfig,
+		NetworkId:     NetworkId,
+		EventMux:      new(event.TypeMux),
+		Peers:         newPeerSet(),
+		SnailChain:    chain,
+		ChainDb:       serverDb,
+		QuitSync:      make(chan struct{}),
+		Wg:            new(sync.WaitGroup),
+		Synced:        func() bool { return true },
+	})
+	h.server.server = srv
+	h.server.servingQueue = newServingQueue(int64(time.Millisecond*10), 1)
+	h.server.servingQueue.setThreads(4)
+	srv.protocolManager = h.server
+	h.closers = append(h.closers, srv.fcManager.Stop, h.server.servingQueue.stop)
+
+	// Client side: the peer set, distributor, retriever and ODR of a light client
+	clientDb := etruedb.NewMemDatabase()
+	clientChain := &syncTestChain{db: clientDb, config: chain.config, genesis: chain.genesis, head: chain.genesis}
+	stop := make(chan struct{})
+	peers := newPeerSet()
+	dist := newRequestDistributor(peers, stop, mclock.System{})
+	retriever := newRetrieveManager(peers, dist, nil)
+	h.odr = NewLesOdr(clientDb, public.DefaultClientIndexerConfig, retriever)
+	h.odr.chainConfig = chain.config
+	h.client = newProtocolManager(&handlerConfig{
+		ChainConfig:   chain.config,
+		IndexerConfig: public.DefaultClientIndexerConfig,
+		NetworkId:     NetworkId,
+		EventMux:      new(event.TypeMux),
+		Peers:         peers,
+		SnailChain:    clientChain,
+		ChainDb:       clientDb,
+		QuitSync:      make(chan struct{}),
+		Wg:            new(sync.WaitGroup),
+	})
+	h.client.client = true
+	h.client.odr = h.odr
+	h.client.retriever = retriever
+	h.client.reqDist = dist
+	h.closers = append(h.closers, func() { h.odr.Stop(); close(stop) })
+
+	// Connect the two ends
+	clientPipe, serverPipe := p2p.MsgPipe()
+	h.rw = &syncClientRW{rw: clientPipe, retriever: retriever}
+
+	var id enode.ID
+	rand.Read(id[:])
+	serverPeer := h.server.newPeer(lpv2, NetworkId, p2p.NewPeer(id, "client", nil), serverPipe)
+	serverPeer.sendQueue = newExecQueue(100)
+	serverPeer.announceType = announceTypeNone
+	serverPeer.fcCosts = make(requestCostTable)
+	c := &requestCosts{}
+	for code := range requests {
+		serverPeer.fcCosts[code] = c
+	}
+	serverPeer.fcParams = flowcontrol.ServerParams{BufLimit: 1, MinRecharge: 1}
+	serverPeer.fcClient = flowcontrol.NewClientNode(srv.fcManager, serverPeer.fcParams)
+	h.closers = append(h.closers, serverPeer.fcClient.Disconnect, serverPeer.sendQueue.quit)
+
+	clientPeer := h.client.newPeer(lpv2, NetworkId, p2p.NewPeer(id, "server", nil), h.rw)
+	clientPeer.fcServer = flowcontrol.NewServerNode(flowcontrol.ServerParams{BufLimit: 1, MinRecharge: 1}, mclock.System{})
+	clientPeer.headInfo = &announceData{Hash: chain.head.Hash(), Number: chain.head.Number.Uint64(), Td: chain.GetTd(chain.head.Hash(), chain.head.Number.Uint64())}
+	h.rw.peer = clientPeer
+	if err := peers.Register(clientPeer); err != nil {
+		h.close()
+		return nil, err
+	}
+	h.closers = append(h.closers, func() { peers.Unregister(clientPeer.id) })
+
+	// Closing the pipe first fails the writes the send queues may be blocked on
+	h.closers = append(h.closers, func() { clientPipe.Close(); serverPipe.Close() })
+
+	go func() {
+		for h.server.handleMsg(serverPeer) == nil {
+		}
+	}()
+	go func() {
+		for h.client.handleMsg(clientPeer) == nil {
+		}
+	}()
+	return h, nil
+}
+
+// close disconnects the client and stops both sides.
+func (h *syncHarness) close() {
+	for i := len(h.closers) - 1; i >= 0; i-- {
+		h.closers[i]()
+	}
+}
+
+// sync downloads the headers of every section and the CHT proof of every
+// section head, the way a light client catches up with a checkpoint. The
+// header batches have to link up to the proven section heads.
+func (h *syncHarness) sync(ctx context.Context) error {
+	atomic.StoreUint64(&h.headers, 0)
+	atomic.StoreUint64(&h.proofs, 0)
+
+	var (
+		size  = public.DefaultClientIndexerConfig.ChtSize
+		wg    sync.WaitGroup
+		errCh = make(chan error, h.sections)
+	)
+	for section := uint64(0); section < h.sections; section++ {
+		wg.Add(1)
+		go func(section uint64) {
+			defer wg.Done()
+			if err := h.syncSection(ctx, section, size); err != nil {
+				errCh <- fmt.Errorf("section %d: %v", section, err)
+			}
+		}(section)
+	}
+	wg.Wait()
+	close(errCh)
+	return <-errCh
+}
+
+// syncSection downloads the headers and the head proof of a single section.
+func (h *syncHarness) syncSection(ctx context.Context, section, size uint64) error {
+	var (
+		start, end = section * size, (section + 1) * size
+		batches    [][]*types.SnailHeader
+		lock       sync.Mutex
+		wg         sync.WaitGroup
+		errCh      = make(chan error, size/MaxHeaderFetch+2)
+	)
+	for from := start; from < end; from += MaxHeaderFetch {
+		amount := uint64(MaxHeaderFetch)
+		if from+amount > end {
+			amount = end - from
+		}
+		batches = append(batches, nil)
+		wg.Add(1)
+		go func(index int, from, amount uint64) {
+			defer wg.Done()
+			headers, err := h.retrieveHeaders(ctx, from, amount)
+			if err != nil {
+				errCh <- err
+				return
+			}
+			lock.Lock()
+			batches[index] = headers
+			lock.Unlock()
+		}(len(batches)-1, from, amount)
+	}
+	req := &light.ChtRequest{
+		Config:   public.DefaultClientIndexerConfig,
+		ChtNum:   section,
+		BlockNum: end - 1,
+		ChtRoot:  h.chtRoots[section],
+	}
+	if err := h.odr.Retrieve(ctx, req); err != nil {
+		return err
+	}
+	atomic.AddUint64(&h.proofs, 1)
+	wg.Wait()
+
+	select {
+	case err := <-errCh:
+		return err
+	default:
+	}
+	// Link the batches up to the proven section head
+	for i := 1; i < len(batches); i++ {
+		if batches[i][0].ParentHash != batches[i-1][len(batches[i-1])-1].Hash() {
+			return errBenchmarkHeaders
+		}
+	}
+	last := batches[len(batches)-1]
+	if last[len(last)-1].Hash() != req.Header.Hash() {
+		return errCHTHashMismatch
+	}
+	return nil
+}
+
+// retrieveHeaders downloads a batch of snail headers by number through the
+// request distributor and the retrieve manager.
+func (h *syncHarness) retrieveHeaders(ctx context.Context, from, amount uint64) ([]*types.SnailHeader, error) {
+	var (
+		headers []*types.SnailHeader
+		reqID   = genReqID()
+	)
+	rq := &distReq{
+		priority: prioritySync,
+		getCost: func(dp distPeer) uint64 {
+			return dp.(*peer).GetRequestCost(GetSnailBlockHeadersMsg, int(amount))
+		},
+		canSend: func(dp distPeer) bool {
+			p := dp.(*peer)
+			p.lock.RLock()
+			defer p.lock.RUnlock()
+			return p.headInfo.Number >= from+amount-1
+		},
+		request: func(dp distPeer) func() {
+			p := dp.(*peer)
+			cost := p.GetRequestCost(GetSnailBlockHeadersMsg, int(amount))
+			p.fcServer.QueuedRequest(reqID, cost)
+			return func() { p.RequestHeadersByNumber(reqID, cost, from, int(amount), 0, false, false) }
+		},
+	}
+	validate := func(p distPeer, msg *Msg) error {
+		batch, ok := msg.Obj.([]*types.SnailHeader)
+		if !ok {
+			return errInvalidMessageType
+		}
+		if err := validateHeaderBatch(batch, from, amount); err != nil {
+			return err
+		}
+		headers = batch
+		return nil
+	}
+	if err := h.client.retriever.retrieve(ctx, reqID, rq, validate, h.odr.stop); err != nil {
+		return nil, err
+	}
+	atomic.AddUint64(&h.headers, amount)
+	return headers, nil
+}
+
+// Tests that the sync harness downloads and validates every header and proof
+// of the served sections, so that the benchmark measures a working sync.
+func TestSyncHarness(t *testing.T) {
+	h, err := newSyncHarness(2)
+	if err != nil {
+		t.Fatalf("failed to create harness: %v", err)
+	}
+	defer h.close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := h.sync(ctx); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	if want := 2 * public.DefaultClientIndexerConfig.ChtSize; h.headers != want {
+		t.Errorf("synced headers mismatch: have %d, want %d", h.headers, want)
+	}
+	if h.proofs != 2 {
+		t.Errorf("synced proofs mismatch: have %d, want 2", h.proofs)
+	}
+	if n := atomic.LoadUint64(&h.rw.invalidHeader); n != 0 {
+		t.Errorf("%d header replies rejected", n)
+	}
+}
+
+// Tests that the client rejects the proofs of a server not matching the CHT
+// the client trusts.
+func TestSyncHarnessInvalidProof(t *testing.T) {
+	h, err := newSyncHarness(1)
+	if err != nil {
+		t.Fatalf("failed to create harness: %v", err)
+	}
+	defer h.close()
+
+	h.chtRoots[0] = common.HexToHash("0xdeadbeef")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := h.sync(ctx); err == nil {
+		t.Fatalf("sync succeeded with an invalid CHT root")
+	}
+}
+
+func BenchmarkLightSync1(b *testing.B) { benchmarkLightSync(b, 1) }
+func BenchmarkLightSync4(b *testing.B) { benchmarkLightSync(b, 4) }
+
+// benchmarkLightSync measures syncing the given number of CHT sections from a
+// local server: the request distribution and retrieval on the client side, the
+// serving on the server side and the validation of every reply. Besides the
+// time and the allocations, it reports the validated headers and proofs per
+// second and the traffic in both directions.
+func benchmarkLightSync(b *testing.B, sections uint64) {
+	h, err := newSyncHarness(sections)
+	if err != nil {
+		b.Fatalf("failed to create harness: %v", err)
+	}
+	defer h.close()
+
+	var headers, proofs uint64
+	atomic.StoreUint64(&h.rw.in, 0)
+	atomic.StoreUint64(&h.rw.out, 0)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		err := h.sync(ctx)
+		cancel()
+		if err != nil {
+			b.Fatalf("sync failed: %v", err)
+		}
+		headers += atomic.LoadUint64(&h.headers)
+		proofs += atomic.LoadUint64(&h.proofs)
+	}
+	b.StopTimer()
+
+	in, out := atomic.LoadUint64(&h.rw.in), atomic.LoadUint64(&h.rw.out)
+	b.SetBytes(int64((in + out) / uint64(b.N)))
+	if secs := b.Elapsed().Seconds(); secs > 0 {
+		b.ReportMetric(float64(headers)/secs, "headers/s")
+		b.ReportMetric(float64(proofs)/secs, "proofs/s")
+	}
+	b.ReportMetric(float64(in)/float64(b.N), "in-B/op")
+	b.ReportMetric(float64(out)/float64(b.N), "out-B/op")
+}
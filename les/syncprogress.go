@@ -0,0 +1,165 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"fmt"
+	"time"
+
+	"truechain/discovery/etrue/downloader"
+	"truechain/discovery/event"
+	"truechain/discovery/log"
+	"truechain/discovery/params"
+)
+
+// syncProgressInterval is the time between two progress events of a header
+// synchronisation.
+const syncProgressInterval = 5 * time.Second
+
+// SyncProgressEvent is posted on the event mux of the light client while it
+// synchronises the snail headers. The synchronisation itself is surrounded by
+// the StartEvent and the DoneEvent or FailedEvent of the downloader.
+type SyncProgressEvent struct {
+	Section       uint64  // CHT section of the current head
+	Sections      uint64  // complete CHT sections up to the highest header
+	Current       uint64  // number of the current head
+	Highest       uint64  // number of the head announced by the synced server
+	HeadersPerSec float64 // headers imported per second since the previous event
+}
+
+// SyncEventType is the kind of a SyncEvent.
+type SyncEventType int
+
+const (
+	SyncStarted           SyncEventType = iota // a header synchronisation started
+	SyncCheckpointReached                      // the synced headers reached the trusted checkpoint
+	SyncCaughtUp                               // the synced headers reached the head of the server
+	SyncFailed                                 // a header synchronisation failed
+)
+
+func (t SyncEventType) String() string {
+	switch t {
+	case SyncStarted:
+		return "started"
+	case SyncCheckpointReached:
+		return "checkpoint reached"
+	case SyncCaughtUp:
+		return "caught up"
+	case SyncFailed:
+		return "failed"
+	default:
+		return fmt.Sprintf("SyncEventType(%d)", int(t))
+	}
+}
+
+// SyncEvent is a milestone of the header synchronisation of the light client,
+// so that embedding applications can follow the synchronisation without
+// polling etrue_syncing.
+type SyncEvent struct {
+	Type    SyncEventType
+	Number  uint64 // number of the current snail head
+	Highest uint64 // number of the head announced by the synced server
+	Err     error  // cause of a failure
+}
+
+// SubscribeSyncEvent registers a subscription of SyncEvent. The subscription
+// is kept across restarts of the light client.
+func (s *LightEtrue) SubscribeSyncEvent(ch chan<- SyncEvent) event.Subscription {
+	return s.syncFeed.Subscribe(ch)
+}
+
+// sendSyncEvent delivers a milestone of the header synchronisation to the
+// subscribers.
+func (pm *ProtocolManager) sendSyncEvent(typ SyncEventType, highest uint64, err error) {
+	if pm.syncFeed == nil {
+		return
+	}
+	number := pm.blockchain.CurrentHeader().Number.Uint64()
+	pm.syncFeed.Send(SyncEvent{Type: typ, Number: number, Highest: highest, Err: err})
+}
+
+// chtSections returns the number of complete CHT sections up to a header.
+func chtSections(number uint64) uint64 {
+	return (number + 1) / params.CHTFrequency
+}
+
+// reportSync posts the start of a header synchronisation up to the given head
+// and its progress, until the returned function is called with the result.
+func (pm *ProtocolManager) reportSync(highest uint64) func(error) {
+	pm.eventMux.Post(downloader.StartEvent{})
+	pm.sendSyncEvent(SyncStarted, highest, nil)
+
+	// The checkpoint is reached once, by the synchronisation passing it
+	checkpoint := func() {}
+	if cp := pm.trustedCheckpoint(); cp != nil && !cp.Empty() {
+		number := (cp.SectionIndex+1)*params.CHTFrequency - 1
+		reached := pm.blockchain.CurrentHeader().Number.Uint64() >= number
+		checkpoint = func() {
+			if !reached && pm.blockchain.CurrentHeader().Number.Uint64() >= number {
+				reached = true
+				pm.sendSyncEvent(SyncCheckpointReached, highest, nil)
+			}
+		}
+	}
+
+	quit, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(syncProgressInterval)
+		defer ticker.Stop()
+
+		last, lastTime := pm.blockchain.CurrentHeader().Number.Uint64(), time.Now()
+		for {
+			select {
+			case now := <-ticker.C:
+				current := pm.blockchain.CurrentHeader().Number.Uint64()
+				var rate float64
+				if current > last {
+					rate = float64(current-last) / now.Sub(lastTime).Seconds()
+				}
+				ev := SyncProgressEvent{
+					Section:       current / params.CHTFrequency,
+					Sections:      chtSections(highest),
+					Current:       current,
+					Highest:       highest,
+					HeadersPerSec: rate,
+				}
+				pm.eventMux.Post(ev)
+				checkpoint()
+				log.Debug("Header synchronisation progress", "section", ev.Section, "sections", ev.Sections, "number", current, "highest", highest, "rate", rate)
+				last, lastTime = current, now
+			case <-quit:
+				return
+			}
+		}
+	}()
+	return func(err error) {
+		close(quit)
+		<-done
+		checkpoint()
+		if err != nil {
+			pm.eventMux.Post(downloader.FailedEvent{Err: err})
+			pm.sendSyncEvent(SyncFailed, highest, err)
+			return
+		}
+		pm.eventMux.Post(downloader.DoneEvent{Latest: pm.blockchain.CurrentHeader()})
+		if pm.blockchain.CurrentHeader().Number.Uint64() >= highest {
+			pm.sendSyncEvent(SyncCaughtUp, highest, nil)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"truechain/discovery/event"
+	"truechain/discovery/light/fast"
+	"truechain/discovery/log"
+)
+
+const (
+	txAlertChanSize  = 16
+	txAlertQueueSize = 256              // undelivered alerts kept, newer ones are dropped
+	txAlertTimeout   = time.Second * 10 // time limit of delivering a single webhook call
+)
+
+// txAlerter forwards the reorg events of watched transactions to a webhook.
+type txAlerter struct {
+	pool    *fast.TxPool
+	url     string
+	client  *http.Client
+	eventCh chan fast.TxReorgEvent
+	queue   chan fast.TxReorgEvent // alerts waiting for delivery
+	sub     event.Subscription
+	quit    chan struct{}
+}
+
+// newTxAlerter creates a webhook alerter for the given url. It returns nil if
+// no url is configured.
+func newTxAlerter(pool *fast.TxPool, url string) *txAlerter {
+	if url == "" {
+		return nil
+	}
+	return &txAlerter{
+		pool:    pool,
+		url:     url,
+		client:  &http.Client{Timeout: txAlertTimeout},
+		eventCh: make(chan fast.TxReorgEvent, txAlertChanSize),
+		queue:   make(chan fast.TxReorgEvent, txAlertQueueSize),
+		quit:    make(chan struct{}),
+	}
+}
+
+// start subscribes to the reorg events of the transaction pool
+func (a *txAlerter) start() {
+	if a == nil {
+		return
+	}
+	a.sub = a.pool.SubscribeTxReorgEvent(a.eventCh)
+	go a.loop()
+	go a.deliverLoop()
+}
+
+// stop stops delivering alerts
+func (a *txAlerter) stop() {
+	if a == nil {
+		return
+	}
+	a.sub.Unsubscribe()
+	close(a.quit)
+}
+
+// loop queues the received events for delivery. It never waits for the
+// webhook, so the pool posting the events isn't held up by it. If the queue is
+// full, the event is dropped.
+func (a *txAlerter) loop() {
+	for {
+		select {
+		case ev := <-a.eventCh:
+			select {
+			case a.queue <- ev:
+			default:
+				log.Warn("Transaction alert queue full, dropping alert", "hash", ev.Hash, "reorged", ev.Reorged)
+			}
+		case <-a.quit:
+			return
+		}
+	}
+}
+
+// deliverLoop delivers the queued alerts to the webhook one by one.
+func (a *txAlerter) deliverLoop() {
+	for {
+		select {
+		case ev := <-a.queue:
+			a.post(ev)
+		case <-a.quit:
+			return
+		}
+	}
+}
+
+// post delivers a single event to the webhook. Delivery is not retried, the
+// failure is logged instead.
+func (a *txAlerter) post(ev fast.TxReorgEvent) {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		log.Error("Failed to encode transaction alert", "err", err)
+		return
+	}
+	resp, err := a.client.Post(a.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Warn("Failed to deliver transaction alert", "hash", ev.Hash, "err", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		log.Warn("Transaction alert rejected by webhook", "hash", ev.Hash, "status", resp.Status)
+	}
+}
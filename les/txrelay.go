@@ -19,15 +19,24 @@ package les
 import (
 	"context"
 	"sync"
+	"time"
 	"truechain/discovery/rlp"
 
 	"truechain/discovery/common"
+	"truechain/discovery/common/mclock"
 	"truechain/discovery/core/types"
+	"truechain/discovery/log"
 )
 
+// txResendInterval is the time after which a transaction still not mined is
+// rebroadcast, including to the servers it has already been sent to, which may
+// have dropped it.
+const txResendInterval = time.Minute
+
 type ltrInfo struct {
 	tx     *types.Transaction
 	sentTo map[*peer]struct{}
+	sentAt mclock.AbsTime // time the transaction was last sent to a server
 }
 
 type lesTxRelay struct {
@@ -38,19 +47,23 @@ type lesTxRelay struct {
 	peerStartPos int
 	lock         sync.RWMutex
 	stop         chan struct{}
+	wg           *sync.WaitGroup // tracks the resending loop of the light client
 
 	retriever *retrieveManager
 }
 
-func newLesTxRelay(ps *peerSet, retriever *retrieveManager) *lesTxRelay {
+func newLesTxRelay(ps *peerSet, retriever *retrieveManager, wg *sync.WaitGroup) *lesTxRelay {
 	r := &lesTxRelay{
 		txSent:    make(map[common.Hash]*ltrInfo),
 		txPending: make(map[common.Hash]struct{}),
 		ps:        ps,
 		retriever: retriever,
 		stop:      make(chan struct{}),
+		wg:        wg,
 	}
 	ps.notify(r)
+	r.wg.Add(1)
+	goLabeled("txRelay", func(*routine) { r.resendLoop() })
 	return r
 }
 
@@ -58,18 +71,37 @@ func (self *lesTxRelay) Stop() {
 	close(self.stop)
 }
 
+// stats returns the number of transactions sent and still waiting for a server.
+func (self *lesTxRelay) stats() (sent, pending int) {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+
+	return len(self.txSent), len(self.txPending)
+}
+
+// relayPeers returns the connected servers transactions may be relayed to.
+func (self *lesTxRelay) relayPeers() []*peer {
+	var list []*peer
+	for _, p := range self.ps.AllPeers() {
+		if p.relaysTxs() {
+			list = append(list, p)
+		}
+	}
+	return list
+}
+
 func (self *lesTxRelay) registerPeer(p *peer) {
 	self.lock.Lock()
 	defer self.lock.Unlock()
 
-	self.peerList = self.ps.AllPeers()
+	self.peerList = self.relayPeers()
 }
 
 func (self *lesTxRelay) unregisterPeer(p *peer) {
 	self.lock.Lock()
 	defer self.lock.Unlock()
 
-	self.peerList = self.ps.AllPeers()
+	self.peerList = self.relayPeers()
 }
 
 // send sends a list of transactions to at most a given number of peers at
@@ -102,6 +134,7 @@ func (self *lesTxRelay) send(txs types.Transactions, count int) {
 				if _, ok := ltr.sentTo[peer]; !ok {
 					sendTo[peer] = append(sendTo[peer], tx)
 					ltr.sentTo[peer] = struct{}{}
+					ltr.sentAt = self.retriever.clock.Now()
 					cnt--
 				}
 				if cnt == 0 {
@@ -173,6 +206,45 @@ func (self *lesTxRelay) NewHead(head common.Hash, mined []common.Hash, rollback
 	}
 }
 
+// resendLoop periodically rebroadcasts the transactions which haven't been mined
+// since they were last sent.
+func (self *lesTxRelay) resendLoop() {
+	defer self.wg.Done()
+
+	for {
+		select {
+		case <-self.retriever.clock.After(txResendInterval / 4):
+			self.resend()
+		case <-self.stop:
+			return
+		}
+	}
+}
+
+// resend rebroadcasts the pending transactions last sent before the resend
+// interval, forgetting the servers they were sent to.
+func (self *lesTxRelay) resend() {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	var (
+		now = self.retriever.clock.Now()
+		txs types.Transactions
+	)
+	for hash := range self.txPending {
+		ltr := self.txSent[hash]
+		if time.Duration(now-ltr.sentAt) < txResendInterval {
+			continue
+		}
+		ltr.sentTo = make(map[*peer]struct{})
+		txs = append(txs, ltr.tx)
+	}
+	if len(txs) > 0 {
+		log.Debug("Rebroadcasting pending transactions", "count", len(txs))
+		self.send(txs, 1)
+	}
+}
+
 func (self *lesTxRelay) Discard(hashes []common.Hash) {
 	self.lock.Lock()
 	defer self.lock.Unlock()
@@ -18,12 +18,29 @@ package les
 
 import (
 	"errors"
+	"sort"
+	"sync"
 
+	"truechain/discovery/etrue"
 	"truechain/discovery/log"
 	"truechain/discovery/p2p/enode"
 )
 
+// ULCStatus is the state of the ultra light client mode.
+type ULCStatus struct {
+	Enabled   bool     `json:"enabled"`
+	Fraction  int      `json:"fraction"`  // minimum percentage of trusted servers agreeing on a head
+	Servers   []string `json:"servers"`   // node ids of the trusted servers
+	Connected []string `json:"connected"` // node ids of the connected trusted servers
+}
+
+var (
+	errULCLastServer     = errors.New("cannot remove the last trusted server of the ultra light client")
+	errULCAnnounceQuorum = errors.New("heads are confirmed by the trusted fraction in ultra light client mode")
+)
+
 type ulc struct {
+	lock     sync.RWMutex // protects keys, which can be changed at runtime
 	keys     map[string]bool
 	fraction int
 }
@@ -48,7 +65,75 @@ func newULC(servers []string, fraction int) (*ulc, error) {
 	}, nil
 }
 
+// ulcConfig returns the trusted servers and the minimum trusted fraction of
+// the ultra light client, nil servers if it is disabled.
+func ulcConfig(config *etrue.Config) ([]string, int) {
+	if config.ULC == nil || len(config.ULC.TrustedServers) == 0 {
+		return nil, 0
+	}
+	fraction := config.ULC.MinTrustedFraction
+	if fraction <= 0 || fraction > 100 {
+		log.Warn("Invalid minimum trusted fraction of ultra light client, using default", "fraction", fraction, "default", etrue.DefaultULCMinTrustedFraction)
+		fraction = etrue.DefaultULCMinTrustedFraction
+	}
+	return config.ULC.TrustedServers, fraction
+}
+
+// status returns the state of the ultra light client mode.
+func (u *ulc) status(peers *peerSet) *ULCStatus {
+	if u == nil {
+		return &ULCStatus{}
+	}
+	u.lock.RLock()
+	status := &ULCStatus{Enabled: true, Fraction: u.fraction, Servers: make([]string, 0, len(u.keys)), Connected: []string{}}
+	for id := range u.keys {
+		status.Servers = append(status.Servers, id)
+	}
+	u.lock.RUnlock()
+
+	for _, p := range peers.AllPeers() {
+		if p.trusted {
+			status.Connected = append(status.Connected, p.ID().String())
+		}
+	}
+	sort.Strings(status.Servers)
+	sort.Strings(status.Connected)
+	return status
+}
+
 // trusted return an indicator that whether the specified peer is trusted.
 func (u *ulc) trusted(p enode.ID) bool {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
 	return u.keys[p.String()]
 }
+
+// count returns the number of trusted servers.
+func (u *ulc) count() int {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	return len(u.keys)
+}
+
+// add adds a trusted server.
+func (u *ulc) add(id enode.ID) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	u.keys[id.String()] = true
+}
+
+// remove removes a trusted server. The last one can't be removed as the ultra
+// light client can't be disabled at runtime.
+func (u *ulc) remove(id enode.ID) error {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	if u.keys[id.String()] && len(u.keys) == 1 {
+		return errULCLastServer
+	}
+	delete(u.keys, id.String())
+	return nil
+}
@@ -0,0 +1,278 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"truechain/discovery/common"
+	"truechain/discovery/common/hexutil"
+	"truechain/discovery/core/state"
+	"truechain/discovery/core/types"
+	"truechain/discovery/crypto"
+	"truechain/discovery/light/public"
+	"truechain/discovery/rlp"
+	"truechain/discovery/trie"
+)
+
+var (
+	errGenesisWithdrawal = errors.New("no withdrawal at the genesis block")
+	errProofBlockUnknown = errors.New("proof block not canonical")
+)
+
+// WithdrawalProof proves the locked staking balance and the balance of an
+// address right before and after a block, so that a withdrawal or an unlock
+// taking effect in that block can be confirmed without trusting the server
+// answering. The proofs are checked against the state roots of the block and
+// its parent, which must be checked against trusted headers.
+type WithdrawalProof struct {
+	Address common.Address      `json:"address"`
+	Number  hexutil.Uint64      `json:"number"`
+	Before  StakingBalanceProof `json:"before"`
+	After   StakingBalanceProof `json:"after"`
+}
+
+// StakingBalanceProof is the Merkle proof of the balances of an address in the
+// state of a block: the proof of its account, the one of the account of the
+// staking address and the one of the entry holding its locked balance in the
+// storage of the staking address.
+type StakingBalanceProof struct {
+	BlockHash    common.Hash     `json:"blockHash"`
+	StateRoot    common.Hash     `json:"stateRoot"`
+	AccountProof []hexutil.Bytes `json:"accountProof"`
+	StakingProof []hexutil.Bytes `json:"stakingProof"`
+	LockedProof  []hexutil.Bytes `json:"lockedProof"`
+}
+
+// WithdrawalResult is the effect of a block on the balances of an address, as
+// proven by a WithdrawalProof. Withdrawn is the decrease of the locked balance,
+// the balance also pays the fees of the transactions of the block.
+type WithdrawalResult struct {
+	Address       common.Address `json:"address"`
+	Number        hexutil.Uint64 `json:"number"`
+	LockedBefore  *hexutil.Big   `json:"lockedBefore"`
+	LockedAfter   *hexutil.Big   `json:"lockedAfter"`
+	BalanceBefore *hexutil.Big   `json:"balanceBefore"`
+	BalanceAfter  *hexutil.Big   `json:"balanceAfter"`
+	Withdrawn     *hexutil.Big   `json:"withdrawn"`
+}
+
+// VerifyWithdrawalProof checks a withdrawal proof against the state roots it
+// carries and returns the balances it proves. The caller is responsible for
+// checking the block hashes and state roots against trusted headers.
+func VerifyWithdrawalProof(proof *WithdrawalProof) (*WithdrawalResult, error) {
+	lockedBefore, balanceBefore, err := verifyStakingBalance(&proof.Before, proof.Address)
+	if err != nil {
+		return nil, fmt.Errorf("parent state: %v", err)
+	}
+	lockedAfter, balanceAfter, err := verifyStakingBalance(&proof.After, proof.Address)
+	if err != nil {
+		return nil, fmt.Errorf("block state: %v", err)
+	}
+	withdrawn := new(big.Int).Sub(lockedBefore, lockedAfter)
+	if withdrawn.Sign() < 0 {
+		withdrawn.SetUint64(0)
+	}
+	return &WithdrawalResult{
+		Address:       proof.Address,
+		Number:        proof.Number,
+		LockedBefore:  (*hexutil.Big)(lockedBefore),
+		LockedAfter:   (*hexutil.Big)(lockedAfter),
+		BalanceBefore: (*hexutil.Big)(balanceBefore),
+		BalanceAfter:  (*hexutil.Big)(balanceAfter),
+		Withdrawn:     (*hexutil.Big)(withdrawn),
+	}, nil
+}
+
+// verifyStakingBalance returns the locked balance and the balance of an
+// address proven against the state root of a balance proof.
+func verifyStakingBalance(p *StakingBalanceProof, addr common.Address) (locked, balance *big.Int, err error) {
+	account, err := verifyAccount(p.StateRoot, addr, p.AccountProof)
+	if err != nil {
+		return nil, nil, err
+	}
+	balance = new(big.Int)
+	if account != nil {
+		balance.Set(account.Balance)
+	}
+	staking, err := verifyAccount(p.StateRoot, types.StakingAddress, p.StakingProof)
+	if err != nil {
+		return nil, nil, err
+	}
+	locked = new(big.Int)
+	if staking == nil || staking.Root == types.EmptyRootHash {
+		return locked, balance, nil
+	}
+	key := state.LockedKey(addr)
+	enc, _, err := trie.VerifyProof(staking.Root, crypto.Keccak256(key[:]), proofNodes(p.LockedProof))
+	if err != nil {
+		return nil, nil, fmt.Errorf("locked balance: %v", err)
+	}
+	if len(enc) > 0 {
+		_, content, _, err := rlp.Split(enc)
+		if err != nil {
+			return nil, nil, fmt.Errorf("locked balance: %v", err)
+		}
+		locked.SetBytes(content)
+	}
+	return locked, balance, nil
+}
+
+// verifyAccount returns the account of an address proven against a state root,
+// nil if it's proven not to exist.
+func verifyAccount(root common.Hash, addr common.Address, proof []hexutil.Bytes) (*state.Account, error) {
+	enc, _, err := trie.VerifyProof(root, crypto.Keccak256(addr[:]), proofNodes(proof))
+	if err != nil {
+		return nil, fmt.Errorf("account %x: %v", addr, err)
+	}
+	if len(enc) == 0 {
+		return nil, nil
+	}
+	account := new(state.Account)
+	if err := rlp.DecodeBytes(enc, account); err != nil {
+		return nil, fmt.Errorf("account %x: %v", addr, err)
+	}
+	return account, nil
+}
+
+func proofNodes(proof []hexutil.Bytes) *public.NodeSet {
+	nodes := make(public.NodeList, len(proof))
+	for i, node := range proof {
+		nodes[i] = rlp.RawValue(node)
+	}
+	return nodes.NodeSet()
+}
+
+// withdrawalProof retrieves the proof of the balances of an address before and
+// after a canonical fast block.
+func (s *LightEtrue) withdrawalProof(ctx context.Context, addr common.Address, number uint64) (*WithdrawalProof, error) {
+	if number == 0 {
+		return nil, errGenesisWithdrawal
+	}
+	proof := &WithdrawalProof{Address: addr, Number: hexutil.Uint64(number)}
+	for _, p := range []struct {
+		number uint64
+		proof  *StakingBalanceProof
+	}{{number - 1, &proof.Before}, {number, &proof.After}} {
+		header, err := s.fblockchain.GetHeaderByNumberOdr(ctx, p.number)
+		if err != nil {
+			return nil, err
+		}
+		if header == nil {
+			return nil, errProofBlockUnknown
+		}
+		if err := s.stakingBalanceProof(ctx, header, addr, p.proof); err != nil {
+			return nil, err
+		}
+	}
+	return proof, nil
+}
+
+// stakingBalanceProof retrieves the state entries proving the balances of an
+// address in the state of a block and collects their proofs.
+func (s *LightEtrue) stakingBalanceProof(ctx context.Context, header *types.Header, addr common.Address, proof *StakingBalanceProof) error {
+	var (
+		accKey     = crypto.Keccak256(addr[:])
+		stakingKey = crypto.Keccak256(types.StakingAddress[:])
+		lockedKey  = state.LockedKey(addr)
+		keys       = newStateKeys()
+	)
+	keys.add(nil, accKey)
+	keys.add(nil, stakingKey)
+	keys.add(stakingKey, crypto.Keccak256(lockedKey[:]))
+	s.prefetchState(ctx, s.odr, header, keys)
+
+	proof.BlockHash, proof.StateRoot = header.Hash(), header.Root
+	st, err := trie.New(header.Root, trie.NewDatabase(s.chainDb))
+	if err != nil {
+		return err
+	}
+	if proof.AccountProof, err = proveEntry(st, accKey); err != nil {
+		return err
+	}
+	if proof.StakingProof, err = proveEntry(st, stakingKey); err != nil {
+		return err
+	}
+	enc, err := st.TryGet(stakingKey)
+	if err != nil || len(enc) == 0 {
+		return err
+	}
+	var staking state.Account
+	if err := rlp.DecodeBytes(enc, &staking); err != nil {
+		return err
+	}
+	if staking.Root == types.EmptyRootHash {
+		return nil
+	}
+	storage, err := trie.New(staking.Root, trie.NewDatabase(s.chainDb))
+	if err != nil {
+		return err
+	}
+	proof.LockedProof, err = proveEntry(storage, crypto.Keccak256(lockedKey[:]))
+	return err
+}
+
+// proveEntry returns the proof of an entry of a local trie.
+func proveEntry(t *trie.Trie, key []byte) ([]hexutil.Bytes, error) {
+	var nodes public.NodeList
+	if err := t.Prove(key, 0, &nodes); err != nil {
+		return nil, err
+	}
+	proof := make([]hexutil.Bytes, len(nodes))
+	for i, node := range nodes {
+		proof[i] = hexutil.Bytes(node)
+	}
+	return proof, nil
+}
+
+// verifyWithdrawal checks the blocks of a withdrawal proof against the
+// canonical fast chain, then the proof itself.
+func (s *LightEtrue) verifyWithdrawal(ctx context.Context, proof *WithdrawalProof) (*WithdrawalResult, error) {
+	number := uint64(proof.Number)
+	if number == 0 {
+		return nil, errGenesisWithdrawal
+	}
+	for _, p := range []struct {
+		number uint64
+		proof  *StakingBalanceProof
+	}{{number - 1, &proof.Before}, {number, &proof.After}} {
+		header, err := s.fblockchain.GetHeaderByNumberOdr(ctx, p.number)
+		if err != nil {
+			return nil, err
+		}
+		if header == nil || header.Hash() != p.proof.BlockHash || header.Root != p.proof.StateRoot {
+			return nil, errProofBlockUnknown
+		}
+	}
+	return VerifyWithdrawalProof(proof)
+}
+
+// GetWithdrawalProof returns the Merkle proof of the locked staking balance and
+// the balance of an address before and after a block, confirming a withdrawal
+// or an unlock taking effect in it.
+func (api *PublicLightImpawnAPI) GetWithdrawalProof(ctx context.Context, addr common.Address, number hexutil.Uint64) (*WithdrawalProof, error) {
+	return api.client.withdrawalProof(ctx, addr, uint64(number))
+}
+
+// VerifyWithdrawal checks a withdrawal proof against the canonical chain and
+// returns the balances it proves.
+func (api *PublicLightImpawnAPI) VerifyWithdrawal(ctx context.Context, proof WithdrawalProof) (*WithdrawalResult, error) {
+	return api.client.verifyWithdrawal(ctx, &proof)
+}
@@ -0,0 +1,219 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+
+	"truechain/discovery/common"
+	"truechain/discovery/crypto"
+	"truechain/discovery/light/public"
+	"truechain/discovery/rlp"
+)
+
+// Proof formats selectable on the client side.
+const (
+	proofFormatRaw     = "raw"     // plain list of the trie nodes
+	proofFormatCompact = "compact" // compact witness, see compactWitness
+)
+
+var errInvalidWitness = errors.New("invalid compact witness")
+
+// proofCapabilities returns the capabilities announced with the given proof
+// format.
+func proofCapabilities(format string) ([]string, error) {
+	switch format {
+	case "", proofFormatCompact:
+		return localCapabilities, nil
+	case proofFormatRaw:
+		var caps []string
+		for _, c := range localCapabilities {
+			if c != capCompactWitness {
+				caps = append(caps, c)
+			}
+		}
+		return caps, nil
+	}
+	return nil, fmt.Errorf("unknown proof format %q, want %q or %q", format, proofFormatRaw, proofFormatCompact)
+}
+
+// splitNode splits an RLP encoded trie node into its encoded items.
+func splitNode(node []byte) ([]rlp.RawValue, error) {
+	content, _, err := rlp.SplitList(node)
+	if err != nil {
+		return nil, err
+	}
+	var items []rlp.RawValue
+	for len(content) > 0 {
+		_, _, rest, err := rlp.Split(content)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, content[:len(content)-len(rest)])
+		content = rest
+	}
+	return items, nil
+}
+
+// refSlots returns the items of a trie node which may reference a child by
+// hash: the children of a full node and the value of an extension node.
+func refSlots(items []rlp.RawValue) []int {
+	switch len(items) {
+	case 17:
+		return []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+	case 2:
+		key, _, err := rlp.SplitString(items[0])
+		if err == nil && len(key) > 0 && key[0]>>4 < 2 {
+			return []int{1} // hex prefix flag of an extension node
+		}
+	}
+	return nil
+}
+
+// compactWitness encodes a list of trie nodes as a compact witness. The nodes
+// are de-duplicated and sorted so that parents precede their children, the
+// references of a parent to the children in the witness are replaced by a
+// single element list holding the index of the child. The entries are thus
+// still RLP lists, sent in place of the node list. Nodes which can't be parsed
+// are kept unchanged.
+func compactWitness(list public.NodeList) public.NodeList {
+	var (
+		nodes    = make(map[common.Hash][]rlp.RawValue)
+		raw      = make(map[common.Hash]rlp.RawValue)
+		children = make(map[common.Hash][]common.Hash)
+		hashes   []common.Hash
+	)
+	for _, node := range list {
+		hash := crypto.Keccak256Hash(node)
+		if _, ok := raw[hash]; ok {
+			continue
+		}
+		raw[hash] = node
+		hashes = append(hashes, hash)
+		if items, err := splitNode(node); err == nil {
+			nodes[hash] = items
+		}
+	}
+	referenced := make(map[common.Hash]bool)
+	for hash, items := range nodes {
+		for _, slot := range refSlots(items) {
+			content, _, err := rlp.SplitString(items[slot])
+			if err != nil || len(content) != common.HashLength {
+				continue
+			}
+			child := common.BytesToHash(content)
+			if _, ok := raw[child]; ok && child != hash {
+				children[hash] = append(children[hash], child)
+				referenced[child] = true
+			}
+		}
+	}
+	// Order the nodes topologically, the roots sorted by hash
+	sort.Slice(hashes, func(i, j int) bool { return bytes.Compare(hashes[i][:], hashes[j][:]) < 0 })
+	var (
+		order   []common.Hash
+		visited = make(map[common.Hash]bool)
+		visit   func(hash common.Hash)
+	)
+	visit = func(hash common.Hash) {
+		if visited[hash] {
+			return
+		}
+		visited[hash] = true
+		for _, child := range children[hash] {
+			visit(child)
+		}
+		order = append(order, hash)
+	}
+	for _, hash := range hashes {
+		if !referenced[hash] {
+			visit(hash)
+		}
+	}
+	for _, hash := range hashes {
+		visit(hash) // only reachable through a cycle, which can't happen
+	}
+	for i := 0; i < len(order)/2; i++ {
+		order[i], order[len(order)-1-i] = order[len(order)-1-i], order[i]
+	}
+	index := make(map[common.Hash]uint64, len(order))
+	for i, hash := range order {
+		index[hash] = uint64(i)
+	}
+	// Replace the references by the indexes
+	witness := make(public.NodeList, len(order))
+	for i, hash := range order {
+		items, ok := nodes[hash]
+		if !ok || len(children[hash]) == 0 {
+			witness[i] = raw[hash]
+			continue
+		}
+		items = append([]rlp.RawValue{}, items...)
+		for _, slot := range refSlots(items) {
+			content, _, err := rlp.SplitString(items[slot])
+			if err != nil || len(content) != common.HashLength {
+				continue
+			}
+			if idx, ok := index[common.BytesToHash(content)]; ok && idx > uint64(i) {
+				items[slot], _ = rlp.EncodeToBytes([]uint64{idx})
+			}
+		}
+		witness[i], _ = rlp.EncodeToBytes(items)
+	}
+	return witness
+}
+
+// expandWitness decodes a compact witness into the list of trie nodes. The
+// entries are processed from the last one, so that the hashes of the children
+// are known when a reference is replaced.
+func expandWitness(witness public.NodeList) (public.NodeList, error) {
+	var (
+		nodes  = make(public.NodeList, len(witness))
+		hashes = make([]common.Hash, len(witness))
+	)
+	for i := len(witness) - 1; i >= 0; i-- {
+		items, err := splitNode(witness[i])
+		if err != nil {
+			// Not a trie node, sent unchanged
+			nodes[i], hashes[i] = witness[i], crypto.Keccak256Hash(witness[i])
+			continue
+		}
+		replaced := false
+		for _, slot := range refSlots(items) {
+			var ref []uint64
+			if rlp.DecodeBytes(items[slot], &ref) != nil || len(ref) != 1 {
+				continue
+			}
+			// References may only point to later entries, ruling out cycles
+			if ref[0] <= uint64(i) || ref[0] >= uint64(len(witness)) {
+				return nil, errInvalidWitness
+			}
+			items[slot], _ = rlp.EncodeToBytes(hashes[ref[0]][:])
+			replaced = true
+		}
+		if replaced {
+			nodes[i], _ = rlp.EncodeToBytes(items)
+		} else {
+			nodes[i] = witness[i]
+		}
+		hashes[i] = crypto.Keccak256Hash(nodes[i])
+	}
+	return nodes, nil
+}
@@ -0,0 +1,156 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"fmt"
+	"testing"
+
+	"truechain/discovery/common"
+	"truechain/discovery/crypto"
+	"truechain/discovery/etruedb"
+	"truechain/discovery/light/public"
+	"truechain/discovery/rlp"
+	"truechain/discovery/trie"
+)
+
+// makeMultiProof returns the root of a trie and the merged proof of the given
+// number of its keys, each node listed once per key proving through it.
+func makeMultiProof(t *testing.T, keys int) (common.Hash, [][]byte, public.NodeList) {
+	tr, _ := trie.New(common.Hash{}, trie.NewDatabase(etruedb.NewMemDatabase()))
+	for i := 0; i < 1000; i++ {
+		tr.Update(crypto.Keccak256([]byte(fmt.Sprintf("key-%d", i))), []byte(fmt.Sprintf("value-%d", i)))
+	}
+	root, err := tr.Commit(nil)
+	if err != nil {
+		t.Fatalf("failed to commit trie: %v", err)
+	}
+	var (
+		proven [][]byte
+		list   public.NodeList
+	)
+	for i := 0; i < keys; i++ {
+		key := crypto.Keccak256([]byte(fmt.Sprintf("key-%d", i*7)))
+		proof := public.NewNodeSet()
+		if err := tr.Prove(key, 0, proof); err != nil {
+			t.Fatalf("failed to prove key: %v", err)
+		}
+		proven = append(proven, key)
+		list = append(list, proof.NodeList()...)
+	}
+	return root, proven, list
+}
+
+// fullNodeRef returns a full node entry of a witness, its first child being a
+// reference to the given entry.
+func fullNodeRef(ref uint64) []byte {
+	items := make([]rlp.RawValue, 17)
+	for i := range items {
+		items[i] = rlp.RawValue{0x80}
+	}
+	items[0], _ = rlp.EncodeToBytes([]uint64{ref})
+	enc, _ := rlp.EncodeToBytes(items)
+	return enc
+}
+
+// Tests that the proofs compacted into a witness are expanded into the same
+// nodes, each one once, and still prove the keys.
+func TestWitnessRoundTrip(t *testing.T) {
+	for _, keys := range []int{1, 2, 10, 50} {
+		root, proven, list := makeMultiProof(t, keys)
+		unique := list.NodeSet()
+
+		witness := compactWitness(list)
+		if len(witness) != unique.KeyCount() {
+			t.Errorf("%d keys: witness entry count mismatch: have %d, want %d", keys, len(witness), unique.KeyCount())
+		}
+		if size := witness.NodeSet().DataSize(); size >= unique.DataSize() {
+			t.Errorf("%d keys: witness not smaller than the proof: %d >= %d", keys, size, unique.DataSize())
+		}
+		nodes, err := expandWitness(witness)
+		if err != nil {
+			t.Fatalf("%d keys: failed to expand witness: %v", keys, err)
+		}
+		set := nodes.NodeSet()
+		if set.KeyCount() != unique.KeyCount() {
+			t.Errorf("%d keys: expanded node count mismatch: have %d, want %d", keys, set.KeyCount(), unique.KeyCount())
+		}
+		for _, node := range unique.NodeList() {
+			if ok, _ := set.Has(crypto.Keccak256(node)); !ok {
+				t.Errorf("%d keys: node %x missing from the expanded witness", keys, crypto.Keccak256(node))
+			}
+		}
+		for _, key := range proven {
+			if _, _, err := trie.VerifyProof(root, key, set); err != nil {
+				t.Errorf("%d keys: expanded proof of %x invalid: %v", keys, key, err)
+			}
+		}
+	}
+}
+
+// Tests that malformed witnesses are rejected or expanded into nodes failing
+// the proof verification, without panicking.
+func TestWitnessMalformed(t *testing.T) {
+	root, proven, list := makeMultiProof(t, 10)
+	witness := compactWitness(list)
+
+	// References to the entry itself, earlier ones or missing ones are invalid
+	tests := []public.NodeList{
+		{fullNodeRef(0)},
+		{fullNodeRef(1), fullNodeRef(0)},
+		{fullNodeRef(2), fullNodeRef(2)},
+		{fullNodeRef(1 << 62)},
+		witness[:len(witness)-1], // the last entry is always referenced
+	}
+	for i, w := range tests {
+		if _, err := expandWitness(w); err != errInvalidWitness {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, errInvalidWitness)
+		}
+	}
+	// Entries which aren't trie nodes are passed on unchanged
+	garbage := public.NodeList{{}, {0x01}, {0xc5, 0x01}, {0xf9}}
+	nodes, err := expandWitness(garbage)
+	if err != nil {
+		t.Fatalf("failed to expand garbage: %v", err)
+	}
+	for i := range garbage {
+		if string(nodes[i]) != string(garbage[i]) {
+			t.Errorf("garbage entry %d changed: have %x, want %x", i, nodes[i], garbage[i])
+		}
+	}
+	// Truncated entries make the proofs fail
+	for i := range witness {
+		for _, cut := range []int{1, len(witness[i]) / 2, len(witness[i]) - 1} {
+			w := append(public.NodeList{}, witness...)
+			w[i] = w[i][:cut]
+			nodes, err := expandWitness(w)
+			if err != nil {
+				continue
+			}
+			set := nodes.NodeSet()
+			failed := false
+			for _, key := range proven {
+				if _, _, err := trie.VerifyProof(root, key, set); err != nil {
+					failed = true
+				}
+			}
+			if !failed {
+				t.Errorf("entry %d truncated to %d bytes: proofs still valid", i, cut)
+			}
+		}
+	}
+}
@@ -252,6 +252,12 @@ func (lc *LightChain) GetBodyRLP(ctx context.Context, hash common.Hash) (rlp.Raw
 	return body, nil
 }
 
+// CacheSizes returns the number of entries held in the body, RLP encoded body
+// and block caches.
+func (lc *LightChain) CacheSizes() (bodies, bodyRLPs, blocks int) {
+	return lc.bodyCache.Len(), lc.bodyRLPCache.Len(), lc.blockCache.Len()
+}
+
 // HasBlock checks if a block is fully present in the database or not, caching
 // it if present.
 func (lc *LightChain) HasBlock(hash common.Hash, number uint64) bool {
@@ -384,7 +390,8 @@ func (lc *LightChain) InsertHeaderChain(chain []*types.Header, checkFreq int) (i
 	for _, head := range chain {
 		if head.CommitteeHash != (types.EmptySignHash) {
 			if inject, ok := lc.infoQueue[head.Hash()]; ok {
-				if err == nil {
+				// Infos not matching the header are left to be retrieved on demand
+				if err == nil && types.RlpHash(inject.infos) == head.CommitteeHash {
 					rawdb.WriteCommitteeInfo(lc.chainDb, head.Hash(), head.Number.Uint64(), inject.infos)
 				}
 				delete(lc.infoQueue, head.Hash())
@@ -453,6 +460,16 @@ func (lc *LightChain) GetSwitchInfo(number uint64) []*types.CommitteeMember {
 	return rawdb.ReadCommitteeInfo(lc.chainDb, head.Hash(), number)
 }
 
+// GetSwitchInfoOdr retrieves a block switchinfo from database or network,
+// validated against the committee hash of the header.
+func (lc *LightChain) GetSwitchInfoOdr(ctx context.Context, number uint64) ([]*types.CommitteeMember, error) {
+	head, err := lc.GetHeaderByNumberOdr(ctx, number)
+	if head == nil {
+		return nil, err
+	}
+	return GetCommitteeInfo(ctx, lc.odr, head.Hash(), number)
+}
+
 // GetHeaderByNumberOdr retrieves a block header from the database or network
 // by number, caching it (associated with its hash) if found.
 func (lc *LightChain) GetHeaderByNumberOdr(ctx context.Context, number uint64) (*types.Header, error) {
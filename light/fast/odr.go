@@ -81,9 +81,10 @@ func StorageTrieID(state *TrieID, addrHash, root common.Hash) *TrieID {
 // TrieRequest is the ODR request type for state/storage trie entries
 type TrieRequest struct {
 	OdrRequest
-	Id    *TrieID
-	Key   []byte
-	Proof *public.NodeSet
+	Id     *TrieID
+	Key    []byte
+	Decoys [][]byte // Keys requested together with Key to hide it from the server
+	Proof  *public.NodeSet
 }
 
 // StoreResult stores the retrieved data in local database
@@ -117,6 +118,20 @@ func (req *BlockRequest) StoreResult(db etruedb.Database) {
 	rawdb.WriteBodyRLP(db, req.Hash, req.Number, req.Rlp)
 }
 
+// CommitteeRequest is the ODR request type for retrieving the committee switch
+// infos of a fast block
+type CommitteeRequest struct {
+	OdrRequest
+	Hash   common.Hash
+	Number uint64
+	Infos  []*types.CommitteeMember
+}
+
+// StoreResult stores the retrieved data in local database
+func (req *CommitteeRequest) StoreResult(db etruedb.Database) {
+	rawdb.WriteCommitteeInfo(db, req.Hash, req.Number, req.Infos)
+}
+
 // ReceiptsRequest is the ODR request type for retrieving block bodies
 type ReceiptsRequest struct {
 	OdrRequest
@@ -174,3 +189,16 @@ type TxStatusRequest struct {
 
 // StoreResult stores the retrieved data in local database
 func (req *TxStatusRequest) StoreResult(db etruedb.Database) {}
+
+// BlockFiltersRequest is the ODR request type for retrieving the compact log
+// filters of a consecutive range of blocks ending at LastNumber. Filters are not
+// committed to by the headers, so they are never stored.
+type BlockFiltersRequest struct {
+	OdrRequest
+	Hashes     []common.Hash
+	LastNumber uint64
+	Filters    [][]byte
+}
+
+// StoreResult stores the retrieved data in local database
+func (req *BlockFiltersRequest) StoreResult(db etruedb.Database) {}
@@ -83,6 +83,26 @@ func GetBody(ctx context.Context, odr OdrBackend, hash common.Hash, number uint6
 	return body, nil
 }
 
+// GetCommitteeInfo retrieves the committee switch infos of a fast block, nil if
+// the block doesn't switch the committee.
+func GetCommitteeInfo(ctx context.Context, odr OdrBackend, hash common.Hash, number uint64) ([]*types.CommitteeMember, error) {
+	header := rawdb.ReadHeader(odr.Database(), hash, number)
+	if header == nil {
+		return nil, ErrNoHeader
+	}
+	if header.CommitteeHash == types.EmptySignHash {
+		return nil, nil
+	}
+	if infos := rawdb.ReadCommitteeInfo(odr.Database(), hash, number); infos != nil {
+		return infos, nil
+	}
+	r := &CommitteeRequest{Hash: hash, Number: number}
+	if err := odr.FastRetrieve(ctx, r); err != nil {
+		return nil, err
+	}
+	return r.Infos, nil
+}
+
 // GetBlock retrieves an entire block corresponding to the hash, assembling it
 // back from the stored header and body.
 func GetBlock(ctx context.Context, odr OdrBackend, hash common.Hash, number uint64) (*types.Block, error) {
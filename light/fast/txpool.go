@@ -18,7 +18,10 @@ package fast
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math/big"
+	"sort"
 	"sync"
 	"time"
 
@@ -43,16 +46,48 @@ const (
 // considered permanent and no rollback is expected
 var txPermanent = uint64(500)
 
+// watchCheckInterval is the minimum time between two lookups of the watched
+// transactions which are not included at the moment.
+const watchCheckInterval = time.Second * 30
+
+const (
+	// priceFloorDivisor and priceCeilMultiplier derive the relay gas price
+	// bounds from the suggested gas price if they are not configured.
+	priceFloorDivisor   = 10
+	priceCeilMultiplier = 100
+)
+
+var (
+	// ErrGasPriceTooHigh is returned if a transaction's gas price is above the
+	// maximum relayed by the pool.
+	ErrGasPriceTooHigh = errors.New("gas price exceeds relay maximum")
+
+	// ErrAccountLimitExceeded is returned if the sender of a transaction already
+	// has the maximum number of pending transactions in the pool.
+	ErrAccountLimitExceeded = errors.New("account pending transaction limit exceeded")
+
+	// ErrTxPoolFull is returned if the pool holds the maximum number of pending
+	// transactions and no other sender has more of them than the transaction's.
+	ErrTxPoolFull = errors.New("transaction pool is full")
+)
+
+// PriceOracle suggests a gas price based on recent blocks.
+type PriceOracle interface {
+	SuggestPrice(ctx context.Context) (*big.Int, error)
+}
+
 // TxPool implements the transaction pool for light clients, which keeps track
 // of the status of locally created transactions, detecting if they are included
 // in a block (mined) or rolled back. There are no queued transactions since we
 // always receive all locally signed transactions in the same order as they are
-// created.
+// created. A pending transaction is replaced by one of the same sender and nonce
+// paying a sufficiently higher gas price.
 type TxPool struct {
 	config       *params.ChainConfig
 	signer       types.Signer
 	quit         chan bool
 	txFeed       event.Feed
+	reorgFeed    event.Feed
 	scope        event.SubscriptionScope
 	chainHeadCh  chan types.FastChainHeadEvent
 	chainHeadSub event.Subscription
@@ -66,6 +101,16 @@ type TxPool struct {
 	pending      map[common.Hash]*types.Transaction   // pending transactions by tx hash
 	mined        map[common.Hash][]*types.Transaction // mined transactions by block hash
 	clearIdx     uint64                               // earliest block nr that can contain mined tx info
+	watched      map[common.Hash]*WatchedTx           // watched transactions by tx hash
+	watchChecked time.Time                            // last lookup of the watched transactions not included
+	reorgEvents  []TxReorgEvent                       // reorg events to post once the lock is released
+
+	minPrice, maxPrice *big.Int    // gas price bounds of relayed transactions, nil if derived
+	oracle             PriceOracle // gas price oracle deriving the missing bounds, nil if unbounded
+
+	accountSlots uint64 // maximum pending transactions of a sender, 0 if unlimited
+	globalSlots  uint64 // maximum pending transactions of all senders, 0 if unlimited
+	priceBump    uint64 // minimum price bump percentage to replace a pending transaction
 }
 
 // TxRelayBackend provides an interface to the mechanism that forwards transacions
@@ -91,6 +136,7 @@ func NewTxPool(config *params.ChainConfig, chain *LightChain, relay TxRelayBacke
 		nonce:       make(map[common.Address]uint64),
 		pending:     make(map[common.Hash]*types.Transaction),
 		mined:       make(map[common.Hash][]*types.Transaction),
+		watched:     make(map[common.Hash]*WatchedTx),
 		quit:        make(chan bool),
 		chainHeadCh: make(chan types.FastChainHeadEvent, chainHeadChanSize),
 		chain:       chain,
@@ -99,6 +145,7 @@ func NewTxPool(config *params.ChainConfig, chain *LightChain, relay TxRelayBacke
 		chainDb:     chain.Odr().Database(),
 		head:        chain.CurrentHeader().Hash(),
 		clearIdx:    chain.CurrentHeader().Number.Uint64(),
+		priceBump:   core.DefaultTxPoolConfig.PriceBump,
 	}
 	// Subscribe events from blockchain
 	pool.chainHeadSub = pool.chain.SubscribeChainHeadEvent(pool.chainHeadCh)
@@ -107,6 +154,66 @@ func NewTxPool(config *params.ChainConfig, chain *LightChain, relay TxRelayBacke
 	return pool
 }
 
+// SetPriceBounds sets the gas price bounds enforced before relaying a
+// transaction, so that mistyped prices are not broadcast. A nil bound is
+// derived from the price suggested by the oracle, if one is given.
+func (pool *TxPool) SetPriceBounds(min, max *big.Int, oracle PriceOracle) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	pool.minPrice, pool.maxPrice, pool.oracle = min, max, oracle
+}
+
+// SetPendingLimits sets the maximum number of pending transactions per sender
+// and in total, so that a single sender can't bloat the pool and the relay
+// bandwidth of a shared light client. Zero disables a limit.
+func (pool *TxPool) SetPendingLimits(account, global uint64) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	pool.accountSlots, pool.globalSlots = account, global
+}
+
+// SetPriceBump sets the minimum percentage by which the gas price of a
+// transaction has to exceed the one of the pending transaction of the same
+// sender and nonce to replace it.
+func (pool *TxPool) SetPriceBump(bump uint64) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	pool.priceBump = bump
+}
+
+// PriceBump returns the minimum percentage by which the gas price of a
+// transaction has to be raised to replace a pending one.
+func (pool *TxPool) PriceBump() uint64 {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	return pool.priceBump
+}
+
+// priceBounds returns the gas price bounds of relayed transactions, nil if
+// a bound is not enforced.
+func (pool *TxPool) priceBounds(ctx context.Context) (min, max *big.Int) {
+	min, max = pool.minPrice, pool.maxPrice
+	if (min != nil && max != nil) || pool.oracle == nil {
+		return min, max
+	}
+	price, err := pool.oracle.SuggestPrice(ctx)
+	if err != nil || price == nil || price.Sign() <= 0 {
+		log.Debug("Failed to derive relay gas price bounds", "err", err)
+		return min, max
+	}
+	if min == nil {
+		min = new(big.Int).Div(price, big.NewInt(priceFloorDivisor))
+	}
+	if max == nil {
+		max = new(big.Int).Mul(price, big.NewInt(priceCeilMultiplier))
+	}
+	return min, max
+}
+
 // currentState returns the light state of the current head header
 func (pool *TxPool) currentState(ctx context.Context) *state.StateDB {
 	return NewState(ctx, pool.chain.CurrentHeader(), pool.odr)
@@ -243,6 +350,7 @@ func (pool *TxPool) reorgOnNewHead(ctx context.Context, newHeader *types.Header)
 	for _, hash := range oldHashes {
 		pool.rollbackTxs(hash, txc)
 	}
+	pool.rollbackWatched(oldHashes)
 	pool.head = oldh.Hash()
 	// check mined txs of new blocks (array is in reversed order)
 	for i := len(newHashes) - 1; i >= 0; i-- {
@@ -271,7 +379,14 @@ func (pool *TxPool) reorgOnNewHead(ctx context.Context, newHeader *types.Header)
 		}
 		pool.clearIdx = idx2
 	}
-
+	// look up the watched transactions which are not included at the moment.
+	// A failed lookup is retried later, it doesn't hold up the new head.
+	if time.Since(pool.watchChecked) >= watchCheckInterval {
+		pool.watchChecked = time.Now()
+		if err := pool.checkWatched(ctx); err != nil {
+			log.Debug("Failed to look up watched transactions", "err", err)
+		}
+	}
 	return txc, nil
 }
 
@@ -299,8 +414,6 @@ func (pool *TxPool) eventLoop() {
 
 func (pool *TxPool) setNewHead(head *types.Header) {
 	pool.mu.Lock()
-	defer pool.mu.Unlock()
-
 	ctx, cancel := context.WithTimeout(context.Background(), blockCheckTimeout)
 	defer cancel()
 
@@ -308,6 +421,15 @@ func (pool *TxPool) setNewHead(head *types.Header) {
 	m, r := txc.getLists()
 	pool.relay.NewHead(pool.head, m, r)
 	pool.signer = types.MakeSigner(pool.config, head.Number)
+	events := pool.reorgEvents
+	pool.reorgEvents = nil
+	pool.mu.Unlock()
+
+	// Post the reorg events without holding the lock, a slow subscriber
+	// mustn't block the pool
+	for _, ev := range events {
+		pool.reorgFeed.Send(ev)
+	}
 }
 
 // Stop stops the light transaction pool
@@ -348,9 +470,21 @@ func (pool *TxPool) validateTx(ctx context.Context, tx *types.Transaction) error
 	if from, err = types.Sender(pool.signer, tx); err != nil {
 		return core.ErrInvalidSender
 	}
+	// Reject gas prices outside of the relay bounds
+	min, max := pool.priceBounds(ctx)
+	if min != nil && tx.GasPrice().Cmp(min) < 0 {
+		return core.ErrUnderpriced
+	}
+	if max != nil && tx.GasPrice().Cmp(max) > 0 {
+		return ErrGasPriceTooHigh
+	}
 	// Last but not least check for nonce errors
 	currentState := pool.currentState(ctx)
-	if n := currentState.GetNonce(from); n > tx.Nonce() {
+	nonce := currentState.GetNonce(from)
+	if err := currentState.Error(); err != nil {
+		return err // the state isn't available, not a verdict on the transaction
+	}
+	if nonce > tx.Nonce() {
 		return core.ErrNonceTooLow
 	}
 
@@ -370,7 +504,11 @@ func (pool *TxPool) validateTx(ctx context.Context, tx *types.Transaction) error
 
 	// Transactor should have enough funds to cover the costs
 	// cost == V + GP * GL
-	if b := currentState.GetBalance(from); b.Cmp(tx.Cost()) < 0 {
+	balance := currentState.GetBalance(from)
+	if err := currentState.Error(); err != nil {
+		return err
+	}
+	if balance.Cmp(tx.Cost()) < 0 {
 		return core.ErrInsufficientFunds
 	}
 
@@ -397,15 +535,22 @@ func (pool *TxPool) add(ctx context.Context, tx *types.Transaction) error {
 	if err != nil {
 		return err
 	}
+	from, _ := types.Sender(pool.signer, tx)
+	if old := pool.pendingNonce(from, tx.Nonce()); old != nil {
+		if err := pool.replace(old, tx); err != nil {
+			return err
+		}
+	} else if err := pool.makeRoom(from); err != nil {
+		return err
+	}
 
 	if _, ok := pool.pending[hash]; !ok {
 		pool.pending[hash] = tx
 
 		nonce := tx.Nonce() + 1
 
-		addr, _ := types.Sender(pool.signer, tx)
-		if nonce > pool.nonce[addr] {
-			pool.nonce[addr] = nonce
+		if nonce > pool.nonce[from] {
+			pool.nonce[from] = nonce
 		}
 
 		// Notify the subscribers. This event is posted in a goroutine
@@ -419,6 +564,84 @@ func (pool *TxPool) add(ctx context.Context, tx *types.Transaction) error {
 	return nil
 }
 
+// pendingNonce returns the pending transaction of a sender with the given nonce,
+// nil if there is none.
+func (pool *TxPool) pendingNonce(from common.Address, nonce uint64) *types.Transaction {
+	for _, tx := range pool.pending {
+		if tx.Nonce() != nonce {
+			continue
+		}
+		if sender, _ := types.Sender(pool.signer, tx); sender == from {
+			return tx
+		}
+	}
+	return nil
+}
+
+// replace drops a pending transaction in favour of a new one with the same
+// sender and nonce, if the new one's gas price exceeds the old one's by at
+// least the price bump, so that a stuck transaction can be sped up.
+func (pool *TxPool) replace(old, tx *types.Transaction) error {
+	threshold := new(big.Int).Mul(old.GasPrice(), new(big.Int).SetUint64(100+pool.priceBump))
+	threshold.Div(threshold, big.NewInt(100))
+	if old.GasPrice().Cmp(tx.GasPrice()) >= 0 || threshold.Cmp(tx.GasPrice()) > 0 {
+		return core.ErrReplaceUnderpriced
+	}
+	hash := old.Hash()
+	delete(pool.pending, hash)
+	pool.chainDb.Delete(hash[:])
+	pool.relay.Discard([]common.Hash{hash})
+	log.Debug("Replaced pending transaction", "old", hash, "new", tx.Hash(), "gasprice", tx.GasPrice())
+	return nil
+}
+
+// makeRoom enforces the pending limits before a transaction of the given sender
+// is added. A sender at its own limit is rejected. If the pool is full, the
+// highest nonce transaction of the sender with the most pending ones is evicted,
+// unless that sender wouldn't have more pending transactions than the new one's.
+func (pool *TxPool) makeRoom(from common.Address) error {
+	if pool.accountSlots == 0 && pool.globalSlots == 0 {
+		return nil
+	}
+	counts := make(map[common.Address]uint64)
+	for _, tx := range pool.pending {
+		sender, _ := types.Sender(pool.signer, tx)
+		counts[sender]++
+	}
+	if pool.accountSlots != 0 && counts[from] >= pool.accountSlots {
+		return ErrAccountLimitExceeded
+	}
+	if pool.globalSlots == 0 || uint64(len(pool.pending)) < pool.globalSlots {
+		return nil
+	}
+	var victim common.Address
+	for sender, count := range counts {
+		if count > counts[victim] {
+			victim = sender
+		}
+	}
+	if counts[victim] <= counts[from]+1 {
+		return ErrTxPoolFull
+	}
+	// Evict the victim's highest nonce transaction, which is mined last and
+	// doesn't leave a nonce gap in the remaining ones
+	var evict *types.Transaction
+	for _, tx := range pool.pending {
+		if sender, _ := types.Sender(pool.signer, tx); sender == victim && (evict == nil || tx.Nonce() > evict.Nonce()) {
+			evict = tx
+		}
+	}
+	hash := evict.Hash()
+	delete(pool.pending, hash)
+	pool.chainDb.Delete(hash[:])
+	pool.relay.Discard([]common.Hash{hash})
+	if pool.nonce[victim] > evict.Nonce() {
+		pool.nonce[victim] = evict.Nonce()
+	}
+	log.Debug("Evicted pending transaction", "hash", hash, "from", victim, "pending", counts[victim])
+	return nil
+}
+
 // Add adds a transaction to the pool if valid and passes it to the tx relay
 // backend
 func (pool *TxPool) Add(ctx context.Context, tx *types.Transaction) error {
@@ -460,6 +683,9 @@ func (pool *TxPool) AddBatch(ctx context.Context, txs []*types.Transaction) {
 // GetTransaction returns a transaction if it is contained in the pool
 // and nil otherwise.
 func (pool *TxPool) GetTransaction(hash common.Hash) *types.Transaction {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
 	// check the txs first
 	if tx, ok := pool.pending[hash]; ok {
 		return tx
@@ -467,6 +693,53 @@ func (pool *TxPool) GetTransaction(hash common.Hash) *types.Transaction {
 	return nil
 }
 
+// txDropped is the error of the status of a transaction relayed by the pool
+// which is no longer known by the servers.
+const txDropped = "dropped by the servers"
+
+// Status returns the status of the given transactions. Transactions found mined
+// by the pool are reported from the local database, the others are looked up
+// from the servers. A pending transaction of the pool which is unknown to the
+// servers has been dropped, its status is unknown with an error saying so.
+func (pool *TxPool) Status(ctx context.Context, hashes []common.Hash) ([]TxStatus, error) {
+	var (
+		status  = make([]TxStatus, len(hashes))
+		pending = make(map[common.Hash]bool)
+		lookup  []common.Hash
+		index   []int
+	)
+	pool.mu.RLock()
+	for i, hash := range hashes {
+		if blockHash, number, txIndex := rawdb.ReadTxLookupEntry(pool.chainDb, hash); blockHash != (common.Hash{}) {
+			status[i] = TxStatus{
+				Status: core.TxStatusIncluded,
+				Lookup: &rawdb.TxLookupEntry{BlockHash: blockHash, BlockIndex: number, Index: txIndex},
+			}
+			continue
+		}
+		if _, ok := pool.pending[hash]; ok {
+			pending[hash] = true
+		}
+		lookup, index = append(lookup, hash), append(index, i)
+	}
+	pool.mu.RUnlock()
+
+	if len(lookup) == 0 {
+		return status, nil
+	}
+	req := &TxStatusRequest{Hashes: lookup}
+	if err := pool.odr.FastRetrieve(ctx, req); err != nil {
+		return nil, err
+	}
+	for j, i := range index {
+		status[i] = req.Status[j]
+		if status[i].Status == core.TxStatusUnknown && pending[lookup[j]] {
+			status[i].Error = txDropped
+		}
+	}
+	return status, nil
+}
+
 // GetTransactions returns all currently processable transactions.
 // The returned slice may be modified by the caller.
 func (pool *TxPool) GetTransactions() (txs types.Transactions, err error) {
@@ -494,6 +767,9 @@ func (pool *TxPool) Content() (map[common.Address]types.Transactions, map[common
 		account, _ := types.Sender(pool.signer, tx)
 		pending[account] = append(pending[account], tx)
 	}
+	for _, txs := range pending {
+		sort.Sort(types.TxByNonce(txs))
+	}
 	// There are no queued transactions in a light pool, just return an empty map
 	queued := make(map[common.Address]types.Transactions)
 	return pending, queued
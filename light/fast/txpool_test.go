@@ -0,0 +1,315 @@
+// Copyright 2016 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package fast
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"testing"
+
+	"truechain/discovery/common"
+	"truechain/discovery/consensus/minerva"
+	"truechain/discovery/core"
+	"truechain/discovery/core/types"
+	"truechain/discovery/crypto"
+	"truechain/discovery/etruedb"
+	"truechain/discovery/light/public"
+	"truechain/discovery/params"
+)
+
+// testChainConfig is the chain configuration of the test pools, with the staking
+// forks scheduled after the blocks the tests use.
+var testChainConfig = func() *params.ChainConfig {
+	config := *params.AllMinervaProtocolChanges
+	config.TIP7 = &params.BlockConfig{FastNumber: big.NewInt(10000)}
+	config.TIP8 = &params.BlockConfig{FastNumber: big.NewInt(1000), CID: big.NewInt(10)}
+	config.TIP9 = &params.BlockConfig{SnailNumber: big.NewInt(1000)}
+	config.TIP10 = &params.BlockConfig{FastNumber: big.NewInt(1000)}
+	return &config
+}()
+
+// testOdr is an ODR backend of a database holding the whole state, so the pool
+// never has to retrieve anything.
+type testOdr struct {
+	db etruedb.Database
+}
+
+func (odr *testOdr) Database() etruedb.Database           { return odr.db }
+func (odr *testOdr) BloomTrieIndexer() *core.ChainIndexer { return nil }
+func (odr *testOdr) BloomIndexer() *core.ChainIndexer     { return nil }
+func (odr *testOdr) FastIndexerConfig() *public.IndexerConfig {
+	return public.DefaultClientIndexerConfig
+}
+func (odr *testOdr) FastRetrieve(ctx context.Context, req OdrRequest) error {
+	return errors.New("not available")
+}
+
+// testTxRelay records the transactions discarded by the pool.
+type testTxRelay struct {
+	discarded []common.Hash
+}
+
+func (r *testTxRelay) Send(txs types.Transactions)                                           {}
+func (r *testTxRelay) NewHead(head common.Hash, mined []common.Hash, rollback []common.Hash) {}
+func (r *testTxRelay) Discard(hashes []common.Hash) {
+	r.discarded = append(r.discarded, hashes...)
+}
+
+// newTestTxPool creates a light transaction pool on a chain whose genesis funds
+// the given number of senders.
+func newTestTxPool(t *testing.T, senders int) (*TxPool, *testTxRelay, []*ecdsa.PrivateKey) {
+	var (
+		db    = etruedb.NewMemDatabase()
+		keys  = make([]*ecdsa.PrivateKey, senders)
+		alloc = make(types.GenesisAlloc)
+	)
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+		alloc[crypto.PubkeyToAddress(keys[i].PublicKey)] = types.GenesisAccount{Balance: big.NewInt(params.Ether)}
+	}
+	genesis := &core.Genesis{Config: testChainConfig, GasLimit: 10000000, Alloc: alloc}
+	genesis.MustFastCommit(db)
+
+	chain, err := NewLightChain(&testOdr{db: db}, testChainConfig, minerva.NewFaker(), nil)
+	if err != nil {
+		t.Fatalf("failed to create light chain: %v", err)
+	}
+	relay := new(testTxRelay)
+	pool := NewTxPool(testChainConfig, chain, relay)
+	t.Cleanup(pool.Stop)
+	return pool, relay, keys
+}
+
+// pricedTransaction creates a value transfer of the given sender, nonce and gas
+// price.
+func pricedTransaction(pool *TxPool, key *ecdsa.PrivateKey, nonce uint64, price int64) *types.Transaction {
+	tx, _ := types.SignTx(types.NewTransaction(nonce, common.Address{}, big.NewInt(100), 21000, big.NewInt(price), nil), pool.signer, key)
+	return tx
+}
+
+// testPoolAdd is a transaction added to the pool and the expected result.
+type testPoolAdd struct {
+	sender int
+	nonce  uint64
+	err    error
+}
+
+// Tests that the per sender and global pending limits reject transactions, or
+// evict the highest nonce transaction of the sender with the most pending ones
+// and roll back its pending nonce.
+func TestTxPoolPendingLimits(t *testing.T) {
+	tests := []struct {
+		name            string
+		account, global uint64
+		adds            []testPoolAdd
+		pending         []int    // pending transactions per sender
+		nonces          []uint64 // pending nonce per sender
+		evicted         []uint64 // nonces of the first sender's evicted transactions
+	}{
+		{
+			name:    "unlimited",
+			adds:    []testPoolAdd{{0, 0, nil}, {0, 1, nil}, {0, 2, nil}, {1, 0, nil}},
+			pending: []int{3, 1},
+			nonces:  []uint64{3, 1},
+		},
+		{
+			name:    "account limit",
+			account: 2,
+			adds:    []testPoolAdd{{0, 0, nil}, {0, 1, nil}, {0, 2, ErrAccountLimitExceeded}, {1, 0, nil}, {1, 1, nil}},
+			pending: []int{2, 2},
+			nonces:  []uint64{2, 2},
+		},
+		{
+			name:    "global eviction",
+			global:  3,
+			adds:    []testPoolAdd{{0, 0, nil}, {0, 1, nil}, {0, 2, nil}, {1, 0, nil}},
+			pending: []int{2, 1},
+			nonces:  []uint64{2, 1},
+			evicted: []uint64{2},
+		},
+		{
+			name:    "global eviction twice",
+			global:  4,
+			adds:    []testPoolAdd{{0, 0, nil}, {0, 1, nil}, {0, 2, nil}, {0, 3, nil}, {1, 0, nil}, {2, 0, nil}},
+			pending: []int{2, 1, 1},
+			nonces:  []uint64{2, 1, 1},
+			evicted: []uint64{3, 2},
+		},
+		{
+			name:    "global full",
+			global:  2,
+			adds:    []testPoolAdd{{0, 0, nil}, {1, 0, nil}, {2, 0, ErrTxPoolFull}},
+			pending: []int{1, 1, 0},
+			nonces:  []uint64{1, 1, 0},
+		},
+		{
+			name:    "global full without heavier sender",
+			global:  3,
+			adds:    []testPoolAdd{{0, 0, nil}, {0, 1, nil}, {1, 0, nil}, {1, 1, ErrTxPoolFull}},
+			pending: []int{2, 1},
+			nonces:  []uint64{2, 1},
+		},
+		{
+			name:    "account limit before eviction",
+			account: 2,
+			global:  3,
+			adds:    []testPoolAdd{{0, 0, nil}, {0, 1, nil}, {1, 0, nil}, {0, 2, ErrAccountLimitExceeded}},
+			pending: []int{2, 1},
+			nonces:  []uint64{2, 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool, relay, keys := newTestTxPool(t, len(tt.pending))
+			pool.SetPendingLimits(tt.account, tt.global)
+
+			txs := make(map[common.Hash]uint64)
+			for i, add := range tt.adds {
+				tx := pricedTransaction(pool, keys[add.sender], add.nonce, 1000)
+				if add.sender == 0 {
+					txs[tx.Hash()] = add.nonce
+				}
+				if err := pool.Add(context.Background(), tx); err != add.err {
+					t.Fatalf("add %d: error mismatch: have %v, want %v", i, err, add.err)
+				}
+			}
+			content, _ := pool.Content()
+			for i, key := range keys {
+				addr := crypto.PubkeyToAddress(key.PublicKey)
+				if n := len(content[addr]); n != tt.pending[i] {
+					t.Errorf("sender %d: pending mismatch: have %d, want %d", i, n, tt.pending[i])
+				}
+				if nonce := pool.nonce[addr]; nonce != tt.nonces[i] {
+					t.Errorf("sender %d: pending nonce mismatch: have %d, want %d", i, nonce, tt.nonces[i])
+				}
+			}
+			if len(relay.discarded) != len(tt.evicted) {
+				t.Fatalf("evicted count mismatch: have %d, want %d", len(relay.discarded), len(tt.evicted))
+			}
+			for i, hash := range relay.discarded {
+				if nonce, ok := txs[hash]; !ok || nonce != tt.evicted[i] {
+					t.Errorf("eviction %d: have nonce %d (known %v), want %d", i, nonce, ok, tt.evicted[i])
+				}
+			}
+		})
+	}
+}
+
+// Tests that a pending transaction is only replaced by one with the same nonce
+// paying at least the price bump more.
+func TestTxPoolReplacement(t *testing.T) {
+	tests := []struct {
+		bump  uint64
+		price int64
+		err   error
+	}{
+		{10, 900, core.ErrReplaceUnderpriced},
+		{10, 1000, core.ErrReplaceUnderpriced},
+		{10, 1099, core.ErrReplaceUnderpriced},
+		{10, 1100, nil},
+		{10, 2000, nil},
+		{0, 1000, core.ErrReplaceUnderpriced},
+		{0, 1001, nil},
+		{100, 1999, core.ErrReplaceUnderpriced},
+		{100, 2000, nil},
+	}
+	for i, tt := range tests {
+		pool, relay, keys := newTestTxPool(t, 1)
+		pool.SetPriceBump(tt.bump)
+
+		old := pricedTransaction(pool, keys[0], 0, 1000)
+		if err := pool.Add(context.Background(), old); err != nil {
+			t.Fatalf("test %d: failed to add original transaction: %v", i, err)
+		}
+		// Transfer a different value, so that an equal price doesn't make it the
+		// same transaction
+		tx, _ := types.SignTx(types.NewTransaction(0, common.Address{}, big.NewInt(200), 21000, big.NewInt(tt.price), nil), pool.signer, keys[0])
+		if err := pool.Add(context.Background(), tx); err != tt.err {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+			continue
+		}
+		want, dropped := old, tx
+		if tt.err == nil {
+			want, dropped = tx, old
+			if len(relay.discarded) != 1 || relay.discarded[0] != old.Hash() {
+				t.Errorf("test %d: replaced transaction not discarded: %x", i, relay.discarded)
+			}
+		}
+		if pool.GetTransaction(want.Hash()) == nil {
+			t.Errorf("test %d: transaction with price %v not pending", i, want.GasPrice())
+		}
+		if pool.GetTransaction(dropped.Hash()) != nil {
+			t.Errorf("test %d: transaction with price %v still pending", i, dropped.GasPrice())
+		}
+		if pending := pool.Stats(); pending != 1 {
+			t.Errorf("test %d: pending mismatch: have %d, want 1", i, pending)
+		}
+	}
+}
+
+// testPriceOracle suggests a fixed gas price.
+type testPriceOracle struct {
+	price *big.Int
+}
+
+func (o testPriceOracle) SuggestPrice(ctx context.Context) (*big.Int, error) { return o.price, nil }
+
+// Tests that transactions priced outside of the configured or derived bounds
+// are rejected.
+func TestTxPoolPriceBounds(t *testing.T) {
+	tests := []struct {
+		min, max *big.Int
+		oracle   PriceOracle
+		price    int64
+		err      error
+	}{
+		// Configured bounds, inclusive
+		{big.NewInt(100), big.NewInt(1000), nil, 99, core.ErrUnderpriced},
+		{big.NewInt(100), big.NewInt(1000), nil, 100, nil},
+		{big.NewInt(100), big.NewInt(1000), nil, 1000, nil},
+		{big.NewInt(100), big.NewInt(1000), nil, 1001, ErrGasPriceTooHigh},
+
+		// No bounds and no oracle
+		{nil, nil, nil, 1, nil},
+		{nil, nil, nil, 1000000, nil},
+
+		// Bounds derived from a suggested price of 100: 10 and 10000
+		{nil, nil, testPriceOracle{big.NewInt(100)}, 9, core.ErrUnderpriced},
+		{nil, nil, testPriceOracle{big.NewInt(100)}, 10, nil},
+		{nil, nil, testPriceOracle{big.NewInt(100)}, 10000, nil},
+		{nil, nil, testPriceOracle{big.NewInt(100)}, 10001, ErrGasPriceTooHigh},
+
+		// A configured bound takes precedence over the derived one
+		{big.NewInt(50), nil, testPriceOracle{big.NewInt(100)}, 49, core.ErrUnderpriced},
+		{big.NewInt(50), nil, testPriceOracle{big.NewInt(100)}, 10001, ErrGasPriceTooHigh},
+		{nil, big.NewInt(200), testPriceOracle{big.NewInt(100)}, 9, core.ErrUnderpriced},
+		{nil, big.NewInt(200), testPriceOracle{big.NewInt(100)}, 201, ErrGasPriceTooHigh},
+
+		// Nothing is derived from an unusable suggestion
+		{nil, nil, testPriceOracle{big.NewInt(0)}, 1, nil},
+	}
+	for i, tt := range tests {
+		pool, _, keys := newTestTxPool(t, 1)
+		pool.SetPriceBounds(tt.min, tt.max, tt.oracle)
+
+		if err := pool.Add(context.Background(), pricedTransaction(pool, keys[0], 0, tt.price)); err != tt.err {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package fast
+
+import (
+	"context"
+
+	"truechain/discovery/common"
+	"truechain/discovery/core"
+	"truechain/discovery/core/rawdb"
+	"truechain/discovery/event"
+	"truechain/discovery/log"
+)
+
+// WatchedTx is the last known position of a watched transaction. Watched
+// transactions don't need to be created locally.
+type WatchedTx struct {
+	Hash        common.Hash `json:"hash"`
+	BlockHash   common.Hash `json:"blockHash"` // zero if not (or no longer) included
+	BlockNumber uint64      `json:"blockNumber"`
+	Reorged     bool        `json:"reorged"` // set once the transaction has been rolled back
+}
+
+// TxReorgEvent is posted when a watched, previously included transaction is
+// rolled back by a reorg (Reorged is true) or when such a transaction has been
+// included again afterwards (Reorged is false).
+type TxReorgEvent struct {
+	Hash        common.Hash `json:"hash"`
+	BlockHash   common.Hash `json:"blockHash"`
+	BlockNumber uint64      `json:"blockNumber"`
+	Reorged     bool        `json:"reorged"`
+}
+
+// Watch starts watching a transaction. If the transaction is included in the
+// canonical chain and later rolled back by a reorg, a TxReorgEvent is posted.
+func (pool *TxPool) Watch(ctx context.Context, hash common.Hash) error {
+	wtx := &WatchedTx{Hash: hash}
+	if err := pool.lookupWatched(ctx, []*WatchedTx{wtx}); err != nil {
+		return err
+	}
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	pool.watched[hash] = wtx
+	return nil
+}
+
+// Unwatch stops watching a transaction. It returns false if the transaction
+// was not watched.
+func (pool *TxPool) Unwatch(hash common.Hash) bool {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	if _, ok := pool.watched[hash]; !ok {
+		return false
+	}
+	delete(pool.watched, hash)
+	return true
+}
+
+// Watched returns the last known positions of all watched transactions.
+func (pool *TxPool) Watched() []WatchedTx {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	list := make([]WatchedTx, 0, len(pool.watched))
+	for _, wtx := range pool.watched {
+		list = append(list, *wtx)
+	}
+	return list
+}
+
+// SubscribeTxReorgEvent registers a subscription of TxReorgEvent and starts
+// sending events to the given channel.
+func (pool *TxPool) SubscribeTxReorgEvent(ch chan<- TxReorgEvent) event.Subscription {
+	return pool.scope.Track(pool.reorgFeed.Subscribe(ch))
+}
+
+// lookupWatched retrieves the position of the given transactions from the
+// network. Only positions in the local canonical chain are accepted.
+func (pool *TxPool) lookupWatched(ctx context.Context, list []*WatchedTx) error {
+	req := &TxStatusRequest{Hashes: make([]common.Hash, len(list))}
+	for i, wtx := range list {
+		req.Hashes[i] = wtx.Hash
+	}
+	if err := pool.odr.FastRetrieve(ctx, req); err != nil {
+		return err
+	}
+	for i, wtx := range list {
+		status := req.Status[i]
+		if status.Status != core.TxStatusIncluded || status.Lookup == nil {
+			continue
+		}
+		pos := status.Lookup
+		if rawdb.ReadCanonicalHash(pool.chainDb, pos.BlockIndex) != pos.BlockHash {
+			continue
+		}
+		wtx.BlockHash, wtx.BlockNumber = pos.BlockHash, pos.BlockIndex
+	}
+	return nil
+}
+
+// rollbackWatched marks the watched transactions included in the rolled back
+// blocks and queues an event for each of them.
+func (pool *TxPool) rollbackWatched(hashes []common.Hash) {
+	if len(pool.watched) == 0 || len(hashes) == 0 {
+		return
+	}
+	rolledBack := make(map[common.Hash]struct{}, len(hashes))
+	for _, hash := range hashes {
+		rolledBack[hash] = struct{}{}
+	}
+	for _, wtx := range pool.watched {
+		if _, ok := rolledBack[wtx.BlockHash]; !ok || wtx.BlockHash == (common.Hash{}) {
+			continue
+		}
+		log.Warn("Watched transaction rolled back", "hash", wtx.Hash, "block", wtx.BlockHash, "number", wtx.BlockNumber)
+		pool.reorgEvents = append(pool.reorgEvents, TxReorgEvent{Hash: wtx.Hash, BlockHash: wtx.BlockHash, BlockNumber: wtx.BlockNumber, Reorged: true})
+		wtx.BlockHash, wtx.BlockNumber, wtx.Reorged = common.Hash{}, 0, true
+	}
+}
+
+// checkWatched looks up the watched transactions which are not included in the
+// canonical chain at the moment, queueing an event for those which have been
+// included again after a reorg.
+func (pool *TxPool) checkWatched(ctx context.Context) error {
+	var list []*WatchedTx
+	for _, wtx := range pool.watched {
+		if wtx.BlockHash == (common.Hash{}) {
+			list = append(list, wtx)
+		}
+	}
+	if len(list) == 0 {
+		return nil
+	}
+	if err := pool.lookupWatched(ctx, list); err != nil {
+		return err
+	}
+	for _, wtx := range list {
+		if wtx.Reorged && wtx.BlockHash != (common.Hash{}) {
+			log.Info("Watched transaction included again", "hash", wtx.Hash, "block", wtx.BlockHash, "number", wtx.BlockNumber)
+			pool.reorgEvents = append(pool.reorgEvents, TxReorgEvent{Hash: wtx.Hash, BlockHash: wtx.BlockHash, BlockNumber: wtx.BlockNumber})
+		}
+	}
+	return nil
+}
@@ -238,6 +238,19 @@ func (lc *LightChain) GetBody(ctx context.Context, hash common.Hash) (*types.Sna
 	return body, nil
 }
 
+// GetFruitHeaders retrieves the headers of the fruits included in a block from
+// the database or ODR service by hash.
+func (lc *LightChain) GetFruitHeaders(ctx context.Context, hash common.Hash) ([]*types.SnailHeader, error) {
+	if cached, ok := lc.bodyCache.Get(hash); ok {
+		return cached.(*types.SnailBody).FruitsHeaders(), nil
+	}
+	number := lc.hc.GetBlockNumber(hash)
+	if number == nil {
+		return nil, errors.New("unknown block")
+	}
+	return GetFruitHeaders(ctx, lc.odr, hash, *number)
+}
+
 // GetBodyRLP retrieves a block body in RLP encoding from the database or
 // ODR service by hash, caching it if found.
 func (lc *LightChain) GetBodyRLP(ctx context.Context, hash common.Hash) (rlp.RawValue, error) {
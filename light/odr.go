@@ -64,6 +64,18 @@ func (req *BlockRequest) StoreResult(db etruedb.Database) {
 	rawdb.WriteBodyRLP(db, req.Hash, req.Number, req.Rlp)
 }
 
+// FruitHeadersRequest is the ODR request type for retrieving the headers of the
+// fruits included in a snail block, without the whole fruits
+type FruitHeadersRequest struct {
+	OdrRequest
+	Hash    common.Hash
+	Number  uint64
+	Headers []*types.SnailHeader
+}
+
+// StoreResult is a no-op, only whole bodies are stored in the database
+func (req *FruitHeadersRequest) StoreResult(db etruedb.Database) {}
+
 // ChtRequest is the ODR request type for state/storage trie entries
 type ChtRequest struct {
 	OdrRequest
@@ -108,17 +120,22 @@ func (req *ChtRequest) StoreResult(db etruedb.Database) {
 		}
 	}
 
+	// The fast header is only delivered with the start of a checkpoint sync
+	if req.FHeader == nil {
+		return
+	}
 	fhash, fnum := req.FHeader.Hash(), req.FHeader.Number.Uint64()
 	fastDB.WriteHeader(db, req.FHeader)
 	fastDB.WriteCanonicalHash(db, fhash, fnum)
 	fastDB.WriteHeadHeaderHash(db, fhash)
 }
 
-// BlockRequest is the ODR request type for retrieving block bodies
+// FruitRequest is the ODR request type for retrieving fruit bodies
 type FruitRequest struct {
 	OdrRequest
 	Hash   common.Hash
 	Number uint64
+	Header *types.SnailHeader // Fruit header the body is validated against, read from the database if nil
 	Rlp    []byte
 }
 
@@ -140,6 +140,20 @@ func GetBlock(ctx context.Context, odr OdrBackend, hash common.Hash, number uint
 	return types.NewSnailBlockWithHeader(header).WithBody(body.Fruits, nil), nil
 }
 
+// GetFruitHeaders retrieves the headers of the fruits included in a snail block,
+// validated against the fruits hash of the block header. The headers are taken
+// from the body if it's already stored.
+func GetFruitHeaders(ctx context.Context, odr OdrBackend, hash common.Hash, number uint64) ([]*types.SnailHeader, error) {
+	if body := rawdb.ReadBody(odr.Database(), hash, number); body != nil {
+		return body.FruitsHeaders(), nil
+	}
+	r := &FruitHeadersRequest{Hash: hash, Number: number}
+	if err := odr.Retrieve(ctx, r); err != nil {
+		return nil, err
+	}
+	return r.Headers, nil
+}
+
 // GetFruitBody retrieves the fruit body (transactons, uncles) corresponding to the
 // hash.
 func GetFruitBody(ctx context.Context, odr OdrBackend, hash common.Hash, number uint64) (*types.SnailBody, error) {
@@ -20,8 +20,10 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"strconv"
 	"time"
 
+	"golang.org/x/net/proxy"
 	"truechain/discovery/log"
 	"truechain/discovery/p2p/enode"
 	"truechain/discovery/p2p/netutil"
@@ -60,10 +62,39 @@ type TCPDialer struct {
 
 // Dial creates a TCP connection to the node
 func (t TCPDialer) Dial(dest *enode.Node) (net.Conn, error) {
+	if dest.Onion() != "" {
+		return nil, errOnionNoProxy
+	}
 	addr := &net.TCPAddr{IP: dest.IP(), Port: dest.TCP()}
 	return t.Dialer.Dial("tcp", addr.String())
 }
 
+// ProxyDialer implements the NodeDialer interface by connecting to nodes
+// through a SOCKS5 proxy such as Tor. Nodes with an onion service address can
+// only be reached this way.
+type ProxyDialer struct {
+	proxy.Dialer
+}
+
+// NewProxyDialer creates a dialer connecting through the SOCKS5 proxy listening
+// at the given address.
+func NewProxyDialer(addr string, timeout time.Duration) (*ProxyDialer, error) {
+	dialer, err := proxy.SOCKS5("tcp", addr, nil, &net.Dialer{Timeout: timeout})
+	if err != nil {
+		return nil, err
+	}
+	return &ProxyDialer{dialer}, nil
+}
+
+// Dial creates a TCP connection to the node through the proxy
+func (t ProxyDialer) Dial(dest *enode.Node) (net.Conn, error) {
+	port := strconv.Itoa(dest.TCP())
+	if onion := dest.Onion(); onion != "" {
+		return t.Dialer.Dial("tcp", net.JoinHostPort(onion, port))
+	}
+	return t.Dialer.Dial("tcp", net.JoinHostPort(dest.IP().String(), port))
+}
+
 // dialstate schedules dials and discovery lookups.
 // It gets a chance to compute new tasks on every iteration
 // of the main loop in Server.run.
@@ -250,6 +281,7 @@ var (
 	errAlreadyConnected = errors.New("already connected")
 	errRecentlyDialed   = errors.New("recently dialed")
 	errNotWhitelisted   = errors.New("not contained in netrestrict whitelist")
+	errOnionNoProxy     = errors.New("onion service address requires a proxy")
 )
 
 func (s *dialstate) checkDial(n *enode.Node, peers map[enode.ID]*Peer) error {
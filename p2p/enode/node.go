@@ -90,9 +90,9 @@ func (n *Node) Seq() uint64 {
 	return n.r.Seq()
 }
 
-// Incomplete returns true for nodes with no IP address.
+// Incomplete returns true for nodes with no IP or onion service address.
 func (n *Node) Incomplete() bool {
-	return n.IP() == nil
+	return n.IP() == nil && n.Onion() == ""
 }
 
 // Load retrieves an entry from the underlying record.
@@ -115,6 +115,13 @@ func (n *Node) IP() net.IP {
 	return nil
 }
 
+// Onion returns the Tor onion service address of the node, if present.
+func (n *Node) Onion() string {
+	var onion enr.Onion
+	n.Load(&onion)
+	return string(onion)
+}
+
 // UDP returns the UDP port of the node.
 func (n *Node) UDP() int {
 	var port enr.UDP
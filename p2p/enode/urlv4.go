@@ -25,6 +25,7 @@ import (
 	"net/url"
 	"regexp"
 	"strconv"
+	"strings"
 
 	"truechain/discovery/common/math"
 	"truechain/discovery/crypto"
@@ -57,6 +58,8 @@ func MustParseV4(rawurl string) *Node {
 // For complete nodes, the node ID is encoded in the username portion
 // of the URL, separated from the host by an @ sign. The hostname can
 // only be given as an IP address, DNS domain names are not allowed.
+// The only exception are Tor onion service addresses ending in ".onion",
+// which can only be dialed through a proxy.
 // The port in the host name section is the TCP listening port. If the
 // TCP and UDP (discovery) ports differ, the UDP port is specified as
 // query parameter "discport".
@@ -98,6 +101,27 @@ func NewV4(pubkey *ecdsa.PublicKey, ip net.IP, tcp, udp int) *Node {
 	return n
 }
 
+// NewOnionV4 creates a node reachable through a Tor onion service. The record
+// contained in the node has a zero-length signature.
+func NewOnionV4(pubkey *ecdsa.PublicKey, onion string, tcp int) *Node {
+	var r enr.Record
+	r.Set(enr.Onion(onion))
+	if tcp != 0 {
+		r.Set(enr.TCP(tcp))
+	}
+	signV4Compat(&r, pubkey)
+	n, err := New(v4CompatID{}, &r)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+// IsOnion returns true if the host name is a Tor onion service address.
+func IsOnion(host string) bool {
+	return strings.HasSuffix(host, ".onion")
+}
+
 // isNewV4 returns true for nodes created by NewV4.
 func isNewV4(n *Node) bool {
 	var k s256raw
@@ -124,6 +148,13 @@ func parseComplete(rawurl string) (*Node, error) {
 	if id, err = parsePubkey(u.User.String()); err != nil {
 		return nil, fmt.Errorf("invalid public key (%v)", err)
 	}
+	// Onion services have no IP address, they are dialed through a proxy.
+	if IsOnion(u.Hostname()) {
+		if tcpPort, err = strconv.ParseUint(u.Port(), 10, 16); err != nil {
+			return nil, errors.New("invalid port")
+		}
+		return NewOnionV4(id, u.Hostname(), int(tcpPort)), nil
+	}
 	// Parse the IP address.
 	ips, err := net.LookupIP(u.Hostname())
 	if err != nil {
@@ -178,6 +209,9 @@ func (n *Node) URLv4() string {
 	u := url.URL{Scheme: "enode"}
 	if n.Incomplete() {
 		u.Host = nodeid
+	} else if onion := n.Onion(); onion != "" {
+		u.User = url.User(nodeid)
+		u.Host = net.JoinHostPort(onion, strconv.Itoa(n.TCP()))
 	} else {
 		addr := net.TCPAddr{IP: n.IP(), Port: n.TCP()}
 		u.User = url.User(nodeid)
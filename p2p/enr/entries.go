@@ -166,6 +166,12 @@ func (v *IPv6) DecodeRLP(s *rlp.Stream) error {
 	return nil
 }
 
+// Onion is the "onion" key, which holds the Tor onion service address of the
+// node. Onion service nodes have no IP address, they are dialed through a proxy.
+type Onion string
+
+func (v Onion) ENRKey() string { return "onion" }
+
 // KeyError is an error related to a key.
 type KeyError struct {
 	Key string
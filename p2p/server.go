@@ -46,6 +46,9 @@ import (
 const (
 	defaultDialTimeout = 15 * time.Second
 
+	// Dials through a proxy such as Tor take considerably longer.
+	defaultProxyDialTimeout = 60 * time.Second
+
 	// Connectivity defaults.
 	maxActiveDialTasks     = 16
 	defaultMaxPendingPeers = 50
@@ -143,6 +146,11 @@ type Config struct {
 	// is used to dial outbound peer connections.
 	Dialer NodeDialer `toml:"-"`
 
+	// Proxy is the address of a SOCKS5 proxy (e.g. Tor) used to dial outbound
+	// peer connections if no Dialer is set. Nodes with an onion service address
+	// can only be dialed through a proxy.
+	Proxy string `toml:",omitempty"`
+
 	// If NoDial is true, the server will not dial any peers.
 	NoDial bool `toml:",omitempty"`
 
@@ -448,6 +456,13 @@ func (srv *Server) Start() (err error) {
 	if srv.listenFunc == nil {
 		srv.listenFunc = net.Listen
 	}
+	if srv.Dialer == nil && srv.Proxy != "" {
+		dialer, err := NewProxyDialer(srv.Proxy, defaultProxyDialTimeout)
+		if err != nil {
+			return err
+		}
+		srv.Dialer = dialer
+	}
 	if srv.Dialer == nil {
 		srv.Dialer = TCPDialer{&net.Dialer{Timeout: defaultDialTimeout}}
 	}
@@ -47,6 +47,11 @@ var TrustedCheckpoints = map[common.Hash]*TrustedCheckpoint{
 	DevnetSnailGenesisHash:  DevnetTrustedCheckpoint,
 }
 
+// CheckpointOracles associates each known checkpoint oracle with the genesis
+// hash of the chain it belongs to. Only oracles deployed on a TrueChain network
+// and administered by TrueChain signers belong here, none is deployed yet.
+var CheckpointOracles = map[common.Hash]*CheckpointOracleConfig{}
+
 var (
 	// MainnetChainConfig is the chain parameters to run a node on the main network.
 	MainnetChainConfig = &ChainConfig{
@@ -228,6 +233,16 @@ type CheckpointOracleConfig struct {
 	Threshold uint64           `json:"threshold"`
 }
 
+// IsSigner returns whether the given address belongs to the admin signer set.
+func (c *CheckpointOracleConfig) IsSigner(addr common.Address) bool {
+	for _, signer := range c.Signers {
+		if signer == addr {
+			return true
+		}
+	}
+	return false
+}
+
 // ChainConfig is the core config which determines the blockchain settings.
 //
 // ChainConfig is stored in the database on a per block basis. This means
@@ -263,12 +278,23 @@ func (c *ChainConfig) UnmarshalJSON(input []byte) error {
 		ChainID *big.Int `json:"chainId"` // chainId identifies the current chain and is used for replay protection
 
 		Minerva *MinervaConfig `json:"minerva"`
+
+		TIP3     *BlockConfig `json:"tip3"`
+		TIP5     *BlockConfig `json:"tip5"`
+		TIP7     *BlockConfig `json:"tip7"`
+		TIP8     *BlockConfig `json:"tip8"`
+		TIP9     *BlockConfig `json:"tip9"`
+		TIP10    *BlockConfig `json:"tip10"`
+		TIP11    *BlockConfig `json:"tip11"`
+		TIPStake *BlockConfig `json:"tipstake"`
 	}
 	var dec ChainConfig
 	if err := json.Unmarshal(input, &dec); err != nil {
 		return err
 	}
 	c.ChainID = dec.ChainID
+	c.TIP3, c.TIP5, c.TIP7, c.TIP8 = dec.TIP3, dec.TIP5, dec.TIP7, dec.TIP8
+	c.TIP9, c.TIP10, c.TIP11, c.TIPStake = dec.TIP9, dec.TIP10, dec.TIP11, dec.TIPStake
 	if dec.Minerva == nil {
 		c.Minerva = &(MinervaConfig{
 			MinimumDifficulty:      MinimumDifficulty,
@@ -360,14 +386,26 @@ func (c *ChainConfig) String() string {
 }
 
 // CheckCompatible checks whether scheduled fork transitions have been imported
-// with a mismatching chain configuration.
+// with a mismatching chain configuration. The fast fork blocks are checked
+// against the given fast chain height.
 func (c *ChainConfig) CheckCompatible(newcfg *ChainConfig, height uint64) *ConfigCompatError {
+	return c.checkLowest(newcfg, height, false)
+}
+
+// CheckSnailCompatible checks whether scheduled fork transitions have been
+// imported with a mismatching chain configuration. The snail fork blocks are
+// checked against the given snail chain height.
+func (c *ChainConfig) CheckSnailCompatible(newcfg *ChainConfig, height uint64) *ConfigCompatError {
+	return c.checkLowest(newcfg, height, true)
+}
+
+func (c *ChainConfig) checkLowest(newcfg *ChainConfig, height uint64, snail bool) *ConfigCompatError {
 	bhead := new(big.Int).SetUint64(height)
 
 	// Iterate checkCompatible to find the lowest conflict.
 	var lasterr *ConfigCompatError
 	for {
-		err := c.checkCompatible(newcfg, bhead)
+		err := c.checkCompatible(newcfg, bhead, snail)
 		if err == nil || (lasterr != nil && err.RewindTo == lasterr.RewindTo) {
 			break
 		}
@@ -377,10 +415,44 @@ func (c *ChainConfig) CheckCompatible(newcfg *ChainConfig, height uint64) *Confi
 	return lasterr
 }
 
-func (c *ChainConfig) checkCompatible(newcfg *ChainConfig, head *big.Int) *ConfigCompatError {
+func (c *ChainConfig) checkCompatible(newcfg *ChainConfig, head *big.Int, snail bool) *ConfigCompatError {
+	stored, proposed := c.tipForks(), newcfg.tipForks()
+	for i, fork := range stored {
+		s1, s2 := fork.block.FastNumber, proposed[i].block.FastNumber
+		what := fork.name + " fork block"
+		if snail {
+			s1, s2 = fork.block.SnailNumber, proposed[i].block.SnailNumber
+			what = fork.name + " fork snail block"
+		}
+		if isForkIncompatible(s1, s2, head) {
+			return newCompatError(what, s1, s2)
+		}
+	}
 	return nil
 }
 
+// tipFork is a named fork of the chain config. The block config is never nil,
+// an unscheduled fork has no fork blocks.
+type tipFork struct {
+	name  string
+	block *BlockConfig
+}
+
+// tipForks returns the forks of the chain config in activation order. A new
+// fork of the chain config has to be added to the list.
+func (c *ChainConfig) tipForks() []tipFork {
+	forks := []tipFork{
+		{"TIP3", c.TIP3}, {"TIP5", c.TIP5}, {"TIP7", c.TIP7}, {"TIP8", c.TIP8},
+		{"TIP9", c.TIP9}, {"TIP10", c.TIP10}, {"TIP11", c.TIP11}, {"TIPStake", c.TIPStake},
+	}
+	for i := range forks {
+		if forks[i].block == nil {
+			forks[i].block = new(BlockConfig)
+		}
+	}
+	return forks
+}
+
 // isForkIncompatible returns true if a fork scheduled at s1 cannot be rescheduled to
 // block s2 because head is already past the fork.
 func isForkIncompatible(s1, s2, head *big.Int) bool {
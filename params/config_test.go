@@ -17,6 +17,7 @@
 package params
 
 import (
+	"encoding/json"
 	"fmt"
 	"math/big"
 	"reflect"
@@ -32,6 +33,53 @@ func TestCheckCompatible(t *testing.T) {
 	tests := []test{
 		{stored: AllMinervaProtocolChanges, new: AllMinervaProtocolChanges, head: 0, wantErr: nil},
 		{stored: AllMinervaProtocolChanges, new: AllMinervaProtocolChanges, head: 100, wantErr: nil},
+		{
+			stored:  &ChainConfig{TIP7: &BlockConfig{FastNumber: big.NewInt(10)}},
+			new:     &ChainConfig{TIP7: &BlockConfig{FastNumber: big.NewInt(20)}},
+			head:    9,
+			wantErr: nil,
+		},
+		{
+			stored: &ChainConfig{TIP7: &BlockConfig{FastNumber: big.NewInt(10)}},
+			new:    &ChainConfig{TIP7: &BlockConfig{FastNumber: big.NewInt(20)}},
+			head:   25,
+			wantErr: &ConfigCompatError{
+				What:         "TIP7 fork block",
+				StoredConfig: big.NewInt(10),
+				NewConfig:    big.NewInt(20),
+				RewindTo:     9,
+			},
+		},
+		{
+			stored: &ChainConfig{TIP7: &BlockConfig{FastNumber: big.NewInt(30)}},
+			new:    &ChainConfig{},
+			head:   40,
+			wantErr: &ConfigCompatError{
+				What:         "TIP7 fork block",
+				StoredConfig: big.NewInt(30),
+				NewConfig:    nil,
+				RewindTo:     29,
+			},
+		},
+		{
+			// The lowest conflicting fork decides the rewind.
+			stored: &ChainConfig{TIP3: &BlockConfig{FastNumber: big.NewInt(10)}, TIP7: &BlockConfig{FastNumber: big.NewInt(30)}},
+			new:    &ChainConfig{TIP3: &BlockConfig{FastNumber: big.NewInt(5)}, TIP7: &BlockConfig{FastNumber: big.NewInt(35)}},
+			head:   40,
+			wantErr: &ConfigCompatError{
+				What:         "TIP3 fork block",
+				StoredConfig: big.NewInt(10),
+				NewConfig:    big.NewInt(5),
+				RewindTo:     4,
+			},
+		},
+		{
+			// Snail fork blocks are not checked against the fast head.
+			stored:  &ChainConfig{TIP9: &BlockConfig{SnailNumber: big.NewInt(10)}},
+			new:     &ChainConfig{TIP9: &BlockConfig{SnailNumber: big.NewInt(20)}},
+			head:    100,
+			wantErr: nil,
+		},
 	}
 
 	for _, test := range tests {
@@ -41,6 +89,47 @@ func TestCheckCompatible(t *testing.T) {
 		}
 	}
 }
+
+func TestCheckSnailCompatible(t *testing.T) {
+	type test struct {
+		stored, new *ChainConfig
+		head        uint64
+		wantErr     *ConfigCompatError
+	}
+	tests := []test{
+		{
+			stored:  &ChainConfig{TIP9: &BlockConfig{SnailNumber: big.NewInt(10)}},
+			new:     &ChainConfig{TIP9: &BlockConfig{SnailNumber: big.NewInt(20)}},
+			head:    5,
+			wantErr: nil,
+		},
+		{
+			stored: &ChainConfig{TIP9: &BlockConfig{SnailNumber: big.NewInt(10)}},
+			new:    &ChainConfig{TIP9: &BlockConfig{SnailNumber: big.NewInt(20)}},
+			head:   15,
+			wantErr: &ConfigCompatError{
+				What:         "TIP9 fork snail block",
+				StoredConfig: big.NewInt(10),
+				NewConfig:    big.NewInt(20),
+				RewindTo:     9,
+			},
+		},
+		{
+			// Fast fork blocks are not checked against the snail head.
+			stored:  &ChainConfig{TIP7: &BlockConfig{FastNumber: big.NewInt(10)}},
+			new:     &ChainConfig{TIP7: &BlockConfig{FastNumber: big.NewInt(20)}},
+			head:    100,
+			wantErr: nil,
+		},
+	}
+
+	for _, test := range tests {
+		err := test.stored.CheckSnailCompatible(test.new, test.head)
+		if !reflect.DeepEqual(err, test.wantErr) {
+			t.Errorf("error mismatch:\nstored: %v\nnew: %v\nhead: %v\nerr: %v\nwant: %v", test.stored, test.new, test.head, err, test.wantErr)
+		}
+	}
+}
 func TestFork(t *testing.T) {
 	Tip := new(big.Int).SetUint64(30001)
 	cur := new(big.Int).SetUint64(30000)
@@ -48,3 +137,27 @@ func TestFork(t *testing.T) {
 	forked := isForked(Tip, cur)
 	fmt.Println("fork:", forked)
 }
+
+func TestChainConfigJSON(t *testing.T) {
+	config := &ChainConfig{
+		ChainID:  big.NewInt(100),
+		Minerva:  &MinervaConfig{MinimumDifficulty, MinimumFruitDifficulty, DurationLimit},
+		TIP3:     &BlockConfig{FastNumber: big.NewInt(10)},
+		TIP9:     &BlockConfig{SnailNumber: big.NewInt(20)},
+		TIPStake: &BlockConfig{FastNumber: big.NewInt(30)},
+	}
+	enc, err := json.Marshal(config)
+	if err != nil {
+		t.Fatalf("failed to encode config: %v", err)
+	}
+	var dec ChainConfig
+	if err := json.Unmarshal(enc, &dec); err != nil {
+		t.Fatalf("failed to decode config: %v", err)
+	}
+	if !reflect.DeepEqual(&dec, config) {
+		t.Errorf("config mismatch:\nhave %v\nwant %v", &dec, config)
+	}
+	if err := config.CheckCompatible(&dec, 100); err != nil {
+		t.Errorf("decoded config incompatible: %v", err)
+	}
+}